@@ -0,0 +1,99 @@
+package main
+
+import (
+	"math"
+	"strconv"
+)
+
+// Parses the value of --brightness, --contrast or --saturation: a whole number from -100 to 100
+func parseAdjustment(name, value string) (int, error) {
+	amount, err := strconv.Atoi(value)
+	if err != nil || amount < -100 || amount > 100 {
+		return 0, msgError("error.invalid_adjustment", name, value)
+	}
+	return amount, nil
+}
+
+// Parses a --gamma value: a positive number, where 1 leaves the image unchanged
+func parseGamma(value string) (float64, error) {
+	gamma, err := strconv.ParseFloat(value, 64)
+	if err != nil || gamma <= 0 || math.IsInf(gamma, 0) {
+		return 0, msgError("error.invalid_gamma", value)
+	}
+	return gamma, nil
+}
+
+// Returns the table of a tone curve, rounding and clamping its values to 0-255
+func toneCurve(curve func(v float64) float64) *[256]byte {
+	var levels [256]byte
+	for i := range levels {
+		levels[i] = byte(math.Round(math.Max(0, math.Min(curve(float64(i)), 255))))
+	}
+	return &levels
+}
+
+// Shifts every channel by amount percent of the full range
+func brightnessCurve(amount int) *[256]byte {
+	return toneCurve(brightnessLevel(amount))
+}
+
+// Spreads the channels away from the middle gray, or draws them towards it for negative amounts. -100
+// leaves a flat gray and 100 all but the middle level black or white, following the formula most editors use.
+func contrastCurve(amount int) *[256]byte {
+	return toneCurve(contrastLevel(amount))
+}
+
+// Applies a gamma curve; values above 1 brighten the midtones and values below 1 darken them
+func gammaCurve(gamma float64) *[256]byte {
+	return toneCurve(gammaLevel(gamma))
+}
+
+// Curve of brightnessCurve on unrounded levels from 0 to 255, as --precision=16 applies it to the levels
+// between the 8-bit ones; contrastLevel and gammaLevel are those of the other curves
+func brightnessLevel(amount int) func(v float64) float64 {
+	return func(v float64) float64 { return v + float64(amount)*255/100 }
+}
+
+// Curve of contrastCurve
+func contrastLevel(amount int) func(v float64) float64 {
+	c := float64(amount) * 255 / 100
+	factor := 259 * (c + 255) / (255 * (259 - c))
+	return func(v float64) float64 { return factor*(v-128) + 128 }
+}
+
+// Curve of gammaCurve
+func gammaLevel(gamma float64) func(v float64) float64 {
+	return func(v float64) float64 { return 255 * math.Pow(v/255, 1/gamma) }
+}
+
+// Replaces every channel through the table. Pixels stay in place, so alpha and hints are kept.
+func applyCurve(img *Image, levels *[256]byte, progress rowProgress) *Image {
+	result := &Image{Width: img.Width, Height: img.Height, Pixels: make([]Pixel, len(img.Pixels)), Gap: img.Gap, Palette: img.Palette}
+	for y := 0; y < img.Height; y++ {
+		for i := y * img.Width; i < (y+1)*img.Width; i++ {
+			p := img.Pixels[i]
+			result.Pixels[i] = Pixel{Blue: levels[p.Blue], Green: levels[p.Green], Red: levels[p.Red]}
+		}
+		progress.Report(y+1, img.Height)
+	}
+	return result
+}
+
+// Moves every pixel away from its own gray by amount percent, or towards it for negative amounts, so
+// that -100 gives a grayscale image. The gray is the pixel's luminance.
+func applySaturation(img *Image, amount int, progress rowProgress) *Image {
+	result := &Image{Width: img.Width, Height: img.Height, Pixels: make([]Pixel, len(img.Pixels)), Gap: img.Gap, Palette: img.Palette}
+	factor := 1 + float64(amount)/100
+	channel := func(v byte, gray float64) byte {
+		return byte(math.Round(math.Max(0, math.Min(gray+(float64(v)-gray)*factor, 255))))
+	}
+	for y := 0; y < img.Height; y++ {
+		for i := y * img.Width; i < (y+1)*img.Width; i++ {
+			p := img.Pixels[i]
+			gray := float64(p.Luminance()) / 1000
+			result.Pixels[i] = Pixel{Blue: channel(p.Blue, gray), Green: channel(p.Green, gray), Red: channel(p.Red, gray)}
+		}
+		progress.Report(y+1, img.Height)
+	}
+	return result
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Describes a flag of a command, other than the apply options. The parsed value is stored in Target.
+type flagSpec struct {
+	Name    string                   // Flag name without the leading dashes
+	Short   string                   // Single-dash form, such as "-v", if there is one
+	Target  any                      // *string, *[]string, *bool, *int, *int64 or *time.Duration
+	Value   string                   // Set in a *string target by a switch, so that switches can pick one of several modes
+	Choices []string                 // Allowed values of a string flag, if limited
+	Min     int64                    // Smallest allowed number; durations must be positive when Min > 0
+	Check   func(value string) error // Extra validation of a string flag, returning what was expected
+}
+
+// Parses the arguments of a command. Flags and, when withOptions is set, apply options may appear
+// anywhere, before or after the positional arguments, and "--" treats everything after it as positional.
+// Values follow the flag after "=" or as the next argument. Apply options are validated and returned in
+// the order given; a repeated flag keeps its last value, except []string flags, which collect every value.
+func parseCommandLine(args []string, flags []flagSpec, withOptions bool) (options []Option, positional []string, err error) {
+	return parseFlags(args, flags, withOptions, false)
+}
+
+// Parses the flags that come before a command, as the global ones do, returning the command and its
+// arguments: everything from the first argument that is not one of the flags, or after "--"
+func parseLeadingFlags(args []string, flags []flagSpec) (rest []string, err error) {
+	_, rest, err = parseFlags(args, flags, false, true)
+	return rest, err
+}
+
+// Parses arguments as parseCommandLine does or, when leading is set, as parseLeadingFlags does
+func parseFlags(args []string, flags []flagSpec, withOptions, leading bool) (options []Option, positional []string, err error) {
+	// Defaults from the environment and the config file are set first, so the command line overrides them
+	for i := range flags {
+		if value, source, ok := lookupDefault(flags[i].Name); ok {
+			if err := flags[i].set(value); err != nil {
+				return nil, nil, msgError("error.default_value", source, err)
+			}
+		}
+	}
+
+	// Values of list flags on the command line replace their defaults rather than adding to them
+	given := map[string]bool{}
+	// Switches given for each target, as two that pick different modes cannot both be meant
+	switched := map[any]string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return options, append(positional, args[i+1:]...), nil
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if leading {
+				return nil, args[i:], nil
+			}
+			positional = append(positional, arg)
+			continue
+		}
+
+		// Takes the value from the next argument when it was not given after "="
+		name, value, found := strings.Cut(arg, "=")
+		nextValue := func() error {
+			if found {
+				return nil
+			}
+			if i+1 >= len(args) {
+				return msgError("error.missing_value", name)
+			}
+			i++
+			value = args[i]
+			return nil
+		}
+
+		if spec := findFlag(flags, name); spec != nil {
+			if _, ok := spec.Target.(*bool); (ok || spec.Value != "") && !found {
+				value = "true"
+			} else if err := nextValue(); err != nil {
+				return nil, nil, err
+			}
+			if spec.Value != "" {
+				if other, ok := switched[spec.Target]; ok && other != spec.Name {
+					return nil, nil, msgError("error.flag_conflict", other, spec.Name)
+				}
+				switched[spec.Target] = spec.Name
+			}
+			if list, ok := spec.Target.(*[]string); ok && !given[spec.Name] {
+				*list = nil
+			}
+			given[spec.Name] = true
+			if err := spec.set(value); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		if leading {
+			// Left for the command, which rejects it or, for -h and --help, prints its help
+			return nil, args[i:], nil
+		}
+		if !withOptions {
+			return nil, nil, msgError("error.unknown_option", name)
+		}
+		op, ok := findOperation(name)
+		if !strings.HasPrefix(name, "--") {
+			// Short forms such as "-m h" always take the value from the next argument
+			if op, ok = findShortOperation(name); !ok || found {
+				return nil, nil, msgError("error.unknown_option", arg)
+			}
+		}
+		if !ok {
+			return nil, nil, msgError("error.unknown_option", name)
+		}
+		// Options with an optional value take it only after "=", as in "--despeckle" or "--despeckle=3"
+		if !found && op.Implicit != "" && strings.HasPrefix(name, "--") {
+			value, found = op.Implicit, true
+		}
+		if err := nextValue(); err != nil {
+			return nil, nil, err
+		}
+		for _, opt := range splitOptionValues("--"+op.Name, value) {
+			if err := checkOption(op, opt.Value); err != nil {
+				return nil, nil, err
+			}
+			// Slice of struct preserves the insertion order of the applied options
+			options = append(options, opt)
+		}
+	}
+	return options, positional, nil
+}
+
+// Looks up a flag by its name with the leading dashes, or by its short form
+func findFlag(flags []flagSpec, name string) *flagSpec {
+	long, ok := strings.CutPrefix(name, "--")
+	for i := range flags {
+		if ok && flags[i].Name == long || !ok && flags[i].Short != "" && flags[i].Short == name {
+			return &flags[i]
+		}
+	}
+	return nil
+}
+
+// Validates the value and stores it in the target
+func (f *flagSpec) set(value string) error {
+	invalid := func(expected string) error {
+		return msgError("error.flag_value", value, f.Name, expected)
+	}
+
+	if f.Value != "" {
+		on, err := strconv.ParseBool(value)
+		if err != nil {
+			return invalid(msg("expect.bool"))
+		}
+		if on {
+			*f.Target.(*string) = f.Value
+		}
+		return nil
+	}
+
+	switch target := f.Target.(type) {
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return invalid(msg("expect.bool"))
+		}
+		*target = b
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil || int64(n) < f.Min {
+			return invalid(msg("expect.int", f.Min))
+		}
+		*target = n
+	case *int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < f.Min {
+			return invalid(msg("expect.int", f.Min))
+		}
+		*target = n
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 || (f.Min > 0 && d == 0) {
+			if f.Min > 0 {
+				return invalid(msg("expect.positive_duration"))
+			}
+			return invalid(msg("expect.duration"))
+		}
+		*target = d
+	case *[]string:
+		if f.Check != nil {
+			if err := f.Check(value); err != nil {
+				return invalid(err.Error())
+			}
+		}
+		*target = append(*target, value)
+	case *string:
+		if f.Choices != nil && !contains(f.Choices, value) {
+			return invalid(msg("expect.choice", strings.Join(f.Choices, ", ")))
+		}
+		if f.Check != nil {
+			if err := f.Check(value); err != nil {
+				return invalid(err.Error())
+			}
+		}
+		*target = value
+	}
+	return nil
+}
+
+// Rejects empty values of string flags
+func nonEmpty(value string) error {
+	if value == "" {
+		return msgError("expect.non_empty")
+	}
+	return nil
+}
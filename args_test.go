@@ -0,0 +1,48 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// Leading flags are parsed up to the command, so that flags after it are left to the command, switches
+// pick a mode of a shared target, and two that pick different modes conflict
+func TestParseLeadingFlags(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantRest []string
+		wantMode string
+		wantSize int64
+		wantErr  bool
+	}{
+		{[]string{"--strict", "--max-size=5", "apply", "--max-size=7"}, []string{"apply", "--max-size=7"}, "strict", 5, false},
+		{[]string{"-s", "--max-size", "5", "header", "x.bmp"}, []string{"header", "x.bmp"}, "strict", 5, false},
+		{[]string{"--strict", "--", "--permissive"}, []string{"--permissive"}, "strict", 0, false},
+		{[]string{"--strict", "--strict", "apply"}, []string{"apply"}, "strict", 0, false},
+		{[]string{"--strict", "--permissive", "apply"}, nil, "", 0, true},
+		{[]string{"--permissive=false", "apply"}, []string{"apply"}, "", 0, false},
+		{[]string{"--help"}, []string{"--help"}, "", 0, false},
+		{[]string{"--max-size=-1", "apply"}, nil, "", 0, true},
+	}
+	for _, tt := range tests {
+		var mode string
+		var size int64
+		flags := []flagSpec{
+			{Name: "strict", Short: "-s", Target: &mode, Value: "strict"},
+			{Name: "permissive", Target: &mode, Value: "permissive"},
+			{Name: "max-size", Target: &size},
+		}
+		rest, err := parseLeadingFlags(tt.args, flags)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error %v, want error %t", tt.args, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !slices.Equal(rest, tt.wantRest) || mode != tt.wantMode || size != tt.wantSize {
+			t.Errorf("%q: got %q, mode %q, size %d; want %q, mode %q, size %d",
+				tt.args, rest, mode, size, tt.wantRest, tt.wantMode, tt.wantSize)
+		}
+	}
+}
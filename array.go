@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"creditcard/bmp"
+)
+
+// Reads the entries of a bitmap array file, or returns nil for a plain BMP file
+func (s *ioSettings) readArray(filename string) ([]bmp.ArrayEntry, error) {
+	file, err := s.openInput(filename)
+	if err != nil {
+		return nil, msgError("error.open_file", err)
+	}
+	defer file.Close()
+	entries, err := bmp.DecodeArray(file)
+	if err != nil {
+		return nil, localizeError(err)
+	}
+	return entries, nil
+}
+
+// Prints the headers of every image in a bitmap array
+func printArray(w io.Writer, entries []bmp.ArrayEntry) {
+	fmt.Fprintf(w, "Bitmap Array: %d images\n", len(entries))
+	for i, entry := range entries {
+		fmt.Fprintf(w, "Image %d (display %dx%d, offset %d):\n", i, entry.Array.DisplayWidth, entry.Array.DisplayHeight, entry.Offset)
+		printHeader(w, &entry.BMP, &entry.DIB, nil)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Arrow metadata version of the messages written, V5
+const arrowVersion = 4
+
+// Writes the pixels as an Arrow IPC file (Feather V2) holding one record batch with a uint8 column per
+// channel, named red, green, blue and, when the image has alpha, alpha. Rows of the table are pixels, top
+// row first and left to right within a row; the schema metadata keeps the width, the height and the
+// NumPy shape, so that pyarrow.feather.read_table(f) and a reshape give back the image.
+func writeArrow(out io.Writer, img *Image) error {
+	names := []string{"red", "green", "blue", "alpha"}[:pixelChannels(img)]
+	count := img.Width * img.Height
+	padded := (count + 7) &^ 7
+
+	fields := make([]flatNode, len(names))
+	var nodes, buffers []byte
+	for i, name := range names {
+		fields[i] = flatTable{
+			{child: flatString(name)}, // name
+			flatScalar(1, 0),          // nullable
+			flatScalar(1, 2),          // type_type: Int
+			{child: flatTable{flatScalar(4, 8), flatScalar(1, 0)}}, // type: bitWidth, is_signed
+			{},                       // dictionary
+			{child: flatTables(nil)}, // children
+		}
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(count))
+		nodes = binary.LittleEndian.AppendUint64(nodes, 0)
+		// An empty validity buffer, as no pixel is null, then the values
+		offset := uint64(i * padded)
+		buffers = binary.LittleEndian.AppendUint64(buffers, offset)
+		buffers = binary.LittleEndian.AppendUint64(buffers, 0)
+		buffers = binary.LittleEndian.AppendUint64(buffers, offset)
+		buffers = binary.LittleEndian.AppendUint64(buffers, uint64(count))
+	}
+	metadata := flatTables{
+		arrowKeyValue("width", fmt.Sprint(img.Width)),
+		arrowKeyValue("height", fmt.Sprint(img.Height)),
+		arrowKeyValue("shape", fmt.Sprintf("[%d, %d, %d]", img.Height, img.Width, len(names))),
+	}
+	schema := flatTable{
+		flatScalar(2, 0), // endianness: little
+		{child: flatTables(fields)},
+		{child: metadata},
+	}
+	bodyLength := len(names) * padded
+	batch := flatTable{
+		flatScalar(8, uint64(count)),
+		{child: flatStructs{data: nodes, count: len(names)}},
+		{child: flatStructs{data: buffers, count: 2 * len(names)}},
+	}
+
+	w := bufio.NewWriter(out)
+	w.WriteString("ARROW1\x00\x00")
+	batchOffset := 8 + writeArrowMessage(w, arrowMessage(1, schema, 0))
+	batchLength := writeArrowMessage(w, arrowMessage(3, batch, bodyLength))
+
+	zeros := make([]byte, padded-count)
+	for c := range names {
+		for y := img.Height - 1; y >= 0; y-- {
+			start := y * img.Width
+			for x, p := range img.Pixels[start : start+img.Width] {
+				switch c {
+				case 0:
+					w.WriteByte(p.Red)
+				case 1:
+					w.WriteByte(p.Green)
+				case 2:
+					w.WriteByte(p.Blue)
+				default:
+					w.WriteByte(img.Alpha[start+x])
+				}
+			}
+		}
+		w.Write(zeros)
+	}
+
+	// The footer repeats the schema and tells readers where the record batch is
+	block := binary.LittleEndian.AppendUint64(nil, uint64(batchOffset))
+	block = binary.LittleEndian.AppendUint32(block, uint32(batchLength))
+	block = binary.LittleEndian.AppendUint32(block, 0)
+	block = binary.LittleEndian.AppendUint64(block, uint64(bodyLength))
+	footer := finishFlatBuffer(flatTable{
+		flatScalar(2, arrowVersion),
+		{child: schema},
+		{child: flatStructs{}},
+		{child: flatStructs{data: block, count: 1}},
+	})
+	w.Write(footer)
+	binary.Write(w, binary.LittleEndian, uint32(len(footer)))
+	w.WriteString("ARROW1")
+	return w.Flush()
+}
+
+// Returns a Message flatbuffer of the given header type (1 for a schema, 3 for a record batch)
+func arrowMessage(headerType uint64, header flatTable, bodyLength int) []byte {
+	return finishFlatBuffer(flatTable{
+		flatScalar(2, arrowVersion),
+		flatScalar(1, headerType),
+		{child: header},
+		flatScalar(8, uint64(bodyLength)),
+	})
+}
+
+// Writes a message behind its continuation marker and length, returning the bytes written
+func writeArrowMessage(w *bufio.Writer, message []byte) int {
+	binary.Write(w, binary.LittleEndian, uint32(0xffffffff))
+	binary.Write(w, binary.LittleEndian, uint32(len(message)))
+	w.Write(message)
+	return 8 + len(message)
+}
+
+// Returns a KeyValue table of Arrow custom metadata
+func arrowKeyValue(key, value string) flatNode {
+	return flatTable{{child: flatString(key)}, {child: flatString(value)}}
+}
+
+// A value that can be serialized into a flatbuffer, of the few kinds Arrow metadata needs
+type flatNode interface {
+	// Appends the value to the buffer, returning its position for the offsets that point to it
+	write(b *flatBuilder) int
+}
+
+// Serializes flatbuffers front to back: a table comes before the values its fields point to, so that every
+// offset points forward as flatbuffers require, and its vtable just before it
+type flatBuilder struct {
+	buf []byte
+}
+
+// Pads the buffer to a multiple of n bytes
+func (b *flatBuilder) align(n int) {
+	for len(b.buf)%n != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+// Points the offset at position at to target
+func (b *flatBuilder) patch(at, target int) {
+	binary.LittleEndian.PutUint32(b.buf[at:], uint32(target-at))
+}
+
+// Returns the flatbuffer holding root as its root table, padded to 8 bytes as Arrow messages are
+func finishFlatBuffer(root flatNode) []byte {
+	b := &flatBuilder{buf: make([]byte, 4)}
+	b.patch(0, root.write(b))
+	b.align(8)
+	return b.buf
+}
+
+// A table, by field id: a scalar of 1 to 8 bytes, an offset to a child, or a zero field left out
+type flatTable []flatField
+
+type flatField struct {
+	size  int
+	value uint64
+	child flatNode
+}
+
+// Returns a scalar field of size bytes
+func flatScalar(size int, value uint64) flatField {
+	return flatField{size: size, value: value}
+}
+
+func (t flatTable) write(b *flatBuilder) int {
+	b.align(2)
+	vtable := len(b.buf)
+	b.buf = append(b.buf, make([]byte, 4+2*len(t))...)
+	b.align(4)
+	start := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(start-vtable))
+
+	// Offset fields, by position, to point at their children once the table is complete
+	type pending struct {
+		at    int
+		child flatNode
+	}
+	var children []pending
+	for i, f := range t {
+		size := f.size
+		if f.child != nil {
+			size = 4
+		}
+		if size == 0 {
+			continue
+		}
+		b.align(size)
+		binary.LittleEndian.PutUint16(b.buf[vtable+4+2*i:], uint16(len(b.buf)-start))
+		if f.child != nil {
+			children = append(children, pending{len(b.buf), f.child})
+		}
+		value := binary.LittleEndian.AppendUint64(nil, f.value)
+		b.buf = append(b.buf, value[:size]...)
+	}
+	binary.LittleEndian.PutUint16(b.buf[vtable:], uint16(4+2*len(t)))
+	binary.LittleEndian.PutUint16(b.buf[vtable+2:], uint16(len(b.buf)-start))
+
+	for _, p := range children {
+		b.patch(p.at, p.child.write(b))
+	}
+	return start
+}
+
+// A string, written with its length and a terminating zero
+type flatString string
+
+func (s flatString) write(b *flatBuilder) int {
+	b.align(4)
+	start := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(s)))
+	b.buf = append(append(b.buf, s...), 0)
+	return start
+}
+
+// A vector of tables
+type flatTables []flatNode
+
+func (v flatTables) write(b *flatBuilder) int {
+	b.align(4)
+	start := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(v)))
+	b.buf = append(b.buf, make([]byte, 4*len(v))...)
+	for i, table := range v {
+		b.patch(start+4+4*i, table.write(b))
+	}
+	return start
+}
+
+// A vector of count structs of 8-byte fields, already serialized into data
+type flatStructs struct {
+	data  []byte
+	count int
+}
+
+func (v flatStructs) write(b *flatBuilder) int {
+	// The structs start 8-byte aligned, after the length
+	b.align(4)
+	if len(b.buf)%8 == 0 {
+		b.buf = append(b.buf, 0, 0, 0, 0)
+	}
+	start := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(v.count))
+	b.buf = append(b.buf, v.data...)
+	return start
+}
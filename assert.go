@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Checks accepted by --assert
+var assertChecks = []string{"dimensions", "max-colors", "not-blank"}
+
+// Parses an --assert value of the form check[:argument]. dimensions takes WxH, max-colors a count of
+// at least 1 and not-blank no argument.
+func parseAssert(value string) (check string, width, height int, err error) {
+	check, arg, _ := strings.Cut(value, ":")
+	switch check {
+	case "dimensions":
+		if width, height, ok := parseSize(arg); ok {
+			return check, width, height, nil
+		}
+	case "max-colors":
+		if width, err = strconv.Atoi(arg); err == nil && width > 0 {
+			return check, width, 0, nil
+		}
+	case "not-blank":
+		if arg == "" {
+			return check, 0, 0, nil
+		}
+	}
+	return "", 0, 0, msgError("error.invalid_assert", value)
+}
+
+// Returns the image unchanged when it satisfies the assertion, or an error describing the violation
+func applyAssert(img *Image, value string) (*Image, error) {
+	check, width, height, err := parseAssert(value)
+	if err != nil {
+		return nil, err
+	}
+
+	switch check {
+	case "dimensions":
+		if img.Width != width || img.Height != height {
+			return nil, msgError("error.assert_dimensions", img.Width, img.Height, width, height)
+		}
+	case "max-colors":
+		// Counting stops as soon as the limit is exceeded
+		colors := make(map[Pixel]struct{})
+		for _, p := range img.Pixels {
+			colors[p] = struct{}{}
+			if len(colors) > width {
+				return nil, msgError("error.assert_colors", width)
+			}
+		}
+	case "not-blank":
+		for _, p := range img.Pixels {
+			if p != img.Pixels[0] {
+				return img, nil
+			}
+		}
+		return nil, msgError("error.assert_blank")
+	}
+	return img, nil
+}
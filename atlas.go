@@ -0,0 +1,274 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"path/filepath"
+	"slices"
+)
+
+// Packing algorithms accepted by --algo
+var packAlgos = []string{"maxrects", "guillotine"}
+
+// Settings of the pack-atlas command
+type atlasConfig struct {
+	max      string // Largest atlas as WxH
+	padding  int    // Empty pixels between sprites
+	trim     bool   // Crop the transparent border of each sprite before packing
+	algo     string
+	sprites  []string
+	image    string
+	metadata string
+}
+
+// Rectangle in atlas coordinates, measured from the top-left corner
+type atlasRect struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// Width and height of a sprite or of the atlas
+type atlasSize struct {
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// Entry of the atlas metadata, in the layout of TexturePacker's JSON array format, which game engines
+// such as Phaser and PixiJS read directly
+type atlasFrame struct {
+	Filename string    `json:"filename"`
+	Frame    atlasRect `json:"frame"`   // Where the sprite is in the atlas
+	Rotated  bool      `json:"rotated"` // Always false; sprites are never rotated
+	Trimmed  bool      `json:"trimmed"`
+	// Part of the original sprite that was kept, so engines can restore the offset of a trimmed sprite
+	SpriteSourceSize atlasRect `json:"spriteSourceSize"`
+	SourceSize       atlasSize `json:"sourceSize"`
+}
+
+// Metadata written next to the atlas image
+type atlasMetadata struct {
+	Frames []atlasFrame `json:"frames"`
+	Meta   struct {
+		Image string    `json:"image"`
+		Size  atlasSize `json:"size"`
+	} `json:"meta"`
+}
+
+// Sprite loaded for packing, with its place in the atlas once packed
+type atlasSprite struct {
+	frame atlasFrame
+	img   *Image
+}
+
+// Parses the arguments of the pack-atlas command
+func parseAtlasArgs(args []string) (*atlasConfig, error) {
+	cfg := &atlasConfig{max: "2048x2048", algo: "maxrects"}
+	flags := []flagSpec{
+		{Name: "max", Target: &cfg.max, Check: checkSize},
+		{Name: "padding", Target: &cfg.padding},
+		{Name: "trim", Target: &cfg.trim},
+		{Name: "algo", Target: &cfg.algo, Choices: packAlgos},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) < 3 {
+		return nil, msgError("usage.pack_atlas")
+	}
+	n := len(positional)
+	cfg.sprites, cfg.image, cfg.metadata = positional[:n-2], positional[n-2], positional[n-1]
+	return cfg, nil
+}
+
+// Packs sprites into a single atlas image and writes the position of each sprite to a JSON file
+func runPackAtlas(args []string) error {
+	cfg, err := parseAtlasArgs(args)
+	if err != nil {
+		return err
+	}
+	maxWidth, maxHeight, _ := parseSize(cfg.max)
+
+	sprites := make([]*atlasSprite, len(cfg.sprites))
+	for i, filename := range cfg.sprites {
+		if sprites[i], err = loadSprite(filename, cfg.trim); err != nil {
+			return err
+		}
+	}
+
+	// Large sprites are placed first, while the free space is still in few large pieces
+	order := slices.Clone(sprites)
+	slices.SortStableFunc(order, func(a, b *atlasSprite) int {
+		return cmp.Or(cmp.Compare(b.img.Width*b.img.Height, a.img.Width*a.img.Height), cmp.Compare(b.img.Height, a.img.Height))
+	})
+	// Padding is added to the right and bottom of every sprite, and the bin grows by as much,
+	// so sprites are kept apart without a gap at the far edges of the atlas
+	packer := newRectPacker(cfg.algo, maxWidth+cfg.padding, maxHeight+cfg.padding)
+	var width, height int
+	for _, sprite := range order {
+		w, h := sprite.img.Width, sprite.img.Height
+		x, y, ok := packer.insert(w+cfg.padding, h+cfg.padding)
+		if !ok {
+			return msgError("error.atlas_full", sprite.frame.Filename, w, h, cfg.max)
+		}
+		sprite.frame.Frame = atlasRect{X: x, Y: y, W: w, H: h}
+		width, height = max(width, x+w), max(height, y+h)
+	}
+
+	atlas := &Image{Width: width, Height: height, Pixels: make([]Pixel, width*height), Alpha: make([]byte, width*height)}
+	var metadata atlasMetadata
+	for _, sprite := range sprites {
+		blitSprite(atlas, sprite.img, sprite.frame.Frame.X, sprite.frame.Frame.Y)
+		metadata.Frames = append(metadata.Frames, sprite.frame)
+	}
+	metadata.Meta.Image = filepath.Base(cfg.image)
+	metadata.Meta.Size = atlasSize{W: width, H: height}
+
+	if err := globalSettings.saveOutput(cfg.image, "", &BMPHeader{}, &DIBHeader{}, atlas); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return msgError("error.write_output", err)
+	}
+	if err := writeFile(cfg.metadata, append(data, '\n')); err != nil {
+		return msgError("error.write_output", err)
+	}
+	return nil
+}
+
+// Loads a sprite, cropping it to its visible pixels when trim is set. Fully transparent sprites are kept whole.
+func loadSprite(filename string, trim bool) (*atlasSprite, error) {
+	_, _, img, err := globalSettings.loadImage(filename)
+	if err != nil {
+		return nil, err
+	}
+	sprite := &atlasSprite{img: img, frame: atlasFrame{
+		Filename:         filepath.Base(filename),
+		SpriteSourceSize: atlasRect{W: img.Width, H: img.Height},
+		SourceSize:       atlasSize{W: img.Width, H: img.Height},
+	}}
+	if x, y, w, h, ok := alphaBounds(img); trim && ok && (w != img.Width || h != img.Height) {
+		if sprite.img, err = applyTrim(img, nil); err != nil {
+			return nil, err
+		}
+		sprite.frame.Trimmed = true
+		sprite.frame.SpriteSourceSize = atlasRect{X: x, Y: y, W: w, H: h}
+	}
+	return sprite, nil
+}
+
+// Copies a sprite into the atlas with its top-left corner at x, y. Sprites without alpha are opaque.
+func blitSprite(atlas, sprite *Image, x, y int) {
+	for sy := 0; sy < sprite.Height; sy++ {
+		for sx := 0; sx < sprite.Width; sx++ {
+			setPixelAt(atlas, x+sx, y+sy, pixelAt(sprite, sx, sy))
+			alpha := byte(255)
+			if sprite.Alpha != nil {
+				alpha = sprite.Alpha[(sprite.Height-1-sy)*sprite.Width+sx]
+			}
+			atlas.Alpha[(atlas.Height-1-y-sy)*atlas.Width+x+sx] = alpha
+		}
+	}
+}
+
+// Places rectangles in a bin, keeping track of the free space as a list of rectangles
+type rectPacker struct {
+	guillotine    bool
+	free          []atlasRect
+	width, height int // Extent of the placed rectangles
+}
+
+// Creates a packer for an empty bin of the given size using the maxrects or guillotine algorithm
+func newRectPacker(algo string, width, height int) *rectPacker {
+	return &rectPacker{guillotine: algo == "guillotine", free: []atlasRect{{W: width, H: height}}}
+}
+
+// Finds room for a rectangle and marks it as used, returning its top-left corner
+func (p *rectPacker) insert(w, h int) (x, y int, ok bool) {
+	// The bin is usually far larger than the sprites, so the free rectangle that grows the used part of
+	// the bin the least wins. Ties go to the one leaving the thinnest strip next to the new rectangle
+	// (best short side fit), then to the smaller one, filling small holes first.
+	best := -1
+	var bestGrowth, bestSide, bestArea int
+	for i, r := range p.free {
+		if w > r.W || h > r.H {
+			continue
+		}
+		growth := max(p.width, r.X+w)*max(p.height, r.Y+h) - p.width*p.height
+		side, area := min(r.W-w, r.H-h), r.W*r.H
+		if best < 0 || cmp.Or(cmp.Compare(growth, bestGrowth), cmp.Compare(side, bestSide), cmp.Compare(area, bestArea)) < 0 {
+			best, bestGrowth, bestSide, bestArea = i, growth, side, area
+		}
+	}
+	if best < 0 {
+		return 0, 0, false
+	}
+	placed := atlasRect{X: p.free[best].X, Y: p.free[best].Y, W: w, H: h}
+	p.width, p.height = max(p.width, placed.X+w), max(p.height, placed.Y+h)
+	if p.guillotine {
+		p.splitGuillotine(best, placed)
+	} else {
+		p.splitMaxRects(placed)
+	}
+	return placed.X, placed.Y, true
+}
+
+// Replaces the free rectangle holding the placed one by the two pieces left over, cutting along the
+// shorter leftover side so that the larger piece stays as big as possible
+func (p *rectPacker) splitGuillotine(index int, placed atlasRect) {
+	r := p.free[index]
+	p.free = slices.Delete(p.free, index, index+1)
+	right := atlasRect{X: r.X + placed.W, Y: r.Y, W: r.W - placed.W, H: placed.H}
+	bottom := atlasRect{X: r.X, Y: r.Y + placed.H, W: r.W, H: r.H - placed.H}
+	if r.W-placed.W > r.H-placed.H {
+		right.H = r.H
+		bottom.W = placed.W
+	}
+	for _, piece := range []atlasRect{right, bottom} {
+		if piece.W > 0 && piece.H > 0 {
+			p.free = append(p.free, piece)
+		}
+	}
+}
+
+// Cuts the placed rectangle out of every free rectangle it overlaps, keeping the maximal pieces
+// around it, then drops free rectangles contained in others
+func (p *rectPacker) splitMaxRects(placed atlasRect) {
+	var free []atlasRect
+	for _, r := range p.free {
+		if placed.X >= r.X+r.W || placed.X+placed.W <= r.X || placed.Y >= r.Y+r.H || placed.Y+placed.H <= r.Y {
+			free = append(free, r)
+			continue
+		}
+		if placed.X > r.X {
+			free = append(free, atlasRect{X: r.X, Y: r.Y, W: placed.X - r.X, H: r.H})
+		}
+		if right := placed.X + placed.W; right < r.X+r.W {
+			free = append(free, atlasRect{X: right, Y: r.Y, W: r.X + r.W - right, H: r.H})
+		}
+		if placed.Y > r.Y {
+			free = append(free, atlasRect{X: r.X, Y: r.Y, W: r.W, H: placed.Y - r.Y})
+		}
+		if bottom := placed.Y + placed.H; bottom < r.Y+r.H {
+			free = append(free, atlasRect{X: r.X, Y: bottom, W: r.W, H: r.Y + r.H - bottom})
+		}
+	}
+
+	p.free = p.free[:0]
+	for i, r := range free {
+		contained := false
+		for j, other := range free {
+			if i != j && r.X >= other.X && r.Y >= other.Y && r.X+r.W <= other.X+other.W && r.Y+r.H <= other.Y+other.H &&
+				(r != other || i > j) {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			p.free = append(p.free, r)
+		}
+	}
+}
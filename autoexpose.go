@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"creditcard/bmp"
+)
+
+// Linear-light luminance --auto-expose brings the sample area to: the 18% reflectance of a gray card,
+// which sRGB encodes as level 118
+const middleGray = 0.18
+
+// Area of --auto-expose, in pixels from the top-left corner
+type exposeArea struct {
+	x, y, width, height int
+}
+
+// Parses an --auto-expose value of the form from:x,y,w,h
+func parseAutoExpose(value string) (exposeArea, error) {
+	coords, ok := strings.CutPrefix(value, "from:")
+	parts := strings.Split(coords, ",")
+	if !ok || len(parts) != 4 {
+		return exposeArea{}, msgError("error.invalid_auto_expose", value)
+	}
+	nums := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || (i >= 2 && n == 0) {
+			return exposeArea{}, msgError("error.invalid_auto_expose", value)
+		}
+		nums[i] = n
+	}
+	return exposeArea{x: nums[0], y: nums[1], width: nums[2], height: nums[3]}, nil
+}
+
+// Returns the exposure gain that brings the mean luminance of the area to middle gray. The luminance is
+// measured in linear light, where it is proportional to the exposure.
+func exposureGain(img *Image, area exposeArea) (float64, error) {
+	if area.x+area.width > img.Width || area.y+area.height > img.Height {
+		return 0, msgError("error.auto_expose_bounds", area.x, area.y, area.width, area.height, img.Width, img.Height)
+	}
+	sample, err := img.Crop(area.x, area.y, area.width, area.height, nil)
+	if err != nil {
+		return 0, localizeError(err)
+	}
+	stats := bmp.Stats(sample)
+	luminance := 0.2126*linearMean(&stats.Red) + 0.7152*linearMean(&stats.Green) + 0.0722*linearMean(&stats.Blue)
+	if luminance == 0 {
+		return 0, msgError("error.auto_expose_black")
+	}
+	return middleGray / luminance, nil
+}
+
+// Returns the mean linear-light intensity of a channel from its histogram
+func linearMean(channel *bmp.ChannelStats) float64 {
+	var sum float64
+	var n int
+	for level, count := range channel.Histogram {
+		sum += float64(count) * bmp.LinearIntensity(byte(level))
+		n += count
+	}
+	return sum / float64(n)
+}
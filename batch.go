@@ -0,0 +1,476 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default output naming template: keep the input file name
+const defaultNameTemplate = "{name}"
+
+// Describes the settings of a batch run
+type batchConfig struct {
+	inputDir     string
+	outputDir    string
+	nameTemplate string
+	options      []Option
+	incremental  bool   // Skip inputs whose output is up to date
+	resume       bool   // Skip inputs already written by an interrupted run
+	stateFile    string // Path of the state file shared by incremental and resume modes
+	results      string // Per-file result format: "text" or "jsonl"
+	resultsFile  string // Where results are written, standard output when empty
+	workers      int    // Files processed at the same time
+	pruneSimilar string // Histogram distance under which files like the last one kept are left out, if set
+	// Read inputs that are symlinks and write outputs through symlinks in the output directory, which are
+	// skipped and refused otherwise
+	followSymlinks bool
+}
+
+// Parses batch arguments: settings and apply options followed by the input and output directories
+func parseBatchArgs(args []string) (*batchConfig, error) {
+	cfg := &batchConfig{nameTemplate: defaultNameTemplate, results: "text", workers: defaultWorkers()}
+	flags := []flagSpec{
+		{Name: "name-template", Target: &cfg.nameTemplate},
+		{Name: "incremental", Target: &cfg.incremental},
+		{Name: "resume", Target: &cfg.resume},
+		{Name: "state-file", Target: &cfg.stateFile},
+		{Name: "results", Target: &cfg.results, Choices: []string{"text", "jsonl"}},
+		{Name: "results-file", Target: &cfg.resultsFile},
+		{Name: "workers", Target: &cfg.workers, Min: 1},
+		{Name: "prune-similar", Target: &cfg.pruneSimilar, Check: checkPruneThreshold},
+		{Name: "follow-symlinks", Target: &cfg.followSymlinks},
+	}
+	options, positional, err := parseCommandLine(args, flags, true)
+	if err != nil {
+		return nil, err
+	}
+	cfg.options = options
+
+	if len(positional) != 2 {
+		return nil, msgError("usage.batch")
+	}
+	cfg.inputDir, cfg.outputDir = positional[0], positional[1]
+	if cfg.stateFile == "" {
+		cfg.stateFile = filepath.Join(cfg.outputDir, defaultStateFile)
+	}
+
+	// Catch template mistakes before any file is processed
+	if _, err := expandNameTemplate(cfg.nameTemplate, nameTemplateVars("example.bmp", cfg.options, &Image{Width: 1, Height: 1})); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Holds the progress of a running batch
+type batchRun struct {
+	cfg      *batchConfig
+	pipeline string            // Hash of the option chain and naming template
+	state    *batchState       // Record of written outputs, kept so runs can be resumed
+	written  map[string]string // output path -> input path
+	// With --deterministic, closed once the input of the same index has claimed its output name or failed
+	claimed []chan struct{}
+	// With --prune-similar, closed once the input of the same index has been compared with the last input
+	// kept, or has ended before it could be; only the input whose turn it is uses pruner
+	pruned []chan struct{}
+	pruner *framePruner
+	root   *pathRoot // Output directory, which outputs may not leave
+
+	mu sync.Mutex // Guards state and written, which workers share
+}
+
+// Outcome of processing one input file, reported by --results=jsonl
+type batchResult struct {
+	Input        string  `json:"input"`
+	Output       string  `json:"output,omitempty"`
+	Status       string  `json:"status"` // "ok", "skipped", "pruned" or "error"
+	Error        string  `json:"error,omitempty"`
+	Width        int     `json:"width,omitempty"`
+	Height       int     `json:"height,omitempty"`
+	OutputWidth  int     `json:"output_width,omitempty"`
+	OutputHeight int     `json:"output_height,omitempty"`
+	DecodeMs     float64 `json:"decode_ms"`
+	ProcessMs    float64 `json:"process_ms"`
+	EncodeMs     float64 `json:"encode_ms"`
+	TotalMs      float64 `json:"total_ms"`
+}
+
+// Applies the same option chain to every BMP file in a directory
+func runBatch(args []string) error {
+	cfg, err := parseBatchArgs(args)
+	if err != nil {
+		return err
+	}
+
+	inputs, err := listBMPFiles(cfg.inputDir, cfg.followSymlinks)
+	if err != nil {
+		return err
+	}
+	lockFiles = true
+	if err := files.MkdirAll(cfg.outputDir); err != nil {
+		return msgError("error.create_dir", err)
+	}
+	root, err := newPathRoot(cfg.outputDir, cfg.followSymlinks)
+	if err != nil {
+		return err
+	}
+
+	var results io.Writer = os.Stdout
+	if cfg.resultsFile != "" {
+		file, err := files.Create(cfg.resultsFile)
+		if err != nil {
+			return msgError("error.create_file", err)
+		}
+		defer file.Close()
+		results = file
+	}
+	encoder := json.NewEncoder(results)
+
+	pipeline, err := globalSettings.pipelineHash(cfg.options, cfg.nameTemplate)
+	if err != nil {
+		return err
+	}
+	run := &batchRun{cfg: cfg, pipeline: pipeline, written: make(map[string]string), root: root}
+	if deterministic {
+		run.claimed = make([]chan struct{}, len(inputs))
+		for i := range run.claimed {
+			run.claimed[i] = make(chan struct{})
+		}
+	}
+	if run.pruner = newFramePruner(cfg.pruneSimilar); run.pruner != nil {
+		run.pruned = make([]chan struct{}, len(inputs))
+		for i := range run.pruned {
+			run.pruned[i] = make(chan struct{})
+		}
+	}
+	// The state is always recorded so that an interrupted run can be resumed
+	if run.state, err = loadBatchState(cfg.stateFile); err != nil {
+		return err
+	}
+	defer run.state.close()
+
+	// Workers take the next file as they finish one; results are reported in input order all the same
+	start := time.Now()
+	pending := make([]chan *batchResult, len(inputs))
+	for i := range pending {
+		pending[i] = make(chan *batchResult, 1)
+	}
+	next := make(chan int)
+	go func() {
+		for i := range inputs {
+			next <- i
+		}
+		close(next)
+	}()
+	for range min(cfg.workers, len(inputs)) {
+		go func() {
+			for i := range next {
+				pending[i] <- run.processFile(i, inputs[i])
+			}
+		}()
+	}
+
+	// Every result is waited for, so no worker is still writing when the state is closed
+	counts := map[string]int{}
+	var writeErr error
+	for i, input := range inputs {
+		result := <-pending[i]
+		counts[result.Status]++
+		if writeErr != nil {
+			continue
+		}
+
+		if cfg.results == "jsonl" {
+			if err := encoder.Encode(result); err != nil {
+				writeErr = msgError("error.write_results", err)
+			}
+			continue
+		}
+		switch result.Status {
+		case "error":
+			printError(fmt.Errorf("%s: %s", input, result.Error))
+		case "skipped":
+			fmt.Fprintln(results, msg("info.batch_skipped", input, result.Output))
+		case "pruned":
+			fmt.Fprintln(results, msg("info.batch_pruned", input))
+		default:
+			fmt.Fprintln(results, msg("info.batch_done", input, result.Output))
+		}
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	logInfo("info.batch_summary", len(inputs), counts["ok"], counts["skipped"], counts["error"], time.Since(start).Round(time.Millisecond))
+	if counts["pruned"] > 0 {
+		logInfo("info.batch_pruned_total", counts["pruned"])
+	}
+
+	if failed := counts["error"]; failed > 0 {
+		return msgError("error.batch_failed", failed, len(inputs))
+	}
+	return nil
+}
+
+// Runs the option chain on one input file, the index-th of the run, writes the result and reports the
+// outcome
+func (run *batchRun) processFile(index int, input string) *batchResult {
+	result := &batchResult{Input: input, Status: "ok"}
+	start := time.Now()
+	defer func() { result.TotalMs = millisSince(start) }()
+
+	// With --deterministic inputs claim their output names in input order, so that of two inputs that name
+	// the same output the earlier one is always written, whichever worker gets there first. Decoding and
+	// processing still run side by side; only the claims wait.
+	waitTurn := func() {
+		if run.claimed != nil && index > 0 {
+			<-run.claimed[index-1]
+		}
+	}
+	claimed := sync.OnceFunc(func() {
+		if run.claimed != nil {
+			close(run.claimed[index])
+		}
+	})
+	defer claimed()
+	// With --prune-similar inputs are compared in input order, each with the last input kept before it.
+	// Inputs that end before they are compared still wait for the one before, so that the turns pass on
+	// in order.
+	pruneTurn := sync.OnceFunc(func() {
+		if run.pruned != nil {
+			if index > 0 {
+				<-run.pruned[index-1]
+			}
+			close(run.pruned[index])
+		}
+	})
+	defer pruneTurn()
+	// Compares a decoded source with the last input kept, in its turn, or makes it the last input kept
+	// when an earlier run wrote its output
+	prune := func(img *Image, kept bool) (bool, float64) {
+		if index > 0 {
+			<-run.pruned[index-1]
+		}
+		defer pruneTurn()
+		if kept {
+			run.pruner.follow(img)
+			return true, 0
+		}
+		return run.pruner.keep(img)
+	}
+
+	fail := func(err error) *batchResult {
+		result.Status, result.Error = "error", err.Error()
+		return result
+	}
+	skip := func(entry stateEntry) *batchResult {
+		// Outputs of earlier runs stay, so the inputs after them are compared with them
+		if run.pruner != nil {
+			if _, _, img, err := globalSettings.loadImage(input); err == nil {
+				prune(img, true)
+			}
+		}
+		waitTurn()
+		run.mu.Lock()
+		run.written[entry.Output] = input
+		run.mu.Unlock()
+		claimed()
+		result.Status, result.Output = "skipped", entry.Output
+		return result
+	}
+
+	// Resuming trusts outputs recorded by the interrupted run without rehashing inputs
+	if run.cfg.resume {
+		run.mu.Lock()
+		entry, ok := run.state.completed(input, run.pipeline)
+		run.mu.Unlock()
+		if ok {
+			return skip(entry)
+		}
+	}
+
+	inputHash, err := hashFile(input)
+	if err != nil {
+		return fail(err)
+	}
+	if run.cfg.incremental {
+		run.mu.Lock()
+		entry, ok := run.state.upToDate(input, inputHash, run.pipeline)
+		run.mu.Unlock()
+		if ok {
+			return skip(entry)
+		}
+	}
+
+	stage := time.Now()
+	bmpHeader, dibHeader, img, err := globalSettings.loadImage(input)
+	result.DecodeMs = millisSince(stage)
+	if err != nil {
+		return fail(err)
+	}
+	result.Width, result.Height = img.Width, img.Height
+
+	// Sources are compared before the options run, which is the work pruning saves
+	if run.pruner != nil {
+		if keep, distance := prune(img, false); !keep {
+			logDetail("info.file_pruned", input, distance)
+			waitTurn()
+			claimed()
+			result.Status = "pruned"
+			return result
+		}
+	}
+
+	stage = time.Now()
+	options, err := resolveStamps(run.cfg.options, input)
+	if err == nil {
+		img, err = applyOptions(img, options)
+	}
+	result.ProcessMs = millisSince(stage)
+	if err != nil {
+		return fail(err)
+	}
+	result.OutputWidth, result.OutputHeight = img.Width, img.Height
+
+	name, err := expandNameTemplate(run.cfg.nameTemplate, nameTemplateVars(input, run.cfg.options, img))
+	if err != nil {
+		return fail(err)
+	}
+	output := filepath.Join(run.cfg.outputDir, name)
+	// Names come from the template and the input, so a symlink in the output directory is the only way out
+	// of it, which is refused unless symlinks are followed
+	if _, err := run.root.resolve(filepath.Join(run.root.dir, name)); err != nil {
+		waitTurn()
+		claimed()
+		return fail(err)
+	}
+	waitTurn()
+	run.mu.Lock()
+	previous, collides := run.written[output]
+	if !collides {
+		run.written[output] = input
+	}
+	run.mu.Unlock()
+	claimed()
+	if collides {
+		return fail(msgError("error.name_collision", output, previous))
+	}
+
+	if err := files.MkdirAll(filepath.Dir(output)); err != nil {
+		return fail(msgError("error.create_dir", err))
+	}
+	stage = time.Now()
+	err = globalSettings.saveImage(output, bmpHeader, dibHeader, img)
+	result.EncodeMs = millisSince(stage)
+	if err != nil {
+		return fail(err)
+	}
+	result.Output = output
+
+	info, err := files.Stat(output)
+	if err != nil {
+		return fail(msgError("error.write_state", err))
+	}
+	entry := stateEntry{Input: input, InputHash: inputHash, Pipeline: run.pipeline, Output: output, OutputSize: info.Size()}
+	run.mu.Lock()
+	err = run.state.record(entry)
+	run.mu.Unlock()
+	if err != nil {
+		return fail(err)
+	}
+	return result
+}
+
+// Returns the milliseconds elapsed since start
+func millisSince(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
+
+// Lists the .bmp files in a directory in name order, leaving out symlinks unless they are followed
+func listBMPFiles(dir string, followSymlinks bool) ([]string, error) {
+	entries, err := files.ReadDir(dir)
+	if err != nil {
+		return nil, msgError("error.read_dir", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".bmp") {
+			continue
+		}
+		if unreadableName(entry.Name()) {
+			printWarning(msgError("warning.unreadable_name", entry.Name()))
+			continue
+		}
+		if entry.Type()&fs.ModeSymlink != 0 && !followSymlinks {
+			printWarning(msgError("warning.symlink_skipped", entry.Name()))
+			continue
+		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Returns the placeholder values available to output naming templates
+func nameTemplateVars(input string, options []Option, img *Image) map[string]string {
+	name := filepath.Base(input)
+	ext := filepath.Ext(name)
+	return map[string]string{
+		"name":   name,
+		"stem":   strings.TrimSuffix(name, ext),
+		"ext":    strings.TrimPrefix(ext, "."),
+		"op":     describeOptions(options),
+		"width":  strconv.Itoa(img.Width),
+		"height": strconv.Itoa(img.Height),
+	}
+}
+
+// Matches {placeholder} fields in a naming template
+var templateField = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// Replaces {placeholder} fields in a naming template with their values
+func expandNameTemplate(tmpl string, vars map[string]string) (string, error) {
+	var unknown string
+	result := templateField.ReplaceAllStringFunc(tmpl, func(field string) string {
+		key := field[1 : len(field)-1]
+		value, ok := vars[key]
+		if !ok && unknown == "" {
+			unknown = field
+		}
+		return value
+	})
+	if unknown != "" {
+		return "", msgError("error.template_field", unknown)
+	}
+	// Only a path element of .. climbs out of the output directory; names such as v1..2 stay valid
+	if result == "" || slices.Contains(strings.Split(filepath.ToSlash(result), "/"), "..") {
+		return "", msgError("error.template_name", tmpl)
+	}
+	return result, nil
+}
+
+// Summarizes an option chain for use in file names, e.g. mirror-horizontal+filter-grayscale
+func describeOptions(options []Option) string {
+	if len(options) == 0 {
+		return "none"
+	}
+	parts := make([]string, len(options))
+	for i, opt := range options {
+		parts[i] = strings.TrimPrefix(opt.Name, "--") + "-" + opt.Value
+	}
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>| `, r) {
+			return '_'
+		}
+		return r
+	}, strings.Join(parts, "+"))
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestExpandNameTemplate(t *testing.T) {
+	vars := map[string]string{"name": "photo.bmp", "stem": "photo", "ext": "bmp", "op": "filter-grayscale"}
+	tests := []struct {
+		tmpl, want string
+	}{
+		{"{name}", "photo.bmp"},
+		{"{stem}..bmp", "photo..bmp"},
+		{"v1..2/{stem}.{ext}", "v1..2/photo.bmp"},
+		{"{op}/{stem}...{ext}", "filter-grayscale/photo...bmp"},
+		{"..{name}", "..photo.bmp"},
+		{"../{name}", ""},
+		{"out/../../{name}", ""},
+		{"{stem}/..", ""},
+		{"..", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got, err := expandNameTemplate(tt.tmpl, vars)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("expandNameTemplate(%q) = %q, want an error", tt.tmpl, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("expandNameTemplate(%q) = %q, %v, want %q", tt.tmpl, got, err, tt.want)
+		}
+	}
+	if _, err := expandNameTemplate("{size}", vars); err == nil {
+		t.Error("expandNameTemplate accepted an unknown field")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+// Layouts of the beforeafter command: the two images next to each other, or one image whose left part
+// shows the first and right part the second
+var beforeAfterLayouts = []string{"side", "split"}
+
+// Settings of the beforeafter command
+type beforeAfterConfig struct {
+	layout   string
+	position int  // Percentage of the width at which split switches to the second image
+	gap      int  // Pixels between the images side by side
+	labels   bool // Marks the images "BEFORE" and "AFTER"
+	before   string
+	after    string
+	output   string
+}
+
+// Parses the arguments of the beforeafter command
+func parseBeforeAfterArgs(args []string) (*beforeAfterConfig, error) {
+	cfg := &beforeAfterConfig{layout: "side", position: 50, gap: 8}
+	flags := []flagSpec{
+		{Name: "layout", Target: &cfg.layout, Choices: beforeAfterLayouts},
+		{Name: "position", Target: &cfg.position},
+		{Name: "gap", Target: &cfg.gap},
+		{Name: "labels", Target: &cfg.labels},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 3 {
+		return nil, msgError("usage.beforeafter")
+	}
+	if cfg.position > 100 {
+		return nil, msgError("error.split_position", cfg.position)
+	}
+	cfg.before, cfg.after, cfg.output = positional[0], positional[1], positional[2]
+	return cfg, nil
+}
+
+// Puts an image and its processed version into one comparison image, to show what a filter does.
+// The output format follows the extension of the output file.
+func runBeforeAfter(args []string) error {
+	cfg, err := parseBeforeAfterArgs(args)
+	if err != nil {
+		return err
+	}
+	bmpHeader, dibHeader, before, err := globalSettings.loadImage(cfg.before)
+	if err != nil {
+		return err
+	}
+	_, _, after, err := globalSettings.loadImage(cfg.after)
+	if err != nil {
+		return err
+	}
+
+	var result *Image
+	if cfg.layout == "split" {
+		if before.Width != after.Width || before.Height != after.Height {
+			return msgError("error.compare_size", before.Width, before.Height, after.Width, after.Height)
+		}
+		result = splitImages(before, after, before.Width*cfg.position/100)
+		if cfg.labels {
+			result = applyStamp(applyStamp(result, "top-left", "BEFORE"), "top-right", "AFTER")
+		}
+	} else {
+		if cfg.labels {
+			before, after = applyStamp(before, "top-left", "BEFORE"), applyStamp(after, "top-left", "AFTER")
+		}
+		result = sideBySide(before, after, cfg.gap)
+	}
+	return globalSettings.saveOutput(cfg.output, "", bmpHeader, dibHeader, result)
+}
+
+// Returns the two images next to each other, gap pixels apart and aligned at the top, on white
+func sideBySide(left, right *Image, gap int) *Image {
+	width, height := left.Width+gap+right.Width, max(left.Height, right.Height)
+	result := &Image{Width: width, Height: height, Pixels: make([]Pixel, width*height)}
+	if left.Alpha != nil || right.Alpha != nil {
+		result.Alpha = make([]byte, width*height)
+	}
+	for i := range result.Pixels {
+		result.Pixels[i] = Pixel{Blue: 255, Green: 255, Red: 255}
+		if result.Alpha != nil {
+			result.Alpha[i] = 255
+		}
+	}
+	copyInto(result, left, 0)
+	copyInto(result, right, left.Width+gap)
+	return result
+}
+
+// Copies an image into a taller or equal one with its top-left corner at column x of the top row
+func copyInto(dst, src *Image, x int) {
+	for y := 0; y < src.Height; y++ {
+		from := (src.Height - 1 - y) * src.Width
+		to := (dst.Height-1-y)*dst.Width + x
+		copy(dst.Pixels[to:to+src.Width], src.Pixels[from:from+src.Width])
+		if dst.Alpha != nil {
+			for k := 0; k < src.Width; k++ {
+				dst.Alpha[to+k] = alphaAt(src, from+k)
+			}
+		}
+	}
+}
+
+// Returns an image that shows the columns left of at from before and the rest from after, with a white
+// line of two pixels, or one in narrow images, marking where they meet as the handle of a slider would
+func splitImages(before, after *Image, at int) *Image {
+	result := &Image{Width: before.Width, Height: before.Height, Pixels: make([]Pixel, len(before.Pixels)), Gap: before.Gap, Palette: before.Palette}
+	if before.Alpha != nil || after.Alpha != nil {
+		result.Alpha = make([]byte, len(before.Pixels))
+	}
+	line := min(2, before.Width/100+1)
+	for i := range result.Pixels {
+		x := i % before.Width
+		src := after
+		if x < at {
+			src = before
+		}
+		result.Pixels[i] = src.Pixels[i]
+		if result.Alpha != nil {
+			result.Alpha[i] = alphaAt(src, i)
+		}
+		if x >= at-line/2 && x < at-line/2+line && at > 0 && at < before.Width {
+			result.Pixels[i] = Pixel{Blue: 255, Green: 255, Red: 255}
+			if result.Alpha != nil {
+				result.Alpha[i] = 255
+			}
+		}
+	}
+	return result
+}
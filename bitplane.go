@@ -0,0 +1,50 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Channels --bitplane can extract a bit from
+var bitplaneChannels = []string{"red", "green", "blue", "alpha"}
+
+// Parses a --bitplane value of the form channel:bit, with bit 0 the least significant
+func parseBitplane(value string) (channel string, bit int, err error) {
+	channel, b, found := strings.Cut(value, ":")
+	bit, err = strconv.Atoi(b)
+	if !found || err != nil || bit < 0 || bit > 7 || !slices.Contains(bitplaneChannels, channel) {
+		return "", 0, msgError("error.invalid_bitplane", value)
+	}
+	return channel, bit, nil
+}
+
+// Returns an opaque black and white image of one bit of a channel: white where the bit is set. Images
+// without alpha read as fully opaque, so their alpha planes are white.
+func applyBitplane(img *Image, channel string, bit int, progress rowProgress) *Image {
+	result := &Image{Width: img.Width, Height: img.Height, Pixels: make([]Pixel, len(img.Pixels)), Gap: img.Gap, Palette: img.Palette}
+	if img.Alpha != nil {
+		result.Alpha = slices.Repeat([]byte{255}, len(img.Pixels))
+	}
+	white := Pixel{Blue: 255, Green: 255, Red: 255}
+	for y := 0; y < img.Height; y++ {
+		for i := y * img.Width; i < (y+1)*img.Width; i++ {
+			var v byte
+			switch p := img.Pixels[i]; channel {
+			case "red":
+				v = p.Red
+			case "green":
+				v = p.Green
+			case "blue":
+				v = p.Blue
+			default:
+				v = alphaAt(img, i)
+			}
+			if v>>bit&1 == 1 {
+				result.Pixels[i] = white
+			}
+		}
+		progress.Report(y+1, img.Height)
+	}
+	return result
+}
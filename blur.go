@@ -0,0 +1,21 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"creditcard/bmp"
+)
+
+// Parses a --blur value of the form radius[,kernel]
+func parseBlur(value string) (radius int, kernel string, err error) {
+	number, kernel, found := strings.Cut(value, ",")
+	if !found {
+		kernel = bmp.BlurKernels[0]
+	}
+	radius, err = strconv.Atoi(number)
+	if err != nil || radius < 1 || radius > bmp.MaxBlurRadius || !contains(bmp.BlurKernels, kernel) {
+		return 0, "", msgError("error.invalid_blur", value, bmp.MaxBlurRadius)
+	}
+	return radius, kernel, nil
+}
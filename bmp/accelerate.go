@@ -0,0 +1,52 @@
+package bmp
+
+// A compute device that per-pixel filters, convolutions and resampling can hand their work to, such as a
+// GPU. Each method returns false when the device cannot do the work, and the CPU code does it instead, so
+// an accelerator may support as little as it likes. Results may differ from the CPU ones by rounding, as
+// devices add up in single precision.
+type Accelerator interface {
+	// Name of the device, for messages
+	Name() string
+	// Writes to result the pixels with one of the filters of pixelFilters applied
+	Filter(pixels, result []Pixel, filter string) bool
+	// Returns what convolveChannels does for a square kernel given from the top of the image down
+	Convolve(pixels []Pixel, width, height int, kernel []float32, edge string) ([][3]float32, bool)
+	// Resamples an image of four float channels per pixel to the size of the taps, first along rows and
+	// then along columns, as separable filters do
+	Resample(src []float32, width, height int, columns, rows Taps) ([]float32, bool)
+}
+
+// Accelerator used instead of the CPU where it can, or nil to use the CPU only
+var Accel Accelerator
+
+// Source pixels that contribute to each result pixel along one axis of a resampling filter, packed for
+// copying to a device: the taps of result pixel i are Index[Start[i]:Start[i+1]] with their Weight
+type Taps struct {
+	Start  []int32
+	Index  []int32
+	Weight []float32
+}
+
+// Returns the filter index of pixelFilters that an accelerator's kernels number, in the order of Filters
+func FilterIndex(filter string) (int, bool) {
+	for i, name := range Filters[:5] {
+		if name == filter {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Returns the sRGB to linear-light table and the level thresholds GrayLevel uses, in single precision,
+// for accelerators that compute grayscale levels
+func GrayTables() (linear, thresholds []float32, weights [3]float32) {
+	linear = make([]float32, len(srgbToLinear))
+	for i, v := range srgbToLinear {
+		linear[i] = float32(v)
+	}
+	thresholds = make([]float32, len(srgbThresholds))
+	for i, v := range srgbThresholds {
+		thresholds[i] = float32(v)
+	}
+	return linear, thresholds, [3]float32{float32(lumaRed), float32(lumaGreen), float32(lumaBlue)}
+}
@@ -0,0 +1,110 @@
+package bmp
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Represents the header in front of each image of an OS/2 bitmap array (14 bytes)
+type ArrayHeader struct {
+	FileType      [2]byte // "BA"
+	HeaderSize    uint32  // Size of this header
+	OffsetNext    uint32  // Offset of the next entry's array header, 0 for the last entry
+	DisplayWidth  uint16  // Width of the display the image is designed for
+	DisplayHeight uint16  // Height of the display the image is designed for
+}
+
+// Size of ArrayHeader in the file
+const arrayHeaderSize = 14
+
+// Represents one image of a bitmap array. Offsets in its BMP header are relative to the start of the file.
+type ArrayEntry struct {
+	Offset int64 // Position of the entry's array header
+	Array  ArrayHeader
+	BMP    BMPHeader
+	DIB    DIBHeader
+}
+
+// Follows the chain of array headers from the start of a stream, or returns nil if the stream
+// does not start with one
+func DecodeArray(r io.ReadSeeker) ([]ArrayEntry, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, newError("error.seek_pixels", err)
+	}
+	var signature [2]byte
+	if _, err := io.ReadFull(r, signature[:]); err != nil || string(signature[:]) != "BA" {
+		return nil, nil
+	}
+
+	var entries []ArrayEntry
+	for offset := int64(0); ; {
+		entry := ArrayEntry{Offset: offset}
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, newError("error.seek_pixels", err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &entry.Array); err != nil {
+			return nil, newError("error.read_array", offset, err)
+		}
+		if string(entry.Array.FileType[:]) != "BA" {
+			return nil, newError("error.array_entry", offset)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &entry.BMP); err != nil {
+			return nil, newError("error.read_bmp_header", err)
+		}
+		dibHeader, err := readDIBHeader(r)
+		if err != nil {
+			return nil, newError("error.read_dib_header", err)
+		}
+		entry.DIB = dibHeader
+		expandCoreHeader(&entry.DIB)
+		entries = append(entries, entry)
+
+		// Entries only ever point forward, which also rules out loops
+		next := int64(entry.Array.OffsetNext)
+		if next == 0 {
+			return entries, nil
+		}
+		if next <= offset {
+			return nil, newError("error.array_loop", offset, next)
+		}
+		offset = next
+	}
+}
+
+// Positions the stream at the BMP header of the image with the given index and returns that position.
+// A plain BMP file holds a single image at the start of the file.
+func seekImage(r io.ReadSeeker, index int) (int64, error) {
+	entries, err := DecodeArray(r)
+	if err != nil {
+		return 0, err
+	}
+
+	var pos int64
+	switch {
+	case entries == nil && index == 0:
+	case index < len(entries):
+		pos = entries[index].Offset + arrayHeaderSize
+	default:
+		return 0, newError("error.image_index", index, max(len(entries), 1))
+	}
+	if _, err := r.Seek(pos, io.SeekStart); err != nil {
+		return 0, newError("error.seek_pixels", err)
+	}
+	return pos, nil
+}
+
+// Converts an OS/2 1.x BITMAPCOREHEADER, read as the start of a DIBHeader, into the usual fields.
+// The core header stores the width, height, planes and bit count as 16-bit values.
+func expandCoreHeader(dibHeader *DIBHeader) {
+	if dibHeader.DibHeaderSize != 12 {
+		return
+	}
+	width, height := uint32(dibHeader.Width), uint32(dibHeader.Height)
+	*dibHeader = DIBHeader{
+		DibHeaderSize: 12,
+		Width:         int32(uint16(width)),
+		Height:        int32(uint16(width >> 16)),
+		Planes:        uint16(height),
+		BitCount:      uint16(height >> 16),
+	}
+}
@@ -0,0 +1,86 @@
+package bmp
+
+import (
+	"math"
+	"slices"
+)
+
+// Kernels of Blur: a Gaussian bell or an even box
+var BlurKernels = []string{"gaussian", "box"}
+
+// Largest radius of Blur
+const MaxBlurRadius = 200
+
+// Returns the weights of a kernel reaching radius pixels to either side. The Gaussian one has a standard
+// deviation of a third of the radius, so the bell fades out at its ends.
+func blurWeights(radius int, kernel string) []float64 {
+	weights := make([]float64, 2*radius+1)
+	sigma := float64(radius) / 3
+	for i := range weights {
+		weights[i] = 1
+		if kernel == "gaussian" {
+			d := float64(i - radius)
+			weights[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		}
+	}
+	return weights
+}
+
+// Blurs the image with a kernel of the given radius. The kernel is separable, so rows are blurred first and
+// columns then, which costs 2r+1 rather than (2r+1)² steps per pixel. Pixels beyond the borders are left
+// out and the weights of the rest rescaled, as the blur filter does.
+func BlurPixels(pixels []Pixel, width, height, radius int, kernel string, progress Progress) []Pixel {
+	weights := blurWeights(radius, kernel)
+	// Each pass takes half of the progress
+	firstHalf := func(done, total int) { progress.Report(done, 2*total) }
+	secondHalf := func(done, total int) { progress.Report(total+done, 2*total) }
+
+	rows := make([][3]float32, len(pixels))
+	parallelRows(height, 1, firstHalf, func(start, end int) {
+		for y := start; y < end; y++ {
+			for x := 0; x < width; x++ {
+				var sum [3]float64
+				var total float64
+				for kx := max(x-radius, 0); kx <= min(x+radius, width-1); kx++ {
+					w := weights[kx-x+radius]
+					p := pixels[y*width+kx]
+					sum[0], sum[1], sum[2] = sum[0]+w*float64(p.Blue), sum[1]+w*float64(p.Green), sum[2]+w*float64(p.Red)
+					total += w
+				}
+				rows[y*width+x] = [3]float32{float32(sum[0] / total), float32(sum[1] / total), float32(sum[2] / total)}
+			}
+		}
+	})
+
+	result := make([]Pixel, len(pixels))
+	parallelRows(height, 1, secondHalf, func(start, end int) {
+		for y := start; y < end; y++ {
+			for x := 0; x < width; x++ {
+				var sum [3]float64
+				var total float64
+				for ky := max(y-radius, 0); ky <= min(y+radius, height-1); ky++ {
+					w := weights[ky-y+radius]
+					c := rows[ky*width+x]
+					sum[0], sum[1], sum[2] = sum[0]+w*float64(c[0]), sum[1]+w*float64(c[1]), sum[2]+w*float64(c[2])
+					total += w
+				}
+				result[y*width+x] = Pixel{
+					Blue:  byte(math.Round(sum[0] / total)),
+					Green: byte(math.Round(sum[1] / total)),
+					Red:   byte(math.Round(sum[2] / total)),
+				}
+			}
+		}
+	})
+	return result
+}
+
+// Returns the image blurred with one of BlurKernels. Pixels stay in place, so alpha and hints are kept.
+func (img *Image) Blur(radius int, kernel string, progress Progress) (*Image, error) {
+	if radius < 1 || radius > MaxBlurRadius || !slices.Contains(BlurKernels, kernel) {
+		return nil, newError("error.blur", radius, kernel)
+	}
+	result := img.derive(img.Width, img.Height, BlurPixels(img.Pixels, img.Width, img.Height, radius, kernel, progress))
+	result.Alpha, result.Hints = img.Alpha, img.Hints
+	return result, nil
+}
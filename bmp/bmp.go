@@ -0,0 +1,126 @@
+// Package bmp reads and writes BMP files and transforms their pixels.
+//
+// Decode and Encode cover the common case. DecodeHeaders, DecodePixels and EncodePixels give access to
+// the headers and to the options of the command-line tool: size limits, strict and permissive parsing,
+// OS/2 bitmap arrays, indexed and embedded output. RowReader and RowWriter process images larger than
+// memory one row at a time. Image.Composite lays one image over another in linear light, with blend
+// modes that programs can extend through RegisterBlendMode. Stats gathers histograms and other statistics
+// of an image. DecodeProfile and ParseProfile read the ICC color profile a V5 header embeds, which
+// Image.Profile carries through to the output. Errors are *Error values that errors.Is matches against
+// kinds such as ErrNotBMP, ErrInvalidBMP and ErrUnsupportedBitCount.
+package bmp
+
+import (
+	"bytes"
+	"io"
+)
+
+// Represents BMP header structure (first 14 bytes)
+type BMPHeader struct {
+	FileType [2]byte // "BM"
+	FileSize uint32  // File size in bytes
+	Reserved uint32  // Reserved (always 0)
+	// Reserved2  uint16  // Reserved (always 0)
+	OffsetData uint32 // Offset to image data
+}
+
+// Represents DIB header structure: the 40 bytes of BITMAPINFOHEADER, followed by the fields that the
+// V4 and V5 headers add, which are zero for shorter headers
+type DIBHeader struct {
+	DibHeaderSize uint32 // DIB Header size
+	Width         int32  // Width of image in pixels
+	Height        int32  // Height of image in pixels
+	Planes        uint16 // Number of color planes (must be 1)
+	BitCount      uint16 // Bits per pixel (e.g., 24 for true color)
+	Compression   uint32 // Compression (0 for uncompressed)
+	ImageSize     uint32 // Image size in bytes (can be 0 for uncompressed)
+	XPixelsPerM   int32  // Horizontal resolution (pixels per meter)
+	YPixelsPerM   int32  // Vertical resolution (pixels per meter)
+	ColorsUsed    uint32 // Number of colors used (0 means all)
+	ColorsImp     uint32 // Important colors (0 means all)
+	// Channels of BI_BITFIELDS pixel data, which follow a 40-byte header as a separate table
+	RedMask   uint32
+	GreenMask uint32
+	BlueMask  uint32
+	AlphaMask uint32
+	// Color space of a V4 or V5 header, e.g. "sRGB" as a four-character code, or 0 for calibrated RGB
+	ColorSpace uint32
+	Endpoints  [9]int32  // CIEXYZ coordinates of the red, green and blue endpoints for calibrated RGB
+	Gamma      [3]uint32 // Gamma of the red, green and blue channels for calibrated RGB
+	// Fields of a V5 header
+	Intent      uint32 // Rendering intent
+	ProfileData uint32 // Offset of the ICC profile from the start of the DIB header
+	ProfileSize uint32 // Size of the ICC profile in bytes
+	V5Reserved  uint32
+}
+
+// Represents a single pixel in the image
+type Pixel struct {
+	Blue  byte
+	Green byte
+	Red   byte
+}
+
+// Returns the perceived brightness of a color, scaled by 1000
+func (p Pixel) Luminance() int {
+	return 299*int(p.Red) + 587*int(p.Green) + 114*int(p.Blue)
+}
+
+// Represents a decoded image together with its dimensions
+type Image struct {
+	Width  int
+	Height int
+	Pixels []Pixel // Rows are stored bottom-up, as in the BMP file
+	Gap    []byte  // Bytes between the headers and the pixel data of the source file
+	// Color table of an indexed source file and, until an operation changes the pixels, their indices into it
+	Palette []Pixel
+	Indices []byte
+	// Regions of interest, kept while operations leave the pixels in place
+	Hints []Hint
+	// Opacity of each pixel, in the order of Pixels, or nil when the image is opaque
+	Alpha []byte
+	// ICC color profile embedded in a V5 source file, which EncodePixels embeds in the output as well
+	Profile []byte
+}
+
+// A region of interest, such as a detected face, in pixels from the top-left corner
+type Hint struct {
+	X      int     `json:"x"`
+	Y      int     `json:"y"`
+	Width  int     `json:"width"`
+	Height int     `json:"height"`
+	Weight float64 `json:"weight"` // Importance relative to other regions, 1 when left out
+}
+
+// Reports how many output rows of a transform are done; a nil Progress reports nothing
+type Progress func(done, total int)
+
+// Calls the progress function, if there is one
+func (progress Progress) Report(done, total int) {
+	if progress != nil {
+		progress(done, total)
+	}
+}
+
+// Reads a BMP file with the default options. Streams that cannot seek are read into memory first.
+func Decode(r io.Reader) (*Image, error) {
+	rs, ok := r.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, newError("error.read_bmp_header", err)
+		}
+		rs = bytes.NewReader(data)
+	}
+	bmpHeader, dibHeader, err := DecodeHeaders(rs, DecodeOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return DecodePixels(rs, bmpHeader, dibHeader, DecodeOptions{})
+}
+
+// Writes the image as a BMP file with the default options
+func Encode(w io.Writer, img *Image) error {
+	dibHeader := DIBHeader{Width: int32(img.Width), Height: int32(img.Height)}
+	return EncodePixels(w, &BMPHeader{}, &dibHeader, img, EncodeOptions{})
+}
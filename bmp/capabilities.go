@@ -0,0 +1,38 @@
+package bmp
+
+// A compression value of the DIB header and what this package does with it
+type Compression struct {
+	Value     uint32 `json:"value"`
+	Name      string `json:"name"`       // Name of the constant in the Windows headers
+	BitCounts []int  `json:"bit_counts"` // Bits per pixel it is read with; 0 when the stream sets them
+	Read      bool   `json:"read"`
+	Write     bool   `json:"write"`
+}
+
+// Compression values DecodePixels reads and Encode writes, in the order of their values
+var Compressions = []Compression{
+	{Value: 0, Name: "BI_RGB", BitCounts: []int{1, 4, 8, 24, 32}, Read: true, Write: true},
+	{Value: 1, Name: "BI_RLE8", BitCounts: []int{8}, Read: true},
+	{Value: 2, Name: "BI_RLE4", BitCounts: []int{4}, Read: true},
+	{Value: compressionBitFields, Name: "BI_BITFIELDS", BitCounts: []int{32}, Read: true},
+	{Value: compressionJPEG, Name: "BI_JPEG", BitCounts: []int{0}, Read: true, Write: true},
+	{Value: compressionPNG, Name: "BI_PNG", BitCounts: []int{0}, Read: true, Write: true},
+	{Value: compressionAlphaBitFields, Name: "BI_ALPHABITFIELDS", BitCounts: []int{32}, Read: true},
+}
+
+// Bits per pixel of the uncompressed files DecodePixels reads and Encode writes: 1, 4 and 8-bit files
+// hold color table indices and are written with EncodeOptions.Compact
+var (
+	ReadBitCounts  = []int{1, 4, 8, 24, 32}
+	WriteBitCounts = []int{1, 4, 8, 24, 32}
+)
+
+// Returns the DIB header sizes DecodeHeaders accepts in strict mode, from the OS/2 core header to
+// BITMAPV5HEADER
+func DIBHeaderSizes() []int {
+	sizes := make([]int, len(dibHeaderSizes))
+	for i, size := range dibHeaderSizes {
+		sizes[i] = int(size)
+	}
+	return sizes
+}
@@ -0,0 +1,128 @@
+package bmp
+
+import (
+	"math"
+	"sort"
+)
+
+// Linear-light intensity of each 8-bit sRGB level
+var srgbToLinear = func() (table [256]float64) {
+	for i := range table {
+		table[i] = decodeSRGB(float64(i) / 255)
+	}
+	return table
+}()
+
+// Linear-light intensities halfway between consecutive sRGB levels, where rounding to a level changes
+var srgbThresholds = func() (table [255]float64) {
+	for i := range table {
+		table[i] = decodeSRGB((float64(i) + 0.5) / 255)
+	}
+	return table
+}()
+
+// Rec. 709 weights of the linear-light red, green and blue intensities in the luminance of an sRGB color
+const lumaRed, lumaGreen, lumaBlue = 0.2126, 0.7152, 0.0722
+
+// Returns the linear-light intensity of an sRGB value, both from 0 to 1
+func decodeSRGB(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// Returns the 8-bit sRGB level of a linear-light intensity, clamped to [0, 1]
+func linearToSRGB(v float64) byte {
+	return byte(math.Round(EncodeSRGB(v) * 255))
+}
+
+// Returns the linear-light intensity of an sRGB value, both from 0 to 1, for callers that keep more than
+// 8 bits per channel
+func DecodeSRGB(v float64) float64 {
+	return decodeSRGB(v)
+}
+
+// Returns the sRGB value of a linear-light intensity clamped to [0, 1], reversing DecodeSRGB
+func EncodeSRGB(v float64) float64 {
+	v = math.Max(0, math.Min(v, 1))
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	// 1.055 - 0.055 rounds below 1, so full intensity is returned as it is
+	if v == 1 {
+		return 1
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// Returns the luminance of linear-light red, green and blue intensities, as GrayLevel weighs them
+func Luma(red, green, blue float64) float64 {
+	return lumaRed*red + lumaGreen*green + lumaBlue*blue
+}
+
+// 8-bit sRGB and linear-light levels of each other, for images kept in either encoding
+var (
+	toLinearLevel [256]byte
+	toSRGBLevel   [256]byte
+)
+
+func init() {
+	for i := range 256 {
+		toLinearLevel[i] = byte(math.Round(srgbToLinear[i] * 255))
+		toSRGBLevel[i] = linearToSRGB(float64(i) / 255)
+	}
+}
+
+// Returns the image with its sRGB levels re-encoded as linear-light ones, in which averaging colors
+// mixes light as it mixes physically. Eight bits merge the darkest sRGB shades into few linear levels.
+func (img *Image) ToLinear(progress Progress) *Image {
+	return img.mapLevels(&toLinearLevel, progress)
+}
+
+// Returns the image with its linear-light levels re-encoded as sRGB ones, reversing ToLinear
+func (img *Image) ToSRGB(progress Progress) *Image {
+	return img.mapLevels(&toSRGBLevel, progress)
+}
+
+// Returns the image with every color channel replaced through a table. Pixels stay in place, so alpha and
+// hints are kept.
+func (img *Image) mapLevels(levels *[256]byte, progress Progress) *Image {
+	result := img.derive(img.Width, img.Height, make([]Pixel, len(img.Pixels)))
+	result.Alpha, result.Hints = img.Alpha, img.Hints
+	parallelRows(img.Height, 1, progress, func(start, end int) {
+		for i := start * img.Width; i < end*img.Width; i++ {
+			p := img.Pixels[i]
+			result.Pixels[i] = Pixel{Blue: levels[p.Blue], Green: levels[p.Green], Red: levels[p.Red]}
+		}
+	})
+	return result
+}
+
+// Returns the sRGB level of the gray as bright as a color: its luminance, the Rec. 709 weighted sum of
+// its channels in linear light, encoded as sRGB. Averaging the sRGB levels instead makes greens too dark
+// and blues too light.
+func GrayLevel(p Pixel) byte {
+	y := lumaRed*srgbToLinear[p.Red] + lumaGreen*srgbToLinear[p.Green] + lumaBlue*srgbToLinear[p.Blue]
+	return byte(sort.Search(len(srgbThresholds), func(i int) bool { return srgbThresholds[i] > y }))
+}
+
+// Returns the linear-light intensity, from 0 to 1, of an 8-bit sRGB level
+func LinearIntensity(level byte) float64 {
+	return srgbToLinear[level]
+}
+
+// Returns the 8-bit sRGB level of a linear-light intensity, clamped to [0, 1]
+func SRGBLevel(intensity float64) byte {
+	return linearToSRGB(intensity)
+}
+
+// Returns the sRGB image with its exposure multiplied by gain: the linear-light intensity of every channel
+// is scaled, and clipped at white, as a longer or shorter exposure would
+func (img *Image) Expose(gain float64, progress Progress) *Image {
+	var levels [256]byte
+	for i := range levels {
+		levels[i] = linearToSRGB(srgbToLinear[i] * gain)
+	}
+	return img.mapLevels(&levels, progress)
+}
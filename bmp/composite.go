@@ -0,0 +1,109 @@
+package bmp
+
+import (
+	"math"
+	"slices"
+)
+
+// Blends one channel of a base and a top color, both in linear light from 0 to 1, into the color that
+// replaces the top one where it covers the base
+type BlendFunc func(base, top float64) float64
+
+// Blend modes by name, and their names in the order they were registered
+var (
+	blendModes     = map[string]BlendFunc{}
+	blendModeNames []string
+)
+
+// Makes a blend mode available to Composite under a name, replacing any mode of that name. Programs that
+// import the package add their own modes this way, next to the built-in ones; registration is meant for
+// init functions and must not run alongside Composite.
+func RegisterBlendMode(name string, blend BlendFunc) {
+	if _, ok := blendModes[name]; !ok {
+		blendModeNames = append(blendModeNames, name)
+	}
+	blendModes[name] = blend
+}
+
+// Returns the names of the registered blend modes, built-in ones first
+func BlendModes() []string {
+	return slices.Clone(blendModeNames)
+}
+
+func init() {
+	RegisterBlendMode("normal", func(base, top float64) float64 { return top })
+	RegisterBlendMode("multiply", func(base, top float64) float64 { return base * top })
+	RegisterBlendMode("screen", func(base, top float64) float64 { return base + top - base*top })
+	RegisterBlendMode("overlay", func(base, top float64) float64 {
+		if base <= 0.5 {
+			return 2 * base * top
+		}
+		return 1 - 2*(1-base)*(1-top)
+	})
+	RegisterBlendMode("darken", math.Min)
+	RegisterBlendMode("lighten", math.Max)
+	RegisterBlendMode("difference", func(base, top float64) float64 { return math.Abs(base - top) })
+}
+
+// Returns the image with top laid over it at offset x, y from the top-left corner, the alpha of top scaled
+// by opacity and its colors blended with the base by one of BlendModes. Colors are mixed in linear light
+// with the Porter-Duff over operator, so that half-covered pixels get the brightness the eye expects
+// rather than the darker midtones of mixing sRGB levels. Parts of top beyond the edges are clipped. The
+// result is opaque unless the image has alpha itself.
+func (img *Image) Composite(top *Image, x, y int, opacity float64, mode string, progress Progress) (*Image, error) {
+	if opacity < 0 || opacity > 1 || math.IsNaN(opacity) {
+		return nil, newError("error.opacity", opacity)
+	}
+	blend, ok := blendModes[mode]
+	if !ok {
+		return nil, newError("error.blend_mode", mode)
+	}
+	result := img.derive(img.Width, img.Height, make([]Pixel, len(img.Pixels)))
+	result.Hints = img.Hints
+	if img.Alpha != nil {
+		result.Alpha = make([]byte, len(img.Alpha))
+	}
+
+	// Rows are bottom-up, so the row ry of the result counts ty = img.Height-1-ry-y rows into top
+	parallelRows(img.Height, 1, progress, func(start, end int) {
+		for ry := start; ry < end; ry++ {
+			row := ry * img.Width
+			copy(result.Pixels[row:row+img.Width], img.Pixels[row:])
+			if img.Alpha != nil {
+				copy(result.Alpha[row:row+img.Width], img.Alpha[row:])
+			}
+			ty := img.Height - 1 - ry - y
+			if ty < 0 || ty >= top.Height {
+				continue
+			}
+			for tx := max(0, -x); tx < top.Width && x+tx < img.Width; tx++ {
+				i, j := row+x+tx, (top.Height-1-ty)*top.Width+tx
+				srcAlpha := opacity
+				if top.Alpha != nil {
+					srcAlpha *= float64(top.Alpha[j]) / 255
+				}
+				dstAlpha := 1.0
+				if result.Alpha != nil {
+					dstAlpha = float64(result.Alpha[i]) / 255
+				}
+				// Premultiplied over: the base shows through wherever top does not cover it
+				outAlpha := srcAlpha + dstAlpha*(1-srcAlpha)
+				if outAlpha == 0 {
+					continue
+				}
+				// Where the base is transparent the top color shows unblended, as in the W3C compositing model
+				mix := func(src, dst byte) byte {
+					s, d := srgbToLinear[src], srgbToLinear[dst]
+					s = (1-dstAlpha)*s + dstAlpha*blend(d, s)
+					return linearToSRGB((s*srcAlpha + d*dstAlpha*(1-srcAlpha)) / outAlpha)
+				}
+				s, d := top.Pixels[j], result.Pixels[i]
+				result.Pixels[i] = Pixel{Blue: mix(s.Blue, d.Blue), Green: mix(s.Green, d.Green), Red: mix(s.Red, d.Red)}
+				if result.Alpha != nil {
+					result.Alpha[i] = byte(math.Round(outAlpha * 255))
+				}
+			}
+		}
+	})
+	return result, nil
+}
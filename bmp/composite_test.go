@@ -0,0 +1,126 @@
+package bmp
+
+import (
+	"testing"
+)
+
+// Returns a one-pixel image of a gray level, opaque when alpha is 255 and with an alpha channel otherwise
+func grayPixel(level, alpha byte) *Image {
+	img := &Image{Width: 1, Height: 1, Pixels: []Pixel{{Blue: level, Green: level, Red: level}}}
+	if alpha != 255 {
+		img.Alpha = []byte{alpha}
+	}
+	return img
+}
+
+// Each blend mode laid over with the Porter-Duff over operator. The wanted levels are worked out apart from
+// the package: both colors decoded to linear light, the top color blended where the base covers it, the two
+// premultiplied by their alphas and summed, then divided by the alpha of the result and encoded to sRGB.
+func TestCompositeOver(t *testing.T) {
+	tests := []struct {
+		mode                string
+		base, top           byte
+		baseAlpha, topAlpha byte
+		want, wantAlpha     byte
+	}{
+		// Half-covered top over an opaque base
+		{"normal", 64, 200, 255, 128, 152, 255},
+		{"multiply", 64, 200, 255, 128, 57, 255},
+		{"screen", 64, 200, 255, 128, 155, 255},
+		{"overlay", 64, 200, 255, 128, 66, 255},
+		{"darken", 64, 200, 255, 128, 64, 255},
+		{"lighten", 64, 200, 255, 128, 152, 255},
+		{"difference", 64, 200, 255, 128, 147, 255},
+		// Half-covered top over a half-covered base
+		{"normal", 64, 200, 128, 128, 170, 192},
+		{"multiply", 64, 200, 128, 128, 129, 192},
+		{"screen", 64, 200, 128, 128, 171, 192},
+		{"overlay", 64, 200, 128, 128, 132, 192},
+		{"darken", 64, 200, 128, 128, 131, 192},
+		{"lighten", 64, 200, 128, 128, 170, 192},
+		{"difference", 64, 200, 128, 128, 167, 192},
+		// Opaque top over an opaque base, where only the blend mode decides
+		{"normal", 200, 64, 255, 255, 64, 255},
+		{"multiply", 200, 64, 255, 255, 48, 255},
+		{"screen", 200, 64, 255, 255, 203, 255},
+		{"overlay", 200, 64, 255, 255, 123, 255},
+		{"darken", 200, 64, 255, 255, 64, 255},
+		{"lighten", 200, 64, 255, 255, 200, 255},
+		{"difference", 200, 64, 255, 255, 192, 255},
+		// A transparent base, where the top color shows unblended with its own alpha
+		{"normal", 200, 64, 0, 51, 64, 51},
+		{"multiply", 200, 64, 0, 51, 64, 51},
+		{"screen", 200, 64, 0, 51, 64, 51},
+		{"overlay", 200, 64, 0, 51, 64, 51},
+		{"darken", 200, 64, 0, 51, 64, 51},
+		{"lighten", 200, 64, 0, 51, 64, 51},
+		{"difference", 200, 64, 0, 51, 64, 51},
+	}
+	for _, tt := range tests {
+		result, err := grayPixel(tt.base, tt.baseAlpha).Composite(grayPixel(tt.top, tt.topAlpha), 0, 0, 1, tt.mode, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.mode, err)
+		}
+		if got := result.Pixels[0]; got != (Pixel{Blue: tt.want, Green: tt.want, Red: tt.want}) {
+			t.Errorf("%s of %d (alpha %d) over %d (alpha %d) = %v, want level %d",
+				tt.mode, tt.top, tt.topAlpha, tt.base, tt.baseAlpha, got, tt.want)
+		}
+		if tt.baseAlpha == 255 {
+			if result.Alpha != nil {
+				t.Errorf("%s over an opaque base gave an alpha channel", tt.mode)
+			}
+		} else if result.Alpha[0] != tt.wantAlpha {
+			t.Errorf("%s of alpha %d over alpha %d gave alpha %d, want %d",
+				tt.mode, tt.topAlpha, tt.baseAlpha, result.Alpha[0], tt.wantAlpha)
+		}
+	}
+}
+
+// Every 8-bit level survives the trip to linear light and back, and the encoder clamps what lies outside
+// [0, 1]
+func TestSRGBRoundTrip(t *testing.T) {
+	for level := 0; level < 256; level++ {
+		if got := linearToSRGB(srgbToLinear[level]); got != byte(level) {
+			t.Errorf("level %d came back as %d", level, got)
+		}
+	}
+	for _, tt := range []struct{ in, want float64 }{{0, 0}, {1, 1}, {-0.5, 0}, {1.5, 1}} {
+		if got := EncodeSRGB(tt.in); got != tt.want {
+			t.Errorf("EncodeSRGB(%g) = %g, want %g", tt.in, got, tt.want)
+		}
+	}
+	if DecodeSRGB(0) != 0 || DecodeSRGB(1) != 1 {
+		t.Errorf("DecodeSRGB maps 0 and 1 to %g and %g", DecodeSRGB(0), DecodeSRGB(1))
+	}
+}
+
+// A top of alpha 0 leaves every level of the base as it was, and an opaque top in normal mode replaces it
+// exactly, whatever the level, so that compositing does not drift colors through the linear-light trip
+func TestCompositeAlphaEdges(t *testing.T) {
+	for level := 0; level < 256; level++ {
+		base, top := grayPixel(byte(level), 255), grayPixel(byte(255-level), 0)
+		for _, mode := range BlendModes() {
+			result, err := base.Composite(top, 0, 0, 1, mode, nil)
+			if err != nil {
+				t.Fatalf("%s: %v", mode, err)
+			}
+			if result.Pixels[0] != base.Pixels[0] {
+				t.Errorf("%s of a transparent top changed level %d to %v", mode, level, result.Pixels[0])
+			}
+		}
+
+		top.Alpha[0] = 255
+		for _, baseAlpha := range []byte{0, 255} {
+			result, err := grayPixel(byte(level), baseAlpha).Composite(top, 0, 0, 1, "normal", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Pixels[0] != top.Pixels[0] {
+				t.Errorf("opaque level %d over base alpha %d gave %v", 255-level, baseAlpha, result.Pixels[0])
+			}
+			if result.Alpha != nil && result.Alpha[0] != 255 {
+				t.Errorf("opaque level %d over base alpha %d gave alpha %d", 255-level, baseAlpha, result.Alpha[0])
+			}
+		}
+	}
+}
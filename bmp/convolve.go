@@ -0,0 +1,150 @@
+package bmp
+
+import (
+	"math"
+	"slices"
+)
+
+// Ways Convolve reads pixels beyond the borders: the nearest border pixel, the pixel from the opposite
+// side, or the pixel reflected across the border
+var EdgeModes = []string{"clamp", "wrap", "mirror"}
+
+// Sides of the square kernels Convolve accepts
+var KernelSizes = []int{3, 5}
+
+// Kernels of the sharpen and emboss filters and the two Sobel kernels of the edge filter, with rows
+// going from the top of the image down
+var (
+	sharpenKernel = []float64{0, -1, 0, -1, 5, -1, 0, -1, 0}
+	embossKernel  = []float64{-1, -1, 0, -1, 0, 1, 0, 1, 1}
+	sobelX        = []float64{-1, 0, 1, -2, 0, 2, -1, 0, 1}
+	sobelY        = []float64{-1, -2, -1, 0, 0, 0, 1, 2, 1}
+)
+
+// Returns the index within [0, n) that an index beyond it reads under an edge mode
+func edgeIndex(i, n int, edge string) int {
+	if i >= 0 && i < n {
+		return i
+	}
+	switch edge {
+	case "wrap":
+		return (i%n + n) % n
+	case "mirror":
+		// Reflects about the border pixels, which are not repeated; images narrower than the kernel
+		// bounce back and forth
+		if n == 1 {
+			return 0
+		}
+		period := 2 * (n - 1)
+		i = (i%period + period) % period
+		if i >= n {
+			i = period - i
+		}
+		return i
+	}
+	return min(max(i, 0), n-1)
+}
+
+// Weighs the neighborhood of every pixel with a square kernel whose rows go from the top of the image
+// down, returning the unrounded sums of each channel in blue, green, red order. Bands of rows are
+// convolved concurrently; each reads the source, so bands never see each other's output.
+func convolveChannels(pixels []Pixel, width, height int, kernel []float64, edge string, progress Progress) [][3]float32 {
+	if Accel != nil {
+		weights := make([]float32, len(kernel))
+		for i, w := range kernel {
+			weights[i] = float32(w)
+		}
+		if result, ok := Accel.Convolve(pixels, width, height, weights, edge); ok {
+			progress.Report(height, height)
+			return result
+		}
+	}
+	size := int(math.Sqrt(float64(len(kernel))))
+	half := size / 2
+	result := make([][3]float32, len(pixels))
+	parallelRows(height, 1, progress, func(start, end int) {
+		for y := start; y < end; y++ {
+			for x := 0; x < width; x++ {
+				var sum [3]float64
+				for ky := 0; ky < size; ky++ {
+					// Rows are stored bottom-up, so kernel rows further down read rows stored further up
+					row := edgeIndex(y+half-ky, height, edge) * width
+					for kx := 0; kx < size; kx++ {
+						w := kernel[ky*size+kx]
+						if w == 0 {
+							continue
+						}
+						p := pixels[row+edgeIndex(x+kx-half, width, edge)]
+						sum[0], sum[1], sum[2] = sum[0]+w*float64(p.Blue), sum[1]+w*float64(p.Green), sum[2]+w*float64(p.Red)
+					}
+				}
+				result[y*width+x] = [3]float32{float32(sum[0]), float32(sum[1]), float32(sum[2])}
+			}
+		}
+	})
+	return result
+}
+
+// Returns a level rounded and clamped to 0-255
+func clampLevel(v float64) byte {
+	return byte(min(max(math.Round(v), 0), 255))
+}
+
+// Weighs the neighborhood of every pixel with a 3x3 or 5x5 kernel given row by row from the top of the
+// image down, adds bias to every channel and clamps the results to 0-255. Pixels beyond the borders are
+// read as one of EdgeModes says.
+func ConvolvePixels(pixels []Pixel, width, height int, kernel []float64, bias float64, edge string, progress Progress) []Pixel {
+	sums := convolveChannels(pixels, width, height, kernel, edge, progress)
+	result := make([]Pixel, len(pixels))
+	for i, s := range sums {
+		result[i] = Pixel{
+			Blue:  clampLevel(float64(s[0]) + bias),
+			Green: clampLevel(float64(s[1]) + bias),
+			Red:   clampLevel(float64(s[2]) + bias),
+		}
+	}
+	return result
+}
+
+// Returns the gradient magnitude of every channel found with the Sobel kernels, which is bright where the
+// image changes sharply and black where it is flat
+func sobelPixels(pixels []Pixel, width, height int, edge string, progress Progress) []Pixel {
+	// Each kernel takes half of the progress
+	firstHalf := func(done, total int) { progress.Report(done, 2*total) }
+	secondHalf := func(done, total int) { progress.Report(total+done, 2*total) }
+	gx := convolveChannels(pixels, width, height, sobelX, edge, firstHalf)
+	gy := convolveChannels(pixels, width, height, sobelY, edge, secondHalf)
+	result := make([]Pixel, len(pixels))
+	for i := range result {
+		var c [3]byte
+		for k := range c {
+			c[k] = clampLevel(math.Hypot(float64(gx[i][k]), float64(gy[i][k])))
+		}
+		result[i] = Pixel{Blue: c[0], Green: c[1], Red: c[2]}
+	}
+	return result
+}
+
+// Returns the image convolved with a 3x3 or 5x5 kernel given row by row from the top of the image down.
+// A kernel whose weights do not add up to 0 is divided by their sum, so that flat areas keep their
+// brightness. Pixels stay in place, so alpha and hints are kept.
+func (img *Image) Convolve(kernel []float64, edge string, progress Progress) (*Image, error) {
+	size := int(math.Sqrt(float64(len(kernel))))
+	if size*size != len(kernel) || !slices.Contains(KernelSizes, size) || !slices.Contains(EdgeModes, edge) {
+		return nil, newError("error.convolve", len(kernel), edge)
+	}
+	var sum float64
+	for _, w := range kernel {
+		sum += w
+	}
+	if sum != 0 {
+		normalized := make([]float64, len(kernel))
+		for i, w := range kernel {
+			normalized[i] = w / sum
+		}
+		kernel = normalized
+	}
+	result := img.derive(img.Width, img.Height, ConvolvePixels(img.Pixels, img.Width, img.Height, kernel, 0, edge, progress))
+	result.Alpha, result.Hints = img.Alpha, img.Hints
+	return result, nil
+}
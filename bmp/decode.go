@@ -0,0 +1,215 @@
+package bmp
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Reads the BMP and DIB headers of the image selected by opts.Index from a stream
+func DecodeHeaders(r io.ReadSeeker, opts DecodeOptions) (*BMPHeader, *DIBHeader, error) {
+	if _, err := seekImage(r, opts.Index); err != nil {
+		return nil, nil, err
+	}
+
+	// Read the BMP header info
+	var bmpHeader BMPHeader
+	if err := binary.Read(r, binary.LittleEndian, &bmpHeader); err != nil {
+		return nil, nil, newError("error.read_bmp_header", err)
+	}
+
+	// Read the DIB header info
+	dibHeader, err := readDIBHeader(r)
+	if err != nil {
+		return nil, nil, newError("error.read_dib_header", err)
+	}
+	expandCoreHeader(&dibHeader)
+
+	if string(bmpHeader.FileType[:]) != "BM" {
+		// Rescued files sometimes lose the signature while the rest of the headers survive
+		if opts.Mode != "permissive" || !plausibleDIBHeader(&dibHeader) {
+			return nil, nil, newError("error.not_bmp")
+		}
+		opts.warn(newError("format.signature", string(bmpHeader.FileType[:])))
+	}
+	if opts.Mode == "strict" {
+		if err := checkStrictHeaders(&bmpHeader, &dibHeader); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return &bmpHeader, &dibHeader, nil
+}
+
+// Reads the pixel data of the image selected by opts.Index from a stream positioned anywhere within the file.
+// Pixel memory is only allocated once the image is known to be within the limits of opts
+func DecodePixels(r io.ReadSeeker, bmpHeader *BMPHeader, dibHeader *DIBHeader, opts DecodeOptions) (*Image, error) {
+	embedded := isEmbedded(dibHeader)
+	indexed := isIndexed(dibHeader)
+	if dibHeader.BitCount != 24 && dibHeader.BitCount != 32 && !indexed && !embedded {
+		return nil, newError("error.bit_count", dibHeader.BitCount)
+	}
+	if dibHeader.Compression != 0 && !embedded && !isRunLength(dibHeader) && !isBitFields(dibHeader) {
+		return nil, newError("error.compression", dibHeader.Compression)
+	}
+	// Only plain rows may be stored top-down, which a negative height marks
+	topDown := dibHeader.Height < 0 && !embedded && !isRunLength(dibHeader)
+	if dibHeader.Width <= 0 || dibHeader.Height == 0 || (dibHeader.Height < 0 && !topDown) {
+		return nil, newError("error.dimensions", dibHeader.Width, dibHeader.Height)
+	}
+
+	fileSize, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, newError("error.seek_pixels", err)
+	}
+	if err := opts.check(dibHeader, fileSize); err != nil {
+		return nil, err
+	}
+	base, err := seekImage(r, opts.Index)
+	if err != nil {
+		return nil, err
+	}
+	// The BMP header of an array entry describes the entry rather than the whole file
+	layoutSize := fileSize
+	if base > 0 {
+		layoutSize = int64(bmpHeader.FileSize)
+	}
+	// Pixel data starts at OffsetData, not necessarily right after the headers
+	offset := int64(bmpHeader.OffsetData)
+	if err := opts.checkLayout(bmpHeader, dibHeader, layoutSize, offset); err != nil {
+		return nil, err
+	}
+	if base == 0 {
+		fileSize = opts.dataSize(bmpHeader, fileSize)
+	}
+	if offset > fileSize {
+		return nil, newError("error.offset_beyond", offset, fileSize)
+	}
+	if err := opts.checkPixelData(dibHeader, offset, fileSize, false); err != nil {
+		return nil, err
+	}
+	width, height := int(dibHeader.Width), int(dibHeader.Height)
+	if topDown {
+		height = -height
+	}
+	img := &Image{Width: width, Height: height}
+	if img.Profile, err = DecodeProfile(r, dibHeader, opts); err != nil {
+		return nil, err
+	}
+
+	// Indexed images keep their color table, which follows the DIB header
+	gapStart := int64(headersSize)
+	if indexed {
+		if img.Palette, gapStart, err = readPalette(r, base, dibHeader); err != nil {
+			return nil, err
+		}
+	}
+
+	// Whatever lies in between is kept so that EncodeOptions.KeepOffset can write it back. Array entries
+	// are written as plain files, so the headers of the other entries are not worth keeping.
+	if base == 0 && offset > gapStart {
+		img.Gap = make([]byte, offset-gapStart)
+		if _, err := r.Seek(gapStart, io.SeekStart); err != nil {
+			return nil, newError("error.seek_pixels", err)
+		}
+		if _, err := io.ReadFull(r, img.Gap); err != nil {
+			return nil, newError("error.seek_pixels", err)
+		}
+	} else if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil, newError("error.seek_pixels", err)
+	}
+	// Nothing is read past the end the size of the pixel data allows for
+	data := io.LimitReader(r, fileSize-offset)
+
+	// JPEG and PNG streams take the place of the pixel rows, as do run-length encoded indices
+	if embedded {
+		if err := decodeEmbedded(data, dibHeader, img, opts); err != nil {
+			return nil, err
+		}
+		return img, nil
+	}
+	if isRunLength(dibHeader) {
+		if err := decodeRunLength(data, dibHeader, img, opts); err != nil {
+			return nil, err
+		}
+		return img, nil
+	}
+
+	bitCount := int(dibHeader.BitCount)
+	bitFields := isBitFields(dibHeader)
+	rowSize := opts.rowSize(dibHeader)
+	row := make([]byte, rowSize)
+	pixels := make([]Pixel, width*height)
+	img.Pixels = pixels
+	if indexed {
+		img.Indices = make([]byte, width*height)
+	}
+	// 32-bit files keep a fourth byte per pixel for alpha. Writers that leave it unused fill it with
+	// zeros, which would make the image invisible, so such files are read as opaque.
+	var alpha []byte
+	hasAlpha := false
+	if bitCount == 32 {
+		alpha = make([]byte, width*height)
+	}
+
+	// Rows are kept bottom-up in memory, whichever order the file stores them in
+	for fileRow := 0; fileRow < height; fileRow++ {
+		if _, err := io.ReadFull(data, row); err != nil {
+			if opts.Mode != "permissive" {
+				return nil, newError("error.read_row", fileRow, err)
+			}
+			// Keep the rows that were read and leave the missing ones black
+			opts.warn(newError("format.truncated", height-fileRow))
+			break
+		}
+		y := fileRow
+		if topDown {
+			y = height - 1 - fileRow
+		}
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			if bitFields {
+				value := binary.LittleEndian.Uint32(row[x*4:])
+				pixels[i] = Pixel{
+					Blue:  maskChannel(value, dibHeader.BlueMask),
+					Green: maskChannel(value, dibHeader.GreenMask),
+					Red:   maskChannel(value, dibHeader.RedMask),
+				}
+				alpha[i] = maskChannel(value, dibHeader.AlphaMask)
+				hasAlpha = hasAlpha || alpha[i] != 0
+				continue
+			}
+			if bitCount == 32 {
+				pixels[i] = Pixel{Blue: row[x*4], Green: row[x*4+1], Red: row[x*4+2]}
+				alpha[i] = row[x*4+3]
+				hasAlpha = hasAlpha || alpha[i] != 0
+				continue
+			}
+			if !indexed {
+				pixels[i] = Pixel{Blue: row[x*3], Green: row[x*3+1], Red: row[x*3+2]}
+				continue
+			}
+			// Indices are packed most significant bits first
+			index := row[x*bitCount/8] >> (8 - bitCount - x*bitCount%8) & (1<<bitCount - 1)
+			img.Indices[i] = index
+			if int(index) < len(img.Palette) {
+				pixels[i] = img.Palette[index]
+			}
+		}
+	}
+	if alpha != nil && !hasAlpha {
+		for i := range alpha {
+			alpha[i] = 255
+		}
+	}
+	img.Alpha = alpha
+
+	return img, nil
+}
+
+// Size of the BMP header and the BITMAPINFOHEADER that the encoder writes
+const headersSize = 14 + infoHeaderSize
+
+// Returns the size in bytes of one pixel row, padded to a multiple of 4 bytes
+func rowStride(width int, bitCount int) int {
+	return (width*bitCount + 31) / 32 * 4
+}
@@ -0,0 +1,106 @@
+package bmp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// Compression values of BMP files whose pixel data is an embedded JPEG or PNG stream
+const (
+	compressionJPEG = 4
+	compressionPNG  = 5
+)
+
+// Formats of the streams EncodeOptions.Embed can store
+var EmbedFormats = []string{"png", "jpeg"}
+
+// Reports whether the header declares an embedded JPEG or PNG stream
+func isEmbedded(dibHeader *DIBHeader) bool {
+	return dibHeader.Compression == compressionJPEG || dibHeader.Compression == compressionPNG
+}
+
+// Decodes the embedded stream at the current position of r into img. The stream takes ImageSize
+// bytes, or the rest of the file when ImageSize is 0 or opts.Trust believes the data.
+func decodeEmbedded(r io.Reader, dibHeader *DIBHeader, img *Image, opts DecodeOptions) error {
+	format, decode, decodeConfig := "png", png.Decode, png.DecodeConfig
+	if dibHeader.Compression == compressionJPEG {
+		format, decode, decodeConfig = "jpeg", jpeg.Decode, jpeg.DecodeConfig
+	}
+
+	if dibHeader.ImageSize != 0 && opts.Trust != "data" {
+		r = io.LimitReader(r, int64(dibHeader.ImageSize))
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return newError("error.embedded", format, err)
+	}
+
+	// The limits were checked against the header, so the stream must not be any larger
+	config, err := decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return newError("error.embedded", format, err)
+	}
+	if config.Width != img.Width || config.Height != img.Height {
+		return newError("error.embedded_size", format, config.Width, config.Height, img.Width, img.Height)
+	}
+	src, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return newError("error.embedded", format, err)
+	}
+	img.Pixels = FromImage(src).Pixels
+	return nil
+}
+
+// Encodes the image as a PNG or JPEG stream for embedding in a BMP file
+func encodeEmbedded(img *Image, format string) ([]byte, uint32, error) {
+	var buf bytes.Buffer
+	compression := uint32(compressionPNG)
+	var err error
+	if format == "jpeg" {
+		compression = compressionJPEG
+		err = jpeg.Encode(&buf, img.ToRGBA(), nil)
+	} else {
+		err = png.Encode(&buf, img.ToRGBA())
+	}
+	if err != nil {
+		return nil, 0, newError("error.encode_embedded", format, err)
+	}
+	return buf.Bytes(), compression, nil
+}
+
+// Converts a standard library image into an Image with rows bottom-up
+func FromImage(src image.Image) *Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	img := &Image{Width: width, Height: height, Pixels: make([]Pixel, width*height)}
+	for y := 0; y < height; y++ {
+		row := img.Pixels[(height-1-y)*width:]
+		for x := 0; x < width; x++ {
+			r, g, b, _ := src.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			row[x] = Pixel{Blue: byte(b >> 8), Green: byte(g >> 8), Red: byte(r >> 8)}
+		}
+	}
+	return img
+}
+
+// Converts the image to a standard library RGBA image with rows top-down
+func (img *Image) ToRGBA() *image.RGBA {
+	rgba := image.NewRGBA(image.Rect(0, 0, img.Width, img.Height))
+	for y := 0; y < img.Height; y++ {
+		row := img.Pixels[(img.Height-1-y)*img.Width:]
+		for x := 0; x < img.Width; x++ {
+			p := row[x]
+			if img.Alpha == nil {
+				rgba.SetRGBA(x, y, color.RGBA{R: p.Red, G: p.Green, B: p.Blue, A: 255})
+				continue
+			}
+			// RGBA holds premultiplied colors, so the conversion from NRGBA takes care of the alpha
+			rgba.Set(x, y, color.NRGBA{R: p.Red, G: p.Green, B: p.Blue, A: img.Alpha[(img.Height-1-y)*img.Width+x]})
+		}
+	}
+	return rgba
+}
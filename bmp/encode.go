@@ -0,0 +1,195 @@
+package bmp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"slices"
+)
+
+// Writes a BMP file with the image's pixels to a stream: indexed when every pixel is in the image's color table
+// or, with opts.Compact, when the image has at most 256 colors, with an embedded stream when opts.Embed is set,
+// 32-bit when the image has alpha and 24-bit otherwise or when opts.TrueColor is set
+func EncodePixels(out io.Writer, bmpHeader *BMPHeader, dibHeader *DIBHeader, img *Image, opts EncodeOptions) error {
+	pixels := img.Pixels
+	width, height := int(dibHeader.Width), int(dibHeader.Height)
+	// A negative height marks a top-down source, whose order opts.KeepOrientation keeps
+	topDown := height < 0 && opts.KeepOrientation && opts.Embed == ""
+	height = max(height, -height)
+	if len(pixels) != width*height {
+		return newError("error.pixel_count", len(pixels), width, height)
+	}
+
+	var stream []byte
+	var compression uint32
+	if opts.Embed != "" {
+		var err error
+		if stream, compression, err = encodeEmbedded(img, opts.Embed); err != nil {
+			return err
+		}
+	}
+
+	var indices []byte
+	palette := img.Palette
+	bitCount := 24
+	if stream == nil && !opts.TrueColor {
+		indices = paletteIndices(img)
+		// Color tables have no alpha, so images with transparency are never compacted
+		if indices == nil && opts.Compact && img.Alpha == nil {
+			palette, indices = compactPalette(pixels)
+		}
+		switch {
+		case indices != nil:
+			bitCount = paletteBitCount(len(palette))
+		case img.Alpha != nil:
+			bitCount = 32
+		}
+	}
+
+	rowSize := rowStride(width, bitCount)
+	outBMP, outDIB := plainHeaders(bmpHeader, dibHeader, bitCount)
+	if topDown {
+		outDIB.Height = -outDIB.Height
+	}
+	if stream != nil {
+		// The embedded stream takes the place of the rows and carries its own pixel format
+		outDIB.BitCount, outDIB.Compression, outDIB.ImageSize = 0, compression, uint32(len(stream))
+	}
+	if indices != nil {
+		outDIB.ColorsUsed = uint32(len(palette))
+		outBMP.OffsetData += uint32(len(palette) * 4)
+	}
+
+	// Reproduce the source layout: the original header size and the bytes before the pixel data
+	var gap []byte
+	if opts.KeepOffset && len(img.Gap) > 0 {
+		gap = img.Gap
+		outBMP.OffsetData += uint32(len(gap))
+		// The color table sits between the header and the gap, so indexed output keeps the short header
+		if extra := dibHeader.DibHeaderSize - 40; dibHeader.DibHeaderSize > 40 && int(extra) <= len(gap) && indices == nil {
+			outDIB.DibHeaderSize = dibHeader.DibHeaderSize
+		}
+	}
+	outBMP.FileSize = outBMP.OffsetData + outDIB.ImageSize
+
+	// A color profile follows the pixel data and needs the fields of a V5 header: a BITMAPINFOHEADER grows
+	// into one, while a V5 header that the gap reproduces has them set in a copy of the gap
+	profile, headerSize := img.Profile, infoHeaderSize
+	switch {
+	case profile == nil:
+	case outDIB.DibHeaderSize == infoHeaderSize:
+		headerSize = v5HeaderSize
+		outBMP.OffsetData += v5HeaderSize - infoHeaderSize
+		outDIB.DibHeaderSize = v5HeaderSize
+		outDIB.RedMask, outDIB.GreenMask, outDIB.BlueMask, outDIB.AlphaMask = 0, 0, 0, 0
+		outDIB.Endpoints, outDIB.Gamma, outDIB.V5Reserved = [9]int32{}, [3]uint32{}, 0
+		if outDIB.Intent == 0 {
+			outDIB.Intent = intentImages
+		}
+		outDIB.ColorSpace = profileEmbedded
+		outDIB.ProfileData = outBMP.OffsetData - 14 + outDIB.ImageSize
+		outDIB.ProfileSize = uint32(len(profile))
+		outBMP.FileSize = outBMP.OffsetData + outDIB.ImageSize + outDIB.ProfileSize
+	case outDIB.DibHeaderSize >= v5HeaderSize && gapHoldsProfile(gap, profile):
+		// The source stored the profile before the pixel data, and the gap reproduces it with the header
+		profile = nil
+	case outDIB.DibHeaderSize >= v5HeaderSize:
+		// The gap starts with the header fields after the first 40 bytes
+		gap = slices.Clone(gap)
+		binary.LittleEndian.PutUint32(gap[56-infoHeaderSize:], profileEmbedded)
+		binary.LittleEndian.PutUint32(gap[112-infoHeaderSize:], outBMP.OffsetData-14+outDIB.ImageSize)
+		binary.LittleEndian.PutUint32(gap[116-infoHeaderSize:], uint32(len(profile)))
+		outBMP.FileSize += uint32(len(profile))
+	default:
+		// A V4 header kept by opts.KeepOffset has no room for a profile
+		profile = nil
+	}
+
+	w := bufio.NewWriter(out)
+	if err := binary.Write(w, binary.LittleEndian, &outBMP); err != nil {
+		return newError("error.write_bmp_header", err)
+	}
+	if err := writeDIBHeader(w, &outDIB, headerSize); err != nil {
+		return newError("error.write_dib_header", err)
+	}
+	if indices != nil {
+		if err := writePalette(w, palette); err != nil {
+			return err
+		}
+	}
+	if _, err := w.Write(gap); err != nil {
+		return newError("error.write_dib_header", err)
+	}
+	if stream != nil {
+		if _, err := w.Write(stream); err != nil {
+			return newError("error.write_pixels", err)
+		}
+		return writeProfile(w, profile)
+	}
+
+	row := make([]byte, rowSize)
+	for fileRow := 0; fileRow < height; fileRow++ {
+		y := fileRow
+		if topDown {
+			y = height - 1 - fileRow
+		}
+		if indices != nil {
+			packIndices(row, indices[y*width:(y+1)*width], bitCount)
+		} else if bitCount == 32 {
+			for x := 0; x < width; x++ {
+				p := pixels[y*width+x]
+				row[x*4], row[x*4+1], row[x*4+2], row[x*4+3] = p.Blue, p.Green, p.Red, img.Alpha[y*width+x]
+			}
+		} else {
+			for x := 0; x < width; x++ {
+				p := pixels[y*width+x]
+				row[x*3], row[x*3+1], row[x*3+2] = p.Blue, p.Green, p.Red
+			}
+		}
+		if _, err := w.Write(row); err != nil {
+			return newError("error.write_pixels", err)
+		}
+	}
+	return writeProfile(w, profile)
+}
+
+// Reports whether a gap that starts with the V5 header fields after the first 40 bytes holds the profile
+// where those fields place it
+func gapHoldsProfile(gap, profile []byte) bool {
+	start := int(binary.LittleEndian.Uint32(gap[112-infoHeaderSize:])) - infoHeaderSize
+	end := start + len(profile)
+	return binary.LittleEndian.Uint32(gap[116-infoHeaderSize:]) == uint32(len(profile)) &&
+		start >= v5HeaderSize-infoHeaderSize && end <= len(gap) && bytes.Equal(gap[start:end], profile)
+}
+
+// Writes the color profile, if any, after the pixel data and flushes the output
+func writeProfile(w *bufio.Writer, profile []byte) error {
+	if _, err := w.Write(profile); err != nil {
+		return newError("error.write_profile", err)
+	}
+	if err := w.Flush(); err != nil {
+		return newError("error.write_pixels", err)
+	}
+	return nil
+}
+
+// Returns the headers of an uncompressed bottom-up file without a color table for the size in dibHeader,
+// taking the remaining fields from the source headers
+func plainHeaders(bmpHeader *BMPHeader, dibHeader *DIBHeader, bitCount int) (BMPHeader, DIBHeader) {
+	outBMP := *bmpHeader
+	outDIB := *dibHeader
+	outDIB.Height = max(dibHeader.Height, -dibHeader.Height)
+	outBMP.FileType = [2]byte{'B', 'M'}
+	outBMP.Reserved = 0
+	outBMP.OffsetData = headersSize
+	outDIB.DibHeaderSize = 40
+	outDIB.Planes = 1
+	outDIB.BitCount = uint16(bitCount)
+	outDIB.Compression = 0
+	outDIB.ImageSize = uint32(rowStride(int(dibHeader.Width), bitCount) * int(outDIB.Height))
+	outDIB.ColorsUsed = 0
+	outDIB.ColorsImp = 0
+	outBMP.FileSize = outBMP.OffsetData + outDIB.ImageSize
+	return outBMP, outDIB
+}
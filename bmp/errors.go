@@ -0,0 +1,183 @@
+package bmp
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Error reported by the decoder and encoder. Key identifies the message, so that applications can
+// show it in other languages; Error formats the English text in Messages with Args.
+type Error struct {
+	Key  string
+	Args []any
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf(Messages[e.Key], e.Args...)
+}
+
+// Returns the underlying error, if any of the arguments is one
+func (e *Error) Unwrap() error {
+	for _, arg := range e.Args {
+		if err, ok := arg.(error); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reports whether the error is of the kind target, one of the Err values below, so that callers can
+// tell failures apart with errors.Is instead of comparing keys
+func (e *Error) Is(target error) bool {
+	return slices.Contains(errorKinds[e.Key], target)
+}
+
+// Kinds of errors the decoder and encoder report
+var (
+	// The data does not start like a BMP file
+	ErrNotBMP = errors.New("not a BMP file")
+	// The file is a BMP file, but damaged, truncated or inconsistent
+	ErrInvalidBMP = errors.New("invalid BMP file")
+	// The file is valid, but uses a feature the decoder does not read
+	ErrUnsupported = errors.New("unsupported BMP feature")
+	// Bit count other than 1, 4, 8, 24 and 32; also matches ErrUnsupported
+	ErrUnsupportedBitCount = errors.New("unsupported bit count")
+	// Compression the decoder does not read; also matches ErrUnsupported
+	ErrUnsupportedCompression = errors.New("unsupported compression")
+	// The image is larger than DecodeOptions allow
+	ErrLimit = errors.New("limit exceeded")
+	// A transform was given a value it does not accept
+	ErrInvalidArgument = errors.New("invalid argument")
+	// Writing the encoded image failed
+	ErrWrite = errors.New("write error")
+)
+
+// Kinds each error key belongs to
+var errorKinds = map[string][]error{
+	"error.not_bmp":          {ErrNotBMP},
+	"format.signature":       {ErrNotBMP},
+	"error.read_bmp_header":  {ErrInvalidBMP},
+	"error.read_dib_header":  {ErrInvalidBMP},
+	"error.rle_truncated":    {ErrInvalidBMP},
+	"error.rle_bounds":       {ErrInvalidBMP},
+	"error.dimensions":       {ErrInvalidBMP},
+	"error.seek_pixels":      {ErrInvalidBMP},
+	"error.offset_beyond":    {ErrInvalidBMP},
+	"error.pixel_data_size":  {ErrInvalidBMP},
+	"error.pixel_data_bound": {ErrInvalidBMP},
+	"error.read_row":         {ErrInvalidBMP},
+	"error.read_palette":     {ErrInvalidBMP},
+	"error.read_array":       {ErrInvalidBMP},
+	"error.array_entry":      {ErrInvalidBMP},
+	"error.array_loop":       {ErrInvalidBMP},
+	"error.embedded":         {ErrInvalidBMP},
+	"error.embedded_size":    {ErrInvalidBMP},
+	"format.reserved":        {ErrInvalidBMP},
+	"format.dib_size":        {ErrInvalidBMP},
+	"format.planes":          {ErrInvalidBMP},
+	"format.offset":          {ErrInvalidBMP},
+	"format.file_size":       {ErrInvalidBMP},
+	"format.image_size":      {ErrInvalidBMP},
+	"format.stream_size":     {ErrInvalidBMP},
+	"format.trust_headers":   {ErrInvalidBMP},
+	"format.trust_data":      {ErrInvalidBMP},
+	"format.palette":         {ErrInvalidBMP},
+	"format.truncated":       {ErrInvalidBMP},
+	"format.profile":         {ErrInvalidBMP},
+	"error.read_profile":     {ErrInvalidBMP},
+	"error.bit_count":        {ErrUnsupported, ErrUnsupportedBitCount},
+	"error.compression":      {ErrUnsupported, ErrUnsupportedCompression},
+	"error.read_rows":        {ErrUnsupported},
+	"error.limit_file_size":  {ErrLimit},
+	"error.limit_width":      {ErrLimit},
+	"error.limit_height":     {ErrLimit},
+	"error.limit_pixels":     {ErrLimit},
+	"error.image_index":      {ErrInvalidArgument},
+	"error.invalid_filter":   {ErrInvalidArgument},
+	"error.invalid_mirror":   {ErrInvalidArgument},
+	"error.invalid_angle":    {ErrInvalidArgument},
+	"error.blur":             {ErrInvalidArgument},
+	"error.convolve":         {ErrInvalidArgument},
+	"error.opacity":          {ErrInvalidArgument},
+	"error.blend_mode":       {ErrInvalidArgument},
+	"error.crop_area":        {ErrInvalidArgument},
+	"error.pixelate":         {ErrInvalidArgument},
+	"error.pixel_count":      {ErrInvalidArgument},
+	"error.tile_filter":      {ErrInvalidArgument},
+	"error.tile_memory":      {ErrLimit},
+	"error.tile_file":        {ErrWrite},
+	"error.write_palette":    {ErrWrite},
+	"error.write_bmp_header": {ErrWrite},
+	"error.write_dib_header": {ErrWrite},
+	"error.write_pixels":     {ErrWrite},
+	"error.encode_embedded":  {ErrWrite},
+	"error.write_profile":    {ErrWrite},
+}
+
+// Returns an error with the message for key formatted with args
+func newError(key string, args ...any) error {
+	return &Error{Key: key, Args: args}
+}
+
+// English messages of the errors and warnings, keyed by Error.Key
+var Messages = map[string]string{
+	"error.not_bmp":          "not a valid BMP file",
+	"error.read_bmp_header":  "error reading BMP header: %v",
+	"error.read_dib_header":  "error reading DIB header: %v",
+	"error.bit_count":        "unsupported bit count: %d (only 1, 4, 8, 24 and 32-bit BMP files are supported)",
+	"error.compression":      "unsupported compression: %d",
+	"error.rle_truncated":    "run-length encoded pixel data ends at row %d before the end-of-bitmap code",
+	"error.read_rows":        "cannot read %d-bit pixel data with compression %d row by row, only uncompressed 24 and 32-bit data stored bottom-up",
+	"error.rle_bounds":       "run-length encoded pixel data at byte %d runs past the %dx%d image",
+	"error.dimensions":       "unsupported dimensions: %dx%d",
+	"error.seek_pixels":      "error seeking to pixel data: %v",
+	"error.offset_beyond":    "pixel data offset %d is beyond the end of the %d byte file",
+	"error.pixel_data_size":  "pixel data needs %d bytes, but only %d follow the pixel data offset",
+	"error.pixel_data_bound": "the headers claim %d pixels, more than the %d that %d bytes of pixel data can make",
+	"error.read_row":         "error reading pixel row %d: %v",
+	"error.read_palette":     "error reading color table: %v",
+	"error.read_profile":     "error reading color profile: %v",
+	"error.write_palette":    "error writing color table: %v",
+	"error.write_profile":    "error writing color profile: %v",
+	"error.pixel_count":      "pixel count %d does not match dimensions %dx%d",
+	"error.write_bmp_header": "error writing BMP header: %v",
+	"error.write_dib_header": "error writing DIB header: %v",
+	"error.write_pixels":     "error writing pixel data: %v",
+	"error.limit_file_size":  "file size %d exceeds the limit of %d bytes",
+	"error.limit_width":      "image width %d exceeds the limit of %d",
+	"error.limit_height":     "image height %d exceeds the limit of %d",
+	"error.limit_pixels":     "image has %d pixels, more than the limit of %d",
+	"error.read_array":       "error reading bitmap array header at offset %d: %v",
+	"error.array_entry":      "bitmap array entry at offset %d has no BA header",
+	"error.array_loop":       "bitmap array entry at offset %d points back to offset %d",
+	"error.image_index":      "image index %d is out of range, the file has %d images",
+	"error.embedded":         "error decoding embedded %s image: %v",
+	"error.embedded_size":    "embedded %s image is %dx%d but the header declares %dx%d",
+	"error.encode_embedded":  "error encoding embedded %s image: %v",
+	"error.invalid_filter":   "invalid filter: %s",
+	"error.invalid_mirror":   "invalid mirror axis: %s",
+	"error.invalid_angle":    "invalid rotation angle: %v",
+	"error.blur":             "invalid blur: radius %d with kernel %s",
+	"error.convolve":         "invalid convolution: %d weights with edge mode %s",
+	"error.opacity":          "invalid opacity %v: expected a value from 0 to 1",
+	"error.blend_mode":       "unknown blend mode: %s",
+	"error.crop_area":        "crop area %dx%d at %d,%d is outside the %dx%d image",
+	"error.pixelate":         "invalid pixelation: area %dx%d at %d,%d with blocks of %d pixels in the %dx%d image",
+	"error.tile_filter":      "filter %s cannot run on tiles: only filters that change each pixel on its own can",
+	"error.tile_memory":      "tiles of %dx%d pixels need %d bytes of memory, more than the limit of %d",
+	"error.tile_file":        "error using temporary tile file: %v",
+	"format.signature":       "file starts with %q instead of BM",
+	"format.reserved":        "reserved header field is %d instead of 0",
+	"format.dib_size":        "unknown DIB header size %d",
+	"format.planes":          "header declares %d color planes instead of 1",
+	"format.offset":          "pixel data offset %d points into the headers",
+	"format.file_size":       "header records a file size of %d bytes, the file has %d",
+	"format.image_size":      "header records an image size of %d bytes, the pixel data needs %d",
+	"format.stream_size":     "header records an image size of %d bytes, %d follow the pixel data offset",
+	"format.trust_headers":   "%v; reading as the headers say",
+	"format.trust_data":      "%v; reading what the file holds",
+	"format.palette":         "header declares %d palette colors for an image without a palette",
+	"format.truncated":       "pixel data is truncated, %d rows are missing and left black",
+	"format.profile":         "color profile of %d bytes at offset %d runs past the end of the %d byte file and is left out",
+}
@@ -0,0 +1,45 @@
+package bmp
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Decodes arbitrary files in every parsing mode, with the whole-image decoder and the row reader. Seeds in
+// testdata/fuzz/FuzzDecode cover valid images of each kind the decoder reads and the malformed headers the
+// caps exist for: sizes no data backs, run-length data past the image and offsets past the file. Decoding
+// may fail, but must not panic or allocate more pixels than MaxDecodePixels.
+func FuzzDecode(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, mode := range []string{"", "strict", "permissive"} {
+			opts := DecodeOptions{Mode: mode}
+			bmpHeader, dibHeader, err := DecodeHeaders(bytes.NewReader(data), opts)
+			if err != nil {
+				continue
+			}
+			img, err := DecodePixels(bytes.NewReader(data), bmpHeader, dibHeader, opts)
+			if err == nil {
+				if pixels := int64(img.Width) * int64(img.Height); pixels > MaxDecodePixels || len(img.Pixels) > MaxDecodePixels {
+					t.Fatalf("mode %q: decoded %dx%d image, more than %d pixels", mode, img.Width, img.Height, MaxDecodePixels)
+				}
+			}
+
+			if !ReadsRows(dibHeader) {
+				continue
+			}
+			rows, err := NewRowReader(bytes.NewReader(data), bmpHeader, dibHeader, opts)
+			if err != nil {
+				continue
+			}
+			if rows.Width > MaxDecodePixels {
+				t.Fatalf("mode %q: row reader accepted width %d, more than %d pixels", mode, rows.Width, MaxDecodePixels)
+			}
+			pixels, alpha := make([]Pixel, rows.Width), make([]byte, rows.Width)
+			for y := 0; y < min(rows.Height, 64); y++ {
+				if rows.Read(pixels, alpha) != nil {
+					break
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package bmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"strconv"
+)
+
+// Sizes of BITMAPINFOHEADER, which the encoder writes, and of BITMAPV5HEADER, the longest version
+const (
+	infoHeaderSize = 40
+	v5HeaderSize   = 124
+)
+
+// Compression values of 16 and 32-bit files whose channels are given by bit masks
+const (
+	compressionBitFields      = 3
+	compressionAlphaBitFields = 6
+)
+
+// Reads a DIB header of any version. Only the size comes first in all of them, so it decides how many
+// bytes belong to the header; the masks of BI_BITFIELDS files with a 40-byte header are read as well.
+// OS/2 core headers are read as 40 bytes and left for expandCoreHeader.
+func readDIBHeader(r io.Reader) (DIBHeader, error) {
+	var dibHeader DIBHeader
+	buf := make([]byte, v5HeaderSize)
+	if _, err := io.ReadFull(r, buf[:infoHeaderSize]); err != nil {
+		return dibHeader, err
+	}
+	size := min(binary.LittleEndian.Uint32(buf), v5HeaderSize)
+	if size == infoHeaderSize {
+		switch binary.LittleEndian.Uint32(buf[16:]) {
+		case compressionBitFields:
+			size += 12
+		case compressionAlphaBitFields:
+			size += 16
+		}
+	}
+	if size > infoHeaderSize {
+		if _, err := io.ReadFull(r, buf[infoHeaderSize:size]); err != nil {
+			return dibHeader, err
+		}
+	}
+	// Fields beyond the header stay zero
+	err := binary.Read(bytes.NewReader(buf), binary.LittleEndian, &dibHeader)
+	return dibHeader, err
+}
+
+// Writes the first size bytes of a DIB header: the fields that BITMAPINFOHEADER has, or all of them
+func writeDIBHeader(w io.Writer, dibHeader *DIBHeader, size int) error {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, dibHeader); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes()[:size])
+	return err
+}
+
+// Reports whether the pixels are 32-bit values whose channels are given by the bit masks of the header
+func isBitFields(dibHeader *DIBHeader) bool {
+	return (dibHeader.Compression == compressionBitFields || dibHeader.Compression == compressionAlphaBitFields) &&
+		dibHeader.BitCount == 32
+}
+
+// Returns the channel of a pixel value that mask selects, scaled to 8 bits
+func maskChannel(value, mask uint32) byte {
+	if mask == 0 {
+		return 0
+	}
+	shift := bits.TrailingZeros32(mask)
+	top := uint64(mask >> shift)
+	return byte((uint64(value&mask>>shift)*255 + top/2) / top)
+}
+
+// Returns the color space of a V4 or V5 header as its four-character code, such as "sRGB", "Win ",
+// "LINK" or "MBED", or "calibrated" when the endpoints and gamma of the header define it
+func (h *DIBHeader) ColorSpaceName() string {
+	if h.ColorSpace == 0 {
+		return "calibrated"
+	}
+	var code [4]byte
+	binary.BigEndian.PutUint32(code[:], h.ColorSpace)
+	for _, c := range code {
+		if c < ' ' || c > '~' {
+			return "0x" + strconv.FormatUint(uint64(h.ColorSpace), 16)
+		}
+	}
+	return string(code[:])
+}
+
+// Returns the size in bytes of one row of uncompressed pixel data, padded to a multiple of 4 bytes
+func (h *DIBHeader) RowStride() int {
+	return rowStride(int(h.Width), int(h.BitCount))
+}
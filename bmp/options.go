@@ -0,0 +1,215 @@
+package bmp
+
+// Settings of the decoder. Limits are checked before pixel memory is allocated; zero means unlimited.
+type DecodeOptions struct {
+	MaxWidth    int
+	MaxHeight   int
+	MaxPixels   int64
+	MaxFileSize int64
+	Mode        string      // "strict" rejects any deviation from the format, "permissive" rescues damaged files with warnings
+	Index       int         // Image to decode from a bitmap array
+	Warn        func(error) `json:"-"` // Receives the problems permissive mode lets through; nil ignores them
+	// What to believe when the file and image sizes the headers record disagree with the file: "headers"
+	// or "data". "" believes the headers about compressed data and the file about the rest, without a word.
+	Trust string
+}
+
+// Passes a problem that does not stop decoding to the Warn function, if there is one
+func (o DecodeOptions) warn(problem error) {
+	if o.Warn != nil {
+		o.Warn(problem)
+	}
+}
+
+// Returns an error if the image described by the header, stored in fileSize bytes, exceeds a limit
+func (o DecodeOptions) check(dibHeader *DIBHeader, fileSize int64) error {
+	height := int64(dibHeader.Height)
+	if height < 0 {
+		height = -height
+	}
+	return o.CheckSize(int64(dibHeader.Width), height, fileSize)
+}
+
+// Returns an error if an image of the given size, stored in fileSize bytes, exceeds a limit. Readers of
+// other formats use it to apply the same limits before decoding pixels.
+func (o DecodeOptions) CheckSize(width, height, fileSize int64) error {
+	switch {
+	case o.MaxFileSize > 0 && fileSize > o.MaxFileSize:
+		return newError("error.limit_file_size", fileSize, o.MaxFileSize)
+	case o.MaxWidth > 0 && width > int64(o.MaxWidth):
+		return newError("error.limit_width", width, o.MaxWidth)
+	case o.MaxHeight > 0 && height > int64(o.MaxHeight):
+		return newError("error.limit_height", height, o.MaxHeight)
+	case o.MaxPixels > 0 && width*height > o.MaxPixels:
+		return newError("error.limit_pixels", width*height, o.MaxPixels)
+	}
+	return nil
+}
+
+// Most pixels the decoder allocates memory for, whatever the limits of opts. Headers can claim any size,
+// so without it a file of a few bytes could make the decoder ask for gigabytes.
+const MaxDecodePixels = 1 << 28
+
+const (
+	// Most pixels a byte of run-length encoded data makes, a run of 255 pixels taking 2 bytes. Short
+	// uncompressed data that permissive mode reads is held to it as well.
+	maxPixelsPerRunByte = 128
+	// Most pixels a byte of an embedded PNG or JPEG stream makes, above what deflate packs a flat image into
+	maxPixelsPerStreamByte = 1024
+	// Pixels allocated for any file, as images this small take little memory whatever their data holds
+	minBoundedPixels = 1 << 22
+)
+
+// Rejects headers that claim more pixel memory than the file can account for: more than MaxDecodePixels
+// pixels, or uncompressed rows that take more bytes than follow the pixel data offset. Decoders that hold
+// a single row pass rowOnly, so that only the width counts. Permissive mode lets short pixel data through,
+// as it reads the missing rows as black, and compressed data only shows its size when it is decoded, so
+// on both the pixels are held to what the bytes after the offset could make at most.
+func (o DecodeOptions) checkPixelData(dibHeader *DIBHeader, offset, fileSize int64, rowOnly bool) error {
+	width, height := int64(dibHeader.Width), int64(dibHeader.Height)
+	if height < 0 {
+		height = -height
+	}
+	pixels := width * height
+	if rowOnly {
+		pixels = width
+	}
+	if pixels > MaxDecodePixels {
+		return newError("error.limit_pixels", pixels, MaxDecodePixels)
+	}
+	available := max(fileSize-offset, 0)
+	if compressed := dibHeader.Compression != 0 && !isBitFields(dibHeader); o.Mode == "permissive" || compressed {
+		perByte := int64(maxPixelsPerRunByte)
+		if isEmbedded(dibHeader) {
+			perByte = maxPixelsPerStreamByte
+		}
+		if bound := max(available*perByte, minBoundedPixels); pixels > bound {
+			return newError("error.pixel_data_bound", pixels, bound, available)
+		}
+		return nil
+	}
+	if needed := int64(o.rowSize(dibHeader)) * height; needed > available {
+		return newError("error.pixel_data_size", needed, available)
+	}
+	return nil
+}
+
+// Checks header fields that depend on the file size: the recorded file and image sizes and
+// palette entries, which 24-bit files should not have. Permissive mode only warns about them. With
+// o.Trust set the sizes that disagree are reported along with the one believed, whatever the mode.
+func (o DecodeOptions) checkLayout(bmpHeader *BMPHeader, dibHeader *DIBHeader, fileSize, offset int64) error {
+	if o.Mode == "" && o.Trust == "" {
+		return nil
+	}
+
+	height := int64(dibHeader.Height)
+	if height < 0 {
+		height = -height
+	}
+	var sizes []error
+	if int64(bmpHeader.FileSize) != fileSize {
+		sizes = append(sizes, newError("format.file_size", bmpHeader.FileSize, fileSize))
+	}
+	compressed := dibHeader.Compression != 0 && !isBitFields(dibHeader)
+	if imageSize := int64(rowStride(int(dibHeader.Width), int(dibHeader.BitCount))) * height; !compressed && dibHeader.ImageSize != 0 && int64(dibHeader.ImageSize) != imageSize {
+		sizes = append(sizes, newError("format.image_size", dibHeader.ImageSize, imageSize))
+	}
+	// How much compressed data there is only shows when it is decoded, except when it runs past the end
+	if available := fileSize - offset; o.Trust != "" && compressed && int64(dibHeader.ImageSize) > available {
+		sizes = append(sizes, newError("format.stream_size", dibHeader.ImageSize, available))
+	}
+	if o.Mode != "strict" && o.Trust != "" {
+		for _, problem := range sizes {
+			o.warn(newError("format.trust_"+o.Trust, problem))
+		}
+		sizes = nil
+	}
+	if o.Mode == "" {
+		return nil
+	}
+	problems := sizes
+	if dibHeader.BitCount > 8 && dibHeader.ColorsUsed != 0 {
+		problems = append(problems, newError("format.palette", dibHeader.ColorsUsed))
+	}
+
+	for _, problem := range problems {
+		if o.Mode == "strict" {
+			return problem
+		}
+		o.warn(problem)
+	}
+	return nil
+}
+
+// Returns the size the pixel data of the image is read with. Trusting the headers, a file that records a
+// smaller size than it has ends there, leaving out whatever was appended to it; otherwise the file has
+// the size it has.
+func (o DecodeOptions) dataSize(bmpHeader *BMPHeader, fileSize int64) int64 {
+	if o.Trust == "headers" && bmpHeader.FileSize != 0 && int64(bmpHeader.FileSize) < fileSize {
+		return int64(bmpHeader.FileSize)
+	}
+	return fileSize
+}
+
+// Returns the bytes one row of uncompressed pixel data takes: padded to a multiple of 4, or, trusting the
+// headers, the size the image size records for each row when that holds every pixel of a row, as it does
+// for writers that leave rows unpadded
+func (o DecodeOptions) rowSize(dibHeader *DIBHeader) int {
+	stride := dibHeader.RowStride()
+	height := int64(dibHeader.Height)
+	if height < 0 {
+		height = -height
+	}
+	if o.Trust != "headers" || dibHeader.ImageSize == 0 || height == 0 || int64(dibHeader.ImageSize)%height != 0 {
+		return stride
+	}
+	if size := int64(dibHeader.ImageSize) / height; size >= (int64(dibHeader.Width)*int64(dibHeader.BitCount)+7)/8 && size <= int64(stride) {
+		return int(size)
+	}
+	return stride
+}
+
+// Header sizes of the known DIB header versions, including the OS/2 core and version 2 headers
+var dibHeaderSizes = []uint32{12, 40, 52, 56, 64, 108, 124}
+
+// Rejects header fields that the format fixes but lenient readers ignore
+func checkStrictHeaders(bmpHeader *BMPHeader, dibHeader *DIBHeader) error {
+	switch {
+	case bmpHeader.Reserved != 0:
+		return newError("format.reserved", bmpHeader.Reserved)
+	case !containsSize(dibHeaderSizes, dibHeader.DibHeaderSize):
+		return newError("format.dib_size", dibHeader.DibHeaderSize)
+	case dibHeader.Planes != 1:
+		return newError("format.planes", dibHeader.Planes)
+	case bmpHeader.OffsetData < 14+dibHeader.DibHeaderSize:
+		return newError("format.offset", bmpHeader.OffsetData)
+	}
+	return nil
+}
+
+// Reports whether a DIB header looks genuine enough to decode a file without the BM signature
+func plausibleDIBHeader(dibHeader *DIBHeader) bool {
+	return containsSize(dibHeaderSizes, dibHeader.DibHeaderSize) && dibHeader.Planes == 1 &&
+		dibHeader.Width > 0 && dibHeader.Height != 0
+}
+
+// Reports whether the list contains the size
+func containsSize(list []uint32, size uint32) bool {
+	for _, item := range list {
+		if item == size {
+			return true
+		}
+	}
+	return false
+}
+
+// Settings of the encoder
+type EncodeOptions struct {
+	KeepOffset bool   // Reproduce the source header size and pixel data offset, including the bytes in between
+	Embed      string // Store the pixels as an embedded "png" or "jpeg" stream instead of rows
+	Compact    bool   // Write images with at most 256 colors, such as grayscale ones, as indexed
+	TrueColor  bool   // Write 24-bit rows even for indexed and 32-bit images, dropping the color table and alpha
+	// Write rows top-down, as the source stored them, when the height in the headers is negative; rows are
+	// written bottom-up otherwise
+	KeepOrientation bool
+}
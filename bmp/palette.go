@@ -0,0 +1,141 @@
+package bmp
+
+import (
+	"io"
+	"sort"
+)
+
+// Reports whether the header describes an image of color table indices, uncompressed or run-length encoded
+func isIndexed(dibHeader *DIBHeader) bool {
+	switch dibHeader.BitCount {
+	case 1, 4, 8:
+		return dibHeader.Compression == 0 || isRunLength(dibHeader)
+	}
+	return false
+}
+
+// Reads the color table that follows the DIB header of the image whose BMP header is at base,
+// returning it with the position where it ends
+func readPalette(r io.ReadSeeker, base int64, dibHeader *DIBHeader) ([]Pixel, int64, error) {
+	count := 1 << dibHeader.BitCount
+	if used := int(dibHeader.ColorsUsed); used > 0 && used < count {
+		count = used
+	}
+	// OS/2 core headers store entries as 3 bytes instead of 4
+	entrySize := 4
+	if dibHeader.DibHeaderSize == 12 {
+		entrySize = 3
+	}
+
+	start := base + 14 + int64(dibHeader.DibHeaderSize)
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, 0, newError("error.read_palette", err)
+	}
+	table := make([]byte, count*entrySize)
+	if _, err := io.ReadFull(r, table); err != nil {
+		return nil, 0, newError("error.read_palette", err)
+	}
+
+	palette := make([]Pixel, count)
+	for i := range palette {
+		entry := table[i*entrySize:]
+		palette[i] = Pixel{Blue: entry[0], Green: entry[1], Red: entry[2]}
+	}
+	return palette, start + int64(len(table)), nil
+}
+
+// Writes a color table with 4-byte entries
+func writePalette(w io.Writer, palette []Pixel) error {
+	table := make([]byte, len(palette)*4)
+	for i, p := range palette {
+		table[i*4], table[i*4+1], table[i*4+2] = p.Blue, p.Green, p.Red
+	}
+	if _, err := w.Write(table); err != nil {
+		return newError("error.write_palette", err)
+	}
+	return nil
+}
+
+// Returns the color table index of every pixel, or nil if the image has no color table or uses a
+// color that is not in it
+func paletteIndices(img *Image) []byte {
+	if img.Palette == nil {
+		return nil
+	}
+	if len(img.Indices) == len(img.Pixels) {
+		return img.Indices
+	}
+
+	// Duplicate entries map to the first one
+	lookup := make(map[Pixel]byte, len(img.Palette))
+	for i := len(img.Palette) - 1; i >= 0; i-- {
+		lookup[img.Palette[i]] = byte(i)
+	}
+	indices := make([]byte, len(img.Pixels))
+	for i, p := range img.Pixels {
+		index, ok := lookup[p]
+		if !ok {
+			return nil
+		}
+		indices[i] = index
+	}
+	return indices
+}
+
+// Builds a color table of the colors used by the pixels, sorted by luminance so that grayscale images
+// get an ordinary gray ramp, and the indices into it. Returns nil when there are more than 256 colors.
+func compactPalette(pixels []Pixel) ([]Pixel, []byte) {
+	used := make(map[Pixel]bool)
+	for _, p := range pixels {
+		if !used[p] {
+			if len(used) == 256 {
+				return nil, nil
+			}
+			used[p] = true
+		}
+	}
+	palette := make([]Pixel, 0, len(used))
+	for p := range used {
+		palette = append(palette, p)
+	}
+	sort.Slice(palette, func(i, j int) bool {
+		if li, lj := palette[i].Luminance(), palette[j].Luminance(); li != lj {
+			return li < lj
+		}
+		return rgb(palette[i]) < rgb(palette[j])
+	})
+
+	lookup := make(map[Pixel]byte, len(palette))
+	for i, p := range palette {
+		lookup[p] = byte(i)
+	}
+	indices := make([]byte, len(pixels))
+	for i, p := range pixels {
+		indices[i] = lookup[p]
+	}
+	return palette, indices
+}
+
+// Returns the smallest indexed bit count that can address a color table of the given size
+func paletteBitCount(colors int) int {
+	switch {
+	case colors <= 2:
+		return 1
+	case colors <= 16:
+		return 4
+	}
+	return 8
+}
+
+// Packs the indices of one row into row, most significant bits first, leaving the padding zero
+func packIndices(row []byte, indices []byte, bitCount int) {
+	clear(row)
+	for x, index := range indices {
+		row[x*bitCount/8] |= index << (8 - bitCount - x*bitCount%8)
+	}
+}
+
+// Packs a color into 0xrrggbb
+func rgb(p Pixel) int {
+	return int(p.Red)<<16 | int(p.Green)<<8 | int(p.Blue)
+}
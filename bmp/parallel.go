@@ -0,0 +1,60 @@
+package bmp
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Number of goroutines that filters and rotations split their rows across; 0 uses GOMAXPROCS
+var Jobs int
+
+// Calls fn for bands of rows that together cover [0, rows), on up to Jobs goroutines at once. Bands start
+// at multiples of align, so that transforms working on blocks of rows never share a block. Progress is
+// reported on the calling goroutine as bands finish.
+func parallelRows(rows, align int, progress Progress, fn func(start, end int)) {
+	workers := Jobs
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	// Several bands per worker balance the load and keep progress moving
+	band := max((rows+workers*8-1)/(workers*8), 1)
+	band = (band + align - 1) / align * align
+
+	if workers == 1 || band >= rows {
+		for start := 0; start < rows; start += band {
+			end := min(start+band, rows)
+			fn(start, end)
+			progress.Report(end, rows)
+		}
+		return
+	}
+
+	starts := make(chan int)
+	finished := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, (rows+band-1)/band) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range starts {
+				end := min(start+band, rows)
+				fn(start, end)
+				finished <- end - start
+			}
+		}()
+	}
+	go func() {
+		for start := 0; start < rows; start += band {
+			starts <- start
+		}
+		close(starts)
+		wg.Wait()
+		close(finished)
+	}()
+
+	done := 0
+	for n := range finished {
+		done += n
+		progress.Report(done, rows)
+	}
+}
@@ -0,0 +1,252 @@
+package bmp
+
+import (
+	"strings"
+	"time"
+)
+
+// Optional hooks of a pipeline for progress UIs and telemetry, run on the goroutine that calls Run
+type StageHooks struct {
+	// Called before each stage with its name, its position and the number of stages
+	OnStageStart func(stage string, index, total int)
+	// Called as a stage completes output rows; done counts up to total
+	OnRowsProcessed func(stage string, done, total int)
+	// Called after each stage with its duration and the error that stopped the pipeline, if any
+	OnStageEnd func(stage string, index, total int, elapsed time.Duration, err error)
+	// Called with the image each successful stage produced; an error stops the pipeline
+	OnStageResult func(stage string, index int, img *Image) error
+}
+
+// Records transforms and applies them in order when Run is called. Runs of mirrors, rotations by multiples
+// of 90 degrees, crops and filters that change each pixel on its own are fused into a single pass: the
+// moves are composed into one mapping from result pixels to source pixels and the filters applied to the
+// pixels the mapping picks, so that a crop anywhere in the run leaves the cropped-away pixels unfiltered
+// and the whole run allocates one image. Other filters end a run and are applied on their own. Each pass
+// is a stage to the hooks, named after its transforms joined by +, and no run is fused when
+// OnStageResult is set, so that it gets the result of every transform.
+type Pipeline struct {
+	StageHooks
+	steps []pipelineStep
+}
+
+// One recorded transform: "mirror" with axis, "rotate" with angle, "crop" with the area or "filter" with
+// its name
+type pipelineStep struct {
+	kind       string
+	axis       string
+	angle      int
+	x, y, w, h int
+	filter     string
+}
+
+// Creates an empty pipeline
+func NewPipeline() *Pipeline {
+	return &Pipeline{}
+}
+
+// Records flipping the image left-to-right ("horizontal") or top-to-bottom ("vertical")
+func (p *Pipeline) Mirror(axis string) *Pipeline {
+	p.steps = append(p.steps, pipelineStep{kind: "mirror", axis: axis})
+	return p
+}
+
+// Records a clockwise rotation by a multiple of 90 degrees; negative angles rotate counterclockwise
+func (p *Pipeline) Rotate(angle int) *Pipeline {
+	p.steps = append(p.steps, pipelineStep{kind: "rotate", angle: angle})
+	return p
+}
+
+// Records cropping to the area at offset x, y from the top-left corner with the given size, measured on
+// the image as the transforms before it leave it
+func (p *Pipeline) Crop(x, y, width, height int) *Pipeline {
+	p.steps = append(p.steps, pipelineStep{kind: "crop", x: x, y: y, w: width, h: height})
+	return p
+}
+
+// Records applying one of Filters
+func (p *Pipeline) Filter(name string) *Pipeline {
+	p.steps = append(p.steps, pipelineStep{kind: "filter", filter: name})
+	return p
+}
+
+// Returns the number of recorded transforms
+func (p *Pipeline) Len() int {
+	return len(p.steps)
+}
+
+// Returns the size the recorded transforms turn an image of the given size into
+func (p *Pipeline) Size(width, height int) (int, int) {
+	for _, step := range p.steps {
+		switch step.kind {
+		case "rotate":
+			if step.angle%180 != 0 {
+				width, height = height, width
+			}
+		case "crop":
+			width, height = step.w, step.h
+		}
+	}
+	return width, height
+}
+
+// Maps a pixel of the result, in column u and row v from the top-left corner, to the source pixel at
+// x = ox + ux·u + vx·v and y = oy + uy·u + vy·v. Mirrors, quarter turns and crops all map this way, and so
+// do any number of them in a row.
+type pixelMapping struct {
+	ox, ux, vx int
+	oy, uy, vy int
+}
+
+// Returns the mapping that applies next after m, where next maps pixels of a later result to pixels of
+// the result of m
+func (m pixelMapping) then(next pixelMapping) pixelMapping {
+	return pixelMapping{
+		ox: m.ox + m.ux*next.ox + m.vx*next.oy,
+		ux: m.ux*next.ux + m.vx*next.uy,
+		vx: m.ux*next.vx + m.vx*next.vy,
+		oy: m.oy + m.uy*next.ox + m.vy*next.oy,
+		uy: m.uy*next.ux + m.vy*next.uy,
+		vy: m.uy*next.vx + m.vy*next.vy,
+	}
+}
+
+// Returns the mapping of a step that moves pixels of an image of the given size, with the size it leaves
+func stepMapping(step pipelineStep, width, height int) (pixelMapping, int, int, error) {
+	switch step.kind {
+	case "mirror":
+		switch step.axis {
+		case "horizontal":
+			return pixelMapping{ox: width - 1, ux: -1, vy: 1}, width, height, nil
+		case "vertical":
+			return pixelMapping{ux: 1, oy: height - 1, vy: -1}, width, height, nil
+		}
+		return pixelMapping{}, 0, 0, newError("error.invalid_mirror", step.axis)
+	case "rotate":
+		if step.angle%90 != 0 {
+			return pixelMapping{}, 0, 0, newError("error.invalid_angle", step.angle)
+		}
+		// The top-left corner of a clockwise quarter turn comes from the bottom-left corner of the source
+		switch (step.angle%360 + 360) % 360 {
+		case 90:
+			return pixelMapping{vx: 1, oy: height - 1, uy: -1}, height, width, nil
+		case 180:
+			return pixelMapping{ox: width - 1, ux: -1, oy: height - 1, vy: -1}, width, height, nil
+		case 270:
+			return pixelMapping{ox: width - 1, vx: -1, uy: 1}, height, width, nil
+		}
+		return pixelMapping{ux: 1, vy: 1}, width, height, nil
+	}
+	if step.x < 0 || step.y < 0 || step.w <= 0 || step.h <= 0 || step.x+step.w > width || step.y+step.h > height {
+		return pixelMapping{}, 0, 0, newError("error.crop_area", step.w, step.h, step.x, step.y, width, height)
+	}
+	return pixelMapping{ox: step.x, ux: 1, oy: step.y, vy: 1}, step.w, step.h, nil
+}
+
+// Reports whether a step can join a fused pass
+func fusable(step pipelineStep) bool {
+	_, perPixel := pixelFilters[step.filter]
+	return step.kind != "filter" || perPixel
+}
+
+// Applies the recorded transforms to the image. Progress covers the whole pipeline, one pass after another.
+func (p *Pipeline) Run(img *Image, progress Progress) (*Image, error) {
+	// Splits the steps into passes: runs of fusable steps, and the other filters one at a time
+	var passes [][]pipelineStep
+	for i, step := range p.steps {
+		if i > 0 && fusable(step) && fusable(p.steps[i-1]) && p.OnStageResult == nil {
+			passes[len(passes)-1] = append(passes[len(passes)-1], step)
+			continue
+		}
+		passes = append(passes, []pipelineStep{step})
+	}
+
+	for n, pass := range passes {
+		names := make([]string, len(pass))
+		for i, step := range pass {
+			names[i] = step.kind
+		}
+		stage := strings.Join(names, "+")
+		if p.OnStageStart != nil {
+			p.OnStageStart(stage, n, len(passes))
+		}
+		var passProgress Progress
+		if progress != nil || p.OnRowsProcessed != nil {
+			passProgress = func(done, total int) {
+				progress.Report(n*total+done, len(passes)*total)
+				if p.OnRowsProcessed != nil {
+					p.OnRowsProcessed(stage, done, total)
+				}
+			}
+		}
+
+		start := time.Now()
+		var result *Image
+		var err error
+		if fusable(pass[0]) {
+			result, err = img.fused(pass, passProgress)
+		} else {
+			result, err = img.Filter(pass[0].filter, passProgress)
+		}
+		if p.OnStageEnd != nil {
+			p.OnStageEnd(stage, n, len(passes), time.Since(start), err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		img = result
+		if p.OnStageResult != nil {
+			if err := p.OnStageResult(stage, n, img); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return img, nil
+}
+
+// Applies a run of fusable steps in one pass over the result
+func (img *Image) fused(steps []pipelineStep, progress Progress) (*Image, error) {
+	mapping := pixelMapping{ux: 1, vy: 1}
+	width, height := img.Width, img.Height
+	var filters []func(Pixel) Pixel
+	moved := false
+	for _, step := range steps {
+		if step.kind == "filter" {
+			filters = append(filters, pixelFilters[step.filter])
+			continue
+		}
+		next, w, h, err := stepMapping(step, width, height)
+		if err != nil {
+			return nil, err
+		}
+		mapping, width, height, moved = mapping.then(next), w, h, true
+	}
+
+	result := img.derive(width, height, make([]Pixel, width*height))
+	if img.Alpha != nil {
+		result.Alpha = make([]byte, width*height)
+	}
+	parallelRows(height, 1, progress, func(start, end int) {
+		for row := start; row < end; row++ {
+			// Rows are stored bottom-up, so stored row row holds row v counted from the top
+			v := height - 1 - row
+			for u := 0; u < width; u++ {
+				x := mapping.ox + mapping.ux*u + mapping.vx*v
+				y := mapping.oy + mapping.uy*u + mapping.vy*v
+				from := (img.Height-1-y)*img.Width + x
+				pixel := img.Pixels[from]
+				for _, f := range filters {
+					pixel = f(pixel)
+				}
+				result.Pixels[row*width+u] = pixel
+				if result.Alpha != nil {
+					result.Alpha[row*width+u] = img.Alpha[from]
+				}
+			}
+		}
+	})
+	// Hints describe where things are, so only a pass that leaves every pixel in place keeps them
+	if !moved {
+		result.Hints = img.Hints
+	}
+	return result, nil
+}
@@ -0,0 +1,47 @@
+package bmp
+
+// Side in pixels of the blocks of the pixelate filter
+const PixelateSize = 20
+
+// Paints size×size blocks of the area at x,y of w×h pixels, counted from the top-left corner, with their
+// average color, in place. Blocks are laid from the top-left corner of the area, so those along its right
+// and bottom edges may be smaller. Rows of blocks are averaged concurrently, as no block spans two of them.
+func pixelateArea(pixels []Pixel, width, height, x, y, w, h, size int, progress Progress) {
+	parallelRows((h+size-1)/size, 1, progress, func(start, end int) {
+		for row := start; row < end; row++ {
+			top, bottom := y+row*size, min(y+(row+1)*size, y+h)
+			for left := x; left < x+w; left += size {
+				right := min(left+size, x+w)
+				var sumR, sumG, sumB, count int
+				for by := top; by < bottom; by++ {
+					for _, p := range pixels[(height-1-by)*width+left : (height-1-by)*width+right] {
+						sumR, sumG, sumB = sumR+int(p.Red), sumG+int(p.Green), sumB+int(p.Blue)
+						count++
+					}
+				}
+				// Averages are rounded to the nearest level, as the reference output of the filter is
+				avg := Pixel{Blue: byte((sumB + count/2) / count), Green: byte((sumG + count/2) / count), Red: byte((sumR + count/2) / count)}
+				for by := top; by < bottom; by++ {
+					for i := (height-1-by)*width + left; i < (height-1-by)*width+right; i++ {
+						pixels[i] = avg
+					}
+				}
+			}
+		}
+	})
+}
+
+// Returns the image with the area at x,y of w×h pixels, counted from the top-left corner, painted in
+// size×size blocks of their average color, leaving the rest sharp. Pixels stay in place, so alpha and
+// hints are kept.
+func (img *Image) Pixelate(x, y, w, h, size int, progress Progress) (*Image, error) {
+	if size < 1 || w < 1 || h < 1 || x < 0 || y < 0 || x+w > img.Width || y+h > img.Height {
+		return nil, newError("error.pixelate", w, h, x, y, size, img.Width, img.Height)
+	}
+	pixels := make([]Pixel, len(img.Pixels))
+	copy(pixels, img.Pixels)
+	pixelateArea(pixels, img.Width, img.Height, x, y, w, h, size, progress)
+	result := img.derive(img.Width, img.Height, pixels)
+	result.Alpha, result.Hints = img.Alpha, img.Hints
+	return result, nil
+}
@@ -0,0 +1,51 @@
+package bmp
+
+import (
+	"os"
+	"testing"
+)
+
+// Decodes a BMP file of the repository's assets
+func decodeAsset(t *testing.T, name string) *Image {
+	t.Helper()
+	file, err := os.Open("../assets/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	img, err := Decode(file)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return img
+}
+
+// The pixelate filter paints the sample as the reference asset does, with block averages rounded to the
+// nearest level
+func TestPixelateReference(t *testing.T) {
+	sample, want := decodeAsset(t, "sample.bmp"), decodeAsset(t, "sample-filtered-pixelate.bmp")
+	if sample.Width != want.Width || sample.Height != want.Height {
+		t.Fatalf("sample is %dx%d, reference %dx%d", sample.Width, sample.Height, want.Width, want.Height)
+	}
+	got := FilterPixels(sample.Pixels, sample.Width, sample.Height, "pixelate", nil)
+	differ := 0
+	for i := range got {
+		if got[i] != want.Pixels[i] {
+			differ++
+		}
+	}
+	if differ > 0 {
+		t.Errorf("%d of %d pixels differ from the reference", differ, len(got))
+	}
+
+	// The same blocks over the whole image through Pixelate
+	result, err := sample.Pixelate(0, 0, sample.Width, sample.Height, PixelateSize, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range result.Pixels {
+		if result.Pixels[i] != want.Pixels[i] {
+			t.Fatalf("Pixelate differs from the reference first at pixel %d: %v, want %v", i, result.Pixels[i], want.Pixels[i])
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package bmp
+
+import (
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Color space of a V5 header whose ICC profile is stored in the file, "MBED" as a four-character code
+const profileEmbedded = 0x4d424544
+
+// Rendering intent written along with a profile when the source header has none: LCS_GM_IMAGES, the
+// perceptual intent that suits photographs
+const intentImages = 4
+
+// Reads the ICC profile that the V5 header of the image selected by opts.Index embeds, or returns nil when
+// it embeds none. A profile that reaches past the end of the file is left out with a warning, since the
+// pixels do not depend on it.
+func DecodeProfile(r io.ReadSeeker, dibHeader *DIBHeader, opts DecodeOptions) ([]byte, error) {
+	if dibHeader.DibHeaderSize < v5HeaderSize || dibHeader.ColorSpace != profileEmbedded || dibHeader.ProfileSize == 0 {
+		return nil, nil
+	}
+	base, err := seekImage(r, opts.Index)
+	if err != nil {
+		return nil, err
+	}
+	fileSize, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, newError("error.read_profile", err)
+	}
+	// The offset counts from the start of the DIB header
+	start := base + 14 + int64(dibHeader.ProfileData)
+	if start+int64(dibHeader.ProfileSize) > fileSize {
+		opts.warn(newError("format.profile", dibHeader.ProfileSize, start, fileSize))
+		return nil, nil
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, newError("error.read_profile", err)
+	}
+	profile := make([]byte, dibHeader.ProfileSize)
+	if _, err := io.ReadFull(r, profile); err != nil {
+		return nil, newError("error.read_profile", err)
+	}
+	return profile, nil
+}
+
+// What the header of an ICC profile and its description tag say about it
+type ProfileInfo struct {
+	Size        int    // Bytes of the profile
+	Version     string // Version of the ICC specification it follows, such as "4.3"
+	Class       string // Device class, such as "mntr" for displays
+	ColorSpace  string // Color space of the pixels it describes, such as "RGB"
+	Description string // Name of the profile, such as "sRGB IEC61966-2.1", or "" when it has none
+}
+
+// Reads the header and description of an ICC profile. A profile shorter than the 128-byte header only
+// gives its size, and a damaged description is left empty.
+func ParseProfile(profile []byte) ProfileInfo {
+	info := ProfileInfo{Size: len(profile)}
+	if len(profile) < 128 {
+		return info
+	}
+	// The major version takes a byte, the minor and bug-fix versions a nibble each
+	info.Version = strconv.Itoa(int(profile[8])) + "." + strconv.Itoa(int(profile[9]>>4))
+	info.Class = strings.TrimSpace(string(profile[12:16]))
+	info.ColorSpace = strings.TrimSpace(string(profile[16:20]))
+	info.Description = profileDescription(profile)
+	return info
+}
+
+// Returns the text of the "desc" tag of a profile, stored as ASCII in version 2 profiles and as UTF-16
+// in the first record of a multi-localized Unicode tag in version 4 ones
+func profileDescription(profile []byte) string {
+	if len(profile) < 132 {
+		return ""
+	}
+	count := int(binary.BigEndian.Uint32(profile[128:]))
+	for i := 0; i < count && 132+12*(i+1) <= len(profile); i++ {
+		entry := profile[132+12*i:]
+		if string(entry[:4]) != "desc" {
+			continue
+		}
+		offset, size := int(binary.BigEndian.Uint32(entry[4:])), int(binary.BigEndian.Uint32(entry[8:]))
+		if offset < 0 || size < 16 || offset+size > len(profile) || offset+size < offset {
+			return ""
+		}
+		tag := profile[offset : offset+size]
+		switch string(tag[:4]) {
+		case "desc":
+			length := int(binary.BigEndian.Uint32(tag[8:]))
+			if length < 0 || 12+length > len(tag) {
+				return ""
+			}
+			return strings.TrimRight(string(tag[12:12+length]), "\x00")
+		case "mluc":
+			if binary.BigEndian.Uint32(tag[8:]) == 0 || len(tag) < 28 {
+				return ""
+			}
+			length, start := int(binary.BigEndian.Uint32(tag[20:])), int(binary.BigEndian.Uint32(tag[24:]))
+			if length < 0 || start < 0 || start+length > len(tag) || start+length < start {
+				return ""
+			}
+			units := make([]uint16, length/2)
+			for k := range units {
+				units[k] = binary.BigEndian.Uint16(tag[start+2*k:])
+			}
+			return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+		}
+		return ""
+	}
+	return ""
+}
@@ -0,0 +1,122 @@
+package bmp
+
+import "io"
+
+// Compression values of indexed BMP files whose pixel data is run-length encoded
+const (
+	compressionRLE8 = 1
+	compressionRLE4 = 2
+)
+
+// Reports whether the header declares RLE8 pixel data for an 8-bit image or RLE4 for a 4-bit one
+func isRunLength(dibHeader *DIBHeader) bool {
+	return dibHeader.Compression == compressionRLE8 && dibHeader.BitCount == 8 ||
+		dibHeader.Compression == compressionRLE4 && dibHeader.BitCount == 4
+}
+
+// Decodes the run-length encoded pixel data at the current position of r into the indices and pixels
+// of img, whose color table has been read. The data takes ImageSize bytes, or the rest of the file when
+// ImageSize is 0 or opts.Trust believes the data. Pixels skipped by end-of-line and delta codes get the first color of the table.
+func decodeRunLength(r io.Reader, dibHeader *DIBHeader, img *Image, opts DecodeOptions) error {
+	if dibHeader.ImageSize != 0 && opts.Trust != "data" {
+		r = io.LimitReader(r, int64(dibHeader.ImageSize))
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return newError("error.read_row", 0, err)
+	}
+
+	width, height := img.Width, img.Height
+	rle4 := dibHeader.Compression == compressionRLE4
+	img.Indices = make([]byte, width*height)
+	// Rows are encoded bottom-up, the order they are kept in memory
+	x, y := 0, 0
+	set := func(index byte, at int) error {
+		if x >= width || y >= height {
+			return newError("error.rle_bounds", at, width, height)
+		}
+		img.Indices[y*width+x] = index
+		x++
+		return nil
+	}
+
+	i := 0
+	for done := false; !done; {
+		if i+2 > len(data) {
+			if err := truncatedRunLength(y, height, opts); err != nil {
+				return err
+			}
+			break
+		}
+		count, value := int(data[i]), data[i+1]
+		i += 2
+
+		switch {
+		case count > 0:
+			// Encoded run: count pixels of one index, or of two alternating indices for RLE4
+			for k := 0; k < count; k++ {
+				index := value
+				if rle4 {
+					index = value >> (4 * (1 - k%2)) & 0x0f
+				}
+				if err := set(index, i-2); err != nil {
+					return err
+				}
+			}
+		case value == 0:
+			x, y = 0, y+1
+		case value == 1:
+			done = true
+		case value == 2:
+			if i+2 > len(data) {
+				if err := truncatedRunLength(y, height, opts); err != nil {
+					return err
+				}
+				done = true
+				break
+			}
+			x, y = x+int(data[i]), y+int(data[i+1])
+			i += 2
+		default:
+			// Absolute run: value indices follow literally, padded to a 16-bit boundary
+			size := int(value)
+			if rle4 {
+				size = (size + 1) / 2
+			}
+			if i+size > len(data) {
+				if err := truncatedRunLength(y, height, opts); err != nil {
+					return err
+				}
+				done = true
+				break
+			}
+			for k := 0; k < int(value); k++ {
+				index := data[i+k]
+				if rle4 {
+					index = data[i+k/2] >> (4 * (1 - k%2)) & 0x0f
+				}
+				if err := set(index, i); err != nil {
+					return err
+				}
+			}
+			i += size + size%2
+		}
+	}
+
+	img.Pixels = make([]Pixel, width*height)
+	for i, index := range img.Indices {
+		if int(index) < len(img.Palette) {
+			img.Pixels[i] = img.Palette[index]
+		}
+	}
+	return nil
+}
+
+// Reports pixel data that ends before the end-of-bitmap code, which permissive mode only warns about
+func truncatedRunLength(row, height int, opts DecodeOptions) error {
+	if opts.Mode != "permissive" {
+		return newError("error.rle_truncated", row)
+	}
+	opts.warn(newError("format.truncated", max(height-row, 0)))
+	return nil
+}
@@ -0,0 +1,47 @@
+package bmp
+
+import "math"
+
+// Returns the image rotated clockwise by any angle in degrees on a canvas enlarged to hold all of it. Every
+// result pixel is sampled bilinearly from where it comes from in the source, with alpha premultiplied so
+// that transparent pixels do not bleed their color. The corners the rotation uncovers take the background
+// color, or are transparent when background is nil, which gives the result alpha.
+func (img *Image) RotateAngle(degrees float64, background *Pixel, progress Progress) *Image {
+	theta := degrees * math.Pi / 180
+	cos, sin := math.Cos(theta), math.Sin(theta)
+	// The tolerance keeps sides that are whole numbers in exact arithmetic from growing by a pixel
+	width := max(int(math.Ceil(math.Abs(float64(img.Width)*cos)+math.Abs(float64(img.Height)*sin)-1e-6)), 1)
+	height := max(int(math.Ceil(math.Abs(float64(img.Width)*sin)+math.Abs(float64(img.Height)*cos)-1e-6)), 1)
+
+	result := img.derive(width, height, make([]Pixel, width*height))
+	if img.Alpha != nil || background == nil {
+		result.Alpha = make([]byte, width*height)
+	}
+	// Premultiplied red, green, blue and alpha of the background
+	var fill [4]float64
+	if background != nil {
+		fill = [4]float64{float64(background.Red), float64(background.Green), float64(background.Blue), 255}
+	}
+	// Premultiplied color of the source pixel in column x and row y counted from the top, or the
+	// background outside the source
+	sample := func(x, y int) [4]float64 {
+		if x < 0 || y < 0 || x >= img.Width || y >= img.Height {
+			return fill
+		}
+		return img.premultiplied(x, y)
+	}
+
+	parallelRows(height, 1, progress, func(start, end int) {
+		for row := start; row < end; row++ {
+			// Pixel centers relative to the center of the result, rows counted from the top
+			dy := float64(height-1-row) + 0.5 - float64(height)/2
+			for col := 0; col < width; col++ {
+				dx := float64(col) + 0.5 - float64(width)/2
+				sx := dx*cos + dy*sin + float64(img.Width)/2
+				sy := -dx*sin + dy*cos + float64(img.Height)/2
+				result.setPremultiplied(row*width+col, bilinear(sx, sy, sample))
+			}
+		}
+	})
+	return result
+}
@@ -0,0 +1,220 @@
+package bmp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// Reports whether RowReader can read the image: uncompressed 24 or 32-bit pixel data stored bottom-up
+func ReadsRows(dibHeader *DIBHeader) bool {
+	return (dibHeader.BitCount == 24 || dibHeader.BitCount == 32) && dibHeader.Compression == 0 && dibHeader.Height > 0
+}
+
+// Reads the pixel rows of an image one at a time, in file order (bottom-up), so that images larger than
+// memory can be processed. Only the files ReadsRows accepts can be read this way.
+type RowReader struct {
+	Width  int
+	Height int
+	Alpha  bool // Set for 32-bit files, whose rows carry alpha
+
+	r         io.Reader
+	opts      DecodeOptions
+	row       []byte
+	y         int
+	opaque    bool // Every alpha byte of the file is zero, so alpha is read as 255
+	truncated bool
+}
+
+// Checks the headers of the image selected by opts.Index against the limits of opts and positions the
+// stream at its first row. 32-bit files are read through once to find out whether they use alpha.
+func NewRowReader(r io.ReadSeeker, bmpHeader *BMPHeader, dibHeader *DIBHeader, opts DecodeOptions) (*RowReader, error) {
+	if !ReadsRows(dibHeader) {
+		return nil, newError("error.read_rows", dibHeader.BitCount, dibHeader.Compression)
+	}
+	if dibHeader.Width <= 0 || dibHeader.Height <= 0 {
+		return nil, newError("error.dimensions", dibHeader.Width, dibHeader.Height)
+	}
+
+	fileSize, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, newError("error.seek_pixels", err)
+	}
+	if err := opts.check(dibHeader, fileSize); err != nil {
+		return nil, err
+	}
+	base, err := seekImage(r, opts.Index)
+	if err != nil {
+		return nil, err
+	}
+	layoutSize := fileSize
+	if base > 0 {
+		layoutSize = int64(bmpHeader.FileSize)
+	}
+	offset := int64(bmpHeader.OffsetData)
+	if err := opts.checkLayout(bmpHeader, dibHeader, layoutSize, offset); err != nil {
+		return nil, err
+	}
+	if base == 0 {
+		fileSize = opts.dataSize(bmpHeader, fileSize)
+	}
+	if offset > fileSize {
+		return nil, newError("error.offset_beyond", offset, fileSize)
+	}
+	if err := opts.checkPixelData(dibHeader, offset, fileSize, true); err != nil {
+		return nil, err
+	}
+
+	rows := &RowReader{
+		Width:  int(dibHeader.Width),
+		Height: int(dibHeader.Height),
+		Alpha:  dibHeader.BitCount == 32,
+		r:      bufio.NewReader(io.LimitReader(r, fileSize-offset)),
+		opts:   opts,
+		row:    make([]byte, opts.rowSize(dibHeader)),
+	}
+	if rows.Alpha {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, newError("error.seek_pixels", err)
+		}
+		rows.opaque = !usesAlpha(bufio.NewReader(io.LimitReader(r, fileSize-offset)), rows.row, rows.Width, rows.Height)
+	}
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil, newError("error.seek_pixels", err)
+	}
+	return rows, nil
+}
+
+// Reports whether any alpha byte of the 32-bit rows that can be read is not zero
+func usesAlpha(r io.Reader, row []byte, width, height int) bool {
+	for y := 0; y < height; y++ {
+		if _, err := io.ReadFull(r, row); err != nil {
+			return false
+		}
+		for x := 0; x < width; x++ {
+			if row[x*4+3] != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Reads the next row into pixels and, when it is not nil, alpha. Both hold Width entries. In permissive
+// mode the rows missing from a truncated file are read as black.
+func (rows *RowReader) Read(pixels []Pixel, alpha []byte) error {
+	y := rows.y
+	rows.y++
+	if !rows.truncated {
+		_, err := io.ReadFull(rows.r, rows.row)
+		if err != nil && rows.opts.Mode != "permissive" {
+			return newError("error.read_row", y, err)
+		}
+		if err != nil {
+			rows.opts.warn(newError("format.truncated", rows.Height-y))
+			rows.truncated = true
+		}
+	}
+	if rows.truncated {
+		clear(pixels)
+		for x := range alpha {
+			alpha[x] = 0
+			if rows.opaque {
+				alpha[x] = 255
+			}
+		}
+		return nil
+	}
+
+	for x := range pixels {
+		if !rows.Alpha {
+			pixels[x] = Pixel{Blue: rows.row[x*3], Green: rows.row[x*3+1], Red: rows.row[x*3+2]}
+			continue
+		}
+		pixels[x] = Pixel{Blue: rows.row[x*4], Green: rows.row[x*4+1], Red: rows.row[x*4+2]}
+		if alpha != nil {
+			alpha[x] = rows.row[x*4+3]
+			if rows.opaque {
+				alpha[x] = 255
+			}
+		}
+	}
+	return nil
+}
+
+// Skips the next n rows without decoding them, as a resumed run does with the rows it already wrote
+func (rows *RowReader) Skip(n int) error {
+	for ; n > 0; n-- {
+		y := rows.y
+		rows.y++
+		if rows.truncated {
+			continue
+		}
+		if _, err := io.ReadFull(rows.r, rows.row); err != nil {
+			if rows.opts.Mode != "permissive" {
+				return newError("error.read_row", y, err)
+			}
+			rows.opts.warn(newError("format.truncated", rows.Height-y))
+			rows.truncated = true
+		}
+	}
+	return nil
+}
+
+// Writes a BMP file one pixel row at a time, in file order (bottom-up)
+type RowWriter struct {
+	w     *bufio.Writer
+	alpha bool
+	row   []byte
+}
+
+// Writes the headers for an image of the size in dibHeader, taking the remaining header fields from the
+// source headers. Rows are 32-bit when alpha is set and 24-bit otherwise.
+func NewRowWriter(w io.Writer, bmpHeader *BMPHeader, dibHeader *DIBHeader, alpha bool) (*RowWriter, error) {
+	bitCount := 24
+	if alpha {
+		bitCount = 32
+	}
+	outBMP, outDIB := plainHeaders(bmpHeader, dibHeader, bitCount)
+	rows := &RowWriter{w: bufio.NewWriter(w), alpha: alpha, row: make([]byte, rowStride(int(dibHeader.Width), bitCount))}
+	if err := binary.Write(rows.w, binary.LittleEndian, &outBMP); err != nil {
+		return nil, newError("error.write_bmp_header", err)
+	}
+	if err := writeDIBHeader(rows.w, &outDIB, infoHeaderSize); err != nil {
+		return nil, newError("error.write_dib_header", err)
+	}
+	return rows, nil
+}
+
+// Continues a BMP file whose headers and first rows were written by an earlier RowWriter, writing the
+// remaining rows of the given width to w
+func ResumeRowWriter(w io.Writer, width int, alpha bool) *RowWriter {
+	bitCount := 24
+	if alpha {
+		bitCount = 32
+	}
+	return &RowWriter{w: bufio.NewWriter(w), alpha: alpha, row: make([]byte, rowStride(width, bitCount))}
+}
+
+// Writes the next row. alpha is only used when the writer was created with alpha.
+func (rows *RowWriter) Write(pixels []Pixel, alpha []byte) error {
+	for x, p := range pixels {
+		if rows.alpha {
+			rows.row[x*4], rows.row[x*4+1], rows.row[x*4+2], rows.row[x*4+3] = p.Blue, p.Green, p.Red, alpha[x]
+		} else {
+			rows.row[x*3], rows.row[x*3+1], rows.row[x*3+2] = p.Blue, p.Green, p.Red
+		}
+	}
+	if _, err := rows.w.Write(rows.row); err != nil {
+		return newError("error.write_pixels", err)
+	}
+	return nil
+}
+
+// Writes any buffered rows to the underlying writer
+func (rows *RowWriter) Flush() error {
+	if err := rows.w.Flush(); err != nil {
+		return newError("error.write_pixels", err)
+	}
+	return nil
+}
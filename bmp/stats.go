@@ -0,0 +1,80 @@
+package bmp
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Statistics of one channel of an image
+type ChannelStats struct {
+	Histogram [256]int // Number of pixels at each level
+	Mean      float64
+	StdDev    float64 // Population standard deviation of the levels
+	Min       byte
+	Max       byte
+}
+
+// Statistics of an image, as gathered by Stats
+type ImageStats struct {
+	Red   ChannelStats
+	Green ChannelStats
+	Blue  ChannelStats
+	// Statistics of the alpha channel, or nil when the image is opaque
+	Alpha *ChannelStats
+	// Number of distinct colors, leaving alpha out
+	UniqueColors int
+}
+
+// Scans the image once for the histogram, mean, standard deviation and range of every channel and the
+// number of distinct colors
+func Stats(img *Image) *ImageStats {
+	var stats ImageStats
+	// One bit per 24-bit color keeps counting fast for photos with millions of colors
+	seen := make([]uint64, 1<<24/64)
+	for _, p := range img.Pixels {
+		stats.Red.Histogram[p.Red]++
+		stats.Green.Histogram[p.Green]++
+		stats.Blue.Histogram[p.Blue]++
+		color := int(p.Red)<<16 | int(p.Green)<<8 | int(p.Blue)
+		seen[color/64] |= 1 << (color % 64)
+	}
+	for _, word := range seen {
+		stats.UniqueColors += bits.OnesCount64(word)
+	}
+	stats.Red.summarize()
+	stats.Green.summarize()
+	stats.Blue.summarize()
+
+	if img.Alpha != nil {
+		stats.Alpha = &ChannelStats{}
+		for _, a := range img.Alpha {
+			stats.Alpha.Histogram[a]++
+		}
+		stats.Alpha.summarize()
+	}
+	return &stats
+}
+
+// Derives the mean, standard deviation and range of a channel from its histogram
+func (c *ChannelStats) summarize() {
+	var n, sum, sumSquares float64
+	first := true
+	for level, count := range c.Histogram {
+		if count == 0 {
+			continue
+		}
+		if first {
+			c.Min, first = byte(level), false
+		}
+		c.Max = byte(level)
+		v := float64(level)
+		n += float64(count)
+		sum += float64(count) * v
+		sumSquares += float64(count) * v * v
+	}
+	if n == 0 {
+		return
+	}
+	c.Mean = sum / n
+	c.StdDev = math.Sqrt(max(0, sumSquares/n-c.Mean*c.Mean))
+}
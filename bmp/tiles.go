@@ -0,0 +1,268 @@
+package bmp
+
+import (
+	"io"
+	"os"
+)
+
+// Side of the tiles RunTiles uses when TileOptions leaves it unset
+const DefaultTileSize = 512
+
+// Tiles RunTiles keeps in memory when TileOptions sets no limit
+const defaultTileCache = 16
+
+// Settings of RunTiles
+type TileOptions struct {
+	TileSize  int    // Side of the square tiles in pixels, DefaultTileSize when 0
+	MaxMemory int64  // Bytes the tiles and rows held in memory may take; 0 keeps 16 tiles
+	TempDir   string // Directory of the temporary tile files, the system one when empty
+}
+
+// Applies the recorded transforms to the rows of a reader and writes the result to a writer created for
+// the size Size returns, holding only a few tiles of the image in memory. The source is first split into
+// square tiles kept in a temporary file; each tile of the result is then built from the source tiles it
+// maps onto, read back through a cache bounded by opts.MaxMemory, and stored in a second temporary file
+// that the result rows are finally read from. The files take eight bytes per pixel of disk space and are
+// removed before RunTiles returns. Only mirrors, quarter turns, crops and filters that change each pixel
+// on its own can run this way.
+func (p *Pipeline) RunTiles(rows *RowReader, out *RowWriter, opts TileOptions, progress Progress) error {
+	mapping := pixelMapping{ux: 1, vy: 1}
+	width, height := rows.Width, rows.Height
+	var filters []func(Pixel) Pixel
+	for _, step := range p.steps {
+		if !fusable(step) {
+			return newError("error.tile_filter", step.filter)
+		}
+		if step.kind == "filter" {
+			filters = append(filters, pixelFilters[step.filter])
+			continue
+		}
+		next, w, h, err := stepMapping(step, width, height)
+		if err != nil {
+			return err
+		}
+		mapping, width, height = mapping.then(next), w, h
+	}
+
+	size := opts.TileSize
+	if size <= 0 {
+		size = DefaultTileSize
+	}
+	// Every tile of the result maps onto at most four source tiles, which must fit next to the tile being
+	// built and the buffers of one row
+	tileBytes := int64(size) * int64(size) * 4
+	rowBytes := int64(max(rows.Width, width)) * 8
+	capacity := defaultTileCache
+	if opts.MaxMemory > 0 {
+		capacity = int((opts.MaxMemory - rowBytes - tileBytes) / tileBytes)
+		if capacity < 4 {
+			return newError("error.tile_memory", size, size, rowBytes+5*tileBytes, opts.MaxMemory)
+		}
+	}
+
+	total := rows.Height + height + height
+	src, err := newTileFile(opts.TempDir, rows.Width, rows.Height, size)
+	if err != nil {
+		return err
+	}
+	defer src.remove()
+	pixels := make([]Pixel, max(rows.Width, width))
+	alpha := make([]byte, max(rows.Width, width))
+	for row := 0; row < rows.Height; row++ {
+		var rowAlpha []byte
+		if rows.Alpha {
+			rowAlpha = alpha[:rows.Width]
+		}
+		if err := rows.Read(pixels[:rows.Width], rowAlpha); err != nil {
+			return err
+		}
+		// Tiles are laid out from the top-left corner while rows arrive bottom-up
+		if err := src.writeRow(rows.Height-1-row, pixels[:rows.Width], rowAlpha); err != nil {
+			return err
+		}
+		progress.Report(row+1, total)
+	}
+
+	dst, err := newTileFile(opts.TempDir, width, height, size)
+	if err != nil {
+		return err
+	}
+	defer dst.remove()
+	cache := newTileCache(src, capacity)
+	tile := make([]byte, tileBytes)
+	for ty := 0; ty < dst.rows; ty++ {
+		for tx := 0; tx < dst.cols; tx++ {
+			for v := ty * size; v < min((ty+1)*size, height); v++ {
+				at := (v - ty*size) * size * 4
+				for u := tx * size; u < min((tx+1)*size, width); u++ {
+					x := mapping.ox + mapping.ux*u + mapping.vx*v
+					y := mapping.oy + mapping.uy*u + mapping.vy*v
+					data, i, err := cache.pixel(x, y)
+					if err != nil {
+						return err
+					}
+					pixel := Pixel{Blue: data[i], Green: data[i+1], Red: data[i+2]}
+					for _, f := range filters {
+						pixel = f(pixel)
+					}
+					tile[at], tile[at+1], tile[at+2], tile[at+3] = pixel.Blue, pixel.Green, pixel.Red, data[i+3]
+					at += 4
+				}
+			}
+			if err := dst.writeTile(tx, ty, tile); err != nil {
+				return err
+			}
+		}
+		progress.Report(rows.Height+min((ty+1)*size, height), total)
+	}
+
+	for row := 0; row < height; row++ {
+		if err := dst.readRow(height-1-row, pixels[:width], alpha[:width]); err != nil {
+			return err
+		}
+		if err := out.Write(pixels[:width], alpha[:width]); err != nil {
+			return err
+		}
+		progress.Report(rows.Height+height+row+1, total)
+	}
+	return nil
+}
+
+// Image stored in a temporary file as square tiles of blue, green, red and alpha bytes, tile after tile
+// from the top-left corner. Tiles at the right and bottom edges are stored whole, with unused pixels.
+type tileFile struct {
+	file       *os.File
+	width      int
+	size       int
+	cols, rows int
+	buf        []byte
+}
+
+// Creates the temporary file for an image of the given size
+func newTileFile(dir string, width, height, size int) (*tileFile, error) {
+	file, err := os.CreateTemp(dir, "bitmap-tiles-*")
+	if err != nil {
+		return nil, newError("error.tile_file", err)
+	}
+	cols, rows := (width+size-1)/size, (height+size-1)/size
+	return &tileFile{file: file, width: width, size: size, cols: cols, rows: rows, buf: make([]byte, width*4)}, nil
+}
+
+// Closes and deletes the file
+func (t *tileFile) remove() {
+	t.file.Close()
+	os.Remove(t.file.Name())
+}
+
+// Returns the offset of row y within tile x, y counted in pixels from the top-left corner of the image
+func (t *tileFile) offset(x, y int) int64 {
+	tile := int64(y/t.size)*int64(t.cols) + int64(x/t.size)
+	return (tile*int64(t.size)*int64(t.size) + int64(y%t.size)*int64(t.size)) * 4
+}
+
+// Stores row y of the image, a part in each tile it crosses. Pixels without alpha are stored opaque.
+func (t *tileFile) writeRow(y int, pixels []Pixel, alpha []byte) error {
+	for x, p := range pixels {
+		a := byte(255)
+		if alpha != nil {
+			a = alpha[x]
+		}
+		t.buf[x*4], t.buf[x*4+1], t.buf[x*4+2], t.buf[x*4+3] = p.Blue, p.Green, p.Red, a
+	}
+	for x := 0; x < t.width; x += t.size {
+		end := min(x+t.size, t.width)
+		if _, err := t.file.WriteAt(t.buf[x*4:end*4], t.offset(x, y)); err != nil {
+			return newError("error.tile_file", err)
+		}
+	}
+	return nil
+}
+
+// Reads row y of the image back from the tiles it crosses
+func (t *tileFile) readRow(y int, pixels []Pixel, alpha []byte) error {
+	for x := 0; x < t.width; x += t.size {
+		end := min(x+t.size, t.width)
+		if _, err := t.file.ReadAt(t.buf[x*4:end*4], t.offset(x, y)); err != nil {
+			return newError("error.tile_file", err)
+		}
+	}
+	for x := range pixels {
+		pixels[x] = Pixel{Blue: t.buf[x*4], Green: t.buf[x*4+1], Red: t.buf[x*4+2]}
+		alpha[x] = t.buf[x*4+3]
+	}
+	return nil
+}
+
+// Stores a whole tile, given in column tx and row ty of tiles
+func (t *tileFile) writeTile(tx, ty int, data []byte) error {
+	if _, err := t.file.WriteAt(data, t.offset(tx*t.size, ty*t.size)); err != nil {
+		return newError("error.tile_file", err)
+	}
+	return nil
+}
+
+// Reads a whole tile into data. The last tile of the file may end early, where rows below the image
+// were never written.
+func (t *tileFile) readTile(tx, ty int, data []byte) error {
+	if _, err := t.file.ReadAt(data, t.offset(tx*t.size, ty*t.size)); err != nil && err != io.EOF {
+		return newError("error.tile_file", err)
+	}
+	return nil
+}
+
+// Tiles of a tile file held in memory, the least recently used one making way when a tile not held is
+// needed and the cache is full
+type tileCache struct {
+	file     *tileFile
+	capacity int
+	tiles    map[int]*cachedTile
+	clock    int
+	last     *cachedTile // Tile of the previous lookup, which the next one usually hits
+	lastKey  int
+}
+
+// Tile held by a tileCache with the time it was last used
+type cachedTile struct {
+	data []byte
+	used int
+}
+
+// Creates a cache holding up to capacity tiles of a file
+func newTileCache(file *tileFile, capacity int) *tileCache {
+	return &tileCache{file: file, capacity: capacity, tiles: make(map[int]*cachedTile), lastKey: -1}
+}
+
+// Returns the tile holding pixel x, y and the index of the pixel's blue byte in it
+func (c *tileCache) pixel(x, y int) ([]byte, int, error) {
+	size := c.file.size
+	key := (y/size)*c.file.cols + x/size
+	i := ((y%size)*size + x%size) * 4
+	if key == c.lastKey {
+		return c.last.data, i, nil
+	}
+	c.clock++
+	tile, ok := c.tiles[key]
+	if !ok {
+		var data []byte
+		if len(c.tiles) >= c.capacity {
+			oldest := -1
+			for k, t := range c.tiles {
+				if oldest < 0 || t.used < c.tiles[oldest].used {
+					oldest = k
+				}
+			}
+			data = c.tiles[oldest].data
+			delete(c.tiles, oldest)
+		} else {
+			data = make([]byte, size*size*4)
+		}
+		if err := c.file.readTile(x/size, y/size, data); err != nil {
+			return nil, 0, err
+		}
+		tile = &cachedTile{data: data}
+		c.tiles[key] = tile
+	}
+	tile.used = c.clock
+	c.last, c.lastKey = tile, key
+	return tile.data, i, nil
+}
@@ -0,0 +1,201 @@
+package bmp
+
+import "slices"
+
+// Applies horizontal or vertical mirroring
+func MirrorPixels[T any](pixels []T, width, height int, mode string, progress Progress) []T {
+	result := make([]T, len(pixels))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			switch mode {
+			case "horizontal":
+				result[y*width+x] = pixels[y*width+(width-1-x)]
+			case "vertical":
+				result[y*width+x] = pixels[(height-1-y)*width+x]
+			}
+		}
+		progress.Report(y+1, height)
+	}
+	return result
+}
+
+// Filters that change each pixel on its own, which FilterPixels and Pipeline apply alike
+var pixelFilters = map[string]func(p Pixel) Pixel{
+	"blue":  func(p Pixel) Pixel { return Pixel{Blue: p.Blue} },
+	"red":   func(p Pixel) Pixel { return Pixel{Red: p.Red} },
+	"green": func(p Pixel) Pixel { return Pixel{Green: p.Green} },
+	"grayscale": func(p Pixel) Pixel {
+		gray := GrayLevel(p)
+		return Pixel{Blue: gray, Green: gray, Red: gray}
+	},
+	"negative": func(p Pixel) Pixel { return Pixel{Blue: 255 - p.Blue, Green: 255 - p.Green, Red: 255 - p.Red} },
+}
+
+// Applies various filters like blue, red, green, grayscale, negative, pixelate, blur, sharpen, emboss or
+// edge. Bands of rows are filtered concurrently; each reads the source, so bands never see each other's output.
+func FilterPixels(pixels []Pixel, width, height int, filterType string, progress Progress) []Pixel {
+	result := make([]Pixel, len(pixels))
+	switch filterType {
+	case "blue", "red", "green", "grayscale", "negative":
+		if Accel != nil && Accel.Filter(pixels, result, filterType) {
+			progress.Report(height, height)
+			return result
+		}
+		f := pixelFilters[filterType]
+		parallelRows(height, 1, progress, func(start, end int) {
+			for i := start * width; i < end*width; i++ {
+				result[i] = f(pixels[i])
+			}
+		})
+	case "pixelate":
+		copy(result, pixels)
+		pixelateArea(result, width, height, 0, 0, width, height, PixelateSize, progress)
+	case "blur":
+		const radius = 3
+		// The kernel reaches into the rows of neighboring bands, which are only read
+		parallelRows(height, 1, progress, func(start, end int) {
+			for y := start; y < end; y++ {
+				for x := 0; x < width; x++ {
+					var sumR, sumG, sumB, count int
+					for ky := y - radius; ky <= y+radius; ky++ {
+						for kx := x - radius; kx <= x+radius; kx++ {
+							if kx < 0 || ky < 0 || kx >= width || ky >= height {
+								continue
+							}
+							p := pixels[ky*width+kx]
+							sumR, sumG, sumB = sumR+int(p.Red), sumG+int(p.Green), sumB+int(p.Blue)
+							count++
+						}
+					}
+					result[y*width+x] = Pixel{Blue: byte(sumB / count), Green: byte(sumG / count), Red: byte(sumR / count)}
+				}
+			}
+		})
+	case "sharpen":
+		return ConvolvePixels(pixels, width, height, sharpenKernel, 0, "clamp", progress)
+	case "emboss":
+		// Flat areas come out mid-gray, with edges raised or sunk depending on their direction
+		return ConvolvePixels(pixels, width, height, embossKernel, 128, "clamp", progress)
+	case "edge":
+		return sobelPixels(pixels, width, height, "clamp", progress)
+	default:
+		copy(result, pixels)
+		progress.Report(height, height)
+	}
+	return result
+}
+
+// Rotates the image by 90, 180 or 270 degrees both clockwise and counterclockwise. Bands of result
+// rows are filled concurrently.
+func RotatePixels[T any](pixels []T, width, height int, angle int, progress Progress) []T {
+	// Normalize to a clockwise angle in [0, 360)
+	angle = ((angle % 360) + 360) % 360
+	result := make([]T, len(pixels))
+
+	// Rows are bottom-up, so coordinates below use y pointing upwards
+	switch angle {
+	case 90:
+		// New image is height x width
+		parallelRows(width, 1, progress, func(start, end int) {
+			for y := start; y < end; y++ {
+				for x := 0; x < height; x++ {
+					result[y*height+x] = pixels[x*width+(width-1-y)]
+				}
+			}
+		})
+	case 180:
+		parallelRows(height, 1, progress, func(start, end int) {
+			for i := start * width; i < end*width; i++ {
+				result[len(pixels)-1-i] = pixels[i]
+			}
+		})
+	case 270:
+		parallelRows(width, 1, progress, func(start, end int) {
+			for y := start; y < end; y++ {
+				for x := 0; x < height; x++ {
+					result[y*height+x] = pixels[(height-1-x)*width+y]
+				}
+			}
+		})
+	default:
+		copy(result, pixels)
+		progress.Report(height, height)
+	}
+
+	return result
+}
+
+// Crops the image based on the given parameters
+func CropPixels[T any](pixels []T, width, height, offsetX, offsetY, cropWidth, cropHeight int, progress Progress) []T {
+	result := make([]T, 0, cropWidth*cropHeight)
+
+	// Offsets are measured from the top-left corner while rows are stored bottom-up
+	firstRow := height - offsetY - cropHeight
+	for y := firstRow; y < firstRow+cropHeight; y++ {
+		start := y*width + offsetX
+		result = append(result, pixels[start:start+cropWidth]...)
+		progress.Report(y-firstRow+1, cropHeight)
+	}
+
+	return result
+}
+
+// Names of the filters FilterPixels applies
+var Filters = []string{"blue", "red", "green", "grayscale", "negative", "pixelate", "blur", "sharpen", "edge", "emboss"}
+
+// Returns the image flipped left-to-right ("horizontal") or top-to-bottom ("vertical")
+func (img *Image) Mirror(axis string, progress Progress) (*Image, error) {
+	if axis != "horizontal" && axis != "vertical" {
+		return nil, newError("error.invalid_mirror", axis)
+	}
+	result := img.derive(img.Width, img.Height, MirrorPixels(img.Pixels, img.Width, img.Height, axis, progress))
+	if img.Alpha != nil {
+		result.Alpha = MirrorPixels(img.Alpha, img.Width, img.Height, axis, nil)
+	}
+	return result, nil
+}
+
+// Returns the image rotated clockwise by a multiple of 90 degrees; negative angles rotate counterclockwise
+func (img *Image) Rotate(angle int, progress Progress) (*Image, error) {
+	if angle%90 != 0 {
+		return nil, newError("error.invalid_angle", angle)
+	}
+	width, height := img.Width, img.Height
+	if angle%180 != 0 {
+		width, height = height, width
+	}
+	result := img.derive(width, height, RotatePixels(img.Pixels, img.Width, img.Height, angle, progress))
+	if img.Alpha != nil {
+		result.Alpha = RotatePixels(img.Alpha, img.Width, img.Height, angle, nil)
+	}
+	return result, nil
+}
+
+// Returns the part of the image at offset x, y from the top-left corner with the given size
+func (img *Image) Crop(x, y, width, height int, progress Progress) (*Image, error) {
+	if x < 0 || y < 0 || width <= 0 || height <= 0 || x+width > img.Width || y+height > img.Height {
+		return nil, newError("error.crop_area", width, height, x, y, img.Width, img.Height)
+	}
+	result := img.derive(width, height, CropPixels(img.Pixels, img.Width, img.Height, x, y, width, height, progress))
+	if img.Alpha != nil {
+		result.Alpha = CropPixels(img.Alpha, img.Width, img.Height, x, y, width, height, nil)
+	}
+	return result, nil
+}
+
+// Returns the image with one of Filters applied. Pixels stay in place, so alpha and hints are kept.
+func (img *Image) Filter(name string, progress Progress) (*Image, error) {
+	if !slices.Contains(Filters, name) {
+		return nil, newError("error.invalid_filter", name)
+	}
+	result := img.derive(img.Width, img.Height, FilterPixels(img.Pixels, img.Width, img.Height, name, progress))
+	result.Alpha, result.Hints = img.Alpha, img.Hints
+	return result, nil
+}
+
+// Returns an image with the given size and pixels that keeps the file layout of img: the bytes before
+// the pixel data, the color table, which the encoder uses again when every pixel is still in it, and the
+// color profile
+func (img *Image) derive(width, height int, pixels []Pixel) *Image {
+	return &Image{Width: width, Height: height, Pixels: pixels, Gap: img.Gap, Palette: img.Palette, Profile: img.Profile}
+}
@@ -0,0 +1,81 @@
+package bmp
+
+import "math"
+
+// Returns the premultiplied red, green, blue and alpha of the pixel in column x and row y counted from the
+// top, or of the nearest border pixel for positions beyond the borders
+func (img *Image) premultiplied(x, y int) [4]float64 {
+	x, y = min(max(x, 0), img.Width-1), min(max(y, 0), img.Height-1)
+	i := (img.Height-1-y)*img.Width + x
+	p, a := img.Pixels[i], 255.0
+	if img.Alpha != nil {
+		a = float64(img.Alpha[i])
+	}
+	return [4]float64{float64(p.Red) * a / 255, float64(p.Green) * a / 255, float64(p.Blue) * a / 255, a}
+}
+
+// Samples the premultiplied color at a point of the source, in pixels from the top-left corner, by
+// weighing the four nearest pixel centers. at reads the pixels, so that callers decide what lies beyond
+// the borders.
+func bilinear(sx, sy float64, at func(x, y int) [4]float64) [4]float64 {
+	// Pixel centers lie half a pixel in from their corners
+	sx, sy = sx-0.5, sy-0.5
+	x0, y0 := int(math.Floor(sx)), int(math.Floor(sy))
+	fx, fy := sx-float64(x0), sy-float64(y0)
+
+	var c [4]float64
+	for _, tap := range [4]struct {
+		x, y   int
+		weight float64
+	}{
+		{x0, y0, (1 - fx) * (1 - fy)},
+		{x0 + 1, y0, fx * (1 - fy)},
+		{x0, y0 + 1, (1 - fx) * fy},
+		{x0 + 1, y0 + 1, fx * fy},
+	} {
+		if tap.weight == 0 {
+			continue
+		}
+		s := at(tap.x, tap.y)
+		for k := range c {
+			c[k] += s[k] * tap.weight
+		}
+	}
+	return c
+}
+
+// Stores a premultiplied color as pixel i of the result, and its alpha when the result has alpha
+func (img *Image) setPremultiplied(i int, c [4]float64) {
+	if img.Alpha != nil {
+		img.Alpha[i] = byte(math.Round(c[3]))
+	}
+	if c[3] > 0 {
+		scale := 255 / c[3]
+		img.Pixels[i] = Pixel{
+			Red:   byte(math.Round(math.Min(c[0]*scale, 255))),
+			Green: byte(math.Round(math.Min(c[1]*scale, 255))),
+			Blue:  byte(math.Round(math.Min(c[2]*scale, 255))),
+		}
+	}
+}
+
+// Returns the image geometrically distorted by source, which maps a point of the result to the point of
+// the image it shows, both in pixels from the top-left corner. The result has the size of the image; each
+// pixel is sampled bilinearly at where source maps its center, with alpha premultiplied, and points beyond
+// the borders take the nearest border pixel.
+func (img *Image) Warp(source func(x, y float64) (float64, float64), progress Progress) *Image {
+	result := img.derive(img.Width, img.Height, make([]Pixel, len(img.Pixels)))
+	if img.Alpha != nil {
+		result.Alpha = make([]byte, len(img.Alpha))
+	}
+	parallelRows(img.Height, 1, progress, func(start, end int) {
+		for row := start; row < end; row++ {
+			y := img.Height - 1 - row
+			for x := 0; x < img.Width; x++ {
+				sx, sy := source(float64(x)+0.5, float64(y)+0.5)
+				result.setPremultiplied(row*img.Width+x, bilinear(sx, sy, img.premultiplied))
+			}
+		}
+	})
+	return result
+}
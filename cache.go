@@ -0,0 +1,63 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Encoded response kept by the serve cache
+type cachedResponse struct {
+	key         string
+	contentType string
+	data        []byte
+}
+
+// In-memory LRU cache of encoded responses, bounded by their total size in bytes
+type responseCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	order    *list.List // Most recently used entries first
+	items    map[string]*list.Element
+}
+
+// Creates a cache holding up to maxBytes of response data
+func newResponseCache(maxBytes int64) *responseCache {
+	return &responseCache{maxBytes: maxBytes, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Returns the cached response for key and marks it as recently used
+func (c *responseCache) get(key string) (*cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cachedResponse), true
+}
+
+// Stores a response, evicting the least recently used ones to stay within the size limit
+func (c *responseCache) put(resp *cachedResponse) {
+	size := int64(len(resp.data))
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[resp.key]; ok {
+		c.size -= int64(len(elem.Value.(*cachedResponse).data))
+		c.order.Remove(elem)
+	}
+	c.items[resp.key] = c.order.PushFront(resp)
+	c.size += size
+
+	for c.size > c.maxBytes {
+		oldest := c.order.Back()
+		evicted := c.order.Remove(oldest).(*cachedResponse)
+		delete(c.items, evicted.key)
+		c.size -= int64(len(evicted.data))
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"creditcard/bmp"
+)
+
+// What this build reads, writes and does, printed by the capabilities command so that wrapping tools can
+// tell what is supported without parsing error messages
+type capabilitiesReport struct {
+	Go        string   `json:"go"`
+	OS        string   `json:"os"`
+	Arch      string   `json:"arch"`
+	BuildTags []string `json:"build_tags"`
+	Commands  []string `json:"commands"`
+	// Formats of the sources every command reads, local, on standard input or over http(s)
+	SourceFormats []string `json:"source_formats"`
+	// Formats convert reads, told apart by their first bytes
+	InputFormats  []string `json:"input_formats"`
+	OutputFormats []string `json:"output_formats"`
+	// DIB header sizes accepted in strict mode; BMP arrays ("BA") are read by --index
+	HeaderSizes    []int             `json:"header_sizes"`
+	ReadBitDepths  []int             `json:"read_bit_depths"`
+	WriteBitDepths []int             `json:"write_bit_depths"`
+	Compressions   []bmp.Compression `json:"compressions"`
+	EmbedFormats   []string          `json:"embed_formats"`
+	Operations     []string          `json:"operations"`
+	Filters        []string          `json:"filters"`
+	ColorSpaces    []string          `json:"color_spaces"`
+	BlendModes     []string          `json:"blend_modes"`
+	Colormaps      []string          `json:"colormaps"`
+	// Features that depend on the platform or the build, and whether this one has them
+	Features map[string]bool `json:"features"`
+}
+
+// Prints what this build supports, as text or as JSON with --json or --format=json
+func runCapabilities(args []string) error {
+	format, asJSON := "text", false
+	flags := []flagSpec{
+		{Name: "format", Target: &format, Choices: []string{"text", "json"}},
+		{Name: "json", Target: &asJSON},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return msgError("usage.capabilities")
+	}
+
+	report := buildCapabilities()
+	if asJSON || format == "json" {
+		if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+			return msgError("error.write_output", err)
+		}
+		return nil
+	}
+	fmt.Printf("go: %s %s/%s\n", report.Go, report.OS, report.Arch)
+	fmt.Printf("build_tags: %s\n", joinOrNone(report.BuildTags))
+	fmt.Printf("commands: %s\n", strings.Join(report.Commands, ", "))
+	fmt.Printf("source_formats: %s\n", strings.Join(report.SourceFormats, ", "))
+	fmt.Printf("input_formats: %s\n", strings.Join(report.InputFormats, ", "))
+	fmt.Printf("output_formats: %s\n", strings.Join(report.OutputFormats, ", "))
+	fmt.Printf("header_sizes: %s\n", joinInts(report.HeaderSizes))
+	fmt.Printf("read_bit_depths: %s\n", joinInts(report.ReadBitDepths))
+	fmt.Printf("write_bit_depths: %s\n", joinInts(report.WriteBitDepths))
+	fmt.Println("compressions:")
+	for _, c := range report.Compressions {
+		var modes []string
+		if c.Read {
+			modes = append(modes, "read")
+		}
+		if c.Write {
+			modes = append(modes, "write")
+		}
+		fmt.Printf("  %d %-17s %-10s bits %s\n", c.Value, c.Name, strings.Join(modes, "+"), joinInts(c.BitCounts))
+	}
+	fmt.Printf("embed_formats: %s\n", strings.Join(report.EmbedFormats, ", "))
+	fmt.Printf("operations: %s\n", strings.Join(report.Operations, ", "))
+	fmt.Printf("filters: %s\n", strings.Join(report.Filters, ", "))
+	fmt.Printf("color_spaces: %s\n", strings.Join(report.ColorSpaces, ", "))
+	fmt.Printf("blend_modes: %s\n", strings.Join(report.BlendModes, ", "))
+	fmt.Printf("colormaps: %s\n", strings.Join(report.Colormaps, ", "))
+	fmt.Println("features:")
+	for _, name := range featureNames {
+		fmt.Printf("  %s: %t\n", name, report.Features[name])
+	}
+	return nil
+}
+
+// Names of the features capabilities reports, in the order text output lists them
+var featureNames = []string{"file_locking", "remote_sources", "remote_cache", "unix_sockets", "gpu_backend"}
+
+// Gathers the capabilities of this build from the tables the commands themselves check against
+func buildCapabilities() *capabilitiesReport {
+	report := &capabilitiesReport{
+		Go:             runtime.Version(),
+		OS:             runtime.GOOS,
+		Arch:           runtime.GOARCH,
+		BuildTags:      buildTags(),
+		SourceFormats:  []string{"bmp"},
+		InputFormats:   []string{"bmp", "png", "jpeg", "text"},
+		OutputFormats:  outputFormats,
+		HeaderSizes:    bmp.DIBHeaderSizes(),
+		ReadBitDepths:  bmp.ReadBitCounts,
+		WriteBitDepths: bmp.WriteBitCounts,
+		Compressions:   bmp.Compressions,
+		EmbedFormats:   bmp.EmbedFormats,
+		Filters:        bmp.Filters,
+		ColorSpaces:    colorSpaces,
+		BlendModes:     bmp.BlendModes(),
+		Colormaps:      colormapNames,
+		Features: map[string]bool{
+			"file_locking":   fileLocksSupported,
+			"remote_sources": true,
+			"remote_cache":   true,
+			// Windows has Unix sockets since Windows 10; other systems without them cannot run daemon
+			"unix_sockets": fileLocksSupported,
+			"gpu_backend":  gpuBuilt,
+		},
+	}
+	for _, cmd := range commands {
+		report.Commands = append(report.Commands, cmd.Name)
+	}
+	for _, op := range operations {
+		report.Operations = append(report.Operations, op.Name)
+	}
+	return report
+}
+
+// Returns the build tags the binary was built with, read from the build information Go embeds in it
+func buildTags() []string {
+	tags := []string{}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return tags
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "-tags" && setting.Value != "" {
+			tags = append(tags, strings.Split(setting.Value, ",")...)
+		}
+	}
+	return tags
+}
+
+// Joins numbers with commas
+func joinInts(values []int) string {
+	text := make([]string, len(values))
+	for i, v := range values {
+		text[i] = strconv.Itoa(v)
+	}
+	return strings.Join(text, ", ")
+}
+
+// Joins names with commas, or returns "none" when there are none
+func joinOrNone(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,177 @@
+package main
+
+// Settings of the caption command
+type captionConfig struct {
+	top      string
+	bottom   string
+	bar      bool   // Extends the canvas with bars holding the text instead of drawing it over the image
+	scale    int    // Pixels per font pixel, 0 to fit the text to the image
+	color    string // Text color, white over the image and black on bars when empty
+	barColor string
+	input    string
+	output   string
+}
+
+// Parses the arguments of the caption command
+func parseCaptionArgs(args []string) (*captionConfig, error) {
+	cfg := &captionConfig{barColor: "#ffffff"}
+	flags := []flagSpec{
+		{Name: "top", Target: &cfg.top},
+		{Name: "bottom", Target: &cfg.bottom},
+		{Name: "bar", Target: &cfg.bar},
+		{Name: "scale", Target: &cfg.scale},
+		{Name: "color", Target: &cfg.color, Check: checkColor},
+		{Name: "bar-color", Target: &cfg.barColor, Check: checkColor},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 2 || (cfg.top == "" && cfg.bottom == "") {
+		return nil, msgError("usage.caption")
+	}
+	cfg.input, cfg.output = positional[0], positional[1]
+	return cfg, nil
+}
+
+// Validates a #rrggbb value
+func checkColor(value string) error {
+	if _, err := parseHexColor(value); err != nil {
+		return msgError("expect.color")
+	}
+	return nil
+}
+
+// Adds a caption above and below an image, either drawn over it in outlined letters as memes are or set
+// on bars added to the canvas. The output format follows the extension of the output file.
+func runCaption(args []string) error {
+	cfg, err := parseCaptionArgs(args)
+	if err != nil {
+		return err
+	}
+	bmpHeader, dibHeader, img, err := globalSettings.loadImage(cfg.input)
+	if err != nil {
+		return err
+	}
+	return globalSettings.saveOutput(cfg.output, "", bmpHeader, dibHeader, captionImage(img, cfg))
+}
+
+// Returns the image with the caption drawn. Without a scale, letters are a tenth of the image height, made
+// smaller when that would leave room for fewer than a dozen characters a line; longer text wraps to more lines.
+func captionImage(img *Image, cfg *captionConfig) *Image {
+	scale := cfg.scale
+	if scale == 0 {
+		scale = max(min(img.Height/(10*glyphHeight), img.Width/(12*(glyphWidth+1))), 1)
+	}
+	margin := glyphHeight * scale / 2
+	lineHeight := (glyphHeight + 2) * scale
+	perLine := lineCapacity(img.Width-2*margin, scale)
+	top := wrapText(breakWords(cfg.top, perLine), perLine)
+	bottom := wrapText(breakWords(cfg.bottom, perLine), perLine)
+	blockHeight := func(lines []string) int {
+		if len(lines) == 0 {
+			return 0
+		}
+		return len(lines)*lineHeight - 2*scale
+	}
+
+	// Rows of the source within the result and where the two blocks of text start, counting from the top
+	offset, topY, bottomY := 0, margin, img.Height-margin-blockHeight(bottom)
+	height := img.Height
+	background, _ := parseHexColor(cfg.barColor)
+	textColor := Pixel{Blue: 255, Green: 255, Red: 255}
+	if cfg.bar {
+		textColor = Pixel{}
+		if len(top) > 0 {
+			offset = blockHeight(top) + 2*margin
+		}
+		bottomY = offset + img.Height + margin
+		height = offset + img.Height
+		if len(bottom) > 0 {
+			height += blockHeight(bottom) + 2*margin
+		}
+	}
+	if cfg.color != "" {
+		textColor, _ = parseHexColor(cfg.color)
+	}
+
+	result := &Image{Width: img.Width, Height: height, Pixels: make([]Pixel, img.Width*height), Gap: img.Gap, Palette: img.Palette}
+	if img.Alpha != nil {
+		result.Alpha = make([]byte, len(result.Pixels))
+	}
+	for y := 0; y < height; y++ {
+		row := (height - 1 - y) * img.Width
+		sy := y - offset
+		for x := 0; x < img.Width; x++ {
+			if sy < 0 || sy >= img.Height {
+				result.Pixels[row+x] = background
+				if result.Alpha != nil {
+					result.Alpha[row+x] = 255
+				}
+				continue
+			}
+			from := (img.Height-1-sy)*img.Width + x
+			result.Pixels[row+x] = img.Pixels[from]
+			if result.Alpha != nil {
+				result.Alpha[row+x] = img.Alpha[from]
+			}
+		}
+	}
+
+	// The mask has its rows from the top down; each line is centered
+	mask := make([]bool, len(result.Pixels))
+	for i, line := range top {
+		stampText(mask, img.Width, height, (img.Width-textWidth(line, scale))/2, topY+i*lineHeight, line, scale)
+	}
+	for i, line := range bottom {
+		stampText(mask, img.Width, height, (img.Width-textWidth(line, scale))/2, bottomY+i*lineHeight, line, scale)
+	}
+	if !cfg.bar {
+		// Over the image the letters get an outline in black, or white for dark text, so they stay legible
+		// on any background
+		outline := Pixel{}
+		if textColor.Luminance() < 128000 {
+			outline = Pixel{Blue: 255, Green: 255, Red: 255}
+		}
+		paintMask(result, strokeMask(mask, img.Width, height, max(scale/2, 1)), outline)
+	}
+	paintMask(result, mask, textColor)
+	return result
+}
+
+// Returns the pixels within radius of a marked pixel of a mask whose rows go from the top down that are
+// not marked themselves
+func strokeMask(mask []bool, width, height, radius int) []bool {
+	stroke := make([]bool, len(mask))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if !mask[y*width+x] {
+				continue
+			}
+			for dy := -radius; dy <= radius; dy++ {
+				for dx := -radius; dx <= radius; dx++ {
+					sx, sy := x+dx, y+dy
+					if dx*dx+dy*dy <= radius*radius && sx >= 0 && sy >= 0 && sx < width && sy < height && !mask[sy*width+sx] {
+						stroke[sy*width+sx] = true
+					}
+				}
+			}
+		}
+	}
+	return stroke
+}
+
+// Paints the pixels marked in a mask whose rows go from the top down with an opaque color
+func paintMask(img *Image, mask []bool, color Pixel) {
+	for i, marked := range mask {
+		if !marked {
+			continue
+		}
+		// Rows are stored bottom-up
+		at := (img.Height-1-i/img.Width)*img.Width + i%img.Width
+		img.Pixels[at] = color
+		if img.Alpha != nil {
+			img.Alpha[at] = 255
+		}
+	}
+}
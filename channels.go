@@ -0,0 +1,97 @@
+package main
+
+// Runs the channels split and merge subcommands
+func runChannels(args []string) error {
+	if len(args) != 5 && len(args) != 6 {
+		return msgError("usage.channels")
+	}
+
+	switch args[0] {
+	case "split":
+		bmpHeader, dibHeader, img, err := globalSettings.loadImage(args[1])
+		if err != nil {
+			return err
+		}
+		for i, output := range args[2:] {
+			if err := globalSettings.saveOutput(output, "", bmpHeader, dibHeader, channelImage(img, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "merge":
+		inputs, output := args[1:len(args)-1], args[len(args)-1]
+		var bmpHeader *BMPHeader
+		var dibHeader *DIBHeader
+		var result *Image
+		for i, input := range inputs {
+			header, dib, img, err := globalSettings.loadImage(input)
+			if err != nil {
+				return err
+			}
+			if result == nil {
+				bmpHeader, dibHeader = header, dib
+				result = &Image{Width: img.Width, Height: img.Height, Pixels: make([]Pixel, len(img.Pixels))}
+			} else if img.Width != result.Width || img.Height != result.Height {
+				return msgError("error.channel_size", input, img.Width, img.Height, result.Width, result.Height)
+			}
+			setChannel(result, i, img)
+		}
+		return globalSettings.saveOutput(output, "", bmpHeader, dibHeader, result)
+	}
+	return msgError("usage.channels")
+}
+
+// Returns a grayscale image of one channel: 0 for red, 1 for green, 2 for blue and 3 for alpha.
+// Images without alpha give an all-white alpha channel, as they are opaque.
+func channelImage(img *Image, channel int) *Image {
+	result := &Image{Width: img.Width, Height: img.Height, Pixels: make([]Pixel, len(img.Pixels))}
+	for i, p := range img.Pixels {
+		var v byte
+		switch channel {
+		case 0:
+			v = p.Red
+		case 1:
+			v = p.Green
+		case 2:
+			v = p.Blue
+		default:
+			v = 255
+			if img.Alpha != nil {
+				v = img.Alpha[i]
+			}
+		}
+		result.Pixels[i] = Pixel{Blue: v, Green: v, Red: v}
+	}
+	return result
+}
+
+// Returns the value a pixel of single-channel data holds: its level when it is gray, as such data is
+// stored, or its luminance otherwise
+func dataLevel(p Pixel) byte {
+	if p.Red != p.Green || p.Green != p.Blue {
+		return byte((p.Luminance() + 500) / 1000)
+	}
+	return p.Red
+}
+
+// Fills one channel of result, numbered as for channelImage, from the brightness of a grayscale image.
+// Images that are not gray contribute their luminance.
+func setChannel(result *Image, channel int, img *Image) {
+	if channel == 3 {
+		result.Alpha = make([]byte, len(result.Pixels))
+	}
+	for i, p := range img.Pixels {
+		v := dataLevel(p)
+		switch channel {
+		case 0:
+			result.Pixels[i].Red = v
+		case 1:
+			result.Pixels[i].Green = v
+		case 2:
+			result.Pixels[i].Blue = v
+		default:
+			result.Alpha[i] = v
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"creditcard/bmp"
+)
+
+// Source rows between the checkpoints of a streaming run
+const checkpointStripe = 1024
+
+// Progress of a streaming run, written by --checkpoint after every stripe of rows so that the run can
+// resume where it stopped. It only applies to the same source, unchanged, run with the same options.
+type checkpointState struct {
+	Source       string `json:"source"`
+	SourceSize   int64  `json:"source_size"`
+	SourceTime   string `json:"source_modified"` // RFC 3339, in UTC
+	Pipeline     string `json:"pipeline"`        // pipelineHash of the options and the output
+	Settings     string `json:"settings"`        // Global options that change the output
+	Output       string `json:"output"`
+	Rows         int    `json:"rows"`          // Source rows done
+	PartialBytes int64  `json:"partial_bytes"` // Bytes of the partial output that hold them
+}
+
+// Returns the partial output of a checkpointed run, renamed to the output once every row is written
+func partialName(output string) string {
+	return output + ".partial"
+}
+
+// Streams the rows through the stages like runStreamCommand, into the partial output, and records the
+// progress in the --checkpoint file after every stripe. When the file holds the progress of an earlier
+// run of the same command, the rows it did are skipped and the partial output is continued.
+func runCheckpointedStream(cmd *commandArgs, bmpHeader *BMPHeader, dibHeader *DIBHeader, stages []rowStage, width, height int) error {
+	output := cmd.outputs[0].Filename
+	if output == stdioName || cmd.filename == stdioName || isRemoteSource(cmd.filename) || cmd.settings.Encrypt != "" || !onOSFileSystem() {
+		return msgError("error.checkpoint_files")
+	}
+	info, err := os.Stat(nativePath(cmd.filename))
+	if err != nil {
+		return msgError("error.open_file", err)
+	}
+	pipeline, err := cmd.settings.pipelineHash(cmd.options, output)
+	if err != nil {
+		return err
+	}
+	state := checkpointState{
+		Source:     cmd.filename,
+		SourceSize: info.Size(),
+		SourceTime: info.ModTime().UTC().Format(time.RFC3339Nano),
+		Pipeline:   pipeline,
+		Settings: fmt.Sprintf("index=%d mode=%s trust=%s true-color=%t dpi=%s",
+			cmd.settings.Decode.Index, cmd.settings.Decode.Mode, cmd.settings.Decode.Trust, cmd.settings.Encode.TrueColor, cmd.dpi),
+		Output: output,
+	}
+
+	rows, closeRows, err := openRowReader(cmd, bmpHeader, dibHeader)
+	if err != nil {
+		return err
+	}
+	defer closeRows()
+	alpha := rows.Alpha && !cmd.settings.Encode.TrueColor
+
+	file, start, err := resumePartial(cmd.checkpoint, &state)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := &writeCounter{Writer: file}
+	defer func() { metrics.addBytesWritten(writer.n) }()
+	var out *bmp.RowWriter
+	if start > 0 {
+		if err := rows.Skip(start); err != nil {
+			return localizeError(err)
+		}
+		out = bmp.ResumeRowWriter(writer, width, alpha)
+		logDetail("info.checkpoint_resumed", start, rows.Height, cmd.checkpoint)
+	} else {
+		dib := *dibHeader
+		dib.Width, dib.Height = int32(width), int32(height)
+		if out, err = bmp.NewRowWriter(writer, bmpHeader, &dib, alpha); err != nil {
+			return localizeError(err)
+		}
+	}
+
+	err = streamRows(rows, out, stages, alpha, start, func(y int) error {
+		if (y+1)%checkpointStripe != 0 || y+1 == rows.Height {
+			return nil
+		}
+		if err := out.Flush(); err != nil {
+			return localizeError(err)
+		}
+		if err := file.Sync(); err != nil {
+			return msgError("error.write_checkpoint", err)
+		}
+		state.Rows = y + 1
+		if state.PartialBytes, err = file.Seek(0, io.SeekCurrent); err != nil {
+			return msgError("error.write_checkpoint", err)
+		}
+		return writeCheckpoint(cmd.checkpoint, &state)
+	})
+	if err != nil {
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		return localizeError(err)
+	}
+	if err := file.Close(); err != nil {
+		return msgError("error.write_pixels", err)
+	}
+	if err := os.Rename(file.Name(), nativePath(output)); err != nil {
+		return msgError("error.create_file", err)
+	}
+	if err := os.Remove(nativePath(cmd.checkpoint)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return msgError("error.write_checkpoint", err)
+	}
+	return nil
+}
+
+// Opens the partial output for the run state describes and returns the source row to start from. The
+// partial output is continued, cut back to the last checkpoint, when the checkpoint file records the
+// same run and the partial output is still there; otherwise the run starts over in a new one.
+func resumePartial(checkpoint string, state *checkpointState) (*os.File, int, error) {
+	partial := nativePath(partialName(state.Output))
+	var saved checkpointState
+	if data, err := os.ReadFile(nativePath(checkpoint)); err == nil {
+		// A checkpoint file that cannot be read is replaced like one of another run
+		if json.Unmarshal(data, &saved) != nil {
+			saved = checkpointState{}
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, msgError("error.read_checkpoint", err)
+	}
+
+	current := *state
+	current.Rows, current.PartialBytes = saved.Rows, saved.PartialBytes
+	if saved.Rows > 0 && saved == current {
+		file, err := os.OpenFile(partial, os.O_WRONLY, 0)
+		if err == nil {
+			info, statErr := file.Stat()
+			if statErr == nil && info.Size() >= saved.PartialBytes {
+				if err := file.Truncate(saved.PartialBytes); err != nil {
+					file.Close()
+					return nil, 0, msgError("error.create_file", err)
+				}
+				if _, err := file.Seek(saved.PartialBytes, io.SeekStart); err != nil {
+					file.Close()
+					return nil, 0, msgError("error.create_file", err)
+				}
+				*state = saved
+				return file, saved.Rows, nil
+			}
+			file.Close()
+		}
+		printWarning(msgError("warning.checkpoint_partial", partialName(state.Output), checkpoint))
+	} else if saved.Rows > 0 {
+		printWarning(msgError("warning.checkpoint_stale", checkpoint))
+	}
+
+	file, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o666)
+	if err != nil {
+		return nil, 0, msgError("error.create_file", err)
+	}
+	return file, 0, nil
+}
+
+// Replaces the checkpoint file with the state, through a temporary file so that an interruption leaves
+// the previous checkpoint whole
+func writeCheckpoint(path string, state *checkpointState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return msgError("error.write_checkpoint", err)
+	}
+	tmp, err := os.CreateTemp(nativePath(filepath.Dir(path)), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return msgError("error.write_checkpoint", err)
+	}
+	_, err = tmp.Write(append(data, '\n'))
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), nativePath(path))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return msgError("error.write_checkpoint", err)
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+//go:build !(js && wasm)
+
+package main
+
+import (
+	"os"
+	"strings"
+
+	"creditcard/bmp"
+)
+
+// Runs the command-line interface
+func main() {
+	if err := loadConfigDefaults(); err != nil {
+		exitWithError(err)
+	}
+	args, err := parseGlobalFlags(os.Args[1:])
+	if err != nil {
+		exitWithError(err)
+	}
+	os.Args = append(os.Args[:1], args...)
+
+	if len(os.Args) < 2 {
+		displayGeneralHelp()
+		os.Exit(exitUsage)
+	}
+
+	// Commands that handle their own arguments
+	var run func([]string) error
+	switch os.Args[1] {
+	case "tune":
+		run = runTune
+	case "batch":
+		run = runBatch
+	case "run":
+		run = runJobs
+	case "serve":
+		run = runServe
+	case "daemon":
+		run = runDaemon
+	case "client":
+		run = runClient
+	case "rpc":
+		run = runRPC
+	case "palette":
+		run = runPalette
+	case "channels":
+		run = runChannels
+	case "split":
+		run = runSplit
+	case "join":
+		run = runJoin
+	case "dump":
+		run = runDump
+	case "convert":
+		run = runConvert
+	case "explain":
+		run = runExplain
+	case "placeholder":
+		run = runPlaceholder
+	case "color":
+		run = runColor
+	case "quality":
+		run = runQuality
+	case "compare":
+		run = runCompare
+	case "fit":
+		run = runFit
+	case "histogram":
+		run = runHistogram
+	case "detect-lines":
+		run = runDetectLines
+	case "testcard":
+		run = runTestcard
+	case "frames":
+		run = runFrames
+	case "caption":
+		run = runCaption
+	case "thumbs":
+		run = runThumbs
+	case "extract-thumb":
+		run = runExtractThumb
+	case "beforeafter":
+		run = runBeforeAfter
+	case "stack":
+		run = runStack
+	case "shell":
+		run = runShell
+	case "pick":
+		run = runPick
+	case "provenance":
+		run = runProvenance
+	case "capabilities":
+		run = runCapabilities
+	case "selftest":
+		run = runSelfTest
+	case "triage":
+		run = runTriage
+	case "pack-atlas":
+		run = runPackAtlas
+	case "cycle":
+		run = runCycle
+	case "match-colors":
+		run = runMatchColors
+	case isolateCommand:
+		run = runIsolatedDecoder
+	case "help":
+		run = runHelp
+	case "man":
+		run = runMan
+	case "-h", "--help":
+		displayGeneralHelp()
+		return
+	}
+	if run != nil {
+		if err := run(os.Args[2:]); err != nil {
+			exitWithError(err)
+		}
+		if err := exportMetrics(); err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	// Per-command help flags
+	if len(os.Args) > 2 && (os.Args[2] == "-h" || os.Args[2] == "--help") {
+		if err := runHelp(os.Args[1:2]); err != nil {
+			exitWithError(err)
+		}
+		return
+	}
+
+	cmd, err := parseArgs(os.Args[1:])
+	if err != nil {
+		exitWithError(err)
+	}
+
+	switch cmd.command {
+	case "header":
+		bmpHeader, dibHeader, err := globalSettings.readHeaders(cmd.filename)
+		if err != nil {
+			exitWithError(err)
+		}
+		// Bitmap arrays list every image they contain
+		entries, err := globalSettings.readArray(cmd.filename)
+		if err != nil {
+			exitWithError(err)
+		}
+		profile, err := globalSettings.readProfile(cmd.filename, dibHeader)
+		if err != nil {
+			exitWithError(err)
+		}
+		if err := writeHeaders(os.Stdout, cmd.format, bmpHeader, dibHeader, profile, entries); err != nil {
+			exitWithError(err)
+		}
+
+	case "apply":
+		if err := runApply(cmd); err != nil {
+			exitWithError(err)
+		}
+
+	default:
+		displayGeneralHelp()
+		os.Exit(exitUsage)
+	}
+
+	if err := exportMetrics(); err != nil {
+		exitWithError(err)
+	}
+}
+
+// Prints the error, as JSON with --errors=json, writes any requested metrics and exits with the status
+// of the error's kind
+func exitWithError(err error) {
+	if errorFormat == "json" {
+		writeErrorJSON(os.Stderr, err)
+	} else {
+		printError(err)
+	}
+	if metricsErr := exportMetrics(); metricsErr != nil {
+		printError(metricsErr)
+	}
+	os.Exit(exitCode(err))
+}
+
+// Parses the global flags, which come before the command, and sets what they select, returning the
+// command and its arguments. Flags after the command are its own, so that a command may have a flag of the
+// same name as a global one, as caption has --color.
+func parseGlobalFlags(args []string) ([]string, error) {
+	// Messages of the errors below are in the language of the locale, as --lang may not be parsed yet
+	selectLanguage("")
+
+	var lang, level, backgroundColor, distance, backend string
+	flags := []flagSpec{
+		{Name: "lang", Target: &lang, Check: checkLanguage},
+		{Name: "errors", Target: &errorFormat, Choices: []string{"text", "json"}},
+		{Name: "verbose", Short: "-v", Target: &level, Value: "verbose"},
+		{Name: "quiet", Target: &level, Value: "quiet"},
+		{Name: "progress", Target: &showProgress},
+		{Name: "color", Target: &colorMode, Choices: []string{"auto", "always", "never"}},
+		{Name: "metrics", Target: &metricsFormat, Choices: []string{"json", "prometheus"}},
+		{Name: "metrics-file", Target: &metricsFile, Check: nonEmpty},
+		{Name: "max-width", Target: &globalSettings.Decode.MaxWidth},
+		{Name: "max-height", Target: &globalSettings.Decode.MaxHeight},
+		{Name: "max-pixels", Target: &globalSettings.Decode.MaxPixels},
+		{Name: "max-file-size", Target: &globalSettings.Decode.MaxFileSize},
+		{Name: "strict", Target: &globalSettings.Decode.Mode, Value: "strict"},
+		{Name: "permissive", Target: &globalSettings.Decode.Mode, Value: "permissive"},
+		{Name: "trust", Target: &globalSettings.Decode.Trust, Choices: []string{"headers", "data"}},
+		{Name: "index", Target: &globalSettings.Decode.Index},
+		{Name: "keep-offset", Target: &globalSettings.Encode.KeepOffset},
+		{Name: "keep-orientation", Target: &globalSettings.Encode.KeepOrientation},
+		{Name: "embed", Target: &globalSettings.Encode.Embed, Choices: bmp.EmbedFormats},
+		{Name: "compact", Target: &globalSettings.Encode.Compact},
+		{Name: "true-color", Target: &globalSettings.Encode.TrueColor},
+		{Name: "jobs", Target: &bmp.Jobs, Min: 1},
+		{Name: "straight-alpha", Target: &straightAlpha},
+		{Name: "deterministic", Target: &deterministic},
+		{Name: "background", Target: &backgroundColor, Check: checkColor},
+		{Name: "distance", Target: &distance, Choices: colorDistanceNames()},
+		{Name: "backend", Target: &backend, Choices: []string{"cpu", "gpu"}},
+		{Name: "nice", Target: &niceMode},
+		{Name: "isolate", Target: &globalSettings.Isolate},
+		{Name: "encrypt", Target: &globalSettings.Encrypt, Check: nonEmpty},
+		{Name: "decrypt", Target: &globalSettings.Decrypt, Check: nonEmpty},
+		{Name: "post-hook", Target: &globalSettings.PostHook, Check: checkPostHook},
+	}
+	rest, err := parseLeadingFlags(args, flags)
+	if err != nil {
+		return nil, err
+	}
+	// No command starts with a dash: any flag left but -h and --help is one that is not global
+	if len(rest) > 0 && strings.HasPrefix(rest[0], "-") && rest[0] != "-h" && rest[0] != "--help" {
+		name, _, _ := strings.Cut(rest[0], "=")
+		return nil, msgError("error.unknown_option", name)
+	}
+
+	selectLanguage(lang)
+	switch level {
+	case "verbose":
+		logLevel = logVerbose
+	case "quiet":
+		logLevel = logQuiet
+	}
+	if backgroundColor != "" {
+		color, _ := parseHexColor(backgroundColor)
+		background = &color
+	}
+	if distance != "" {
+		activeDistance = colorDistances[distance]
+	}
+	if backend != "" {
+		if err := selectBackend(backend); err != nil {
+			return nil, err
+		}
+	}
+	if niceMode {
+		selectPriority()
+	}
+	return rest, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// Modes of the color command
+var colorModes = []string{"average", "vibrant", "muted"}
+
+// Target saturation and lightness of the accent colors, with the limits a candidate must meet
+type accentTarget struct {
+	saturation, minSaturation, maxSaturation float64
+	lightness, minLightness, maxLightness    float64
+}
+
+var accentTargets = map[string]accentTarget{
+	"vibrant": {saturation: 1, minSaturation: 0.35, maxSaturation: 1, lightness: 0.5, minLightness: 0.3, maxLightness: 0.7},
+	"muted":   {saturation: 0.3, minSaturation: 0, maxSaturation: 0.4, lightness: 0.5, minLightness: 0.3, maxLightness: 0.7},
+}
+
+// Prints a color of the image as #rrggbb: the average or a vibrant or muted accent
+func runColor(args []string) error {
+	mode := "average"
+	flags := []flagSpec{{Name: "mode", Target: &mode, Choices: colorModes}}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return msgError("usage.color")
+	}
+
+	_, _, img, err := globalSettings.loadImage(positional[0])
+	if err != nil {
+		return err
+	}
+	if mode == "average" {
+		fmt.Println(hexColor(averageColor(img.Pixels)))
+	} else {
+		fmt.Println(hexColor(accentColor(img.Pixels, accentTargets[mode])))
+	}
+	return nil
+}
+
+// Averages the pixels in linear light, so that dark and bright areas are weighted as the eye sees them mixed
+func averageColor(pixels []Pixel) Pixel {
+	var sum colorSum
+	for _, p := range pixels {
+		sum.add(p)
+	}
+	return sum.mean()
+}
+
+// Accumulates colors in linear light
+type colorSum struct {
+	red, green, blue float64
+	count            int
+}
+
+// Adds a color to the sum
+func (c *colorSum) add(p Pixel) {
+	c.red += srgbToLinear(p.Red)
+	c.green += srgbToLinear(p.Green)
+	c.blue += srgbToLinear(p.Blue)
+	c.count++
+}
+
+// Returns the average of the added colors
+func (c *colorSum) mean() Pixel {
+	n := float64(c.count)
+	return Pixel{Red: linearToSRGB(c.red / n), Green: linearToSRGB(c.green / n), Blue: linearToSRGB(c.blue / n)}
+}
+
+// Picks the accent color closest to the target. Pixels are grouped by the top 4 bits of each channel and
+// every group is represented by its average color; groups are scored by how close their saturation and
+// lightness are to the target and by their share of the image. When no group meets the limits the best
+// scoring one is used anyway.
+func accentColor(pixels []Pixel, target accentTarget) Pixel {
+	groups := make([]colorSum, 1<<12)
+	largest := 0
+	for _, p := range pixels {
+		group := &groups[int(p.Red>>4)<<8|int(p.Green>>4)<<4|int(p.Blue>>4)]
+		group.add(p)
+		largest = max(largest, group.count)
+	}
+
+	var best, fallback Pixel
+	bestScore, fallbackScore := -1.0, -1.0
+	for i := range groups {
+		if groups[i].count == 0 {
+			continue
+		}
+		color := groups[i].mean()
+		s, l := saturationLightness(color)
+		// Lightness matters most, then saturation, then population, as in the Vibrant.js weighting
+		score := (3*(1-math.Abs(s-target.saturation)) + 6*(1-math.Abs(l-target.lightness)) + float64(groups[i].count)/float64(largest)) / 10
+		if score > fallbackScore {
+			fallback, fallbackScore = color, score
+		}
+		if s >= target.minSaturation && s <= target.maxSaturation && l >= target.minLightness && l <= target.maxLightness && score > bestScore {
+			best, bestScore = color, score
+		}
+	}
+	if bestScore < 0 {
+		return fallback
+	}
+	return best
+}
+
+// Returns the HSL saturation and lightness of a color, both in [0, 1]
+func saturationLightness(p Pixel) (s, l float64) {
+	hi := float64(max(p.Red, p.Green, p.Blue)) / 255
+	lo := float64(min(p.Red, p.Green, p.Blue)) / 255
+	l = (hi + lo) / 2
+	if hi == lo {
+		return 0, l
+	}
+	if l > 0.5 {
+		return (hi - lo) / (2 - hi - lo), l
+	}
+	return (hi - lo) / (hi + lo), l
+}
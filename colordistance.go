@@ -0,0 +1,285 @@
+package main
+
+import (
+	"cmp"
+	"image"
+	"image/draw"
+	"maps"
+	"math"
+	"slices"
+)
+
+// How far apart two colors look, as features that match colors measure it
+type colorDistance interface {
+	// Returns the coordinates of a color in the space the distance is measured in, so that colors
+	// compared many times are converted once
+	coordinates(p Pixel) [3]float64
+	// Returns the distance between two colors by their coordinates, 0 for equal ones
+	between(a, b [3]float64) float64
+	// Returns the least the distance grows by per unit the first coordinates differ by, which lets a
+	// search pass over colors that differ too much in it
+	firstWeight() float64
+}
+
+// Distances --distance selects, by name
+var colorDistances = map[string]colorDistance{
+	"rgb":       rgbDistance{},
+	"weighted":  weightedDistance{},
+	"cie76":     cie76Distance{},
+	"ciede2000": ciede2000Distance{},
+}
+
+// Distance colors are matched by, set by --distance. Plain RGB distance is cheap, but treats steps in
+// dark and light colors and in every hue alike, which the eye does not, so colors it calls nearest can
+// look far off; the CIE distances follow the eye at a higher cost.
+var activeDistance colorDistance = rgbDistance{}
+
+// Returns the names of the distances in colorDistances, sorted
+func colorDistanceNames() []string {
+	return slices.Sorted(maps.Keys(colorDistances))
+}
+
+// Returns the distance between two colors
+func distanceBetween(d colorDistance, a, b Pixel) float64 {
+	return d.between(d.coordinates(a), d.coordinates(b))
+}
+
+// Returns the red, green and blue levels of a color
+func rgbCoordinates(p Pixel) [3]float64 {
+	return [3]float64{float64(p.Red), float64(p.Green), float64(p.Blue)}
+}
+
+// Euclidean distance in sRGB levels
+type rgbDistance struct{}
+
+func (rgbDistance) coordinates(p Pixel) [3]float64 { return rgbCoordinates(p) }
+
+func (rgbDistance) firstWeight() float64 { return 1 }
+
+func (rgbDistance) between(a, b [3]float64) float64 {
+	dr, dg, db := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return math.Sqrt(dr*dr + dg*dg + db*db)
+}
+
+// Euclidean distance in sRGB levels with the channels weighted by the mean red of the colors, the
+// "redmean" approximation: green counts most, and red more among reds and blue more among blues
+type weightedDistance struct{}
+
+func (weightedDistance) coordinates(p Pixel) [3]float64 { return rgbCoordinates(p) }
+
+// The red weight is at least 2, under the square root
+func (weightedDistance) firstWeight() float64 { return math.Sqrt2 }
+
+func (weightedDistance) between(a, b [3]float64) float64 {
+	redMean := (a[0] + b[0]) / 2
+	dr, dg, db := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return math.Sqrt((2+redMean/256)*dr*dr + 4*dg*dg + (2+(255-redMean)/256)*db*db)
+}
+
+// Euclidean distance in CIELAB, ΔE*ab of 1976, about 2.3 for colors most people can just tell apart
+type cie76Distance struct{}
+
+func (cie76Distance) coordinates(p Pixel) [3]float64 { return labColor(p) }
+
+func (cie76Distance) firstWeight() float64 { return 1 }
+
+func (cie76Distance) between(a, b [3]float64) float64 {
+	dl, da, db := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return math.Sqrt(dl*dl + da*da + db*db)
+}
+
+// CIEDE2000 difference, ΔE00, which corrects CIE76 for the eye being less sensitive to differences in
+// chroma among saturated colors and in lightness among light and dark ones, and for blues
+type ciede2000Distance struct{}
+
+func (ciede2000Distance) coordinates(p Pixel) [3]float64 { return labColor(p) }
+
+// The lightness term alone is ΔL* divided by at most 1.75, and the others add up to no less than 0
+func (ciede2000Distance) firstWeight() float64 { return 1 / 1.75 }
+
+func (ciede2000Distance) between(a, b [3]float64) float64 { return deltaE2000(a, b) }
+
+// Returns the CIEDE2000 difference of two CIELAB colors, with the weights of lightness, chroma and hue
+// all 1
+func deltaE2000(la, lb [3]float64) float64 {
+	deg := math.Pi / 180
+
+	c1, c2 := math.Hypot(la[1], la[2]), math.Hypot(lb[1], lb[2])
+	meanC7 := math.Pow((c1+c2)/2, 7)
+	g := 0.5 * (1 - math.Sqrt(meanC7/(meanC7+math.Pow(25, 7))))
+	a1, a2 := (1+g)*la[1], (1+g)*lb[1]
+	c1, c2 = math.Hypot(a1, la[2]), math.Hypot(a2, lb[2])
+	hue := func(b, a float64) float64 {
+		if a == 0 && b == 0 {
+			return 0
+		}
+		h := math.Atan2(b, a) / deg
+		if h < 0 {
+			h += 360
+		}
+		return h
+	}
+	h1, h2 := hue(la[2], a1), hue(lb[2], a2)
+
+	dl, dc := lb[0]-la[0], c2-c1
+	dh := 0.0
+	if c1*c2 != 0 {
+		dh = h2 - h1
+		if dh > 180 {
+			dh -= 360
+		} else if dh < -180 {
+			dh += 360
+		}
+	}
+	dH := 2 * math.Sqrt(c1*c2) * math.Sin(dh/2*deg)
+
+	meanL, meanC := (la[0]+lb[0])/2, (c1+c2)/2
+	meanH := h1 + h2
+	if c1*c2 != 0 {
+		meanH /= 2
+		if math.Abs(h1-h2) > 180 {
+			if meanH < 180 {
+				meanH += 180
+			} else {
+				meanH -= 180
+			}
+		}
+	}
+	t := 1 - 0.17*math.Cos((meanH-30)*deg) + 0.24*math.Cos(2*meanH*deg) + 0.32*math.Cos((3*meanH+6)*deg) - 0.20*math.Cos((4*meanH-63)*deg)
+	sl := 1 + 0.015*(meanL-50)*(meanL-50)/math.Sqrt(20+(meanL-50)*(meanL-50))
+	sc := 1 + 0.045*meanC
+	sh := 1 + 0.015*meanC*t
+	meanC7 = math.Pow(meanC, 7)
+	rt := -2 * math.Sqrt(meanC7/(meanC7+math.Pow(25, 7))) * math.Sin(60*math.Exp(-math.Pow((meanH-275)/25, 2))*deg)
+
+	l, c, h := dl/sl, dc/sc, dH/sh
+	return math.Sqrt(l*l + c*c + h*h + rt*c*h)
+}
+
+// Returns the L*, a* and b* of a color in the CIELAB space of the D65 white point of sRGB
+func labColor(p Pixel) [3]float64 {
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	r, g, b := srgbToLinear(p.Red), srgbToLinear(p.Green), srgbToLinear(p.Blue)
+	x := (0.4124*r + 0.3576*g + 0.1805*b) / 0.95047
+	y := 0.2126*r + 0.7152*g + 0.0722*b
+	z := (0.0193*r + 0.1192*g + 0.9505*b) / 1.08883
+	fx, fy, fz := f(x), f(y), f(z)
+	return [3]float64{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// Maps colors to the nearest entry of a color table by a distance, remembering the colors it has mapped,
+// as images hold far fewer colors than they have pixels. Entries are searched outward from the first
+// coordinate of the color, until they differ in it by more than the nearest one so far is away.
+type paletteMatcher struct {
+	entries  [][3]float64 // Coordinates of the entries of the table
+	order    []int        // Indices of the entries by their first coordinate
+	distance colorDistance
+	matched  map[Pixel]int
+}
+
+// Creates a matcher for a color table
+func newPaletteMatcher(palette []Pixel, distance colorDistance) *paletteMatcher {
+	m := &paletteMatcher{entries: make([][3]float64, len(palette)), distance: distance, matched: map[Pixel]int{}}
+	for i, p := range palette {
+		m.entries[i] = distance.coordinates(p)
+		m.order = append(m.order, i)
+	}
+	slices.SortFunc(m.order, func(a, b int) int { return cmp.Compare(m.entries[a][0], m.entries[b][0]) })
+	return m
+}
+
+// Returns the index of the entry nearest to a color, the first of equally near ones
+func (m *paletteMatcher) nearest(p Pixel) int {
+	if index, ok := m.matched[p]; ok {
+		return index
+	}
+	c := m.distance.coordinates(p)
+	weight := m.distance.firstWeight()
+	index, best := -1, math.Inf(1)
+	// Tries the entry at a position of order, reporting whether the search goes on past it
+	try := func(k int) bool {
+		i := m.order[k]
+		if weight*math.Abs(m.entries[i][0]-c[0]) > best {
+			return false
+		}
+		if d := m.distance.between(c, m.entries[i]); d < best || d == best && i < index {
+			index, best = i, d
+		}
+		return true
+	}
+	start, _ := slices.BinarySearchFunc(m.order, c[0], func(i int, first float64) int { return cmp.Compare(m.entries[i][0], first) })
+	for up, down := start, start-1; up < len(m.order) || down >= 0; {
+		if up < len(m.order) && !try(up) {
+			up = len(m.order)
+		} else {
+			up++
+		}
+		if down >= 0 && !try(down) {
+			down = -1
+		} else {
+			down--
+		}
+	}
+	m.matched[p] = index
+	return index
+}
+
+// Floyd-Steinberg dithering to the nearest colors of the destination's table by a distance: the error of
+// every pixel is spread over its right and lower neighbors, so areas keep their average color, as
+// draw.FloydSteinberg does with RGB distance
+type ditherer struct {
+	distance colorDistance
+}
+
+// Returns the drawer that dithers to a color table by the distance set by --distance
+func paletteDrawer() draw.Drawer {
+	if _, ok := activeDistance.(rgbDistance); ok {
+		return draw.FloydSteinberg
+	}
+	return ditherer{activeDistance}
+}
+
+func (d ditherer) Draw(dst draw.Image, r image.Rectangle, src image.Image, sp image.Point) {
+	paletted, ok := dst.(*image.Paletted)
+	if !ok {
+		draw.FloydSteinberg.Draw(dst, r, src, sp)
+		return
+	}
+	r = r.Intersect(paletted.Bounds())
+	palette := make([]Pixel, len(paletted.Palette))
+	for i, c := range paletted.Palette {
+		red, green, blue, _ := c.RGBA()
+		palette[i] = Pixel{Red: byte(red >> 8), Green: byte(green >> 8), Blue: byte(blue >> 8)}
+	}
+	matcher := newPaletteMatcher(palette, d.distance)
+	clamp := func(v float64) byte { return byte(min(max(math.Round(v), 0), 255)) }
+
+	// Errors carried to the current and next row, three channels per column with a column of margin on
+	// either side
+	width := r.Dx()
+	current, next := make([]float64, 3*(width+2)), make([]float64, 3*(width+2))
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			red, green, blue, _ := src.At(sp.X+x-r.Min.X, sp.Y+y-r.Min.Y).RGBA()
+			k := 3 * (x - r.Min.X + 1)
+			want := [3]float64{float64(red>>8) + current[k], float64(green>>8) + current[k+1], float64(blue>>8) + current[k+2]}
+			index := matcher.nearest(Pixel{Red: clamp(want[0]), Green: clamp(want[1]), Blue: clamp(want[2])})
+			paletted.SetColorIndex(x, y, uint8(index))
+			got := palette[index]
+			for c, level := range [3]byte{got.Red, got.Green, got.Blue} {
+				e := want[c] - float64(level)
+				current[k+3+c] += e * 7 / 16
+				next[k-3+c] += e * 3 / 16
+				next[k+c] += e * 5 / 16
+				next[k+3+c] += e * 1 / 16
+			}
+		}
+		current, next = next, current
+		clear(next)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math"
+	"slices"
+)
+
+// A color of a colormap and the position, from 0 to 1, at which it is reached
+type colormapStop struct {
+	at    float64
+	color Pixel
+}
+
+// Colormaps of --colormap as control points; levels between two points are interpolated. viridis and
+// magma are sampled from matplotlib at ten even steps, jet follows its classic piecewise ramp.
+var colormaps = map[string][]colormapStop{
+	"viridis": evenStops(0x440154, 0x482878, 0x3e4989, 0x31688e, 0x26828e, 0x1f9e89, 0x35b779, 0x6ece58, 0xb5de2b, 0xfde725),
+	"magma":   evenStops(0x000004, 0x180f3d, 0x440f76, 0x721f81, 0x9e2f7f, 0xcd4071, 0xf1605d, 0xfd9668, 0xfeca8d, 0xfcfdbf),
+	"jet": {
+		{0, rgbColor(0x00007f)}, {0.125, rgbColor(0x0000ff)}, {0.375, rgbColor(0x00ffff)},
+		{0.625, rgbColor(0xffff00)}, {0.875, rgbColor(0xff0000)}, {1, rgbColor(0x7f0000)},
+	},
+	"grayscale": evenStops(0x000000, 0xffffff),
+}
+
+// Names of the colormaps, in the order help lists them
+var colormapNames = []string{"viridis", "jet", "magma", "grayscale"}
+
+// Returns a color given as 0xrrggbb
+func rgbColor(c uint32) Pixel {
+	return Pixel{Blue: byte(c), Green: byte(c >> 8), Red: byte(c >> 16)}
+}
+
+// Spreads colors given as 0xrrggbb evenly from 0 to 1
+func evenStops(colors ...uint32) []colormapStop {
+	stops := make([]colormapStop, len(colors))
+	for i, c := range colors {
+		stops[i] = colormapStop{at: float64(i) / float64(len(colors)-1), color: rgbColor(c)}
+	}
+	return stops
+}
+
+// Validates a --colormap value
+func parseColormap(value string) (string, error) {
+	if !slices.Contains(colormapNames, value) {
+		return "", msgError("error.invalid_colormap", value)
+	}
+	return value, nil
+}
+
+// Returns the color of every level from 0 to 255 along a colormap
+func colormapTable(stops []colormapStop) *[256]Pixel {
+	var table [256]Pixel
+	lerp := func(a, b byte, t float64) byte {
+		return byte(math.Round(float64(a) + (float64(b)-float64(a))*t))
+	}
+	k := 0
+	for level := range table {
+		at := float64(level) / 255
+		for k < len(stops)-2 && at > stops[k+1].at {
+			k++
+		}
+		from, to := stops[k], stops[k+1]
+		t := (at - from.at) / (to.at - from.at)
+		table[level] = Pixel{
+			Blue:  lerp(from.color.Blue, to.color.Blue, t),
+			Green: lerp(from.color.Green, to.color.Green, t),
+			Red:   lerp(from.color.Red, to.color.Red, t),
+		}
+	}
+	return &table
+}
+
+// Replaces every pixel with the colormap color of the value it holds as single-channel data. Pixels stay in
+// place, so alpha and hints are kept.
+func applyColormap(img *Image, name string, progress rowProgress) *Image {
+	table := colormapTable(colormaps[name])
+	result := &Image{Width: img.Width, Height: img.Height, Pixels: make([]Pixel, len(img.Pixels)), Gap: img.Gap, Palette: img.Palette}
+	for y := 0; y < img.Height; y++ {
+		for i := y * img.Width; i < (y+1)*img.Width; i++ {
+			result.Pixels[i] = table[dataLevel(img.Pixels[i])]
+		}
+		progress.Report(y+1, img.Height)
+	}
+	return result
+}
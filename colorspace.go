@@ -0,0 +1,21 @@
+package main
+
+// Color encodings of the working image: sRGB levels as files store them, or linear-light levels
+var colorSpaces = []string{"srgb", "linear"}
+
+// Returns the color encoding a stage needs its input in, or "" when it works on either
+func stageColorSpace(op *Operation, value string) string {
+	// --colorspace asks for the encoding in its value; the conversion the pipeline inserts is all it does
+	if op.Name == "colorspace" {
+		return value
+	}
+	return op.ColorSpace
+}
+
+// Returns the image re-encoded from the color encoding it is in to the other one
+func convertColorSpace(img *Image, to string, progress rowProgress) *Image {
+	if to == "linear" {
+		return img.ToLinear(progress)
+	}
+	return img.ToSRGB(progress)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Measurements printed by the compare command
+type compareReport struct {
+	Identical bool `json:"identical"`
+	// Pixels that differ in any channel, and their percentage of the image
+	DifferentPixels int     `json:"different_pixels"`
+	Different       float64 `json:"different"`
+	// Mean absolute error of each channel, out of 255; alpha counts as 255 in images without it
+	MAERed   float64 `json:"mae_red"`
+	MAEGreen float64 `json:"mae_green"`
+	MAEBlue  float64 `json:"mae_blue"`
+	MAEAlpha float64 `json:"mae_alpha"`
+	// Peak signal-to-noise ratio in decibels over the color channels, and alpha when either image has it,
+	// or nil for identical images
+	PSNR *float64 `json:"psnr"`
+	// Scores of the perceptual metrics asked for with --metric, by name
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+}
+
+// Settings of the compare command
+type compareConfig struct {
+	format  string // "text" or "json"
+	diff    string // File the visual diff is written to, if set
+	minPSNR int    // PSNR in decibels at or above which differing images still match, 0 to require identical pixels
+	// Perceptual metrics to measure, by name, each with an optional score after ":" that differing images
+	// have to reach to match
+	metrics []string
+	first   string
+	second  string
+}
+
+// Parses the arguments of the compare command
+func parseCompareArgs(args []string) (*compareConfig, error) {
+	cfg := &compareConfig{format: "text"}
+	flags := []flagSpec{
+		{Name: "format", Target: &cfg.format, Choices: []string{"text", "json"}},
+		{Name: "diff", Target: &cfg.diff, Check: nonEmpty},
+		{Name: "min-psnr", Target: &cfg.minPSNR},
+		{Name: "metric", Target: &cfg.metrics, Check: checkMetricFlag},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 2 {
+		return nil, msgError("usage.compare")
+	}
+	cfg.first, cfg.second = positional[0], positional[1]
+	return cfg, nil
+}
+
+// Compares two images pixel by pixel, printing how much they differ and failing when they do not match
+func runCompare(args []string) error {
+	cfg, err := parseCompareArgs(args)
+	if err != nil {
+		return err
+	}
+	bmpHeader, dibHeader, a, err := loadConvertInput(cfg.first, pdfOptions{})
+	if err != nil {
+		return err
+	}
+	_, _, b, err := loadConvertInput(cfg.second, pdfOptions{})
+	if err != nil {
+		return err
+	}
+	if a.Width != b.Width || a.Height != b.Height {
+		return msgError("error.compare_size", a.Width, a.Height, b.Width, b.Height)
+	}
+
+	report := compareImages(a, b)
+	for _, value := range cfg.metrics {
+		name, _, _, _ := parseMetricFlag(value)
+		if _, done := report.Metrics[name]; !done {
+			if report.Metrics == nil {
+				report.Metrics = map[string]float64{}
+			}
+			report.Metrics[name] = qualityMetrics[name].score(a, b)
+		}
+	}
+	if cfg.format == "json" {
+		if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+			return msgError("error.write_output", err)
+		}
+	} else {
+		fmt.Printf("identical: %t\n", report.Identical)
+		fmt.Printf("different_pixels: %d (%.2f%%)\n", report.DifferentPixels, report.Different)
+		fmt.Printf("mae: red %.3f, green %.3f, blue %.3f, alpha %.3f\n", report.MAERed, report.MAEGreen, report.MAEBlue, report.MAEAlpha)
+		if report.PSNR == nil {
+			fmt.Println("psnr: inf")
+		} else {
+			fmt.Printf("psnr: %.2f dB\n", *report.PSNR)
+		}
+		printed := map[string]bool{}
+		for _, value := range cfg.metrics {
+			if name, _, _, _ := parseMetricFlag(value); !printed[name] {
+				fmt.Printf("%s: %.4f\n", name, report.Metrics[name])
+				printed[name] = true
+			}
+		}
+	}
+
+	if cfg.diff != "" {
+		if err := globalSettings.saveOutput(cfg.diff, "", bmpHeader, dibHeader, diffImage(a, b)); err != nil {
+			return err
+		}
+	}
+	if report.Identical {
+		return nil
+	}
+	// Differing images match when they meet every limit given, and there is at least one
+	limited := cfg.minPSNR != 0
+	matches := cfg.minPSNR == 0 || *report.PSNR >= float64(cfg.minPSNR)
+	for _, value := range cfg.metrics {
+		name, threshold, given, _ := parseMetricFlag(value)
+		if !given {
+			continue
+		}
+		limited = true
+		if score := report.Metrics[name]; qualityMetrics[name].higherIsBetter() && score < threshold ||
+			!qualityMetrics[name].higherIsBetter() && score > threshold {
+			matches = false
+		}
+	}
+	if !limited || !matches {
+		return msgError("error.images_differ", report.DifferentPixels)
+	}
+	return nil
+}
+
+// Returns the alpha of pixel i, which is 255 in images without alpha
+func alphaAt(img *Image, i int) byte {
+	if img.Alpha == nil {
+		return 255
+	}
+	return img.Alpha[i]
+}
+
+// Measures the differences between two images of the same size
+func compareImages(a, b *Image) *compareReport {
+	var report compareReport
+	var sum [4]float64
+	var squares float64
+	channels := 3
+	if a.Alpha != nil || b.Alpha != nil {
+		channels = 4
+	}
+	for i, p := range a.Pixels {
+		q := b.Pixels[i]
+		diffs := [4]float64{
+			math.Abs(float64(p.Red) - float64(q.Red)),
+			math.Abs(float64(p.Green) - float64(q.Green)),
+			math.Abs(float64(p.Blue) - float64(q.Blue)),
+			math.Abs(float64(alphaAt(a, i)) - float64(alphaAt(b, i))),
+		}
+		if diffs != [4]float64{} {
+			report.DifferentPixels++
+		}
+		for k, d := range diffs {
+			sum[k] += d
+			if k < channels {
+				squares += d * d
+			}
+		}
+	}
+
+	n := float64(len(a.Pixels))
+	report.Identical = report.DifferentPixels == 0
+	report.Different = float64(report.DifferentPixels) * 100 / n
+	report.MAERed, report.MAEGreen, report.MAEBlue, report.MAEAlpha = sum[0]/n, sum[1]/n, sum[2]/n, sum[3]/n
+	if !report.Identical {
+		psnr := 10 * math.Log10(255*255/(squares/(float64(channels)*n)))
+		report.PSNR = &psnr
+	}
+	return &report
+}
+
+// Returns a diff image: unchanged pixels are a faint gray copy of the first image, so that changes can be
+// placed, and changed pixels are red, brighter the larger the largest difference of any channel
+func diffImage(a, b *Image) *Image {
+	result := &Image{Width: a.Width, Height: a.Height, Pixels: make([]Pixel, len(a.Pixels))}
+	for i, p := range a.Pixels {
+		q := b.Pixels[i]
+		largest := max(
+			absDiff(p.Red, q.Red), absDiff(p.Green, q.Green), absDiff(p.Blue, q.Blue),
+			absDiff(alphaAt(a, i), alphaAt(b, i)),
+		)
+		if largest == 0 {
+			gray := byte(192 + p.Luminance()/1000/4)
+			result.Pixels[i] = Pixel{Blue: gray, Green: gray, Red: gray}
+			continue
+		}
+		result.Pixels[i] = Pixel{Red: byte(128 + int(largest)*127/255)}
+	}
+	return result
+}
+
+// Returns the absolute difference of two levels
+func absDiff(a, b byte) byte {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
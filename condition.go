@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Image properties that --if predicates can test
+var conditionProperties = []string{"width", "height", "pixels"}
+
+// Comparison operators of --if predicates; two-character operators come first so they match before their prefixes
+var conditionOperators = []string{">=", "<=", "==", "!=", ">", "<"}
+
+// Parses an --if predicate of the form <property><operator><number>, e.g. width>2000
+func parseCondition(value string) (property, operator string, n int64, err error) {
+	for _, prop := range conditionProperties {
+		rest, ok := strings.CutPrefix(value, prop)
+		if !ok {
+			continue
+		}
+		for _, op := range conditionOperators {
+			if num, ok := strings.CutPrefix(rest, op); ok {
+				if n, err = strconv.ParseInt(num, 10, 64); err == nil {
+					return prop, op, n, nil
+				}
+			}
+		}
+	}
+	return "", "", 0, msgError("error.invalid_condition", value)
+}
+
+// Reports whether the image satisfies an --if predicate
+func evalCondition(img *Image, value string) (bool, error) {
+	property, operator, n, err := parseCondition(value)
+	if err != nil {
+		return false, err
+	}
+
+	var v int64
+	switch property {
+	case "width":
+		v = int64(img.Width)
+	case "height":
+		v = int64(img.Height)
+	case "pixels":
+		v = int64(img.Width) * int64(img.Height)
+	}
+	switch operator {
+	case ">=":
+		return v >= n, nil
+	case "<=":
+		return v <= n, nil
+	case "==":
+		return v == n, nil
+	case "!=":
+		return v != n, nil
+	case ">":
+		return v > n, nil
+	}
+	return v < n, nil
+}
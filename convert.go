@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"strconv"
+	"time"
+
+	"creditcard/bmp"
+)
+
+// Writes an image file from a BMP, PNG or JPEG file, a page of a PDF file or the text format printed by
+// dump, as BMP unless the output name or --format asks for another format
+func runConvert(args []string) error {
+	var format string
+	var pdf pdfOptions
+	flags := []flagSpec{
+		{Name: "format", Target: &format, Choices: outputFormats},
+		{Name: "page", Target: &pdf.page, Min: 1},
+		{Name: "rasterizer", Target: &pdf.rasterizer, Check: checkRasterizer},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return msgError("usage.convert")
+	}
+
+	bmpHeader, dibHeader, img, err := loadConvertInput(positional[0], pdf)
+	if err != nil {
+		return err
+	}
+	// The encoder fills in every header field the image itself determines
+	return globalSettings.saveOutput(positional[1], format, bmpHeader, dibHeader, img)
+}
+
+// Reads the input of convert, telling the formats apart by their first bytes. BMP files keep their
+// headers, so that fields such as the resolution carry over to BMP output, and PDF pages get the
+// resolution they were read at.
+func loadConvertInput(filename string, pdf pdfOptions) (*BMPHeader, *DIBHeader, *Image, error) {
+	file, err := globalSettings.openInput(filename)
+	if err != nil {
+		return nil, nil, nil, msgError("error.open_file", err)
+	}
+	defer file.Close()
+	magic := make([]byte, 4)
+	n, _ := io.ReadFull(file, magic)
+	magic = magic[:n]
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, nil, msgError("error.open_file", err)
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte("BM")) || bytes.HasPrefix(magic, []byte("BA")):
+		file.Close()
+		return globalSettings.loadImage(filename)
+	case bytes.HasPrefix(magic, []byte("\x89PNG")) || bytes.HasPrefix(magic, []byte("\xff\xd8")):
+		img, err := globalSettings.decodeStandardImage(file, filename)
+		return &BMPHeader{}, &DIBHeader{}, img, err
+	case bytes.HasPrefix(magic, []byte("%PDF")):
+		file.Close()
+		img, resolution, err := globalSettings.loadPDFPage(filename, pdf)
+		dibHeader := &DIBHeader{}
+		setResolution(dibHeader, strconv.FormatFloat(resolution, 'f', -1, 64))
+		return &BMPHeader{}, dibHeader, img, err
+	}
+	img, err := parsePixelText(file, filename)
+	return &BMPHeader{}, &DIBHeader{}, img, err
+}
+
+// Decodes a PNG or JPEG file within the size limits of the settings. Transparency is dropped, so
+// BMP output is 24-bit; partly transparent pixels keep their color darkened by their opacity.
+func (s *ioSettings) decodeStandardImage(file io.ReadSeeker, filename string) (*Image, error) {
+	src, err := s.decodeStandard(file, filename)
+	if err != nil {
+		return nil, err
+	}
+	return bmp.FromImage(src), nil
+}
+
+// Decodes a PNG or JPEG file within the size limits of the settings, keeping every bit it holds
+func (s *ioSettings) decodeStandard(file io.ReadSeeker, filename string) (image.Image, error) {
+	defer metrics.observeStage("decode", time.Now())
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, msgError("error.decode_input", filename, err)
+	}
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, msgError("error.open_file", err)
+	}
+	if err := s.Decode.CheckSize(int64(config.Width), int64(config.Height), size); err != nil {
+		return nil, localizeError(err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, msgError("error.open_file", err)
+	}
+	src, _, err := image.Decode(file)
+	if err != nil {
+		return nil, msgError("error.decode_input", filename, err)
+	}
+	metrics.addBytesRead(size)
+	return src, nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"creditcard/bmp"
+)
+
+// Parses a --convolve value: the kernel weights row by row, separated by commas, optionally followed by
+// :clamp, :wrap or :mirror
+func parseConvolve(value string) (kernel []float64, edge string, err error) {
+	weights, edge, found := strings.Cut(value, ":")
+	if !found {
+		edge = bmp.EdgeModes[0]
+	}
+	for _, w := range strings.Split(weights, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(w), 64)
+		if err != nil {
+			return nil, "", msgError("error.invalid_convolve", value)
+		}
+		kernel = append(kernel, v)
+	}
+	if (len(kernel) != 9 && len(kernel) != 25) || !contains(bmp.EdgeModes, edge) {
+		return nil, "", msgError("error.invalid_convolve", value)
+	}
+	return kernel, edge, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"time"
+
+	"creditcard/bmp"
+)
+
+// Steps a goroutine runs per second in the estimates, a step being about one tap of a kernel on one pixel,
+// as measured on a common x86-64 core
+const costStepsPerSecond = 3e8
+
+// Steps of a pass over a pixel that looks at no neighbors, such as a per-pixel filter makes
+const costPassSteps = 8
+
+// Limits of the estimates above which apply warns, unless --warn-memory and --warn-time set others
+const (
+	defaultWarnMemory = "2G"
+	defaultWarnTime   = time.Minute
+)
+
+// What a stage of apply costs on an image
+type stageCost struct {
+	width, height int     // Size of the result
+	extra         int64   // Bytes the stage holds besides its input and result, at its peak
+	steps         float64 // Steps of work, see costStepsPerSecond
+}
+
+// Returns the cost of a stage that makes a result of the given size with steps and extra bytes per pixel of
+// the result
+func passCost(width, height int, steps float64, extra int64) stageCost {
+	pixels := int64(width) * int64(height)
+	return stageCost{width: width, height: height, extra: pixels * extra, steps: float64(pixels) * steps}
+}
+
+// Estimates the memory apply holds at its peak and the time it takes for the options on an image of the
+// given size, with or without alpha. Sizes follow the stages that know their result, and other stages
+// are taken for a pass over the pixels that keeps the size.
+func estimateApply(options []Option, width, height int, alpha bool) (bytes int64, elapsed time.Duration) {
+	pixelBytes := int64(3)
+	if alpha {
+		pixelBytes++
+	}
+	image := func(width, height int) int64 { return int64(width) * int64(height) * pixelBytes }
+	bytes = image(width, height)
+	steps := 0.0
+	for _, opt := range options {
+		cost := passCost(width, height, costPassSteps, 0)
+		if op, ok := findOperation(opt.Name); ok && op.Cost != nil {
+			cost = op.Cost(opt.Value, width, height)
+		}
+		// The input is held until the result is done
+		bytes = max(bytes, image(width, height)+cost.extra+image(cost.width, cost.height))
+		steps += cost.steps
+		width, height = cost.width, cost.height
+	}
+	jobs := bmp.Jobs
+	if jobs <= 0 {
+		jobs = runtime.GOMAXPROCS(0)
+	}
+	return bytes, time.Duration(steps / costStepsPerSecond / float64(jobs) * float64(time.Second))
+}
+
+// Returns a number of bytes rounded in the units --max-memory takes, such as 1.5G
+func formatByteSize(bytes int64) string {
+	size, unit := float64(bytes), ""
+	for _, next := range []string{"K", "M", "G"} {
+		if size < 1024 {
+			break
+		}
+		size, unit = size/1024, next
+	}
+	if unit == "" {
+		return fmt.Sprint(bytes)
+	}
+	return fmt.Sprintf("%.3g%s", size, unit)
+}
+
+// Warns, before apply reads the pixels, when the estimates for the options exceed --warn-memory or
+// --warn-time, pointing to --stream or --max-memory when either can run the options instead, as runs
+// that exhaust the memory of a shared machine take others down with them
+func warnExpensiveApply(cmd *commandArgs, dibHeader *DIBHeader) {
+	width, height := int(dibHeader.Width), int(dibHeader.Height)
+	if height < 0 {
+		height = -height
+	}
+	bytes, elapsed := estimateApply(cmd.options, width, height, dibHeader.BitCount == 32)
+	logDetail("info.estimate", formatByteSize(bytes), elapsed.Round(time.Millisecond))
+
+	limit, _ := parseByteSize(cmd.warnMemory)
+	overMemory, overTime := bytes > limit, elapsed > cmd.warnTime
+	if overMemory {
+		printWarning(msgError("warning.estimate_memory", formatByteSize(bytes), width, height, cmd.warnMemory))
+	}
+	if overTime {
+		printWarning(msgError("warning.estimate_time", elapsed.Round(time.Second), width, height, cmd.warnTime))
+	}
+	if !overMemory || checkStreamOutput(cmd) != nil {
+		return
+	}
+	if _, _, _, err := streamStages(cmd.options, width, height); err == nil && bmp.ReadsRows(dibHeader) {
+		printWarning(msgError("warning.estimate_stream"))
+	} else if _, err := tilePipeline(cmd.options, width, height); err == nil {
+		printWarning(msgError("warning.estimate_tiles", cmd.warnMemory))
+	}
+}
+
+// Returns the cost of --rotate: quarter turns move every pixel once, and other angles resample onto a
+// canvas enlarged to hold the turned image
+func rotateCost(value string, width, height int) stageCost {
+	angle, err := parseRotate(value)
+	switch {
+	case err != nil:
+		return passCost(width, height, costPassSteps, 0)
+	case math.Mod(angle, 180) == 0:
+		return passCost(width, height, 2, 0)
+	case math.Mod(angle, 90) == 0:
+		return passCost(height, width, 2, 0)
+	}
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+	sin, cos = math.Abs(sin), math.Abs(cos)
+	w := int(math.Ceil(float64(width)*cos + float64(height)*sin))
+	h := int(math.Ceil(float64(width)*sin + float64(height)*cos))
+	return passCost(w, h, 30, 0)
+}
+
+// Returns the cost of resampling an image to a size, which holds a row of floats per pixel of the result
+func resampleCost(width, height int, algorithm string) stageCost {
+	if algorithm == "nearest" {
+		return passCost(width, height, 2, 0)
+	}
+	return passCost(width, height, 16, 16)
+}
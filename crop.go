@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+)
+
+// Anchors --crop can place the crop area at instead of offsets, longest first so that prefixes such as
+// "top" do not hide "top-left"
+var cropAnchors = []string{"top-left", "top-right", "bottom-left", "bottom-right", "center", "bottom", "right", "left", "top"}
+
+// One number of a --crop value
+type cropNumber struct {
+	length   geometryLength
+	negative bool // Offset counted back from the right or bottom edge
+}
+
+// Resolves the number to pixels along a side of the given length
+func (n cropNumber) pixels(side int) int {
+	v := n.length.pixels(side)
+	if n.negative {
+		v = side - v
+	}
+	return v
+}
+
+// Splits a --crop value into its anchor, if any, and numbers, each a length as parseLength reads it. The
+// size may also be given as one WxH part, as in center-800x600. A minus sign in front of an offset shows
+// as an empty part before it, so "-40--30" holds the offsets -40 and -30.
+func parseCropNumbers(value string) (anchor string, nums []cropNumber, err error) {
+	rest := value
+	for _, a := range cropAnchors {
+		if after, ok := strings.CutPrefix(value, a+"-"); ok {
+			anchor, rest = a, after
+			break
+		}
+	}
+
+	parts := strings.Split(rest, "-")
+	negative := false
+	for i, part := range parts {
+		if part == "" && anchor == "" && len(nums) < 2 && !negative && i+1 < len(parts) {
+			negative = true
+			continue
+		}
+		if strings.ContainsAny(part, sizeSeparators) && !negative {
+			w, h, ok := parseGeometry(part)
+			if !ok || (w.percent && w.value > 100) || (h.percent && h.value > 100) {
+				return "", nil, msgError("error.invalid_crop_val", part)
+			}
+			nums = append(nums, cropNumber{length: w}, cropNumber{length: h})
+			continue
+		}
+		n, ok := parseLength(part)
+		if !ok || (n.percent && n.value > 100) {
+			return "", nil, msgError("error.invalid_crop_val", part)
+		}
+		nums = append(nums, cropNumber{length: n, negative: negative})
+		negative = false
+	}
+	if (anchor == "" && len(nums) != 2 && len(nums) != 4) || (anchor != "" && len(nums) != 2) {
+		return "", nil, msgError("error.invalid_crop", value)
+	}
+	return anchor, nums, nil
+}
+
+// Parses a --crop value of the form offsetX-offsetY[-width-height] or anchor-width-height for an image
+// of the given size. Every number may be a percentage of the image side, and offsets may be negative to
+// count back from the right or bottom edge.
+func parseCrop(value string, width, height int) (x, y, w, h int, err error) {
+	anchor, nums, err := parseCropNumbers(value)
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+
+	if anchor != "" {
+		w, h = nums[0].pixels(width), nums[1].pixels(height)
+		x, y = (width-w)/2, (height-h)/2
+		if strings.Contains(anchor, "left") {
+			x = 0
+		} else if strings.Contains(anchor, "right") {
+			x = width - w
+		}
+		if strings.HasPrefix(anchor, "top") {
+			y = 0
+		} else if strings.HasPrefix(anchor, "bottom") {
+			y = height - h
+		}
+	} else {
+		x, y = nums[0].pixels(width), nums[1].pixels(height)
+		w, h = width-x, height-y
+		if len(nums) == 4 {
+			w, h = nums[2].pixels(width), nums[3].pixels(height)
+		}
+	}
+
+	if w <= 0 || h <= 0 || x < 0 || y < 0 || x+w > width || y+h > height {
+		return 0, 0, 0, 0, msgError("error.crop_bounds", value, w, h, x, y, width, height)
+	}
+	return x, y, w, h, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// An encrypted container starts with this magic, followed by a version byte, the PBKDF2 iteration count as
+// a big-endian uint32, a 16-byte salt and a 12-byte nonce. The rest is the output sealed with AES-256-GCM
+// under the key PBKDF2-HMAC-SHA256 derives from the passphrase, with those header bytes as additional
+// data, so that neither the contents nor the parameters can be changed without the tag failing.
+const (
+	cryptMagic      = "BMPCRYPT"
+	cryptVersion    = 1
+	cryptIterations = 600000
+	cryptSaltSize   = 16
+	cryptHeaderSize = len(cryptMagic) + 1 + 4 + cryptSaltSize + 12
+	// Most iterations a container may ask for, so that a crafted header cannot keep the key derivation
+	// running for minutes
+	maxCryptIterations = 4 * cryptIterations
+	// Keys of the containers opened last kept by decryptContainer, so that opening a source again, as
+	// decoding does for the headers and the pixels, does not derive its key again
+	maxCryptKeys = 64
+)
+
+// Keys derived for opening containers, keyed by a hash of the passphrase, salt and iteration count
+var cryptKeys struct {
+	sync.Mutex
+	keys map[[sha256.Size]byte][]byte
+}
+
+// Reports whether data starts like an encrypted container
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(cryptMagic))
+}
+
+// Derives a key of keyLen bytes from a passphrase with PBKDF2-HMAC-SHA256 (RFC 8018)
+func deriveKey(passphrase string, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, []byte(passphrase))
+	var key []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		u := prf.Sum(nil)
+		t := bytes.Clone(u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+// Returns the key of a container, derived by deriveKey unless one of the last maxCryptKeys containers
+// opened had the same passphrase, salt and iteration count
+func containerKey(passphrase string, salt []byte, iterations int) []byte {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\x00%x\x00%s", iterations, salt, passphrase)
+	var id [sha256.Size]byte
+	h.Sum(id[:0])
+
+	cryptKeys.Lock()
+	key, ok := cryptKeys.keys[id]
+	cryptKeys.Unlock()
+	if ok {
+		return key
+	}
+	key = deriveKey(passphrase, salt, iterations, 32)
+	cryptKeys.Lock()
+	if len(cryptKeys.keys) >= maxCryptKeys || cryptKeys.keys == nil {
+		cryptKeys.keys = make(map[[sha256.Size]byte][]byte)
+	}
+	cryptKeys.keys[id] = key
+	cryptKeys.Unlock()
+	return key
+}
+
+// Returns the AES-256-GCM cipher of a key
+func newCryptCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Wraps data in an encrypted container with a fresh salt and nonce, so that encrypting the same output
+// twice gives different containers
+func encryptContainer(data []byte, passphrase string) ([]byte, error) {
+	header := make([]byte, cryptHeaderSize)
+	copy(header, cryptMagic)
+	header[len(cryptMagic)] = cryptVersion
+	binary.BigEndian.PutUint32(header[len(cryptMagic)+1:], cryptIterations)
+	salt := header[len(cryptMagic)+5 : len(cryptMagic)+5+cryptSaltSize]
+	nonce := header[len(cryptMagic)+5+cryptSaltSize:]
+	if _, err := rand.Read(header[len(cryptMagic)+5:]); err != nil {
+		return nil, err
+	}
+	aead, err := newCryptCipher(deriveKey(passphrase, salt, cryptIterations, 32))
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(header, nonce, data, header), nil
+}
+
+// Opens an encrypted container, failing when the passphrase is wrong or the container was altered
+func decryptContainer(data []byte, passphrase string) ([]byte, error) {
+	if len(data) < cryptHeaderSize || !isEncrypted(data) || data[len(cryptMagic)] != cryptVersion {
+		return nil, msgError("error.encrypted_format")
+	}
+	header := data[:cryptHeaderSize]
+	iterations := binary.BigEndian.Uint32(header[len(cryptMagic)+1:])
+	if iterations == 0 {
+		return nil, msgError("error.encrypted_format")
+	}
+	if iterations > maxCryptIterations {
+		return nil, msgError("error.encrypted_iterations", iterations, maxCryptIterations)
+	}
+	salt := header[len(cryptMagic)+5 : len(cryptMagic)+5+cryptSaltSize]
+	nonce := header[len(cryptMagic)+5+cryptSaltSize:]
+	aead, err := newCryptCipher(containerKey(passphrase, salt, int(iterations)))
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, nonce, data[cryptHeaderSize:], header)
+	if err != nil {
+		return nil, msgError("error.decrypt")
+	}
+	return plain, nil
+}
+
+// An output written through --encrypt: the bytes are held until it is closed, then sealed and written.
+// Closing it again does nothing, as closing a file twice writes nothing more.
+type encryptingWriter struct {
+	bytes.Buffer
+	out        io.WriteCloser
+	passphrase string
+	closed     bool
+}
+
+func (w *encryptingWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	sealed, err := encryptContainer(w.Bytes(), w.passphrase)
+	if err != nil {
+		w.out.Close()
+		return err
+	}
+	if _, err := w.out.Write(sealed); err != nil {
+		w.out.Close()
+		return err
+	}
+	return w.out.Close()
+}
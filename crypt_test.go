@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A container opens with its passphrase only, and one asking for more iterations than allowed is refused
+// before any key is derived
+func TestDecryptContainer(t *testing.T) {
+	sealed, err := encryptContainer([]byte("pixels"), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := decryptContainer(sealed, "secret"); err != nil || string(plain) != "pixels" {
+		t.Fatalf("opened %q, %v", plain, err)
+	}
+	if _, err := decryptContainer(sealed, "wrong"); err == nil {
+		t.Error("opened a container with a wrong passphrase")
+	}
+
+	for _, iterations := range []uint32{0, maxCryptIterations + 1, 100 * cryptIterations} {
+		crafted := append([]byte(nil), sealed...)
+		binary.BigEndian.PutUint32(crafted[len(cryptMagic)+1:], iterations)
+		if _, err := decryptContainer(crafted, "secret"); err == nil {
+			t.Errorf("opened a container of %d iterations", iterations)
+		}
+	}
+}
+
+// The plaintext of an encrypted source is kept while a reader of it is open and dropped when the last one
+// is closed
+func TestDecryptedSourceDropped(t *testing.T) {
+	sealed, err := encryptContainer([]byte("pixels"), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "sealed.bmp")
+	if err := os.WriteFile(name, sealed, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	settings := &ioSettings{Decrypt: "secret"}
+
+	held := func() bool {
+		buffered.Lock()
+		defer buffered.Unlock()
+		_, ok := buffered.decrypted[name+"\x00secret"]
+		return ok
+	}
+	first, err := settings.openInput(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := settings.openInput(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(second); string(data) != "pixels" {
+		t.Errorf("read %q", data)
+	}
+	first.Close()
+	first.Close()
+	if !held() {
+		t.Error("dropped the plaintext while a reader was open")
+	}
+	second.Close()
+	if held() {
+		t.Error("kept the plaintext after every reader was closed")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+// Most cells --crystallize accepts; images with fewer pixels get no more sites than they have pixels
+const maxCrystalCells = 1 << 20
+
+// Parses a --crystallize value of the form cells[:seed]
+func parseCrystallize(value string) (cells int, seed uint64, err error) {
+	c, s, found := strings.Cut(value, ":")
+	cells, err = strconv.Atoi(c)
+	seed = defaultShiftSeed
+	if err == nil && found {
+		seed, err = strconv.ParseUint(s, 10, 64)
+	}
+	if err != nil || cells < 1 || cells > maxCrystalCells {
+		return 0, 0, msgError("error.invalid_crystallize", value, maxCrystalCells)
+	}
+	return cells, seed, nil
+}
+
+// Sites of Voronoi cells bucketed in a grid of square buckets, each holding about one site, so that the
+// nearest site to a point is found by looking at the buckets around it rather than at every site
+type siteGrid struct {
+	x, y       []float64 // Site positions from the top-left corner
+	side       float64   // Side of a bucket in pixels
+	cols, rows int
+	starts     []int // Sites of bucket b are order[starts[b]:starts[b+1]]
+	order      []int
+}
+
+// Buckets the sites of an image of the given size
+func newSiteGrid(x, y []float64, width, height int) *siteGrid {
+	side := max(math.Sqrt(float64(width)*float64(height)/float64(len(x))), 1)
+	g := &siteGrid{x: x, y: y, side: side, cols: int(math.Ceil(float64(width) / side)), rows: int(math.Ceil(float64(height) / side))}
+	g.starts = make([]int, g.cols*g.rows+1)
+	buckets := make([]int, len(x))
+	for i := range x {
+		buckets[i] = g.bucket(x[i], y[i])
+		g.starts[buckets[i]+1]++
+	}
+	for b := 1; b < len(g.starts); b++ {
+		g.starts[b] += g.starts[b-1]
+	}
+	g.order = make([]int, len(x))
+	next := append([]int(nil), g.starts[:len(g.starts)-1]...)
+	for i, b := range buckets {
+		g.order[next[b]] = i
+		next[b]++
+	}
+	return g
+}
+
+// Returns the bucket a point falls in
+func (g *siteGrid) bucket(x, y float64) int {
+	return min(int(y/g.side), g.rows-1)*g.cols + min(int(x/g.side), g.cols-1)
+}
+
+// Returns the site nearest to a point. Buckets are searched in growing square rings around the point's
+// own; once the nearest site so far is closer than any bucket of the next ring can be, the search stops.
+func (g *siteGrid) nearest(x, y float64) int {
+	bx, by := min(int(x/g.side), g.cols-1), min(int(y/g.side), g.rows-1)
+	best, bestDist := -1, math.Inf(1)
+	for r := 0; r <= max(g.cols, g.rows); r++ {
+		for j := by - r; j <= by+r; j++ {
+			if j < 0 || j >= g.rows {
+				continue
+			}
+			for i := bx - r; i <= bx+r; i++ {
+				// Inner buckets were searched in earlier rings
+				if i < 0 || i >= g.cols || (j != by-r && j != by+r && i != bx-r && i != bx+r) {
+					continue
+				}
+				b := j*g.cols + i
+				for _, s := range g.order[g.starts[b]:g.starts[b+1]] {
+					dx, dy := g.x[s]-x, g.y[s]-y
+					if d := dx*dx + dy*dy; d < bestDist {
+						best, bestDist = s, d
+					}
+				}
+			}
+		}
+		if reach := float64(r) * g.side; best >= 0 && bestDist <= reach*reach {
+			break
+		}
+	}
+	return best
+}
+
+// Partitions the image into Voronoi cells around randomly placed sites and paints every cell with the
+// average color of its pixels, and their average alpha in images with alpha. The sites come from a
+// generator seeded by seed, so the same seed always gives the same cells.
+func applyCrystallize(img *Image, cells int, seed uint64, progress rowProgress) *Image {
+	cells = min(cells, img.Width*img.Height)
+	random := rand.New(rand.NewPCG(seed, seed))
+	x, y := make([]float64, cells), make([]float64, cells)
+	for i := range x {
+		x[i], y[i] = random.Float64()*float64(img.Width), random.Float64()*float64(img.Height)
+	}
+	grid := newSiteGrid(x, y, img.Width, img.Height)
+
+	// Labels every pixel with its cell, measuring at pixel centers and counting rows from the top
+	labels := make([]int, len(img.Pixels))
+	sums := make([][5]int, cells)
+	for row := 0; row < img.Height; row++ {
+		for col := 0; col < img.Width; col++ {
+			i := (img.Height-1-row)*img.Width + col
+			cell := grid.nearest(float64(col)+0.5, float64(row)+0.5)
+			labels[i] = cell
+			p := img.Pixels[i]
+			sums[cell][0] += int(p.Blue)
+			sums[cell][1] += int(p.Green)
+			sums[cell][2] += int(p.Red)
+			sums[cell][3] += int(alphaAt(img, i))
+			sums[cell][4]++
+		}
+		progress.Report(row+1, img.Height)
+	}
+
+	result := &Image{Width: img.Width, Height: img.Height, Pixels: make([]Pixel, len(img.Pixels)), Gap: img.Gap, Palette: img.Palette}
+	if img.Alpha != nil {
+		result.Alpha = make([]byte, len(img.Alpha))
+	}
+	for i, cell := range labels {
+		s := sums[cell]
+		n := s[4]
+		result.Pixels[i] = Pixel{Blue: byte((s[0] + n/2) / n), Green: byte((s[1] + n/2) / n), Red: byte((s[2] + n/2) / n)}
+		if result.Alpha != nil {
+			result.Alpha[i] = byte((s[3] + n/2) / n)
+		}
+	}
+	return result
+}
@@ -0,0 +1,165 @@
+//go:build cshared
+
+package main
+
+/*
+#include <stdint.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// C interface of the engine, built with:
+//
+//	go build -tags cshared -buildmode=c-shared -o libbitmap.so .
+//
+// Images are opaque handles owned by the library and released with bitmap_release.
+// Functions report failure by returning 0 (handles) or -1 (status codes) and, when err
+// is not NULL, storing a message in *err. Messages and encoded buffers are allocated
+// with malloc and freed with bitmap_free.
+
+// Version of the C interface, raised only on incompatible changes
+const abiVersion = 1
+
+// Images behind the live handles. Handles are looked up rather than turned back into pointers, so that a
+// released or made-up handle is reported as an error instead of crashing the host process.
+var (
+	handlesMu  sync.Mutex
+	handles    = map[C.uintptr_t]*loadedImage{}
+	lastHandle C.uintptr_t
+)
+
+// Returns a new handle of an image
+func newHandle(img *loadedImage) C.uintptr_t {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	lastHandle++
+	handles[lastHandle] = img
+	return lastHandle
+}
+
+// int bitmap_abi_version(void)
+//
+//export bitmap_abi_version
+func bitmap_abi_version() C.int {
+	return abiVersion
+}
+
+// uintptr_t bitmap_decode(const uint8_t *data, size_t len, char **err)
+//
+//export bitmap_decode
+func bitmap_decode(data *C.uint8_t, length C.size_t, errOut **C.char) C.uintptr_t {
+	// The decoder copies the pixels, so the caller's buffer is read in place
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(data)), int(length))
+	bmpHeader, dibHeader, img, err := globalSettings.decodeImage(bytes.NewReader(buf))
+	if err != nil {
+		setError(errOut, err)
+		return 0
+	}
+	return newHandle(&loadedImage{bmpHeader, dibHeader, img})
+}
+
+// uintptr_t bitmap_apply_json(uintptr_t image, const char *ops, char **err)
+//
+// ops is a JSON array such as [{"name": "rotate", "value": "right"}]. The result is a new
+// handle; the input image is left unchanged.
+//
+//export bitmap_apply_json
+func bitmap_apply_json(handle C.uintptr_t, ops *C.char, errOut **C.char) C.uintptr_t {
+	src, err := lookupImage(handle)
+	if err != nil {
+		setError(errOut, err)
+		return 0
+	}
+
+	var options []Option
+	if err := json.Unmarshal([]byte(C.GoString(ops)), &options); err != nil {
+		setError(errOut, msgError("error.invalid_ops_json", err))
+		return 0
+	}
+	for i := range options {
+		options[i].Name = "--" + strings.TrimPrefix(options[i].Name, "--")
+	}
+
+	img, err := applyOptions(src.img, options)
+	if err != nil {
+		setError(errOut, err)
+		return 0
+	}
+	return newHandle(&loadedImage{src.bmpHeader, src.dibHeader, img})
+}
+
+// int bitmap_encode(uintptr_t image, uint8_t **out, size_t *out_len, char **err)
+//
+//export bitmap_encode
+func bitmap_encode(handle C.uintptr_t, out **C.uint8_t, outLen *C.size_t, errOut **C.char) C.int {
+	src, err := lookupImage(handle)
+	if err != nil {
+		setError(errOut, err)
+		return -1
+	}
+
+	var buf bytes.Buffer
+	if err := globalSettings.encodeImage(&buf, src.bmpHeader, src.dibHeader, src.img); err != nil {
+		setError(errOut, err)
+		return -1
+	}
+	*out = (*C.uint8_t)(C.CBytes(buf.Bytes()))
+	*outLen = C.size_t(buf.Len())
+	return 0
+}
+
+// int bitmap_dimensions(uintptr_t image, int *width, int *height)
+//
+//export bitmap_dimensions
+func bitmap_dimensions(handle C.uintptr_t, width, height *C.int) C.int {
+	src, err := lookupImage(handle)
+	if err != nil {
+		return -1
+	}
+	*width, *height = C.int(src.img.Width), C.int(src.img.Height)
+	return 0
+}
+
+// void bitmap_release(uintptr_t image)
+//
+// Releasing 0 or a handle that was already released does nothing.
+//
+//export bitmap_release
+func bitmap_release(handle C.uintptr_t) {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	delete(handles, handle)
+}
+
+// void bitmap_free(void *ptr)
+//
+//export bitmap_free
+func bitmap_free(ptr unsafe.Pointer) {
+	C.free(ptr)
+}
+
+// Returns the image behind a live handle
+func lookupImage(handle C.uintptr_t) (*loadedImage, error) {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	img, ok := handles[handle]
+	if !ok {
+		return nil, msgError("error.invalid_handle")
+	}
+	return img, nil
+}
+
+// Stores the error message in *errOut when the caller asked for it
+func setError(errOut **C.char, err error) {
+	if errOut != nil {
+		*errOut = C.CString(err.Error())
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"strconv"
+	"strings"
+)
+
+// Settings of the cycle command
+type cycleConfig struct {
+	colors string // Color table entries that rotate, as first-last
+	fps    int
+	input  string
+	output string
+}
+
+// Parses a --range value of the form first-last with 0 <= first < last <= 255
+func parseColorRange(value string) (first, last int, ok bool) {
+	a, b, found := strings.Cut(value, "-")
+	first, errA := strconv.Atoi(a)
+	last, errB := strconv.Atoi(b)
+	if !found || errA != nil || errB != nil || first < 0 || first >= last || last > 255 {
+		return 0, 0, false
+	}
+	return first, last, true
+}
+
+// Validates a --range value
+func checkColorRange(value string) error {
+	if _, _, ok := parseColorRange(value); !ok {
+		return msgError("expect.color_range")
+	}
+	return nil
+}
+
+// Parses the arguments of the cycle command
+func parseCycleArgs(args []string) (*cycleConfig, error) {
+	cfg := &cycleConfig{fps: 10}
+	flags := []flagSpec{
+		{Name: "range", Target: &cfg.colors, Check: checkColorRange},
+		{Name: "fps", Target: &cfg.fps, Min: 1},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 2 {
+		return nil, msgError("usage.cycle")
+	}
+	cfg.input, cfg.output = positional[0], positional[1]
+	return cfg, nil
+}
+
+// Writes an animated GIF of an indexed image whose color table entries in the range rotate by one
+// position per frame, as palette-cycling animations of old games and demos did. The animation
+// covers one full turn and loops.
+func runCycle(args []string) error {
+	cfg, err := parseCycleArgs(args)
+	if err != nil {
+		return err
+	}
+	_, _, img, err := globalSettings.loadImage(cfg.input)
+	if err != nil {
+		return err
+	}
+	if img.Indices == nil {
+		return msgError("error.not_indexed", cfg.input)
+	}
+	first, last := 0, len(img.Palette)-1
+	if cfg.colors != "" {
+		first, last, _ = parseColorRange(cfg.colors)
+	}
+	if last >= len(img.Palette) || first >= last {
+		return msgError("error.cycle_range", first, last, len(img.Palette))
+	}
+
+	// Indices past the end of the color table are shown black, as the decoder does
+	palette := make(color.Palette, 256)
+	for i := range palette {
+		palette[i] = color.Black
+	}
+	frame := image.NewPaletted(image.Rect(0, 0, img.Width, img.Height), nil)
+	for y := 0; y < img.Height; y++ {
+		// Rows are stored bottom-up
+		copy(frame.Pix[(img.Height-1-y)*frame.Stride:], img.Indices[y*img.Width:(y+1)*img.Width])
+	}
+
+	n := last - first + 1
+	delay := max(100/cfg.fps, 1)
+	anim := &gif.GIF{}
+	for step := 0; step < n; step++ {
+		frames := make(color.Palette, len(palette))
+		copy(frames, palette)
+		for i, p := range img.Palette {
+			if i >= first && i <= last {
+				// Each color moves up one entry per frame and wraps around at the end of the range
+				p = img.Palette[first+((i-first-step)%n+n)%n]
+			}
+			frames[i] = color.RGBA{R: p.Red, G: p.Green, B: p.Blue, A: 255}
+		}
+		anim.Image = append(anim.Image, &image.Paletted{Pix: frame.Pix, Stride: frame.Stride, Rect: frame.Rect, Palette: frames})
+		anim.Delay = append(anim.Delay, delay)
+	}
+
+	file, err := files.Create(cfg.output)
+	if err != nil {
+		return msgError("error.create_file", err)
+	}
+	defer file.Close()
+	if err := gif.EncodeAll(file, anim); err != nil {
+		return msgError("error.write_output", err)
+	}
+	return file.Close()
+}
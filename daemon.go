@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+// Largest frame accepted by the daemon protocol
+const maxFrameSize = 1 << 20
+
+// Request frame: header or apply arguments as given on the command line, with absolute file paths, and
+// the global flags of the client that the daemon has to follow
+type daemonRequest struct {
+	Args     []string    `json:"args"`
+	Settings *ioSettings `json:"settings,omitempty"` // Read and write settings the request runs with
+	Stages   []string    `json:"stages,omitempty"`   // Global flags that change what the stages do
+}
+
+// Response frame: what the command printed, or why it failed and the exit status it fails with
+type daemonResponse struct {
+	Output   string `json:"output,omitempty"`
+	Error    string `json:"error,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"`
+}
+
+// Returns the response to a request that failed
+func failedResponse(err error) *daemonResponse {
+	return &daemonResponse{Error: err.Error(), ExitCode: exitCode(err)}
+}
+
+// Error a daemon answered a request with, which the client exits with the status of
+type daemonError struct {
+	message string
+	code    int
+}
+
+func (e *daemonError) Error() string {
+	return e.message
+}
+
+// Returns the socket used when --socket is not given
+func defaultSocketPath() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, fmt.Sprintf("bitmap-%d.sock", os.Getuid()))
+}
+
+// Parses leading --socket=<path> arguments, returning the socket and the remaining arguments
+func parseSocketArg(args []string) (string, []string) {
+	socket := defaultSocketPath()
+	for len(args) > 0 && strings.HasPrefix(args[0], "--socket=") {
+		socket = strings.TrimPrefix(args[0], "--socket=")
+		args = args[1:]
+	}
+	return socket, args
+}
+
+// Serves header and apply requests on a Unix socket until interrupted. With --root, the files requests
+// name have to stay in that directory, as with rpc.
+func runDaemon(args []string) error {
+	socket := defaultSocketPath()
+	var rootDir string
+	var followSymlinks bool
+	flags := []flagSpec{
+		{Name: "socket", Target: &socket, Check: nonEmpty},
+		{Name: "root", Target: &rootDir, Check: nonEmpty},
+		{Name: "follow-symlinks", Target: &followSymlinks},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return msgError("usage.daemon")
+	}
+	var root *pathRoot
+	if rootDir != "" {
+		if root, err = newPathRoot(rootDir, followSymlinks); err != nil {
+			return err
+		}
+	}
+
+	// A socket file left behind by a crashed daemon is replaced, a live one is not
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		return msgError("error.daemon_running", socket)
+	}
+	os.Remove(socket)
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return msgError("error.start_server", err)
+	}
+	defer listener.Close()
+	lockFiles = true
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		listener.Close()
+	}()
+
+	logInfo("info.daemon_listening", socket)
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return msgError("error.start_server", err)
+		}
+		go serveDaemonConn(conn, root)
+	}
+}
+
+// Answers requests on one connection until the client closes it
+func serveDaemonConn(conn net.Conn, root *pathRoot) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		var req daemonRequest
+		if err := readFrame(r, &req); err != nil {
+			if err != io.EOF {
+				writeFrame(conn, failedResponse(err))
+			}
+			return
+		}
+		if err := writeFrame(conn, executeDaemonRequest(&req, root)); err != nil {
+			return
+		}
+	}
+}
+
+// Runs a header or apply request the same way the command line does, confined to root unless it is nil.
+// The request is read and written with its own settings; the flags its stages follow are globals of the
+// daemon, so a request made with other ones is refused rather than run differently.
+func executeDaemonRequest(req *daemonRequest, root *pathRoot) *daemonResponse {
+	if stages := stageFlags(); !slices.Equal(req.Stages, stages) {
+		return failedResponse(msgError("error.daemon_stage_flags", strings.Join(req.Stages, " "), strings.Join(stages, " ")))
+	}
+	cmd, err := parseArgs(req.Args)
+	if err == nil && req.Settings != nil {
+		cmd.settings = req.Settings
+	}
+	if err == nil && root != nil {
+		err = confineDaemonRequest(cmd, root)
+	}
+	if err != nil {
+		return failedResponse(err)
+	}
+
+	switch cmd.command {
+	case "header":
+		bmpHeader, dibHeader, err := cmd.settings.readHeaders(cmd.filename)
+		if err != nil {
+			return failedResponse(err)
+		}
+		entries, err := cmd.settings.readArray(cmd.filename)
+		if err != nil {
+			return failedResponse(err)
+		}
+		profile, err := cmd.settings.readProfile(cmd.filename, dibHeader)
+		if err != nil {
+			return failedResponse(err)
+		}
+		var out strings.Builder
+		if err := writeHeaders(&out, cmd.format, bmpHeader, dibHeader, profile, entries); err != nil {
+			return failedResponse(err)
+		}
+		return &daemonResponse{Output: out.String()}
+	default:
+		if err := runApply(cmd); err != nil {
+			return failedResponse(err)
+		}
+		return &daemonResponse{}
+	}
+}
+
+// Replaces every file a request names with its path in the root, refusing those that leave it. Options
+// that read files, --rasterizer and --post-hook, which run commands, are refused, as none can be confined.
+func confineDaemonRequest(cmd *commandArgs, root *pathRoot) error {
+	for _, opt := range cmd.options {
+		if op, ok := findOperation(opt.Name); ok && readsFiles(op) {
+			return msgError("error.rpc_file_option", op.Name)
+		}
+	}
+	if cmd.rasterizer != "" {
+		return msgError("error.root_command", "rasterizer")
+	}
+	if cmd.settings.PostHook != "" {
+		return msgError("error.root_command", "post-hook")
+	}
+	names := []*string{&cmd.filename, &cmd.saveStages, &cmd.record, &cmd.provenance, &cmd.checkpoint, &cmd.cacheDir}
+	for i := range cmd.outputs {
+		names = append(names, &cmd.outputs[i].Filename)
+	}
+	for _, name := range names {
+		if *name == "" {
+			continue
+		}
+		path, err := root.resolve(*name)
+		if err != nil {
+			return err
+		}
+		*name = path
+	}
+	return nil
+}
+
+// Sends a header or apply command to a running daemon and prints its output
+func runClient(args []string) error {
+	socket, rest := parseSocketArg(args)
+	cmd, err := parseArgs(rest)
+	if err != nil {
+		return err
+	}
+
+	req, err := newDaemonRequest(cmd)
+	if err != nil {
+		return err
+	}
+	for _, output := range cmd.outputs {
+		if output.Filename, err = filepath.Abs(output.Filename); err != nil {
+			return msgError("error.open_file", err)
+		}
+		req.Args = append(req.Args, "--output="+output.String())
+	}
+	abs, err := filepath.Abs(cmd.filename)
+	if err != nil {
+		return msgError("error.open_file", err)
+	}
+	req.Args = append(req.Args, "--", abs)
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return msgError("error.connect_daemon", socket, err)
+	}
+	defer conn.Close()
+
+	if err := writeFrame(conn, req); err != nil {
+		return err
+	}
+	var resp daemonResponse
+	if err := readFrame(bufio.NewReader(conn), &resp); err != nil {
+		return err
+	}
+	fmt.Print(resp.Output)
+	if resp.Error != "" {
+		return &daemonError{message: resp.Error, code: resp.ExitCode}
+	}
+	return nil
+}
+
+// Starts the request for a command with the flags of the command and the global settings of this process,
+// so that the daemon reads and writes the files as this process would. The daemon has its own working
+// directory, so the request carries absolute file names. Global flags that only change how a process
+// runs, such as --jobs, --nice, --lang, the logging and the metrics, stay those of the daemon.
+func newDaemonRequest(cmd *commandArgs) (*daemonRequest, error) {
+	settings := *cmd.settings
+	req := &daemonRequest{Args: []string{cmd.command}, Settings: &settings, Stages: stageFlags()}
+	if cmd.command != "apply" {
+		if cmd.format != "" {
+			req.Args = append(req.Args, "--format="+cmd.format)
+		}
+		return req, nil
+	}
+	for _, opt := range cmd.options {
+		req.Args = append(req.Args, opt.Name+"="+opt.Value)
+	}
+	values := []struct{ name, value string }{
+		{"format", cmd.format}, {"precision", cmd.precision}, {"rasterizer", cmd.rasterizer},
+		{"dpi", cmd.dpi}, {"max-memory", cmd.maxMemory}, {"cache-url", cmd.cacheURL},
+		{"provenance-key", cmd.provenanceKey}, {"warn-memory", cmd.warnMemory}, {"warn-time", cmd.warnTime.String()},
+	}
+	for _, flag := range values {
+		if flag.value != "" {
+			req.Args = append(req.Args, "--"+flag.name+"="+flag.value)
+		}
+	}
+	paths := []struct{ name, value string }{
+		{"save-stages", cmd.saveStages}, {"record", cmd.record}, {"provenance", cmd.provenance},
+		{"checkpoint", cmd.checkpoint}, {"cache-dir", cmd.cacheDir},
+	}
+	for _, flag := range paths {
+		if flag.value == "" {
+			continue
+		}
+		path, err := filepath.Abs(flag.value)
+		if err != nil {
+			return nil, msgError("error.open_file", err)
+		}
+		req.Args = append(req.Args, "--"+flag.name+"="+path)
+	}
+	if cmd.page > 1 {
+		req.Args = append(req.Args, fmt.Sprintf("--page=%d", cmd.page))
+	}
+	if cmd.tileSize > 0 {
+		req.Args = append(req.Args, fmt.Sprintf("--tile-size=%d", cmd.tileSize))
+	}
+	if cmd.stream {
+		req.Args = append(req.Args, "--stream")
+	}
+	return req, nil
+}
+
+// Returns the global flags that change what the stages of an apply do, as they are given on the command
+// line. The stages read them from globals, so the daemon compares those of a request with its own.
+func stageFlags() []string {
+	var flags []string
+	if background != nil {
+		flags = append(flags, "--background="+hexColor(*background))
+	}
+	if straightAlpha {
+		flags = append(flags, "--straight-alpha")
+	}
+	if deterministic {
+		flags = append(flags, "--deterministic")
+	}
+	for _, name := range colorDistanceNames() {
+		if name != "rgb" && colorDistances[name] == activeDistance {
+			flags = append(flags, "--distance="+name)
+		}
+	}
+	return flags
+}
+
+// Writes v as a frame: a 4-byte big-endian length followed by that many bytes of JSON
+func writeFrame(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return msgError("error.frame", err)
+	}
+	frame := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(data)), uint32(len(data)))
+	if _, err := w.Write(append(frame, data...)); err != nil {
+		return msgError("error.frame", err)
+	}
+	return nil
+}
+
+// Reads one frame into v, returning io.EOF when the peer closed the connection between frames
+func readFrame(r io.Reader, v any) error {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		if err == io.EOF {
+			return err
+		}
+		return msgError("error.frame", err)
+	}
+	if size > maxFrameSize {
+		return msgError("error.frame", msg("error.frame_size", size, maxFrameSize))
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return msgError("error.frame", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return msgError("error.frame", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Runs an apply command line locally with the given settings and through executeDaemonRequest with the
+// request a client with those settings sends, returning both outputs and errors
+func applyLocalAndDaemon(t *testing.T, settings ioSettings, args ...string) (local, daemon []byte, localErr, daemonErr error) {
+	t.Helper()
+	dir := t.TempDir()
+	localOut, daemonOut := filepath.Join(dir, "local.bmp"), filepath.Join(dir, "daemon.bmp")
+
+	cmd, err := parseArgs(append(append([]string{"apply"}, args...), localOut))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.settings = &settings
+	localErr = runApply(cmd)
+	local, _ = os.ReadFile(localOut)
+
+	cmd, err = parseArgs(append(append([]string{"apply"}, args...), daemonOut))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.settings = &settings
+	req, err := newDaemonRequest(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Args = append(req.Args, "--", cmd.filename, daemonOut)
+	if resp := executeDaemonRequest(req, nil); resp.Error != "" {
+		daemonErr = &daemonError{message: resp.Error, code: resp.ExitCode}
+	}
+	daemon, _ = os.ReadFile(daemonOut)
+	return local, daemon, localErr, daemonErr
+}
+
+func TestDaemonRequestSettings(t *testing.T) {
+	source, err := filepath.Abs(filepath.Join("assets", "sample.bmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact := ioSettings{Encode: EncodeOptions{Compact: true}}
+	local, daemon, localErr, daemonErr := applyLocalAndDaemon(t, compact, "--filter=grayscale", source)
+	if localErr != nil || daemonErr != nil {
+		t.Fatalf("--compact: local error %v, daemon error %v", localErr, daemonErr)
+	}
+	if !bytes.Equal(local, daemon) {
+		t.Errorf("--compact: the daemon wrote %d bytes, the local run %d", len(daemon), len(local))
+	}
+	full, _, _, _ := applyLocalAndDaemon(t, ioSettings{}, "--filter=grayscale", source)
+	if len(local) >= len(full) {
+		t.Errorf("--compact wrote %d bytes, no fewer than the %d written without it", len(local), len(full))
+	}
+
+	// A set reserved field is rejected by strict parsing only
+	data, err := os.ReadFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[6] = 1
+	damaged := filepath.Join(t.TempDir(), "reserved.bmp")
+	if err := os.WriteFile(damaged, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	strict := ioSettings{Decode: DecodeOptions{Mode: "strict"}}
+	_, _, localErr, daemonErr = applyLocalAndDaemon(t, strict, "--filter=grayscale", damaged)
+	if localErr == nil || daemonErr == nil {
+		t.Errorf("--strict: local error %v, daemon error %v, want both to fail", localErr, daemonErr)
+	} else if exitCode(localErr) != exitInvalidBMP || exitCode(daemonErr) != exitInvalidBMP {
+		t.Errorf("--strict: exit status %d locally and %d through the daemon, want %d", exitCode(localErr), exitCode(daemonErr), exitInvalidBMP)
+	}
+	if _, _, localErr, daemonErr := applyLocalAndDaemon(t, ioSettings{}, "--filter=grayscale", damaged); localErr != nil || daemonErr != nil {
+		t.Errorf("without --strict: local error %v, daemon error %v, want both to succeed", localErr, daemonErr)
+	}
+}
+
+func TestDaemonRequestStageFlags(t *testing.T) {
+	source, err := filepath.Abs(filepath.Join("assets", "sample.bmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &daemonRequest{
+		Args:   []string{"apply", "--filter=grayscale", source, filepath.Join(t.TempDir(), "out.bmp")},
+		Stages: []string{"--straight-alpha"},
+	}
+	if resp := executeDaemonRequest(req, nil); resp.Error == "" {
+		t.Error("the daemon ran a request made with other stage flags")
+	}
+}
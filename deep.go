@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"slices"
+	"time"
+
+	"creditcard/bmp"
+)
+
+// Bits per channel apply works in: 8, as BMP files hold, or 16 with --precision=16
+var precisions = []string{"8", "16"}
+
+// An image apply --precision=16 works on: red, green, blue and alpha levels from 0 to 65535 for each pixel,
+// top row first, with straight alpha
+type deepImage struct {
+	Width, Height int
+	Pix           []uint16
+}
+
+func newDeepImage(width, height int) *deepImage {
+	return &deepImage{Width: width, Height: height, Pix: make([]uint16, width*height*4)}
+}
+
+// Returns the four levels of the pixel at x, y from the top-left corner
+func (img *deepImage) at(x, y int) []uint16 {
+	i := (y*img.Width + x) * 4
+	return img.Pix[i : i+4]
+}
+
+// Rounds a level from 0 to 65535 and clamps it to that range
+func deepLevel(v float64) uint16 {
+	return uint16(math.Round(math.Max(0, math.Min(v, 65535))))
+}
+
+// Operations --precision=16 runs on 16-bit levels. The others only work on 8-bit pixels, which would lose
+// what the mode keeps, so they are refused rather than rounded.
+var deepOperations = map[string]func(img *deepImage, value string) (*deepImage, error){
+	"mirror": func(img *deepImage, value string) (*deepImage, error) {
+		axis, err := parseMirror(value)
+		if err != nil {
+			return nil, err
+		}
+		return img.remap(img.Width, img.Height, func(x, y int) (int, int) {
+			if axis == "horizontal" {
+				return img.Width - 1 - x, y
+			}
+			return x, img.Height - 1 - y
+		}), nil
+	},
+	"rotate": func(img *deepImage, value string) (*deepImage, error) {
+		angle, err := parseRotate(value)
+		if err != nil {
+			return nil, err
+		}
+		if math.Mod(angle, 90) != 0 {
+			return nil, msgError("error.precision_angle", value)
+		}
+		switch (int(math.Mod(angle, 360)) + 360) % 360 {
+		case 90:
+			return img.remap(img.Height, img.Width, func(x, y int) (int, int) { return y, img.Height - 1 - x }), nil
+		case 180:
+			return img.remap(img.Width, img.Height, func(x, y int) (int, int) { return img.Width - 1 - x, img.Height - 1 - y }), nil
+		case 270:
+			return img.remap(img.Height, img.Width, func(x, y int) (int, int) { return img.Width - 1 - y, x }), nil
+		}
+		return img, nil
+	},
+	"crop": func(img *deepImage, value string) (*deepImage, error) {
+		left, top, width, height, err := parseCrop(value, img.Width, img.Height)
+		if err != nil {
+			return nil, err
+		}
+		return img.remap(width, height, func(x, y int) (int, int) { return left + x, top + y }), nil
+	},
+	"resize": func(img *deepImage, value string) (*deepImage, error) {
+		width, height, algorithm, err := parseResize(value)
+		if err != nil {
+			return nil, err
+		}
+		w, h := max(width.pixels(img.Width), 1), max(height.pixels(img.Height), 1)
+		if tooManyPixels(w, h) {
+			return nil, msgError("error.invalid_resize", value, bmp.MaxDecodePixels)
+		}
+		return img.resize(w, h, algorithm), nil
+	},
+	"scale": func(img *deepImage, value string) (*deepImage, error) {
+		factor, algorithm, err := parseScale(value)
+		if err != nil {
+			return nil, err
+		}
+		width, height := scaleSize(img.Width, img.Height, factor)
+		if tooManyPixels(width, height) {
+			return nil, msgError("error.invalid_scale", value, bmp.MaxDecodePixels)
+		}
+		return img.resize(width, height, algorithm), nil
+	},
+	"filter": func(img *deepImage, value string) (*deepImage, error) {
+		name, size, err := parseFilter(value)
+		if err != nil {
+			return nil, err
+		}
+		var f func(c []uint16)
+		switch name {
+		case "red":
+			f = func(c []uint16) { c[1], c[2] = 0, 0 }
+		case "green":
+			f = func(c []uint16) { c[0], c[2] = 0, 0 }
+		case "blue":
+			f = func(c []uint16) { c[0], c[1] = 0, 0 }
+		case "negative":
+			f = func(c []uint16) { c[0], c[1], c[2] = 65535-c[0], 65535-c[1], 65535-c[2] }
+		case "grayscale":
+			// As GrayLevel does, but without rounding the luminance to one of 256 levels
+			f = func(c []uint16) {
+				y := bmp.Luma(bmp.DecodeSRGB(float64(c[0])/65535), bmp.DecodeSRGB(float64(c[1])/65535), bmp.DecodeSRGB(float64(c[2])/65535))
+				gray := deepLevel(bmp.EncodeSRGB(y) * 65535)
+				c[0], c[1], c[2] = gray, gray, gray
+			}
+		}
+		if f == nil || size > 0 {
+			return nil, msgError("error.precision_filter", value)
+		}
+		return img.mapPixels(f), nil
+	},
+	"brightness": deepCurve("brightness", brightnessLevel),
+	"contrast":   deepCurve("contrast", contrastLevel),
+	"saturation": func(img *deepImage, value string) (*deepImage, error) {
+		amount, err := parseAdjustment("saturation", value)
+		if err != nil {
+			return nil, err
+		}
+		factor := 1 + float64(amount)/100
+		return img.mapPixels(func(c []uint16) {
+			gray := (299*float64(c[0]) + 587*float64(c[1]) + 114*float64(c[2])) / 1000
+			for i := range 3 {
+				c[i] = deepLevel(gray + (float64(c[i])-gray)*factor)
+			}
+		}), nil
+	},
+	"gamma": func(img *deepImage, value string) (*deepImage, error) {
+		gamma, err := parseGamma(value)
+		if err != nil {
+			return nil, err
+		}
+		return img.mapLevels(gammaLevel(gamma)), nil
+	},
+	// The pipeline converts the image to the encoding --colorspace asks for, which is all it does
+	"colorspace": func(img *deepImage, value string) (*deepImage, error) {
+		return img, nil
+	},
+}
+
+// Returns the 16-bit operation of --brightness or --contrast, which take an amount for a tone curve
+func deepCurve(name string, curve func(amount int) func(v float64) float64) func(img *deepImage, value string) (*deepImage, error) {
+	return func(img *deepImage, value string) (*deepImage, error) {
+		amount, err := parseAdjustment(name, value)
+		if err != nil {
+			return nil, err
+		}
+		return img.mapLevels(curve(amount)), nil
+	}
+}
+
+// Returns an image of the given size whose pixel x, y is the pixel source(x, y) of img
+func (img *deepImage) remap(width, height int, source func(x, y int) (int, int)) *deepImage {
+	result := newDeepImage(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			copy(result.at(x, y), img.at(source(x, y)))
+		}
+	}
+	return result
+}
+
+// Returns the image with f applied to the red, green, blue and alpha levels of every pixel
+func (img *deepImage) mapPixels(f func(c []uint16)) *deepImage {
+	result := &deepImage{Width: img.Width, Height: img.Height, Pix: slices.Clone(img.Pix)}
+	for i := 0; i < len(result.Pix); i += 4 {
+		f(result.Pix[i : i+4])
+	}
+	return result
+}
+
+// Returns the image with every color channel passed through a tone curve of levels from 0 to 255
+func (img *deepImage) mapLevels(curve func(v float64) float64) *deepImage {
+	return img.mapPixels(func(c []uint16) {
+		for i := range 3 {
+			c[i] = deepLevel(curve(float64(c[i])/257) * 257)
+		}
+	})
+}
+
+// Returns the image re-encoded in the color encoding to, "linear" or "srgb", as convertColorSpace does
+func (img *deepImage) convert(to string) *deepImage {
+	encode := bmp.EncodeSRGB
+	if to == "linear" {
+		encode = bmp.DecodeSRGB
+	}
+	return img.mapPixels(func(c []uint16) {
+		for i := range 3 {
+			c[i] = deepLevel(encode(float64(c[i])/65535) * 65535)
+		}
+	})
+}
+
+// Scales the image as applyResize does: nearest picks the pixel resizeImage does and bilinear blends with
+// the taps of resizeBilinear, the colors weighted by alpha unless --straight-alpha is given
+func (img *deepImage) resize(width, height int, algorithm string) *deepImage {
+	if width == img.Width && height == img.Height {
+		return img
+	}
+	if algorithm == "nearest" {
+		// resizeImage counts rows from the bottom, as BMP files store them
+		return img.remap(width, height, func(x, y int) (int, int) {
+			return x * img.Width / width, img.Height - 1 - (height-1-y)*img.Height/height
+		})
+	}
+
+	columns, rows := resizeTaps(width, img.Width), resizeTaps(height, img.Height)
+	// Source rows scaled to the result width, as red, green, blue and alpha
+	scaled := make([]float64, img.Height*width*4)
+	for y := 0; y < img.Height; y++ {
+		for x, taps := range columns {
+			c := scaled[(y*width+x)*4 : (y*width+x)*4+4]
+			for _, tap := range taps {
+				p := img.at(tap.index, y)
+				w, a := tap.weight, float64(p[3])/65535
+				c[3] += w * a
+				if !straightAlpha {
+					w *= a
+				}
+				c[0], c[1], c[2] = c[0]+w*float64(p[0]), c[1]+w*float64(p[1]), c[2]+w*float64(p[2])
+			}
+		}
+	}
+
+	result := newDeepImage(width, height)
+	for y, taps := range rows {
+		for x := 0; x < width; x++ {
+			var c [4]float64
+			for _, tap := range taps {
+				for i, v := range scaled[(tap.index*width+x)*4 : (tap.index*width+x)*4+4] {
+					c[i] += tap.weight * v
+				}
+			}
+			if !straightAlpha && c[3] > 0 {
+				c[0], c[1], c[2] = c[0]/c[3], c[1]/c[3], c[2]/c[3]
+			}
+			p := result.at(x, y)
+			if straightAlpha || c[3] > 0 {
+				p[0], p[1], p[2] = deepLevel(c[0]), deepLevel(c[1]), deepLevel(c[2])
+			}
+			p[3] = deepLevel(c[3] * 65535)
+		}
+	}
+	return result
+}
+
+// Returns the image of a BMP, PNG, JPEG or PDF source at 16 bits per channel. 8-bit levels become the
+// 16-bit ones of the same brightness, v * 257.
+func (s *ioSettings) loadDeepImage(filename string, pdf pdfOptions) (*deepImage, error) {
+	file, err := s.openInput(filename)
+	if err != nil {
+		return nil, msgError("error.open_file", err)
+	}
+	defer file.Close()
+	magic := make([]byte, 5)
+	n, _ := io.ReadFull(file, magic)
+	var img *Image
+	switch {
+	case bytes.HasPrefix(magic[:n], []byte("BM")) || bytes.HasPrefix(magic[:n], []byte("BA")):
+		file.Close()
+		_, _, img, err = s.loadImage(filename)
+	case string(magic[:n]) == "%PDF-":
+		file.Close()
+		img, _, err = s.loadPDFPage(filename, pdf)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if img != nil {
+		result := newDeepImage(img.Width, img.Height)
+		for y := 0; y < img.Height; y++ {
+			for x := 0; x < img.Width; x++ {
+				i := (img.Height-1-y)*img.Width + x
+				p, alpha := img.Pixels[i], byte(255)
+				if img.Alpha != nil {
+					alpha = img.Alpha[i]
+				}
+				copy(result.at(x, y), []uint16{uint16(p.Red) * 257, uint16(p.Green) * 257, uint16(p.Blue) * 257, uint16(alpha) * 257})
+			}
+		}
+		return result, nil
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, msgError("error.open_file", err)
+	}
+
+	src, err := s.decodeStandard(file, filename)
+	if err != nil {
+		return nil, err
+	}
+	bounds := src.Bounds()
+	result := newDeepImage(bounds.Dx(), bounds.Dy())
+	for y := 0; y < result.Height; y++ {
+		for x := 0; x < result.Width; x++ {
+			c := color.NRGBA64Model.Convert(src.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA64)
+			copy(result.at(x, y), []uint16{c.R, c.G, c.B, c.A})
+		}
+	}
+	return result, nil
+}
+
+// Writes the image as a 16-bit PNG file, with an alpha channel unless every pixel is opaque
+func (s *ioSettings) saveDeepImage(filename string, img *deepImage) error {
+	defer metrics.observeStage("encode", time.Now())
+	nrgba := image.NewNRGBA64(image.Rect(0, 0, img.Width, img.Height))
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			p := img.at(x, y)
+			nrgba.SetNRGBA64(x, y, color.NRGBA64{R: p[0], G: p[1], B: p[2], A: p[3]})
+		}
+	}
+	file, err := s.createOutput(filename)
+	if err != nil {
+		return msgError("error.create_file", err)
+	}
+	defer file.Close()
+	if err := png.Encode(file, nrgba); err != nil {
+		return msgError("error.encode_output", "png", err)
+	}
+	return file.Close()
+}
+
+// Runs apply with --precision=16: the source is read at 16 bits per channel, the options that support it
+// work on the 16-bit levels, and the outputs are written as 16-bit PNG files, so that the tool can sit
+// between the stages of a high-bit-depth pipeline.
+func runDeepApply(cmd *commandArgs) error {
+	// These write BMP files or 8-bit pixels
+	unsupported := []struct {
+		flag string
+		set  bool
+	}{
+		{"--save-stages", cmd.saveStages != ""}, {"--record", cmd.record != ""}, {"--stream", cmd.stream},
+		{"--checkpoint", cmd.checkpoint != ""}, {"--tile-size", cmd.tileSize > 0},
+		{"--max-memory", cmd.maxMemory != ""}, {"--dpi", cmd.dpi != ""},
+	}
+	for _, u := range unsupported {
+		if u.set {
+			return msgError("error.precision_flag", u.flag)
+		}
+	}
+	for _, output := range cmd.outputs {
+		if format := outputFormat(output.Filename, cmd.format); format != "png" {
+			return msgError("error.precision_format", format)
+		}
+	}
+	options, err := resolveStamps(cmd.options, cmd.filename)
+	if err != nil {
+		return err
+	}
+	for _, opt := range options {
+		op, ok := findOperation(opt.Name)
+		if !ok {
+			return msgError("error.unknown_option", opt.Name)
+		}
+		if _, ok := deepOperations[op.Name]; !ok {
+			return msgError("error.precision_operation", opt.Name)
+		}
+		if err := checkOption(op, opt.Value); err != nil {
+			return err
+		}
+	}
+
+	img, err := cmd.settings.loadDeepImage(cmd.filename, cmd.pdfOptions())
+	if err != nil {
+		return err
+	}
+	// Color encoding of img, which stages that need the other one get converted to, as Pipeline.Run does
+	space := "srgb"
+	for _, opt := range options {
+		op, _ := findOperation(opt.Name)
+		start := time.Now()
+		metrics.addPixels(int64(img.Width) * int64(img.Height))
+		if need := stageColorSpace(op, opt.Value); need != "" && need != space {
+			img, space = img.convert(need), need
+		}
+		if img, err = deepOperations[op.Name](img, opt.Value); err != nil {
+			return err
+		}
+		metrics.observeStage(op.Name, start)
+	}
+	if space != "srgb" {
+		img = img.convert("srgb")
+	}
+
+	for _, output := range cmd.outputs {
+		result := img
+		if width, height := output.size(img.Width, img.Height); width != img.Width || height != img.Height {
+			result = img.resize(width, height, "nearest")
+		}
+		if err := cmd.settings.saveDeepImage(output.Filename, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Flag values from the [defaults] section of the config file, by flag name
+var configDefaults = map[string]string{}
+
+// Returns the path of the config file: $BITMAP_CONFIG, or bitmap/config in the user's config directory
+func configPath() string {
+	if path := os.Getenv("BITMAP_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "bitmap", "config")
+}
+
+// Reads the [defaults] section of the config file, if there is one. Each line sets a flag by its name
+// without the dashes, e.g. "results = jsonl"; other sections are left for other uses.
+func loadConfigDefaults() error {
+	path := configPath()
+	if path == "" {
+		return nil
+	}
+	file, err := os.Open(nativePath(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return msgError("error.open_file", err)
+	}
+	defer file.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";"):
+			continue
+		case strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]"):
+			section = strings.TrimSpace(text[1 : len(text)-1])
+			continue
+		case section != "defaults":
+			continue
+		}
+		name, value, found := strings.Cut(text, "=")
+		if !found {
+			return msgError("error.config_line", path, line)
+		}
+		configDefaults[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return msgError("error.read_file", err)
+	}
+	return nil
+}
+
+// Returns the default of a flag and where it came from: BITMAP_<NAME> in the environment (e.g.
+// BITMAP_MAX_PIXELS for --max-pixels) takes precedence over the config file
+func lookupDefault(name string) (value, source string, ok bool) {
+	env := "BITMAP_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	if value, ok := os.LookupEnv(env); ok {
+		return value, env, true
+	}
+	if value, ok := configDefaults[name]; ok {
+		return value, configPath(), true
+	}
+	return "", "", false
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// Set by --deterministic, for reproducible builds that content-hash their outputs. Pixels, header fields,
+// color tables and the effects drawn with seeded generators already follow from the sources, the options
+// and the settings alone; the flag settles what otherwise comes from the machine and the moment: the time
+// --stamp writes, and which of two batch inputs that name the same output is written.
+var deterministic bool
+
+// Returns the time --stamp writes in deterministic mode: $SOURCE_DATE_EPOCH, the seconds since 1970 that
+// reproducible builds agree on, or the Unix epoch when it is unset. It is kept in UTC, so that the text
+// does not follow the machine's time zone either.
+func deterministicTime() (time.Time, error) {
+	value := os.Getenv("SOURCE_DATE_EPOCH")
+	if value == "" {
+		return time.Unix(0, 0).UTC(), nil
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return time.Time{}, msgError("error.invalid_source_date", value)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Shift in pixels a --displace map gives at full strength when no strength is given
+const defaultDisplaceStrength = 10
+
+// Parses a --displace value of the form file[:strength]. The strength is taken from the end, so file
+// names may contain colons themselves.
+func parseDisplace(value string) (file string, strength float64, err error) {
+	file, strength = value, defaultDisplaceStrength
+	if i := strings.LastIndex(value, ":"); i >= 0 {
+		if s, err := strconv.ParseFloat(value[i+1:], 64); err == nil {
+			file, strength = value[:i], s
+		}
+	}
+	if file == "" || math.IsNaN(strength) || math.IsInf(strength, 0) {
+		return "", 0, msgError("error.invalid_displace", value)
+	}
+	return file, strength, nil
+}
+
+// Warps the image by a displacement map: the red channel of the map shifts where each pixel is sampled
+// from sideways and the green channel up or down, by up to strength pixels. Level 128 leaves a pixel in
+// place, lower levels take it from the left or above and higher ones from the right or below. The map is
+// stretched over the image when their sizes differ.
+func applyDisplace(img *Image, file string, strength float64, progress rowProgress) (*Image, error) {
+	_, _, displacement, err := globalSettings.loadImage(file)
+	if err != nil {
+		return nil, err
+	}
+	scaleX := float64(displacement.Width) / float64(img.Width)
+	scaleY := float64(displacement.Height) / float64(img.Height)
+	return img.Warp(func(x, y float64) (float64, float64) {
+		mx := min(int(x*scaleX), displacement.Width-1)
+		my := min(int(y*scaleY), displacement.Height-1)
+		p := displacement.Pixels[(displacement.Height-1-my)*displacement.Width+mx]
+		return x + (float64(p.Red)-128)/127*strength, y + (float64(p.Green)-128)/127*strength
+	}, progress), nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Parses a --swirl value of the form degrees[,radius]; radius is 0 when it is not given
+func parseSwirl(value string) (degrees, radius float64, err error) {
+	d, r, found := strings.Cut(value, ",")
+	degrees, err = strconv.ParseFloat(d, 64)
+	if err == nil && found {
+		radius, err = strconv.ParseFloat(r, 64)
+	}
+	if err != nil || math.IsNaN(degrees) || math.IsInf(degrees, 0) || math.IsNaN(radius) || math.IsInf(radius, 0) || radius < 0 || (found && radius == 0) {
+		return 0, 0, msgError("error.invalid_swirl", value)
+	}
+	return degrees, radius, nil
+}
+
+// Parses an --implode value, a factor from -1 to 1
+func parseImplode(value string) (float64, error) {
+	factor, err := strconv.ParseFloat(value, 64)
+	if err != nil || !(factor >= -1 && factor <= 1) {
+		return 0, msgError("error.invalid_implode", value)
+	}
+	return factor, nil
+}
+
+// Parses a --wave value of the form amplitude,wavelength in pixels
+func parseWave(value string) (amplitude, wavelength float64, err error) {
+	a, l, found := strings.Cut(value, ",")
+	amplitude, err = strconv.ParseFloat(a, 64)
+	if err == nil {
+		wavelength, err = strconv.ParseFloat(l, 64)
+	}
+	if !found || err != nil || math.IsNaN(amplitude) || math.IsInf(amplitude, 0) || !(wavelength > 0) || math.IsInf(wavelength, 0) {
+		return 0, 0, msgError("error.invalid_wave", value)
+	}
+	return amplitude, wavelength, nil
+}
+
+// Twists the image around its center by up to degrees, clockwise for positive angles. The twist is
+// strongest at the center and fades to nothing at radius pixels from it, or at half the shorter side when
+// radius is 0, as in the swirl of ImageMagick.
+func applySwirl(img *Image, degrees, radius float64, progress rowProgress) *Image {
+	cx, cy := float64(img.Width)/2, float64(img.Height)/2
+	if radius == 0 {
+		radius = min(cx, cy)
+	}
+	twist := degrees * math.Pi / 180
+	return img.Warp(func(x, y float64) (float64, float64) {
+		dx, dy := x-cx, y-cy
+		r := math.Hypot(dx, dy)
+		if r >= radius {
+			return x, y
+		}
+		// Sampling at a smaller angle turns the content the other way, clockwise for positive twists
+		t := 1 - r/radius
+		angle := -twist * t * t
+		sin, cos := math.Sincos(angle)
+		return cx + dx*cos - dy*sin, cy + dx*sin + dy*cos
+	}, progress)
+}
+
+// Pulls the image towards its center for positive factors and pushes it outward for negative ones,
+// within the circle that fits in the image, as in the implode of ImageMagick
+func applyImplode(img *Image, factor float64, progress rowProgress) *Image {
+	cx, cy := float64(img.Width)/2, float64(img.Height)/2
+	radius := min(cx, cy)
+	return img.Warp(func(x, y float64) (float64, float64) {
+		dx, dy := x-cx, y-cy
+		r := math.Hypot(dx, dy)
+		if r >= radius || r == 0 {
+			return x, y
+		}
+		// Points near the center are taken from further out, which draws their content in
+		scale := math.Pow(math.Sin(math.Pi*r/(2*radius)), -factor)
+		return cx + dx*scale, cy + dy*scale
+	}, progress)
+}
+
+// Shifts every column up or down along a sine wave of the given amplitude and wavelength in pixels. Unlike
+// the wave of ImageMagick the canvas keeps its size, and the edges the wave uncovers repeat the border
+// pixels.
+func applyWave(img *Image, amplitude, wavelength float64, progress rowProgress) *Image {
+	return img.Warp(func(x, y float64) (float64, float64) {
+		return x, y + amplitude*math.Sin(2*math.Pi*x/wavelength)
+	}, progress)
+}
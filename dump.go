@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"creditcard/bmp"
+)
+
+// Settings of the dump command
+type dumpConfig struct {
+	format   string // Only "text" for now
+	region   string // Optional offsetX-offsetY[-width-height], as for --crop
+	filename string
+}
+
+// Parses the arguments of the dump command
+func parseDumpArgs(args []string) (*dumpConfig, error) {
+	cfg := &dumpConfig{format: "text"}
+	// Pixels are the only section so far, so --pixels is accepted but changes nothing
+	var pixels bool
+	flags := []flagSpec{
+		{Name: "pixels", Target: &pixels},
+		{Name: "format", Target: &cfg.format, Choices: []string{"text"}},
+		{Name: "region", Target: &cfg.region},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(positional) != 1 {
+		return nil, msgError("usage.dump")
+	}
+	cfg.filename = positional[0]
+	return cfg, nil
+}
+
+// Prints the pixels of an image, or of a region of it, as text
+func runDump(args []string) error {
+	cfg, err := parseDumpArgs(args)
+	if err != nil {
+		return err
+	}
+	_, _, img, err := globalSettings.loadImage(cfg.filename)
+	if err != nil {
+		return err
+	}
+
+	if cfg.region != "" {
+		x, y, w, h, err := parseCrop(cfg.region, img.Width, img.Height)
+		if err != nil {
+			return err
+		}
+		img = &Image{Width: w, Height: h, Pixels: bmp.CropPixels(img.Pixels, img.Width, img.Height, x, y, w, h, nil)}
+	}
+	return writePixelText(os.Stdout, img)
+}
+
+// Writes the pixels as text: a "# bitmap pixels WxH" comment followed by one line of rrggbb values
+// per row, top row first, so that small images diff line by line
+func writePixelText(out io.Writer, img *Image) error {
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "# bitmap pixels %dx%d\n", img.Width, img.Height)
+	for y := img.Height - 1; y >= 0; y-- {
+		for x, p := range img.Pixels[y*img.Width : (y+1)*img.Width] {
+			if x > 0 {
+				w.WriteByte(' ')
+			}
+			fmt.Fprintf(w, "%02x%02x%02x", p.Red, p.Green, p.Blue)
+		}
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		return msgError("error.write_output", err)
+	}
+	return nil
+}
+
+// Reads an image from the text format written by writePixelText. Blank lines and lines starting
+// with # are skipped; every remaining line is a row of rrggbb values, top row first.
+func parsePixelText(r io.Reader, name string) (*Image, error) {
+	var rows [][]Pixel
+	scanner := bufio.NewScanner(r)
+	// A row takes 7 bytes per pixel, which is longer than the default line limit for wide images
+	scanner.Buffer(nil, 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(rows) > 0 && len(fields) != len(rows[0]) {
+			return nil, msgError("error.text_row_width", name, line, len(fields), len(rows[0]))
+		}
+		row := make([]Pixel, len(fields))
+		for i, field := range fields {
+			p, err := parseHexColor(field)
+			if err != nil {
+				return nil, err
+			}
+			row[i] = p
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, msgError("error.read_file", err)
+	}
+	if len(rows) == 0 {
+		return nil, msgError("error.text_empty", name)
+	}
+
+	// Rows are stored bottom-up
+	width, height := len(rows[0]), len(rows)
+	img := &Image{Width: width, Height: height, Pixels: make([]Pixel, 0, width*height)}
+	for y := height - 1; y >= 0; y-- {
+		img.Pixels = append(img.Pixels, rows[y]...)
+	}
+	return img, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+
+	"creditcard/bmp"
+)
+
+// Exit statuses of the command-line tool, so that scripts can tell a failure worth retrying from one
+// that will fail again
+const (
+	exitFailure     = 1 // Any failure not listed below
+	exitUsage       = 2 // Wrong arguments or option values
+	exitNotFound    = 3 // A file to read does not exist
+	exitInvalidBMP  = 4 // An input is not a BMP file or a damaged one
+	exitUnsupported = 5 // An input is a valid BMP file that uses a feature the decoder does not read
+	exitWrite       = 6 // An output could not be written
+)
+
+// Names of the exit statuses in --errors=json output
+var exitCodeNames = map[int]string{
+	exitFailure:     "failure",
+	exitUsage:       "usage",
+	exitNotFound:    "not_found",
+	exitInvalidBMP:  "invalid_bmp",
+	exitUnsupported: "unsupported",
+	exitWrite:       "write",
+}
+
+// Set by --errors=json: a failing command prints its error as a JSON object instead of text
+var errorFormat = "text"
+
+// Messages reporting arguments the command does not accept, besides the usage.*, expect.* and
+// error.invalid_* ones
+var usageErrorKeys = []string{
+	"error.unknown_command", "error.unknown_option", "error.unknown_topic", "error.missing_value",
+	"error.flag_value", "error.flag_conflict", "error.default_value", "error.config_line", "error.unexpected_arg",
+	"error.stream_option", "error.stream_output", "error.tile_option", "error.guard_last",
+	"error.stamp_field", "error.template_field", "error.template_name", "error.split_position",
+	"error.histogram_bins",
+}
+
+// Messages reporting outputs that could not be written
+var writeErrorKeys = []string{
+	"error.create_file", "error.create_dir", "error.write_output", "error.write_results",
+	"error.write_script", "error.write_state", "error.encode_output",
+}
+
+// Returns the exit status for an error. Arguments are checked first, so a bad option value is a usage
+// error even when it names a missing file, and outputs before inputs, so that an output in a missing
+// directory is a write error. Errors a daemon answered with keep the status the daemon gave them.
+func exitCode(err error) int {
+	var daemonErr *daemonError
+	if errors.As(err, &daemonErr) && daemonErr.code != 0 {
+		return daemonErr.code
+	}
+	key := errorKey(err)
+	switch {
+	case strings.HasPrefix(key, "usage.") || strings.HasPrefix(key, "expect.") ||
+		strings.HasPrefix(key, "error.invalid_") || slices.Contains(usageErrorKeys, key) ||
+		errors.Is(err, bmp.ErrInvalidArgument):
+		return exitUsage
+	case slices.Contains(writeErrorKeys, key) || errors.Is(err, bmp.ErrWrite):
+		return exitWrite
+	case errors.Is(err, fs.ErrNotExist):
+		return exitNotFound
+	case errors.Is(err, bmp.ErrNotBMP) || errors.Is(err, bmp.ErrInvalidBMP) || key == "error.decode_input":
+		return exitInvalidBMP
+	case errors.Is(err, bmp.ErrUnsupported):
+		return exitUnsupported
+	}
+	return exitFailure
+}
+
+// Returns the message key of an error, or "" for errors that do not come from the catalog
+func errorKey(err error) string {
+	var msgErr *messageError
+	if errors.As(err, &msgErr) {
+		return msgErr.key
+	}
+	var bmpErr *bmp.Error
+	if errors.As(err, &bmpErr) {
+		return bmpErr.Key
+	}
+	return ""
+}
+
+// Error as --errors=json prints it
+type errorReport struct {
+	Code     string `json:"code"`
+	ExitCode int    `json:"exit_code"`
+	Key      string `json:"key,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Writes an error as a JSON object on one line: {"error":{"code":"not_found","exit_code":3,...}}
+func writeErrorJSON(w io.Writer, err error) error {
+	code := exitCode(err)
+	report := errorReport{Code: exitCodeNames[code], ExitCode: code, Key: errorKey(err), Message: localizeError(err).Error()}
+	return json.NewEncoder(w).Encode(map[string]errorReport{"error": report})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Size of the built-in sample image used for previews
+const (
+	sampleWidth  = 24
+	sampleHeight = 12
+)
+
+// Characters used to draw previews, from dark to light
+const asciiRamp = " .:-=+*#%@"
+
+// Prints the help page of an apply option followed by a before and after preview on a built-in sample
+func runExplain(args []string) error {
+	if len(args) != 1 || !strings.HasPrefix(args[0], "--") {
+		return msgError("usage.explain")
+	}
+	name, value, found := strings.Cut(args[0], "=")
+	op, ok := findOperation(name)
+	if !ok {
+		return msgError("error.unknown_option", name)
+	}
+
+	displayOperationHelp(op)
+	fmt.Println()
+
+	// The sample has no files next to it, so options that read one can only be described
+	if readsFiles(op) {
+		fmt.Println(msg("explain.no_preview"))
+		return nil
+	}
+	if op.Guard != nil {
+		fmt.Println(msg("explain.guard"))
+		return nil
+	}
+	if !found && len(op.Examples) > 0 {
+		value = op.Examples[0]
+	}
+
+	before := sampleImage()
+	after, err := applyOptions(before, []Option{{Name: "--" + op.Name, Value: value}})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(msg("explain.preview", op.Name, value))
+	left, right := asciiArt(before), asciiArt(after)
+	fmt.Printf("  %-*s  %s\n", sampleWidth, msg("explain.before"), msg("explain.after"))
+	for i := 0; i < max(len(left), len(right)); i++ {
+		var l, r string
+		if i < len(left) {
+			l = left[i]
+		}
+		if i < len(right) {
+			r = right[i]
+		}
+		fmt.Println(strings.TrimRight(fmt.Sprintf("  %-*s  %s", sampleWidth, l, r), " "))
+	}
+	return nil
+}
+
+// Generates the sample: a diagonal gradient with a yellow square near the top-left corner and a dark bar
+// near the bottom-right, so that every operation changes it visibly
+func sampleImage() *Image {
+	img := &Image{Width: sampleWidth, Height: sampleHeight, Pixels: make([]Pixel, sampleWidth*sampleHeight)}
+	for y := 0; y < sampleHeight; y++ {
+		// Rows are stored bottom-up, the shapes are placed from the top
+		top := sampleHeight - 1 - y
+		for x := 0; x < sampleWidth; x++ {
+			level := byte(40 + 180*(x+top)/(sampleWidth+sampleHeight-2))
+			p := Pixel{Blue: level, Green: level, Red: level}
+			switch {
+			case x >= 2 && x < 8 && top >= 2 && top < 6:
+				p = Pixel{Blue: 0, Green: 255, Red: 255}
+			case x >= 15 && x < 22 && top >= 8 && top < 10:
+				p = Pixel{}
+			}
+			img.Pixels[y*sampleWidth+x] = p
+		}
+	}
+	return img
+}
+
+// Draws the image as lines of characters, top row first, with one character per pixel
+func asciiArt(img *Image) []string {
+	lines := make([]string, img.Height)
+	for y := 0; y < img.Height; y++ {
+		var b strings.Builder
+		for _, p := range img.Pixels[y*img.Width : (y+1)*img.Width] {
+			b.WriteByte(asciiRamp[p.Luminance()*len(asciiRamp)/256000])
+		}
+		lines[img.Height-1-y] = b.String()
+	}
+	return lines
+}
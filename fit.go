@@ -0,0 +1,42 @@
+package main
+
+import "strings"
+
+// Modes of --fit: whether images smaller than the box are scaled up to it
+var fitModes = []string{"upscale", "no-upscale"}
+
+// Parses a --fit value of the form WxH[:upscale|:no-upscale]
+func parseFit(value string) (width, height int, upscale bool, err error) {
+	box, mode, found := strings.Cut(value, ":")
+	if found && !contains(fitModes, mode) {
+		return 0, 0, false, msgError("error.invalid_fit", value)
+	}
+	width, height, ok := parseSize(box)
+	if !ok {
+		return 0, 0, false, msgError("error.invalid_fit", value)
+	}
+	return width, height, mode != "no-upscale", nil
+}
+
+// Scales the image to the largest size that fits in the box while keeping its aspect ratio.
+// Without upscale, images that already fit are left as they are.
+func applyFit(img *Image, boxWidth, boxHeight int, upscale bool) *Image {
+	if !upscale && img.Width <= boxWidth && img.Height <= boxHeight {
+		return img
+	}
+
+	width, height := fitSize(img.Width, img.Height, boxWidth, boxHeight)
+	if width == img.Width && height == img.Height {
+		return img
+	}
+	return resizeImage(img, width, height)
+}
+
+// Returns the largest size with the aspect ratio of width x height that fits in the box
+func fitSize(width, height, boxWidth, boxHeight int) (int, int) {
+	// Compares the aspect ratios without division to find the side that touches the box
+	if width*boxHeight <= height*boxWidth {
+		return max(width*boxHeight/height, 1), boxHeight
+	}
+	return boxWidth, max(height*boxWidth/width, 1)
+}
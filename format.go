@@ -0,0 +1,77 @@
+package main
+
+import (
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Output formats accepted by --format
+var outputFormats = []string{"bmp", "png", "jpeg", "text", "npy", "arrow"}
+
+// Formats inferred from output file extensions; any other extension writes a BMP file
+var formatExtensions = map[string]string{
+	".png":  "png",
+	".jpg":  "jpeg",
+	".jpeg": "jpeg",
+	".txt":  "text",
+	".npy":  "npy",
+	// Feather V2 files are Arrow IPC files
+	".arrow":   "arrow",
+	".feather": "arrow",
+}
+
+// Returns the format to write: the override when given, otherwise the one implied by the file extension
+func outputFormat(filename, override string) string {
+	if override != "" {
+		return override
+	}
+	if format, ok := formatExtensions[strings.ToLower(filepath.Ext(filename))]; ok {
+		return format
+	}
+	return "bmp"
+}
+
+// Writes the image in the given format, or in the one inferred from the file name when format is empty.
+// The headers are only used for BMP output.
+func (s *ioSettings) saveOutput(filename, format string, bmpHeader *BMPHeader, dibHeader *DIBHeader, img *Image) error {
+	format = outputFormat(filename, format)
+	if format == "bmp" {
+		return s.saveImage(filename, bmpHeader, dibHeader, img)
+	}
+
+	defer metrics.observeStage("encode", time.Now())
+	file, err := s.createOutput(filename)
+	if err != nil {
+		return msgError("error.create_file", err)
+	}
+	defer file.Close()
+
+	switch format {
+	case "text":
+		if err := writePixelText(file, img); err != nil {
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		return s.runPostHook(filename, img)
+	case "jpeg":
+		err = jpeg.Encode(file, img.ToRGBA(), nil)
+	case "npy":
+		err = writeNPY(file, img)
+	case "arrow":
+		err = writeArrow(file, img)
+	default:
+		err = png.Encode(file, img.ToRGBA())
+	}
+	if err != nil {
+		return msgError("error.encode_output", format, err)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return s.runPostHook(filename, img)
+}
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Most pixels of a video frame the frames command reads; headers can claim any size
+const maxFramePixels = 1 << 28
+
+// Longest header line of a YUV4MPEG2 stream or of one of its frames
+const maxY4MLine = 4096
+
+// Frames of a video, read one at a time from the start
+type frameSource interface {
+	// Reads the next frame, returning io.EOF after the last one. The frame is only decoded into an image,
+	// with the headers it is best written with, when decode is set.
+	next(decode bool) (*BMPHeader, *DIBHeader, *Image, error)
+}
+
+// Writes every --every-th frame of an uncompressed YUV4MPEG2 (.y4m) or AVI video, from frame --start on, as
+// BMP files named by their frame numbers into a directory, so that the batch command and others can take
+// them from there. With --prune-similar, frames that look like the last one written are left out.
+func runFrames(args []string) error {
+	every, start, most := 1, 1, 0
+	var pruneSimilar string
+	flags := []flagSpec{
+		{Name: "every", Target: &every, Min: 1},
+		{Name: "start", Target: &start, Min: 1},
+		{Name: "max", Target: &most},
+		{Name: "prune-similar", Target: &pruneSimilar, Check: checkPruneThreshold},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return msgError("usage.frames")
+	}
+	source, dir := positional[0], positional[1]
+
+	logDetail("info.opening_file", source)
+	file, err := globalSettings.openInput(source)
+	if err != nil {
+		return msgError("error.open_file", err)
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	magic, _ := r.Peek(12)
+	var frames frameSource
+	switch {
+	case bytes.HasPrefix(magic, []byte("YUV4MPEG2")):
+		frames, err = newY4MSource(r)
+	case bytes.HasPrefix(magic, []byte("RIFF")) && bytes.HasSuffix(magic, []byte("AVI ")):
+		frames, err = newAVISource(r)
+	default:
+		return msgError("error.video_container", source)
+	}
+	if err != nil {
+		return videoError(source, err)
+	}
+	if err := files.MkdirAll(dir); err != nil {
+		return msgError("error.create_dir", err)
+	}
+
+	pruner := newFramePruner(pruneSimilar)
+	written, pruned, n := 0, 0, 0
+	for most <= 0 || written < most {
+		n++
+		keep := n >= start && (n-start)%every == 0
+		bmpHeader, dibHeader, img, err := frames.next(keep)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return videoError(source, err)
+		}
+		if img == nil {
+			continue
+		}
+		if pruner != nil {
+			if keep, distance := pruner.keep(img); !keep {
+				logDetail("info.frame_pruned", n, distance)
+				pruned++
+				continue
+			}
+		}
+		name := filepath.Join(dir, fmt.Sprintf("frame_%06d.bmp", n))
+		if err := globalSettings.saveOutput(name, "", bmpHeader, dibHeader, img); err != nil {
+			return err
+		}
+		written++
+	}
+	if written == 0 {
+		return msgError("error.no_frames", source, n-1, start)
+	}
+	logInfo("info.frames_written", written, dir)
+	if pruned > 0 {
+		logInfo("info.frames_pruned", pruned)
+	}
+	return nil
+}
+
+// Reports a video that cannot be read, keeping errors that are already messages
+func videoError(source string, err error) error {
+	var m *messageError
+	if errors.As(err, &m) {
+		return err
+	}
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		err = errors.New(msg("video.truncated"))
+	}
+	return msgError("error.video_damaged", source, err)
+}
+
+// A frame of YUV video, in 8-bit planes: full-size luma and alpha, and chroma planes of cw x ch samples
+// that cover the frame
+type yuvFrame struct {
+	width, height int
+	y, cb, cr, a  []byte
+	cw, ch        int
+	fullRange     bool // Levels span 0 to 255 rather than the 16 to 235 of studio video
+}
+
+// Converts the frame to RGB by the BT.601 matrix, taking the chroma sample that covers each pixel
+func (f *yuvFrame) image() *Image {
+	img := &Image{Width: f.width, Height: f.height, Pixels: make([]Pixel, f.width*f.height)}
+	if f.a != nil {
+		img.Alpha = make([]byte, len(img.Pixels))
+	}
+	clamp := func(v int) byte { return byte(min(max(v, 0), 255)) }
+	for y := range f.height {
+		row := (f.height - 1 - y) * f.width
+		for x := range f.width {
+			luma := int(f.y[y*f.width+x])
+			var cb, cr int
+			if f.cb != nil {
+				at := y*f.ch/f.height*f.cw + x*f.cw/f.width
+				cb, cr = int(f.cb[at])-128, int(f.cr[at])-128
+			}
+			var p Pixel
+			if f.fullRange {
+				p = Pixel{
+					Red:   clamp(luma + (91881*cr+32768)>>16),
+					Green: clamp(luma - (22554*cb+46802*cr-32768)>>16),
+					Blue:  clamp(luma + (116130*cb+32768)>>16),
+				}
+			} else {
+				c := 298 * (luma - 16)
+				p = Pixel{
+					Red:   clamp((c + 409*cr + 128) >> 8),
+					Green: clamp((c - 100*cb - 208*cr + 128) >> 8),
+					Blue:  clamp((c + 516*cb + 128) >> 8),
+				}
+			}
+			img.Pixels[row+x] = p
+			if f.a != nil {
+				img.Alpha[row+x] = f.a[y*f.width+x]
+			}
+		}
+	}
+	return img
+}
+
+// Returns the size of the chroma planes of a frame for a YUV4MPEG2 chroma subsampling such as 420
+func chromaSize(subsampling string, width, height int) (int, int) {
+	switch subsampling {
+	case "420":
+		return (width + 1) / 2, (height + 1) / 2
+	case "422":
+		return (width + 1) / 2, height
+	case "411":
+		return (width + 3) / 4, height
+	}
+	return width, height
+}
+
+// Checks that a frame size is positive and within the limits of the global flags
+func checkFrameSize(width, height int) error {
+	if width <= 0 || height <= 0 || int64(width)*int64(height) > maxFramePixels {
+		return errors.New(msg("video.frame_size", width, height))
+	}
+	if err := globalSettings.Decode.CheckSize(int64(width), int64(height), 0); err != nil {
+		return localizeError(err)
+	}
+	return nil
+}
+
+// A YUV4MPEG2 stream: a header line, then for every frame a FRAME line and its planes, luma first
+type y4mSource struct {
+	r          *bufio.Reader
+	frame      yuvFrame
+	subsampled string // Chroma subsampling, or "mono" for luma alone
+	depth      int    // Bits per sample; more than 8 take two little-endian bytes
+	data       []byte
+}
+
+// Reads the header of a YUV4MPEG2 stream
+func newY4MSource(r *bufio.Reader) (*y4mSource, error) {
+	line, err := readY4MLine(r)
+	if err != nil {
+		return nil, err
+	}
+	s := &y4mSource{r: r, subsampled: "420", depth: 8}
+	alpha := false
+	for _, field := range strings.Fields(line)[1:] {
+		value := field[1:]
+		switch field[0] {
+		case 'W':
+			s.frame.width, err = strconv.Atoi(value)
+		case 'H':
+			s.frame.height, err = strconv.Atoi(value)
+		case 'C':
+			if s.subsampled, s.depth, alpha, err = parseY4MColorSpace(value); err != nil {
+				return nil, msgError("error.video_codec", "Y4M C"+value)
+			}
+		case 'X':
+			s.frame.fullRange = s.frame.fullRange || value == "COLORRANGE=FULL"
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%q", field)
+		}
+	}
+	if err := checkFrameSize(s.frame.width, s.frame.height); err != nil {
+		return nil, err
+	}
+
+	f := &s.frame
+	f.cw, f.ch = chromaSize(s.subsampled, f.width, f.height)
+	planes := []*[]byte{&f.y}
+	if s.subsampled != "mono" {
+		planes = append(planes, &f.cb, &f.cr)
+	}
+	if alpha {
+		planes = append(planes, &f.a)
+	}
+	size := 0
+	for i, plane := range planes {
+		n := f.width * f.height
+		if plane == &f.cb || plane == &f.cr {
+			n = f.cw * f.ch
+		}
+		*planes[i] = make([]byte, n)
+		size += n
+	}
+	if s.depth > 8 {
+		size *= 2
+	}
+	s.data = make([]byte, size)
+	return s, nil
+}
+
+// Parses the C field of a YUV4MPEG2 header, such as 420jpeg, 422p10 or mono, into its chroma subsampling,
+// bits per sample and whether an alpha plane follows
+func parseY4MColorSpace(value string) (string, int, bool, error) {
+	if value == "444alpha" {
+		return "444", 8, true, nil
+	}
+	subsampling, rest := value, ""
+	switch {
+	case strings.HasPrefix(value, "mono"):
+		subsampling, rest = "mono", strings.TrimPrefix(value, "mono")
+	case len(value) >= 3:
+		subsampling, rest = value[:3], value[3:]
+		if rest == "jpeg" || rest == "paldv" || rest == "mpeg2" {
+			rest = ""
+		}
+		rest = strings.TrimPrefix(rest, "p")
+	}
+	switch subsampling {
+	case "420", "422", "444", "411", "mono":
+	default:
+		return "", 0, false, errors.New(value)
+	}
+	if rest == "" {
+		return subsampling, 8, false, nil
+	}
+	depth, err := strconv.Atoi(rest)
+	if err != nil || depth < 8 || depth > 16 {
+		return "", 0, false, errors.New(value)
+	}
+	return subsampling, depth, false, nil
+}
+
+// Reads a header line of a YUV4MPEG2 stream without its newline
+func readY4MLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		part, err := r.ReadSlice('\n')
+		line = append(line, part...)
+		if len(line) > maxY4MLine {
+			return "", errors.New(msg("video.long_line"))
+		}
+		if err != bufio.ErrBufferFull {
+			if err == io.EOF && len(line) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return strings.TrimSuffix(string(line), "\n"), err
+		}
+	}
+}
+
+func (s *y4mSource) next(decode bool) (*BMPHeader, *DIBHeader, *Image, error) {
+	line, err := readY4MLine(s.r)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !strings.HasPrefix(line, "FRAME") {
+		return nil, nil, nil, fmt.Errorf("%q", line[:min(len(line), 16)])
+	}
+	if _, err := io.ReadFull(s.r, s.data); err != nil {
+		return nil, nil, nil, io.ErrUnexpectedEOF
+	}
+	if !decode {
+		return nil, nil, nil, nil
+	}
+
+	// Samples of more than 8 bits keep their 8 most significant ones
+	f := &s.frame
+	at := 0
+	for _, plane := range [][]byte{f.y, f.cb, f.cr, f.a} {
+		for i := range plane {
+			if s.depth > 8 {
+				plane[i] = byte(binary.LittleEndian.Uint16(s.data[at:]) >> (s.depth - 8))
+				at += 2
+			} else {
+				plane[i] = s.data[at]
+				at++
+			}
+		}
+	}
+	return &BMPHeader{}, &DIBHeader{}, f.image(), nil
+}
+
+// An AVI file, read chunk by chunk: the stream headers first, then the frames of its first video stream
+// in its movi lists. Frames are either DIBs, with the BITMAPINFOHEADER of the stream format, or YUV of a
+// few common four-character codes. Chunks of other streams, indexes and the like are skipped.
+type aviSource struct {
+	r       *bufio.Reader
+	streams int    // Stream headers read so far
+	kinds   []byte // Whether each stream is video
+	video   string // Chunk id prefix of the frames, such as "00", once the video stream is known
+	format  []byte // Stream format of the video stream
+	header  DIBHeader
+	data    []byte // The last frame with pixels, which frames without any repeat
+}
+
+// Four-character codes of the YUV frames read
+var aviYUVCodes = []string{"YUY2", "YUYV", "UYVY", "I420", "IYUV", "YV12", "NV12", "Y800", "GREY", "Y8  "}
+
+// Reads the headers of an AVI file up to its first frame
+func newAVISource(r *bufio.Reader) (*aviSource, error) {
+	if _, err := r.Discard(12); err != nil {
+		return nil, err
+	}
+	return &aviSource{r: r}, nil
+}
+
+// Returns the four-character code of a compression field, or its number when it is not printable
+func fourCC(code uint32) string {
+	b := binary.LittleEndian.AppendUint32(nil, code)
+	for _, c := range b {
+		if c < ' ' || c > '~' {
+			return strconv.FormatUint(uint64(code), 10)
+		}
+	}
+	return string(b)
+}
+
+// Takes the stream format of the video stream, checking that its frames can be read
+func (s *aviSource) setFormat(format []byte) error {
+	if len(format) < 40 {
+		return errors.New(msg("video.short_format"))
+	}
+	h := &s.header
+	h.Width = int32(binary.LittleEndian.Uint32(format[4:]))
+	h.Height = int32(binary.LittleEndian.Uint32(format[8:]))
+	h.BitCount = binary.LittleEndian.Uint16(format[14:])
+	h.Compression = binary.LittleEndian.Uint32(format[16:])
+	width, height := int(h.Width), int(h.Height)
+	if height < 0 {
+		height = -height
+	}
+	if err := checkFrameSize(width, height); err != nil {
+		return err
+	}
+	code := fourCC(h.Compression)
+	switch {
+	case h.Compression == 0 || h.Compression == 3:
+	case slices.Contains(aviYUVCodes, code):
+	default:
+		return msgError("error.video_codec", code)
+	}
+	s.format = format
+	return nil
+}
+
+// Returns the bytes of a frame of the video stream, which holds at least that many
+func (s *aviSource) frameSize() int {
+	h := &s.header
+	width, height := int(h.Width), int(max(h.Height, -h.Height))
+	switch fourCC(h.Compression) {
+	case "YUY2", "YUYV", "UYVY":
+		return (width + 1) / 2 * 4 * height
+	case "I420", "IYUV", "YV12", "NV12":
+		cw, ch := chromaSize("420", width, height)
+		return width*height + 2*cw*ch
+	case "Y800", "GREY", "Y8  ":
+		return width * height
+	}
+	return (width*int(h.BitCount) + 31) / 32 * 4 * height
+}
+
+func (s *aviSource) next(decode bool) (*BMPHeader, *DIBHeader, *Image, error) {
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(s.r, chunk[:]); err != nil {
+			if err == io.EOF && s.video == "" {
+				return nil, nil, nil, errors.New(msg("video.no_stream"))
+			}
+			return nil, nil, nil, err
+		}
+		id, size := string(chunk[:4]), int64(binary.LittleEndian.Uint32(chunk[4:]))
+		padded := size + size%2
+
+		switch {
+		case id == "RIFF" || id == "LIST":
+			// The lists that lead to stream headers and frames are entered, others skipped; files over 1 GB
+			// go on in AVIX lists of their own
+			kind := make([]byte, 4)
+			if _, err := io.ReadFull(s.r, kind); err != nil {
+				return nil, nil, nil, io.ErrUnexpectedEOF
+			}
+			switch string(kind) {
+			case "hdrl", "strl", "movi", "rec ", "AVIX":
+				continue
+			}
+			padded -= 4
+		case id == "strh" || id == "strf":
+			data := make([]byte, min(size, 1<<16))
+			if _, err := io.ReadFull(s.r, data); err != nil {
+				return nil, nil, nil, io.ErrUnexpectedEOF
+			}
+			padded -= int64(len(data))
+			if id == "strh" {
+				s.streams++
+				s.kinds = append(s.kinds, 0)
+				if bytes.HasPrefix(data, []byte("vids")) {
+					s.kinds[s.streams-1] = 1
+				}
+			} else if s.video == "" && s.streams > 0 && s.kinds[s.streams-1] == 1 {
+				if err := s.setFormat(data); err != nil {
+					return nil, nil, nil, err
+				}
+				s.video = fmt.Sprintf("%02d", s.streams-1)
+			}
+		case s.video != "" && strings.HasPrefix(id, s.video) && (id[2:] == "db" || id[2:] == "dc"):
+			if size > 0 {
+				if size > int64(2*s.frameSize()+1<<16) {
+					return nil, nil, nil, errors.New(msg("video.large_frame", size))
+				}
+				s.data = make([]byte, padded)
+				if _, err := io.ReadFull(s.r, s.data); err != nil {
+					return nil, nil, nil, io.ErrUnexpectedEOF
+				}
+				s.data = s.data[:size]
+			}
+			// A frame without pixels repeats the one before, as a dropped frame does
+			if !decode || s.data == nil {
+				return nil, nil, nil, nil
+			}
+			return s.decodeFrame()
+		}
+		if _, err := s.r.Discard(int(padded)); err != nil {
+			return nil, nil, nil, io.ErrUnexpectedEOF
+		}
+	}
+}
+
+// Decodes the last frame read. DIB frames go through the BMP decoder behind a file header of their own;
+// YUV frames are converted as studio video.
+func (s *aviSource) decodeFrame() (*BMPHeader, *DIBHeader, *Image, error) {
+	h := &s.header
+	if len(s.data) < s.frameSize() {
+		return nil, nil, nil, errors.New(msg("video.short_frame", len(s.data), s.frameSize()))
+	}
+	width, height := int(h.Width), int(max(h.Height, -h.Height))
+	code := fourCC(h.Compression)
+	if h.Compression == 0 || h.Compression == 3 {
+		file := binary.LittleEndian.AppendUint32([]byte("BM"), uint32(14+len(s.format)+len(s.data)))
+		file = binary.LittleEndian.AppendUint32(file, 0)
+		file = binary.LittleEndian.AppendUint32(file, uint32(14+len(s.format)))
+		file = append(append(file, s.format...), s.data...)
+		bmpHeader, dibHeader, img, err := globalSettings.decodeImage(bytes.NewReader(file))
+		if err != nil {
+			// Reported as damage to the video rather than to a BMP file the user never gave
+			return nil, nil, nil, errors.New(err.Error())
+		}
+		return bmpHeader, dibHeader, img, nil
+	}
+
+	f := &yuvFrame{width: width, height: height, y: s.data[:width*height]}
+	switch code {
+	case "YUY2", "YUYV", "UYVY":
+		// Two pixels share four bytes: both lumas, and one sample of each chroma
+		f.cw, f.ch = (width+1)/2, height
+		f.y, f.cb, f.cr = make([]byte, width*height), make([]byte, f.cw*height), make([]byte, f.cw*height)
+		lumas, cb, cr := [2]int{0, 2}, 1, 3
+		if code == "UYVY" {
+			lumas, cb, cr = [2]int{1, 3}, 0, 2
+		}
+		for y := range height {
+			for i := range f.cw {
+				group := s.data[(y*f.cw+i)*4:]
+				f.y[y*width+2*i] = group[lumas[0]]
+				if 2*i+1 < width {
+					f.y[y*width+2*i+1] = group[lumas[1]]
+				}
+				f.cb[y*f.cw+i], f.cr[y*f.cw+i] = group[cb], group[cr]
+			}
+		}
+	case "I420", "IYUV", "YV12", "NV12":
+		f.cw, f.ch = chromaSize("420", width, height)
+		n, chroma := f.cw*f.ch, s.data[width*height:]
+		switch code {
+		case "YV12":
+			f.cr, f.cb = chroma[:n], chroma[n:2*n]
+		case "NV12":
+			f.cb, f.cr = make([]byte, n), make([]byte, n)
+			for i := range n {
+				f.cb[i], f.cr[i] = chroma[2*i], chroma[2*i+1]
+			}
+		default:
+			f.cb, f.cr = chroma[:n], chroma[n:2*n]
+		}
+	}
+	return &BMPHeader{}, &DIBHeader{}, f.image(), nil
+}
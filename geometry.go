@@ -0,0 +1,97 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Physical units lengths can be given in, as fractions of an inch
+var lengthUnits = map[string]float64{"in": 1, "cm": 1 / 2.54, "mm": 1 / 25.4}
+
+// Characters that separate the width from the height of a size: x, as in 800x600, its capital and the
+// multiplication sign, which keyboard layouts and word processors put in its place
+const sizeSeparators = "xX×"
+
+// One side of a geometry argument: a number of pixels, or a percentage of the image side it is measured
+// along. Physical lengths are converted to pixels when they are parsed.
+type geometryLength struct {
+	value   float64
+	percent bool
+}
+
+// Parses a length shared by the operations that take sizes and offsets: whole pixels (800 or 800px), a
+// percentage of the image side (50% or 12.5%) or a physical length at a resolution (2cm@300dpi,
+// 1.5in@96dpi, 40mm@300dpi). Lengths are never negative; offsets that count back take the sign themselves.
+func parseLength(text string) (geometryLength, bool) {
+	if number, ok := strings.CutSuffix(text, "%"); ok {
+		n, err := strconv.ParseFloat(number, 64)
+		if err != nil || n < 0 || math.IsInf(n, 0) {
+			return geometryLength{}, false
+		}
+		return geometryLength{value: n, percent: true}, true
+	}
+	if length, resolution, found := strings.Cut(text, "@"); found {
+		ppi, err := strconv.ParseFloat(strings.TrimSuffix(resolution, "dpi"), 64)
+		if err != nil || ppi <= 0 || math.IsInf(ppi, 0) {
+			return geometryLength{}, false
+		}
+		for unit, inches := range lengthUnits {
+			if number, ok := strings.CutSuffix(length, unit); ok {
+				n, err := strconv.ParseFloat(number, 64)
+				if err != nil || n < 0 || n*inches*ppi > math.MaxInt32 {
+					return geometryLength{}, false
+				}
+				return geometryLength{value: math.Round(n * inches * ppi)}, true
+			}
+		}
+		return geometryLength{}, false
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(text, "px"))
+	if err != nil || n < 0 {
+		return geometryLength{}, false
+	}
+	return geometryLength{value: float64(n)}, true
+}
+
+// Resolves the length to pixels along a side of the given length, rounding percentages down
+func (l geometryLength) pixels(side int) int {
+	if l.percent {
+		return int(l.value * float64(side) / 100)
+	}
+	return int(l.value)
+}
+
+// Parses a size of the form WxH, with 800X600 and 800×600 accepted as well and each side a length as
+// parseLength reads it. A single percentage, such as 50%, sizes both sides. A physical size gives its
+// resolution once at the end, and a width without a unit takes that of the height: 10x15cm@300dpi.
+func parseGeometry(value string) (width, height geometryLength, ok bool) {
+	size, resolution, physical := strings.Cut(value, "@")
+	i := strings.IndexAny(size, sizeSeparators)
+	if i < 0 {
+		width, ok = parseLength(value)
+		return width, width, ok && width.percent
+	}
+	_, n := utf8.DecodeRuneInString(size[i:])
+	w, h := size[:i], size[i+n:]
+	if physical {
+		if strings.TrimLeft(w, "0123456789.") == "" {
+			w += strings.TrimLeft(h, "0123456789.")
+		}
+		w, h = w+"@"+resolution, h+"@"+resolution
+	}
+	width, okW := parseLength(w)
+	height, okH := parseLength(h)
+	return width, height, okW && okH
+}
+
+// Parses a size in pixels with positive sides, given as parseGeometry reads it but without percentages,
+// which only operations that know the image size can resolve
+func parseSize(value string) (width, height int, ok bool) {
+	w, h, ok := parseGeometry(value)
+	if !ok || w.percent || h.percent || w.value <= 0 || h.value <= 0 {
+		return 0, 0, false
+	}
+	return int(w.value), int(h.value), true
+}
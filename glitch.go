@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Directions --pixelsort sorts along
+var sortDirections = []string{"horizontal", "vertical"}
+
+// Seed --rowshift uses when none is given, so that runs repeat unless asked otherwise
+const defaultShiftSeed = 1
+
+// Parses a --pixelsort value of the form threshold[,direction]
+func parsePixelSort(value string) (threshold int, direction string, err error) {
+	t, direction, found := strings.Cut(value, ",")
+	if !found {
+		direction = "horizontal"
+	}
+	threshold, err = strconv.Atoi(t)
+	if err != nil || threshold < 0 || threshold > 255 || !slices.Contains(sortDirections, direction) {
+		return 0, "", msgError("error.invalid_pixelsort", value)
+	}
+	return threshold, direction, nil
+}
+
+// Parses a --rowshift value of the form amount[:seed]
+func parseRowShift(value string) (amount int, seed uint64, err error) {
+	a, s, found := strings.Cut(value, ":")
+	amount, err = strconv.Atoi(a)
+	seed = defaultShiftSeed
+	if err == nil && found {
+		seed, err = strconv.ParseUint(s, 10, 64)
+	}
+	if err != nil || amount < 1 {
+		return 0, 0, msgError("error.invalid_rowshift", value)
+	}
+	return amount, seed, nil
+}
+
+// Sorts every run of pixels brighter than the threshold along rows or columns by luminance, darkest
+// first, going left to right or top to bottom. Darker pixels stay in place and break the runs, which
+// gives the streaks of the pixel sorting effect. Alpha moves with the pixels.
+func applyPixelSort(img *Image, threshold int, direction string, progress rowProgress) *Image {
+	result := &Image{Width: img.Width, Height: img.Height, Pixels: slices.Clone(img.Pixels), Alpha: slices.Clone(img.Alpha), Gap: img.Gap, Palette: img.Palette}
+	// Lines are rows for horizontal sorting and columns for vertical sorting; index returns where the
+	// k-th pixel of line j is stored, counting columns from the left and rows from the top
+	lines, length := img.Height, img.Width
+	index := func(j, k int) int { return (img.Height-1-j)*img.Width + k }
+	if direction == "vertical" {
+		lines, length = img.Width, img.Height
+		index = func(j, k int) int { return (img.Height-1-k)*img.Width + j }
+	}
+
+	type entry struct {
+		pixel Pixel
+		alpha byte
+	}
+	var run []entry
+	for j := 0; j < lines; j++ {
+		for start := 0; start < length; {
+			if img.Pixels[index(j, start)].Luminance() <= threshold*1000 {
+				start++
+				continue
+			}
+			end := start
+			run = run[:0]
+			for end < length && img.Pixels[index(j, end)].Luminance() > threshold*1000 {
+				i := index(j, end)
+				run = append(run, entry{pixel: img.Pixels[i], alpha: alphaAt(img, i)})
+				end++
+			}
+			slices.SortStableFunc(run, func(a, b entry) int { return a.pixel.Luminance() - b.pixel.Luminance() })
+			for k, e := range run {
+				i := index(j, start+k)
+				result.Pixels[i] = e.pixel
+				if result.Alpha != nil {
+					result.Alpha[i] = e.alpha
+				}
+			}
+			start = end
+		}
+		progress.Report(j+1, lines)
+	}
+	return result
+}
+
+// Shifts every row sideways by a random number of pixels from -amount to amount, wrapping around the
+// edges. The offsets are drawn from the top row down with a generator seeded by seed, so the same seed
+// glitches an image the same way every time.
+func applyRowShift(img *Image, amount int, seed uint64, progress rowProgress) *Image {
+	result := &Image{Width: img.Width, Height: img.Height, Pixels: make([]Pixel, len(img.Pixels)), Gap: img.Gap, Palette: img.Palette}
+	if img.Alpha != nil {
+		result.Alpha = make([]byte, len(img.Alpha))
+	}
+	random := rand.New(rand.NewPCG(seed, seed))
+	for y := 0; y < img.Height; y++ {
+		shift := random.IntN(2*amount+1) - amount
+		row := (img.Height - 1 - y) * img.Width
+		for x := 0; x < img.Width; x++ {
+			to := row + ((x+shift)%img.Width+img.Width)%img.Width
+			result.Pixels[to] = img.Pixels[row+x]
+			if result.Alpha != nil {
+				result.Alpha[to] = img.Alpha[row+x]
+			}
+		}
+		progress.Report(y+1, img.Height)
+	}
+	return result
+}
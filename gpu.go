@@ -0,0 +1,418 @@
+//go:build gpu && cgo && (linux || darwin || freebsd)
+
+package main
+
+/*
+#cgo linux LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdint.h>
+#include <stdlib.h>
+
+// The OpenCL entry points are looked up in the library at run time, so that the binary builds without the
+// OpenCL headers and starts on machines without a driver
+typedef int32_t cl_int;
+typedef uint32_t cl_uint;
+typedef uint64_t cl_ulong;
+typedef void *cl_obj;
+
+#define CL_DEVICE_TYPE_GPU (1 << 2)
+#define CL_DEVICE_NAME 0x102B
+#define CL_MEM_WRITE_ONLY (1 << 1)
+#define CL_MEM_READ_ONLY (1 << 2)
+#define CL_MEM_READ_WRITE (1 << 0)
+#define CL_MEM_COPY_HOST_PTR (1 << 5)
+
+static cl_int (*clGetPlatformIDs_)(cl_uint, cl_obj *, cl_uint *);
+static cl_int (*clGetDeviceIDs_)(cl_obj, cl_ulong, cl_uint, cl_obj *, cl_uint *);
+static cl_int (*clGetDeviceInfo_)(cl_obj, cl_uint, size_t, void *, size_t *);
+static cl_obj (*clCreateContext_)(const intptr_t *, cl_uint, const cl_obj *, void *, void *, cl_int *);
+static cl_obj (*clCreateCommandQueue_)(cl_obj, cl_obj, cl_ulong, cl_int *);
+static cl_obj (*clCreateProgramWithSource_)(cl_obj, cl_uint, const char **, const size_t *, cl_int *);
+static cl_int (*clBuildProgram_)(cl_obj, cl_uint, const cl_obj *, const char *, void *, void *);
+static cl_obj (*clCreateKernel_)(cl_obj, const char *, cl_int *);
+static cl_obj (*clCreateBuffer_)(cl_obj, cl_ulong, size_t, void *, cl_int *);
+static cl_int (*clSetKernelArg_)(cl_obj, cl_uint, size_t, const void *);
+static cl_int (*clEnqueueNDRangeKernel_)(cl_obj, cl_obj, cl_uint, const size_t *, const size_t *, const size_t *, cl_uint, const void *, void *);
+static cl_int (*clEnqueueReadBuffer_)(cl_obj, cl_obj, cl_uint, size_t, size_t, void *, cl_uint, const void *, void *);
+static cl_int (*clReleaseMemObject_)(cl_obj);
+static cl_int (*clReleaseKernel_)(cl_obj);
+
+static cl_obj device, context, queue, program;
+
+// Stage of cl_open that failed, for messages
+static const char *cl_stage = "";
+
+static const char *cl_failed_stage(void) { return cl_stage; }
+
+#define LOAD(name) if (!(name##_ = dlsym(lib, #name))) { cl_stage = #name; return -1; }
+
+// Loads the library, picks the first GPU and builds the kernels. Returns 0, -1 when the library lacks an
+// entry point, or the OpenCL error of cl_stage.
+static cl_int cl_open(const char *library, const char *source, char *name, size_t name_size) {
+	void *lib = dlopen(library, RTLD_NOW | RTLD_LOCAL);
+	if (!lib) {
+		cl_stage = "dlopen";
+		return -1;
+	}
+	LOAD(clGetPlatformIDs) LOAD(clGetDeviceIDs) LOAD(clGetDeviceInfo) LOAD(clCreateContext)
+	LOAD(clCreateCommandQueue) LOAD(clCreateProgramWithSource) LOAD(clBuildProgram) LOAD(clCreateKernel)
+	LOAD(clCreateBuffer) LOAD(clSetKernelArg) LOAD(clEnqueueNDRangeKernel) LOAD(clEnqueueReadBuffer)
+	LOAD(clReleaseMemObject) LOAD(clReleaseKernel)
+
+	cl_obj platforms[8];
+	cl_uint count = 0;
+	cl_int err = clGetPlatformIDs_(8, platforms, &count);
+	if (err != 0) {
+		cl_stage = "clGetPlatformIDs";
+		return err;
+	}
+	err = -1;
+	for (cl_uint i = 0; i < count && err != 0; i++) {
+		cl_uint devices = 0;
+		err = clGetDeviceIDs_(platforms[i], CL_DEVICE_TYPE_GPU, 1, &device, &devices);
+	}
+	if (err != 0) {
+		cl_stage = "clGetDeviceIDs";
+		return err;
+	}
+	clGetDeviceInfo_(device, CL_DEVICE_NAME, name_size, name, NULL);
+
+	context = clCreateContext_(NULL, 1, &device, NULL, NULL, &err);
+	if (err != 0) {
+		cl_stage = "clCreateContext";
+		return err;
+	}
+	queue = clCreateCommandQueue_(context, device, 0, &err);
+	if (err != 0) {
+		cl_stage = "clCreateCommandQueue";
+		return err;
+	}
+	program = clCreateProgramWithSource_(context, 1, &source, NULL, &err);
+	if (err != 0) {
+		cl_stage = "clCreateProgramWithSource";
+		return err;
+	}
+	if ((err = clBuildProgram_(program, 1, &device, NULL, NULL, NULL)) != 0) {
+		cl_stage = "clBuildProgram";
+		return err;
+	}
+	return 0;
+}
+
+// Buffers and the kernel of one run, released together
+typedef struct {
+	cl_obj kernel;
+	cl_obj buffers[8];
+	int count;
+} cl_run;
+
+static void cl_release(cl_run *run) {
+	for (int i = 0; i < run->count; i++) {
+		clReleaseMemObject_(run->buffers[i]);
+	}
+	if (run->kernel) {
+		clReleaseKernel_(run->kernel);
+	}
+}
+
+// Creates a device buffer, filled from data when it is set, and stores it as kernel argument arg
+static cl_int cl_buffer(cl_run *run, cl_obj kernel, cl_uint arg, cl_ulong flags, size_t size, void *data) {
+	cl_int err;
+	if (data) {
+		flags |= CL_MEM_COPY_HOST_PTR;
+	}
+	cl_obj buffer = clCreateBuffer_(context, flags, size, data, &err);
+	if (err != 0) {
+		return err;
+	}
+	run->buffers[run->count++] = buffer;
+	return clSetKernelArg_(kernel, arg, sizeof(cl_obj), &buffer);
+}
+
+// Runs a kernel over width by height items and reads the result buffer back into out
+static cl_int cl_launch(cl_obj kernel, size_t width, size_t height, cl_obj result, void *out, size_t size) {
+	size_t global[2] = {width, height};
+	cl_int err = clEnqueueNDRangeKernel_(queue, kernel, height > 1 ? 2 : 1, NULL, global, NULL, 0, NULL, NULL);
+	if (err != 0) {
+		return err;
+	}
+	return clEnqueueReadBuffer_(queue, result, 1, 0, size, out, 0, NULL, NULL);
+}
+
+static cl_int cl_filter(uint8_t *in, uint8_t *out, size_t n, int mode, float *linear, float *thresholds, float *weights) {
+	cl_run run = {0};
+	cl_int err;
+	run.kernel = clCreateKernel_(program, "filter", &err);
+	if (err == 0) err = cl_buffer(&run, run.kernel, 0, CL_MEM_READ_ONLY, n * 3, in);
+	if (err == 0) err = cl_buffer(&run, run.kernel, 1, CL_MEM_WRITE_ONLY, n * 3, NULL);
+	if (err == 0) err = clSetKernelArg_(run.kernel, 2, sizeof(int), &mode);
+	if (err == 0) err = cl_buffer(&run, run.kernel, 3, CL_MEM_READ_ONLY, 256 * sizeof(float), linear);
+	if (err == 0) err = cl_buffer(&run, run.kernel, 4, CL_MEM_READ_ONLY, 255 * sizeof(float), thresholds);
+	if (err == 0) err = cl_buffer(&run, run.kernel, 5, CL_MEM_READ_ONLY, 3 * sizeof(float), weights);
+	if (err == 0) err = cl_launch(run.kernel, n, 1, run.buffers[1], out, n * 3);
+	cl_release(&run);
+	return err;
+}
+
+static cl_int cl_convolve(uint8_t *in, float *out, int width, int height, float *weights, int size, int edge) {
+	cl_run run = {0};
+	cl_int err;
+	size_t n = (size_t)width * height;
+	run.kernel = clCreateKernel_(program, "convolve", &err);
+	if (err == 0) err = cl_buffer(&run, run.kernel, 0, CL_MEM_READ_ONLY, n * 3, in);
+	if (err == 0) err = cl_buffer(&run, run.kernel, 1, CL_MEM_WRITE_ONLY, n * 3 * sizeof(float), NULL);
+	if (err == 0) err = clSetKernelArg_(run.kernel, 2, sizeof(int), &width);
+	if (err == 0) err = clSetKernelArg_(run.kernel, 3, sizeof(int), &height);
+	if (err == 0) err = cl_buffer(&run, run.kernel, 4, CL_MEM_READ_ONLY, (size_t)size * size * sizeof(float), weights);
+	if (err == 0) err = clSetKernelArg_(run.kernel, 5, sizeof(int), &size);
+	if (err == 0) err = clSetKernelArg_(run.kernel, 6, sizeof(int), &edge);
+	if (err == 0) err = cl_launch(run.kernel, width, height, run.buffers[1], out, n * 3 * sizeof(float));
+	cl_release(&run);
+	return err;
+}
+
+// Sets up one resampling pass of a kernel from the device buffer in to a new one returned in out, with the
+// taps of the axis it resamples
+static cl_int cl_resample_pass(cl_run *run, const char *name, cl_obj in, int in_width, int out_width, int out_height,
+		int32_t *start, int starts, int32_t *index, float *weight, int taps, cl_obj *out) {
+	cl_int err;
+	run->kernel = clCreateKernel_(program, name, &err);
+	if (err == 0) err = clSetKernelArg_(run->kernel, 0, sizeof(cl_obj), &in);
+	if (err == 0) err = cl_buffer(run, run->kernel, 1, CL_MEM_READ_WRITE, (size_t)out_width * out_height * 4 * sizeof(float), NULL);
+	if (err == 0) *out = run->buffers[run->count - 1];
+	if (err == 0) err = clSetKernelArg_(run->kernel, 2, sizeof(int), &in_width);
+	if (err == 0) err = clSetKernelArg_(run->kernel, 3, sizeof(int), &out_width);
+	if (err == 0) err = cl_buffer(run, run->kernel, 4, CL_MEM_READ_ONLY, starts * sizeof(int32_t), start);
+	if (err == 0) err = cl_buffer(run, run->kernel, 5, CL_MEM_READ_ONLY, taps * sizeof(int32_t), index);
+	if (err == 0) err = cl_buffer(run, run->kernel, 6, CL_MEM_READ_ONLY, taps * sizeof(float), weight);
+	return err;
+}
+
+static cl_int cl_resample(float *in, float *out, int width, int height, int out_width, int out_height,
+		int32_t *col_start, int32_t *col_index, float *col_weight, int col_taps,
+		int32_t *row_start, int32_t *row_index, float *row_weight, int row_taps) {
+	cl_run source = {0}, first = {0}, second = {0};
+	cl_obj src = NULL, scaled = NULL, result = NULL;
+	cl_int err;
+	src = clCreateBuffer_(context, CL_MEM_READ_ONLY | CL_MEM_COPY_HOST_PTR, (size_t)width * height * 4 * sizeof(float), in, &err);
+	if (err == 0) source.buffers[source.count++] = src;
+	if (err == 0) err = cl_resample_pass(&first, "resample_rows", src, width, out_width, height,
+		col_start, out_width + 1, col_index, col_weight, col_taps, &scaled);
+	if (err == 0) {
+		size_t global[2] = {out_width, height};
+		err = clEnqueueNDRangeKernel_(queue, first.kernel, 2, NULL, global, NULL, 0, NULL, NULL);
+	}
+	if (err == 0) err = cl_resample_pass(&second, "resample_columns", scaled, out_width, out_width, out_height,
+		row_start, out_height + 1, row_index, row_weight, row_taps, &result);
+	if (err == 0) err = cl_launch(second.kernel, out_width, out_height, result, out, (size_t)out_width * out_height * 4 * sizeof(float));
+	cl_release(&second);
+	cl_release(&first);
+	cl_release(&source);
+	return err;
+}
+*/
+import "C"
+
+import (
+	"slices"
+	"sync"
+	"unsafe"
+
+	"creditcard/bmp"
+)
+
+// Reports whether this build has a GPU backend for --backend=gpu
+const gpuBuilt = true
+
+// OpenCL libraries tried in turn, from the usual name of the loader to the macOS framework
+var openCLLibraries = []string{"libOpenCL.so.1", "libOpenCL.so", "/System/Library/Frameworks/OpenCL.framework/OpenCL"}
+
+// Kernels of the OpenCL backend. They mirror the CPU code of pixelFilters, convolveChannels and
+// resizeBilinear, in single precision.
+const openCLSource = `
+__kernel void filter(__global const uchar *in, __global uchar *out, int mode,
+		__constant float *linear, __constant float *thresholds, __constant float *weights) {
+	size_t i = get_global_id(0) * 3;
+	uchar b = in[i], g = in[i + 1], r = in[i + 2];
+	uchar3 c = (uchar3)(0, 0, 0);
+	if (mode == 0) {
+		c.x = b;
+	} else if (mode == 1) {
+		c.z = r;
+	} else if (mode == 2) {
+		c.y = g;
+	} else if (mode == 3) {
+		float y = weights[0] * linear[r] + weights[1] * linear[g] + weights[2] * linear[b];
+		int lo = 0, hi = 255;
+		while (lo < hi) {
+			int mid = (lo + hi) / 2;
+			if (thresholds[mid] > y) {
+				hi = mid;
+			} else {
+				lo = mid + 1;
+			}
+		}
+		c = (uchar3)((uchar)lo, (uchar)lo, (uchar)lo);
+	} else {
+		c = (uchar3)((uchar)(255 - b), (uchar)(255 - g), (uchar)(255 - r));
+	}
+	out[i] = c.x;
+	out[i + 1] = c.y;
+	out[i + 2] = c.z;
+}
+
+int edge_index(int i, int n, int edge) {
+	if (i >= 0 && i < n) {
+		return i;
+	}
+	if (edge == 1) {
+		return (i % n + n) % n;
+	}
+	if (edge == 2) {
+		if (n == 1) {
+			return 0;
+		}
+		int period = 2 * (n - 1);
+		i = (i % period + period) % period;
+		return i >= n ? period - i : i;
+	}
+	return clamp(i, 0, n - 1);
+}
+
+__kernel void convolve(__global const uchar *in, __global float *out, int width, int height,
+		__constant float *weights, int size, int edge) {
+	int x = get_global_id(0), y = get_global_id(1), reach = size / 2;
+	float3 sum = (float3)(0.0f, 0.0f, 0.0f);
+	for (int ky = 0; ky < size; ky++) {
+		int row = edge_index(y + reach - ky, height, edge) * width;
+		for (int kx = 0; kx < size; kx++) {
+			float w = weights[ky * size + kx];
+			if (w != 0) {
+				int p = (row + edge_index(x + kx - reach, width, edge)) * 3;
+				sum += w * (float3)((float)in[p], (float)in[p + 1], (float)in[p + 2]);
+			}
+		}
+	}
+	int o = (y * width + x) * 3;
+	out[o] = sum.x;
+	out[o + 1] = sum.y;
+	out[o + 2] = sum.z;
+}
+
+__kernel void resample_rows(__global const float4 *in, __global float4 *out, int in_width, int out_width,
+		__global const int *start, __global const int *index, __global const float *weight) {
+	int x = get_global_id(0), y = get_global_id(1);
+	float4 c = (float4)(0.0f, 0.0f, 0.0f, 0.0f);
+	for (int t = start[x]; t < start[x + 1]; t++) {
+		c += weight[t] * in[y * in_width + index[t]];
+	}
+	out[y * out_width + x] = c;
+}
+
+__kernel void resample_columns(__global const float4 *in, __global float4 *out, int in_width, int out_width,
+		__global const int *start, __global const int *index, __global const float *weight) {
+	int x = get_global_id(0), y = get_global_id(1);
+	float4 c = (float4)(0.0f, 0.0f, 0.0f, 0.0f);
+	for (int t = start[y]; t < start[y + 1]; t++) {
+		c += weight[t] * in[index[t] * in_width + x];
+	}
+	out[y * out_width + x] = c;
+}
+`
+
+// The OpenCL backend. OpenCL queues are not shared across threads here, so runs take turns.
+type openCL struct {
+	sync.Mutex
+	name       string
+	linear     []float32
+	thresholds []float32
+	weights    [3]float32
+	failed     sync.Once
+}
+
+// Loads OpenCL and builds the kernels for the first GPU found
+func openGPU() (bmp.Accelerator, error) {
+	source := C.CString(openCLSource)
+	defer C.free(unsafe.Pointer(source))
+	name := make([]byte, 256)
+	var err error
+	for _, library := range openCLLibraries {
+		lib := C.CString(library)
+		code := C.cl_open(lib, source, (*C.char)(unsafe.Pointer(&name[0])), C.size_t(len(name)))
+		C.free(unsafe.Pointer(lib))
+		stage := C.GoString(C.cl_failed_stage())
+		switch {
+		case code == 0:
+			gpu := &openCL{name: C.GoString((*C.char)(unsafe.Pointer(&name[0])))}
+			gpu.linear, gpu.thresholds, gpu.weights = bmp.GrayTables()
+			return gpu, nil
+		case stage == "dlopen":
+			err = msgError("error.gpu_library")
+			continue
+		case code == -1:
+			return nil, msgError("error.gpu_symbol", library, stage)
+		}
+		return nil, msgError("error.gpu_setup", stage, int(code))
+	}
+	return nil, err
+}
+
+func (g *openCL) Name() string { return g.name }
+
+// Reports a failed run once, after which the work that fails goes back to the CPU without a word
+func (g *openCL) fail(kernel string, code C.cl_int) bool {
+	g.failed.Do(func() { printWarning(msgError("warning.gpu_failed", kernel, int(code))) })
+	return false
+}
+
+func (g *openCL) Filter(pixels, result []Pixel, filter string) bool {
+	mode, ok := bmp.FilterIndex(filter)
+	if !ok || len(pixels) == 0 {
+		return false
+	}
+	g.Lock()
+	defer g.Unlock()
+	code := C.cl_filter((*C.uint8_t)(unsafe.Pointer(&pixels[0])), (*C.uint8_t)(unsafe.Pointer(&result[0])), C.size_t(len(pixels)),
+		C.int(mode), (*C.float)(&g.linear[0]), (*C.float)(&g.thresholds[0]), (*C.float)(&g.weights[0]))
+	if code != 0 {
+		return g.fail("filter", code)
+	}
+	return true
+}
+
+func (g *openCL) Convolve(pixels []Pixel, width, height int, kernel []float32, edge string) ([][3]float32, bool) {
+	mode := slices.Index(bmp.EdgeModes, edge)
+	if mode < 0 || len(pixels) == 0 {
+		return nil, false
+	}
+	size := 1
+	for size*size < len(kernel) {
+		size++
+	}
+	result := make([][3]float32, len(pixels))
+	g.Lock()
+	defer g.Unlock()
+	code := C.cl_convolve((*C.uint8_t)(unsafe.Pointer(&pixels[0])), (*C.float)(&result[0][0]), C.int(width), C.int(height),
+		(*C.float)(&kernel[0]), C.int(size), C.int(mode))
+	if code != 0 {
+		return nil, g.fail("convolve", code)
+	}
+	return result, true
+}
+
+func (g *openCL) Resample(src []float32, width, height int, columns, rows bmp.Taps) ([]float32, bool) {
+	outWidth, outHeight := len(columns.Start)-1, len(rows.Start)-1
+	if len(src) == 0 || len(columns.Index) == 0 || len(rows.Index) == 0 {
+		return nil, false
+	}
+	result := make([]float32, outWidth*outHeight*4)
+	g.Lock()
+	defer g.Unlock()
+	code := C.cl_resample((*C.float)(&src[0]), (*C.float)(&result[0]), C.int(width), C.int(height), C.int(outWidth), C.int(outHeight),
+		(*C.int32_t)(&columns.Start[0]), (*C.int32_t)(&columns.Index[0]), (*C.float)(&columns.Weight[0]), C.int(len(columns.Index)),
+		(*C.int32_t)(&rows.Start[0]), (*C.int32_t)(&rows.Index[0]), (*C.float)(&rows.Weight[0]), C.int(len(rows.Index)))
+	if code != 0 {
+		return nil, g.fail("resample", code)
+	}
+	return result, true
+}
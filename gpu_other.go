@@ -0,0 +1,13 @@
+//go:build !(gpu && cgo && (linux || darwin || freebsd))
+
+package main
+
+import "creditcard/bmp"
+
+// Reports whether this build has a GPU backend for --backend=gpu
+const gpuBuilt = false
+
+// Builds without the gpu tag run everything on the CPU
+func openGPU() (bmp.Accelerator, error) {
+	return nil, msgError("error.gpu_not_built")
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"creditcard/bmp"
+)
+
+// Formats the header command prints in
+var headerFormats = []string{"text", "json", "yaml"}
+
+// Fields of the BMP file header as printed by header --format=json or yaml
+type bmpHeaderInfo struct {
+	FileType   string `json:"file_type"`
+	FileSize   uint32 `json:"file_size"`
+	Reserved   uint32 `json:"reserved"`
+	PixelStart uint32 `json:"pixel_offset"`
+}
+
+// Fields of the DIB header; the ones a header version lacks are zero
+type dibHeaderInfo struct {
+	HeaderSize      uint32    `json:"header_size"`
+	Width           int32     `json:"width"`
+	Height          int32     `json:"height"`
+	Planes          uint16    `json:"planes"`
+	BitCount        uint16    `json:"bit_count"`
+	Compression     uint32    `json:"compression"`
+	ImageSize       uint32    `json:"image_size"`
+	XPixelsPerMeter int32     `json:"x_pixels_per_meter"`
+	YPixelsPerMeter int32     `json:"y_pixels_per_meter"`
+	ColorsUsed      uint32    `json:"colors_used"`
+	ColorsImportant uint32    `json:"colors_important"`
+	RedMask         uint32    `json:"red_mask"`
+	GreenMask       uint32    `json:"green_mask"`
+	BlueMask        uint32    `json:"blue_mask"`
+	AlphaMask       uint32    `json:"alpha_mask"`
+	ColorSpace      string    `json:"color_space"`
+	Endpoints       [9]int32  `json:"endpoints"`
+	Gamma           [3]uint32 `json:"gamma"`
+	Intent          uint32    `json:"rendering_intent"`
+	ProfileOffset   uint32    `json:"profile_offset"`
+	ProfileSize     uint32    `json:"profile_size"`
+}
+
+// Values computed from the headers
+type layoutInfo struct {
+	TopDown bool `json:"top_down"`
+	// Bytes per row of uncompressed pixel data, including the padding to a multiple of 4 bytes
+	RowStride    int `json:"row_stride"`
+	PaddingBytes int `json:"padding_bytes"` // Padding at the end of every row
+	PixelBytes   int `json:"pixel_data_size"`
+	PaletteSize  int `json:"palette_size"` // Entries of the color table, 0 for true-color images
+	// Resolution in dots per inch, rounded to a tenth
+	XDPI float64 `json:"x_dpi"`
+	YDPI float64 `json:"y_dpi"`
+}
+
+// What an embedded ICC profile says about itself
+type profileInfo struct {
+	Size        int    `json:"size"`
+	Version     string `json:"version"`
+	DeviceClass string `json:"device_class"`
+	ColorSpace  string `json:"color_space"`
+	Description string `json:"description"`
+}
+
+// Everything header --format=json or yaml prints about one image
+type headerInfo struct {
+	BMP     bmpHeaderInfo `json:"bmp"`
+	DIB     dibHeaderInfo `json:"dib"`
+	Layout  layoutInfo    `json:"layout"`
+	Profile *profileInfo  `json:"profile,omitempty"` // Only for files that embed one
+}
+
+// One image of a bitmap array, with the array header fields in front of its own headers
+type arrayImageInfo struct {
+	Offset        int64  `json:"offset"`
+	DisplayWidth  uint16 `json:"display_width"`
+	DisplayHeight uint16 `json:"display_height"`
+	headerInfo
+}
+
+// Images of a bitmap array
+type arrayInfo struct {
+	Images []arrayImageInfo `json:"images"`
+}
+
+// Collects the header fields of an image along with the values computed from them
+func newHeaderInfo(bmpHeader *BMPHeader, dib *DIBHeader) headerInfo {
+	info := headerInfo{
+		BMP: bmpHeaderInfo{
+			FileType:   string(bmpHeader.FileType[:]),
+			FileSize:   bmpHeader.FileSize,
+			Reserved:   bmpHeader.Reserved,
+			PixelStart: bmpHeader.OffsetData,
+		},
+		DIB: dibHeaderInfo{
+			HeaderSize:      dib.DibHeaderSize,
+			Width:           dib.Width,
+			Height:          dib.Height,
+			Planes:          dib.Planes,
+			BitCount:        dib.BitCount,
+			Compression:     dib.Compression,
+			ImageSize:       dib.ImageSize,
+			XPixelsPerMeter: dib.XPixelsPerM,
+			YPixelsPerMeter: dib.YPixelsPerM,
+			ColorsUsed:      dib.ColorsUsed,
+			ColorsImportant: dib.ColorsImp,
+			RedMask:         dib.RedMask,
+			GreenMask:       dib.GreenMask,
+			BlueMask:        dib.BlueMask,
+			AlphaMask:       dib.AlphaMask,
+			Endpoints:       dib.Endpoints,
+			Gamma:           dib.Gamma,
+			Intent:          dib.Intent,
+			ProfileOffset:   dib.ProfileData,
+			ProfileSize:     dib.ProfileSize,
+		},
+	}
+	if dib.DibHeaderSize >= 108 {
+		info.DIB.ColorSpace = dib.ColorSpaceName()
+	}
+
+	height := int(dib.Height)
+	if height < 0 {
+		height = -height
+		info.Layout.TopDown = true
+	}
+	info.Layout.RowStride = dib.RowStride()
+	info.Layout.XDPI, info.Layout.YDPI = dotsPerInch(dib.XPixelsPerM), dotsPerInch(dib.YPixelsPerM)
+	info.Layout.PaddingBytes = info.Layout.RowStride - (int(dib.Width)*int(dib.BitCount)+7)/8
+	info.Layout.PixelBytes = info.Layout.RowStride * height
+	if dib.BitCount <= 8 {
+		info.Layout.PaletteSize = int(dib.ColorsUsed)
+		if info.Layout.PaletteSize == 0 {
+			info.Layout.PaletteSize = 1 << dib.BitCount
+		}
+	}
+	return info
+}
+
+// Prints the headers of a BMP file along with its color profile, or the headers of every image when entries
+// holds a bitmap array, in the given format
+func writeHeaders(w io.Writer, format string, bmpHeader *BMPHeader, dibHeader *DIBHeader, profile []byte, entries []bmp.ArrayEntry) error {
+	if format == "" || format == "text" {
+		table := newTableWriter(w)
+		if entries != nil {
+			printArray(table, entries)
+		} else {
+			printHeader(table, bmpHeader, dibHeader, profile)
+		}
+		return table.Flush()
+	}
+
+	var value any
+	if entries != nil {
+		array := arrayInfo{Images: make([]arrayImageInfo, len(entries))}
+		for i, entry := range entries {
+			array.Images[i] = arrayImageInfo{
+				Offset:        entry.Offset,
+				DisplayWidth:  entry.Array.DisplayWidth,
+				DisplayHeight: entry.Array.DisplayHeight,
+				headerInfo:    newHeaderInfo(&entry.BMP, &entry.DIB),
+			}
+		}
+		value = array
+	} else {
+		info := newHeaderInfo(bmpHeader, dibHeader)
+		if profile != nil {
+			parsed := bmp.ParseProfile(profile)
+			info.Profile = &profileInfo{Size: parsed.Size, Version: parsed.Version, DeviceClass: parsed.Class,
+				ColorSpace: parsed.ColorSpace, Description: parsed.Description}
+		}
+		value = info
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(value); err != nil {
+			return msgError("error.write_output", err)
+		}
+		return nil
+	}
+	var out strings.Builder
+	writeYAML(&out, reflect.ValueOf(value), "")
+	if _, err := io.WriteString(w, out.String()); err != nil {
+		return msgError("error.write_output", err)
+	}
+	return nil
+}
+
+// Writes a struct of numbers, strings, arrays and nested structs as YAML block mappings, naming the fields
+// after their json tags. Embedded structs are written inline.
+func writeYAML(out *strings.Builder, v reflect.Value, indent string) {
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		if field.Anonymous {
+			writeYAML(out, value, indent)
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch value.Kind() {
+		case reflect.Pointer:
+			// Optional sections are left out when missing
+			if !value.IsNil() {
+				fmt.Fprintf(out, "%s%s:\n", indent, name)
+				writeYAML(out, value.Elem(), indent+"  ")
+			}
+		case reflect.Struct:
+			fmt.Fprintf(out, "%s%s:\n", indent, name)
+			writeYAML(out, value, indent+"  ")
+		case reflect.Array:
+			items := make([]string, value.Len())
+			for k := range items {
+				items[k] = yamlScalar(value.Index(k))
+			}
+			fmt.Fprintf(out, "%s%s: [%s]\n", indent, name, strings.Join(items, ", "))
+		case reflect.Slice:
+			fmt.Fprintf(out, "%s%s:\n", indent, name)
+			for k := 0; k < value.Len(); k++ {
+				// The first field of every item follows the dash, the others line up under it
+				var item strings.Builder
+				writeYAML(&item, value.Index(k), indent+"  ")
+				fmt.Fprintf(out, "%s- %s", indent, strings.TrimPrefix(item.String(), indent+"  "))
+			}
+		default:
+			fmt.Fprintf(out, "%s%s: %s\n", indent, name, yamlScalar(value))
+		}
+	}
+}
+
+// Formats a number, boolean or string; strings are quoted so that YAML keeps them as text
+func yamlScalar(v reflect.Value) string {
+	if v.Kind() == reflect.String {
+		return strconv.Quote(v.String())
+	}
+	return fmt.Sprint(v.Interface())
+}
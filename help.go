@@ -0,0 +1,524 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Describes a top-level command for help and man page generation
+type Command struct {
+	Name    string
+	Usage   string
+	Summary string
+	Help    func()
+}
+
+// Commands in the order they are listed by the general help
+var commands = []Command{
+	{Name: "header", Usage: "bitmap header [--format=<text|json|yaml>] <source_file>", Summary: "prints bitmap file header information", Help: displayHeaderHelp},
+	{Name: "apply", Usage: "bitmap apply [options] <source_file> [<output_file>] [--output=<file>[:WxH]]...", Summary: "applies processing to the image and saves it to the file", Help: displayApplyHelp},
+	{Name: "tune", Usage: "bitmap tune [options] <source_file>", Summary: "starts a local web UI to tune options with a live preview", Help: displayTuneHelp},
+	{Name: "batch", Usage: "bitmap batch [options] <input_dir> <output_dir>", Summary: "applies options to every BMP file in a directory", Help: displayBatchHelp},
+	{Name: "run", Usage: "bitmap run [options] <jobs_file>", Summary: "runs the jobs of a JSON Lines file, each an input, options and an output", Help: displayRunHelp},
+	{Name: "serve", Usage: "bitmap serve [options]", Summary: "serves the apply pipeline over HTTP", Help: displayServeHelp},
+	{Name: "daemon", Usage: "bitmap daemon [--socket=<path>] [--root=<dir>] [--follow-symlinks]", Summary: "serves header and apply commands on a Unix socket", Help: displayDaemonHelp},
+	{Name: "client", Usage: "bitmap client [--socket=<path>] <command> [arguments]", Summary: "runs a header or apply command in a running daemon", Help: displayClientHelp},
+	{Name: "rpc", Usage: "bitmap rpc [--root=<dir>] [--follow-symlinks]", Summary: "answers JSON requests on standard input, one per line", Help: displayRPCHelp},
+	{Name: "palette", Usage: "bitmap palette <show|replace|sort> <source_file> [arguments]", Summary: "prints, replaces or sorts the color table of an indexed image", Help: displayPaletteHelp},
+	{Name: "channels", Usage: "bitmap channels <split|merge> <source_file>... <output_file>...", Summary: "splits the color and alpha channels into grayscale images or merges them back", Help: displayChannelsHelp},
+	{Name: "split", Usage: "bitmap split [--rows=<n>] [--split-pages] <source_file> <pattern>", Summary: "divides an image into horizontal strip files of a number of rows, or a book scan into its pages", Help: displaySplitHelp},
+	{Name: "join", Usage: "bitmap join <strip_file>... <output_file>", Summary: "stacks strip files written by split back into one image", Help: displayJoinHelp},
+	{Name: "dump", Usage: "bitmap dump [--pixels] [--format=text] [--region=<offsetX-offsetY[-width-height]>] <source_file>", Summary: "prints the pixels as text, one line of hex colors per row", Help: displayDumpHelp},
+	{Name: "convert", Usage: "bitmap convert [--format=<bmp|png|jpeg|text|npy|arrow>] [--page=<n>] [--rasterizer=<command>] <input_file> <output_file>", Summary: "converts between BMP, PNG, JPEG and the text printed by dump", Help: displayConvertHelp},
+	{Name: "explain", Usage: "bitmap explain --<option>[=<value>]", Summary: "describes an apply option and previews it on a built-in sample", Help: displayExplainHelp},
+	{Name: "placeholder", Usage: "bitmap placeholder [--algo=<blurhash|thumbhash>] [--components=<XxY>] <source_file> | --decode=<hash> [--size=<WxH>] <output_file>", Summary: "prints a BlurHash or ThumbHash placeholder, or renders one to an image", Help: displayPlaceholderHelp},
+	{Name: "color", Usage: "bitmap color [--mode=<average|vibrant|muted>] <source_file>", Summary: "prints the average or an accent color of the image as #rrggbb", Help: displayColorHelp},
+	{Name: "quality", Usage: "bitmap quality [--format=<text|json>] [--min-sharpness=<n>] [--max-clipped=<percent>] [--reject-blank] <source_file>", Summary: "reports sharpness, clipping, blankness, noise, banding and grayscale use of the image", Help: displayQualityHelp},
+	{Name: "compare", Usage: "bitmap compare [--format=<text|json>] [--diff=<file>] [--min-psnr=<dB>] [--metric=<name>[:<score>]] <first_file> <second_file>", Summary: "reports whether two images are pixel-identical and how much they differ", Help: displayCompareHelp},
+	{Name: "fit", Usage: "bitmap fit --target=<reference_file> --op=<option>[,<option>...] [--metric=<psnr|butteraugli-lite|ssim>] [--format=<text|json>] [--output=<file>] <source_file>", Summary: "searches values of tone options that make the image look most like a reference", Help: displayFitHelp},
+	{Name: "histogram", Usage: "bitmap histogram [--format=<text|json>] [--bins=<n>] [--output=<file>] <source_file>", Summary: "prints the red, green, blue and luminance histograms of the image", Help: displayHistogramHelp},
+	{Name: "detect-lines", Usage: "bitmap detect-lines [--format=<text|json>] [--json] [--lines=<n>] [--min-length=<n>] <source_file>", Summary: "reports the dominant straight lines of the image and the page rectangle they make", Help: displayDetectLinesHelp},
+	{Name: "testcard", Usage: "bitmap testcard [--type=<gray-steps|gamma|convergence>] [--size=<WxH>] [--steps=<n>] <output_file> | --analyze [--steps=<n>] [--format=<text|json>] <photo_file>", Summary: "draws test cards for calibrating displays and printers, and measures photographed ones", Help: displayTestcardHelp},
+	{Name: "frames", Usage: "bitmap frames [--every=<n>] [--start=<n>] [--max=<n>] [--prune-similar=<distance>] <video_file> <output_dir>", Summary: "writes frames of an uncompressed Y4M or AVI video as BMP files", Help: displayFramesHelp},
+	{Name: "caption", Usage: "bitmap caption [--top=<text>] [--bottom=<text>] [--bar] [--scale=<n>] [--color=<#rrggbb>] [--bar-color=<#rrggbb>] <source_file> <output_file>", Summary: "adds meme-style text over the image or on bars above and below it", Help: displayCaptionHelp},
+	{Name: "thumbs", Usage: "bitmap thumbs [--cols=<n>] [--cell=<WxH>] [--padding=<n>] [--labels] [--sheet-color=<#rrggbb>] <dir> <output_file>", Summary: "tiles thumbnails of every BMP file in a directory into one contact sheet", Help: displayThumbsHelp},
+	{Name: "extract-thumb", Usage: "bitmap extract-thumb <raw_file> <output_file>", Summary: "extracts the JPEG preview embedded in a camera RAW file", Help: displayExtractThumbHelp},
+	{Name: "beforeafter", Usage: "bitmap beforeafter [--layout=<side|split>] [--position=<percent>] [--gap=<n>] [--labels] <before_file> <after_file> <output_file>", Summary: "puts an image and its processed version side by side or split in one image", Help: displayBeforeAfterHelp},
+	{Name: "stack", Usage: "bitmap stack [--method=<mean|weighted|max|min>] [--weights=<flat|gauss[,width]|ramp|w1,w2,...>] <frame_file>... <output_file>", Summary: "combines frames of the same size into one image, as a long exposure", Help: displayStackHelp},
+	{Name: "shell", Usage: "bitmap shell <source_file>", Summary: "loads the image once and applies options typed one at a time, with undo and redo", Help: displayShellHelp},
+	{Name: "pick", Usage: "bitmap pick [--option=<crop|pixelate>] <source_file>", Summary: "shows the image in the terminal and prints the --crop of an area selected with the keys", Help: displayPickHelp},
+	{Name: "selftest", Usage: "bitmap selftest", Summary: "checks that this build produces the reference results on fixtures embedded in it", Help: displaySelfTestHelp},
+	{Name: "triage", Usage: "bitmap triage [--output=<file>] [--format=<text|json>] <input_file>", Summary: "names the format rule a malformed file breaks and cuts it down to a minimal reproducer", Help: displayTriageHelp},
+	{Name: "provenance", Usage: "bitmap provenance verify [--provenance-key=<key>] [--source=<file>] <image_file> <manifest_file>", Summary: "checks an image against the manifest apply --provenance wrote for it", Help: displayProvenanceHelp},
+	{Name: "capabilities", Usage: "bitmap capabilities [--json] [--format=<text|json>]", Summary: "lists the formats, bit depths, compressions and operations this build supports", Help: displayCapabilitiesHelp},
+	{Name: "pack-atlas", Usage: "bitmap pack-atlas [--max=<WxH>] [--padding=<n>] [--trim] [--algo=<maxrects|guillotine>] <sprite_file>... <atlas_file> <json_file>", Summary: "packs sprites into one atlas image with a JSON file of their positions", Help: displayPackAtlasHelp},
+	{Name: "cycle", Usage: "bitmap cycle [--range=<first-last>] [--fps=<n>] <source_file> <gif_file>", Summary: "animates an indexed image by rotating color table entries, written as a GIF", Help: displayCycleHelp},
+	{Name: "match-colors", Usage: "bitmap match-colors --reference=<reference_file> [--method=<reinhard|histogram>] <source_file> <output_file>", Summary: "recolors the image to match the colors of a reference image", Help: displayMatchColorsHelp},
+	{Name: "help", Usage: "bitmap help [command|option]", Summary: "prints help for a command or an apply option", Help: displayHelpHelp},
+	{Name: "man", Usage: "bitmap man", Summary: "prints the manual page in troff format", Help: displayManHelp},
+}
+
+// Displays general usage instructions
+func displayGeneralHelp() {
+	fmt.Println(msg("help.usage"))
+	fmt.Println("  bitmap [global options] <command> [arguments]")
+	fmt.Println()
+	fmt.Println(msg("help.commands"))
+	width := 0
+	for _, cmd := range commands {
+		width = max(width, len(cmd.Name))
+	}
+	for _, cmd := range commands {
+		fmt.Printf("  %-*s %s\n", width, cmd.Name, commandSummary(&cmd))
+	}
+	fmt.Println()
+	fmt.Println(msg("help.global_options"))
+	fmt.Println()
+	fmt.Println(msg("help.exit_status"))
+	for code := exitFailure; code <= exitWrite; code++ {
+		fmt.Printf("  %d  %s\n", code, msg("exit."+exitCodeNames[code]))
+	}
+	fmt.Println()
+	fmt.Println(msg("help.general_more"))
+}
+
+// Displays usage instructions for header command
+func displayHeaderHelp() {
+	fmt.Println(msg("help.header_body"))
+}
+
+// Displays usage instructions for tune command
+func displayTuneHelp() {
+	fmt.Println(msg("help.tune_body"))
+}
+
+// Displays usage instructions for batch command
+func displayBatchHelp() {
+	fmt.Println(msg("help.batch_body"))
+}
+
+// Displays usage instructions for run command
+func displayRunHelp() {
+	fmt.Println(msg("help.run_body"))
+}
+
+// Displays usage instructions for serve command
+func displayServeHelp() {
+	fmt.Println(msg("help.serve_body"))
+}
+
+// Displays usage instructions for daemon command
+func displayDaemonHelp() {
+	fmt.Println(msg("help.daemon_body"))
+}
+
+// Displays usage instructions for client command
+func displayClientHelp() {
+	fmt.Println(msg("help.client_body"))
+}
+
+// Displays usage instructions for rpc command
+func displayRPCHelp() {
+	fmt.Println(msg("help.rpc_body"))
+}
+
+// Displays usage instructions for palette command
+func displayPaletteHelp() {
+	fmt.Println(msg("help.palette_body"))
+}
+
+// Displays usage instructions for dump command
+func displayDumpHelp() {
+	fmt.Println(msg("help.dump_body"))
+}
+
+// Displays usage instructions for convert command
+func displayConvertHelp() {
+	fmt.Println(msg("help.convert_body"))
+}
+
+// Displays usage instructions for placeholder command
+func displayPlaceholderHelp() {
+	fmt.Println(msg("help.placeholder_body"))
+}
+
+// Displays usage instructions for color command
+func displayColorHelp() {
+	fmt.Println(msg("help.color_body"))
+}
+
+// Displays usage instructions for quality command
+func displayQualityHelp() {
+	fmt.Println(msg("help.quality_body"))
+}
+
+// Displays usage instructions for provenance command
+func displayProvenanceHelp() {
+	fmt.Println(msg("help.provenance_body"))
+}
+
+// Displays usage instructions for capabilities command
+func displayCapabilitiesHelp() {
+	fmt.Println(msg("help.capabilities_body"))
+}
+
+// Displays usage instructions for compare command
+func displayCompareHelp() {
+	fmt.Println(msg("help.compare_body"))
+}
+
+// Displays usage instructions for fit command
+func displayFitHelp() {
+	fmt.Println(msg("help.fit_body"))
+}
+
+// Displays usage instructions for histogram command
+func displayHistogramHelp() {
+	fmt.Println(msg("help.histogram_body"))
+}
+
+// Displays usage instructions for detect-lines command
+func displayDetectLinesHelp() {
+	fmt.Println(msg("help.detect_lines_body"))
+}
+
+// Displays usage instructions for testcard command
+func displayTestcardHelp() {
+	fmt.Println(msg("help.testcard_body"))
+}
+
+// Displays usage instructions for frames command
+func displayFramesHelp() {
+	fmt.Println(msg("help.frames_body"))
+}
+
+// Displays usage instructions for caption command
+func displayCaptionHelp() {
+	fmt.Println(msg("help.caption_body"))
+}
+
+// Displays usage instructions for thumbs command
+func displayThumbsHelp() {
+	fmt.Println(msg("help.thumbs_body"))
+}
+
+// Displays usage instructions for extract-thumb command
+func displayExtractThumbHelp() {
+	fmt.Println(msg("help.extract_thumb_body"))
+}
+
+// Displays usage instructions for beforeafter command
+func displayBeforeAfterHelp() {
+	fmt.Println(msg("help.beforeafter_body"))
+}
+
+// Displays usage instructions for stack command
+func displayStackHelp() {
+	fmt.Println(msg("help.stack_body"))
+}
+
+// Displays usage instructions for shell command
+func displayShellHelp() {
+	fmt.Println(msg("help.shell_body"))
+}
+
+// Displays usage instructions for pick command
+func displayPickHelp() {
+	fmt.Println(msg("help.pick_body"))
+}
+
+// Displays usage instructions for selftest command
+func displaySelfTestHelp() {
+	fmt.Println(msg("help.selftest_body"))
+}
+
+// Displays usage instructions for triage command
+func displayTriageHelp() {
+	fmt.Println(msg("help.triage_body"))
+}
+
+// Displays usage instructions for pack-atlas command
+func displayPackAtlasHelp() {
+	fmt.Println(msg("help.pack_atlas_body"))
+}
+
+// Displays usage instructions for cycle command
+func displayCycleHelp() {
+	fmt.Println(msg("help.cycle_body"))
+}
+
+// Displays usage instructions for match-colors command
+func displayMatchColorsHelp() {
+	fmt.Println(msg("help.match_colors_body"))
+}
+
+// Displays usage instructions for channels command
+func displayChannelsHelp() {
+	fmt.Println(msg("help.channels_body"))
+}
+
+// Displays usage instructions for split command
+func displaySplitHelp() {
+	fmt.Println(msg("help.split_body"))
+}
+
+// Displays usage instructions for join command
+func displayJoinHelp() {
+	fmt.Println(msg("help.join_body"))
+}
+
+// Displays usage instructions for explain command
+func displayExplainHelp() {
+	fmt.Println(msg("help.explain_body"))
+}
+
+// Displays usage instructions for apply command, generated from the operation registry
+func displayApplyHelp() {
+	fmt.Println(msg("help.usage"))
+	fmt.Println("  bitmap apply [options] <source_file> [<output_file>] [--output=<file>[:WxH]]...")
+	fmt.Println()
+	fmt.Println(msg("help.options"))
+
+	width := len("-h, --help")
+	for _, op := range operations {
+		width = max(width, len(operationFlags(&op)))
+	}
+	fmt.Printf("  %-*s    %s\n", width, "-h, --help", msg("help.flag_help"))
+	for _, op := range operations {
+		fmt.Printf("  %-*s    %s\n", width, operationFlags(&op), operationSummary(&op))
+	}
+
+	fmt.Println()
+	fmt.Println(msg("help.note"))
+	fmt.Println(msg("help.apply_note"))
+}
+
+// Displays usage instructions for help command
+func displayHelpHelp() {
+	fmt.Println(msg("help.help_body"))
+}
+
+// Displays usage instructions for man command
+func displayManHelp() {
+	fmt.Println(msg("help.man_body"))
+}
+
+// Displays the detail page of an apply option
+func displayOperationHelp(op *Operation) {
+	fmt.Println(msg("help.usage"))
+	fmt.Printf("  bitmap apply %s <source_file> <output_file>\n", operationUsage(op))
+	fmt.Println()
+	fmt.Println(msg("help.description"))
+	fmt.Printf("  %s\n", capitalize(operationSummary(op)))
+	if details := operationDetails(op); details != "" {
+		for _, line := range wrapText(details, 76) {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+	fmt.Println()
+	fmt.Println(msg("help.parameters"))
+	for _, p := range op.Params {
+		fmt.Printf("  %-10s %s\n", p.Name, paramHelp(op, &p))
+		fmt.Printf("  %-10s %s\n", "", msg("help.values", paramRange(&p)))
+		if p.Default != "" {
+			fmt.Printf("  %-10s %s\n", "", msg("help.default", p.Default))
+		}
+	}
+	if len(op.Examples) > 0 {
+		fmt.Println()
+		fmt.Println(msg("help.examples"))
+		for _, example := range op.Examples {
+			fmt.Printf("  bitmap apply --%s=%s in.bmp out.bmp\n", op.Name, example)
+		}
+	}
+}
+
+// Returns the localized one-line summary of a command
+func commandSummary(cmd *Command) string {
+	return localized("cmd."+cmd.Name+".summary", cmd.Summary)
+}
+
+// Returns the localized one-line summary of an operation
+func operationSummary(op *Operation) string {
+	return localized("op."+op.Name+".summary", op.Summary)
+}
+
+// Returns the localized long description of an operation
+func operationDetails(op *Operation) string {
+	return localized("op."+op.Name+".details", op.Details)
+}
+
+// Returns the localized explanation of an operation parameter
+func paramHelp(op *Operation, p *Param) string {
+	return localized("op."+op.Name+".param."+p.Name, p.Help)
+}
+
+// Prints help for the command or apply option named in args
+func runHelp(args []string) error {
+	if len(args) == 0 {
+		displayGeneralHelp()
+		return nil
+	}
+	if len(args) > 1 {
+		return msgError("usage.help")
+	}
+
+	for _, cmd := range commands {
+		if cmd.Name == args[0] {
+			cmd.Help()
+			return nil
+		}
+	}
+	if op, ok := findOperation(args[0]); ok {
+		displayOperationHelp(op)
+		return nil
+	}
+	return msgError("error.unknown_topic", args[0])
+}
+
+// Prints the manual page to standard output
+func runMan(args []string) error {
+	if len(args) != 0 {
+		return msgError("usage.man")
+	}
+	return writeManPage(os.Stdout)
+}
+
+// Writes a troff manual page generated from the command and operation registries
+func writeManPage(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString(".TH BITMAP 1\n")
+	b.WriteString(".SH NAME\n")
+	fmt.Fprintf(&b, "bitmap \\- %s\n", manEscape(msg("man.name")))
+
+	b.WriteString(".SH SYNOPSIS\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, ".B %s\n.br\n", manEscape(cmd.Usage))
+	}
+
+	b.WriteString(".SH COMMANDS\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, ".TP\n.B %s\n%s\n", cmd.Name, manEscape(capitalize(commandSummary(&cmd))))
+	}
+
+	b.WriteString(".SH OPTIONS\n")
+	fmt.Fprintf(&b, "%s\n", manEscape(msg("man.options_intro")))
+	for _, op := range operations {
+		fmt.Fprintf(&b, ".TP\n.B %s\n%s.\n", manEscape(operationUsage(&op)), manEscape(capitalize(operationSummary(&op))))
+		if details := operationDetails(&op); details != "" {
+			fmt.Fprintf(&b, "%s\n", manEscape(details))
+		}
+		for _, p := range op.Params {
+			fmt.Fprintf(&b, ".br\n\\fI%s\\fR: %s (%s", manEscape(p.Name), manEscape(paramHelp(&op, &p)), manEscape(paramRange(&p)))
+			if p.Default != "" {
+				fmt.Fprintf(&b, "; %s", manEscape(msg("help.default", p.Default)))
+			}
+			b.WriteString(")\n")
+		}
+	}
+
+	b.WriteString(".SH EXIT STATUS\n")
+	fmt.Fprintf(&b, "%s\n", manEscape(msg("help.exit_status")))
+	for code := exitFailure; code <= exitWrite; code++ {
+		fmt.Fprintf(&b, ".TP\n%d\n%s\n", code, manEscape(msg("exit."+exitCodeNames[code])))
+	}
+
+	b.WriteString(".SH EXAMPLES\n")
+	for _, op := range operations {
+		for _, example := range op.Examples {
+			fmt.Fprintf(&b, ".nf\nbitmap apply %s in.bmp out.bmp\n.fi\n", manEscape("--"+op.Name+"="+example))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Returns the usage form of an option, e.g. --mirror=<horizontal|vertical>
+func operationUsage(op *Operation) string {
+	if len(op.Params) == 1 && op.Params[0].Kind == "enum" {
+		return fmt.Sprintf("--%s=<%s>", op.Name, strings.Join(op.Params[0].Choices, "|"))
+	}
+	names := make([]string, len(op.Params))
+	for i, p := range op.Params {
+		names[i] = p.Name
+	}
+	if op.Implicit != "" {
+		return fmt.Sprintf("--%s[=<%s>]", op.Name, strings.Join(names, op.Separator))
+	}
+	return fmt.Sprintf("--%s=<%s>", op.Name, strings.Join(names, op.Separator))
+}
+
+// Returns the usage form of an option preceded by its short alias, e.g. -m, --mirror=<horizontal|vertical>
+func operationFlags(op *Operation) string {
+	if op.Short == "" {
+		return "    " + operationUsage(op)
+	}
+	return "-" + op.Short + ", " + operationUsage(op)
+}
+
+// Describes the allowed values of a parameter, followed by its unit
+func paramRange(p *Param) string {
+	var text string
+	switch {
+	case p.Kind == "enum":
+		return strings.Join(p.Choices, ", ")
+	case p.Kind == "file":
+		return msg("help.range_file")
+	case p.Kind == "text":
+		return msg("help.range_text")
+	case p.Kind == "number" && p.Min >= p.Max:
+		text = msg("help.range_number")
+	case p.Bound != "":
+		text = msg("help.range_bound", p.Min, p.Bound)
+	default:
+		text = msg("help.range", p.Min, p.Max)
+	}
+	if p.Unit != "" {
+		text += ", " + msg("unit."+p.Unit)
+	}
+	return text
+}
+
+// Escapes text for use in a troff document
+func manEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+// Returns the text with its first letter in upper case
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// Splits text into lines of at most width characters
+func wrapText(text string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Levels of one channel counted by the histogram command
+type histogramChannel struct {
+	Levels [256]int `json:"levels"` // Number of pixels at each level
+	Mean   float64  `json:"mean"`
+	Median int      `json:"median"`
+}
+
+// Histograms printed by the histogram command, with the share of pixels clipped to black or white as the
+// quality command counts them
+type histogramReport struct {
+	Red           histogramChannel `json:"red"`
+	Green         histogramChannel `json:"green"`
+	Blue          histogramChannel `json:"blue"`
+	Luminance     histogramChannel `json:"luminance"`
+	ClippedDark   float64          `json:"clipped_dark"`
+	ClippedBright float64          `json:"clipped_bright"`
+}
+
+// Bin counts the text chart accepts, so that every bin spans the same number of levels
+var histogramBins = []int{1, 2, 4, 8, 16, 32, 64, 128, 256}
+
+// Width in characters of the longest bar of the text chart
+const histogramBarWidth = 40
+
+// Height in pixels of the chart of one channel in the histogram image
+const histogramPanelHeight = 64
+
+// Settings of the histogram command
+type histogramConfig struct {
+	format   string // "text" or "json"
+	bins     int    // Bars per channel in the text chart
+	output   string // Image file the histograms are drawn to, if set
+	filename string
+}
+
+// Parses the arguments of the histogram command
+func parseHistogramArgs(args []string) (*histogramConfig, error) {
+	cfg := &histogramConfig{format: "text", bins: 16}
+	flags := []flagSpec{
+		{Name: "format", Target: &cfg.format, Choices: []string{"text", "json"}},
+		{Name: "bins", Target: &cfg.bins},
+		{Name: "output", Target: &cfg.output, Check: nonEmpty},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(histogramBins, cfg.bins) {
+		return nil, msgError("error.histogram_bins", cfg.bins)
+	}
+	if len(positional) != 1 {
+		return nil, msgError("usage.histogram")
+	}
+	cfg.filename = positional[0]
+	return cfg, nil
+}
+
+// Prints the red, green, blue and luminance histograms of an image as a bar chart or JSON, and draws
+// them to an image when asked
+func runHistogram(args []string) error {
+	cfg, err := parseHistogramArgs(args)
+	if err != nil {
+		return err
+	}
+	bmpHeader, dibHeader, img, err := globalSettings.loadImage(cfg.filename)
+	if err != nil {
+		return err
+	}
+
+	report := measureHistogram(img)
+	if cfg.format == "json" {
+		if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+			return msgError("error.write_output", err)
+		}
+	} else {
+		printHistogram(report, cfg.bins)
+	}
+
+	if cfg.output != "" {
+		return globalSettings.saveOutput(cfg.output, "", bmpHeader, dibHeader, histogramImage(report))
+	}
+	return nil
+}
+
+// Counts the levels of every channel and of the luminance
+func measureHistogram(img *Image) *histogramReport {
+	var report histogramReport
+	for _, p := range img.Pixels {
+		report.Red.Levels[p.Red]++
+		report.Green.Levels[p.Green]++
+		report.Blue.Levels[p.Blue]++
+		level := (p.Luminance() + 500) / 1000
+		report.Luminance.Levels[level]++
+		if level <= clipDarkLevel {
+			report.ClippedDark++
+		}
+		if level >= clipBrightLevel {
+			report.ClippedBright++
+		}
+	}
+	n := float64(len(img.Pixels))
+	report.ClippedDark = report.ClippedDark * 100 / n
+	report.ClippedBright = report.ClippedBright * 100 / n
+	for _, c := range report.channels() {
+		c.summarize()
+	}
+	return &report
+}
+
+// Returns the channels of the report in the order they are printed and drawn
+func (r *histogramReport) channels() []*histogramChannel {
+	return []*histogramChannel{&r.Red, &r.Green, &r.Blue, &r.Luminance}
+}
+
+// Names of the channels, in the order channels returns them
+var histogramChannelNames = []string{"red", "green", "blue", "luminance"}
+
+// Derives the mean and median of a channel from its levels
+func (c *histogramChannel) summarize() {
+	var n, sum int
+	for level, count := range c.Levels {
+		n += count
+		sum += level * count
+	}
+	c.Mean = float64(sum) / float64(n)
+	for seen := 0; c.Median < 255; c.Median++ {
+		if seen += c.Levels[c.Median]; 2*seen >= n {
+			break
+		}
+	}
+}
+
+// Prints every channel as bins bars of # marks, the longest bar of each channel histogramBarWidth wide
+func printHistogram(report *histogramReport, bins int) {
+	span := 256 / bins
+	for k, c := range report.channels() {
+		counts := make([]int, bins)
+		for level, count := range c.Levels {
+			counts[level/span] += count
+		}
+		fmt.Printf("%s: mean %.2f, median %d\n", histogramChannelNames[k], c.Mean, c.Median)
+		longest := max(slices.Max(counts), 1)
+		for b, count := range counts {
+			bar := strings.Repeat("#", (count*histogramBarWidth+longest-1)/longest)
+			fmt.Printf("  %3d-%-3d %-*s %d\n", b*span, (b+1)*span-1, histogramBarWidth, bar, count)
+		}
+	}
+	fmt.Printf("clipped_dark: %.2f%%\n", report.ClippedDark)
+	fmt.Printf("clipped_bright: %.2f%%\n", report.ClippedBright)
+}
+
+// Draws the histograms one above the other, red, green, blue and then luminance, each 256 pixels wide
+// with one column per level and scaled to its own highest count
+func histogramImage(report *histogramReport) *Image {
+	colors := []Pixel{rgbColor(0xff0000), rgbColor(0x00ff00), rgbColor(0x0000ff), rgbColor(0xc0c0c0)}
+	background := rgbColor(0x202020)
+	height := len(colors) * histogramPanelHeight
+	img := &Image{Width: 256, Height: height, Pixels: make([]Pixel, 256*height)}
+	for k, c := range report.channels() {
+		longest := max(slices.Max(c.Levels[:]), 1)
+		for level, count := range c.Levels {
+			bar := (count*histogramPanelHeight + longest - 1) / longest
+			for y := 0; y < histogramPanelHeight; y++ {
+				p := background
+				if histogramPanelHeight-y <= bar {
+					p = colors[k]
+				}
+				// Panels go down from the top, and rows are stored bottom-up
+				img.Pixels[(height-1-k*histogramPanelHeight-y)*256+level] = p
+			}
+		}
+	}
+	return img
+}
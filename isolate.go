@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+
+	"creditcard/bmp"
+)
+
+// Command the process runs itself with to decode a file under --isolate. It is not listed by help.
+const isolateCommand = "__decode"
+
+// Most bytes of the standard error of a decoder process kept for the message of its crash
+const isolateStderrLimit = 4096
+
+// What the run sends a decoder process: the whole file and how to decode it
+type isolateRequest struct {
+	Data        []byte
+	Options     DecodeOptions // Warn is a function, which gob leaves out
+	HeadersOnly bool
+}
+
+// What a decoder process sends back: the headers and image it decoded, or the error it failed with, and
+// the warnings of permissive mode either way
+type isolateResponse struct {
+	BMPHeader *BMPHeader
+	DIBHeader *DIBHeader
+	Image     *Image
+	Warnings  []isolatedError
+	Error     *isolatedError
+}
+
+// Error of a decoder process. Errors of the bmp package keep their key and arguments, so that they are
+// localized and tell their kind apart as they would in the run; the errors among their arguments, and
+// other errors, keep their message.
+type isolatedError struct {
+	Key     string
+	Args    []any
+	Message string
+}
+
+// Error among the arguments of a bmp package error, or another error, from a decoder process
+type isolatedCause struct {
+	Message string
+}
+
+func (e isolatedCause) Error() string { return e.Message }
+
+func init() {
+	gob.Register(isolatedCause{})
+}
+
+// Describes an error of the decoder for the response
+func newIsolatedError(err error) *isolatedError {
+	var bmpErr *bmp.Error
+	if !errors.As(err, &bmpErr) {
+		return &isolatedError{Message: err.Error()}
+	}
+	e := &isolatedError{Key: bmpErr.Key, Args: make([]any, len(bmpErr.Args))}
+	for i, arg := range bmpErr.Args {
+		switch value := arg.(type) {
+		case error:
+			e.Args[i] = isolatedCause{value.Error()}
+		default:
+			// Arguments are numbers and strings; anything else gob could not send is sent as text
+			if kind := reflect.ValueOf(arg).Kind(); kind > reflect.Complex128 && kind != reflect.String {
+				arg = fmt.Sprint(arg)
+			}
+			e.Args[i] = arg
+		}
+	}
+	return e
+}
+
+// Returns the error a decoder process described
+func (e *isolatedError) err() error {
+	if e.Key == "" {
+		return isolatedCause{e.Message}
+	}
+	return &bmp.Error{Key: e.Key, Args: e.Args}
+}
+
+// Decodes a file in a decoder process, the headers of the image opts.Index selects and, unless
+// headersOnly is set, its pixels
+func decodeIsolated(r io.ReadSeeker, opts DecodeOptions, headersOnly bool) (*BMPHeader, *DIBHeader, *Image, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, nil, msgError("error.open_file", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, nil, msgError("error.open_file", err)
+	}
+	metrics.addBytesRead(int64(len(data)))
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, nil, nil, msgError("error.isolate_start", err)
+	}
+	cmd := exec.Command(executable, isolateCommand)
+	cmd.SysProcAttr = isolatedProcAttr()
+	// The decoder gets no variables, so it reads neither a config file nor a language
+	cmd.Env = []string{}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, nil, msgError("error.isolate_start", err)
+	}
+	var stdout bytes.Buffer
+	stderr := &limitedBuffer{limit: isolateStderrLimit}
+	cmd.Stdout, cmd.Stderr = &stdout, stderr
+	if err := cmd.Start(); err != nil {
+		return nil, nil, nil, msgError("error.isolate_start", err)
+	}
+	release, err := confineIsolated(cmd.Process)
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, nil, nil, msgError("error.isolate_start", err)
+	}
+	defer release()
+
+	// The file is only sent once the process is confined
+	sendErr := gob.NewEncoder(stdin).Encode(&isolateRequest{Data: data, Options: opts, HeadersOnly: headersOnly})
+	stdin.Close()
+	waitErr := cmd.Wait()
+	var resp isolateResponse
+	if waitErr != nil || gob.NewDecoder(&stdout).Decode(&resp) != nil {
+		// A process that crashed or was killed for a call it may not make says why on standard error
+		reason := fmt.Sprint(waitErr)
+		if waitErr == nil {
+			reason = fmt.Sprint(sendErr)
+		}
+		if line, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n"); line != "" {
+			reason += ": " + line
+		}
+		return nil, nil, nil, msgError("error.isolate_crash", reason)
+	}
+
+	for _, warning := range resp.Warnings {
+		if opts.Warn != nil {
+			opts.Warn(localizeError(warning.err()))
+		}
+	}
+	if resp.Error != nil {
+		return nil, nil, nil, localizeError(resp.Error.err())
+	}
+	return resp.BMPHeader, resp.DIBHeader, resp.Image, nil
+}
+
+// Runs as a decoder process: reads a request from standard input, gives up every privilege it can, decodes
+// the file and writes the response to standard output
+func runIsolatedDecoder(args []string) error {
+	var req isolateRequest
+	if len(args) > 0 || gob.NewDecoder(os.Stdin).Decode(&req) != nil {
+		return msgError("error.isolate_request")
+	}
+	if err := confineDecoder(); err != nil {
+		return msgError("error.isolate_confine", err)
+	}
+
+	resp := &isolateResponse{}
+	opts := req.Options
+	opts.Warn = func(problem error) {
+		resp.Warnings = append(resp.Warnings, *newIsolatedError(problem))
+	}
+	r := bytes.NewReader(req.Data)
+	bmpHeader, dibHeader, err := bmp.DecodeHeaders(r, opts)
+	if err == nil && !req.HeadersOnly {
+		resp.Image, err = bmp.DecodePixels(r, bmpHeader, dibHeader, opts)
+	}
+	if err != nil {
+		resp.Error = newIsolatedError(err)
+	}
+	resp.BMPHeader, resp.DIBHeader = bmpHeader, dibHeader
+	return gob.NewEncoder(os.Stdout).Encode(resp)
+}
+
+// Writer that keeps the first bytes written to it, up to a limit, and drops the rest
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Arguments of prctl and seccomp, which the syscall package does not define
+const (
+	prSetNoNewPrivs         = 38
+	seccompSetModeFilter    = 1
+	seccompFilterFlagTsync  = 1
+	seccompRetAllow         = 0x7fff0000
+	seccompRetErrno         = 0x00050000
+	sysClone3               = 435 // The same on every architecture that has it
+	seccompRetKillProcess   = 0x80000000
+	seccompDataNumberOffset = 0
+	seccompDataArchOffset   = 4
+	bpfLoadWord             = syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS
+	bpfJumpEqual            = syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K
+	bpfReturn               = syscall.BPF_RET | syscall.BPF_K
+)
+
+// Kills the decoder process along with the run, so that none is left behind
+func isolatedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+}
+
+// Does nothing: the decoder process confines itself
+func confineIsolated(process *os.Process) (func(), error) {
+	return func() {}, nil
+}
+
+// Gives up what the decoder process needs no more once it has its request: it may create no files, open
+// no more and, where seccompSyscalls lists the calls of the architecture, make no system calls but the
+// ones the Go runtime needs to compute and to write the response. Every other call fails with EPERM, so
+// code that takes over the decoder can neither open files nor sockets nor start programs.
+func confineDecoder() error {
+	// The runtime starts its network poller, which timers need, on the first one, opening a file for it; a
+	// sleep starts it while files may still be opened, rather than whenever the runtime next sets a timer
+	time.Sleep(time.Nanosecond)
+	for _, limit := range []int{syscall.RLIMIT_FSIZE, syscall.RLIMIT_NOFILE} {
+		if err := syscall.Setrlimit(limit, &syscall.Rlimit{}); err != nil {
+			return err
+		}
+	}
+	if seccompSyscalls == nil {
+		return nil
+	}
+
+	// The filter checks the architecture first, so that calls made through another ABI of the CPU, such as
+	// 32-bit calls on x86-64, cannot slip past numbers meant for this one
+	filter := []syscall.SockFilter{
+		{Code: bpfLoadWord, K: seccompDataArchOffset},
+		{Code: bpfJumpEqual, Jt: 1, K: seccompArch},
+		{Code: bpfReturn, K: seccompRetKillProcess},
+		{Code: bpfLoadWord, K: seccompDataNumberOffset},
+		// A C library starts threads with clone3 and falls back on clone only when the kernel lacks it
+		{Code: bpfJumpEqual, Jf: 1, K: sysClone3},
+		{Code: bpfReturn, K: seccompRetErrno | uint32(syscall.ENOSYS)},
+	}
+	for i, nr := range seccompSyscalls {
+		filter = append(filter, syscall.SockFilter{Code: bpfJumpEqual, Jt: uint8(len(seccompSyscalls) - i), K: uint32(nr)})
+	}
+	filter = append(filter,
+		syscall.SockFilter{Code: bpfReturn, K: seccompRetErrno | uint32(syscall.EPERM)},
+		syscall.SockFilter{Code: bpfReturn, K: seccompRetAllow})
+	program := syscall.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+		return errno
+	}
+	// Applied to every thread of the process, not only this one
+	_, _, errno := syscall.RawSyscall(seccompSyscall, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&program)))
+	runtime.KeepAlive(filter)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
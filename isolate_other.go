@@ -0,0 +1,23 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly || windows)
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Other systems, such as WebAssembly hosts, start no processes, so decoding cannot be isolated there
+func isolatedProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+// Does nothing, as isolatedProcAttr
+func confineIsolated(process *os.Process) (func(), error) {
+	return func() {}, nil
+}
+
+// Does nothing, as isolatedProcAttr
+func confineDecoder() error {
+	return nil
+}
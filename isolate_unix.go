@@ -0,0 +1,32 @@
+//go:build darwin || freebsd || netbsd || openbsd || dragonfly
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// Starts the decoder process as any other
+func isolatedProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+// Does nothing: the decoder process confines itself
+func confineIsolated(process *os.Process) (func(), error) {
+	return func() {}, nil
+}
+
+// Gives up what the decoder process needs no more once it has its request: it may create no files and
+// open no more. These systems have no filter of system calls the syscall package can set up.
+func confineDecoder() error {
+	// Starts the network poller of the runtime while it may still open a file, as on Linux
+	time.Sleep(time.Nanosecond)
+	for _, limit := range []int{syscall.RLIMIT_FSIZE, syscall.RLIMIT_NOFILE} {
+		if err := syscall.Setrlimit(limit, &syscall.Rlimit{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
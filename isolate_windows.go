@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Job object functions from kernel32, which the syscall package does not wrap
+var (
+	procCreateJobObject          = syscall.NewLazyDLL("kernel32.dll").NewProc("CreateJobObjectW")
+	procSetInformationJobObject  = syscall.NewLazyDLL("kernel32.dll").NewProc("SetInformationJobObject")
+	procAssignProcessToJobObject = syscall.NewLazyDLL("kernel32.dll").NewProc("AssignProcessToJobObject")
+)
+
+// Classes of job information and limits of job objects
+const (
+	jobObjectBasicUIRestrictions          = 4
+	jobObjectExtendedLimitInformation     = 9
+	jobObjectLimitActiveProcess           = 0x8
+	jobObjectLimitDieOnUnhandledException = 0x400
+	jobObjectLimitKillOnJobClose          = 0x2000
+	jobObjectUILimitAll                   = 0xff
+	processSetQuota                       = 0x100
+	processTerminate                      = 0x1
+)
+
+// JOBOBJECT_EXTENDED_LIMIT_INFORMATION
+type jobExtendedLimits struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+	IoInfo                  [6]uint64
+	ProcessMemoryLimit      uintptr
+	JobMemoryLimit          uintptr
+	PeakProcessMemoryUsed   uintptr
+	PeakJobMemoryUsed       uintptr
+}
+
+// Starts the decoder process as any other
+func isolatedProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+// Puts the decoder process in a job object of its own, which lets it start no other process, touch no
+// window, clipboard or desktop setting, and which kills it when the run lets go of the job. The returned
+// function lets go of it.
+func confineIsolated(process *os.Process) (func(), error) {
+	job, _, err := procCreateJobObject.Call(0, 0)
+	if job == 0 {
+		return nil, err
+	}
+	closeJob := func() { syscall.CloseHandle(syscall.Handle(job)) }
+	limits := jobExtendedLimits{
+		LimitFlags:         jobObjectLimitActiveProcess | jobObjectLimitDieOnUnhandledException | jobObjectLimitKillOnJobClose,
+		ActiveProcessLimit: 1,
+	}
+	if ok, _, err := procSetInformationJobObject.Call(job, jobObjectExtendedLimitInformation, uintptr(unsafe.Pointer(&limits)), unsafe.Sizeof(limits)); ok == 0 {
+		closeJob()
+		return nil, err
+	}
+	ui := uint32(jobObjectUILimitAll)
+	if ok, _, err := procSetInformationJobObject.Call(job, jobObjectBasicUIRestrictions, uintptr(unsafe.Pointer(&ui)), unsafe.Sizeof(ui)); ok == 0 {
+		closeJob()
+		return nil, err
+	}
+	handle, err := syscall.OpenProcess(processSetQuota|processTerminate, false, uint32(process.Pid))
+	if err != nil {
+		closeJob()
+		return nil, err
+	}
+	defer syscall.CloseHandle(handle)
+	if ok, _, err := procAssignProcessToJobObject.Call(job, uintptr(handle)); ok == 0 {
+		closeJob()
+		return nil, err
+	}
+	return closeJob, nil
+}
+
+// Does nothing: the job object confines the decoder process
+func confineDecoder() error {
+	return nil
+}
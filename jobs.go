@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Jobs read ahead of the oldest one still running, per worker. Jobs are read as workers take them and
+// reported in order, so a run of millions of jobs holds only this many at once.
+const jobsAheadPerWorker = 4
+
+// Settings of the run command
+type runConfig struct {
+	jobsFile    string
+	workers     int           // Jobs processed at the same time
+	retries     int           // Further attempts at a job that failed in a way worth retrying
+	retryDelay  time.Duration // Wait before the first retry, doubled before each next one
+	results     string        // Per-job result format: "text" or "jsonl"
+	resultsFile string        // Where results are written, standard output when empty
+	failedFile  string        // Where the lines of failed jobs are copied, if set
+	outputRoot  string        // Directory outputs may not leave, relative ones taken from it, if set
+	// Read inputs and write outputs that are symlinks, or with an output root go through them, which are
+	// refused otherwise
+	followSymlinks bool
+	root           *pathRoot // Of outputRoot, nil when it is not set
+}
+
+// One line of a jobs file: {"input": "a.png", "output": "out/a.bmp", "ops": [{"name": "rotate", "value": "right"}]}
+type runJob struct {
+	Input  string   `json:"input"`
+	Output string   `json:"output"`
+	Ops    []Option `json:"ops,omitempty"`    // Apply options, run in order, with or without the leading dashes
+	Format string   `json:"format,omitempty"` // Output format, inferred from the output name when empty
+}
+
+// Outcome of one job, reported by --results=jsonl
+type runResult struct {
+	Line     int     `json:"line"` // Line of the job in the jobs file, from 1
+	Input    string  `json:"input,omitempty"`
+	Output   string  `json:"output,omitempty"`
+	Status   string  `json:"status"` // "ok" or "error"
+	Error    string  `json:"error,omitempty"`
+	Attempts int     `json:"attempts"`
+	TotalMs  float64 `json:"total_ms"`
+}
+
+// Job read from the jobs file, with the result its worker hands over once it is done
+type pendingJob struct {
+	line int
+	text string
+	done chan *runResult
+}
+
+// Parses the arguments of the run command
+func parseRunArgs(args []string) (*runConfig, error) {
+	cfg := &runConfig{workers: defaultWorkers(), retries: 2, retryDelay: time.Second, results: "text"}
+	flags := []flagSpec{
+		{Name: "workers", Target: &cfg.workers, Min: 1},
+		{Name: "retries", Target: &cfg.retries},
+		{Name: "retry-delay", Target: &cfg.retryDelay},
+		{Name: "results", Target: &cfg.results, Choices: []string{"text", "jsonl"}},
+		{Name: "results-file", Target: &cfg.resultsFile, Check: nonEmpty},
+		{Name: "failed", Target: &cfg.failedFile, Check: nonEmpty},
+		{Name: "output-root", Target: &cfg.outputRoot, Check: nonEmpty},
+		{Name: "follow-symlinks", Target: &cfg.followSymlinks},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 1 {
+		return nil, msgError("usage.run")
+	}
+	cfg.jobsFile = positional[0]
+	return cfg, nil
+}
+
+// Runs the jobs of a JSON Lines file, each an input, the apply options for it and an output, on a pool of
+// workers. Unlike batch, which takes a directory, the jobs can come from anywhere and go anywhere, so a
+// migration of millions of files can be planned by a script, split up and run again on the jobs that
+// failed.
+func runJobs(args []string) error {
+	cfg, err := parseRunArgs(args)
+	if err != nil {
+		return err
+	}
+	if cfg.outputRoot != "" {
+		if cfg.root, err = newPathRoot(cfg.outputRoot, cfg.followSymlinks); err != nil {
+			return err
+		}
+	}
+	source, err := globalSettings.openInput(cfg.jobsFile)
+	if err != nil {
+		return msgError("error.open_jobs", err)
+	}
+	defer source.Close()
+	lockFiles = true
+
+	var results io.Writer = os.Stdout
+	if cfg.resultsFile != "" {
+		file, err := files.Create(cfg.resultsFile)
+		if err != nil {
+			return msgError("error.create_file", err)
+		}
+		defer file.Close()
+		results = file
+	}
+	encoder := json.NewEncoder(results)
+	var failed io.Writer
+	if cfg.failedFile != "" {
+		file, err := files.Create(cfg.failedFile)
+		if err != nil {
+			return msgError("error.create_file", err)
+		}
+		defer file.Close()
+		failed = file
+	}
+
+	// Jobs go to the workers and, in the same order, to the report below, which waits for each in turn.
+	// A job is handed to the workers before the next is queued for the report, so the report never waits
+	// for a job no worker can take.
+	start := time.Now()
+	work := make(chan *pendingJob)
+	order := make(chan *pendingJob, cfg.workers*jobsAheadPerWorker)
+	var readErr error
+	go func() {
+		defer close(work)
+		defer close(order)
+		scanner := bufio.NewScanner(source)
+		scanner.Buffer(make([]byte, 64*1024), maxFrameSize)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			job := &pendingJob{line: line, text: text, done: make(chan *runResult, 1)}
+			order <- job
+			work <- job
+		}
+		readErr = scanner.Err()
+	}()
+	for range cfg.workers {
+		go func() {
+			for job := range work {
+				job.done <- cfg.runJob(job)
+			}
+		}()
+	}
+
+	counts := map[string]int{}
+	total, retried := 0, 0
+	var writeErr error
+	for job := range order {
+		result := <-job.done
+		total++
+		counts[result.Status]++
+		if result.Attempts > 1 {
+			retried++
+		}
+		if writeErr != nil {
+			continue
+		}
+		if result.Status == "error" && failed != nil {
+			if _, err := fmt.Fprintln(failed, job.text); err != nil {
+				writeErr = msgError("error.write_results", err)
+				continue
+			}
+		}
+
+		if cfg.results == "jsonl" {
+			if err := encoder.Encode(result); err != nil {
+				writeErr = msgError("error.write_results", err)
+			}
+			continue
+		}
+		if result.Status == "error" {
+			printError(fmt.Errorf("%s:%d: %s", cfg.jobsFile, result.Line, result.Error))
+		} else {
+			fmt.Fprintln(results, msg("info.batch_done", result.Input, result.Output))
+		}
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	if readErr != nil {
+		return msgError("error.open_jobs", readErr)
+	}
+	logInfo("info.run_summary", total, counts["ok"], counts["error"], retried, time.Since(start).Round(time.Millisecond))
+
+	if counts["error"] > 0 {
+		return msgError("error.run_failed", counts["error"], total)
+	}
+	return nil
+}
+
+// Runs one job, again after a growing wait while it fails in a way that may pass, such as a write to a
+// full disk or a network file system that dropped out. Jobs that can only fail again, such as ones with
+// a missing or damaged input or a bad option, are not retried.
+func (cfg *runConfig) runJob(pending *pendingJob) *runResult {
+	result := &runResult{Line: pending.line, Status: "ok"}
+	start := time.Now()
+	defer func() { result.TotalMs = millisSince(start) }()
+
+	var job runJob
+	err := json.Unmarshal([]byte(pending.text), &job)
+	switch {
+	case err != nil:
+		err = msgError("error.invalid_job", err)
+	case job.Input == "" || job.Output == "":
+		err = msgError("error.invalid_job", msg("error.job_fields"))
+	case job.Format != "" && !contains(outputFormats, job.Format):
+		err = msgError("error.invalid_job", msg("error.job_format", job.Format, strings.Join(outputFormats, ", ")))
+	default:
+		err = cfg.checkPaths(&job)
+	}
+	result.Input, result.Output = job.Input, job.Output
+	if err == nil {
+		for delay := cfg.retryDelay; ; delay *= 2 {
+			result.Attempts++
+			if err = runOneJob(&job); err == nil || result.Attempts > cfg.retries {
+				break
+			}
+			if code := exitCode(err); code != exitFailure && code != exitWrite {
+				break
+			}
+			logInfo("info.job_retry", cfg.jobsFile, pending.line, localizeError(err), delay)
+			time.Sleep(delay)
+		}
+	}
+	if err != nil {
+		result.Status, result.Error = "error", localizeError(err).Error()
+	}
+	return result
+}
+
+// Refuses the files of a job that are symlinks, unless they are followed, and resolves its output in the
+// output root. Jobs files may be written from listings of trees that are not trusted, where a planted link
+// would have a run read or overwrite files elsewhere.
+func (cfg *runConfig) checkPaths(job *runJob) error {
+	if !cfg.followSymlinks && isSymlink(job.Input) {
+		return msgError("error.symlink", job.Input)
+	}
+	if cfg.root != nil {
+		output, err := cfg.root.resolve(job.Output)
+		if err != nil {
+			return err
+		}
+		job.Output = output
+		return nil
+	}
+	if !cfg.followSymlinks && isSymlink(job.Output) {
+		return msgError("error.symlink", job.Output)
+	}
+	return nil
+}
+
+// Reads the input of a job, applies its options and writes the output, creating its directory
+func runOneJob(job *runJob) error {
+	bmpHeader, dibHeader, img, err := loadConvertInput(job.Input, pdfOptions{})
+	if err != nil {
+		return err
+	}
+	options := make([]Option, len(job.Ops))
+	for i, opt := range job.Ops {
+		options[i] = Option{Name: "--" + strings.TrimPrefix(opt.Name, "--"), Value: opt.Value}
+	}
+	if options, err = resolveStamps(options, job.Input); err != nil {
+		return err
+	}
+	if img, err = applyOptions(img, options); err != nil {
+		return err
+	}
+	if err := files.MkdirAll(filepath.Dir(job.Output)); err != nil {
+		return msgError("error.create_dir", err)
+	}
+	return globalSettings.saveOutput(job.Output, job.Format, bmpHeader, dibHeader, img)
+}
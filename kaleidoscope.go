@@ -0,0 +1,90 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Most wedges --kaleidoscope accepts
+const maxKaleidoscopeSegments = 64
+
+// Kinds of --symmetry: the left half reflected onto the right, the top half onto the bottom, or the
+// top-left quarter onto the other three
+var symmetryModes = []string{"horizontal", "vertical", "quad"}
+
+// Parses a --kaleidoscope value of the form segments[,angle], the angle in degrees
+func parseKaleidoscope(value string) (segments int, angle float64, err error) {
+	s, a, found := strings.Cut(value, ",")
+	segments, err = strconv.Atoi(s)
+	if err == nil && found {
+		angle, err = strconv.ParseFloat(a, 64)
+	}
+	if err != nil || segments < 2 || segments > maxKaleidoscopeSegments || math.IsNaN(angle) || math.IsInf(angle, 0) {
+		return 0, 0, msgError("error.invalid_kaleidoscope", value, maxKaleidoscopeSegments)
+	}
+	return segments, angle, nil
+}
+
+// Validates a --symmetry value
+func parseSymmetry(value string) (string, error) {
+	if !slices.Contains(symmetryModes, value) {
+		return "", msgError("error.invalid_symmetry", value)
+	}
+	return value, nil
+}
+
+// Divides the image into equal wedges around its center and fills every wedge with the one that starts
+// at angle degrees clockwise from the right, reflected in turn as in a kaleidoscope's mirrors. Points
+// reflected beyond the borders take the nearest border pixel.
+func applyKaleidoscope(img *Image, segments int, angle float64, progress rowProgress) *Image {
+	wedge := 2 * math.Pi / float64(segments)
+	start := angle * math.Pi / 180
+	cx, cy := float64(img.Width)/2, float64(img.Height)/2
+	return img.Warp(func(x, y float64) (float64, float64) {
+		dx, dy := x-cx, y-cy
+		// Angle from the start of the source wedge; rows count down, so angles grow clockwise
+		theta := math.Mod(math.Atan2(dy, dx)-start, 2*math.Pi)
+		if theta < 0 {
+			theta += 2 * math.Pi
+		}
+		k := math.Floor(theta / wedge)
+		t := theta - k*wedge
+		if int(k)%2 == 1 {
+			t = wedge - t
+		}
+		r := math.Hypot(dx, dy)
+		return cx + r*math.Cos(start+t), cy + r*math.Sin(start+t)
+	}, progress)
+}
+
+// Makes the image symmetric by reflecting one half onto the other, or one quarter onto the other three.
+// Pixels are copied, so nothing is resampled; of an odd width or height the middle line stays as it is.
+func applySymmetry(img *Image, mode string, progress rowProgress) *Image {
+	result := &Image{Width: img.Width, Height: img.Height, Pixels: make([]Pixel, len(img.Pixels)), Gap: img.Gap, Palette: img.Palette}
+	if img.Alpha != nil {
+		result.Alpha = make([]byte, len(img.Alpha))
+	}
+	mirrorX, mirrorY := mode != "vertical", mode != "horizontal"
+	for y := 0; y < img.Height; y++ {
+		// Rows and columns in the second half take the ones reflected into the first
+		sy := y
+		if mirrorY && y >= img.Height/2 {
+			sy = img.Height - 1 - y
+		}
+		row, from := (img.Height-1-y)*img.Width, (img.Height-1-sy)*img.Width
+		for x := 0; x < img.Width; x++ {
+			sx := x
+			if mirrorX && x >= img.Width/2 {
+				sx = img.Width - 1 - x
+			}
+			result.Pixels[row+x] = img.Pixels[from+sx]
+			if result.Alpha != nil {
+				result.Alpha[row+x] = img.Alpha[from+sx]
+			}
+		}
+		progress.Report(y+1, img.Height)
+	}
+	return result
+}
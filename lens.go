@@ -0,0 +1,39 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Parses a --lens value of the form k1,k2[,k3]
+func parseLens(value string) ([3]float64, error) {
+	var k [3]float64
+	parts := strings.Split(value, ",")
+	if len(parts) < 2 || len(parts) > 3 {
+		return k, msgError("error.invalid_lens", value)
+	}
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			return k, msgError("error.invalid_lens", value)
+		}
+		k[i] = v
+	}
+	return k, nil
+}
+
+// Applies radial lens distortion with the polynomial model of Brown: a pixel at radius r from the center,
+// with r 1 at the corners, is sampled from radius r(1 + k1 r² + k2 r⁴ + k3 r⁶). Positive coefficients
+// squeeze the edges inward into barrel distortion, and negative ones stretch them out, which undoes the
+// barrel distortion of wide-angle and action cameras.
+func applyLens(img *Image, k [3]float64, progress rowProgress) *Image {
+	cx, cy := float64(img.Width)/2, float64(img.Height)/2
+	corner := math.Hypot(cx, cy)
+	return img.Warp(func(x, y float64) (float64, float64) {
+		dx, dy := (x-cx)/corner, (y-cy)/corner
+		r2 := dx*dx + dy*dy
+		scale := 1 + r2*(k[0]+r2*(k[1]+r2*k[2]))
+		return cx + dx*scale*corner, cy + dy*scale*corner
+	}, progress)
+}
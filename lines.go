@@ -0,0 +1,474 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+)
+
+// Hough transform settings of the detect-lines command. Edge pixels vote for the lines through them whose
+// normal is within lineVoteSpread degrees of their gradient, in steps of lineAngleStep degrees and 1 pixel.
+const (
+	lineAngleStep  = 0.5
+	lineVoteSpread = 10
+	lineEdgeLevel  = 80  // Sobel gradient magnitude, out of 1020, from which a pixel counts as an edge
+	lineDistance   = 1.5 // Largest distance in pixels from a line of the edge pixels that support it
+	lineGapShare   = 50  // Segments bridge gaps of up to 1/lineGapShare of the image diagonal
+	// Edges are taken out with the lines they support up to 1/lineEdgeShare of the image diagonal, and at
+	// least 3 pixels, away, so that a blurred edge, several pixels wide, does not come out as several lines
+	lineEdgeShare = 200
+)
+
+// A page rectangle is reported when its area is at least rectMinArea percent of the image, its corners
+// lie at most rectMargin percent of the image size outside it, its opposite sides are within rectParallel
+// degrees of parallel and lines found back at least rectMinCoverage percent of its perimeter
+const (
+	rectMinArea     = 10
+	rectMargin      = 5
+	rectParallel    = 30
+	rectMinCoverage = 30
+)
+
+// Lines and page rectangle printed by the detect-lines command, in pixels from the top left corner of the
+// image. Angles are in degrees, clockwise from the horizontal.
+type lineReport struct {
+	Width     int            `json:"width"`
+	Height    int            `json:"height"`
+	Lines     []detectedLine `json:"lines"`     // Longest first
+	Rectangle *detectedRect  `json:"rectangle"` // Null when no lines make one
+}
+
+// A straight segment, on the line of the points where x*cos(theta) + y*sin(theta) = rho
+type detectedLine struct {
+	X1     float64 `json:"x1"`
+	Y1     float64 `json:"y1"`
+	X2     float64 `json:"x2"`
+	Y2     float64 `json:"y2"`
+	Angle  float64 `json:"angle"` // From -90 to 90; 0 is horizontal, 90 vertical
+	Length float64 `json:"length"`
+	Rho    float64 `json:"rho"`
+	Theta  float64 `json:"theta"` // Angle of the normal of the line, from 0 to 180
+}
+
+// The quadrilateral four of the lines make that is most likely the page, with the options that straighten
+// and cut it out
+type detectedRect struct {
+	// Top left, top right, bottom right and bottom left
+	Corners  [4][2]float64 `json:"corners"`
+	Skew     float64       `json:"skew"`     // Mean clockwise tilt of the sides
+	Area     float64       `json:"area"`     // Percentage of the image it covers
+	Coverage float64       `json:"coverage"` // Percentage of its perimeter the lines found run along
+	Rotate   string        `json:"rotate"`   // --rotate value that levels it
+	Crop     string        `json:"crop"`     // --crop value of its bounding box, within the image
+}
+
+// An edge pixel with the angle bin of its gradient
+type edgePixel struct {
+	x, y, bin int
+	used      bool // Set once it supports a line that was taken out
+}
+
+// Settings of the detect-lines command
+type linesConfig struct {
+	format    string // "text" or "json"
+	asJSON    bool
+	lines     int // Most lines reported
+	minLength int // Shortest segment reported, 0 for an eighth of the shorter side of the image
+	filename  string
+}
+
+// Parses the arguments of the detect-lines command
+func parseLinesArgs(args []string) (*linesConfig, error) {
+	cfg := &linesConfig{format: "text", lines: 10}
+	flags := []flagSpec{
+		{Name: "format", Target: &cfg.format, Choices: []string{"text", "json"}},
+		{Name: "json", Target: &cfg.asJSON},
+		{Name: "lines", Target: &cfg.lines, Min: 1},
+		{Name: "min-length", Target: &cfg.minLength},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 1 {
+		return nil, msgError("usage.detect_lines")
+	}
+	if cfg.asJSON {
+		cfg.format = "json"
+	}
+	cfg.filename = positional[0]
+	return cfg, nil
+}
+
+// Prints the dominant straight lines of an image and the page rectangle they make, found by a Hough
+// transform of its edges, as text or JSON
+func runDetectLines(args []string) error {
+	cfg, err := parseLinesArgs(args)
+	if err != nil {
+		return err
+	}
+	_, _, img, err := globalSettings.loadImage(cfg.filename)
+	if err != nil {
+		return err
+	}
+
+	minLength := cfg.minLength
+	if minLength <= 0 {
+		minLength = max(min(img.Width, img.Height)/8, 2)
+	}
+	report := &lineReport{Width: img.Width, Height: img.Height}
+	report.Lines = detectLines(img, cfg.lines, minLength)
+	report.Rectangle = pageRectangle(report.Lines, img.Width, img.Height)
+
+	if cfg.format == "json" {
+		if report.Lines == nil {
+			report.Lines = []detectedLine{}
+		}
+		if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+			return msgError("error.write_output", err)
+		}
+		return nil
+	}
+	fmt.Printf("size: %dx%d\n", report.Width, report.Height)
+	fmt.Printf("lines: %d\n", len(report.Lines))
+	for i, l := range report.Lines {
+		fmt.Printf("  %d: %g,%g to %g,%g, angle %g, length %g\n", i+1, l.X1, l.Y1, l.X2, l.Y2, l.Angle, l.Length)
+	}
+	r := report.Rectangle
+	if r == nil {
+		fmt.Println("rectangle: none")
+		return nil
+	}
+	fmt.Printf("rectangle: %g,%g %g,%g %g,%g %g,%g\n", r.Corners[0][0], r.Corners[0][1], r.Corners[1][0],
+		r.Corners[1][1], r.Corners[2][0], r.Corners[2][1], r.Corners[3][0], r.Corners[3][1])
+	fmt.Printf("skew: %g\n", r.Skew)
+	fmt.Printf("area: %g%%\n", r.Area)
+	fmt.Printf("coverage: %g%%\n", r.Coverage)
+	fmt.Printf("rotate: %s\n", r.Rotate)
+	fmt.Printf("crop: %s\n", r.Crop)
+	return nil
+}
+
+// Returns up to count segments of at least minLength pixels, longest first. The line with the most votes
+// is taken out of the transform with the edge pixels that support it before the next one is looked for,
+// so that an edge does not come out again as lines at nearby angles.
+func detectLines(img *Image, count, minLength int) []detectedLine {
+	w, h := img.Width, img.Height
+	edges := edgePixels(img)
+	bins := int(180 / lineAngleStep)
+	spread := int(lineVoteSpread / lineAngleStep)
+	offset := int(math.Ceil(math.Hypot(float64(w), float64(h))))
+	span := 2*offset + 1
+	cos, sin := make([]float64, bins), make([]float64, bins)
+	for b := range bins {
+		theta := float64(b) * lineAngleStep * math.Pi / 180
+		cos[b], sin[b] = math.Cos(theta), math.Sin(theta)
+	}
+
+	// Votes of each angle bin, one row of distances per bin
+	votes := make([]int32, bins*span)
+	vote := func(e *edgePixel, delta int32) {
+		for d := -spread; d <= spread; d++ {
+			b := (e.bin + d + bins) % bins
+			rho := int(math.Round(float64(e.x)*cos[b]+float64(e.y)*sin[b])) + offset
+			votes[b*span+rho] += delta
+		}
+	}
+	for i := range edges {
+		vote(&edges[i], 1)
+	}
+
+	// The pixels of a slanted or noisy edge fall on both sides of the distance of its line, so peaks are
+	// looked for in the votes of three neighboring distances, the pixels within lineDistance of the line
+	peak := func() (b, rho int, total int32) {
+		for i := range bins {
+			row := votes[i*span : (i+1)*span]
+			for r := 1; r < span-1; r++ {
+				if sum := row[r-1] + row[r] + row[r+1]; sum > total {
+					b, rho, total = i, r-offset, sum
+				}
+			}
+		}
+		return b, rho, total
+	}
+
+	// More lines than reported are taken out, as the longest ones need not have the most votes
+	diagonal := math.Hypot(float64(w), float64(h))
+	gap, thickness := diagonal/lineGapShare, max(diagonal/lineEdgeShare, 3)
+	var lines []detectedLine
+	for range 4 * count {
+		b, r, total := peak()
+		if int(total) < minLength {
+			break
+		}
+		rho := float64(r)
+
+		// Positions along the line of the pixels that support it
+		var along []float64
+		for i := range edges {
+			e := &edges[i]
+			distance := math.Abs(float64(e.x)*cos[b] + float64(e.y)*sin[b] - rho)
+			turn := (e.bin - b + bins) % bins
+			if e.used || distance > thickness || (turn > spread && turn < bins-spread) {
+				continue
+			}
+			e.used = true
+			vote(e, -1)
+			if distance <= lineDistance {
+				along = append(along, float64(e.y)*cos[b]-float64(e.x)*sin[b])
+			}
+		}
+		if line, ok := longestSegment(along, b, rho, gap); ok && line.Length >= float64(minLength) {
+			lines = append(lines, line)
+		}
+	}
+	slices.SortStableFunc(lines, func(a, b detectedLine) int { return cmp.Compare(b.Length, a.Length) })
+	return lines[:min(len(lines), count)]
+}
+
+// Returns the pixels of an image on its edges, where the Sobel gradient of the gray levels is at least
+// lineEdgeLevel and no weaker than at the neighbors across the edge, so that edges are one pixel thick.
+// Coordinates are from the top left corner.
+func edgePixels(img *Image) []edgePixel {
+	w, h := img.Width, img.Height
+	levels := grayLevels(img)
+	gray := func(x, y int) int {
+		x, y = min(max(x, 0), w-1), min(max(y, 0), h-1)
+		return int(levels[(h-1-y)*w+x])
+	}
+	magnitude := make([]float64, w*h)
+	angle := make([]float64, w*h)
+	for y := range h {
+		for x := range w {
+			gx := gray(x+1, y-1) + 2*gray(x+1, y) + gray(x+1, y+1) - gray(x-1, y-1) - 2*gray(x-1, y) - gray(x-1, y+1)
+			gy := gray(x-1, y+1) + 2*gray(x, y+1) + gray(x+1, y+1) - gray(x-1, y-1) - 2*gray(x, y-1) - gray(x+1, y-1)
+			magnitude[y*w+x] = math.Hypot(float64(gx), float64(gy))
+			angle[y*w+x] = math.Atan2(float64(gy), float64(gx))
+		}
+	}
+	at := func(x, y int) float64 {
+		if x < 0 || y < 0 || x >= w || y >= h {
+			return 0
+		}
+		return magnitude[y*w+x]
+	}
+
+	bins := int(180 / lineAngleStep)
+	var edges []edgePixel
+	for y := range h {
+		for x := range w {
+			m := magnitude[y*w+x]
+			if m < lineEdgeLevel {
+				continue
+			}
+			// The neighbors along the gradient, one of the four directions of the pixel grid
+			theta := angle[y*w+x]
+			dx, dy := int(math.Round(math.Cos(theta))), int(math.Round(math.Sin(theta)))
+			if m < at(x+dx, y+dy) || m <= at(x-dx, y-dy) {
+				continue
+			}
+			degrees := math.Mod(theta*180/math.Pi+360, 180)
+			edges = append(edges, edgePixel{x: x, y: y, bin: int(math.Round(degrees/lineAngleStep)) % bins})
+		}
+	}
+	return edges
+}
+
+// Returns the longest run of positions along a line with no gap wider than gap between them, as a
+// segment of the line of angle bin b at distance rho from the origin
+func longestSegment(along []float64, b int, rho, gap float64) (detectedLine, bool) {
+	if len(along) == 0 {
+		return detectedLine{}, false
+	}
+	slices.Sort(along)
+	start, end, runStart := along[0], along[0], along[0]
+	for i := 1; i <= len(along); i++ {
+		if i < len(along) && along[i]-along[i-1] <= gap {
+			continue
+		}
+		if along[i-1]-runStart > end-start {
+			start, end = runStart, along[i-1]
+		}
+		if i < len(along) {
+			runStart = along[i]
+		}
+	}
+
+	theta := float64(b) * lineAngleStep
+	c, s := math.Cos(theta*math.Pi/180), math.Sin(theta*math.Pi/180)
+	// The direction of the line is the normal turned a quarter clockwise
+	angle := theta - 90
+	if angle <= -90 {
+		angle += 180
+	}
+	line := detectedLine{
+		X1:     roundTenth(rho*c - start*s),
+		Y1:     roundTenth(rho*s + start*c),
+		X2:     roundTenth(rho*c - end*s),
+		Y2:     roundTenth(rho*s + end*c),
+		Angle:  roundTenth(angle),
+		Length: roundTenth(end - start),
+		Rho:    rho,
+		Theta:  theta,
+	}
+	// Segments go left to right, or top to bottom when they are steep
+	if math.Abs(angle) <= 45 && line.X1 > line.X2 || math.Abs(angle) > 45 && line.Y1 > line.Y2 {
+		line.X1, line.Y1, line.X2, line.Y2 = line.X2, line.Y2, line.X1, line.Y1
+	}
+	return line, true
+}
+
+// Returns the quadrilateral of two roughly horizontal and two roughly vertical lines that the lines run
+// along the most, or nil when no four lines make a large enough one
+func pageRectangle(lines []detectedLine, width, height int) *detectedRect {
+	var horizontal, vertical []detectedLine
+	for _, l := range lines {
+		if math.Abs(l.Angle) <= 45 {
+			horizontal = append(horizontal, l)
+		} else {
+			vertical = append(vertical, l)
+		}
+	}
+	mx, my := float64(width)*rectMargin/100, float64(height)*rectMargin/100
+	inside := func(p [2]float64) bool {
+		return p[0] >= -mx && p[0] <= float64(width)+mx && p[1] >= -my && p[1] <= float64(height)+my
+	}
+
+	var best *detectedRect
+	bestScore := 0.0
+	for i, top := range horizontal {
+		for _, bottom := range horizontal[i+1:] {
+			if (top.Y1 + top.Y2) > (bottom.Y1 + bottom.Y2) {
+				top, bottom = bottom, top
+			}
+			if angleBetween(top.Angle, bottom.Angle) > rectParallel {
+				continue
+			}
+			for j, left := range vertical {
+				for _, right := range vertical[j+1:] {
+					if (left.X1 + left.X2) > (right.X1 + right.X2) {
+						left, right = right, left
+					}
+					if angleBetween(left.Angle, right.Angle) > rectParallel {
+						continue
+					}
+					sides := [4]detectedLine{top, right, bottom, left}
+					// Each corner is where a side meets the one before it, starting where left meets top
+					var corners [4][2]float64
+					valid := true
+					for k := range 4 {
+						var ok bool
+						corners[k], ok = intersectLines(sides[(k+3)%4], sides[k])
+						valid = valid && ok && inside(corners[k])
+					}
+					if !valid {
+						continue
+					}
+					area := polygonArea(corners)
+					if area*100 < rectMinArea*float64(width*height) {
+						continue
+					}
+					covered, perimeter := 0.0, 0.0
+					for k, side := range sides {
+						from, to := corners[k], corners[(k+1)%4]
+						covered += segmentOverlap(side, from, to)
+						perimeter += math.Hypot(to[0]-from[0], to[1]-from[1])
+					}
+					if covered*100 < rectMinCoverage*perimeter || covered <= bestScore {
+						continue
+					}
+					bestScore = covered
+					best = &detectedRect{Corners: corners, Area: area * 100 / float64(width*height),
+						Coverage: covered * 100 / perimeter}
+					for _, side := range sides {
+						tilt := side.Angle
+						if side == left || side == right {
+							tilt -= math.Copysign(90, tilt)
+						}
+						best.Skew += tilt / 4
+					}
+				}
+			}
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	// The corners are rounded as the lines are; the options are given in whole pixels, within the image
+	x0, y0, x1, y1 := float64(width), float64(height), 0.0, 0.0
+	for k, p := range best.Corners {
+		best.Corners[k] = [2]float64{roundTenth(p[0]), roundTenth(p[1])}
+		x0, y0 = min(x0, p[0]), min(y0, p[1])
+		x1, y1 = max(x1, p[0]), max(y1, p[1])
+	}
+	left, top := max(int(math.Floor(x0)), 0), max(int(math.Floor(y0)), 0)
+	right, bottom := min(int(math.Ceil(x1)), width), min(int(math.Ceil(y1)), height)
+	best.Crop = fmt.Sprintf("%d-%d-%d-%d", left, top, right-left, bottom-top)
+	best.Skew = math.Round(best.Skew*100) / 100
+	if best.Skew == 0 {
+		best.Skew = 0 // Not -0
+	}
+	best.Rotate = strconv.FormatFloat(-best.Skew, 'f', -1, 64)
+	if best.Skew == 0 {
+		best.Rotate = "0"
+	}
+	best.Area, best.Coverage = roundTenth(best.Area), roundTenth(best.Coverage)
+	return best
+}
+
+// Returns the point where two lines cross, or false when they are parallel
+func intersectLines(a, b detectedLine) ([2]float64, bool) {
+	ta, tb := a.Theta*math.Pi/180, b.Theta*math.Pi/180
+	det := math.Cos(ta)*math.Sin(tb) - math.Sin(ta)*math.Cos(tb)
+	if math.Abs(det) < 1e-9 {
+		return [2]float64{}, false
+	}
+	x := (a.Rho*math.Sin(tb) - b.Rho*math.Sin(ta)) / det
+	y := (b.Rho*math.Cos(ta) - a.Rho*math.Cos(tb)) / det
+	return [2]float64{x, y}, true
+}
+
+// Returns the length of the part of a segment that lies between two points on its line
+func segmentOverlap(l detectedLine, from, to [2]float64) float64 {
+	theta := l.Theta * math.Pi / 180
+	along := func(x, y float64) float64 { return y*math.Cos(theta) - x*math.Sin(theta) }
+	s1, s2 := along(l.X1, l.Y1), along(l.X2, l.Y2)
+	t1, t2 := along(from[0], from[1]), along(to[0], to[1])
+	return max(0, min(max(s1, s2), max(t1, t2))-max(min(s1, s2), min(t1, t2)))
+}
+
+// Returns the area of a quadrilateral whose corners go around it, 0 when its sides cross
+func polygonArea(corners [4][2]float64) float64 {
+	area := 0.0
+	sign := 0.0
+	for k := range 4 {
+		p, q, r := corners[k], corners[(k+1)%4], corners[(k+2)%4]
+		area += p[0]*q[1] - q[0]*p[1]
+		// The turn at every corner goes the same way in a convex quadrilateral
+		turn := (q[0]-p[0])*(r[1]-q[1]) - (q[1]-p[1])*(r[0]-q[0])
+		if sign != 0 && turn*sign <= 0 {
+			return 0
+		}
+		sign = turn
+	}
+	return math.Abs(area) / 2
+}
+
+// Returns the difference between two line angles, from 0 to 90
+func angleBetween(a, b float64) float64 {
+	d := math.Mod(math.Abs(a-b), 180)
+	return min(d, 180-d)
+}
+
+// Rounds a measurement to a tenth, as reported, without negative zeros
+func roundTenth(v float64) float64 {
+	if v = math.Round(v*10) / 10; v == 0 {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,18 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly || windows)
+
+package main
+
+import "os"
+
+// Other systems, such as WebAssembly hosts, offer no file locks
+const fileLocksSupported = false
+
+// Reports the file as locked, as there are no locks to take
+func tryLockFile(file *os.File, exclusive bool) (bool, error) {
+	return true, nil
+}
+
+// Does nothing, as tryLockFile
+func lockFile(file *os.File, exclusive bool) error {
+	return nil
+}
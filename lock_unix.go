@@ -0,0 +1,46 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Locks are taken with flock
+const fileLocksSupported = true
+
+// Locks a whole file with flock, shared for reading or exclusive for writing, without waiting. Reports
+// false when another process holds a lock that conflicts. File systems without locks, as some network
+// ones are, count as locked, so that runs over them go on as they did before.
+func tryLockFile(file *os.File, exclusive bool) (bool, error) {
+	err := flock(file, exclusive, syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+	return true, err
+}
+
+// Locks a whole file like tryLockFile, waiting for conflicting locks to be released
+func lockFile(file *os.File, exclusive bool) error {
+	return flock(file, exclusive, 0)
+}
+
+// Calls flock until a signal no longer interrupts it. The lock lasts until the file is closed.
+func flock(file *os.File, exclusive bool, flags int) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	for {
+		err := syscall.Flock(int(file.Fd()), how|flags)
+		switch {
+		case err == syscall.EINTR:
+			continue
+		case err == syscall.ENOTSUP || err == syscall.EOPNOTSUPP || err == syscall.ENOLCK:
+			return nil
+		}
+		return err
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Locks are taken with LockFileEx
+const fileLocksSupported = true
+
+// LockFileEx from kernel32, which the syscall package does not wrap
+var procLockFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("LockFileEx")
+
+// Flags of LockFileEx
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+)
+
+// Error LockFileEx fails with when another handle holds a conflicting lock
+const errorLockViolation syscall.Errno = 33
+
+// Locks a whole file with LockFileEx, shared for reading or exclusive for writing, without waiting.
+// Reports false when another process holds a lock that conflicts.
+func tryLockFile(file *os.File, exclusive bool) (bool, error) {
+	err := lockFileEx(file, exclusive, lockfileFailImmediately)
+	if errors.Is(err, errorLockViolation) {
+		return false, nil
+	}
+	return true, err
+}
+
+// Locks a whole file like tryLockFile, waiting for conflicting locks to be released
+func lockFile(file *os.File, exclusive bool) error {
+	return lockFileEx(file, exclusive, 0)
+}
+
+// Locks every byte a file can have. Windows releases the lock when the file is closed.
+func lockFileEx(file *os.File, exclusive bool, flags uintptr) error {
+	if exclusive {
+		flags |= lockfileExclusiveLock
+	}
+	var overlapped syscall.Overlapped
+	ok, _, err := procLockFileEx.Call(file.Fd(), flags, 0, 0xffffffff, 0xffffffff, uintptr(unsafe.Pointer(&overlapped)))
+	if ok == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// How much commands print on standard error besides errors
+const (
+	logQuiet   = iota // Errors only
+	logNormal         // Also warnings and notes such as batch summaries and listening addresses
+	logVerbose        // Also the files opened and how long every stage took
+)
+
+// Set by -v, --verbose and --quiet, of which one may be given
+var logLevel = logNormal
+
+// Set by --progress: apply draws a bar of the rows every stage has done on standard error
+var showProgress bool
+
+// Prints a note on standard error unless --quiet is given
+func logInfo(key string, args ...any) {
+	if logLevel >= logNormal {
+		fmt.Fprintln(os.Stderr, msg(key, args...))
+	}
+}
+
+// Prints a note on standard error when -v is given
+func logDetail(key string, args ...any) {
+	if logLevel >= logVerbose {
+		fmt.Fprintln(os.Stderr, msg(key, args...))
+	}
+}
+
+// Width in characters of the bar drawn by --progress
+const progressBarWidth = 30
+
+// Progress bar of the running stage, redrawn in place on standard error whenever its percentage changes
+type progressBar struct {
+	stage   string
+	percent int
+	total   int
+}
+
+// Redraws the bar for a stage that has done rows of total
+func (b *progressBar) report(stage string, done, total int) {
+	percent := 100
+	if total > 0 {
+		percent = done * 100 / total
+	}
+	if stage == b.stage && percent == b.percent {
+		return
+	}
+	b.stage, b.percent, b.total = stage, percent, total
+	b.draw(fmt.Sprintf(" (%d/%d)", done, total))
+}
+
+// Draws the bar with the count of rows after it
+func (b *progressBar) draw(rows string) {
+	filled := b.percent * progressBarWidth / 100
+	fmt.Fprintf(os.Stderr, "\r%-16s [%s%s] %3d%%%s", b.stage,
+		strings.Repeat("#", filled), strings.Repeat("-", progressBarWidth-filled), b.percent, rows)
+}
+
+// Ends the bar of a stage and moves to the next line. A stage that succeeded is shown complete, without
+// a count of rows when it never reported any.
+func (b *progressBar) finish(stage string, err error) {
+	switch {
+	case err != nil && stage != b.stage:
+		return
+	case err == nil && stage != b.stage:
+		b.stage, b.percent = stage, 100
+		b.draw("")
+	case err == nil && b.percent < 100:
+		b.report(stage, b.total, b.total)
+	}
+	fmt.Fprintln(os.Stderr)
+	b.stage, b.percent, b.total = "", 0, 0
+}
+
+// Sets the hooks of a pipeline that draw --progress bars and print stage timings with -v
+func watchPipeline(p *Pipeline) {
+	bar := &progressBar{}
+	if showProgress {
+		p.OnRowsProcessed = bar.report
+	}
+	p.OnStageEnd = func(stage string, index, total int, elapsed time.Duration, err error) {
+		if showProgress {
+			bar.finish(stage, err)
+		}
+		logDetail("info.stage_done", index+1, total, stage, elapsed.Round(time.Microsecond))
+	}
+}
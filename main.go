@@ -1,43 +1,21 @@
 package main
 
 import (
-	"encoding/binary"
-	"errors"
 	"fmt"
-	"os"
-	"strings"
-)
-
-// Represents BMP header structure (first 14 bytes)
-type BMPHeader struct {
-	FileType [2]byte // "BM"
-	FileSize uint32  // File size in bytes
-	Reserved uint32  // Reserved (always 0)
-	// Reserved2  uint16  // Reserved (always 0)
-	OffsetData uint32 // Offset to image data
-}
+	"io"
+	"path/filepath"
+	"time"
 
-// Represents DIB header structure (next 40 bytes)
-type DIBHeader struct {
-	DibHeaderSize uint32 // DIB Header size
-	Width         int32  // Width of image in pixels
-	Height        int32  // Height of image in pixels
-	Planes        uint16 // Number of color planes (must be 1)
-	BitCount      uint16 // Bits per pixel (e.g., 24 for true color)
-	Compression   uint32 // Compression (0 for uncompressed)
-	ImageSize     uint32 // Image size in bytes (can be 0 for uncompressed)
-	XPixelsPerM   int32  // Horizontal resolution (pixels per meter)
-	YPixelsPerM   int32  // Vertical resolution (pixels per meter)
-	ColorsUsed    uint32 // Number of colors used (0 means all)
-	ColorsImp     uint32 // Important colors (0 means all)
-}
+	"creditcard/bmp"
+)
 
-// Represents a single pixel in the image (for 24-bit BMP files)
-type Pixel struct {
-	Blue  byte
-	Green byte
-	Red   byte
-}
+// Headers, pixels and images are those of the bmp package, which does the decoding and encoding
+type (
+	BMPHeader = bmp.BMPHeader
+	DIBHeader = bmp.DIBHeader
+	Pixel     = bmp.Pixel
+	Image     = bmp.Image
+)
 
 // Represents a command-line option that consists of name and its value
 type Option struct {
@@ -45,217 +23,381 @@ type Option struct {
 	Value string // The associated value (e.g., "horizontal", "90", "negative", etc)
 }
 
+// Describes a header or apply command line
+type commandArgs struct {
+	command    string // "header" or "apply"
+	filename   string
+	outputs    []outputTarget // Files the apply result is written to
+	options    []Option       // Apply options in the order given
+	format     string         // Output format overriding the file extensions, or the header format, if set
+	saveStages string         // Directory that receives the image after every stage, if set
+	record     string         // GIF file that receives the source and the image after every stage, if set
+	stream     bool           // Process the image row by row instead of loading it whole
+	checkpoint string         // File recording the progress of a streaming run so that it can resume, if set
+	dpi        string         // Resolution in dots per inch written to the outputs, if set
+	tileSize   int            // Side of the tiles of tiled processing, which it turns on when set
+	maxMemory  string         // Memory tiled processing may use, such as 256M; turns it on when set
+	cacheDir   string         // Directory whose earlier results are reused and where new ones are stored, if set
+	cacheURL   string         // Remote cache shared across machines that backs the cache directory, if set
+	precision  string         // "16" to work on 16-bit levels and write 16-bit PNG files, if set
+	page       int            // Page of a PDF source to work on, counted from 1
+	rasterizer string         // Command that renders PDF pages, if set
+	warnMemory string         // Estimated memory above which apply warns before it runs
+	warnTime   time.Duration  // Estimated time above which apply warns before it runs
+	// Manifest of the source, options and outputs written after the outputs, if set, and the key it is
+	// signed with
+	provenance    string
+	provenanceKey string
+	settings      *ioSettings // Read and write settings of the run, the global ones unless a daemon request set its own
+}
+
 // Parses command-line arguments while maintaining order
-func parseArgs(args []string) (command string, filename string, outputFilename string, orderedOptions []Option, err error) {
+func parseArgs(args []string) (*commandArgs, error) {
 	if len(args) < 2 {
-		return "", "", "", nil, errors.New("invalid number of arguments")
+		return nil, msgError("error.invalid_args")
 	}
 
-	command = args[0] // "header" or "apply"
+	cmd := &commandArgs{command: args[0], settings: &globalSettings} // "header" or "apply"
+	switch cmd.command {
+	case "header":
+		// Only requires filename and takes the output format
+		flags := []flagSpec{{Name: "format", Target: &cmd.format, Choices: headerFormats}}
+		_, positional, err := parseCommandLine(args[1:], flags, false)
+		if err != nil {
+			return nil, err
+		}
+		if len(positional) != 1 {
+			return nil, msgError("usage.header")
+		}
+		cmd.filename = positional[0]
+		return cmd, nil
 
-	// Handle "header" command (only requires filename)
-	if command == "header" {
-		if len(args) != 2 {
-			return "", "", "", nil, errors.New("usage: ./bitmap header <bmp_file>")
+	case "apply":
+		// Requires at least one option or --dpi, input file, and output file, in any order
+		cmd.warnMemory, cmd.warnTime = defaultWarnMemory, defaultWarnTime
+		var outputFlags []string
+		flags := []flagSpec{
+			{Name: "format", Target: &cmd.format, Choices: outputFormats},
+			{Name: "output", Target: &outputFlags, Check: checkOutputTarget},
+			{Name: "save-stages", Target: &cmd.saveStages, Check: nonEmpty},
+			{Name: "record", Target: &cmd.record, Check: nonEmpty},
+			{Name: "stream", Target: &cmd.stream},
+			{Name: "checkpoint", Target: &cmd.checkpoint, Check: nonEmpty},
+			{Name: "dpi", Target: &cmd.dpi, Check: checkDPI},
+			{Name: "tile-size", Target: &cmd.tileSize, Min: 16},
+			{Name: "max-memory", Target: &cmd.maxMemory, Check: checkByteSize},
+			{Name: "cache-dir", Target: &cmd.cacheDir, Check: nonEmpty},
+			{Name: "cache-url", Target: &cmd.cacheURL, Check: checkCacheURL},
+			{Name: "provenance", Target: &cmd.provenance, Check: nonEmpty},
+			{Name: "provenance-key", Target: &cmd.provenanceKey},
+			{Name: "precision", Target: &cmd.precision, Choices: precisions},
+			{Name: "page", Target: &cmd.page, Min: 1},
+			{Name: "rasterizer", Target: &cmd.rasterizer, Check: checkRasterizer},
+			{Name: "warn-memory", Target: &cmd.warnMemory, Check: checkByteSize},
+			{Name: "warn-time", Target: &cmd.warnTime, Min: 1},
+		}
+		options, positional, err := parseCommandLine(args[1:], flags, true)
+		if err != nil {
+			return nil, err
+		}
+		// The output file may be given after the input file, with --output flags, or both
+		if (len(options) == 0 && cmd.dpi == "") || len(positional) < 1 || len(positional) > 2 || (len(positional) == 1 && len(outputFlags) == 0) {
+			return nil, msgError("usage.apply")
 		}
-		filename = args[1]
-		return command, filename, "", nil, nil
+		cmd.filename, cmd.options = positional[0], options
+		if len(positional) == 2 {
+			cmd.outputs = append(cmd.outputs, outputTarget{Filename: positional[1]})
+		}
+		for _, value := range outputFlags {
+			output, _ := parseOutputTarget(value)
+			cmd.outputs = append(cmd.outputs, output)
+		}
+		return cmd, nil
 	}
 
-	// Handle "apply" command (requires at least one option, input file, and output file)
-	if command == "apply" {
-		if len(args) < 4 {
-			return "", "", "", nil, errors.New("usage: ./bitmap apply [options] <source_file> <output_file>")
-		}
+	// If command is neither "header" nor "apply", then return an error
+	return nil, msgError("error.unknown_command", cmd.command)
+}
+
+// Runs an apply command and writes its provenance manifest when --provenance is set. 16-bit sources are
+// PNG files and PDF pages are rasterized, so neither has BMP headers; BMP sources are processed whole, in
+// tiles or a row at a time, as the flags and the image size call for.
+func runApply(cmd *commandArgs) error {
+	var err error
+	switch {
+	case cmd.precision == "16":
+		err = runDeepApply(cmd)
+	case cmd.settings.isPDFSource(cmd.filename):
+		err = runPDFApply(cmd)
+	default:
+		err = runBMPApply(cmd)
+	}
+	if err == nil && cmd.provenance != "" {
+		err = writeProvenance(cmd)
+	}
+	return err
+}
 
-		filename = args[len(args)-2]       // Second-to-last argument is the source file
-		outputFilename = args[len(args)-1] // Last argument is the output file
+// Runs an apply command on a BMP source
+func runBMPApply(cmd *commandArgs) error {
+	bmpHeader, dibHeader, err := cmd.settings.readHeaders(cmd.filename)
+	if err != nil {
+		return err
+	}
+	if cmd.dpi != "" {
+		setResolution(dibHeader, cmd.dpi)
+	}
+	// With --cache-dir, outputs of an identical earlier run are copied instead of computed
+	return runCachedApply(cmd, func() error {
+		// Tiles spilled to disk bound memory for any option that only moves pixels or filters them one by one
+		if useTiles(cmd) {
+			return runTiledCommand(cmd, bmpHeader, dibHeader)
+		}
+		// Huge images go from file to file a row at a time when the options allow it
+		if useStream(cmd, dibHeader) {
+			return runStreamCommand(cmd, bmpHeader, dibHeader)
+		}
+		warnExpensiveApply(cmd, dibHeader)
+		img, err := cmd.settings.readPixels(cmd.filename, bmpHeader, dibHeader)
+		if err != nil {
+			return err
+		}
 
-		for i := 1; i < len(args)-2; i++ { // Ignore the last two arguments (file names)
-			if strings.HasPrefix(args[i], "--") {
-				// Break down the option into the option name and its associated value
-				parts := strings.SplitN(args[i], "=", 2)
-				if len(parts) != 2 {
-					return "", "", "", nil, fmt.Errorf("invalid option format: %s", args[i])
-				}
-				name, value := parts[0], parts[1]
+		// Process options sequentially
+		return runApplyCommand(cmd, bmpHeader, dibHeader, img)
+	})
+}
 
-				// Slice of struct preserves the insertion order of the applied options
-				orderedOptions = append(orderedOptions, Option{Name: name, Value: value})
-			} else {
-				return "", "", "", nil, fmt.Errorf("unexpected argument: %s", args[i])
+// Runs the apply options on the image and writes the result to every output, saving the image after
+// each stage first when --save-stages is set and recording the stages as a GIF when --record is
+func runApplyCommand(cmd *commandArgs, bmpHeader *BMPHeader, dibHeader *DIBHeader, img *Image) error {
+	options, err := resolveStamps(cmd.options, cmd.filename)
+	if err != nil {
+		return err
+	}
+	pipeline := NewPipeline(options)
+	watchPipeline(pipeline)
+	if cmd.saveStages != "" {
+		if err := files.MkdirAll(cmd.saveStages); err != nil {
+			return msgError("error.create_dir", err)
+		}
+		pipeline.OnStageResult = func(stage string, index int, result *Image) error {
+			name := fmt.Sprintf("stage%02d_%s.bmp", index+1, stage)
+			return cmd.settings.saveImage(filepath.Join(cmd.saveStages, name), bmpHeader, dibHeader, result)
+		}
+	}
+	var recorder *stageRecorder
+	if cmd.record != "" {
+		recorder = newStageRecorder(img, len(options))
+		saveStage := pipeline.OnStageResult
+		pipeline.OnStageResult = func(stage string, index int, result *Image) error {
+			recorder.add(stage, index, result)
+			if saveStage != nil {
+				return saveStage(stage, index, result)
 			}
+			return nil
 		}
-
-		return command, filename, outputFilename, orderedOptions, nil
 	}
 
-	// If command is neither "header" nor "apply", then return an error
-	return "", "", "", nil, fmt.Errorf("unknown command: %s", command)
+	img, err = pipeline.Run(img)
+	if err != nil {
+		return err
+	}
+	if recorder != nil {
+		if err := recorder.save(cmd.record); err != nil {
+			return err
+		}
+	}
+	return cmd.settings.saveOutputs(cmd.outputs, cmd.format, bmpHeader, dibHeader, img)
 }
 
 // Reads the BMP and DIB headers from a file
-func readHeaders(filename string) (*BMPHeader, *DIBHeader, error) {
-	fmt.Println("Opening file: <", filename, ">")
+func (s *ioSettings) readHeaders(filename string) (*BMPHeader, *DIBHeader, error) {
+	logDetail("info.opening_file", filename)
 	// Open the file
-	file, err := os.Open(filename)
+	file, err := s.openInput(filename)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error opening file: %v", err)
+		return nil, nil, msgError("error.open_file", err)
 	}
 	defer file.Close()
+	return s.decodeHeaders(file, s.Decode)
+}
 
-	// Read the BMP header info
-	var bmpHeader BMPHeader
-	if err := binary.Read(file, binary.LittleEndian, &bmpHeader); err != nil {
-		return nil, nil, fmt.Errorf("error reading BMP header: %v", err)
-	}
-
-	if string(bmpHeader.FileType[:]) != "BM" {
-		return nil, nil, errors.New("error: not a valid BMP file")
+// Reads the BMP and DIB headers of the image selected by opts.Index from a stream
+func (s *ioSettings) decodeHeaders(r io.ReadSeeker, opts DecodeOptions) (*BMPHeader, *DIBHeader, error) {
+	opts.Warn = printWarning
+	if s.Isolate {
+		bmpHeader, dibHeader, _, err := decodeIsolated(r, opts, true)
+		return bmpHeader, dibHeader, err
 	}
-
-	// Read the DIB header info
-	var dibHeader DIBHeader
-	if err := binary.Read(file, binary.LittleEndian, &dibHeader); err != nil {
-		return nil, nil, fmt.Errorf("error reading DIB header: %v", err)
+	counter := &readCounter{ReadSeeker: r}
+	bmpHeader, dibHeader, err := bmp.DecodeHeaders(counter, opts)
+	metrics.addBytesRead(counter.n)
+	if err != nil {
+		return nil, nil, localizeError(err)
 	}
-
-	return &bmpHeader, &dibHeader, nil
-}
-
-// Prints the BMP and DIB header information
-func printHeader(bmp *BMPHeader, dib *DIBHeader) {
-	fmt.Println("BMP Header:")
-	fmt.Printf("- FileType %s\n", string(bmp.FileType[:]))
-	fmt.Printf("- FileSizeInBytes %d\n", bmp.FileSize)
-	fmt.Printf("- HeaderSize %d\n", bmp.OffsetData)
-
-	fmt.Println("DIB Header:")
-	fmt.Printf("- DibHeaderSize %d\n", dib.DibHeaderSize)
-	fmt.Printf("- WidthInPixels %d\n", dib.Width)
-	fmt.Printf("- HeightInPixels %d\n", dib.Height)
-	fmt.Printf("- PixelSizeInBits %d\n", dib.BitCount)
-	fmt.Printf("- ImageSizeInBytes %d\n", dib.ImageSize)
+	return bmpHeader, dibHeader, nil
 }
 
-// Reads the pixel data from the BMP file
-func readPixels(filename string, bmpHeader *BMPHeader, dibHeader *DIBHeader) ([]Pixel, error) {
-	return nil, nil
-}
-
-// Writes the modified pixel data to an output BMP file
-func writePixels(filename string, bmpHeader *BMPHeader, dibHeader *DIBHeader, pixels []Pixel) error {
-	return nil
+// Prints the BMP and DIB header information and what the embedded color profile, if any, says about itself,
+// a field name and its value on each line separated by a tab for newTableWriter
+func printHeader(w io.Writer, bmpHeader *BMPHeader, dib *DIBHeader, profile []byte) {
+	fmt.Fprintln(w, "BMP Header:")
+	fmt.Fprintf(w, "- FileType\t%s\n", string(bmpHeader.FileType[:]))
+	fmt.Fprintf(w, "- FileSizeInBytes\t%d\n", bmpHeader.FileSize)
+	fmt.Fprintf(w, "- HeaderSize\t%d\n", bmpHeader.OffsetData)
+
+	fmt.Fprintln(w, "DIB Header:")
+	fmt.Fprintf(w, "- DibHeaderSize\t%d\n", dib.DibHeaderSize)
+	fmt.Fprintf(w, "- WidthInPixels\t%d\n", dib.Width)
+	fmt.Fprintf(w, "- HeightInPixels\t%d\n", dib.Height)
+	fmt.Fprintf(w, "- PixelSizeInBits\t%d\n", dib.BitCount)
+	fmt.Fprintf(w, "- ImageSizeInBytes\t%d\n", dib.ImageSize)
+	// Core headers have no resolution fields
+	if dib.DibHeaderSize >= 40 {
+		fmt.Fprintf(w, "- XPixelsPerMeter\t%d (%g DPI)\n", dib.XPixelsPerM, dotsPerInch(dib.XPixelsPerM))
+		fmt.Fprintf(w, "- YPixelsPerMeter\t%d (%g DPI)\n", dib.YPixelsPerM, dotsPerInch(dib.YPixelsPerM))
+	}
+	// Longer header versions and BI_BITFIELDS files carry channel masks, V4 and V5 headers a color space
+	if dib.DibHeaderSize >= 52 || dib.Compression == 3 || dib.Compression == 6 {
+		fmt.Fprintf(w, "- RedMask\t0x%08x\n", dib.RedMask)
+		fmt.Fprintf(w, "- GreenMask\t0x%08x\n", dib.GreenMask)
+		fmt.Fprintf(w, "- BlueMask\t0x%08x\n", dib.BlueMask)
+		fmt.Fprintf(w, "- AlphaMask\t0x%08x\n", dib.AlphaMask)
+	}
+	if dib.DibHeaderSize >= 108 {
+		fmt.Fprintf(w, "- ColorSpace\t%s\n", dib.ColorSpaceName())
+	}
+	if dib.DibHeaderSize >= 124 {
+		fmt.Fprintf(w, "- RenderingIntent\t%d\n", dib.Intent)
+		fmt.Fprintf(w, "- ProfileOffset\t%d\n", dib.ProfileData)
+		fmt.Fprintf(w, "- ProfileSizeInBytes\t%d\n", dib.ProfileSize)
+	}
+	if profile != nil {
+		info := bmp.ParseProfile(profile)
+		fmt.Fprintln(w, "ICC Profile:")
+		fmt.Fprintf(w, "- Version\t%s\n", info.Version)
+		fmt.Fprintf(w, "- DeviceClass\t%s\n", info.Class)
+		fmt.Fprintf(w, "- ColorSpace\t%s\n", info.ColorSpace)
+		fmt.Fprintf(w, "- Description\t%s\n", info.Description)
+	}
 }
 
-// Applies horizontal or vertical mirroring
-func applyMirror(pixels []Pixel, width, height int, mode string) []Pixel {
-	return pixels
+// Reads the ICC profile embedded in a BMP file, or returns nil when the file has none
+func (s *ioSettings) readProfile(filename string, dibHeader *DIBHeader) ([]byte, error) {
+	file, err := s.openInput(filename)
+	if err != nil {
+		return nil, msgError("error.open_file", err)
+	}
+	defer file.Close()
+	opts := s.Decode
+	opts.Warn = printWarning
+	profile, err := bmp.DecodeProfile(file, dibHeader, opts)
+	if err != nil {
+		return nil, localizeError(err)
+	}
+	return profile, nil
 }
 
-// Applies various filters like blue, red, green, grayscale, negative, pixelate or blur
-func applyFilter(pixels []Pixel, width, height int, filterType string) []Pixel {
-	return pixels
+// Reads the pixel data from the BMP file into an Image
+func (s *ioSettings) readPixels(filename string, bmpHeader *BMPHeader, dibHeader *DIBHeader) (*Image, error) {
+	file, err := s.openInput(filename)
+	if err != nil {
+		return nil, msgError("error.open_file", err)
+	}
+	defer file.Close()
+	return s.decodePixels(file, bmpHeader, dibHeader, s.Decode)
 }
 
-// Rotates the image by 90, 180 or 270 degrees both clockwise and counterclockwise
-func applyRotate(pixels []Pixel, width, height int, angle int) []Pixel {
-	return pixels
+// Reads the pixel data of the image selected by opts.Index from a stream positioned anywhere within the file
+func (s *ioSettings) decodePixels(r io.ReadSeeker, bmpHeader *BMPHeader, dibHeader *DIBHeader, opts DecodeOptions) (*Image, error) {
+	defer metrics.observeStage("decode", time.Now())
+	opts.Warn = printWarning
+	if s.Isolate {
+		_, _, img, err := decodeIsolated(r, opts, false)
+		return img, err
+	}
+	counter := &readCounter{ReadSeeker: r}
+	img, err := bmp.DecodePixels(counter, bmpHeader, dibHeader, opts)
+	metrics.addBytesRead(counter.n)
+	if err != nil {
+		return nil, localizeError(err)
+	}
+	return img, nil
 }
 
-// Crops the image based on the given parameters
-func applyCrop(pixels []Pixel, width, height, offsetX, offsetY, cropWidth, cropHeight int) []Pixel {
-	return pixels
+// Reads the headers and pixel data of a BMP file into an Image
+func (s *ioSettings) loadImage(filename string) (*BMPHeader, *DIBHeader, *Image, error) {
+	bmpHeader, dibHeader, err := s.readHeaders(filename)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	img, err := s.readPixels(filename, bmpHeader, dibHeader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return bmpHeader, dibHeader, img, nil
 }
 
-// Displays general usage instructions
-func displayGeneralHelp() {
-	fmt.Println("Usage:")
-	fmt.Println("  bitmap <command> [arguments]")
-	fmt.Println()
-	fmt.Println("The commands are:")
-	fmt.Println("  header    prints bitmap file header information")
-	fmt.Println("  apply     applies processing to the image and saves it to the file")
+// Reads a whole BMP image from a stream
+func (s *ioSettings) decodeImage(r io.ReadSeeker) (*BMPHeader, *DIBHeader, *Image, error) {
+	bmpHeader, dibHeader, err := s.decodeHeaders(r, s.Decode)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	img, err := s.decodePixels(r, bmpHeader, dibHeader, s.Decode)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return bmpHeader, dibHeader, img, nil
 }
 
-// Displays usage instructions for header command
-func displayHeaderHelp() {
-	fmt.Println("Usage:")
-	fmt.Println("  bitmap header <source_file>")
-	fmt.Println()
-	fmt.Println("Description:")
-	fmt.Println("  Prints bitmap file header information")
+// Writes an image to a BMP file, taking the remaining header fields from the source headers
+func (s *ioSettings) saveImage(filename string, bmpHeader *BMPHeader, dibHeader *DIBHeader, img *Image) error {
+	defer metrics.observeStage("encode", time.Now())
+	dib := outputDIBHeader(dibHeader, img)
+	if err := s.writePixels(filename, bmpHeader, &dib, img); err != nil {
+		return err
+	}
+	return s.runPostHook(filename, img)
 }
 
-// Displays usage instructions for apply command
-func displayApplyHelp() {
-	fmt.Println("Usage:")
-	fmt.Println("  bitmap apply [options] <source_file> <output_file>")
-	fmt.Println()
-	fmt.Println("The options are:")
-	fmt.Println("  -h, --help                                                      prints program usage information")
-	fmt.Println("  --mirror=<horizontal|vertical>                                  mirrors the image along the specified axis")
-	fmt.Println("  --filter=<blue|red|green|grayscale|negative|pixelate|blur>      applies a specified filter to the image")
-	fmt.Println("  --rotate=<right|left|90|-90|180|-180|270|-270>                  rotates the image by the specified angle")
-	fmt.Println("  --crop=<offsetX-offsetY-width-height>                           crops the image based on the specified offset and dimensions")
-	fmt.Println()
-	fmt.Println("Note:")
-	fmt.Println("  Multiple options can be combined and applied sequentially")
+// Writes an image as a BMP file to a stream, taking the remaining header fields from the source headers
+func (s *ioSettings) encodeImage(w io.Writer, bmpHeader *BMPHeader, dibHeader *DIBHeader, img *Image) error {
+	defer metrics.observeStage("encode", time.Now())
+	dib := outputDIBHeader(dibHeader, img)
+	return encodePixels(w, bmpHeader, &dib, img, s.Encode)
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		displayGeneralHelp()
-		os.Exit(1)
+// Returns the source DIB header with the size of the image. The height stays negative for top-down
+// sources, so that --keep-orientation can write the rows in the same order.
+func outputDIBHeader(dibHeader *DIBHeader, img *Image) DIBHeader {
+	dib := *dibHeader
+	dib.Width, dib.Height = int32(img.Width), int32(img.Height)
+	if dibHeader.Height < 0 {
+		dib.Height = -dib.Height
 	}
+	return dib
+}
 
-	command, filename, outputFilename, orderedOptions, err := parseArgs(os.Args[1:])
+// Writes the modified pixel data to an output BMP file
+func (s *ioSettings) writePixels(filename string, bmpHeader *BMPHeader, dibHeader *DIBHeader, img *Image) error {
+	file, err := s.createOutput(filename)
 	if err != nil {
-		fmt.Println("Error:", err)
-		os.Exit(1)
+		return msgError("error.create_file", err)
 	}
+	defer file.Close()
 
-	bmpHeader, dibHeader, err := readHeaders(filename)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error:", err)
-		os.Exit(1)
+	if err := encodePixels(file, bmpHeader, dibHeader, img, s.Encode); err != nil {
+		return err
 	}
+	return file.Close()
+}
 
-	switch command {
-	case "header":
-		printHeader(bmpHeader, dibHeader)
-
-	case "apply":
-		pixels, err := readPixels(filename, bmpHeader, dibHeader)
-		if err != nil {
-			fmt.Println("Error:", err)
-			os.Exit(1)
-		}
-
-		// Process options sequentially
-		for _, opt := range orderedOptions {
-			switch opt.Name {
-			case "--mirror":
-				pixels = applyMirror(pixels, int(dibHeader.Width), int(dibHeader.Height), opt.Value)
-			case "--filter":
-				pixels = applyFilter(pixels, int(dibHeader.Width), int(dibHeader.Height), opt.Value)
-			case "--rotate":
-				angle := 0 // Parse rotation value
-				pixels = applyRotate(pixels, int(dibHeader.Width), int(dibHeader.Height), angle)
-			case "--crop":
-				// Parse crop values and apply cropping
-				pixels = applyCrop(pixels, int(dibHeader.Width), int(dibHeader.Height), 0, 0, 100, 100)
-			}
-		}
-
-		err = writePixels(outputFilename, bmpHeader, dibHeader, pixels)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-			os.Exit(1)
-		}
-
-	default:
-		displayGeneralHelp()
-		os.Exit(1)
-	}
+// Writes a BMP file with the image's pixels to a stream
+func encodePixels(out io.Writer, bmpHeader *BMPHeader, dibHeader *DIBHeader, img *Image, opts EncodeOptions) error {
+	counter := &writeCounter{Writer: out}
+	err := bmp.EncodePixels(counter, bmpHeader, dibHeader, img, opts)
+	metrics.addBytesWritten(counter.n)
+	return localizeError(err)
 }
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"math"
+
+	"creditcard/bmp"
+)
+
+// Ways match-colors transfers the look of the reference
+var matchMethods = []string{"reinhard", "histogram"}
+
+// Settings of the match-colors command
+type matchConfig struct {
+	reference string
+	method    string
+	input     string
+	output    string
+}
+
+// Parses the arguments of the match-colors command
+func parseMatchArgs(args []string) (*matchConfig, error) {
+	cfg := &matchConfig{method: "reinhard"}
+	flags := []flagSpec{
+		{Name: "reference", Target: &cfg.reference, Check: nonEmpty},
+		{Name: "method", Target: &cfg.method, Choices: matchMethods},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 2 || cfg.reference == "" {
+		return nil, msgError("usage.match_colors")
+	}
+	cfg.input, cfg.output = positional[0], positional[1]
+	return cfg, nil
+}
+
+// Recolors an image so that its colors follow those of a reference image, giving a series of shots
+// a consistent look. The output format follows the extension of the output file.
+func runMatchColors(args []string) error {
+	cfg, err := parseMatchArgs(args)
+	if err != nil {
+		return err
+	}
+	_, _, reference, err := globalSettings.loadImage(cfg.reference)
+	if err != nil {
+		return err
+	}
+	bmpHeader, dibHeader, img, err := globalSettings.loadImage(cfg.input)
+	if err != nil {
+		return err
+	}
+
+	var result *Image
+	if cfg.method == "histogram" {
+		result = matchHistograms(img, reference)
+	} else {
+		result = transferColors(img, reference)
+	}
+	return globalSettings.saveOutput(cfg.output, "", bmpHeader, dibHeader, result)
+}
+
+// Returns an image with the size, layout and alpha of img and the given pixels
+func recolored(img *Image, pixels []Pixel) *Image {
+	return &Image{Width: img.Width, Height: img.Height, Pixels: pixels, Alpha: img.Alpha, Gap: img.Gap, Palette: img.Palette, Hints: img.Hints}
+}
+
+// Maps every channel through the level whose share of the reference pixels at or below it first reaches
+// the share of the image pixels at or below the original level, so that each channel of the result has
+// the histogram of the reference as closely as whole levels allow
+func matchHistograms(img, reference *Image) *Image {
+	source, target := bmp.Stats(img), bmp.Stats(reference)
+	red := matchLevels(&source.Red.Histogram, &target.Red.Histogram)
+	green := matchLevels(&source.Green.Histogram, &target.Green.Histogram)
+	blue := matchLevels(&source.Blue.Histogram, &target.Blue.Histogram)
+
+	pixels := make([]Pixel, len(img.Pixels))
+	for i, p := range img.Pixels {
+		pixels[i] = Pixel{Blue: blue[p.Blue], Green: green[p.Green], Red: red[p.Red]}
+	}
+	return recolored(img, pixels)
+}
+
+// Returns the table that maps the levels of one histogram onto those of another with the same cumulative share
+func matchLevels(source, target *[256]int) *[256]byte {
+	cumulative := func(histogram *[256]int) (shares [256]float64) {
+		var total, sum int
+		for _, count := range histogram {
+			total += count
+		}
+		for level, count := range histogram {
+			sum += count
+			shares[level] = float64(sum) / float64(total)
+		}
+		return shares
+	}
+	from, to := cumulative(source), cumulative(target)
+
+	var levels [256]byte
+	level := 0
+	for i := range levels {
+		for level < 255 && to[level] < from[i] {
+			level++
+		}
+		levels[i] = byte(level)
+	}
+	return &levels
+}
+
+// Converts a color to the lαβ space of Reinhard et al., in which the channels are nearly uncorrelated so
+// that each can be shifted on its own. The levels are taken to linear light first; black is lifted to half
+// the first level above it, which the space needs as it is logarithmic and which still rounds back to black.
+func toLAlphaBeta(p Pixel) [3]float64 {
+	floor := bmp.LinearIntensity(1) / 2
+	r := max(bmp.LinearIntensity(p.Red), floor)
+	g := max(bmp.LinearIntensity(p.Green), floor)
+	b := max(bmp.LinearIntensity(p.Blue), floor)
+	l := math.Log10(0.3811*r + 0.5783*g + 0.0402*b)
+	m := math.Log10(0.1967*r + 0.7244*g + 0.0782*b)
+	s := math.Log10(0.0241*r + 0.1288*g + 0.8444*b)
+	return [3]float64{(l + m + s) / math.Sqrt(3), (l + m - 2*s) / math.Sqrt(6), (l - m) / math.Sqrt(2)}
+}
+
+// Converts a color back from lαβ with the inverse of the matrices, clamping it to the sRGB range
+func fromLAlphaBeta(c [3]float64) Pixel {
+	l := math.Pow(10, c[0]/math.Sqrt(3)+c[1]/math.Sqrt(6)+c[2]/math.Sqrt(2))
+	m := math.Pow(10, c[0]/math.Sqrt(3)+c[1]/math.Sqrt(6)-c[2]/math.Sqrt(2))
+	s := math.Pow(10, c[0]/math.Sqrt(3)-2*c[1]/math.Sqrt(6))
+	return Pixel{
+		Red:   bmp.SRGBLevel(4.4687*l - 3.5887*m + 0.1196*s),
+		Green: bmp.SRGBLevel(-1.2197*l + 2.3831*m - 0.1626*s),
+		Blue:  bmp.SRGBLevel(0.0585*l - 0.2611*m + 1.2057*s),
+	}
+}
+
+// Returns the mean and standard deviation of every lαβ channel over the pixels of an image
+func lAlphaBetaStats(img *Image) (mean, deviation [3]float64) {
+	var sum, sumSquares [3]float64
+	for _, p := range img.Pixels {
+		c := toLAlphaBeta(p)
+		for k := range c {
+			sum[k] += c[k]
+			sumSquares[k] += c[k] * c[k]
+		}
+	}
+	n := float64(len(img.Pixels))
+	for k := range mean {
+		mean[k] = sum[k] / n
+		deviation[k] = math.Sqrt(max(0, sumSquares[k]/n-mean[k]*mean[k]))
+	}
+	return mean, deviation
+}
+
+// Transfers the color statistics of the reference to the image as Reinhard et al. describe: in lαβ,
+// every channel is shifted and scaled so that its mean and standard deviation become those of the
+// reference. Channels that are flat in the image are only shifted.
+func transferColors(img, reference *Image) *Image {
+	sourceMean, sourceDeviation := lAlphaBetaStats(img)
+	targetMean, targetDeviation := lAlphaBetaStats(reference)
+	var scale [3]float64
+	for k := range scale {
+		scale[k] = 1
+		if sourceDeviation[k] > 0 {
+			scale[k] = targetDeviation[k] / sourceDeviation[k]
+		}
+	}
+
+	pixels := make([]Pixel, len(img.Pixels))
+	for i, p := range img.Pixels {
+		c := toLAlphaBeta(p)
+		for k := range c {
+			c[k] = (c[k]-sourceMean[k])*scale[k] + targetMean[k]
+		}
+		pixels[i] = fromLAlphaBeta(c)
+	}
+	return recolored(img, pixels)
+}
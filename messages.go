@@ -0,0 +1,1210 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"creditcard/bmp"
+)
+
+// Language used for user-facing messages, set from --lang or the environment
+var language = "en"
+
+// Message catalogs keyed by language code, then by message key.
+// Messages are fmt format strings; translations may reorder arguments with %[n]v.
+var catalogs = map[string]map[string]string{
+	"en": {
+		"error.prefix":                 "Error:",
+		"error.invalid_args":           "invalid number of arguments",
+		"error.invalid_option":         "invalid option format: %s",
+		"error.missing_value":          "missing value for option %s",
+		"error.default_value":          "%s: %v",
+		"error.config_line":            "invalid config line %s:%d: expected name = value in the [defaults] section",
+		"error.flag_value":             "invalid value %q for --%s: expected %s",
+		"error.flag_conflict":          "--%s and --%s cannot be combined",
+		"expect.bool":                  "true or false",
+		"expect.int":                   "an integer of at least %d",
+		"expect.duration":              "a duration such as 30s",
+		"expect.positive_duration":     "a duration greater than zero, such as 30s",
+		"expect.choice":                "one of %s",
+		"expect.non_empty":             "a non-empty value",
+		"expect.output":                "<file>[:WxH] with positive sizes",
+		"expect.components":            "XxY with each count from 1 to 9",
+		"expect.size":                  "WxH with positive sizes",
+		"expect.color_range":           "first-last with 0 <= first < last <= 255",
+		"expect.strip_pattern":         "a file name with one integer verb for the strip number, such as part_%02d.bmp",
+		"expect.color":                 "a color as rrggbb or #rrggbb",
+		"expect.dpi":                   "a positive number of dots per inch, such as 300",
+		"expect.prune_similar":         "a histogram distance from 0 to 1, such as 0.05",
+		"expect.metric":                "one of the metrics %s, optionally followed by \":\" and a score that is not negative",
+		"expect.fit_ops":               "options from %s, separated by commas, each at most once",
+		"expect.byte_size":             "a positive number of bytes, optionally with K, M or G, such as 256M",
+		"expect.url":                   "an http:// or https:// URL",
+		"expect.command":               "a command starting with the program to run",
+		"expect.post_hook":             "a command with the placeholders %s",
+		"expect.language":              "one of the languages %s, or a locale such as ru_RU.UTF-8",
+		"expect.stack_weights":         "flat, gauss with an optional width in frames such as gauss,3, ramp, or weights that are not negative and not all 0 separated by commas",
+		"error.invalid_assert":         "invalid assertion %q: expected dimensions:WxH, max-colors:N or not-blank",
+		"error.assert_dimensions":      "assertion failed: image is %dx%d, expected %dx%d",
+		"error.assert_colors":          "assertion failed: image has more than %d colors",
+		"error.assert_blank":           "assertion failed: image is blank",
+		"error.invalid_condition":      "invalid condition %q: expected width, height or pixels, a comparison (>, <, >=, <=, ==, !=) and a number",
+		"error.guard_last":             "condition %q is not followed by an option to run",
+		"error.unexpected_arg":         "unexpected argument: %s",
+		"error.unknown_command":        "unknown command: %s",
+		"error.unknown_option":         "unknown option: %s",
+		"error.unknown_topic":          "unknown command or option: %s",
+		"error.open_file":              "error opening file: %v",
+		"error.create_file":            "error creating file: %v",
+		"error.start_server":           "error starting server: %v",
+		"error.write_script":           "error writing script: %v",
+		"error.invalid_crop":           "invalid crop format: %s",
+		"error.invalid_crop_val":       "invalid crop value: %s",
+		"error.invalid_pixelate":       "invalid pixelation %q: expected an area as for --crop, optionally followed by :size with a positive block size",
+		"error.invalid_fit":            "invalid fit %q: expected WxH, optionally followed by :upscale or :no-upscale",
+		"error.invalid_resize":         "invalid resize %q: expected WxH of at most %d pixels, optionally followed by :bilinear or :nearest",
+		"error.invalid_scale":          "invalid scale %q: expected a positive factor giving at most %d pixels, optionally followed by :bilinear or :nearest",
+		"error.invalid_upscale":        "invalid upscale %q: expected scale2x, hq2x or xbr, optionally followed by :2, :3 or :4",
+		"error.invalid_zoom":           "invalid zoom %q: expected a factor from 2x to %dx, optionally followed by :grid",
+		"error.invalid_smartcrop":      "invalid smart crop size %q: expected WxH",
+		"error.smartcrop_bounds":       "smart crop window %dx%d is larger than the %dx%d image",
+		"error.stream_option":          "option %s=%s cannot be applied row by row; --stream supports --mirror=horizontal, --crop and the blue, red, green, grayscale and negative filters",
+		"error.stream_output":          "--stream, --tile-size and --max-memory write a single BMP file without a size, --save-stages, --record, --embed, --compact or --keep-offset",
+		"error.tile_option":            "option %s=%s cannot run on tiles; --tile-size and --max-memory support --mirror, --rotate by multiples of 90 degrees, --crop and the blue, red, green, grayscale and negative filters",
+		"error.checkpoint_tiles":       "--checkpoint resumes streaming runs and cannot be combined with --tile-size or --max-memory",
+		"error.checkpoint_files":       "--checkpoint needs a local source file and a local output file, without --encrypt",
+		"error.no_preview":             "%s holds no JPEG preview that can be decoded",
+		"error.invalid_testcard_steps": "invalid --steps %d: a gray-steps card has at most %d steps",
+		"error.testcard_small":         "a %dx%d image is too small to measure %d steps; crop the photograph to the card",
+		"error.video_container":        "%s is neither a YUV4MPEG2 (.y4m) nor an AVI video",
+		"error.video_codec":            "frames reads uncompressed RGB and YUV video only, not %s; ffmpeg -i <video> frame_%%06d.bmp extracts the frames of any other",
+		"error.video_damaged":          "%s is damaged: %v",
+		"error.no_frames":              "%s has %d frames, none of them from --start=%d on",
+		"video.truncated":              "it ends in the middle of a frame",
+		"video.long_line":              "a header line is too long",
+		"video.short_format":           "the format of its video stream is too short",
+		"video.large_frame":            "a frame of %d bytes is larger than its format allows",
+		"video.short_frame":            "a frame holds %d bytes of the %d its format needs",
+		"video.no_stream":              "it has no video stream",
+		"video.frame_size":             "its frames of %dx%d pixels are empty or too large",
+		"error.pdf_page_content":       "%s: page %d cannot be read without a rasterizer (%v); install pdftoppm or set --rasterizer=<command>",
+		"error.pdf_page_range":         "%s has %d pages, so there is no page %d",
+		"error.pdf_rasterizer":         "rasterizer %s failed: %v",
+		"error.no_rasterizer":          "--rasterizer names no program to run",
+		"pdf.color_space":              "the %s color space is not supported",
+		"pdf.damaged":                  "the document or its image cannot be parsed",
+		"pdf.encrypted":                "the document is encrypted",
+		"pdf.filter":                   "images compressed with %s are not supported",
+		"pdf.no_image":                 "the page holds no image",
+		"pdf.partial_image":            "no image covers the whole page",
+		"error.precision_flag":         "--precision=16 cannot be combined with %s",
+		"error.precision_format":       "--precision=16 writes PNG files only, not %s",
+		"error.precision_operation":    "%s does not work at 16 bits per channel; --precision=16 supports --mirror, --rotate, --crop, --resize, --scale, --filter, --brightness, --contrast, --saturation, --gamma and --colorspace",
+		"error.precision_filter":       "--precision=16 does not support --filter=%s; it supports red, green, blue, grayscale and negative",
+		"error.precision_angle":        "--precision=16 rotates by multiples of 90 degrees only, not %s",
+		"error.read_checkpoint":        "error reading checkpoint file: %v",
+		"error.write_checkpoint":       "error writing checkpoint: %v",
+		"error.invalid_ninepatch":      "invalid nine-patch %q: expected left,top,right,bottom:WxH",
+		"error.ninepatch_size":         "nine-patch borders %s do not fit in %dx%d",
+		"error.ninepatch_bounds":       "nine-patch borders %d,%d,%d,%d leave no center in the %dx%d image",
+		"error.invalid_trim":           "invalid trim mode %q: expected alpha",
+		"error.invalid_auto_rotate":    "invalid auto-rotate mode %q: expected text",
+		"error.trim_empty":             "cannot trim: every pixel is fully transparent",
+		"error.invalid_deskew":         "invalid deskew %q: expected the largest skew in degrees, above 0 and at most %d",
+		"error.invalid_threshold":      "invalid threshold %q: expected otsu, adaptive[,window[,offset]] with an odd window from 3 to 1001 and an offset from -255 to 255, or a level from 0 to 255",
+		"error.invalid_despeckle":      "invalid despeckle strength %q: expected 1 to %d",
+		"error.invalid_margin_crop":    "invalid margin crop %q: expected padding in pixels from 0 to %d",
+		"error.invalid_preset":         "unknown preset %q: expected ocr",
+		"error.invalid_outline":        "invalid outline %q: expected width,rrggbb with a width from 1 to %d",
+		"error.invalid_blur":           "invalid blur %q: expected a radius from 1 to %d, optionally followed by ,gaussian or ,box",
+		"error.invalid_convolve":       "invalid kernel %q: expected 9 or 25 weights separated by commas, optionally followed by :clamp, :wrap or :mirror",
+		"error.invalid_colorspace":     "invalid color space %q: expected srgb or linear",
+		"error.invalid_adjustment":     "invalid %s %q: expected a whole number from -100 to 100",
+		"error.invalid_gamma":          "invalid gamma %q: expected a positive number such as 2.2",
+		"error.invalid_auto_expose":    "invalid auto-expose %q: expected from:x,y,w,h with a positive width and height",
+		"error.channel_size":           "channel file %s is %dx%d, expected %dx%d like the first one",
+		"error.invalid_strip_pattern":  "invalid strip file pattern %q: expected %s",
+		"error.no_gutter":              "no gutter between two pages found in %s: expected a book scan with a blank or shadowed band in its middle third",
+		"error.strip_width":            "strip file %s is %d pixels wide, expected %d like the first one",
+		"error.invalid_colormap":       "invalid colormap %q: expected viridis, jet, magma or grayscale",
+		"error.invalid_backend":        "invalid backend %q: expected cpu or gpu",
+		"error.gpu_not_built":          "this build has no GPU backend; build with -tags gpu",
+		"error.gpu_library":            "no OpenCL library found",
+		"error.gpu_symbol":             "%s has no %s",
+		"error.gpu_setup":              "OpenCL %s failed with error %d",
+		"error.post_hook":              "post hook %s failed for %s: %v",
+		"error.encrypted":              "%s is encrypted: give its passphrase with --decrypt",
+		"error.encrypted_format":       "not an encrypted container of a supported version",
+		"error.encrypted_iterations":   "the container asks for %d key derivation iterations, more than the %d allowed",
+		"error.decrypt":                "cannot decrypt: wrong passphrase, or the file was altered",
+		"error.compare_size":           "images differ in size: %dx%d and %dx%d",
+		"error.stack_size":             "frame %s is %dx%d, but the first frame is %dx%d",
+		"error.stack_weight_count":     "--weights lists %d weights for %d frames",
+		"error.fit_aspect":             "the source of %dx%d and the target of %dx%d differ in aspect ratio",
+		"error.split_position":         "invalid split position %d: expected a percentage from 0 to 100",
+		"error.histogram_bins":         "invalid number of bins %d: expected 1, 2, 4, 8, 16, 32, 64, 128 or 256",
+		"error.thumbs_empty":           "no readable BMP files in %s",
+		"error.images_differ":          "images differ in %d pixels",
+		"error.invalid_bitplane":       "invalid bit plane %q: expected channel:bit with a channel of red, green, blue or alpha and a bit from 0 to 7",
+		"error.invalid_pixelsort":      "invalid pixel sort %q: expected threshold[,direction] with a threshold from 0 to 255 and a direction of horizontal or vertical",
+		"error.invalid_rowshift":       "invalid row shift %q: expected amount[:seed] with a positive amount",
+		"error.invalid_crystallize":    "invalid crystallize %q: expected cells[:seed] with from 1 to %d cells",
+		"error.invalid_lens":           "invalid lens distortion %q: expected two or three coefficients k1,k2[,k3]",
+		"error.invalid_swirl":          "invalid swirl %q: expected degrees[,radius] with a positive radius in pixels",
+		"error.invalid_implode":        "invalid implode factor %q: expected a number from -1 to 1",
+		"error.invalid_param":          "invalid %s %q for --%s: expected %s",
+		"error.invalid_wave":           "invalid wave %q: expected amplitude,wavelength in pixels with a positive wavelength",
+		"error.invalid_kaleidoscope":   "invalid kaleidoscope %q: expected segments[,angle] with from 2 to %d segments",
+		"error.invalid_symmetry":       "invalid symmetry %q: expected horizontal, vertical or quad",
+		"error.invalid_overlay":        "invalid overlay %q: expected file:x,y[:opacity[:mode]] with an opacity from 0 to 1",
+		"error.invalid_overlay_mode":   "unknown blend mode %q: expected one of %s",
+		"error.invalid_displace":       "invalid displacement %q: expected file[:strength] with strength in pixels",
+		"error.invalid_stamp":          "invalid stamp %q: expected [corner:]text with some text",
+		"error.invalid_source_date":    "invalid SOURCE_DATE_EPOCH %q: expected a non-negative number of seconds since 1970",
+		"error.stamp_field":            "unknown stamp field %s: expected {filename}, {stem} or {mtime}",
+		"error.auto_expose_bounds":     "auto-expose area %d,%d %dx%d exceeds the image bounds %dx%d",
+		"error.auto_expose_black":      "auto-expose area is black, so no exposure brings it to middle gray",
+		"error.read_hints":             "error reading hints from %s: %v",
+		"error.invalid_hint":           "invalid hint in %s: box %d needs a positive width and height and a non-negative weight",
+		"error.crop_bounds":            "area %s (%dx%d at %d,%d) is outside the %dx%d image",
+		"usage.header":                 "usage: ./bitmap header [--format=<text|json|yaml>] <bmp_file>",
+		"usage.apply":                  "usage: ./bitmap apply [options] <source_file> [<output_file>] [--output=<file>[:WxH]]...",
+		"usage.tune":                   "usage: ./bitmap tune [options] <source_file>",
+		"usage.help":                   "usage: ./bitmap help [command|option]",
+		"usage.man":                    "usage: ./bitmap man",
+		"info.opening_file":            "Opening file: < %s >",
+		"info.lock_wait":               "Waiting for another run to finish with %s",
+		"info.gpu_device":              "Running filters, convolutions and resizing on %s",
+		"info.pdf_image":               "Reading page %d as its %dx%d scanned image",
+		"info.pdf_rasterizer":          "Page %d cannot be read directly (%v); rendering it with %s",
+		"info.deskew":                  "Straightening a skew of %.2f degrees",
+		"info.estimate":                "Estimated to need %s of memory and take %v",
+		"info.post_hook":               "Running %s",
+		"info.stack_frame":             "Frame %d of %d stacked: %s",
+		"info.split_pages":             "Pages end at column %d and start at column %d",
+		"info.auto_rotate":             "Turning text rotated by %d degrees upright",
+		"info.frames_written":          "%d frames written to %s",
+		"info.frames_pruned":           "%d frames left out as similar to the last one written",
+		"info.frame_pruned":            "frame %d left out: %.3f from the last frame written",
+		"info.checkpoint_resumed":      "Resuming at row %d of %d from %s",
+		"info.fetch_range":             "Fetched bytes %d-%d of %d from %s",
+		"info.cache_hit":               "Copied %s from the cache",
+		"info.stage_done":              "stage %d of %d, %s, took %s",
+		"info.shell_loaded":            "%s: %dx%d; type help for commands",
+		"info.shell_applied":           "%s: %dx%d in %s",
+		"info.shell_state":             "%dx%d, %d steps to undo, %d to redo",
+		"info.shell_saved":             "saved %s",
+		"info.shell_preview":           "preview written to %s",
+		"info.pick_keys":               "arrows move, Shift+arrows resize, Enter prints, q cancels",
+		"info.shell_undone":            "(undone)",
+		"info.shell_no_steps":          "no steps applied",
+		"info.selftest_ok":             "ok    %-44s %08x",
+		"info.selftest_fail":           "FAIL  %-44s %08x, expected %08x",
+		"info.selftest_error":          "FAIL  %-44s %v",
+		"info.selftest_jobs":           "FAIL  %-44s differs between 1 and %d goroutines",
+		"info.selftest_passed":         "all %d checks passed on %s",
+		"info.tuning":                  "Tuning %s at http://%s/ (press Done in the browser to finish)",
+		"help.usage":                   "Usage:",
+		"help.description":             "Description:",
+		"help.options":                 "The options are:",
+		"help.commands":                "The commands are:",
+		"help.parameters":              "Parameters:",
+		"help.examples":                "Examples:",
+		"help.note":                    "Note:",
+		"help.values":                  "values: %s",
+		"help.default":                 "default: %s",
+		"help.range":                   "%d to %d",
+		"help.range_bound":             "%d to image %s",
+		"help.range_file":              "path to a file",
+		"help.range_text":              "text, as described above",
+		"help.range_number":            "any number",
+		"unit.px":                      "in pixels",
+		"unit.percent":                 "in percent",
+		"unit.degrees":                 "in degrees",
+		"error.file_option":            "option --%s reads files and is not available over HTTP",
+		"error.rpc_file_option":        "option --%s reads files and is not available with --root",
+		"error.root_command":           "--%s runs a command and is not available with --root",
+		"error.remap_line":             "%s:%d: expected oldHex=newHex",
+		"help.flag_help":               "prints program usage information",
+		"help.general_more":            "Use \"bitmap help <command>\" or \"bitmap help <option>\" for more information.",
+		"help.apply_note":              "  Multiple options can be combined and applied sequentially\n  Values may follow an option after a space (--mirror horizontal, -m h)\n  Comma-separated values apply an option once per value (--filter=grayscale,negative)\n  Options may come before or after the file names; arguments after -- are always file names\n  Use \"bitmap help <option>\" for details and examples of a single option\n  A file name of - reads the source from standard input or writes an output to standard output\n  (cat a.bmp | bitmap apply --filter=grayscale - - > b.bmp); pipes and process substitutions work as sources\n  A source given as an http:// or https:// URL is fetched with Range requests in blocks as decoding reaches them\n  The output format follows the output file extension (.png, .jpg, .jpeg, .txt, .npy, .arrow, .feather,\n  otherwise BMP); --format=<bmp|png|jpeg|text|npy|arrow> overrides it. npy writes a NumPy array of bytes\n  shaped (height, width, 3 or 4 with alpha), top row first; arrow writes an Arrow IPC (Feather) file with a\n  uint8 column per channel, one row per pixel, and the width, height and shape in the schema metadata\n  Each --output=<file>[:WxH] writes one more output from the same run, scaled to WxH when given;\n  with only W or H (200x, x150) the aspect ratio is kept\n  --save-stages=<dir> writes the image after every option to dir (stage01_rotate.bmp, ...)\n  --record=<file.gif> writes an animated GIF of the source and the image after every option, each frame\n  labelled with its option, to show how the result comes about; frames are shrunk to 640 pixels at most\n  --stream processes the image one row at a time with bounded memory; it is chosen by itself for images\n  over 64M pixels when only --mirror=horizontal, --crop and per-pixel filters are applied to one BMP output\n  --checkpoint=<file> streams the image and, after every 1024 rows, records in file how far the run got and\n  syncs the output written so far to <output>.partial; run the same command again after an interruption\n  and it resumes from the last checkpoint instead of starting over, as long as the source is unchanged\n  --tile-size=<n> and --max-memory=<size> (256M, 1G) process the image in n by n tiles kept in temporary\n  files of 8 bytes per pixel, holding only as many in memory as the limit allows; they support --mirror,\n  --rotate by multiples of 90 degrees, --crop and per-pixel filters, which --stream cannot all apply\n  --warn-memory=<size> (2G by default) and --warn-time=<duration> (1m by default) warn before the pixels are\n  read when the memory or time the options are estimated to take from the image size exceeds them, as a\n  large --blur radius or --resize does, and name --stream or --max-memory when either can run the options;\n  -v prints the estimates. Set them in the [defaults] section of the config file on shared machines\n  --dpi=<n> sets the resolution stored in BMP outputs to n dots per inch, which print shops go by;\n  it may be given without other options to change only the resolution and keep the pixels as they are\n  --cache-dir=<dir> (such as ~/.cache/bitmap, or $BITMAP_CACHE_DIR) keeps the outputs keyed by the source\n  contents, the options and the settings that change them, and copies them from there when the same run\n  comes again, as repeated CI jobs do; runs writing to standard output, --save-stages or --record are not cached\n  --cache-url=<url> (or $BITMAP_CACHE_URL) shares the cache across machines through an HTTP server that\n  answers GET and PUT of <url>/<key>, as Bazel remote caches do; entries missing from --cache-dir (by default\n  bitmap in the user cache directory) are fetched from it and new ones uploaded, and its failures only warn\n  --provenance=<file.json> writes a manifest of the SHA-256 of the source and of every output file, the\n  options and the build that made them; with --provenance-key=<key> (or $BITMAP_PROVENANCE_KEY) it is signed\n  with HMAC-SHA256, and bitmap provenance verify checks an image against it\n  --precision=16 reads the source, such as a 16-bit PNG, at 16 bits per channel, applies the options in\n  16-bit precision and writes 16-bit PNG outputs, so that bitmap can be a stage of a high-bit-depth pipeline;\n  it supports --mirror, --rotate by multiples of 90 degrees, --crop, --resize, --scale, --filter with red,\n  green, blue, grayscale or negative, --brightness, --contrast, --saturation, --gamma and --colorspace\n  A PDF source is read one page at a time, the first unless --page=<n> picks another, so that scanned\n  documents can be deskewed, thresholded and cropped; a page that is a single scanned image is read at the\n  resolution it was scanned at, and other pages are rendered at --dpi (300 by default) by the command of\n  --rasterizer=<command> (or $BITMAP_RASTERIZER), or by pdftoppm when it is installed. The command gets\n  {file}, {page} and {dpi} replaced and writes a PNG, JPEG or BMP file to standard output\n  (--rasterizer='mutool draw -r {dpi} -F png -o - {file} {page}')",
+		"help.global_options":          "Global options, given before the command:\n  --lang=<code>                    language of messages (en, ru); defaults to $BITMAP_LANG or $LANG\n  --metrics=<json|prometheus>      writes stage timings, bytes and pixel counts after the run\n  --metrics-file=<file>            destination of --metrics, standard error by default\n  --max-width=<n> --max-height=<n>  reject images wider or taller than n pixels\n  --max-pixels=<n>                 reject images with more than n pixels\n  --max-file-size=<bytes>          reject files larger than the given size\n  --strict                         reject files that deviate from the format in any way\n  --permissive                     rescue damaged files, printing a warning for each problem\n  --trust=<headers|data>           when the recorded file or image size disagrees with the file, believe the\n                                   headers (end the file where they say, read rows of the recorded size, e.g.\n                                   unpadded ones) or the data (read all the file holds), and report it\n  --keep-offset                    write the source header size and pixel data offset, keeping the bytes in between\n  --keep-orientation               write rows top-down when the source stores them so, instead of bottom-up\n  --index=<n>                      image to read from an OS/2 bitmap array, 0 by default\n  --embed=<png|jpeg>               store the output pixels as an embedded PNG or JPEG stream\n  --compact                        write output with at most 256 colors, e.g. grayscale, as indexed BMP\n  --true-color                     write 24-bit BMP output, expanding color tables and dropping alpha\n  --jobs=<n>                       goroutines that filters and rotations split rows across, one per CPU by default\n  --nice                           runs at a lower CPU and I/O priority (nice 10 and ionice -c3, or background mode\n                                   on Windows) with half the default --jobs and batch and run workers, so that long\n                                   jobs leave the machine usable\n  --isolate                        decodes every file in a separate process that can open no files or sockets\n                                   (seccomp on Linux, a job object on Windows), so that a decoder bug hit by a\n                                   crafted file cannot reach the rest of the run\n  --straight-alpha                 resize without weighting colors by alpha, as earlier versions did\n  --deterministic                  make outputs byte-identical across runs and machines for reproducible builds:\n                                   --stamp times come from $SOURCE_DATE_EPOCH in UTC, and batch name collisions\n                                   always keep the earlier input\n  --background=<rrggbb>            color of the corners uncovered by rotations that are not multiples of 90 degrees\n  --distance=<name>                how colors are matched when they are reduced to a color table, as for --record:\n                                   rgb (default), weighted (redmean), cie76 or ciede2000, which follow the eye best\n  --progress                       draws a bar of the rows every apply stage has done on standard error\n  -v, --verbose                    also prints the files opened and how long every stage took\n  --quiet                          prints nothing but results and errors, leaving out warnings and notes\n  --errors=<text|json>             prints a failure as a JSON object with its code, exit status, key and message\n  --color=<auto|always|never>      colors the error and warning prefixes; auto does so on a terminal unless\n                                   $NO_COLOR is set, and header aligns its columns on a terminal either way\n  --encrypt=<passphrase>           seals every output in an encrypted container (AES-256-GCM, with a key derived\n                                   by PBKDF2); containers differ on every run and are not cached\n  --decrypt=<passphrase>           opens sources sealed by --encrypt; give both through $BITMAP_ENCRYPT and\n                                   $BITMAP_DECRYPT to keep them out of the process list\n  --backend=<cpu|gpu>              device that per-pixel filters, convolutions and bilinear resizing run on; gpu\n                                   needs a build with -tags gpu and an OpenCL driver, and falls back to the CPU\n                                   with a warning otherwise. Results may differ from the CPU ones by one level\n  --post-hook=<command>            runs a command after every output file is written, e.g. to upload it;\n                                   {output}, {name}, {stem}, {ext}, {dir}, {width} and {height} in it stand for\n                                   the file, and it is split at spaces and run without a shell. A failing\n                                   command fails the output, as a failed write does\n\nDefaults of any flag, global or of a command, are read from BITMAP_<FLAG> variables such as\nBITMAP_MAX_PIXELS or BITMAP_RESULTS, then from the [defaults] section of the config file\n($BITMAP_CONFIG or bitmap/config in the user config directory), one \"flag = value\" per line.\nFlags given on the command line take precedence.",
+		"help.exit_status":             "Exit status, 0 on success, and on failure:",
+		"exit.failure":                 "any failure not listed below",
+		"exit.usage":                   "wrong arguments or option values",
+		"exit.not_found":               "a file to read does not exist",
+		"exit.invalid_bmp":             "an input is not a BMP file or is damaged",
+		"exit.unsupported":             "an input is a valid BMP file using a feature that is not supported",
+		"exit.write":                   "an output could not be written",
+		"error.encode_output":          "error encoding %s output: %v",
+		"error.decode_input":           "error decoding %s: %v",
+		"usage.dump":                   "usage: ./bitmap dump [--pixels] [--format=text] [--region=<offsetX-offsetY[-width-height]>] <source_file>",
+		"error.write_output":           "error writing output: %v",
+		"help.dump_body":               "Usage:\n  bitmap dump [--pixels] [--format=text] [--region=<offsetX-offsetY[-width-height]>] <source_file>\n\nDescription:\n  Prints a \"# bitmap pixels WxH\" line followed by one line per pixel row, top row first,\n  with each pixel written as rrggbb. Small fixture images can then be reviewed\n  and diffed as text.\n\nOptions:\n  --pixels         dumps the pixels (the default and only section)\n  --format=text    output format (only text)\n  --region=<...>   dumps only this area, given as for --crop",
+		"usage.convert":                "usage: ./bitmap convert [--format=<bmp|png|jpeg|text|npy|arrow>] [--page=<n>] [--rasterizer=<command>] <input_file> <output_file>",
+		"error.text_row_width":         "%s:%d: row has %d pixels, expected %d like the first row",
+		"error.text_empty":             "%s has no pixel rows",
+		"help.convert_body":            "Usage:\n  bitmap convert [--format=<bmp|png|jpeg|text|npy|arrow>] [--page=<n>] [--rasterizer=<command>]\n                 <input_file> <output_file>\n\nDescription:\n  Converts between BMP, PNG, JPEG and the text format printed by dump, telling\n  the input format by the first bytes of the file. The text format has one line\n  of rrggbb values per pixel row, top row first. Blank lines and lines starting\n  with # are ignored, so tiny test images can be written and edited by hand.\n\n  The output is a BMP file unless the output name ends in .png, .jpg, .jpeg,\n  .txt, .npy, .arrow or .feather, or --format names another format. npy and arrow\n  export the pixel array for NumPy and pandas, as apply describes; they are not read.\n  PNG and JPEG input gives 24-bit BMP output; transparency is dropped. BMP input\n  keeps its headers, and the global flags such as --max-pixels limit every input\n  format.\n\n  A PDF input gives one page, the first unless --page=<n> picks another, read as\n  apply describes; --rasterizer=<command> renders pages that are not a single\n  scanned image. BMP output keeps the resolution the page was read at.",
+		"usage.explain":                "usage: ./bitmap explain --<option>[=<value>]",
+		"explain.preview":              "Preview of --%s=%s on the built-in sample:",
+		"explain.before":               "before",
+		"explain.after":                "after",
+		"explain.no_preview":           "This option reads a file, so there is no preview on the built-in sample.",
+		"explain.guard":                "This option only decides whether the next one runs, so it has no preview of its own.",
+		"usage.placeholder":            "usage: ./bitmap placeholder [--algo=<blurhash|thumbhash>] [--components=<XxY>] <source_file>\n       ./bitmap placeholder [--algo=<blurhash|thumbhash>] --decode=<hash> [--size=<WxH>] <output_file>",
+		"error.invalid_blurhash":       "invalid BlurHash %q",
+		"error.invalid_thumbhash":      "invalid ThumbHash %q: expected base64 of at least 5 bytes with all its factors",
+		"help.placeholder_body":        "Usage:\n  bitmap placeholder [--algo=<blurhash|thumbhash>] [--components=<XxY>] <source_file>\n  bitmap placeholder [--algo=<blurhash|thumbhash>] --decode=<hash> [--size=<WxH>] <output_file>\n\nDescription:\n  Prints a compact placeholder string for showing a blurred preview while the\n  image loads: a BlurHash (the default) or a base64 ThumbHash. Images larger\n  than 100x100 are scaled down first.\n\n  With --decode the placeholder is rendered to an image file instead, in the\n  format implied by the output name. BlurHashes are rendered at 32x32 and\n  ThumbHashes at up to 32 pixels in their own aspect ratio unless --size is given.\n\nOptions:\n  --algo=<blurhash|thumbhash>  placeholder algorithm, blurhash by default\n  --components=<XxY>           BlurHash components across and down, 1 to 9 each, 4x3 by default\n  --decode=<hash>              render the given placeholder to <output_file>\n  --size=<WxH>                 size of the rendered image\n\nExamples:\n  bitmap placeholder photo.bmp\n  bitmap placeholder --algo=thumbhash photo.bmp\n  bitmap placeholder --decode='LEHV6nWB2yk8pyo0adR*.7kCMdnj' preview.png",
+		"usage.color":                  "usage: ./bitmap color [--mode=<average|vibrant|muted>] <source_file>",
+		"help.color_body":              "Usage:\n  bitmap color [--mode=<average|vibrant|muted>] <source_file>\n\nDescription:\n  Prints one color of the image as #rrggbb for use in UI themes:\n    average  the mean of all pixels, mixed in linear light rather than on sRGB values\n    vibrant  a saturated accent of medium lightness\n    muted    a desaturated accent of medium lightness\n  Accents are chosen among groups of similar colors by their saturation, lightness\n  and share of the image. When no group fits the mode the closest one is printed.\n  For the color table of an indexed image use the palette command.\n\nExamples:\n  bitmap color photo.bmp\n  bitmap color --mode=vibrant photo.bmp",
+		"usage.quality":                "usage: ./bitmap quality [--format=<text|json>] [--min-sharpness=<n>] [--max-clipped=<percent>] [--reject-blank] <source_file>",
+		"usage.pack_atlas":             "usage: ./bitmap pack-atlas [--max=<WxH>] [--padding=<n>] [--trim] [--algo=<maxrects|guillotine>] <sprite_file>... <atlas_file> <json_file>",
+		"help.pack_atlas_body":         "Usage:\n  bitmap pack-atlas [options] <sprite_file>... <atlas_file> <json_file>\n\nThe options are:\n  --max=<WxH>                      largest atlas size, 2048x2048 by default\n  --padding=<n>                    empty pixels between sprites, 0 by default\n  --trim                           crop the fully transparent border of each sprite before packing\n  --algo=<maxrects|guillotine>     packing algorithm, maxrects by default\n\nDescription:\n  Places every sprite in one image, largest first, without rotating them, and crops\n  the atlas to the space used. The atlas has alpha, so BMP output is 32-bit; the format\n  follows the extension of <atlas_file>. maxrects packs tighter, guillotine is simpler\n  and keeps the free space in fewer pieces.\n  The JSON file follows TexturePacker's array format: for each sprite, frame is its\n  place in the atlas and spriteSourceSize the part of the original that was kept,\n  whose x and y are the offsets to restore a trimmed sprite; sourceSize is its original size.\n\nExample:\n  bitmap pack-atlas --max=1024x1024 --padding=2 --trim sprites/*.bmp atlas.png atlas.json",
+		"usage.cycle":                  "usage: ./bitmap cycle [--range=<first-last>] [--fps=<n>] <source_file> <gif_file>",
+		"help.cycle_body":              "Usage:\n  bitmap cycle [options] <source_file> <gif_file>\n\nThe options are:\n  --range=<first-last>             color table entries that rotate, the whole table by default\n  --fps=<n>                        frames per second, 10 by default\n\nDescription:\n  Simulates palette cycling, the animation technique of classic games and demos: every frame,\n  each color in the range moves up one entry of the color table and the last one wraps around\n  to the first, so pixels using those entries appear to flow. The source must be an indexed\n  1, 4 or 8-bit image. The animated GIF holds one full turn of the range and loops.\n\nExample:\n  bitmap cycle --range=16-31 --fps=10 waterfall.bmp waterfall.gif",
+		"usage.match_colors":           "usage: ./bitmap match-colors --reference=<reference_file> [--method=<reinhard|histogram>] <source_file> <output_file>",
+		"help.match_colors_body":       "Usage:\n  bitmap match-colors [options] <source_file> <output_file>\n\nThe options are:\n  --reference=<file>               BMP image whose colors the result takes on (required)\n  --method=<reinhard|histogram>    transfer method, reinhard by default\n\nDescription:\n  Recolors the source so that it matches the look of the reference, e.g. to give a series\n  of shots a consistent look. reinhard shifts the mean and spread of each channel of the\n  lαβ color space to those of the reference, which carries over the overall cast and\n  contrast while keeping the image natural. histogram remaps the red, green and blue\n  levels so that each channel has the distribution of the reference, which matches\n  more closely but can posterize images that differ a lot. Alpha is kept, and the\n  output format follows the extension of <output_file>.\n\nExample:\n  bitmap match-colors --reference=first.bmp shot2.bmp shot2_matched.bmp",
+		"error.atlas_full":             "sprite %s (%dx%d) does not fit in the space left in the %s atlas",
+		"quality.blurry":               "sharpness %.2f is below %d",
+		"quality.clipped":              "%.2f%% of the pixels are clipped, more than %d%%",
+		"quality.blank":                "the image is blank",
+		"error.quality":                "quality check failed: %s",
+		"help.quality_body":            "Usage:\n  bitmap quality [--format=<text|json>] [--min-sharpness=<n>] [--max-clipped=<percent>] [--reject-blank] <source_file>\n\nDescription:\n  Measures the image on its luminance and prints:\n    sharpness       variance of the Laplacian; blurred or out-of-focus images score low\n    clipped_dark    percentage of pixels crushed to black\n    clipped_bright  percentage of pixels blown out to white\n    deviation       standard deviation of the luminance, 0 to 255\n    blank           true when the deviation is below 3, i.e. the image is nearly one color\n    noise           estimated standard deviation of the noise, 0 to 255; guides denoising\n    banding         percentage of small luminance steps that follow flat runs of 8 or more pixels\n    banded          true when banding exceeds 50%, i.e. gradients show steps that dithering would hide\n    grayscale       true when red, green and blue are equal in every pixel\n    constant_channels  channels with the same value in every pixel\n    transparent     percentage of fully transparent pixels, 0 for images without alpha\n    alpha_bounds    box of the pixels that are not fully transparent, as x-y-width-height\n                    for --crop, or none; --trim=alpha crops to it\n  Grayscale images and others with at most 256 colors take a third of the space or less\n  when written with the global --compact flag, which stores them as indexed BMP files.\n  With any of the limits below the command fails after printing the report when the\n  image does not meet them, so ingestion scripts can reject bad captures by exit status.\n\nOptions:\n  --format=<text|json>      report format, text by default\n  --min-sharpness=<n>       reject images with a lower sharpness\n  --max-clipped=<percent>   reject images with more clipped pixels, dark and bright together\n  --reject-blank            reject blank images\n\nExamples:\n  bitmap quality photo.bmp\n  bitmap quality --format=json --min-sharpness=100 --max-clipped=5 --reject-blank photo.bmp",
+		"usage.capabilities":           "usage: ./bitmap capabilities [--json] [--format=<text|json>]",
+		"help.capabilities_body":       "Usage:\n  bitmap capabilities [--json] [--format=<text|json>]\n\nDescription:\n  Lists what this build supports, so that scripts and wrapping tools can check for a\n  feature before using it instead of parsing error messages:\n    go, build_tags      Go version, platform and the build tags the binary was built with\n    commands            commands this binary runs\n    source_formats      formats of the sources every command reads\n    input_formats       formats convert reads\n    output_formats      formats --format and output extensions write\n    header_sizes        DIB header sizes accepted in strict mode\n    read_bit_depths     bits per pixel of the uncompressed files that are read\n    write_bit_depths    bits per pixel of the files that are written; 1, 4 and 8 need --compact\n    compressions        compression values, whether they are read and written, and their bit depths\n    embed_formats       streams --embed stores\n    operations          apply options\n    filters, color_spaces, blend_modes, colormaps  values those options accept\n    features            file_locking, remote_sources, remote_cache, unix_sockets and\n                        gpu_backend, true when this platform and build have them\n  The lists come from the tables the commands check against, so they change with the\n  build rather than with the documentation.\n\nOptions:\n  --json                print the report as JSON, as --format=json does\n  --format=<text|json>  report format, text by default\n\nExamples:\n  bitmap capabilities\n  bitmap capabilities --json | jq '.compressions[] | select(.write) | .name'",
+		"usage.provenance":             "usage: ./bitmap provenance verify [--provenance-key=<key>] [--source=<file>] <image_file> <manifest_file>",
+		"help.provenance_body":         "Usage:\n  bitmap provenance verify [--provenance-key=<key>] [--source=<file>] <image_file> <manifest_file>\n\nDescription:\n  Checks an image against the manifest that apply --provenance wrote along with it. The image\n  must have the SHA-256 of one of the outputs the manifest lists, under any name. The command\n  then prints the output, the source, the options, the build and when it ran, and fails when:\n    - the image is none of the outputs, having been edited since or made otherwise\n    - --source is given and is not the recorded source\n    - a key is given and the signature does not match, as when the manifest was altered\n    - a key is given and the manifest is not signed\n  A signed manifest checked without a key is only compared by hashes, with a warning.\n\nOptions:\n  --provenance-key=<key>  key the manifest was signed with, or $BITMAP_PROVENANCE_KEY\n  --source=<file>         also check that the source is the one recorded\n\nExamples:\n  bitmap apply --provenance=out.json --provenance-key=secret --filter=grayscale in.bmp out.bmp\n  bitmap provenance verify --provenance-key=secret --source=in.bmp out.bmp out.json",
+		"error.provenance_manifest":    "invalid manifest %s: %v",
+		"error.provenance_version":     "manifest %s has version %d, this build reads version %d",
+		"error.provenance_output":      "%s is none of the outputs recorded in %s",
+		"error.provenance_source":      "%s is not the source recorded in %s",
+		"error.provenance_signature":   "the signature of %s does not match: the manifest was altered or signed with another key",
+		"error.provenance_unsigned":    "%s is not signed",
+		"warning.provenance_unchecked": "the signature of %s was not checked: no --provenance-key given",
+		"info.provenance_written":      "provenance manifest written to %s",
+		"usage.compare":                "usage: ./bitmap compare [--format=<text|json>] [--diff=<file>] [--min-psnr=<dB>] [--metric=<name>[:<score>]] <first_file> <second_file>",
+		"usage.histogram":              "usage: ./bitmap histogram [--format=<text|json>] [--bins=<n>] [--output=<file>] <source_file>",
+		"help.compare_body":            "Usage:\n  bitmap compare [options] <first_file> <second_file>\n\nThe options are:\n  --format=<text|json>    output format, text by default\n  --diff=<file>           writes an image of the differences: changed pixels in red, brighter\n                          the larger the change, over a faint gray copy of the first image\n  --min-psnr=<dB>         accepts images that differ when their PSNR is at least this high\n  --metric=<name>[:<n>]   also measures a perceptual metric, and with a score, accepts images\n                          that differ when they reach it; may be given more than once:\n                            ssim              structural similarity of the luma, 1 for images\n                                              that look the same, lower the more they differ\n                            butteraugli-lite  distance in steps that can just be seen, 0 for\n                                              images that look the same, about 1 for a difference\n                                              that can just be made out; a much simpler take on\n                                              Butteraugli that also sees shifts of color\n\nDescription:\n  Compares two images of the same size pixel by pixel for regression tests. Prints whether\n  they are identical, how many pixels differ, the mean absolute error of each channel\n  out of 255 and the PSNR, which is inf for identical images. Images without alpha count\n  as opaque; perceptual metrics leave alpha out. When limits are given, differing images\n  match only if they meet all of them. Exits with status 1 when the images do not match, so scripts can check the\n  result. The inputs may be BMP, PNG, JPEG or the text printed by dump.\n\nExamples:\n  bitmap compare expected.bmp actual.bmp\n  bitmap compare --diff=diff.png --min-psnr=40 expected.bmp actual.bmp\n  bitmap compare --metric=ssim --metric=butteraugli-lite:1.5 original.bmp encoded.png",
+		"usage.fit":                    "usage: ./bitmap fit --target=<reference_file> --op=<option>[,<option>...] [--metric=<psnr|butteraugli-lite|ssim>] [--format=<text|json>] [--output=<file>] <source_file>",
+		"help.fit_body":                "Usage:\n  bitmap fit --target=<reference_file> --op=<option>[,<option>...] [options] <source_file>\n\nThe options are:\n  --target=<file>         reference image the source should look like\n  --op=<options>          options to search, applied in the given order: brightness,\n                          contrast and saturation from -100 to 100, gamma from 0.2 to 5\n  --metric=<name>         what \"alike\" means: psnr, the default, ssim or butteraugli-lite,\n                          as compare measures them\n  --format=<text|json>    output format, text by default\n  --output=<file>         also writes the source with the values found applied\n\nDescription:\n  Searches the values of the options that make the source look most like the target,\n  such as a capture of a test chart by a camera or scanner and the chart itself, and\n  prints them as apply options, with the score before and after. Each option is searched\n  across its range and then narrowed down, in turn, for a few rounds. The search runs on\n  copies of at most 384 pixels a side; the target is scaled to the size of the source\n  and has to have the same aspect ratio.\n\nExamples:\n  bitmap fit --target=chart.bmp --op=brightness,contrast,gamma capture.bmp\n  bitmap fit --target=chart.png --op=gamma,saturation --metric=butteraugli-lite --output=fixed.bmp capture.bmp\n  bitmap apply --brightness=6 --contrast=-12 --gamma=1.18 capture2.bmp fixed2.bmp",
+		"help.histogram_body":          "Usage:\n  bitmap histogram [options] <source_file>\n\nThe options are:\n  --format=<text|json>    output format, text by default\n  --bins=<n>              bars per channel in the text chart: 1, 2, 4 and so on up to 256,\n                          16 by default\n  --output=<file>         also draws the histograms to an image, one 256x64 chart per channel\n\nDescription:\n  Counts the levels of the red, green and blue channels and of the luminance and prints\n  each as a bar chart with its mean and median, followed by the percentages of pixels\n  clipped to black and to white. JSON output holds the count of every level from 0 to 255,\n  so scripts can look for over- or underexposed images, e.g. in a loop over a folder of scans.\n\nExamples:\n  bitmap histogram scan.bmp\n  bitmap histogram --format=json scan.bmp\n  bitmap histogram --bins=64 --output=histogram.png scan.bmp",
+		"usage.detect_lines":           "usage: ./bitmap detect-lines [--format=<text|json>] [--json] [--lines=<n>] [--min-length=<n>] <source_file>",
+		"help.detect_lines_body":       "Usage:\n  bitmap detect-lines [options] <source_file>\n\nThe options are:\n  --format=<text|json>    output format, text by default\n  --json                  same as --format=json\n  --lines=<n>             most lines reported, 10 by default\n  --min-length=<n>        shortest line reported in pixels, an eighth of the shorter side of\n                          the image by default\n\nDescription:\n  Finds the dominant straight lines of the image, such as the edges of a page, a screen or\n  a whiteboard photographed on a desk, by a Hough transform of its edges, and reports each\n  as a segment with its angle and length, longest first. Of the roughly horizontal and\n  roughly vertical lines, the four that make the largest quadrilateral they run along the\n  most are reported as the page rectangle: its corners, top left first, its skew, the\n  --rotate value that levels it and the --crop value of its bounding box. Coordinates are\n  in pixels from the top left corner of the image and angles in degrees clockwise from the\n  horizontal; JSON output has null for the rectangle when no lines make one.\n\nExamples:\n  bitmap detect-lines photo.bmp\n  bitmap detect-lines --json photo.bmp\n  bitmap apply --rotate=$(bitmap detect-lines --json photo.bmp | jq -r .rectangle.rotate) photo.bmp level.bmp",
+		"usage.testcard":               "usage: ./bitmap testcard [--type=<gray-steps|gamma|convergence>] [--size=<WxH>] [--steps=<n>] <output_file> | --analyze [--steps=<n>] [--format=<text|json>] <photo_file>",
+		"help.testcard_body":           "Usage:\n  bitmap testcard [options] <output_file>\n  bitmap testcard --analyze [options] <photo_file>\n\nThe options are:\n  --type=<gray-steps|gamma|convergence>\n                          card drawn, gray-steps by default:\n                            gray-steps   bars from black on the left to white on the right\n                            gamma        gray patches on black and white lines, labeled with the\n                                         gammas 1.8 to 2.6\n                            convergence  a white crosshatch on black with dots and a circle\n  --size=<WxH>            size of the card, 1920x1080 by default\n  --steps=<n>             bars of the gray-steps card, from 2 to 256, 11 by default\n  --analyze               measures a photograph of a gray-steps card instead of drawing one\n  --format=<text|json>    output format of --analyze, text by default\n\nDescription:\n  Draws test cards for calibrating displays, projectors and printers. On the gamma card,\n  the lines blur into a gray of half the light of white from a distance; the patch that\n  matches it carries the gamma of the display. On the convergence card, misconverged\n  displays show colored fringes along the lines, and geometry errors bend them.\n\n  --analyze reads a photograph or scan of a displayed or printed gray-steps card, in any\n  format convert reads, cropped to the card, for example with the crop value of\n  detect-lines; --steps must match the card. It prints the mean luminance and noise of\n  the middle of each step, which steps can be told from the one before, how many dark\n  steps are crushed to black and light ones clipped to white, and the gamma of the power\n  curve that fits the response: 1 when the mid-tones come out as on the card, above 1\n  when they come out darker.\n\nExamples:\n  bitmap testcard --type=gamma gamma.bmp\n  bitmap testcard --steps=21 --size=3840x2160 steps.bmp\n  bitmap testcard --analyze --steps=21 --format=json photo.jpg",
+		"usage.frames":                 "usage: ./bitmap frames [--every=<n>] [--start=<n>] [--max=<n>] [--prune-similar=<distance>] <video_file> <output_dir>",
+		"help.frames_body":             "Usage:\n  bitmap frames [options] <video_file> <output_dir>\n\nThe options are:\n  --every=<n>             writes every n-th frame, 1 by default\n  --start=<n>             number of the first frame written, counted from 1, 1 by default\n  --max=<n>               stops after writing n frames; 0, the default, writes all\n  --prune-similar=<d>     leaves out frames whose color histograms are less than d, from 0\n                          to 1, away from those of the last frame written, such as the still\n                          shots of a screen recording; 0.05 drops little more than noise\n\nDescription:\n  Writes frames of an uncompressed video as BMP files named frame_000001.bmp and so on by\n  their numbers in the video, creating the directory if needed, so that batch and the\n  other commands can process them without ffmpeg. YUV4MPEG2 (.y4m) streams with 4:2:0,\n  4:2:2, 4:1:1 or 4:4:4 chroma, or luma alone, of 8 to 16 bits, are read, and AVI files\n  whose video is stored as uncompressed DIBs or as YUY2, UYVY, I420, YV12, NV12 or Y800;\n  compressed video needs ffmpeg. YUV is converted by the BT.601 matrix, as studio video\n  unless a Y4M stream says it is full range. The video is read from start to end, so\n  it can come from standard input as -.\n\nExamples:\n  bitmap frames video.y4m frames/\n  bitmap frames --every=30 --max=100 capture.avi frames/\n  bitmap frames --prune-similar=0.1 screencast.avi frames/\n  bitmap batch --filter=grayscale frames/ gray/",
+		"usage.caption":                "usage: ./bitmap caption [--top=<text>] [--bottom=<text>] [--bar] [--scale=<n>] [--color=<#rrggbb>] [--bar-color=<#rrggbb>] <source_file> <output_file>",
+		"help.caption_body":            "Usage:\n  bitmap caption [options] <source_file> <output_file>\n\nThe options are:\n  --top=<text>              text along the top of the image\n  --bottom=<text>           text along the bottom of the image; at least one of the two is required\n  --bar                     sets the text on bars added above and below the image instead of\n                            drawing it over the image\n  --scale=<n>               size of the letters, n pixels per pixel of the 5x7 font; 0, the default,\n                            makes them about a tenth of the image height\n  --color=<#rrggbb>         text color, white over the image and black on bars by default\n  --bar-color=<#rrggbb>     color of the bars, white by default\n\nDescription:\n  Captions an image the way memes are: centered lines of text, wrapped between words to\n  fit the width. Over the image the letters get a black outline, or a white one for dark\n  text, so they stay legible on any background. With --bar the canvas grows by a bar for\n  each caption given and the image itself stays uncovered. The built-in font covers\n  printable ASCII; other characters are drawn as question marks. The output format\n  follows the extension of <output_file>.\n\nExamples:\n  bitmap caption --top=\"ONE DOES NOT SIMPLY\" --bottom=\"DECODE A BMP\" cat.bmp meme.bmp\n  bitmap caption --bottom=\"Figure 1: sample\" --bar --scale=2 chart.bmp figure.png",
+		"usage.thumbs":                 "usage: ./bitmap thumbs [--cols=<n>] [--cell=<WxH>] [--padding=<n>] [--labels] [--sheet-color=<#rrggbb>] <dir> <output_file>",
+		"help.thumbs_body":             "Usage:\n  bitmap thumbs [options] <dir> <output_file>\n\nThe options are:\n  --cols=<n>                 thumbnails per row, 6 by default\n  --cell=<WxH>               box every thumbnail is scaled down to fit, 160x120 by default\n  --padding=<n>              pixels between the cells and around the sheet, 8 by default\n  --labels                   writes the file name under every thumbnail\n  --sheet-color=<#rrggbb>    color of the sheet, white by default\n\nDescription:\n  Makes a contact sheet of the .bmp files in <dir>, in name order, for reviewing a batch\n  of scans at a glance. Every image is scaled down with its aspect ratio kept and centered\n  in its cell; images smaller than the cell keep their size. Transparent pixels show the\n  background. Labels use the built-in 5x7 font and are shortened with dots when the name\n  is wider than the cell. Files that cannot be read are skipped with a warning. The output\n  format follows the extension of <output_file>.\n\nExamples:\n  bitmap thumbs scans sheet.bmp\n  bitmap thumbs --cols=4 --cell=240x180 --labels scans/batch7 batch7.png",
+		"usage.extract_thumb":          "usage: ./bitmap extract-thumb <raw_file> <output_file>",
+		"help.extract_thumb_body":      "Usage:\n  bitmap extract-thumb <raw_file> <output_file>\n\nDescription:\n  Writes the largest JPEG preview a camera embeds in its RAW files, turned upright\n  by the EXIF orientation, without developing the sensor data, which is a quick way\n  to browse a directory of RAW photos. TIFF-based files (CR2, NEF, ARW, DNG, PEF,\n  ORF, RW2 and most others) list their previews; other containers, such as CR3 and\n  RAF, are searched for JPEG streams. The output format follows the extension of\n  <output_file>.\n\nExamples:\n  bitmap extract-thumb IMG_0042.CR2 IMG_0042.bmp\n  for f in *.NEF; do bitmap extract-thumb \"$f\" \"${f%.NEF}.bmp\"; done && bitmap thumbs . sheet.bmp",
+		"usage.beforeafter":            "usage: ./bitmap beforeafter [--layout=<side|split>] [--position=<percent>] [--gap=<n>] [--labels] <before_file> <after_file> <output_file>",
+		"help.beforeafter_body":        "Usage:\n  bitmap beforeafter [options] <before_file> <after_file> <output_file>\n\nThe options are:\n  --layout=<side|split>     side puts the images next to each other, split shows the left part of\n                            the first and the rest of the second; side by default\n  --position=<percent>      where split switches images, as a percentage of the width, 50 by default\n  --gap=<n>                 pixels of white between the images side by side, 8 by default\n  --labels                  marks the images BEFORE and AFTER in their top corners\n\nDescription:\n  Makes one image that documents what processing does. Side by side, images of any\n  size are aligned at the top on white. split needs images of the same size and draws a\n  white line where they meet, like the handle of a comparison slider. The output format\n  follows the extension of <output_file>.\n\nExamples:\n  bitmap apply --filter=sharpen photo.bmp sharp.bmp\n  bitmap beforeafter --labels photo.bmp sharp.bmp compare.png\n  bitmap beforeafter --layout=split --position=40 photo.bmp sharp.bmp slider.bmp",
+		"usage.stack":                  "usage: ./bitmap stack [--method=<mean|weighted|max|min>] [--weights=<flat|gauss[,width]|ramp|w1,w2,...>] <frame_file>... <output_file>",
+		"help.stack_body":              "Usage:\n  bitmap stack [options] <frame_file>... <output_file>\n\nThe options are:\n  --method=<name>               how the frames are combined, mean by default:\n                                mean      the mean of all the frames\n                                weighted  the mean of the frames by --weights\n                                max       the lightest level of every channel, as for star trails\n                                min       the darkest level of every channel\n  --weights=<shape>             weight of each frame for weighted, gauss by default:\n                                flat      the same for every frame, as mean\n                                gauss     a bell curve on the middle frame, a quarter of the frames\n                                          wide, or as many frames as given after a comma\n                                ramp      rising evenly to the last frame, so that moving things\n                                          leave trails fading toward where they started\n                                w1,w2,... one weight per frame, in the order given\n\nDescription:\n  Emulates a long exposure from a sequence of frames of the same size, such as those\n  frames writes from a video: means are taken in linear light, as a sensor gathers it,\n  so still parts stay sharp and moving ones blur as behind a slow shutter. The weights\n  shape the exposure in time, as a shutter that opens and closes gradually does for\n  gauss. Frames with alpha count where they are opaque. Frames are read one at a time,\n  so sequences of any length fit in memory, and the output format follows the\n  extension of <output_file>.\n\nExamples:\n  bitmap frames clip.y4m frames\n  bitmap stack --method=weighted --weights=gauss frames/*.bmp exposure.bmp\n  bitmap stack --method=weighted --weights=1,2,4,8 f1.bmp f2.bmp f3.bmp f4.bmp trail.bmp\n  bitmap stack --method=max sky_*.bmp trails.bmp",
+		"usage.shell":                  "usage: ./bitmap shell <source_file>",
+		"help.shell_body":              "Usage:\n  bitmap shell <source_file>\n\nDescription:\n  Loads the image once and reads commands from standard input, one per line, applying\n  each option to the image in memory. Experimenting with option chains on large files\n  this way skips decoding and encoding the file at every step. Up to 31 steps can be\n  undone; older ones stay in the history. Commands can also be piped in from a file;\n  the prompt is only shown when typing, and lines starting with # are skipped.\n\nCommands:\n  <option> <value>     applies an apply option, e.g. filter grayscale or rotate 90; the forms\n                       --filter=grayscale and -m h of the apply command work too\n  undo, redo           steps back and forward through the results\n  history              lists the steps and prints the apply command that repeats them\n  preview [<file>]     writes the current image, to bitmap-preview.png in the temporary\n                       directory by default, for viewing\n  save <file>          writes the current image; the format follows the extension\n  help                 shows this list\n  quit, exit           ends the session, as does the end of input\n\nExample:\n  bitmap shell scan.bmp\n  bitmap> filter grayscale\n  bitmap> rotate 90\n  bitmap> undo\n  bitmap> save scan_gray.bmp",
+		"usage.pick":                   "usage: ./bitmap pick [--option=<crop|pixelate>] <source_file>",
+		"help.pick_body":               "Usage:\n  bitmap pick [--option=<crop|pixelate>] <source_file>\n\nThe options are:\n  --option=<crop|pixelate>      apply option the selection is printed as, crop by default\n\nKeys:\n  arrows, h j k l               move the selection\n  Shift+arrows, H J K L         resize it from the bottom-right corner: right and down\n                                widen and heighten it, left and up narrow and shorten it\n  Enter                         prints the selection and ends\n  q, Esc, Ctrl-C                end without printing\n\nDescription:\n  Shows the image in the terminal, two pixels to a character cell in true color, with\n  the area outside the selection dimmed, and prints the selection as an apply option\n  such as --crop=120-80-640-480, in pixels of the image from its top-left corner, to\n  paste into a pipeline. Keys move and resize it by a pixel of the preview, which is\n  several pixels of large images. The preview is drawn on standard error, so\n  $(bitmap pick photo.bmp) takes only the option. Needs a terminal on standard input\n  and standard error.\n\nExample:\n  bitmap apply $(bitmap pick photo.bmp) photo.bmp cropped.bmp",
+		"help.shell_commands":          "Commands:\n  <option> <value>     applies an apply option, e.g. filter grayscale or rotate 90; the forms\n                       --filter=grayscale and -m h of the apply command work too\n  undo, redo           steps back and forward through the results\n  history              lists the steps and prints the apply command that repeats them\n  preview [<file>]     writes the current image, to bitmap-preview.png in the temporary\n                       directory by default, for viewing\n  save <file>          writes the current image; the format follows the extension\n  help                 shows this list\n  quit, exit           ends the session, as does the end of input",
+		"usage.selftest":               "usage: ./bitmap selftest",
+		"help.selftest_body":           "Usage:\n  bitmap selftest\n\nDescription:\n  Checks that this build reads, writes and transforms images exactly as the reference build does,\n  before it is trusted with batch runs on a new platform, compiler or processor. Small fixtures\n  generated in memory are encoded as 1, 4, 24 and 32-bit files and decoded back, an embedded\n  run-length encoded file is decoded, and every apply option runs on the fixtures. Each result is\n  compared with the CRC-32 checksum of the reference result, and every option also runs on a single\n  goroutine, which must agree with the rows split across --jobs. Each check prints one line; the\n  command fails with the number of failed checks when any differ.\n\nExample:\n  bitmap selftest",
+		"usage.triage":                 "usage: ./bitmap triage [--output=<file>] [--format=<text|json>] <input_file>",
+		"help.triage_body":             "Usage:\n  bitmap triage [options] <input_file>\n\nThe options are:\n  --output=<file>         reproducer file, <name>.min.bmp next to the input by default;\n                          needed when the input is standard input\n  --format=<text|json>    report format, text by default\n\nDescription:\n  Decodes a file that fuzzing or a user turned up, in the mode --strict or --permissive\n  selects, and names the rule of the format it breaks: the key of the decoder message,\n  its kind (not_bmp, invalid, unsupported, limit) and whether reading the headers or\n  the pixels failed. A panic of the decoder is reported with the function it came from.\n  The file is then cut down while it keeps failing the same way, first to the shortest\n  prefix that does, found by bisection, then by removing ranges of halving length, and\n  the result is written as the reproducer. The report shows the pixel format the headers\n  declare and how many bytes of every part of the file, from the headers and color table\n  to the pixel rows, the reproducer keeps. A file that decodes is reported as such and\n  no reproducer is written.\n\nExamples:\n  bitmap triage crash-input.bmp\n  bitmap --strict triage --format=json --output=repro.bmp crash-input.bmp",
+		"help.explain_body":            "Usage:\n  bitmap explain --<option>[=<value>]\n\nDescription:\n  Prints the parameters, ranges, defaults and notes of an apply option, followed by\n  ASCII drawings of a built-in sample image before and after applying it.\n  Without a value the first example of the option is previewed.\n\nExamples:\n  bitmap explain --filter=blur\n  bitmap explain --rotate",
+		"usage.palette":                "usage: ./bitmap palette show <source_file>\n       ./bitmap palette replace <source_file> <colors_file> <output_file>\n       ./bitmap palette sort <source_file> <output_file>",
+		"error.not_indexed":            "%s has no color table (only 1, 4 and 8-bit images do)",
+		"error.cycle_range":            "color range %d-%d does not fit the color table of %d entries",
+		"error.palette_line":           "%s:%d: expected \"<index> #rrggbb\"",
+		"error.palette_index":          "color table index %s is out of range, the table has %d entries",
+		"error.invalid_color":          "invalid color: %s (expected rrggbb or #rrggbb)",
+		"error.read_file":              "error reading file: %v",
+		"help.palette_body":            "Usage:\n  bitmap palette show <source_file>\n  bitmap palette replace <source_file> <colors_file> <output_file>\n  bitmap palette sort <source_file> <output_file>\n\nDescription:\n  Works on the color table of 1, 4 and 8-bit images.\n  show     prints one \"<index> #rrggbb\" line per entry\n  replace  sets the entries listed in colors_file, in the format printed by show\n  sort     orders the entries from dark to light and renumbers the pixels to match\n\n  apply keeps the color table as long as every resulting color is in it.",
+		"usage.channels":               "usage: ./bitmap channels split <source_file> <red_file> <green_file> <blue_file> [<alpha_file>]\n       ./bitmap channels merge <red_file> <green_file> <blue_file> [<alpha_file>] <output_file>",
+		"help.channels_body":           "Usage:\n  bitmap channels split <source_file> <red_file> <green_file> <blue_file> [<alpha_file>]\n  bitmap channels merge <red_file> <green_file> <blue_file> [<alpha_file>] <output_file>\n\nDescription:\n  Keeps channels that carry independent data, such as masks or heightmaps, in\n  files of their own.\n  split  writes every channel as a grayscale image; images without alpha give a\n         white alpha file, as they are opaque\n  merge  builds an image from grayscale channel files of the same size, with\n         alpha when an alpha file is given; other images contribute their luminance\n  The output formats follow the file extensions.\n\nExamples:\n  bitmap channels split sprite.bmp r.bmp g.bmp b.bmp a.bmp\n  bitmap channels merge r.bmp g.bmp b.bmp mask.bmp sprite.bmp",
+		"usage.split":                  "usage: ./bitmap split [--rows=<n>] [--split-pages] <source_file> <pattern>",
+		"help.split_body":              "Usage:\n  bitmap split [--rows=<n>] [--split-pages] <source_file> <pattern>\n\nThe options are:\n  --rows=<n>                       rows of every strip, 1024 by default; the last strip holds the rest\n  --split-pages                    divides a two-page book scan into its left and right page instead,\n                                   numbered 1 and 2\n\nDescription:\n  Divides an image into horizontal strips, e.g. to send it past a limit on file\n  sizes, and writes each to a file named by the pattern, a file name with one integer\n  verb that takes the strip number: part_%02d.bmp writes part_01.bmp, part_02.bmp and\n  so on from the top down. Pad the number to as many digits as there are strips, so\n  that a shell pattern lists the files in order. Strips of an indexed image keep its\n  color table, and the output formats follow the file extensions.\n\n  --split-pages finds the gutter of a book scan, the widest band without text,\n  blank or in the shadow of the spine, in the middle third of its width, and splits\n  the pages in its middle. The dark border a scanner lid leaves around the book and\n  the shadow of the spine, rows and columns at least half covered in ink, are cut\n  away from the edges of each page.\n\nExamples:\n  bitmap split --rows=1024 huge.bmp part_%02d.bmp\n  bitmap split --split-pages spread_012.bmp page_012_%d.bmp",
+		"usage.join":                   "usage: ./bitmap join <strip_file>... <output_file>",
+		"help.join_body":               "Usage:\n  bitmap join <strip_file>... <output_file>\n\nDescription:\n  Stacks strips of the same width, given from the top down, into one image, undoing\n  split without losing anything: compare reports the result pixel-identical to the\n  image that was split. Strips that share a color table are joined as an indexed\n  image with it, alpha is kept when any strip has it, and the output format follows\n  the extension of <output_file>.\n\nExample:\n  bitmap join part_*.bmp huge.bmp",
+		"warning.prefix":               "Warning:",
+		"warning.thumb_skipped":        "skipping %s: %v",
+		"warning.strip_transparent":    "%s is fully transparent and will read back as opaque, as BMP readers take all-zero alpha for unused; choose --rows so that every strip has a visible pixel",
+		"warning.estimate_memory":      "the options are estimated to need %s of memory on the %dx%d image, over --warn-memory=%s",
+		"warning.estimate_time":        "the options are estimated to take %v on the %dx%d image, over --warn-time=%v",
+		"warning.estimate_stream":      "--stream runs these options a row at a time in memory that does not grow with the image",
+		"warning.estimate_tiles":       "--max-memory=%s runs these options on tiles in no more memory than that",
+		"warning.unreadable_name":      "skipping %s: the name holds characters Windows cannot pass on, rename the file to process it",
+		"warning.cache_store":          "could not store %s in the cache: %v",
+		"warning.gpu_fallback":         "--backend=gpu: %v; running on the CPU",
+		"warning.nice":                 "--nice: could not lower the priority: %v",
+		"error.isolate_start":          "--isolate: could not start the decoder process: %v",
+		"error.isolate_crash":          "--isolate: the decoder process failed: %s",
+		"error.isolate_request":        "the decoder process got no request; it is started by --isolate",
+		"error.isolate_confine":        "the decoder process could not give up its privileges: %v",
+		"warning.gpu_failed":           "the GPU %s kernel failed with OpenCL error %d; running on the CPU",
+		"warning.checkpoint_partial":   "%s is missing or shorter than %s records, starting over",
+		"warning.checkpoint_stale":     "%s belongs to another source, options or output, starting over",
+		"warning.cache_download":       "could not fetch %s from the remote cache: %v",
+		"warning.cache_upload":         "could not upload %s to the remote cache: %v",
+		"error.selftest_failed":        "%d of %d self-test checks failed on %s: this build does not produce the reference results",
+		"error.selftest_roundtrip":     "decoding the encoded file does not give the original pixels back",
+		"help.header_body":             "Usage:\n  bitmap header [--format=<text|json|yaml>] <source_file>\n\nThe options are:\n  --format=<text|json|yaml>    output format (default text); json and yaml list every\n                               header field along with the row stride, row padding,\n                               pixel data size and palette size\n\nDescription:\n  Prints bitmap file header information. For V5 files that embed an ICC color profile,\n  also prints its version, device class, color space and description; apply keeps the\n  profile in its BMP outputs. A <source_file> of - reads the file from standard input.\n  Only the headers, the entries of a bitmap array and the color profile are read, a few\n  kilobytes however large the image is. A <source_file> given as an http:// or https://\n  URL is read with Range requests, so inspecting a remote image takes a single request\n  of 64 KiB, plus one for a profile stored after the pixels.",
+		"help.help_body":               "Usage:\n  bitmap help [command|option]\n\nDescription:\n  Prints usage of a command (e.g. apply) or parameters, ranges and examples\n  of an apply option (e.g. crop or --crop)",
+		"help.man_body":                "Usage:\n  bitmap man > bitmap.1\n\nDescription:\n  Prints a manual page generated from the command and operation registries",
+		"help.tune_body":               "Usage:\n  bitmap tune [options] <source_file>\n\nThe options are:\n  --addr=<host:port>        address to listen on (default 127.0.0.1:8080)\n  --output=<output_file>    output file name used in the generated command\n  --script=<file>           also writes the final command to a shell script\n\nDescription:\n  Opens a web UI with controls for every operation and a live preview.\n  Pressing Done prints the equivalent apply command and exits.",
+		"man.name":                     "inspect and transform BMP images",
+		"man.options_intro":            "Options of the apply command are applied in the order they are given.",
+		"usage.batch":                  "usage: ./bitmap batch [options] <input_dir> <output_dir>",
+		"error.create_dir":             "error creating directory: %v",
+		"error.read_dir":               "error reading directory: %v",
+		"error.read_input":             "error reading commands: %v",
+		"error.pick_terminal":          "pick needs a terminal on standard input and standard error",
+		"error.pick_raw":               "could not switch the terminal to raw mode: %v",
+		"error.pick_cancelled":         "selection cancelled",
+		"error.shell_command":          "unknown command %q: type help for the list",
+		"error.shell_usage":            "usage: %s",
+		"error.shell_undo":             "nothing to undo",
+		"error.shell_redo":             "nothing to redo",
+		"error.batch_failed":           "%d of %d files failed",
+		"error.name_collision":         "output %s was already written for %s",
+		"error.path_root":              "cannot resolve %s: %v",
+		"error.path_escape":            "%s is outside %s",
+		"error.symlink":                "%s is or goes through a symbolic link; --follow-symlinks follows them",
+		"warning.symlink_skipped":      "%s skipped: symbolic link; --follow-symlinks follows them",
+		"error.template_field":         "unknown naming template field: %s",
+		"error.template_name":          "naming template %q produces an invalid file name",
+		"info.batch_done":              "%s -> %s",
+		"info.batch_skipped":           "%s -> %s (up to date)",
+		"info.batch_pruned":            "%s left out as similar to the last file kept",
+		"info.batch_pruned_total":      "%d files left out as similar to the last one kept",
+		"info.file_pruned":             "%s left out: %.3f from the last file kept",
+		"info.batch_summary":           "%d files: %d written, %d up to date, %d failed in %v",
+		"info.run_summary":             "%d jobs: %d done, %d failed, %d retried in %v",
+		"info.job_retry":               "%s:%d: %v, retrying in %v",
+		"error.run_failed":             "%d of %d jobs failed",
+		"error.open_jobs":              "error reading jobs: %v",
+		"error.invalid_job":            "invalid job: %v",
+		"error.job_fields":             "input and output are both required",
+		"error.job_format":             "format %q is not one of %s",
+		"error.read_state":             "error reading state file: %v",
+		"error.write_state":            "error writing state file: %v",
+		"error.write_results":          "error writing results: %v",
+		"info.serving":                 "Serving on http://%s/ (POST images to /apply)",
+		"error.too_many_requests":      "too many concurrent requests, try again later",
+		"error.body_too_large":         "request body exceeds the limit of %d bytes",
+		"error.request_timeout":        "request timed out",
+		"error.read_body":              "error reading request body: %v",
+		"error.invalid_signature":      "missing or invalid request signature",
+		"info.draining":                "Shutting down, waiting for in-flight requests",
+		"error.draining":               "shutting down",
+		"error.shutdown":               "error shutting down server: %v",
+		"usage.daemon":                 "usage: ./bitmap daemon [--socket=<path>] [--root=<dir>] [--follow-symlinks]",
+		"error.invalid_handle":         "invalid image handle",
+		"error.invalid_ops_json":       "invalid operations JSON: %v",
+		"usage.rpc":                    "usage: ./bitmap rpc [--root=<dir>] [--follow-symlinks]",
+		"error.rpc_request":            "invalid request: %v",
+		"error.rpc_method":             "unknown method: %s",
+		"error.unknown_image":          "unknown image: %d",
+		"help.rpc_body":                "Usage:\n  bitmap rpc [--root=<dir>] [--follow-symlinks]\n\nThe options are:\n  --root=<dir>         directory the paths of requests may not leave, for requests that are\n                       not trusted; relative paths are taken from it, paths through symbolic\n                       links are refused and options that read files are not available\n  --follow-symlinks    with --root, allows paths through symbolic links in it\n\nDescription:\n  Reads one JSON request per line from standard input and writes one JSON\n  response per line to standard output, so a script can drive a long-lived process.\n  Responses echo the request id and hold either result or error.\n\nMethods:\n  {\"method\": \"load\", \"path\": \"in.bmp\"}                          loads an image, returns its id and size\n  {\"method\": \"apply\", \"image\": 1, \"ops\": [{\"name\": \"rotate\", \"value\": \"right\"}]}\n                                                                 applies options, returns a new image\n  {\"method\": \"save\", \"image\": 2, \"path\": \"out.bmp\"}              writes an image to a file\n  {\"method\": \"stats\", \"image\": 2}                                size and per-channel min, max and mean\n  {\"method\": \"release\", \"image\": 1}                              frees an image",
+		"info.daemon_listening":        "Listening on %s",
+		"error.daemon_running":         "a daemon is already listening on %s",
+		"error.connect_daemon":         "error connecting to daemon at %s: %v",
+		"error.daemon_stage_flags":     "the request was made with the global flags %q, but the daemon runs with %q; start the daemon with the same ones",
+		"error.frame":                  "protocol error: %v",
+		"error.frame_size":             "frame of %d bytes exceeds the limit of %d",
+		"help.daemon_body":             "Usage:\n  bitmap daemon [--socket=<path>] [--root=<dir>] [--follow-symlinks]\n\nThe options are:\n  --socket=<path>      Unix socket to listen on (default $XDG_RUNTIME_DIR/bitmap-<uid>.sock)\n  --root=<dir>         directory the files of requests may not leave, for clients that are\n                       not trusted; relative paths are taken from it, paths through symbolic\n                       links are refused, and options that read files, --rasterizer and\n                       --post-hook are not available\n  --follow-symlinks    with --root, allows paths through symbolic links in it\n\nDescription:\n  Keeps one process running to serve header and apply requests, so tools that\n  invoke bitmap many times avoid the startup cost of each run. Stop it with SIGTERM.\n  Files are locked while they are read and written, as batch does.\n\nProtocol:\n  Each frame is a 4-byte big-endian length followed by that many bytes of JSON.\n  Requests are {\"args\": [\"apply\", \"--filter=grayscale\", \"/abs/in.bmp\", \"/abs/out.bmp\"]},\n  responses are {\"output\": \"...\"} or {\"error\": \"...\", \"exit_code\": 4}. A connection may\n  carry many requests. A request may add \"settings\", the read and write settings of\n  the global flags of the client, which it then runs with instead of those of the daemon,\n  and has to give in \"stages\" the --background, --straight-alpha, --deterministic and\n  --distance flags the daemon was started with.",
+		"help.client_body":             "Usage:\n  bitmap client [--socket=<path>] header <source_file>\n  bitmap client [--socket=<path>] apply [options] <source_file> <output_file>\n\nDescription:\n  Runs a header or apply command in a running daemon instead of in this process.\n  Relative file names are resolved against the current directory. Global flags\n  that change how files are read and written, such as --strict or --compact, are\n  sent with the request; --background, --straight-alpha, --deterministic and\n  --distance have to be those of the daemon.",
+		"help.serve_body":              "Usage:\n  bitmap serve [options]\n\nThe options are:\n  --addr=<host:port>          address to listen on (default 127.0.0.1:8080)\n  --max-concurrent=<n>        requests processed at once, more get 429 (default: number of CPUs)\n  --max-body-size=<bytes>     largest accepted upload, larger ones get 413 (default 33554432)\n  --timeout=<duration>        time allowed to read and process a request, e.g. 10s (default 30s)\n  --secret=<key>              requires every /apply URL to carry a valid signature\n  --cache-size=<bytes>        memory for cached responses, 0 disables the cache (default 67108864)\n  --cache-max-age=<duration>  max-age sent in Cache-Control headers (default 1h)\n  --shutdown-delay=<duration> time /readyz fails after SIGTERM before draining (default 0s)\n\nEndpoints:\n  POST /apply?op=<option>=<value>...[&format=png]\n                              applies the options in order to the BMP in the request body\n  GET /metrics                stage timings and I/O counters\n  GET /healthz                liveness probe\n  GET /readyz                 readiness probe, fails once shutdown has begun\n\nOn SIGTERM or interrupt the server stops accepting requests and waits up to\n--timeout for in-flight requests to finish.\n\nSigned URLs:\n  With --secret, add sig=<signature> to the query. The signature is the unpadded\n  base64url HMAC-SHA256 of the path and query without sig, e.g.\n  /apply?op=rotate=right&format=png\n\nExample:\n  curl --data-binary @in.bmp 'http://127.0.0.1:8080/apply?op=rotate=right&op=filter=grayscale' > out.bmp",
+		"help.batch_body":              "Usage:\n  bitmap batch [options] <input_dir> <output_dir>\n\nThe options are:\n  --name-template=<template>    output file name, default {name}\n  --incremental                 skips files whose output is up to date\n  --resume                      skips files already written by an interrupted run\n  --state-file=<file>           record of written outputs, default <output_dir>/.bitmap-state.jsonl\n  --results=<text|jsonl>        per-file result format; jsonl prints one JSON object per file\n  --results-file=<file>         writes per-file results to a file instead of standard output\n  --workers=<n>                 files processed at the same time, one per CPU by default, half\n                                as many with --nice\n  --prune-similar=<d>           leaves out files whose color histograms are less than d, from 0 to 1,\n                                away from those of the last file kept in name order, such as\n                                repeated frames written by the frames command\n  --follow-symlinks             reads inputs that are symbolic links and writes through links in\n                                <output_dir>; by default they are skipped and refused, so a link\n                                planted in a tree that is not trusted cannot reach other files\n  any apply option              applied to every file in the given order\n\nTemplate fields:\n  {name} {stem} {ext}           input file name, without extension, extension\n  {op}                          applied options, e.g. mirror-horizontal+filter-grayscale\n  {width} {height}              output dimensions\n\nLocking:\n  Sources are read under shared locks and outputs written under exclusive ones\n  (flock, or LockFileEx on Windows), so runs over the same directories wait for\n  each other instead of reading or writing half-written files.\n\nExample:\n  bitmap batch --filter=grayscale --name-template={stem}_{op}_{width}x{height}.bmp scans/ out/",
+		"usage.run":                    "usage: ./bitmap run [options] <jobs_file>",
+		"help.run_body":                "Usage:\n  bitmap run [options] <jobs_file>\n\nThe options are:\n  --workers=<n>                 jobs run at the same time, one per CPU by default, half as many\n                                with --nice\n  --retries=<n>                 further attempts at a job that failed in a way that may pass,\n                                such as a write error, 2 by default\n  --retry-delay=<duration>      wait before the first retry, doubled before each next one,\n                                1s by default\n  --results=<text|jsonl>        per-job result format; jsonl prints one JSON object per job\n  --results-file=<file>         writes per-job results to a file instead of standard output\n  --failed=<file>               copies the lines of the jobs that failed to a jobs file, to\n                                run them again once the cause is fixed\n  --output-root=<dir>           directory outputs may not leave; relative outputs are taken\n                                from it\n  --follow-symlinks             reads inputs and writes outputs that are symbolic links, and with\n                                --output-root writes through links in it; by default they are\n                                refused, for jobs listed from trees that are not trusted\n\nJobs:\n  Every line of <jobs_file> is a job, a JSON object with the fields:\n    input                       source file, in any format convert reads\n    output                      file to write; missing directories are created\n    ops                         apply options run in the given order, as in rpc:\n                                [{\"name\": \"rotate\", \"value\": \"right\"}]\n    format                      output format, inferred from the output name when left out\n  A <jobs_file> of - reads the jobs from standard input.\n\nDescription:\n  Runs every job on a pool of workers and prints a summary at the end. Jobs are read as\n  workers take them and reported in the order of the file, so a jobs file of millions of\n  lines, such as one written by a script planning a migration, runs in little memory.\n  Jobs with a missing or damaged input or a bad option fail at once; others are retried.\n  A job that fails does not stop the others, but the run ends with an error.\n\nExample:\n  bitmap run --workers=16 --failed=failed.jsonl --results=jsonl --results-file=log.jsonl jobs.jsonl",
+	},
+	"ru": {
+		"error.prefix":                   "Ошибка:",
+		"error.invalid_args":             "неверное количество аргументов",
+		"error.invalid_option":           "неверный формат опции: %s",
+		"error.missing_value":            "не указано значение опции %s",
+		"error.default_value":            "%s: %v",
+		"error.config_line":              "недопустимая строка настроек %s:%d: в разделе [defaults] ожидается имя = значение",
+		"error.flag_value":               "недопустимое значение %q для --%s: ожидается %s",
+		"error.flag_conflict":            "--%s и --%s нельзя использовать вместе",
+		"expect.bool":                    "true или false",
+		"expect.int":                     "целое число не меньше %d",
+		"expect.duration":                "длительность, например 30s",
+		"expect.positive_duration":       "длительность больше нуля, например 30s",
+		"expect.choice":                  "одно из значений %s",
+		"expect.non_empty":               "непустое значение",
+		"expect.output":                  "<файл>[:ШxВ] с положительными размерами",
+		"expect.components":              "XxY, каждое число от 1 до 9",
+		"expect.size":                    "ШxВ с положительными размерами",
+		"expect.color_range":             "first-last, где 0 <= first < last <= 255",
+		"expect.strip_pattern":           "имя файла с одним целочисленным спецификатором для номера полосы, например part_%02d.bmp",
+		"expect.color":                   "цвет в виде rrggbb или #rrggbb",
+		"expect.dpi":                     "положительное число точек на дюйм, например 300",
+		"expect.prune_similar":           "расстояние между гистограммами от 0 до 1, например 0.05",
+		"expect.metric":                  "одна из метрик %s, после \":\" можно указать неотрицательную оценку",
+		"expect.fit_ops":                 "опции из списка %s через запятую, каждая не больше одного раза",
+		"expect.byte_size":               "положительное число байт, можно с K, M или G, например 256M",
+		"expect.url":                     "URL вида http:// или https://",
+		"expect.command":                 "команда, начинающаяся с имени запускаемой программы",
+		"expect.post_hook":               "команда с подстановками %s",
+		"expect.language":                "один из языков %s или локаль, например ru_RU.UTF-8",
+		"expect.stack_weights":           "flat, gauss с необязательной шириной в кадрах, например gauss,3, ramp или веса через запятую, неотрицательные и не все равные 0",
+		"error.invalid_assert":           "недопустимая проверка %q: ожидается dimensions:ШxВ, max-colors:N или not-blank",
+		"error.assert_dimensions":        "проверка не пройдена: размер изображения %dx%d, ожидается %dx%d",
+		"error.assert_colors":            "проверка не пройдена: в изображении больше %d цветов",
+		"error.assert_blank":             "проверка не пройдена: изображение пустое",
+		"error.invalid_condition":        "недопустимое условие %q: ожидается width, height или pixels, сравнение (>, <, >=, <=, ==, !=) и число",
+		"error.guard_last":               "за условием %q не следует опция, которую оно проверяет",
+		"error.unexpected_arg":           "неожиданный аргумент: %s",
+		"error.unknown_command":          "неизвестная команда: %s",
+		"error.unknown_option":           "неизвестная опция: %s",
+		"error.unknown_topic":            "неизвестная команда или опция: %s",
+		"error.open_file":                "ошибка открытия файла: %v",
+		"error.create_file":              "ошибка создания файла: %v",
+		"error.read_bmp_header":          "ошибка чтения заголовка BMP: %v",
+		"error.read_dib_header":          "ошибка чтения заголовка DIB: %v",
+		"error.not_bmp":                  "файл не является BMP",
+		"error.bit_count":                "неподдерживаемая глубина цвета: %d (поддерживаются только 1, 4, 8, 24 и 32-битные BMP)",
+		"error.compression":              "неподдерживаемое сжатие: %d",
+		"error.rle_truncated":            "сжатые RLE пиксельные данные заканчиваются на строке %d до кода конца изображения",
+		"error.rle_bounds":               "сжатые RLE пиксельные данные в байте %d выходят за пределы изображения %dx%d",
+		"error.dimensions":               "неподдерживаемые размеры: %dx%d",
+		"error.seek_pixels":              "ошибка перехода к пиксельным данным: %v",
+		"error.read_row":                 "ошибка чтения строки пикселей %d: %v",
+		"error.pixel_count":              "количество пикселей %d не соответствует размерам %dx%d",
+		"error.write_bmp_header":         "ошибка записи заголовка BMP: %v",
+		"error.write_dib_header":         "ошибка записи заголовка DIB: %v",
+		"error.write_pixels":             "ошибка записи пиксельных данных: %v",
+		"error.start_server":             "ошибка запуска сервера: %v",
+		"error.write_script":             "ошибка записи скрипта: %v",
+		"error.invalid_filter":           "неверный фильтр: %s",
+		"error.invalid_mirror":           "неверная ось отражения: %s",
+		"error.invalid_angle":            "неверный угол поворота: %v",
+		"error.blur":                     "неверное размытие: радиус %d с ядром %s",
+		"error.convolve":                 "неверная свертка: %d весов с режимом краев %s",
+		"error.opacity":                  "неверная непрозрачность %v: ожидается значение от 0 до 1",
+		"error.blend_mode":               "неизвестный режим наложения: %s",
+		"error.invalid_crop":             "неверный формат обрезки: %s",
+		"error.invalid_crop_val":         "неверное значение обрезки: %s",
+		"error.invalid_pixelate":         "неверная пикселизация %q: ожидается область, как для --crop, возможно с :size и положительным размером блока",
+		"error.invalid_fit":              "неверный размер вписывания %q: ожидается ШxВ, возможно с :upscale или :no-upscale",
+		"error.invalid_resize":           "неверный размер %q: ожидается ШxВ не больше %d пикселей, возможно с :bilinear или :nearest",
+		"error.invalid_scale":            "неверный масштаб %q: ожидается положительный множитель, дающий не больше %d пикселей, возможно с :bilinear или :nearest",
+		"error.invalid_upscale":          "неверное увеличение %q: ожидается scale2x, hq2x или xbr, возможно с :2, :3 или :4",
+		"error.invalid_zoom":             "неверное увеличение %q: ожидается множитель от 2x до %dx, возможно с :grid",
+		"error.invalid_smartcrop":        "неверный размер умной обрезки %q: ожидается ШxВ",
+		"error.smartcrop_bounds":         "окно умной обрезки %dx%d больше изображения %dx%d",
+		"error.stream_option":            "опцию %s=%s нельзя применить построчно; --stream поддерживает --mirror=horizontal, --crop и фильтры blue, red, green, grayscale и negative",
+		"error.stream_output":            "--stream, --tile-size и --max-memory записывают один BMP-файл без размера, --save-stages, --record, --embed, --compact и --keep-offset",
+		"error.tile_option":              "опцию %s=%s нельзя применить по тайлам; --tile-size и --max-memory поддерживают --mirror, --rotate на углы, кратные 90 градусам, --crop и фильтры blue, red, green, grayscale и negative",
+		"error.checkpoint_tiles":         "--checkpoint возобновляет построчные запуски и не сочетается с --tile-size и --max-memory",
+		"error.checkpoint_files":         "--checkpoint требует локального исходного и локального выходного файла, без --encrypt",
+		"error.no_preview":               "в %s нет JPEG-превью, которое можно декодировать",
+		"error.invalid_testcard_steps":   "неверное значение --steps %d: на карте gray-steps не больше %d ступеней",
+		"error.testcard_small":           "изображение %dx%d слишком мало, чтобы измерить %d ступеней; обрежьте фотографию по карте",
+		"error.video_container":          "%s не является видео YUV4MPEG2 (.y4m) или AVI",
+		"error.video_codec":              "frames читает только несжатое видео RGB и YUV, а не %s; ffmpeg -i <видео> frame_%%06d.bmp извлекает кадры любого другого",
+		"error.video_damaged":            "%s поврежден: %v",
+		"error.no_frames":                "в %s %d кадров, и ни одного начиная с --start=%d",
+		"video.truncated":                "он обрывается посреди кадра",
+		"video.long_line":                "строка заголовка слишком длинная",
+		"video.short_format":             "формат его видеопотока слишком короткий",
+		"video.large_frame":              "кадр из %d байт больше, чем допускает его формат",
+		"video.short_frame":              "в кадре %d байт из %d, нужных его формату",
+		"video.no_stream":                "в нем нет видеопотока",
+		"video.frame_size":               "кадры размером %dx%d пусты или слишком велики",
+		"error.pdf_page_content":         "%s: страницу %d нельзя прочитать без растеризатора (%v); установите pdftoppm или задайте --rasterizer=<команда>",
+		"error.pdf_page_range":           "в %s страниц: %d, страницы %d нет",
+		"error.pdf_rasterizer":           "растеризатор %s завершился с ошибкой: %v",
+		"error.no_rasterizer":            "--rasterizer не называет программу для запуска",
+		"pdf.color_space":                "цветовое пространство %s не поддерживается",
+		"pdf.damaged":                    "документ или его изображение не удается разобрать",
+		"pdf.encrypted":                  "документ зашифрован",
+		"pdf.filter":                     "изображения, сжатые %s, не поддерживаются",
+		"pdf.no_image":                   "на странице нет изображения",
+		"pdf.partial_image":              "ни одно изображение не занимает всю страницу",
+		"error.precision_flag":           "--precision=16 не сочетается с %s",
+		"error.precision_format":         "--precision=16 записывает только файлы PNG, а не %s",
+		"error.precision_operation":      "%s не работает с 16 битами на канал; --precision=16 поддерживает --mirror, --rotate, --crop, --resize, --scale, --filter, --brightness, --contrast, --saturation, --gamma и --colorspace",
+		"error.precision_filter":         "--precision=16 не поддерживает --filter=%s; поддерживаются red, green, blue, grayscale и negative",
+		"error.precision_angle":          "--precision=16 поворачивает только на углы, кратные 90 градусам, а не на %s",
+		"error.read_checkpoint":          "ошибка чтения файла контрольной точки: %v",
+		"error.write_checkpoint":         "ошибка записи контрольной точки: %v",
+		"error.read_rows":                "нельзя построчно прочитать %d-битные пиксели со сжатием %d, только несжатые 24- и 32-битные, записанные снизу вверх",
+		"error.invalid_ninepatch":        "неверный nine-patch %q: ожидается left,top,right,bottom:ШxВ",
+		"error.ninepatch_size":           "границы nine-patch %s не помещаются в %dx%d",
+		"error.ninepatch_bounds":         "границы nine-patch %d,%d,%d,%d не оставляют центра в изображении %dx%d",
+		"error.invalid_trim":             "неверный режим обрезки краев %q: ожидается alpha",
+		"error.invalid_auto_rotate":      "неверный режим автоповорота %q: ожидается text",
+		"error.trim_empty":               "нечего обрезать: все пиксели полностью прозрачны",
+		"error.invalid_deskew":           "неверное выравнивание %q: ожидается наибольший наклон в градусах, больше 0 и не больше %d",
+		"error.invalid_threshold":        "неверный порог %q: ожидается otsu, adaptive[,окно[,смещение]] с нечетным окном от 3 до 1001 и смещением от -255 до 255 или уровень от 0 до 255",
+		"error.invalid_despeckle":        "неверная сила удаления соринок %q: ожидается от 1 до %d",
+		"error.invalid_margin_crop":      "неверная обрезка полей %q: ожидается отступ в пикселях от 0 до %d",
+		"error.invalid_preset":           "неизвестный набор %q: ожидается ocr",
+		"error.invalid_outline":          "неверный контур %q: ожидается ширина,rrggbb с шириной от 1 до %d",
+		"error.invalid_blur":             "неверное размытие %q: ожидается радиус от 1 до %d, возможно с ,gaussian или ,box",
+		"error.invalid_convolve":         "неверное ядро %q: ожидается 9 или 25 весов через запятую, возможно с :clamp, :wrap или :mirror",
+		"error.invalid_colorspace":       "неверное цветовое пространство %q: ожидается srgb или linear",
+		"error.invalid_adjustment":       "неверное значение %s %q: ожидается целое число от -100 до 100",
+		"error.invalid_gamma":            "неверная гамма %q: ожидается положительное число, например 2.2",
+		"error.invalid_auto_expose":      "неверное значение auto-expose %q: ожидается from:x,y,w,h с положительными шириной и высотой",
+		"error.channel_size":             "файл канала %s имеет размер %dx%d, ожидается %dx%d, как у первого",
+		"error.invalid_strip_pattern":    "неверный шаблон имени полос %q: ожидается %s",
+		"error.no_gutter":                "в %s не найден корешок между двумя страницами: ожидается скан книги с пустой или затененной полосой в средней трети",
+		"error.strip_width":              "файл полосы %s шириной %d пикселей, ожидается %d, как у первого",
+		"error.invalid_colormap":         "неверная цветовая карта %q: ожидается viridis, jet, magma или grayscale",
+		"error.invalid_backend":          "неверное устройство %q: ожидается cpu или gpu",
+		"error.gpu_not_built":            "в этой сборке нет GPU-бэкенда; соберите с -tags gpu",
+		"error.gpu_library":              "библиотека OpenCL не найдена",
+		"error.gpu_symbol":               "в %s нет %s",
+		"error.gpu_setup":                "OpenCL %s завершился с ошибкой %d",
+		"error.post_hook":                "команда после записи %s завершилась ошибкой для %s: %v",
+		"error.encrypted":                "%s зашифрован: укажите парольную фразу в --decrypt",
+		"error.encrypted_format":         "не зашифрованный контейнер поддерживаемой версии",
+		"error.encrypted_iterations":     "контейнер требует %d итераций выработки ключа, больше допустимых %d",
+		"error.decrypt":                  "не удалось расшифровать: неверная парольная фраза или файл изменен",
+		"error.compare_size":             "изображения разного размера: %dx%d и %dx%d",
+		"error.stack_size":               "кадр %s имеет размер %dx%d, а первый кадр — %dx%d",
+		"error.stack_weight_count":       "--weights задает %d весов для %d кадров",
+		"error.fit_aspect":               "у исходного файла %dx%d и эталона %dx%d разное соотношение сторон",
+		"error.split_position":           "неверное положение разделения %d: ожидается процент от 0 до 100",
+		"error.histogram_bins":           "неверное число столбцов %d: ожидается 1, 2, 4, 8, 16, 32, 64, 128 или 256",
+		"error.thumbs_empty":             "в %s нет читаемых BMP-файлов",
+		"error.images_differ":            "изображения различаются в %d пикселях",
+		"error.invalid_bitplane":         "неверная битовая плоскость %q: ожидается канал:бит, где канал red, green, blue или alpha, а бит от 0 до 7",
+		"error.invalid_pixelsort":        "неверная сортировка пикселей %q: ожидается порог[,направление], где порог от 0 до 255, а направление horizontal или vertical",
+		"error.invalid_rowshift":         "неверный сдвиг строк %q: ожидается величина[:seed] с положительной величиной",
+		"error.invalid_crystallize":      "неверная кристаллизация %q: ожидается cells[:seed] с числом ячеек от 1 до %d",
+		"error.invalid_lens":             "неверная дисторсия %q: ожидается два или три коэффициента k1,k2[,k3]",
+		"error.invalid_swirl":            "неверное закручивание %q: ожидается degrees[,radius] с положительным радиусом в пикселях",
+		"error.invalid_implode":          "неверный коэффициент сжатия %q: ожидается число от -1 до 1",
+		"error.invalid_param":            "недопустимое значение %s %q для --%s: ожидается %s",
+		"error.invalid_wave":             "неверная волна %q: ожидается amplitude,wavelength в пикселях с положительной длиной волны",
+		"error.invalid_kaleidoscope":     "неверный калейдоскоп %q: ожидается segments[,angle] с числом сегментов от 2 до %d",
+		"error.invalid_symmetry":         "неверная симметрия %q: ожидается horizontal, vertical или quad",
+		"error.invalid_overlay":          "неверное наложение %q: ожидается файл:x,y[:непрозрачность[:режим]] с непрозрачностью от 0 до 1",
+		"error.invalid_overlay_mode":     "неизвестный режим смешивания %q: ожидается один из %s",
+		"error.invalid_displace":         "неверное смещение %q: ожидается file[:strength] с силой в пикселях",
+		"error.invalid_stamp":            "неверная надпись %q: ожидается [угол:]текст с непустым текстом",
+		"error.invalid_source_date":      "неверное значение SOURCE_DATE_EPOCH %q: ожидается неотрицательное число секунд с 1970 года",
+		"error.stamp_field":              "неизвестное поле надписи %s: ожидается {filename}, {stem} или {mtime}",
+		"error.auto_expose_bounds":       "область auto-expose %d,%d %dx%d выходит за границы изображения %dx%d",
+		"error.auto_expose_black":        "область auto-expose черная, никакая экспозиция не сделает ее средне-серой",
+		"error.read_hints":               "ошибка чтения подсказок из %s: %v",
+		"error.invalid_hint":             "неверная подсказка в %s: у области %d должны быть положительные ширина и высота и неотрицательный вес",
+		"error.crop_area":                "область обрезки %dx%d в точке %d,%d выходит за пределы изображения %dx%d",
+		"error.pixelate":                 "неверная пикселизация: область %dx%d в точке %d,%d с блоками по %d пикселей в изображении %dx%d",
+		"error.tile_filter":              "фильтр %s нельзя применить по тайлам: подходят только фильтры, меняющие каждый пиксель отдельно",
+		"error.tile_memory":              "тайлам размером %dx%d пикселей нужно %d байт памяти, больше ограничения %d",
+		"error.tile_file":                "ошибка работы с временным файлом тайлов: %v",
+		"error.read_profile":             "ошибка чтения цветового профиля: %v",
+		"error.write_profile":            "ошибка записи цветового профиля: %v",
+		"format.profile":                 "цветовой профиль размером %d байт по смещению %d выходит за конец файла размером %d байт и пропущен",
+		"error.crop_bounds":              "область %s (%dx%d в точке %d,%d) выходит за пределы изображения %dx%d",
+		"usage.header":                   "использование: ./bitmap header [--format=<text|json|yaml>] <bmp_файл>",
+		"usage.apply":                    "использование: ./bitmap apply [опции] <исходный_файл> [<выходной_файл>] [--output=<файл>[:ШxВ]]...",
+		"usage.tune":                     "использование: ./bitmap tune [опции] <исходный_файл>",
+		"usage.help":                     "использование: ./bitmap help [команда|опция]",
+		"usage.man":                      "использование: ./bitmap man",
+		"info.opening_file":              "Открытие файла: < %s >",
+		"info.lock_wait":                 "Ожидание, пока другой запуск закончит работу с %s",
+		"info.gpu_device":                "Фильтры, свертки и масштабирование выполняются на %s",
+		"info.pdf_image":                 "Страница %d читается как отсканированное изображение %dx%d",
+		"info.pdf_rasterizer":            "Страницу %d нельзя прочитать напрямую (%v); она отрисовывается программой %s",
+		"info.deskew":                    "Выпрямляется наклон %.2f градуса",
+		"info.estimate":                  "Оценка: %s памяти и %v времени",
+		"info.post_hook":                 "Выполняется %s",
+		"info.stack_frame":               "Кадр %d из %d сложен: %s",
+		"info.split_pages":               "Страницы заканчиваются на столбце %d и начинаются со столбца %d",
+		"info.auto_rotate":               "Текст, повернутый на %d градусов, ставится прямо",
+		"info.frames_written":            "записано кадров: %d в %s",
+		"info.frames_pruned":             "пропущено кадров, похожих на последний записанный: %d",
+		"info.frame_pruned":              "кадр %d пропущен: %.3f от последнего записанного кадра",
+		"info.checkpoint_resumed":        "Продолжение со строки %d из %d по %s",
+		"info.fetch_range":               "Получены байты %d-%d из %d с %s",
+		"info.cache_hit":                 "%s скопирован из кэша",
+		"info.stage_done":                "этап %d из %d, %s, занял %s",
+		"info.shell_loaded":              "%s: %dx%d; введите help для списка команд",
+		"info.shell_applied":             "%s: %dx%d за %s",
+		"info.shell_state":               "%dx%d, шагов для отмены: %d, для возврата: %d",
+		"info.shell_saved":               "сохранено в %s",
+		"info.shell_preview":             "предпросмотр записан в %s",
+		"info.pick_keys":                 "стрелки перемещают, Shift+стрелки меняют размер, Enter выводит, q отменяет",
+		"info.shell_undone":              "(отменено)",
+		"info.shell_no_steps":            "шаги не применялись",
+		"info.selftest_ok":               "ok    %-44s %08x",
+		"info.selftest_fail":             "СБОЙ  %-44s %08x, ожидалось %08x",
+		"info.selftest_error":            "СБОЙ  %-44s %v",
+		"info.selftest_jobs":             "СБОЙ  %-44s результат с 1 и %d горутинами различается",
+		"info.selftest_passed":           "все проверки (%d) пройдены на %s",
+		"info.tuning":                    "Настройка %s по адресу http://%s/ (нажмите Done в браузере для завершения)",
+		"help.usage":                     "Использование:",
+		"help.description":               "Описание:",
+		"help.options":                   "Опции:",
+		"help.commands":                  "Команды:",
+		"help.parameters":                "Параметры:",
+		"help.examples":                  "Примеры:",
+		"help.note":                      "Примечание:",
+		"help.values":                    "значения: %s",
+		"help.default":                   "по умолчанию: %s",
+		"help.range":                     "от %d до %d",
+		"help.range_bound":               "от %d до размера изображения (%s)",
+		"help.range_file":                "путь к файлу",
+		"help.range_text":                "текст, как описано выше",
+		"help.range_number":              "любое число",
+		"unit.px":                        "в пикселях",
+		"unit.percent":                   "в процентах",
+		"unit.degrees":                   "в градусах",
+		"error.file_option":              "опция --%s читает файлы и недоступна по HTTP",
+		"error.rpc_file_option":          "опция --%s читает файлы и недоступна с --root",
+		"error.root_command":             "--%s запускает команду и недоступна с --root",
+		"error.remap_line":               "%s:%d: ожидается старыйHex=новыйHex",
+		"help.flag_help":                 "выводит справку по использованию программы",
+		"help.general_more":              "Используйте \"bitmap help <команда>\" или \"bitmap help <опция>\" для подробностей.",
+		"help.apply_note":                "  Несколько опций можно комбинировать, они применяются по порядку\n  Значение можно указать через пробел после опции (--mirror horizontal, -m h)\n  Значения через запятую применяют опцию для каждого из них (--filter=grayscale,negative)\n  Опции можно указывать до или после имен файлов; аргументы после -- всегда считаются именами файлов\n  Используйте \"bitmap help <опция>\" для описания и примеров отдельной опции\n  Имя файла - читает исходное изображение из стандартного ввода или пишет результат в стандартный вывод\n  (cat a.bmp | bitmap apply --filter=grayscale - - > b.bmp); каналы и подстановка процессов тоже подходят как источник\n  Источник, заданный как URL http:// или https://, загружается запросами Range блоками по мере декодирования\n  Формат результата определяется расширением выходного файла (.png, .jpg, .jpeg, .txt, .npy, .arrow, .feather,\n  иначе BMP); --format=<bmp|png|jpeg|text|npy|arrow> задает его явно. npy записывает массив NumPy из байтов\n  формы (высота, ширина, 3 или 4 с альфа-каналом), начиная с верхней строки; arrow записывает файл Arrow IPC\n  (Feather) со столбцом uint8 на каждый канал, строкой на каждый пиксель и шириной, высотой и формой в метаданных схемы\n  Каждый флаг --output=<файл>[:ШxВ] записывает еще один результат того же запуска, масштабированный до ШxВ;\n  если указана только ширина или высота (200x, x150), пропорции сохраняются\n  --save-stages=<каталог> записывает изображение после каждой опции в каталог (stage01_rotate.bmp, ...)\n  --record=<файл.gif> записывает анимированный GIF из исходного изображения и изображения после каждой\n  опции с ее названием на кадре, чтобы показать, как получается результат; кадры уменьшаются до 640 пикселей\n  --stream обрабатывает изображение построчно в ограниченной памяти; выбирается сам для изображений\n  больше 64M пикселей, когда применяются только --mirror=horizontal, --crop и попиксельные фильтры к одному BMP\n  --checkpoint=<файл> обрабатывает изображение построчно и после каждых 1024 строк записывает в файл, докуда\n  дошел запуск, и сохраняет на диск уже записанную часть результата в <результат>.partial; после прерывания\n  запустите ту же команду снова, и она продолжит с последней контрольной точки, если источник не изменился\n  --tile-size=<n> и --max-memory=<размер> (256M, 1G) обрабатывают изображение тайлами n на n, хранящимися\n  во временных файлах по 8 байт на пиксель, и держат в памяти столько тайлов, сколько позволяет ограничение;\n  они поддерживают --mirror, --rotate на углы, кратные 90 градусам, --crop и попиксельные фильтры\n  --warn-memory=<размер> (по умолчанию 2G) и --warn-time=<длительность> (по умолчанию 1m) предупреждают до\n  чтения пикселей, если память или время, которые по оценке из размера изображения займут опции, больше их,\n  как при большом радиусе --blur или --resize, и называют --stream или --max-memory, если те могут выполнить\n  опции; -v выводит оценки. На общих машинах задайте их в разделе [defaults] файла настроек\n  --dpi=<n> задает разрешение BMP-результатов в n точек на дюйм, на которое ориентируются типографии;\n  его можно указать без других опций, чтобы изменить только разрешение, не трогая пиксели\n  --cache-dir=<каталог> (например ~/.cache/bitmap, или $BITMAP_CACHE_DIR) хранит результаты по содержимому\n  исходного файла, опциям и влияющим на них настройкам и копирует их оттуда, когда тот же запуск повторяется,\n  как в повторных CI-заданиях; запуски со стандартным выводом, --save-stages или --record не кэшируются\n  --cache-url=<url> (или $BITMAP_CACHE_URL) делает кэш общим для разных машин через HTTP-сервер, который\n  отвечает на GET и PUT <url>/<ключ>, как удаленные кэши Bazel; записи, которых нет в --cache-dir (по умолчанию\n  bitmap в пользовательском каталоге кэша), берутся с него, новые загружаются на него, а его сбои дают лишь предупреждения\n  --provenance=<файл.json> записывает манифест с SHA-256 исходного и каждого выходного файла, опциями\n  и сборкой, которая их создала; с --provenance-key=<ключ> (или $BITMAP_PROVENANCE_KEY) он подписывается\n  HMAC-SHA256, а bitmap provenance verify проверяет по нему изображение\n  --precision=16 читает источник, например 16-битный PNG, с 16 битами на канал, применяет опции с 16-битной\n  точностью и записывает 16-битные PNG, чтобы bitmap мог быть этапом конвейера с высокой глубиной цвета;\n  поддерживаются --mirror, --rotate на углы, кратные 90 градусам, --crop, --resize, --scale, --filter с red,\n  green, blue, grayscale или negative, --brightness, --contrast, --saturation, --gamma и --colorspace\n  PDF-источник читается по одной странице, первой, если --page=<n> не выбирает другую, чтобы отсканированные\n  документы можно было выравнивать, бинаризовать и обрезать; страница, которая является одним\n  отсканированным изображением, читается в разрешении сканирования, а остальные страницы отрисовываются\n  с разрешением --dpi (по умолчанию 300) командой --rasterizer=<команда> (или $BITMAP_RASTERIZER) либо\n  программой pdftoppm, если она установлена. В команде заменяются {file}, {page} и {dpi}, и она пишет\n  PNG, JPEG или BMP в стандартный вывод (--rasterizer='mutool draw -r {dpi} -F png -o - {file} {page}')",
+		"help.global_options":            "Общие опции, указываемые перед командой:\n  --lang=<код>                     язык сообщений (en, ru); по умолчанию $BITMAP_LANG или $LANG\n  --metrics=<json|prometheus>      выводит время этапов, объем данных и число пикселей после запуска\n  --metrics-file=<файл>            куда записывать --metrics, по умолчанию стандартный поток ошибок\n  --max-width=<n> --max-height=<n>  отклоняет изображения шире или выше n пикселей\n  --max-pixels=<n>                 отклоняет изображения, в которых больше n пикселей\n  --max-file-size=<байты>          отклоняет файлы больше указанного размера\n  --strict                         отклоняет файлы с любыми отступлениями от формата\n  --permissive                     восстанавливает поврежденные файлы с предупреждением о каждой проблеме\n  --trust=<headers|data>           если записанный размер файла или изображения расходится с файлом, верить\n                                   заголовкам (файл кончается там, где они говорят, строки читаются записанного\n                                   размера, например без выравнивания) или данным (читается все, что есть в файле),\n                                   сообщая о расхождении\n  --keep-offset                    сохраняет исходный размер заголовка и смещение пиксельных данных вместе с байтами между ними\n  --keep-orientation               записывает строки сверху вниз, если так их хранит исходный файл, а не снизу вверх\n  --index=<n>                      изображение, читаемое из массива OS/2, по умолчанию 0\n  --embed=<png|jpeg>               сохраняет пиксели результата как встроенный поток PNG или JPEG\n  --compact                        записывает результат, где не больше 256 цветов (например, серый), как индексированный BMP\n  --true-color                     записывает 24-битный BMP, раскрывая таблицу цветов и отбрасывая альфа-канал\n  --jobs=<n>                       число горутин, между которыми фильтры и повороты делят строки, по умолчанию по одной на процессор\n  --nice                           работает с пониженным приоритетом процессора и ввода-вывода (nice 10 и ionice -c3,\n                                   на Windows фоновый режим) и вдвое меньшим числом --jobs и обработчиков batch и run\n                                   по умолчанию, чтобы долгие задания не мешали работать на машине\n  --isolate                        декодирует каждый файл в отдельном процессе, который не может открывать файлы\n                                   и сокеты (seccomp в Linux, объект задания в Windows), чтобы ошибка декодера,\n                                   вызванная специально созданным файлом, не затронула остальную работу\n  --straight-alpha                 изменяет размер, не взвешивая цвета по альфа-каналу, как прежние версии\n  --deterministic                  делает результаты побайтно одинаковыми между запусками и машинами для воспроизводимых\n                                   сборок: время в --stamp берется из $SOURCE_DATE_EPOCH в UTC, а при совпадении имен\n                                   в batch всегда записывается более ранний файл\n  --background=<rrggbb>            цвет углов, открывающихся при повороте на угол, не кратный 90 градусам\n  --distance=<имя>                 как подбираются цвета при сведении к таблице цветов, например для --record:\n                                   rgb (по умолчанию), weighted (redmean), cie76 или ciede2000, точнее всего для глаза\n  --progress                       рисует в стандартном потоке ошибок полосу строк, обработанных каждым этапом apply\n  -v, --verbose                    также выводит открываемые файлы и время каждого этапа\n  --quiet                          выводит только результаты и ошибки, без предупреждений и заметок\n  --errors=<text|json>             выводит ошибку как объект JSON с кодом, кодом завершения, ключом и текстом\n  --color=<auto|always|never>      выделяет цветом префиксы ошибок и предупреждений; auto — только в терминале\n                                   и без $NO_COLOR, а header в терминале в любом случае выравнивает столбцы\n  --encrypt=<фраза>                запечатывает каждый результат в зашифрованный контейнер (AES-256-GCM, ключ\n                                   выводится через PBKDF2); контейнеры различаются при каждом запуске и не кэшируются\n  --decrypt=<фраза>                открывает источники, запечатанные --encrypt; передавайте обе фразы через\n                                   $BITMAP_ENCRYPT и $BITMAP_DECRYPT, чтобы их не было видно в списке процессов\n  --backend=<cpu|gpu>              устройство для попиксельных фильтров, сверток и билинейного масштабирования; gpu\n                                   требует сборки с -tags gpu и драйвера OpenCL, иначе работа с предупреждением\n                                   остается на процессоре. Результаты могут отличаться от процессорных на один уровень\n  --post-hook=<команда>            выполняет команду после записи каждого выходного файла, например чтобы\n                                   выгрузить его; {output}, {name}, {stem}, {ext}, {dir}, {width} и {height}\n                                   в ней обозначают файл, а сама она делится по пробелам и запускается без\n                                   оболочки. Ошибка команды считается ошибкой результата, как ошибка записи\n\nЗначения по умолчанию для любых флагов, общих и команд, берутся из переменных BITMAP_<ФЛАГ>,\nнапример BITMAP_MAX_PIXELS или BITMAP_RESULTS, затем из раздела [defaults] файла настроек\n($BITMAP_CONFIG или bitmap/config в каталоге настроек пользователя), по одной строке \"флаг = значение\".\nФлаги в командной строке имеют приоритет.",
+		"help.exit_status":               "Код завершения: 0 при успехе, а при ошибке:",
+		"exit.failure":                   "любая ошибка, не перечисленная ниже",
+		"exit.usage":                     "неверные аргументы или значения опций",
+		"exit.not_found":                 "читаемый файл не существует",
+		"exit.invalid_bmp":               "входной файл не является BMP или поврежден",
+		"exit.unsupported":               "входной файл — корректный BMP, использующий неподдерживаемую возможность",
+		"exit.write":                     "не удалось записать результат",
+		"error.embedded":                 "ошибка декодирования встроенного изображения %s: %v",
+		"error.embedded_size":            "встроенное изображение %s имеет размер %dx%d, а заголовок указывает %dx%d",
+		"error.encode_embedded":          "ошибка кодирования встроенного изображения %s: %v",
+		"error.encode_output":            "ошибка кодирования результата в формате %s: %v",
+		"error.decode_input":             "ошибка декодирования %s: %v",
+		"cmd.dump.summary":               "выводит пиксели в виде текста, по строке шестнадцатеричных цветов на ряд",
+		"usage.dump":                     "использование: ./bitmap dump [--pixels] [--format=text] [--region=<смещениеX-смещениеY[-ширина-высота]>] <исходный_файл>",
+		"error.write_output":             "ошибка записи вывода: %v",
+		"help.dump_body":                 "Использование:\n  bitmap dump [--pixels] [--format=text] [--region=<смещениеX-смещениеY[-ширина-высота]>] <исходный_файл>\n\nОписание:\n  Выводит строку \"# bitmap pixels ШxВ\", а затем по строке на каждый ряд пикселей,\n  начиная с верхнего, с пикселями в виде rrggbb. Так небольшие тестовые изображения\n  можно просматривать и сравнивать как текст.\n\nОпции:\n  --pixels         выводит пиксели (раздел по умолчанию и пока единственный)\n  --format=text    формат вывода (только text)\n  --region=<...>   выводит только эту область, заданную как для --crop",
+		"cmd.convert.summary":            "преобразует между BMP, PNG, JPEG и текстом, выведенным dump",
+		"usage.convert":                  "использование: ./bitmap convert [--format=<bmp|png|jpeg|text|npy|arrow>] [--page=<n>] [--rasterizer=<команда>] <входной_файл> <выходной_файл>",
+		"error.text_row_width":           "%s:%d: в ряду %d пикселей, ожидается %d, как в первом ряду",
+		"error.text_empty":               "в %s нет рядов пикселей",
+		"help.convert_body":              "Использование:\n  bitmap convert [--format=<bmp|png|jpeg|text|npy|arrow>] [--page=<n>] [--rasterizer=<команда>]\n                 <входной_файл> <выходной_файл>\n\nОписание:\n  Преобразует между BMP, PNG, JPEG и текстовым форматом, выводимым dump, определяя\n  формат входного файла по его первым байтам. В текстовом формате по строке значений\n  rrggbb на каждый ряд пикселей, начиная с верхнего. Пустые строки и строки,\n  начинающиеся с #, пропускаются, так что маленькие тестовые изображения можно писать вручную.\n\n  Результат записывается как BMP-файл, если имя выходного файла не оканчивается\n  на .png, .jpg, .jpeg, .txt, .npy, .arrow или .feather и --format не задает другой\n  формат. npy и arrow выгружают массив пикселей для NumPy и pandas, как описано в apply;\n  они не читаются.\n  Из PNG и JPEG получается 24-битный BMP; прозрачность отбрасывается. BMP на входе\n  сохраняет свои заголовки, а общие флаги вроде --max-pixels ограничивают входные файлы любого формата.\n\n  Из PDF берется одна страница, первая, если --page=<n> не выбирает другую, и читается,\n  как описано в apply; --rasterizer=<команда> отрисовывает страницы, которые не являются\n  одним отсканированным изображением. BMP-результат сохраняет разрешение, в котором прочитана страница.",
+		"cmd.explain.summary":            "описывает опцию apply и показывает ее действие на встроенном образце",
+		"usage.explain":                  "использование: ./bitmap explain --<опция>[=<значение>]",
+		"explain.preview":                "Действие --%s=%s на встроенном образце:",
+		"explain.before":                 "до",
+		"explain.after":                  "после",
+		"explain.no_preview":             "Эта опция читает файл, поэтому показать ее на встроенном образце нельзя.",
+		"explain.guard":                  "Эта опция только решает, выполняется ли следующая, поэтому собственного образца у нее нет.",
+		"cmd.placeholder.summary":        "выводит заглушку BlurHash или ThumbHash либо отрисовывает ее в изображение",
+		"usage.placeholder":              "использование: ./bitmap placeholder [--algo=<blurhash|thumbhash>] [--components=<XxY>] <исходный_файл>\n               ./bitmap placeholder [--algo=<blurhash|thumbhash>] --decode=<хеш> [--size=<ШxВ>] <выходной_файл>",
+		"error.invalid_blurhash":         "неверный BlurHash %q",
+		"error.invalid_thumbhash":        "неверный ThumbHash %q: ожидается base64 не менее 5 байт со всеми коэффициентами",
+		"help.placeholder_body":          "Использование:\n  bitmap placeholder [--algo=<blurhash|thumbhash>] [--components=<XxY>] <исходный_файл>\n  bitmap placeholder [--algo=<blurhash|thumbhash>] --decode=<хеш> [--size=<ШxВ>] <выходной_файл>\n\nОписание:\n  Выводит компактную строку-заглушку для размытого предпросмотра, пока\n  изображение загружается: BlurHash (по умолчанию) или ThumbHash в base64.\n  Изображения больше 100x100 сначала уменьшаются.\n\n  С --decode заглушка вместо этого отрисовывается в файл изображения в формате,\n  определяемом именем файла. BlurHash отрисовывается размером 32x32, а ThumbHash\n  до 32 пикселей в собственных пропорциях, если не указан --size.\n\nОпции:\n  --algo=<blurhash|thumbhash>  алгоритм заглушки, по умолчанию blurhash\n  --components=<XxY>           число компонент BlurHash по горизонтали и вертикали, от 1 до 9, по умолчанию 4x3\n  --decode=<хеш>               отрисовать заглушку в <выходной_файл>\n  --size=<ШxВ>                 размер отрисованного изображения\n\nПримеры:\n  bitmap placeholder photo.bmp\n  bitmap placeholder --algo=thumbhash photo.bmp\n  bitmap placeholder --decode='LEHV6nWB2yk8pyo0adR*.7kCMdnj' preview.png",
+		"cmd.color.summary":              "выводит средний или акцентный цвет изображения как #rrggbb",
+		"usage.color":                    "использование: ./bitmap color [--mode=<average|vibrant|muted>] <исходный_файл>",
+		"help.color_body":                "Использование:\n  bitmap color [--mode=<average|vibrant|muted>] <исходный_файл>\n\nОписание:\n  Выводит один цвет изображения как #rrggbb для тем интерфейса:\n    average  среднее всех пикселей, смешанных в линейном свете, а не по значениям sRGB\n    vibrant  насыщенный акцентный цвет средней светлоты\n    muted    приглушенный акцентный цвет средней светлоты\n  Акценты выбираются среди групп похожих цветов по насыщенности, светлоте\n  и доле в изображении. Если ни одна группа не подходит, выводится ближайшая.\n  Для таблицы цветов индексированного изображения используйте команду palette.\n\nПримеры:\n  bitmap color photo.bmp\n  bitmap color --mode=vibrant photo.bmp",
+		"cmd.quality.summary":            "сообщает резкость, обрезку яркости, пустоту, шум и ступенчатость изображения",
+		"cmd.capabilities.summary":       "перечисляет форматы, глубины цвета, сжатия и операции, которые поддерживает эта сборка",
+		"cmd.provenance.summary":         "проверяет изображение по манифесту, который записала для него apply --provenance",
+		"cmd.pack-atlas.summary":         "упаковывает спрайты в одно изображение-атлас с JSON-файлом их положений",
+		"usage.pack_atlas":               "использование: ./bitmap pack-atlas [--max=<ШxВ>] [--padding=<n>] [--trim] [--algo=<maxrects|guillotine>] <файл_спрайта>... <файл_атласа> <файл_json>",
+		"help.pack_atlas_body":           "Использование:\n  bitmap pack-atlas [опции] <файл_спрайта>... <файл_атласа> <файл_json>\n\nОпции:\n  --max=<ШxВ>                      наибольший размер атласа, по умолчанию 2048x2048\n  --padding=<n>                    пустые пиксели между спрайтами, по умолчанию 0\n  --trim                           обрезать полностью прозрачные края каждого спрайта перед упаковкой\n  --algo=<maxrects|guillotine>     алгоритм упаковки, по умолчанию maxrects\n\nОписание:\n  Размещает все спрайты на одном изображении, начиная с больших, не поворачивая их,\n  и обрезает атлас до занятой области. У атласа есть альфа-канал, поэтому BMP получается\n  32-битным; формат определяется расширением <файла_атласа>. maxrects упаковывает плотнее,\n  guillotine проще и делит свободное место на меньшее число частей.\n  Файл JSON следует формату массива TexturePacker: для каждого спрайта frame — его место\n  в атласе, spriteSourceSize — сохраненная часть оригинала, чьи x и y — смещения для\n  восстановления обрезанного спрайта; sourceSize — исходный размер.\n\nПример:\n  bitmap pack-atlas --max=1024x1024 --padding=2 --trim sprites/*.bmp atlas.png atlas.json",
+		"cmd.cycle.summary":              "анимирует индексированное изображение, сдвигая цвета таблицы, и записывает GIF",
+		"usage.cycle":                    "использование: ./bitmap cycle [--range=<первый-последний>] [--fps=<n>] <исходный_файл> <файл_gif>",
+		"help.cycle_body":                "Использование:\n  bitmap cycle [опции] <исходный_файл> <файл_gif>\n\nОпции:\n  --range=<первый-последний>       сдвигаемые цвета таблицы, по умолчанию вся таблица\n  --fps=<n>                        кадров в секунду, по умолчанию 10\n\nОписание:\n  Имитирует циклическую смену палитры, прием анимации классических игр и демо: в каждом кадре\n  каждый цвет диапазона переходит на следующую позицию таблицы цветов, а последний — на первую,\n  так что пиксели с этими цветами словно текут. Исходное изображение должно быть\n  индексированным 1, 4 или 8-битным. Анимированный GIF содержит один полный оборот диапазона\n  и повторяется.\n\nПример:\n  bitmap cycle --range=16-31 --fps=10 waterfall.bmp waterfall.gif",
+		"usage.match_colors":             "использование: ./bitmap match-colors --reference=<эталонный_файл> [--method=<reinhard|histogram>] <исходный_файл> <выходной_файл>",
+		"help.match_colors_body":         "Использование:\n  bitmap match-colors [опции] <исходный_файл> <выходной_файл>\n\nОпции:\n  --reference=<файл>               BMP-изображение, цвета которого перенимает результат (обязательно)\n  --method=<reinhard|histogram>    способ переноса, по умолчанию reinhard\n\nОписание:\n  Перекрашивает исходное изображение под эталонное, например чтобы серия снимков\n  выглядела единообразно. reinhard приводит среднее и разброс каждого канала\n  цветового пространства lαβ к значениям эталона, перенося общий оттенок и контраст\n  без потери естественности. histogram перераспределяет уровни красного, зеленого\n  и синего так, чтобы каждый канал имел распределение эталона: совпадение точнее,\n  но сильно различающиеся изображения могут получить постеризацию. Альфа-канал\n  сохраняется, формат результата определяется расширением <выходной_файл>.\n\nПример:\n  bitmap match-colors --reference=first.bmp shot2.bmp shot2_matched.bmp",
+		"error.atlas_full":               "спрайт %s (%dx%d) не помещается в оставшееся место атласа %s",
+		"usage.quality":                  "использование: ./bitmap quality [--format=<text|json>] [--min-sharpness=<n>] [--max-clipped=<процент>] [--reject-blank] <исходный_файл>",
+		"quality.blurry":                 "резкость %.2f ниже %d",
+		"quality.clipped":                "%.2f%% пикселей обрезаны по яркости, больше %d%%",
+		"quality.blank":                  "изображение пустое",
+		"error.quality":                  "проверка качества не пройдена: %s",
+		"help.quality_body":              "Использование:\n  bitmap quality [--format=<text|json>] [--min-sharpness=<n>] [--max-clipped=<процент>] [--reject-blank] <исходный_файл>\n\nОписание:\n  Оценивает изображение по яркости и выводит:\n    sharpness       дисперсия лапласиана; у размытых и нерезких изображений она мала\n    clipped_dark    процент пикселей, провалившихся в черный\n    clipped_bright  процент пикселей, пересвеченных до белого\n    deviation       стандартное отклонение яркости, от 0 до 255\n    blank           true, если отклонение меньше 3, то есть изображение почти одного цвета\n    noise           оценка стандартного отклонения шума, от 0 до 255; помогает выбрать шумоподавление\n    banding         процент небольших перепадов яркости после ровных участков от 8 пикселей\n    banded          true, если banding больше 50%, то есть в градиентах видны ступени, которые скрыл бы дизеринг\n    grayscale       true, если красный, зеленый и синий равны в каждом пикселе\n    constant_channels  каналы с одинаковым значением во всех пикселях\n    transparent     процент полностью прозрачных пикселей, 0 для изображений без альфа-канала\n    alpha_bounds    область не полностью прозрачных пикселей как x-y-ширина-высота\n                    для --crop или none; --trim=alpha обрезает по ней\n  Изображения в оттенках серого и другие, где не больше 256 цветов, занимают втрое меньше места\n  или еще меньше, если записывать их с общим флагом --compact в виде индексированных BMP-файлов.\n  Если задан любой из порогов ниже, команда после вывода отчета завершается с ошибкой,\n  когда изображение им не соответствует, так что скрипты могут отбраковывать снимки по коду выхода.\n\nОпции:\n  --format=<text|json>      формат отчета, по умолчанию text\n  --min-sharpness=<n>       отклонять изображения с меньшей резкостью\n  --max-clipped=<процент>   отклонять изображения с большей долей обрезанных пикселей, темных и светлых вместе\n  --reject-blank            отклонять пустые изображения\n\nПримеры:\n  bitmap quality photo.bmp\n  bitmap quality --format=json --min-sharpness=100 --max-clipped=5 --reject-blank photo.bmp",
+		"usage.capabilities":             "использование: ./bitmap capabilities [--json] [--format=<text|json>]",
+		"help.capabilities_body":         "Использование:\n  bitmap capabilities [--json] [--format=<text|json>]\n\nОписание:\n  Перечисляет, что поддерживает эта сборка, чтобы скрипты и программы-обертки проверяли\n  возможность до ее использования, а не разбирали сообщения об ошибках:\n    go, build_tags      версия Go, платформа и теги, с которыми собрана программа\n    commands            команды, которые выполняет программа\n    source_formats      форматы исходных файлов, которые читают все команды\n    input_formats       форматы, которые читает convert\n    output_formats      форматы, которые записывают --format и расширения выходных файлов\n    header_sizes        размеры заголовков DIB, допустимые в строгом режиме\n    read_bit_depths     число бит на пиксель читаемых несжатых файлов\n    write_bit_depths    число бит на пиксель записываемых файлов; для 1, 4 и 8 нужен --compact\n    compressions        значения сжатия, читаются ли и записываются ли они и их глубины цвета\n    embed_formats       потоки, которые сохраняет --embed\n    operations          параметры apply\n    filters, color_spaces, blend_modes, colormaps  значения, которые принимают эти параметры\n    features            file_locking, remote_sources, remote_cache, unix_sockets и gpu_backend,\n                        true, если они есть на этой платформе и в этой сборке\n  Списки берутся из тех же таблиц, по которым проверяют команды, поэтому меняются\n  вместе со сборкой, а не с документацией.\n\nПараметры:\n  --json                вывести отчет в JSON, как --format=json\n  --format=<text|json>  формат отчета, по умолчанию text\n\nПримеры:\n  bitmap capabilities\n  bitmap capabilities --json | jq '.compressions[] | select(.write) | .name'",
+		"usage.provenance":               "использование: ./bitmap provenance verify [--provenance-key=<ключ>] [--source=<файл>] <файл_изображения> <файл_манифеста>",
+		"help.provenance_body":           "Использование:\n  bitmap provenance verify [--provenance-key=<ключ>] [--source=<файл>] <файл_изображения> <файл_манифеста>\n\nОписание:\n  Проверяет изображение по манифесту, который записала вместе с ним команда apply --provenance.\n  SHA-256 изображения должен совпадать с одним из перечисленных в манифесте выходных файлов,\n  под любым именем. Затем команда выводит выходной файл, исходный файл, опции, сборку и время\n  запуска и завершается ошибкой, если:\n    - изображение не совпадает ни с одним выходным файлом, так как его изменили или создали иначе\n    - задан --source, и это не записанный исходный файл\n    - задан ключ, и подпись не совпадает, например если манифест изменили\n    - задан ключ, а манифест не подписан\n  Подписанный манифест без ключа сверяется только по хешам, с предупреждением.\n\nПараметры:\n  --provenance-key=<ключ>  ключ, которым подписан манифест, или $BITMAP_PROVENANCE_KEY\n  --source=<файл>          также проверить, что исходный файл тот же, что записан\n\nПримеры:\n  bitmap apply --provenance=out.json --provenance-key=secret --filter=grayscale in.bmp out.bmp\n  bitmap provenance verify --provenance-key=secret --source=in.bmp out.bmp out.json",
+		"error.provenance_manifest":      "неверный манифест %s: %v",
+		"error.provenance_version":       "у манифеста %s версия %d, а эта сборка читает версию %d",
+		"error.provenance_output":        "%s не совпадает ни с одним выходным файлом из %s",
+		"error.provenance_source":        "%s не является исходным файлом, записанным в %s",
+		"error.provenance_signature":     "подпись %s не совпадает: манифест изменен или подписан другим ключом",
+		"error.provenance_unsigned":      "%s не подписан",
+		"warning.provenance_unchecked":   "подпись %s не проверена: не задан --provenance-key",
+		"info.provenance_written":        "манифест происхождения записан в %s",
+		"usage.compare":                  "использование: ./bitmap compare [--format=<text|json>] [--diff=<файл>] [--min-psnr=<дБ>] [--metric=<имя>[:<оценка>]] <первый_файл> <второй_файл>",
+		"usage.histogram":                "использование: ./bitmap histogram [--format=<text|json>] [--bins=<n>] [--output=<файл>] <исходный_файл>",
+		"help.compare_body":              "Использование:\n  bitmap compare [опции] <первый_файл> <второй_файл>\n\nОпции:\n  --format=<text|json>    формат вывода, по умолчанию text\n  --diff=<файл>           записывает изображение различий: измененные пиксели красные, тем ярче,\n                          чем сильнее изменение, поверх бледной серой копии первого изображения\n  --min-psnr=<дБ>         принимает различающиеся изображения, если их PSNR не ниже указанного\n  --metric=<имя>[:<n>]    также измеряет перцептивную метрику, а с оценкой принимает различающиеся\n                          изображения, если они ее достигают; можно указать несколько раз:\n                            ssim              структурное сходство яркости, 1 для изображений,\n                                              которые выглядят одинаково, тем меньше, чем сильнее\n                                              они различаются\n                            butteraugli-lite  расстояние в едва заметных шагах, 0 для изображений,\n                                              которые выглядят одинаково, около 1 для едва\n                                              различимой разницы; сильно упрощенный вариант\n                                              Butteraugli, который замечает и сдвиги цвета\n\nОписание:\n  Попиксельно сравнивает два изображения одного размера для регрессионных тестов. Выводит,\n  совпадают ли они, сколько пикселей различается, среднюю абсолютную ошибку каждого канала\n  из 255 и PSNR, равный inf для одинаковых изображений. Изображения без альфа-канала\n  считаются непрозрачными; перцептивные метрики альфа-канал не учитывают. Если заданы\n  пороги, различающиеся изображения совпадают, только когда выполнены все. Завершается с кодом 1, если изображения не совпадают, чтобы\n  скрипты могли проверить результат. На вход подходят BMP, PNG, JPEG и текст команды dump.\n\nПримеры:\n  bitmap compare expected.bmp actual.bmp\n  bitmap compare --diff=diff.png --min-psnr=40 expected.bmp actual.bmp\n  bitmap compare --metric=ssim --metric=butteraugli-lite:1.5 original.bmp encoded.png",
+		"cmd.fit.summary":                "подбирает значения тоновых опций, при которых изображение больше всего похоже на эталон",
+		"usage.fit":                      "использование: ./bitmap fit --target=<эталон> --op=<опция>[,<опция>...] [--metric=<psnr|butteraugli-lite|ssim>] [--format=<text|json>] [--output=<файл>] <исходный_файл>",
+		"help.fit_body":                  "Использование:\n  bitmap fit --target=<эталон> --op=<опция>[,<опция>...] [опции] <исходный_файл>\n\nОпции:\n  --target=<файл>         эталонное изображение, на которое должен походить исходный файл\n  --op=<опции>            подбираемые опции, применяются в указанном порядке: brightness,\n                          contrast и saturation от -100 до 100, gamma от 0.2 до 5\n  --metric=<имя>          что считать сходством: psnr, по умолчанию, ssim или\n                          butteraugli-lite, как их измеряет compare\n  --format=<text|json>    формат вывода, по умолчанию text\n  --output=<файл>         также записывает исходный файл с найденными значениями\n\nОписание:\n  Подбирает значения опций, при которых исходное изображение больше всего похоже на\n  эталон, например снимок тестовой таблицы камерой или сканером на саму таблицу, и\n  выводит их как опции apply вместе с оценкой до и после. Каждая опция по очереди\n  перебирается по всему диапазону, а затем уточняется, в несколько проходов. Поиск\n  идет на копиях не больше 384 пикселей по стороне; эталон масштабируется до размера\n  исходного файла, и соотношение сторон у них должно совпадать.\n\nПримеры:\n  bitmap fit --target=chart.bmp --op=brightness,contrast,gamma capture.bmp\n  bitmap fit --target=chart.png --op=gamma,saturation --metric=butteraugli-lite --output=fixed.bmp capture.bmp\n  bitmap apply --brightness=6 --contrast=-12 --gamma=1.18 capture2.bmp fixed2.bmp",
+		"help.histogram_body":            "Использование:\n  bitmap histogram [опции] <исходный_файл>\n\nОпции:\n  --format=<text|json>    формат вывода, по умолчанию text\n  --bins=<n>              число столбцов на канал в текстовой диаграмме: 1, 2, 4 и так далее\n                          до 256, по умолчанию 16\n  --output=<файл>         также рисует гистограммы в изображение, по диаграмме 256x64 на канал\n\nОписание:\n  Подсчитывает уровни красного, зеленого и синего каналов и яркости и выводит каждый\n  в виде столбчатой диаграммы со средним и медианой, а затем доли пикселей, обрезанных\n  до черного и до белого. Вывод JSON содержит число пикселей каждого уровня от 0 до 255,\n  чтобы скрипты могли искать пере- и недоэкспонированные изображения, например в цикле\n  по папке сканов.\n\nПримеры:\n  bitmap histogram scan.bmp\n  bitmap histogram --format=json scan.bmp\n  bitmap histogram --bins=64 --output=histogram.png scan.bmp",
+		"cmd.detect-lines.summary":       "сообщает преобладающие прямые линии и прямоугольник страницы, которые они образуют",
+		"usage.detect_lines":             "использование: ./bitmap detect-lines [--format=<text|json>] [--json] [--lines=<n>] [--min-length=<n>] <исходный_файл>",
+		"help.detect_lines_body":         "Использование:\n  bitmap detect-lines [опции] <исходный_файл>\n\nОпции:\n  --format=<text|json>    формат вывода, по умолчанию text\n  --json                  то же, что --format=json\n  --lines=<n>             сколько линий выводить самое большее, по умолчанию 10\n  --min-length=<n>        длина самой короткой выводимой линии в пикселях, по умолчанию\n                          восьмая часть меньшей стороны изображения\n\nОписание:\n  Находит преобладающие прямые линии изображения, например края страницы, экрана или доски,\n  сфотографированных на столе, преобразованием Хафа его границ и выводит каждую как отрезок\n  с углом и длиной, начиная с самой длинной. Из примерно горизонтальных и примерно\n  вертикальных линий четыре, образующие самый большой четырехугольник, вдоль сторон которого\n  они больше всего идут, выводятся как прямоугольник страницы: его углы, начиная с левого\n  верхнего, наклон, значение --rotate, выравнивающее его, и значение --crop его\n  ограничивающей рамки. Координаты даны в пикселях от левого верхнего угла изображения,\n  углы — в градусах по часовой стрелке от горизонтали; в выводе JSON прямоугольник равен\n  null, когда линии его не образуют.\n\nПримеры:\n  bitmap detect-lines photo.bmp\n  bitmap detect-lines --json photo.bmp\n  bitmap apply --rotate=$(bitmap detect-lines --json photo.bmp | jq -r .rectangle.rotate) photo.bmp level.bmp",
+		"cmd.testcard.summary":           "рисует тестовые карты для калибровки дисплеев и принтеров и измеряет сфотографированные",
+		"usage.testcard":                 "использование: ./bitmap testcard [--type=<gray-steps|gamma|convergence>] [--size=<ШxВ>] [--steps=<n>] <выходной_файл> | --analyze [--steps=<n>] [--format=<text|json>] <файл_фотографии>",
+		"help.testcard_body":             "Использование:\n  bitmap testcard [опции] <выходной_файл>\n  bitmap testcard --analyze [опции] <файл_фотографии>\n\nОпции:\n  --type=<gray-steps|gamma|convergence>\n                          рисуемая карта, по умолчанию gray-steps:\n                            gray-steps   полосы от черного слева до белого справа\n                            gamma        серые квадраты на черных и белых линиях, подписанные\n                                         гаммами от 1.8 до 2.6\n                            convergence  белая сетка на черном с точками и окружностью\n  --size=<ШxВ>            размер карты, по умолчанию 1920x1080\n  --steps=<n>             полос на карте gray-steps, от 2 до 256, по умолчанию 11\n  --analyze               измеряет фотографию карты gray-steps вместо рисования карты\n  --format=<text|json>    формат вывода --analyze, по умолчанию text\n\nОписание:\n  Рисует тестовые карты для калибровки дисплеев, проекторов и принтеров. На карте gamma\n  линии издалека сливаются в серый с половиной света белого; квадрат, совпадающий с ним,\n  подписан гаммой дисплея. На карте convergence дисплеи с несведением показывают цветные\n  каймы вдоль линий, а ошибки геометрии их изгибают.\n\n  --analyze читает фотографию или скан показанной или напечатанной карты gray-steps в любом\n  формате, который читает convert, обрезанные по карте, например значением crop из\n  detect-lines; --steps должен совпадать с картой. Выводит среднюю яркость и шум середины\n  каждой ступени, какие ступени отличимы от предыдущей, сколько темных ступеней сливаются\n  с черным, а светлых — с белым, и гамму степенной кривой, описывающей отклик: 1, когда\n  средние тона выходят как на карте, больше 1, когда темнее.\n\nПримеры:\n  bitmap testcard --type=gamma gamma.bmp\n  bitmap testcard --steps=21 --size=3840x2160 steps.bmp\n  bitmap testcard --analyze --steps=21 --format=json photo.jpg",
+		"cmd.frames.summary":             "записывает кадры несжатого видео Y4M или AVI как файлы BMP",
+		"usage.frames":                   "использование: ./bitmap frames [--every=<n>] [--start=<n>] [--max=<n>] [--prune-similar=<расстояние>] <видеофайл> <выходной_каталог>",
+		"help.frames_body":               "Использование:\n  bitmap frames [опции] <видеофайл> <выходной_каталог>\n\nОпции:\n  --every=<n>             записывает каждый n-й кадр, по умолчанию 1\n  --start=<n>             номер первого записываемого кадра, считая с 1, по умолчанию 1\n  --max=<n>               останавливается после записи n кадров; 0, по умолчанию, записывает все\n  --prune-similar=<d>     пропускает кадры, гистограммы цветов которых отстоят от гистограмм\n                          последнего записанного кадра меньше чем на d, от 0 до 1, например\n                          неподвижные планы записи экрана; 0.05 отбрасывает немногим больше шума\n\nОписание:\n  Записывает кадры несжатого видео как файлы BMP с именами frame_000001.bmp и так далее по\n  их номерам в видео, создавая каталог при необходимости, чтобы batch и другие команды могли\n  обработать их без ffmpeg. Читаются потоки YUV4MPEG2 (.y4m) с цветностью 4:2:0, 4:2:2,\n  4:1:1 или 4:4:4 или только с яркостью, от 8 до 16 бит, и файлы AVI, видео которых хранится\n  как несжатые DIB или как YUY2, UYVY, I420, YV12, NV12 или Y800; для сжатого видео нужен\n  ffmpeg. YUV преобразуется по матрице BT.601 как студийное видео, если поток Y4M не\n  указывает полный диапазон. Видео читается от начала до конца, поэтому его можно подать\n  со стандартного ввода как -.\n\nПримеры:\n  bitmap frames video.y4m frames/\n  bitmap frames --every=30 --max=100 capture.avi frames/\n  bitmap frames --prune-similar=0.1 screencast.avi frames/\n  bitmap batch --filter=grayscale frames/ gray/",
+		"usage.caption":                  "использование: ./bitmap caption [--top=<текст>] [--bottom=<текст>] [--bar] [--scale=<n>] [--color=<#rrggbb>] [--bar-color=<#rrggbb>] <исходный_файл> <выходной_файл>",
+		"help.caption_body":              "Использование:\n  bitmap caption [опции] <исходный_файл> <выходной_файл>\n\nОпции:\n  --top=<текст>             текст вдоль верхнего края изображения\n  --bottom=<текст>          текст вдоль нижнего края изображения; нужен хотя бы один из двух\n  --bar                     размещает текст на полосах, добавленных над и под изображением,\n                            а не поверх него\n  --scale=<n>               размер букв, n пикселей на пиксель шрифта 5x7; 0, по умолчанию,\n                            делает их высотой около десятой части изображения\n  --color=<#rrggbb>         цвет текста, по умолчанию белый поверх изображения и черный на полосах\n  --bar-color=<#rrggbb>     цвет полос, по умолчанию белый\n\nОписание:\n  Подписывает изображение в стиле мемов: строки текста по центру, перенесенные между\n  словами по ширине. Поверх изображения буквы получают черный контур, а темный текст —\n  белый, чтобы их можно было прочесть на любом фоне. С --bar холст увеличивается на\n  полосу для каждой заданной подписи, а само изображение остается открытым. Встроенный\n  шрифт содержит печатные символы ASCII; остальные символы рисуются вопросительными\n  знаками. Формат результата определяется расширением <выходной_файл>.\n\nПримеры:\n  bitmap caption --top=\"ONE DOES NOT SIMPLY\" --bottom=\"DECODE A BMP\" cat.bmp meme.bmp\n  bitmap caption --bottom=\"Figure 1: sample\" --bar --scale=2 chart.bmp figure.png",
+		"usage.thumbs":                   "использование: ./bitmap thumbs [--cols=<n>] [--cell=<ШxВ>] [--padding=<n>] [--labels] [--sheet-color=<#rrggbb>] <каталог> <выходной_файл>",
+		"help.thumbs_body":               "Использование:\n  bitmap thumbs [опции] <каталог> <выходной_файл>\n\nОпции:\n  --cols=<n>                 миниатюр в строке, по умолчанию 6\n  --cell=<ШxВ>               рамка, в которую уменьшается каждая миниатюра, по умолчанию 160x120\n  --padding=<n>              пикселей между ячейками и по краям листа, по умолчанию 8\n  --labels                   подписывает имя файла под каждой миниатюрой\n  --sheet-color=<#rrggbb>    цвет листа, по умолчанию белый\n\nОписание:\n  Составляет контрольный лист из файлов .bmp в <каталог> в порядке имен, чтобы быстро\n  просмотреть пакет сканов. Каждое изображение уменьшается с сохранением пропорций\n  и располагается по центру своей ячейки; изображения меньше ячейки сохраняют размер.\n  Прозрачные пиксели показывают фон. Подписи используют встроенный шрифт 5x7 и\n  сокращаются многоточием, если имя шире ячейки. Нечитаемые файлы пропускаются\n  с предупреждением. Формат результата определяется расширением <выходной_файл>.\n\nПримеры:\n  bitmap thumbs scans sheet.bmp\n  bitmap thumbs --cols=4 --cell=240x180 --labels scans/batch7 batch7.png",
+		"cmd.extract-thumb.summary":      "извлекает JPEG-превью, встроенное в RAW-файл камеры",
+		"usage.extract_thumb":            "использование: ./bitmap extract-thumb <raw_файл> <выходной_файл>",
+		"help.extract_thumb_body":        "Использование:\n  bitmap extract-thumb <raw_файл> <выходной_файл>\n\nОписание:\n  Записывает самое большое JPEG-превью, которое камера встраивает в RAW-файлы,\n  повернутое по ориентации EXIF, не проявляя данные сенсора, — быстрый способ\n  просмотреть каталог RAW-снимков. В файлах на основе TIFF (CR2, NEF, ARW, DNG, PEF,\n  ORF, RW2 и большинстве других) превью перечислены; в других контейнерах, например\n  CR3 и RAF, ищутся потоки JPEG. Формат результата определяется расширением\n  <выходной_файл>.\n\nПримеры:\n  bitmap extract-thumb IMG_0042.CR2 IMG_0042.bmp\n  for f in *.NEF; do bitmap extract-thumb \"$f\" \"${f%.NEF}.bmp\"; done && bitmap thumbs . sheet.bmp",
+		"usage.beforeafter":              "использование: ./bitmap beforeafter [--layout=<side|split>] [--position=<процент>] [--gap=<n>] [--labels] <файл_до> <файл_после> <выходной_файл>",
+		"help.beforeafter_body":          "Использование:\n  bitmap beforeafter [опции] <файл_до> <файл_после> <выходной_файл>\n\nОпции:\n  --layout=<side|split>     side ставит изображения рядом, split показывает левую часть первого\n                            и остальное от второго; по умолчанию side\n  --position=<процент>      где split сменяет изображения, в процентах ширины, по умолчанию 50\n  --gap=<n>                 пикселей белого между изображениями рядом, по умолчанию 8\n  --labels                  подписывает изображения BEFORE и AFTER в верхних углах\n\nОписание:\n  Составляет одно изображение, показывающее, что делает обработка. Рядом ставятся\n  изображения любого размера, выровненные по верху на белом фоне. split требует\n  изображений одного размера и рисует белую линию на их стыке, как ручку ползунка\n  сравнения. Формат результата определяется расширением <выходной_файл>.\n\nПримеры:\n  bitmap apply --filter=sharpen photo.bmp sharp.bmp\n  bitmap beforeafter --labels photo.bmp sharp.bmp compare.png\n  bitmap beforeafter --layout=split --position=40 photo.bmp sharp.bmp slider.bmp",
+		"cmd.stack.summary":              "складывает кадры одного размера в одно изображение, как длинная выдержка",
+		"usage.stack":                    "использование: ./bitmap stack [--method=<mean|weighted|max|min>] [--weights=<flat|gauss[,ширина]|ramp|в1,в2,...>] <файл_кадра>... <выходной_файл>",
+		"help.stack_body":                "Использование:\n  bitmap stack [опции] <файл_кадра>... <выходной_файл>\n\nОпции:\n  --method=<имя>                как складываются кадры, по умолчанию mean:\n                                mean      среднее всех кадров\n                                weighted  среднее кадров с весами --weights\n                                max       самый светлый уровень каждого канала, как для треков звезд\n                                min       самый темный уровень каждого канала\n  --weights=<форма>             вес каждого кадра для weighted, по умолчанию gauss:\n                                flat      одинаковый для всех кадров, как mean\n                                gauss     колокол с центром на среднем кадре шириной в четверть\n                                          кадров или в заданное после запятой число кадров\n                                ramp      равномерно растет к последнему кадру, так что движущиеся\n                                          предметы оставляют следы, гаснущие к началу движения\n                                в1,в2,... по весу на кадр в порядке перечисления\n\nОписание:\n  Имитирует длинную выдержку по последовательности кадров одного размера, например\n  записанных командой frames из видео: средние берутся в линейном свете, как его\n  накапливает матрица, поэтому неподвижное остается резким, а движущееся размывается,\n  как при медленном затворе. Веса задают форму выдержки во времени, для gauss — как\n  у затвора, который открывается и закрывается плавно. Кадры с альфа-каналом\n  учитываются там, где они непрозрачны. Кадры читаются по одному, поэтому\n  последовательности любой длины помещаются в памяти, а формат результата\n  определяется расширением <выходной_файл>.\n\nПримеры:\n  bitmap frames clip.y4m frames\n  bitmap stack --method=weighted --weights=gauss frames/*.bmp exposure.bmp\n  bitmap stack --method=weighted --weights=1,2,4,8 f1.bmp f2.bmp f3.bmp f4.bmp trail.bmp\n  bitmap stack --method=max sky_*.bmp trails.bmp",
+		"usage.shell":                    "использование: ./bitmap shell <исходный_файл>",
+		"help.shell_body":                "Использование:\n  bitmap shell <исходный_файл>\n\nОписание:\n  Загружает изображение один раз и читает команды из стандартного ввода, по одной на\n  строку, применяя каждую опцию к изображению в памяти. Так можно пробовать цепочки\n  опций на больших файлах, не декодируя и не кодируя файл на каждом шаге. Отменить\n  можно до 31 шага; более ранние остаются в истории. Команды можно передать из файла;\n  приглашение выводится только при вводе с клавиатуры, строки с # пропускаются.\n\nКоманды:\n  <опция> <значение>   применяет опцию apply, например filter grayscale или rotate 90; формы\n                       --filter=grayscale и -m h команды apply тоже работают\n  undo, redo           шаг назад и вперед по результатам\n  history              перечисляет шаги и выводит команду apply, которая их повторяет\n  preview [<файл>]     записывает текущее изображение для просмотра, по умолчанию\n                       в bitmap-preview.png во временном каталоге\n  save <файл>          записывает текущее изображение; формат определяется расширением\n  help                 показывает этот список\n  quit, exit           завершает сеанс, как и конец ввода\n\nПример:\n  bitmap shell scan.bmp\n  bitmap> filter grayscale\n  bitmap> rotate 90\n  bitmap> undo\n  bitmap> save scan_gray.bmp",
+		"usage.pick":                     "использование: ./bitmap pick [--option=<crop|pixelate>] <исходный_файл>",
+		"cmd.pick.summary":               "показывает изображение в терминале и выводит --crop области, выбранной клавишами",
+		"help.pick_body":                 "Использование:\n  bitmap pick [--option=<crop|pixelate>] <исходный_файл>\n\nОпции:\n  --option=<crop|pixelate>      опция apply, в виде которой выводится выделение, по умолчанию crop\n\nКлавиши:\n  стрелки, h j k l              перемещают выделение\n  Shift+стрелки, H J K L        меняют его размер от правого нижнего угла: вправо и вниз\n                                расширяют и удлиняют, влево и вверх сужают и укорачивают\n  Enter                         выводит выделение и завершает работу\n  q, Esc, Ctrl-C                завершают работу без вывода\n\nОписание:\n  Показывает изображение в терминале, по два пикселя на знакоместо в полном цвете,\n  затемняя все вне выделения, и выводит выделение как опцию apply, например\n  --crop=120-80-640-480, в пикселях изображения от левого верхнего угла, чтобы вставить\n  ее в конвейер. Клавиши перемещают и меняют выделение на пиксель предпросмотра, то есть\n  на несколько пикселей большого изображения. Предпросмотр рисуется в стандартный поток\n  ошибок, поэтому $(bitmap pick photo.bmp) получает только опцию. Нужен терминал на\n  стандартном вводе и в стандартном потоке ошибок.\n\nПример:\n  bitmap apply $(bitmap pick photo.bmp) photo.bmp cropped.bmp",
+		"help.shell_commands":            "Команды:\n  <опция> <значение>   применяет опцию apply, например filter grayscale или rotate 90; формы\n                       --filter=grayscale и -m h команды apply тоже работают\n  undo, redo           шаг назад и вперед по результатам\n  history              перечисляет шаги и выводит команду apply, которая их повторяет\n  preview [<файл>]     записывает текущее изображение для просмотра, по умолчанию\n                       в bitmap-preview.png во временном каталоге\n  save <файл>          записывает текущее изображение; формат определяется расширением\n  help                 показывает этот список\n  quit, exit           завершает сеанс, как и конец ввода",
+		"usage.selftest":                 "использование: ./bitmap selftest",
+		"help.selftest_body":             "Использование:\n  bitmap selftest\n\nОписание:\n  Проверяет, что эта сборка читает, записывает и обрабатывает изображения точно так же, как\n  эталонная, прежде чем доверять ей пакетную обработку на новой платформе, компиляторе или\n  процессоре. Небольшие тестовые изображения, создаваемые в памяти, записываются как 1, 4, 24\n  и 32-битные файлы и читаются обратно, встроенный файл со сжатием RLE декодируется, а каждая опция\n  apply применяется к тестовым изображениям. Каждый результат сравнивается с контрольной суммой\n  CRC-32 эталонного результата, а каждая опция также выполняется в одной горутине, и результат\n  должен совпасть с разбиением строк по --jobs. Каждая проверка выводит одну строку; если какие-то\n  не совпали, команда завершается ошибкой с их числом.\n\nПример:\n  bitmap selftest",
+		"cmd.triage.summary":             "называет правило формата, которое нарушает поврежденный файл, и сокращает его до минимального воспроизведения",
+		"usage.triage":                   "использование: ./bitmap triage [--output=<файл>] [--format=<text|json>] <входной_файл>",
+		"help.triage_body":               "Использование:\n  bitmap triage [опции] <входной_файл>\n\nОпции:\n  --output=<файл>         файл воспроизведения, по умолчанию <имя>.min.bmp рядом с входным;\n                          обязателен, если входной файл подается со стандартного ввода\n  --format=<text|json>    формат отчета, по умолчанию text\n\nОписание:\n  Декодирует файл, найденный фаззингом или пользователем, в режиме, выбранном --strict\n  или --permissive, и называет правило формата, которое он нарушает: ключ сообщения\n  декодера, его вид (not_bmp, invalid, unsupported, limit) и то, на чем произошел сбой,\n  на заголовках или на пикселях. Паника декодера сообщается с функцией, в которой она\n  произошла. Затем файл сокращается, пока он дает тот же сбой, сначала до кратчайшего\n  такого начала, найденного делением пополам, затем удалением участков вдвое меньшей\n  длины, и результат записывается как файл воспроизведения. В отчете указаны формат\n  пикселей из заголовков и сколько байтов каждой части файла, от заголовков и таблицы\n  цветов до строк пикселей, осталось в файле воспроизведения. О файле, который\n  декодируется, так и сообщается, и файл воспроизведения не записывается.\n\nПримеры:\n  bitmap triage crash-input.bmp\n  bitmap --strict triage --format=json --output=repro.bmp crash-input.bmp",
+		"help.explain_body":              "Использование:\n  bitmap explain --<опция>[=<значение>]\n\nОписание:\n  Выводит параметры, диапазоны, значения по умолчанию и пояснения опции apply,\n  а затем ASCII-рисунки встроенного образца до и после ее применения.\n  Без значения показывается первый пример опции.\n\nПримеры:\n  bitmap explain --filter=blur\n  bitmap explain --rotate",
+		"cmd.palette.summary":            "выводит, заменяет или сортирует таблицу цветов индексированного изображения",
+		"usage.palette":                  "использование: ./bitmap palette show <исходный_файл>\n               ./bitmap palette replace <исходный_файл> <файл_цветов> <выходной_файл>\n               ./bitmap palette sort <исходный_файл> <выходной_файл>",
+		"error.not_indexed":              "у %s нет таблицы цветов (она есть только у 1, 4 и 8-битных изображений)",
+		"error.cycle_range":              "диапазон цветов %d-%d не помещается в таблицу из %d цветов",
+		"error.read_palette":             "ошибка чтения таблицы цветов: %v",
+		"error.write_palette":            "ошибка записи таблицы цветов: %v",
+		"error.palette_line":             "%s:%d: ожидается \"<номер> #rrggbb\"",
+		"error.palette_index":            "номер цвета %s вне диапазона, в таблице %d цветов",
+		"error.invalid_color":            "недопустимый цвет: %s (ожидается rrggbb или #rrggbb)",
+		"error.read_file":                "ошибка чтения файла: %v",
+		"help.palette_body":              "Использование:\n  bitmap palette show <исходный_файл>\n  bitmap palette replace <исходный_файл> <файл_цветов> <выходной_файл>\n  bitmap palette sort <исходный_файл> <выходной_файл>\n\nОписание:\n  Работает с таблицей цветов 1, 4 и 8-битных изображений.\n  show     выводит по строке \"<номер> #rrggbb\" на каждый цвет\n  replace  задает цвета, перечисленные в файле_цветов в формате вывода show\n  sort     упорядочивает цвета от темных к светлым и перенумеровывает пиксели\n\n  apply сохраняет таблицу цветов, пока все цвета результата есть в ней.",
+		"usage.channels":                 "использование: ./bitmap channels split <исходный_файл> <файл_красного> <файл_зеленого> <файл_синего> [<файл_альфы>]\n               ./bitmap channels merge <файл_красного> <файл_зеленого> <файл_синего> [<файл_альфы>] <выходной_файл>",
+		"help.channels_body":             "Использование:\n  bitmap channels split <исходный_файл> <файл_красного> <файл_зеленого> <файл_синего> [<файл_альфы>]\n  bitmap channels merge <файл_красного> <файл_зеленого> <файл_синего> [<файл_альфы>] <выходной_файл>\n\nОписание:\n  Хранит каналы с независимыми данными, например маски или карты высот,\n  в отдельных файлах.\n  split  записывает каждый канал как изображение в оттенках серого; у изображений\n         без альфа-канала файл альфы белый, так как они непрозрачны\n  merge  собирает изображение из серых файлов каналов одного размера, с альфа-каналом,\n         если указан файл альфы; цветные изображения дают свою яркость\n  Форматы результатов определяются расширениями файлов.\n\nПримеры:\n  bitmap channels split sprite.bmp r.bmp g.bmp b.bmp a.bmp\n  bitmap channels merge r.bmp g.bmp b.bmp mask.bmp sprite.bmp",
+		"cmd.split.summary":              "делит изображение на файлы горизонтальных полос по заданному числу строк или скан книги на страницы",
+		"usage.split":                    "использование: ./bitmap split [--rows=<n>] [--split-pages] <исходный_файл> <шаблон>",
+		"help.split_body":                "Использование:\n  bitmap split [--rows=<n>] [--split-pages] <исходный_файл> <шаблон>\n\nОпции:\n  --rows=<n>                       строк в каждой полосе, по умолчанию 1024; в последней остаток\n  --split-pages                    делит скан разворота книги на левую и правую страницы,\n                                   с номерами 1 и 2\n\nОписание:\n  Делит изображение на горизонтальные полосы, например чтобы передать его в обход\n  ограничения на размер файла, и записывает каждую в файл по шаблону — имени файла с\n  одним целочисленным спецификатором для номера полосы: part_%02d.bmp записывает\n  part_01.bmp, part_02.bmp и так далее сверху вниз. Дополняйте номер до стольких цифр,\n  сколько их в числе полос, чтобы шаблон оболочки перечислял файлы по порядку. Полосы\n  индексированного изображения сохраняют его таблицу цветов, а форматы определяются\n  расширениями файлов.\n\n  --split-pages находит корешок скана книги — самую широкую полосу без текста,\n  пустую или в тени переплета, в средней трети ширины — и делит страницы по ее\n  середине. Темная рамка, которую оставляет крышка сканера вокруг книги, и тень\n  переплета — строки и столбцы, не меньше чем наполовину покрытые краской, —\n  обрезаются с краев каждой страницы.\n\nПримеры:\n  bitmap split --rows=1024 huge.bmp part_%02d.bmp\n  bitmap split --split-pages spread_012.bmp page_012_%d.bmp",
+		"cmd.join.summary":               "собирает файлы полос, записанные split, обратно в одно изображение",
+		"usage.join":                     "использование: ./bitmap join <файл_полосы>... <выходной_файл>",
+		"help.join_body":                 "Использование:\n  bitmap join <файл_полосы>... <выходной_файл>\n\nОписание:\n  Складывает полосы одной ширины, перечисленные сверху вниз, в одно изображение,\n  отменяя split без потерь: compare сообщает, что результат попиксельно совпадает с\n  разделенным изображением. Полосы с общей таблицей цветов собираются в\n  индексированное изображение с ней, альфа-канал сохраняется, если он есть хотя бы\n  у одной полосы, а формат результата определяется расширением <выходной_файл>.\n\nПример:\n  bitmap join part_*.bmp huge.bmp",
+		"error.read_array":               "ошибка чтения заголовка массива изображений по смещению %d: %v",
+		"error.array_entry":              "у элемента массива изображений по смещению %d нет заголовка BA",
+		"error.array_loop":               "элемент массива изображений по смещению %d ссылается назад на смещение %d",
+		"error.image_index":              "номер изображения %d вне диапазона, в файле изображений: %d",
+		"error.offset_beyond":            "смещение пиксельных данных %d выходит за конец файла размером %d байт",
+		"error.pixel_data_size":          "пиксельным данным нужно %d байт, но после смещения пиксельных данных есть только %d",
+		"error.pixel_data_bound":         "в заголовках заявлено %d пикселей, больше %d, которые можно получить из %d байт пиксельных данных",
+		"warning.prefix":                 "Предупреждение:",
+		"warning.thumb_skipped":          "пропуск %s: %v",
+		"warning.strip_transparent":      "%s полностью прозрачен и будет прочитан как непрозрачный, так как BMP-читатели считают нулевую альфу неиспользуемой; выберите --rows так, чтобы в каждой полосе был видимый пиксель",
+		"warning.estimate_memory":        "по оценке опциям нужно %s памяти для изображения %dx%d, больше --warn-memory=%s",
+		"warning.estimate_time":          "по оценке опции займут %v для изображения %dx%d, больше --warn-time=%v",
+		"warning.estimate_stream":        "--stream выполняет эти опции построчно в памяти, которая не растет с изображением",
+		"warning.estimate_tiles":         "--max-memory=%s выполняет эти опции по тайлам, не занимая больше памяти",
+		"warning.unreadable_name":        "пропуск %s: имя содержит символы, которые Windows не может передать, переименуйте файл для обработки",
+		"warning.cache_store":            "не удалось сохранить %s в кэше: %v",
+		"warning.gpu_fallback":           "--backend=gpu: %v; работа выполняется на процессоре",
+		"warning.nice":                   "--nice: не удалось понизить приоритет: %v",
+		"error.isolate_start":            "--isolate: не удалось запустить процесс декодирования: %v",
+		"error.isolate_crash":            "--isolate: сбой процесса декодирования: %s",
+		"error.isolate_request":          "процесс декодирования не получил запроса; его запускает --isolate",
+		"error.isolate_confine":          "процесс декодирования не смог отказаться от привилегий: %v",
+		"warning.gpu_failed":             "ядро GPU %s завершилось с ошибкой OpenCL %d; работа выполняется на процессоре",
+		"warning.checkpoint_partial":     "%s отсутствует или короче, чем записано в %s, обработка начинается заново",
+		"warning.checkpoint_stale":       "%s относится к другому источнику, опциям или результату, обработка начинается заново",
+		"warning.cache_download":         "не удалось получить %s из удаленного кэша: %v",
+		"warning.cache_upload":           "не удалось загрузить %s в удаленный кэш: %v",
+		"format.file_size":               "в заголовке указан размер файла %d байт, фактический — %d",
+		"format.image_size":              "в заголовке указан размер изображения %d байт, пиксельным данным нужно %d",
+		"format.palette":                 "в заголовке объявлено %d цветов палитры для изображения без палитры",
+		"format.reserved":                "зарезервированное поле заголовка равно %d вместо 0",
+		"format.dib_size":                "неизвестный размер заголовка DIB: %d",
+		"format.planes":                  "в заголовке объявлено %d цветовых плоскостей вместо 1",
+		"format.offset":                  "смещение пиксельных данных %d указывает внутрь заголовков",
+		"format.signature":               "файл начинается с %q вместо BM",
+		"format.truncated":               "пиксельные данные обрезаны, %d строк отсутствуют и остаются черными",
+		"format.stream_size":             "в заголовке указан размер изображения %d байт, после смещения пиксельных данных их %d",
+		"format.trust_headers":           "%v; чтение по заголовкам",
+		"format.trust_data":              "%v; чтение по содержимому файла",
+		"error.limit_file_size":          "размер файла %d превышает ограничение в %d байт",
+		"error.limit_width":              "ширина изображения %d превышает ограничение %d",
+		"error.limit_height":             "высота изображения %d превышает ограничение %d",
+		"error.limit_pixels":             "в изображении %d пикселей, больше ограничения %d",
+		"error.selftest_failed":          "%d из %d проверок самотестирования не пройдены на %s: эта сборка не дает эталонных результатов",
+		"error.selftest_roundtrip":       "декодирование записанного файла не возвращает исходные пиксели",
+		"help.header_body":               "Использование:\n  bitmap header [--format=<text|json|yaml>] <исходный_файл>\n\nОпции:\n  --format=<text|json|yaml>    формат вывода (по умолчанию text); json и yaml содержат\n                               все поля заголовков, а также длину строки, выравнивание\n                               строки, размер пиксельных данных и размер палитры\n\nОписание:\n  Выводит информацию из заголовков bitmap-файла. Для V5-файлов со встроенным ICC-профилем\n  выводит также его версию, класс устройства, цветовое пространство и описание; apply\n  сохраняет профиль в BMP-результатах. <исходный_файл> - читает файл из стандартного ввода.\n  Читаются только заголовки, записи массива изображений и цветовой профиль — несколько\n  килобайт, каким бы большим ни было изображение. <исходный_файл>, заданный как URL http://\n  или https://, читается запросами Range, так что осмотр удаленного изображения занимает\n  один запрос на 64 КиБ и еще один для профиля, хранящегося после пикселей.",
+		"help.help_body":                 "Использование:\n  bitmap help [команда|опция]\n\nОписание:\n  Выводит справку по команде (например, apply) или параметры, диапазоны\n  и примеры опции apply (например, crop или --crop)",
+		"help.man_body":                  "Использование:\n  bitmap man > bitmap.1\n\nОписание:\n  Выводит man-страницу, созданную из реестров команд и операций",
+		"help.tune_body":                 "Использование:\n  bitmap tune [опции] <исходный_файл>\n\nОпции:\n  --addr=<хост:порт>         адрес для прослушивания (по умолчанию 127.0.0.1:8080)\n  --output=<выходной_файл>   имя выходного файла в итоговой команде\n  --script=<файл>            дополнительно записывает итоговую команду в shell-скрипт\n\nОписание:\n  Открывает веб-интерфейс с настройками всех операций и живым предпросмотром.\n  Кнопка Done выводит эквивалентную команду apply и завершает работу.",
+		"man.name":                       "просмотр и обработка изображений BMP",
+		"man.options_intro":              "Опции команды apply применяются в том порядке, в котором они указаны.",
+		"cmd.header.summary":             "выводит информацию из заголовков bitmap-файла",
+		"cmd.apply.summary":              "обрабатывает изображение и сохраняет результат в файл",
+		"cmd.tune.summary":               "запускает локальный веб-интерфейс для настройки опций с предпросмотром",
+		"cmd.help.summary":               "выводит справку по команде или опции apply",
+		"cmd.man.summary":                "выводит man-страницу в формате troff",
+		"op.mirror.summary":              "отражает изображение по указанной оси",
+		"op.mirror.param.axis":           "ось отражения",
+		"op.filter.summary":              "применяет указанный фильтр к изображению",
+		"op.filter.param.type":           "применяемый фильтр",
+		"op.pixelate.summary":            "пикселизирует часть изображения, например лица или номерные знаки",
+		"op.pixelate.details":            "Область задается так же, как для --crop: смещения от левого верхнего угла и размер, любое из чисел в процентах от стороны изображения, или привязка и размер. Она закрашивается блоками по size пикселей, по умолчанию 20, уложенными от ее левого верхнего угла, средним цветом каждого блока; остальное изображение остается четким.",
+		"op.pixelate.param.area":         "пикселизируемая область, как для --crop",
+		"op.pixelate.param.size":         "сторона блоков в пикселях",
+		"op.rotate.summary":              "поворачивает изображение на указанный угол",
+		"op.rotate.details":              "Положительные углы и right поворачивают по часовой стрелке, отрицательные углы и left — против. Поворот на 90 или 270 градусов меняет местами ширину и высоту. Любой другой угол, например 37.5, пересчитывается билинейно на холст, увеличенный так, чтобы изображение поместилось целиком; открывшиеся углы заливаются цветом --background, а без него становятся прозрачными у изображений с альфа-каналом и черными у остальных.",
+		"op.rotate.param.angle":          "угол поворота в градусах: right, left или любое число",
+		"op.crop.summary":                "обрезает изображение по указанному смещению и размерам",
+		"op.crop.details":                "Смещения отсчитываются в пикселях от левого верхнего угла; отрицательные смещения отсчитываются назад от правого и нижнего краев. Если ширина и высота не указаны, обрезка продолжается до правого нижнего угла. Любое число может быть процентом от ширины или высоты изображения, например 10%-10%-80%-80%, или физической длиной при заданном разрешении, например 1in@300dpi, а ширину и высоту можно записать вместе как ШxВ, например center-640x480. Вместо смещений можно указать привязку (top-left, top, top-right, left, center, right, bottom-left, bottom или bottom-right), а за ней ширину и высоту: область прижимается к этой стороне или ставится посередине.",
+		"op.crop.param.offsetX":          "левый край области обрезки",
+		"op.crop.param.offsetY":          "верхний край области обрезки",
+		"op.crop.param.width":            "ширина области обрезки",
+		"op.crop.param.height":           "высота области обрезки",
+		"op.smartcrop.summary":           "обрезает окно заданного размера вокруг самой детализированной части изображения",
+		"op.smartcrop.details":           "Выбирает окно ШxВ с наибольшей энергией границ, то есть разностью яркости соседних пикселей, а не центральное, чтобы миниатюры сохраняли объект в кадре. Однородные изображения обрезаются по центру. Если перед этим указан --hints, побеждает окно, больше всего покрывающее отмеченные области, а энергия решает только при равенстве.",
+		"op.hints.summary":               "загружает области интереса, которые --smartcrop сохраняет в кадре",
+		"op.hints.details":               "Файл содержит JSON-массив областей в пикселях от левого верхнего угла, например [{\"x\": 40, \"y\": 30, \"width\": 120, \"height\": 160, \"weight\": 2}], как их выдает детектор лиц или объектов. weight необязателен, по умолчанию 1. Области описывают изображение на этом этапе и отбрасываются этапами, которые перемещают пиксели, например rotate или crop.",
+		"op.hints.param.file":            "JSON-файл с областями",
+		"op.smartcrop.param.size":        "окно как ШxВ, не больше изображения",
+		"op.trim.summary":                "обрезает полностью прозрачные края 32-битных изображений",
+		"op.trim.details":                "Оставляет наименьшую область, в которой есть все не полностью прозрачные пиксели, как делают упаковщики спрайтов перед размещением изображений в атласе. Изображения без альфа-канала не меняются.",
+		"op.trim.param.mode":             "что считается пустым",
+		"op.deskew.summary":              "выпрямляет отсканированные страницы с наклонными строками текста",
+		"op.deskew.details":              "Находит угол, не больше заданного числа градусов в каждую сторону, при котором темные пиксели лучше всего выстраиваются в горизонтальные строки, и поворачивает изображение обратно на него. Размер сохраняется; открывшиеся при повороте углы заливаются цветом --background или белым, если он не задан. Страницы без строк текста и страницы, наклоненные меньше чем на 0,05 градуса, не меняются.",
+		"op.deskew.param.max":            "наибольший искомый наклон",
+		"op.threshold.summary":           "делает каждый пиксель черным или белым, как нужно системам OCR и факсам",
+		"op.threshold.details":           "Уровень от 0 до 255 делает пиксели не темнее него белыми, а остальные черными; otsu выбирает уровень, который лучше всего разделяет темные и светлые пиксели изображения. adaptive вместо этого сравнивает каждый пиксель со средним по окну шириной window пикселей вокруг него и делает его черным, если он темнее этого среднего за вычетом offset, чтобы текст оставался читаемым на неравномерно освещенных, затененных или пожелтевших страницах. Большие окна подходят для крупного текста; большие смещения оставляют белыми больше бледных штрихов.",
+		"op.threshold.param.method":      "otsu, adaptive или уровень от 0 до 255",
+		"op.threshold.param.window":      "нечетная сторона адаптивного окна",
+		"op.threshold.param.offset":      "насколько чернила темнее среднего по окну",
+		"op.despeckle.summary":           "убирает шум «соль и перец», например соринки пыли на отсканированных страницах",
+		"op.despeckle.details":           "Работает в окне шириной 2 * strength + 1 пикселей. В черно-белых изображениях, например после --threshold, каждая группа соприкасающихся черных пикселей, включая касание углами, занимающая меньше половины окна становится белой, а каждая такая группа белых пикселей среди черных — черной, так что соринки и проколы исчезают, а углы символов остаются четкими. Остальные изображения проходят через медианный фильтр этого окна, который заменяет каждый канал каждого пикселя его медианой вокруг него. Без значения сила равна 1.",
+		"op.despeckle.param.strength":    "радиус окна",
+		"op.margin-crop.summary":         "обрезает пустые поля страницы, оставляя отступ вокруг текста",
+		"op.margin-crop.details":         "Обрезает до области, в которой есть все группы темных пикселей, различаемых так же, как в --threshold=otsu, с заданным отступом с каждой стороны, где страница его позволяет. Группы, касающиеся краев изображения или занимающие половину его ширины или высоты, например темная рамка, которую сканер оставляет вокруг бумаги, не считаются содержимым и отрезаются, если их не окружает другое содержимое. Пустые страницы не меняются.",
+		"op.margin-crop.param.padding":   "поле, оставляемое вокруг содержимого",
+		"op.preset.summary":              "применяет настроенную последовательность опций для распространенной задачи",
+		"op.preset.details":              "ocr готовит отсканированные страницы для систем OCR, таких как Tesseract. Это то же, что --filter=grayscale --deskew=5 --threshold=adaptive,31,10 --despeckle=2 --margin-crop=20 в этом порядке: страница делается серой, выпрямляется, становится черно-белой относительно местного фона, очищается от соринок и обрезается до текста. Чтобы настроить этап, укажите вместо набора эти опции с измененным значением, например большее окно --threshold для крупного шрифта или более сильный --despeckle для пыльных сканов.",
+		"op.preset.param.name":           "набор",
+		"op.resize.summary":              "масштабирует изображение до заданного размера",
+		"op.resize.details":              "bilinear смешивает ближайшие пиксели исходного изображения, при уменьшении — все пиксели, которые покрывает результат, и подходит для фотографий; цвета взвешиваются по альфа-каналу, поэтому прозрачные пиксели не затемняют края (--straight-alpha отключает это); nearest копирует ближайший пиксель, сохраняя резкие края и цвета индексированных изображений. Пропорции не сохраняются; для этого есть --fit и --scale. Любая сторона может быть процентом от стороны изображения, например 50%x100%, а один процент, например 50%, задает обе; у физических размеров разрешение указывается в конце, например 10x15cm@300dpi.",
+		"op.resize.param.size":           "результат как ШxВ",
+		"op.resize.param.algorithm":      "интерполяция",
+		"op.scale.summary":               "масштабирует изображение в заданное число раз, сохраняя пропорции",
+		"op.scale.details":               "Множители меньше 1 уменьшают изображение, больше 1 — увеличивают; стороны округляются до целых пикселей. Алгоритмы те же, что у --resize.",
+		"op.scale.param.factor":          "множитель, например 0.5",
+		"op.scale.param.algorithm":       "интерполяция",
+		"op.upscale.summary":             "увеличивает пиксель-арт в 2, 3 или 4 раза, сохраняя резкие края",
+		"op.upscale.details":             "scale2x (Scale2x, Scale3x и Scale4x) только копирует имеющиеся цвета, сглаживая ступеньки там, где совпадают два соседа пикселя. hq2x находит края по тому, какие соседи похожи в YUV, как hqx, а xbr взвешивает разницу цветов вокруг каждого угла, как 2xBR; оба смешивают срезанные углы, давая более гладкие диагонали ценой новых цветов.",
+		"op.upscale.param.algorithm":     "алгоритм увеличения",
+		"op.upscale.param.factor":        "во сколько раз увеличить",
+		"op.zoom.summary":                "увеличивает каждый пиксель до блока NxN, при желании с сеткой между пикселями",
+		"op.zoom.details":                "Увеличение копирует пиксели без смешивания, поэтому иконки и спрайты остаются четкими для документации. С grid серые линии в один пиксель отмечают границы каждого исходного пикселя и обрамляют изображение, так что результат на пиксель шире и выше, чем в N раз больше исходного.",
+		"op.zoom.param.factor":           "увеличение как Nx",
+		"op.zoom.param.grid":             "рисовать границы пикселей",
+		"op.outline.summary":             "обводит содержимое контуром, как для игровых спрайтов и стикеров",
+		"op.outline.details":             "Содержимое — все не полностью прозрачные пиксели или, в изображениях без альфа-канала, все пиксели, отличающиеся от левого верхнего угла. Пиксели фона в пределах ширины от содержимого закрашиваются цветом и становятся непрозрачными; контур обрезается по краям изображения.",
+		"op.outline.param.width":         "ширина контура в пикселях",
+		"op.outline.param.color":         "цвет контура как rrggbb",
+		"op.colormap.summary":            "переводит одноканальные данные, например глубину или результаты измерений, в условные цвета",
+		"op.colormap.details":            "Каждый уровень серого, а у пикселей, которые не серые, их яркость, заменяется цветом карты от наименьшего значения к наибольшему. viridis и magma перцептивно равномерны: одинаковые шаги данных выглядят одинаково, и результат читается даже в оттенках серого; jet — классическая радуга от темно-синего до темно-красного.",
+		"op.colormap.param.map":          "цветовая карта",
+		"op.bitplane.summary":            "показывает один бит канала как черно-белое изображение",
+		"op.bitplane.details":            "Пиксели, у которых в канале установлен этот бит, становятся белыми, остальные черными; бит 0 младший, 7 старший. Младшие плоскости обычных фотографий похожи на шум, поэтому структура в них указывает на скрытые данные, а старшие показывают полосы, оставленные квантованием. Результат непрозрачный.",
+		"op.bitplane.param.channel":      "канал для чтения",
+		"op.bitplane.param.bit":          "бит, 0 — младший",
+		"op.pixelsort.summary":           "сортирует участки ярких пикселей по яркости — глитч-эффект сортировки пикселей",
+		"op.pixelsort.details":           "В каждой строке, а для vertical в каждом столбце, каждый участок пикселей ярче порога сортируется от темного к светлому слева направо или сверху вниз; более темные пиксели остаются на месте и разделяют участки. Чем ниже порог, тем длиннее полосы. Результат зависит только от изображения, поэтому повторяется в точности.",
+		"op.pixelsort.param.threshold":   "яркость, выше которой пиксели сортируются",
+		"op.pixelsort.param.direction":   "линии, вдоль которых идет сортировка",
+		"op.rowshift.summary":            "сдвигает строки вбок на случайные величины с переносом через края",
+		"op.rowshift.details":            "Каждая строка сдвигается влево или вправо не больше чем на amount пикселей. Сдвиги берутся из генератора с начальным значением seed, по умолчанию 1, поэтому одно значение всегда дает один и тот же глитч, а разные — разные.",
+		"op.rowshift.param.amount":       "наибольший сдвиг в пикселях",
+		"op.rowshift.param.seed":         "начальное значение случайных сдвигов",
+		"op.crystallize.summary":         "разбивает изображение на похожие на кристаллы ячейки однородного цвета",
+		"op.crystallize.details":         "cells центров разбрасываются случайно, и каждый пиксель попадает в ячейку ближайшего, так что получаются ячейки Вороного, закрашенные средним цветом своих пикселей. Центры берутся из генератора с начальным значением seed, по умолчанию 1, поэтому одно и то же значение всегда дает те же ячейки.",
+		"op.crystallize.param.cells":     "число ячеек",
+		"op.crystallize.param.seed":      "начальное значение центров ячеек",
+		"op.lens.summary":                "добавляет или исправляет радиальную дисторсию объектива",
+		"op.lens.details":                "Каждый пиксель на расстоянии r от центра, где r равно 1 в углах, берется с расстояния r(1 + k1 r² + k2 r⁴ + k3 r⁶). Положительные коэффициенты выгибают прямые линии бочкой; отрицательные растягивают края наружу, что выпрямляет линии кадров «рыбьего глаза» и экшн-камер. Пиксели пересчитываются билинейно, а области, взятые из-за краев, повторяют крайние пиксели.",
+		"op.lens.param.k1":               "коэффициент при r²",
+		"op.lens.param.k2":               "коэффициент при r⁴",
+		"op.lens.param.k3":               "коэффициент при r⁶, 0 если не указан",
+		"op.swirl.summary":               "закручивает изображение вокруг центра",
+		"op.swirl.details":               "Закручивание равно degrees в центре, по часовой стрелке для положительных углов, и сходит на нет на расстоянии radius пикселей от центра или половины меньшей стороны, если радиус не указан. Пиксели пересчитываются билинейно.",
+		"op.swirl.param.degrees":         "закручивание в центре",
+		"op.swirl.param.radius":          "охват закручивания в пикселях",
+		"op.implode.summary":             "стягивает изображение к центру или выталкивает наружу",
+		"op.implode.details":             "Положительные коэффициенты до 1 стягивают содержимое наибольшего центрированного круга внутрь, отрицательные до -1 выпячивают его наружу. Пиксели пересчитываются билинейно.",
+		"op.implode.param.factor":        "сила стягивания, отрицательная выталкивает наружу",
+		"op.wave.summary":                "покрывает изображение синусоидальной рябью",
+		"op.wave.details":                "Каждый столбец сдвигается вверх или вниз не больше чем на amplitude пикселей по синусоиде, повторяющейся каждые wavelength пикселей поперек изображения. Размер изображения не меняется, а открывающиеся края повторяют крайние пиксели. Пиксели пересчитываются билинейно.",
+		"op.wave.param.amplitude":        "наибольший сдвиг в пикселях",
+		"op.wave.param.wavelength":       "длина одной волны в пикселях",
+		"op.kaleidoscope.summary":        "повторяет отраженный клин изображения вокруг его центра",
+		"op.kaleidoscope.details":        "Изображение делится на segments равных клиньев вокруг центра. Клин, начинающийся на angle градусов по часовой стрелке от направления вправо, сохраняется, а каждый другой клин показывает его отраженным через предыдущий, как зеркала калейдоскопа; четное число сегментов смыкается без швов. Пиксели пересчитываются билинейно.",
+		"op.kaleidoscope.param.segments": "число клиньев",
+		"op.kaleidoscope.param.angle":    "начало сохраняемого клина в градусах",
+		"op.symmetry.summary":            "делает изображение симметричным, отражая его половину",
+		"op.symmetry.details":            "horizontal отражает левую половину на правую, vertical — верхнюю на нижнюю, а quad — левую верхнюю четверть на остальные три. Пиксели копируются как есть.",
+		"op.symmetry.param.mode":         "отражаемые половины",
+		"op.overlay.summary":             "накладывает другое BMP-изображение поверх этого, например водяной знак",
+		"op.overlay.details":             "Левый верхний угол наложения ставится в точку x,y от левого верхнего угла изображения; части за краями обрезаются. 32-битные наложения смешиваются по своему альфа-каналу, а непрозрачность, по умолчанию 1, масштабирует его для любого наложения. Цвета смешиваются в линейном свете, с указанным режимом смешивания, если он задан. Альфа-канал изображения сохраняется, а файл наложения читается заново для каждого изображения пакета.",
+		"op.overlay.param.file":          "BMP-файл для наложения",
+		"op.overlay.param.position":      "x,y левого верхнего угла наложения",
+		"op.overlay.param.opacity":       "1 — непрозрачно, 0 — невидимо",
+		"op.overlay.param.mode":          "режим смешивания",
+		"op.stamp.summary":               "впечатывает в угол текст, например имя файла и время",
+		"op.stamp.details":               "Рисует одну строку текста белым на черной плашке в правом нижнем углу или в углу, указанном перед ним, как камеры наблюдения подписывают кадры. {filename} и {stem} обозначают имя исходного файла с расширением и без него, а {mtime} — время его изменения в формате Go-раскладки времени после двоеточия, например {mtime:2006-01-02 15:04}; без нее время выглядит как 2006-01-02 15:04:05. apply и batch подставляют их для каждого файла, так что каждое изображение пакета получает свою надпись. С общим флагом --deterministic {mtime} — это $SOURCE_DATE_EPOCH в UTC или 1970-01-01 00:00:00, если переменная не задана. Буквы растут вместе с изображением, а текст шире изображения обрезается.",
+		"op.stamp.param.corner":          "угол надписи",
+		"op.stamp.param.text":            "текст с полями {filename}, {stem} и {mtime}",
+		"op.displace.summary":            "искажает изображение по каналам карты смещения",
+		"op.displace.details":            "Уровни красного канала карты сдвигают место, откуда берется каждый пиксель, вбок, а уровни зеленого — вверх или вниз, не больше чем на strength пикселей, по умолчанию 10: 128 оставляет пиксель на месте, меньшие уровни берут его слева или сверху, большие — справа или снизу. Отрицательная сила меняет направления на обратные. Если размеры карты и изображения различаются, карта растягивается на изображение, а пиксели пересчитываются билинейно. Файл карты читается заново для каждого изображения пакета.",
+		"op.displace.param.file":         "BMP-файл карты смещения",
+		"op.displace.param.strength":     "наибольший сдвиг в пикселях",
+		"op.blur.summary":                "размывает изображение с заданным радиусом",
+		"op.blur.details":                "gaussian взвешивает соседей по колоколу Гаусса и дает мягкое размытие; box усредняет их поровну. Ядро раскладывается на строки и столбцы, поэтому большие радиусы остаются быстрыми. Альфа-канал не меняется.",
+		"op.blur.param.radius":           "радиус в пикселях",
+		"op.blur.param.kernel":           "ядро размытия",
+		"op.convolve.summary":            "взвешивает каждый пиксель и его соседей собственным ядром",
+		"op.convolve.details":            "Ядро состоит из 9 или 25 весов для 3x3 или 5x5, перечисленных по строкам сверху вниз. Если сумма весов не равна 0, они делятся на нее, поэтому 1,1,1,1,1,1,1,1,1 усредняет. Пиксели за краями повторяют крайний пиксель (clamp), берутся с противоположной стороны (wrap) или отражаются от края (mirror). Альфа-канал не меняется.",
+		"op.convolve.param.kernel":       "веса через запятую",
+		"op.convolve.param.edge":         "пиксели, читаемые за краями",
+		"op.brightness.summary":          "делает изображение светлее или темнее",
+		"op.brightness.details":          "Каждый канал сдвигается на заданный процент полного диапазона и ограничивается пределами 0-255.",
+		"op.brightness.param.amount":     "прибавляемый процент полного диапазона",
+		"op.contrast.summary":            "повышает или понижает контраст изображения",
+		"op.contrast.details":            "При положительных значениях каналы удаляются от среднего серого, при отрицательных приближаются к нему; -100 дает ровный серый, а 100 переводит все прочие уровни в черный или белый.",
+		"op.contrast.param.amount":       "сила изменения",
+		"op.saturation.summary":          "делает цвета более или менее насыщенными",
+		"op.saturation.details":          "При положительных значениях каждый пиксель удаляется от серого своей яркости, при отрицательных приближается к нему; -100 дает изображение в оттенках серого.",
+		"op.saturation.param.amount":     "сила изменения",
+		"op.gamma.summary":               "применяет гамма-кривую, чтобы осветлить или затемнить средние тона",
+		"op.gamma.details":               "Значения больше 1 осветляют средние тона, меньше 1 затемняют их, а черный и белый не меняются; 1 оставляет изображение без изменений. Каждый канал v становится 255 * (v/255)^(1/gamma).",
+		"op.gamma.param.gamma":           "положительное число, например 2.2",
+		"op.auto-expose.summary":         "исправляет экспозицию так, чтобы нейтральная область стала средне-серой",
+		"op.auto-expose.details":         "Средняя яркость области, например серой карты в кадре, измеряется в линейном свете, и все изображение осветляется или затемняется во столько раз, чтобы она стала серой 18%, как при более длинной или короткой выдержке; света, вышедшие за белый, обрезаются. Область задается в пикселях от левого верхнего угла, поэтому одно значение исправляет все снимки серии, снятой с картой на месте.",
+		"op.auto-expose.param.area":      "область замера в виде from:x,y,w,h",
+		"op.colorspace.summary":          "переводит цвета в линейный свет или обратно в sRGB для следующих этапов",
+		"op.colorspace.details":          "Этапы, усредняющие цвета, такие как --resize, --scale и --blur, смешивают их в линейном свете так, как смешивается свет, и смеси ярких и темных цветов не становятся слишком темными. Перед этапами, работающими с цветами такими, какими они видны, например --filter, --outline и --remap, а также перед выводом изображение переводится обратно в sRGB, а перевод в ту кодировку, в которой изображение уже находится, ничего не делает. Восемь бит линейного света сливают самые темные оттенки, поэтому переводите только вокруг этапов, которым это нужно.",
+		"op.colorspace.param.space":      "кодировка цветов",
+		"op.fit.summary":                 "вписывает изображение в заданный размер, сохраняя пропорции",
+		"op.fit.details":                 "Результат получается как можно больше, но не превышает ШxВ ни по одной стороне. С no-upscale изображения, которые уже помещаются, не меняются, так что уменьшаются только большие.",
+		"op.fit.param.size":              "размер как ШxВ",
+		"op.fit.param.mode":              "увеличивать ли меньшие изображения",
+		"op.ninepatch.summary":           "масштабирует изображение до ШxВ по схеме 9-slice, как для скинов интерфейса",
+		"op.ninepatch.details":           "Границы, в пикселях от левого, верхнего, правого и нижнего краёв, делят изображение на девять частей. Углы сохраняют размер, верхний и нижний края растягиваются по горизонтали, левый и правый — по вертикали, а центр — в обе стороны. Границы должны оставлять центр в исходном изображении и помещаться в ШxВ.",
+		"op.ninepatch.param.borders":     "ширина левой, верхней, правой и нижней границ",
+		"op.ninepatch.param.size":        "результат как ШxВ",
+		"op.remap.summary":               "заменяет цвета по файлу соответствий",
+		"op.remap.details":               "Файл содержит по одной паре старыйHex=новыйHex на строку, например ff00ff=00ff00. У индексированных изображений перекрашивается и сохраняется таблица цветов, остальные перекрашиваются попиксельно.",
+		"op.remap.param.file":            "файл соответствий",
+		"op.assert.summary":              "останавливает конвейер, если изображение не удовлетворяет условию",
+		"op.assert.details":              "dimensions:ШxВ требует точного размера, max-colors:N не более N разных цветов, not-blank хотя бы двух разных цветов. Изображение проходит без изменений, поэтому проверки можно ставить между любыми этапами.",
+		"op.assert.param.check":          "проверяемое условие",
+		"op.assert.param.argument":       "ШxВ для dimensions, число цветов для max-colors, ничего для not-blank",
+		"op.if.summary":                  "выполняет следующую опцию, только если изображение удовлетворяет условию",
+		"op.if.details":                  "Условие сравнивает width, height или pixels (ширина на высоту) с числом с помощью >, <, >=, <=, == или !=, например width>2000. Несколько условий подряд должны выполняться все. Заключайте опцию в кавычки, чтобы оболочка не приняла > и < за перенаправление.",
+		"op.if.param.predicate":          "свойство, сравнение и число",
+		"cmd.batch.summary":              "применяет опции ко всем BMP-файлам в каталоге",
+		"cmd.run.summary":                "выполняет задания из файла JSON Lines: исходный файл, опции и выходной файл",
+		"usage.batch":                    "использование: ./bitmap batch [опции] <входной_каталог> <выходной_каталог>",
+		"error.create_dir":               "ошибка создания каталога: %v",
+		"error.read_dir":                 "ошибка чтения каталога: %v",
+		"error.read_input":               "ошибка чтения команд: %v",
+		"error.pick_terminal":            "pick нужен терминал на стандартном вводе и в стандартном потоке ошибок",
+		"error.pick_raw":                 "не удалось перевести терминал в режим без обработки ввода: %v",
+		"error.pick_cancelled":           "выделение отменено",
+		"error.shell_command":            "неизвестная команда %q: введите help для списка",
+		"error.shell_usage":              "использование: %s",
+		"error.shell_undo":               "нечего отменять",
+		"error.shell_redo":               "нечего возвращать",
+		"error.batch_failed":             "ошибки в %d из %d файлов",
+		"error.name_collision":           "файл %s уже записан для %s",
+		"error.path_root":                "не удалось определить путь %s: %v",
+		"error.path_escape":              "%s находится вне %s",
+		"error.symlink":                  "%s является символической ссылкой или проходит через нее; --follow-symlinks разрешает ссылки",
+		"warning.symlink_skipped":        "%s пропущен: символическая ссылка; --follow-symlinks разрешает ссылки",
+		"error.template_field":           "неизвестное поле шаблона имени: %s",
+		"error.template_name":            "шаблон имени %q дает недопустимое имя файла",
+		"info.batch_done":                "%s -> %s",
+		"info.batch_skipped":             "%s -> %s (не изменился)",
+		"info.batch_pruned":              "%s пропущен как похожий на последний оставленный файл",
+		"info.batch_pruned_total":        "пропущено файлов, похожих на последний оставленный: %d",
+		"info.file_pruned":               "%s пропущен: %.3f от последнего оставленного файла",
+		"info.batch_summary":             "файлов: %d; записано: %d, не изменились: %d, с ошибками: %d за %v",
+		"info.run_summary":               "заданий: %d; выполнено: %d, с ошибками: %d, с повторами: %d за %v",
+		"info.job_retry":                 "%s:%d: %v, повтор через %v",
+		"error.run_failed":               "ошибки в %d из %d заданий",
+		"error.open_jobs":                "ошибка чтения заданий: %v",
+		"error.invalid_job":              "неверное задание: %v",
+		"error.job_fields":               "обязательны оба поля, input и output",
+		"error.job_format":               "формат %q не входит в список %s",
+		"error.read_state":               "ошибка чтения файла состояния: %v",
+		"error.write_state":              "ошибка записи файла состояния: %v",
+		"error.write_results":            "ошибка записи результатов: %v",
+		"cmd.serve.summary":              "предоставляет обработку apply по HTTP",
+		"info.serving":                   "Сервер запущен на http://%s/ (отправляйте изображения POST-запросом на /apply)",
+		"error.too_many_requests":        "слишком много одновременных запросов, повторите позже",
+		"error.body_too_large":           "тело запроса превышает ограничение в %d байт",
+		"error.request_timeout":          "время обработки запроса истекло",
+		"error.read_body":                "ошибка чтения тела запроса: %v",
+		"error.invalid_signature":        "подпись запроса отсутствует или неверна",
+		"info.draining":                  "Остановка, ожидание завершения текущих запросов",
+		"error.draining":                 "сервер останавливается",
+		"error.shutdown":                 "ошибка остановки сервера: %v",
+		"cmd.daemon.summary":             "обслуживает команды header и apply через Unix-сокет",
+		"cmd.client.summary":             "выполняет команду header или apply в запущенном демоне",
+		"usage.daemon":                   "использование: ./bitmap daemon [--socket=<путь>] [--root=<каталог>] [--follow-symlinks]",
+		"error.invalid_handle":           "неверный дескриптор изображения",
+		"error.invalid_ops_json":         "неверный JSON операций: %v",
+		"cmd.rpc.summary":                "отвечает на JSON-запросы со стандартного ввода, по одному на строку",
+		"usage.rpc":                      "использование: ./bitmap rpc [--root=<каталог>] [--follow-symlinks]",
+		"error.rpc_request":              "неверный запрос: %v",
+		"error.rpc_method":               "неизвестный метод: %s",
+		"error.unknown_image":            "неизвестное изображение: %d",
+		"help.rpc_body":                  "Использование:\n  bitmap rpc [--root=<каталог>] [--follow-symlinks]\n\nОпции:\n  --root=<каталог>     каталог, за пределы которого не могут выходить пути запросов, для\n                       запросов из ненадежных источников; относительные пути отсчитываются\n                       от него, пути через символические ссылки отклоняются, а опции,\n                       читающие файлы, недоступны\n  --follow-symlinks    с --root разрешает пути через символические ссылки в нем\n\nОписание:\n  Читает по одному JSON-запросу на строку со стандартного ввода и пишет по одному\n  JSON-ответу на строку в стандартный вывод, чтобы скрипт мог управлять долгоживущим процессом.\n  Ответы повторяют id запроса и содержат result или error.\n\nМетоды:\n  {\"method\": \"load\", \"path\": \"in.bmp\"}                          загружает изображение, возвращает его id и размер\n  {\"method\": \"apply\", \"image\": 1, \"ops\": [{\"name\": \"rotate\", \"value\": \"right\"}]}\n                                                                 применяет опции, возвращает новое изображение\n  {\"method\": \"save\", \"image\": 2, \"path\": \"out.bmp\"}              записывает изображение в файл\n  {\"method\": \"stats\", \"image\": 2}                                размер и минимум, максимум и среднее каналов\n  {\"method\": \"release\", \"image\": 1}                              освобождает изображение",
+		"info.daemon_listening":          "Ожидание запросов на %s",
+		"error.daemon_running":           "демон уже слушает %s",
+		"error.connect_daemon":           "ошибка подключения к демону %s: %v",
+		"error.daemon_stage_flags":       "запрос сделан с общими опциями %q, а демон запущен с %q; запустите демон с теми же",
+		"error.frame":                    "ошибка протокола: %v",
+		"error.frame_size":               "кадр размером %d байт превышает ограничение %d",
+		"help.daemon_body":               "Использование:\n  bitmap daemon [--socket=<путь>] [--root=<каталог>] [--follow-symlinks]\n\nОпции:\n  --socket=<путь>      Unix-сокет для прослушивания (по умолчанию $XDG_RUNTIME_DIR/bitmap-<uid>.sock)\n  --root=<каталог>     каталог, за пределы которого не могут выходить файлы запросов, для\n                       клиентов, которым нет доверия; относительные пути отсчитываются от него,\n                       пути через символические ссылки отклоняются, а опции, читающие файлы,\n                       --rasterizer и --post-hook недоступны\n  --follow-symlinks    с --root разрешает пути через символические ссылки в нем\n\nОписание:\n  Держит один процесс запущенным для обработки запросов header и apply, чтобы\n  инструменты, часто вызывающие bitmap, не тратили время на запуск. Остановка — SIGTERM.\n  Файлы блокируются на время чтения и записи, как в batch.\n\nПротокол:\n  Каждый кадр — 4-байтовая длина (big-endian) и столько же байт JSON.\n  Запросы: {\"args\": [\"apply\", \"--filter=grayscale\", \"/abs/in.bmp\", \"/abs/out.bmp\"]},\n  ответы: {\"output\": \"...\"} или {\"error\": \"...\", \"exit_code\": 4}. Соединение может\n  передавать много запросов. Запрос может добавить \"settings\" — настройки чтения и\n  записи из общих опций клиента, с которыми он и выполняется вместо настроек демона, —\n  и должен передать в \"stages\" опции --background, --straight-alpha, --deterministic\n  и --distance, с которыми запущен демон.",
+		"help.client_body":               "Использование:\n  bitmap client [--socket=<путь>] header <исходный_файл>\n  bitmap client [--socket=<путь>] apply [опции] <исходный_файл> <выходной_файл>\n\nОписание:\n  Выполняет команду header или apply в запущенном демоне, а не в этом процессе.\n  Относительные имена файлов разрешаются от текущего каталога. Общие опции,\n  меняющие чтение и запись файлов, например --strict или --compact, передаются\n  с запросом; --background, --straight-alpha, --deterministic и --distance\n  должны совпадать с опциями демона.",
+		"help.serve_body":                "Использование:\n  bitmap serve [опции]\n\nОпции:\n  --addr=<хост:порт>          адрес для прослушивания (по умолчанию 127.0.0.1:8080)\n  --max-concurrent=<n>        число одновременно обрабатываемых запросов, остальные получают 429 (по умолчанию: число процессоров)\n  --max-body-size=<байты>     наибольший размер загрузки, большие получают 413 (по умолчанию 33554432)\n  --timeout=<длительность>    время на чтение и обработку запроса, например 10s (по умолчанию 30s)\n  --secret=<ключ>             требует, чтобы каждый URL /apply содержал верную подпись\n  --cache-size=<байты>        память для кэша ответов, 0 отключает кэш (по умолчанию 67108864)\n  --cache-max-age=<длительность>  max-age в заголовках Cache-Control (по умолчанию 1h)\n  --shutdown-delay=<длительность>  время после SIGTERM, когда /readyz уже сообщает об ошибке (по умолчанию 0s)\n\nКонечные точки:\n  POST /apply?op=<опция>=<значение>...[&format=png]\n                              применяет опции по порядку к BMP из тела запроса\n  GET /metrics                время этапов и счетчики ввода-вывода\n  GET /healthz                проверка работоспособности\n  GET /readyz                 проверка готовности, отказывает после начала остановки\n\nПо SIGTERM или прерыванию сервер перестает принимать запросы и ждет\nзавершения текущих не дольше --timeout.\n\nПодписанные URL:\n  С --secret добавьте к запросу sig=<подпись>. Подпись — base64url без выравнивания\n  от HMAC-SHA256 пути и запроса без sig, например\n  /apply?op=rotate=right&format=png\n\nПример:\n  curl --data-binary @in.bmp 'http://127.0.0.1:8080/apply?op=rotate=right&op=filter=grayscale' > out.bmp",
+		"help.batch_body":                "Использование:\n  bitmap batch [опции] <входной_каталог> <выходной_каталог>\n\nОпции:\n  --name-template=<шаблон>      имя выходного файла, по умолчанию {name}\n  --incremental                 пропускает файлы с актуальным результатом\n  --resume                      пропускает файлы, уже записанные прерванным запуском\n  --state-file=<файл>           журнал записанных файлов, по умолчанию <выходной_каталог>/.bitmap-state.jsonl\n  --results=<text|jsonl>        формат результатов; jsonl выводит JSON-объект на каждый файл\n  --results-file=<файл>         записывает результаты в файл вместо стандартного вывода\n  --workers=<n>                 число файлов, обрабатываемых одновременно, по умолчанию по одному на процессор,\n                                с --nice вдвое меньше\n  --prune-similar=<d>           пропускает файлы, гистограммы цветов которых отстоят от гистограмм\n                                последнего оставленного файла в порядке имен меньше чем на d, от 0 до 1,\n                                например повторяющиеся кадры, записанные командой frames\n  --follow-symlinks             читает исходные файлы, которые являются символическими ссылками, и\n                                пишет через ссылки в <выходном_каталоге>; по умолчанию они\n                                пропускаются и отклоняются, чтобы ссылка, подброшенная в дерево\n                                из ненадежного источника, не открыла доступ к другим файлам\n  любая опция apply             применяется к каждому файлу в указанном порядке\n\nПоля шаблона:\n  {name} {stem} {ext}           имя входного файла, без расширения, расширение\n  {op}                          примененные опции, например mirror-horizontal+filter-grayscale\n  {width} {height}              размеры результата\n\nБлокировки:\n  Исходные файлы читаются под разделяемой блокировкой, а результаты пишутся под\n  исключительной (flock, в Windows LockFileEx), поэтому запуски над одними каталогами\n  ждут друг друга, а не читают и не пишут недописанные файлы.\n\nПример:\n  bitmap batch --filter=grayscale --name-template={stem}_{op}_{width}x{height}.bmp scans/ out/",
+		"usage.run":                      "использование: ./bitmap run [опции] <файл_заданий>",
+		"help.run_body":                  "Использование:\n  bitmap run [опции] <файл_заданий>\n\nОпции:\n  --workers=<n>                 число заданий, выполняемых одновременно, по умолчанию по\n                                одному на процессор, с --nice вдвое меньше\n  --retries=<n>                 число повторных попыток для задания, ошибка которого может\n                                пройти, например ошибка записи, по умолчанию 2\n  --retry-delay=<длительность>  пауза перед первым повтором, удваивается перед каждым\n                                следующим, по умолчанию 1s\n  --results=<text|jsonl>        формат результатов заданий; jsonl выводит по JSON-объекту\n                                на задание\n  --results-file=<файл>         записывает результаты заданий в файл вместо стандартного вывода\n  --failed=<файл>               копирует строки заданий с ошибками в файл заданий, чтобы\n                                выполнить их снова после устранения причины\n  --output-root=<каталог>       каталог, за пределы которого нельзя писать; относительные пути\n                                выходных файлов отсчитываются от него\n  --follow-symlinks             читает и пишет файлы, которые являются символическими ссылками, а с\n                                --output-root пишет и через ссылки в нем; по умолчанию они\n                                отклоняются, для заданий из деревьев из ненадежных источников\n\nЗадания:\n  Каждая строка <файла_заданий> — задание, JSON-объект с полями:\n    input                       исходный файл в любом формате, который читает convert\n    output                      записываемый файл; недостающие каталоги создаются\n    ops                         опции apply, применяемые в указанном порядке, как в rpc:\n                                [{\"name\": \"rotate\", \"value\": \"right\"}]\n    format                      формат вывода, если не указан, определяется по имени файла\n  <файл_заданий> - читает задания со стандартного ввода.\n\nОписание:\n  Выполняет все задания на пуле обработчиков и в конце выводит сводку. Задания читаются\n  по мере того, как обработчики их берут, а результаты выводятся в порядке файла, поэтому\n  файл из миллионов строк, например составленный скриптом для переноса архива, требует\n  немного памяти. Задания с отсутствующим или поврежденным исходным файлом или неверной\n  опцией завершаются ошибкой сразу, остальные повторяются. Ошибка одного задания не\n  останавливает остальные, но запуск завершается с ошибкой.\n\nПример:\n  bitmap run --workers=16 --failed=failed.jsonl --results=jsonl --results-file=log.jsonl jobs.jsonl",
+	},
+}
+
+// The English messages of the bmp package are part of the catalog, so only translations are listed above
+func init() {
+	for key, text := range bmp.Messages {
+		catalogs["en"][key] = text
+	}
+}
+
+// Returns the message for key in the current language, formatted with args
+func msg(key string, args ...any) string {
+	format, ok := catalogs[language][key]
+	if !ok {
+		format, ok = catalogs["en"][key]
+	}
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Returns an error whose text is the message for key formatted with args
+func msgError(key string, args ...any) error {
+	e := &messageError{key: key, text: msg(key, args...)}
+	for _, arg := range args {
+		if err, ok := arg.(error); ok {
+			e.err = err
+			break
+		}
+	}
+	return e
+}
+
+// Error carrying a localized message
+type messageError struct {
+	key  string
+	text string
+	err  error // Error the message reports, if any, so that errors.Is and errors.As see through it
+}
+
+func (e *messageError) Error() string {
+	return e.text
+}
+
+func (e *messageError) Unwrap() error {
+	return e.err
+}
+
+// Translates errors of the bmp package into the current language, keeping them underneath for errors.Is;
+// other errors, localized messages wrapping bmp errors included, are returned as they are
+func localizeError(err error) error {
+	if bmpErr, ok := err.(*bmp.Error); ok {
+		e := msgError(bmpErr.Key, bmpErr.Args...).(*messageError)
+		e.err = bmpErr
+		return e
+	}
+	return err
+}
+
+// Returns the translation for key if the current language has one, or fallback otherwise.
+// Used for texts whose English source lives in a registry rather than in the catalog.
+func localized(key, fallback string) string {
+	if text, ok := catalogs[language][key]; ok {
+		return text
+	}
+	return fallback
+}
+
+// Prints an error with the localized prefix to standard error
+func printError(err error) {
+	fmt.Fprintln(os.Stderr, colorize(os.Stderr, styleError, msg("error.prefix")), localizeError(err))
+}
+
+// Prints a warning with the localized prefix to standard error
+func printWarning(err error) {
+	if logLevel < logNormal {
+		return
+	}
+	fmt.Fprintln(os.Stderr, colorize(os.Stderr, styleWarning, msg("warning.prefix")), localizeError(err))
+}
+
+// Selects the message language: the one --lang names, or else the one of LC_ALL, LC_MESSAGES or LANG
+// when there are messages in it. BITMAP_LANG and the config file give --lang its default.
+func selectLanguage(lang string) {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if lang != "" {
+			break
+		}
+		lang = os.Getenv(name)
+	}
+	if code := languageCode(lang); catalogs[code] != nil {
+		language = code
+	}
+}
+
+// Reduces a locale name such as ru_RU.UTF-8 to its language code
+func languageCode(locale string) string {
+	code := strings.ToLower(locale)
+	if i := strings.IndexAny(code, "_.@-"); i >= 0 {
+		code = code[:i]
+	}
+	return code
+}
+
+// Rejects --lang values of languages without messages
+func checkLanguage(value string) error {
+	if catalogs[languageCode(value)] == nil {
+		return msgError("expect.language", strings.Join(availableLanguages(), ", "))
+	}
+	return nil
+}
+
+// Lists the language codes that have a message catalog
+func availableLanguages() []string {
+	codes := make([]string, 0, len(catalogs))
+	for code := range catalogs {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
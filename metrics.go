@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Accumulated duration of one pipeline stage
+type stageMetric struct {
+	Count   int64   `json:"count"`
+	Seconds float64 `json:"seconds"`
+}
+
+// Process-wide counters for stage timings, I/O volume and pixel throughput
+type metricsRegistry struct {
+	mu              sync.Mutex
+	stages          map[string]*stageMetric
+	bytesRead       int64
+	bytesWritten    int64
+	pixelsProcessed int64
+}
+
+// Metrics collected by this process
+var metrics = &metricsRegistry{stages: make(map[string]*stageMetric)}
+
+// Settings of the --metrics and --metrics-file global flags
+var metricsFormat, metricsFile string
+
+// Records the duration of a stage that started at start
+func (m *metricsRegistry) observeStage(stage string, start time.Time) {
+	elapsed := time.Since(start).Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.stages[stage]
+	if !ok {
+		s = &stageMetric{}
+		m.stages[stage] = s
+	}
+	s.Count++
+	s.Seconds += elapsed
+}
+
+// Adds to the number of bytes read from image files
+func (m *metricsRegistry) addBytesRead(n int64) {
+	m.mu.Lock()
+	m.bytesRead += n
+	m.mu.Unlock()
+}
+
+// Adds to the number of bytes written to image files
+func (m *metricsRegistry) addBytesWritten(n int64) {
+	m.mu.Lock()
+	m.bytesWritten += n
+	m.mu.Unlock()
+}
+
+// Adds to the number of pixels that went through pipeline stages
+func (m *metricsRegistry) addPixels(n int64) {
+	m.mu.Lock()
+	m.pixelsProcessed += n
+	m.mu.Unlock()
+}
+
+// Writes the metrics as a JSON document
+func (m *metricsRegistry) writeJSON(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(map[string]any{
+		"stages":           m.stages,
+		"bytes_read":       m.bytesRead,
+		"bytes_written":    m.bytesWritten,
+		"pixels_processed": m.pixelsProcessed,
+	})
+}
+
+// Writes the metrics in the Prometheus text exposition format
+func (m *metricsRegistry) writePrometheus(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.stages))
+	for name := range m.stages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("# HELP bitmap_stage_duration_seconds Time spent in each pipeline stage.\n")
+	b.WriteString("# TYPE bitmap_stage_duration_seconds summary\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "bitmap_stage_duration_seconds_sum{stage=%q} %g\n", name, m.stages[name].Seconds)
+		fmt.Fprintf(&b, "bitmap_stage_duration_seconds_count{stage=%q} %d\n", name, m.stages[name].Count)
+	}
+	b.WriteString("# HELP bitmap_bytes_read_total Bytes read from image files.\n")
+	b.WriteString("# TYPE bitmap_bytes_read_total counter\n")
+	fmt.Fprintf(&b, "bitmap_bytes_read_total %d\n", m.bytesRead)
+	b.WriteString("# HELP bitmap_bytes_written_total Bytes written to image files.\n")
+	b.WriteString("# TYPE bitmap_bytes_written_total counter\n")
+	fmt.Fprintf(&b, "bitmap_bytes_written_total %d\n", m.bytesWritten)
+	b.WriteString("# HELP bitmap_pixels_processed_total Pixels processed by pipeline stages.\n")
+	b.WriteString("# TYPE bitmap_pixels_processed_total counter\n")
+	fmt.Fprintf(&b, "bitmap_pixels_processed_total %d\n", m.pixelsProcessed)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Serves the metrics, as JSON when ?format=json is given and in Prometheus format otherwise
+func (m *metricsRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		m.writeJSON(w)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.writePrometheus(w)
+}
+
+// Writes the collected metrics if --metrics was given, to --metrics-file or standard error
+func exportMetrics() error {
+	if metricsFormat == "" {
+		return nil
+	}
+
+	w := io.Writer(os.Stderr)
+	if metricsFile != "" {
+		file, err := os.Create(nativePath(metricsFile))
+		if err != nil {
+			return msgError("error.create_file", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if metricsFormat == "json" {
+		return metrics.writeJSON(w)
+	}
+	return metrics.writePrometheus(w)
+}
+
+// Counts the bytes read through a stream, for the bytes-read metric
+type readCounter struct {
+	io.ReadSeeker
+	n int64
+}
+
+func (c *readCounter) Read(p []byte) (int, error) {
+	n, err := c.ReadSeeker.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Counts the bytes written to a stream, for the bytes-written metric
+type writeCounter struct {
+	io.Writer
+	n int64
+}
+
+func (c *writeCounter) Write(p []byte) (int, error) {
+	n, err := c.Writer.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"runtime"
+
+	"creditcard/bmp"
+)
+
+// Niceness --nice runs at on Unix systems, that of the nice command
+const niceLevel = 10
+
+// Set by --nice: the process runs at a lower CPU and I/O priority, and with half as many workers and row
+// goroutines as it would otherwise, so that long batch and run jobs leave the machine usable
+var niceMode bool
+
+// Lowers the priority of the process for --nice. Systems that refuse, or have no priorities to lower,
+// only get a warning, as the run works the same either way. Comes after --jobs, which it leaves alone
+// when given.
+func selectPriority() {
+	if err := lowerPriority(); err != nil {
+		printWarning(msgError("warning.nice", err))
+	}
+	if bmp.Jobs == 0 {
+		bmp.Jobs = defaultWorkers()
+	}
+}
+
+// Returns the number of files commands work on at the same time by default: one per CPU, or half as
+// many with --nice
+func defaultWorkers() int {
+	if niceMode {
+		return max(runtime.NumCPU()/2, 1)
+	}
+	return runtime.NumCPU()
+}
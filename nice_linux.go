@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// Arguments of ioprio_set, which the syscall package does not wrap
+const (
+	ioprioWhoProcess = 1
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+)
+
+// Lowers the CPU priority of the process to niceLevel and puts its I/O in the idle class, as
+// ionice -c3 does, so that it only reads and writes when no other process is waiting for the disk. Linux
+// keeps both per thread, so every thread of the process is lowered; threads started later take the
+// priorities of the one that starts them.
+func lowerPriority() error {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, niceLevel); err != nil {
+			return err
+		}
+		_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), ioprioClassIdle<<ioprioClassShift)
+		if errno != 0 {
+			return errno
+		}
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly || windows)
+
+package main
+
+// Other systems, such as WebAssembly hosts, offer no priorities to lower
+func lowerPriority() error {
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build darwin || freebsd || netbsd || openbsd || dragonfly
+
+package main
+
+import "syscall"
+
+// Lowers the CPU priority of the process to niceLevel. These systems have no I/O priority the syscall
+// package can reach, so reads and writes keep theirs.
+func lowerPriority() error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, 0, niceLevel)
+}
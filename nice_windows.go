@@ -0,0 +1,21 @@
+package main
+
+import "syscall"
+
+// SetPriorityClass from kernel32, which the syscall package does not wrap
+var procSetPriorityClass = syscall.NewLazyDLL("kernel32.dll").NewProc("SetPriorityClass")
+
+// Priority class that puts the process in background mode
+const processModeBackgroundBegin = 0x00100000
+
+// Puts the process in background mode, which lowers its CPU, I/O and memory priorities together
+func lowerPriority() error {
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return err
+	}
+	if ok, _, err := procSetPriorityClass.Call(uintptr(process), processModeBackgroundBegin); ok == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Parses a --ninepatch value of the form left,top,right,bottom:WxH into the border widths and target size
+func parseNinePatch(value string) (borders [4]int, width, height int, err error) {
+	insets, size, found := strings.Cut(value, ":")
+	parts := strings.Split(insets, ",")
+	width, height, ok := parseSize(size)
+	if !found || !ok || len(parts) != 4 {
+		return borders, 0, 0, msgError("error.invalid_ninepatch", value)
+	}
+	for i, part := range parts {
+		if borders[i], err = strconv.Atoi(part); err != nil || borders[i] < 0 {
+			return borders, 0, 0, msgError("error.invalid_ninepatch", value)
+		}
+	}
+	left, top, right, bottom := borders[0], borders[1], borders[2], borders[3]
+	if left+right > width || top+bottom > height {
+		return borders, 0, 0, msgError("error.ninepatch_size", insets, width, height)
+	}
+	return borders, width, height, nil
+}
+
+// Scales the image to the given size with 9-slice semantics: the corners keep their size, the edges
+// stretch along one axis and the center along both. borders holds the left, top, right and bottom widths.
+func applyNinePatch(img *Image, borders [4]int, width, height int, progress rowProgress) (*Image, error) {
+	left, top, right, bottom := borders[0], borders[1], borders[2], borders[3]
+	if left+right >= img.Width || top+bottom >= img.Height {
+		return nil, msgError("error.ninepatch_bounds", borders[0], borders[1], borders[2], borders[3], img.Width, img.Height)
+	}
+
+	result := &Image{Width: width, Height: height, Pixels: make([]Pixel, width*height), Gap: img.Gap, Palette: img.Palette}
+	if img.Alpha != nil {
+		result.Alpha = make([]byte, width*height)
+	}
+	columns := make([]int, width)
+	for x := range columns {
+		columns[x] = sliceSource(x, width, img.Width, left, right)
+	}
+	// Borders are measured from the top while rows are stored bottom-up
+	for y := 0; y < height; y++ {
+		sy := img.Height - 1 - sliceSource(height-1-y, height, img.Height, top, bottom)
+		for x, sx := range columns {
+			result.Pixels[y*width+x] = img.Pixels[sy*img.Width+sx]
+			if img.Alpha != nil {
+				result.Alpha[y*width+x] = img.Alpha[sy*img.Width+sx]
+			}
+		}
+		progress.Report(y+1, height)
+	}
+	return result, nil
+}
+
+// Maps a position along one axis of the result to the source: positions within the leading and
+// trailing borders map one to one, the ones between them are stretched with nearest-neighbor sampling
+func sliceSource(pos, size, sourceSize, lead, trail int) int {
+	switch {
+	case pos < lead:
+		return pos
+	case pos >= size-trail:
+		return sourceSize - (size - pos)
+	}
+	return lead + (pos-lead)*(sourceSize-lead-trail)/(size-lead-trail)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Returns the number of channels of the pixel arrays exported for the image: 3 for red, green and blue, and
+// 4 when it has alpha
+func pixelChannels(img *Image) int {
+	if img.Alpha != nil {
+		return 4
+	}
+	return 3
+}
+
+// Writes the pixels as a NumPy .npy array of unsigned bytes shaped (height, width, channels), top row first
+// and channels in RGB or RGBA order, as numpy.load and PIL's numpy.asarray give them
+func writeNPY(out io.Writer, img *Image) error {
+	channels := pixelChannels(img)
+	header := fmt.Sprintf("{'descr': '|u1', 'fortran_order': False, 'shape': (%d, %d, %d), }", img.Height, img.Width, channels)
+	// The magic, version and length take 10 bytes, and the header ends in a newline padded to 64 bytes
+	header += strings.Repeat(" ", 63-(10+len(header))%64) + "\n"
+
+	w := bufio.NewWriter(out)
+	w.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(w, binary.LittleEndian, uint16(len(header)))
+	w.WriteString(header)
+	row := make([]byte, img.Width*channels)
+	for y := img.Height - 1; y >= 0; y-- {
+		for x, p := range img.Pixels[y*img.Width : (y+1)*img.Width] {
+			i := x * channels
+			row[i], row[i+1], row[i+2] = p.Red, p.Green, p.Blue
+			if channels == 4 {
+				row[i+3] = img.Alpha[y*img.Width+x]
+			}
+		}
+		if _, err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,637 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"creditcard/bmp"
+)
+
+const (
+	maxDeskew     = 45      // Largest skew --deskew looks for, in degrees
+	maxDespeckle  = 10      // Largest strength of --despeckle
+	maxMargin     = 10000   // Largest padding --margin-crop keeps, in pixels
+	maxSkewPoints = 1 << 18 // Ink pixels the skew is estimated from, sampled evenly when there are more
+)
+
+// Presets of --preset, each the options it stands for, applied in order. They are documented with the
+// preset operation, so that users can give the options themselves and tune a stage.
+var presets = map[string][]Option{
+	"ocr": {
+		{Name: "--filter", Value: "grayscale"},
+		{Name: "--deskew", Value: "5"},
+		{Name: "--threshold", Value: "adaptive,31,10"},
+		{Name: "--despeckle", Value: "2"},
+		{Name: "--margin-crop", Value: "20"},
+	},
+}
+
+var presetNames = []string{"ocr"}
+
+// The preset operation applies other operations, so it is completed once the registry exists
+func init() {
+	op, _ := findOperation("preset")
+	op.Apply = applyPreset
+}
+
+// Applies the options of a preset in order
+func applyPreset(img *Image, name string, progress rowProgress) (*Image, error) {
+	stages, ok := presets[name]
+	if !ok {
+		return nil, msgError("error.invalid_preset", name)
+	}
+	for _, opt := range stages {
+		op, _ := findOperation(opt.Name)
+		var err error
+		if img, err = op.Apply(img, opt.Value, progress); err != nil {
+			return nil, err
+		}
+	}
+	return img, nil
+}
+
+// Returns the gray level of every pixel, in the order of img.Pixels
+func grayLevels(img *Image) []byte {
+	gray := make([]byte, len(img.Pixels))
+	for i, p := range img.Pixels {
+		gray[i] = bmp.GrayLevel(p)
+	}
+	return gray
+}
+
+// Returns the level that splits the gray levels into ink and paper by Otsu's method, the one that makes
+// the two classes as far apart as their sizes allow: levels below it are ink. Images of a single level
+// have no ink, and the level is 0.
+func otsuLevel(gray []byte) int {
+	var hist [256]int
+	total := 0.0
+	for _, g := range gray {
+		hist[g]++
+		total += float64(g)
+	}
+	level, best := 0, 0.0
+	weight, partial := 0, 0.0
+	for l, n := range hist {
+		weight += n
+		rest := len(gray) - weight
+		if weight == 0 {
+			continue
+		}
+		if rest == 0 {
+			break
+		}
+		partial += float64(l * n)
+		dark, light := partial/float64(weight), (total-partial)/float64(rest)
+		if v := float64(weight) * float64(rest) * (dark - light) * (dark - light); v > best {
+			level, best = l+1, v
+		}
+	}
+	return level
+}
+
+// Reports which pixels are ink, darker than the Otsu level of the image, in the order of img.Pixels
+func inkMask(img *Image) []bool {
+	gray := grayLevels(img)
+	level := otsuLevel(gray)
+	ink := make([]bool, len(gray))
+	for i, g := range gray {
+		ink[i] = int(g) < level
+	}
+	return ink
+}
+
+// Calls visit with the indexes of the pixels of every group of ink pixels that touch each other, corners
+// included. The slice is reused between calls.
+func inkComponents(ink []bool, width, height int, visit func(pixels []int)) {
+	seen := make([]bool, len(ink))
+	var queue []int
+	for start := range ink {
+		if !ink[start] || seen[start] {
+			continue
+		}
+		seen[start] = true
+		queue = append(queue[:0], start)
+		for i := 0; i < len(queue); i++ {
+			x, y := queue[i]%width, queue[i]/width
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					nx, ny := x+dx, y+dy
+					if nx < 0 || ny < 0 || nx >= width || ny >= height {
+						continue
+					}
+					if n := ny*width + nx; ink[n] && !seen[n] {
+						seen[n] = true
+						queue = append(queue, n)
+					}
+				}
+			}
+		}
+		visit(queue)
+	}
+}
+
+// Parses a --deskew value, the largest skew in degrees that is looked for
+func parseDeskew(value string) (float64, error) {
+	angle, err := strconv.ParseFloat(value, 64)
+	if err != nil || !(angle > 0 && angle <= maxDeskew) {
+		return 0, msgError("error.invalid_deskew", value, maxDeskew)
+	}
+	return angle, nil
+}
+
+// Returns the clockwise skew of the text lines in degrees, at most limit either way, to 0.05 degrees
+func estimateSkew(img *Image, limit float64) float64 {
+	xs, ys := inkPoints(img)
+	return skewOfPoints(xs, ys, img.Width, img.Height, limit)
+}
+
+// Returns the coordinates from the top-left corner of the ink pixels of an image, sampled evenly down to
+// maxSkewPoints, or none when there are too few to tell lines of text from specks
+func inkPoints(img *Image) (xs, ys []float64) {
+	ink := inkMask(img)
+	count := 0
+	for _, v := range ink {
+		if v {
+			count++
+		}
+	}
+	if count < 64 {
+		return nil, nil
+	}
+	step := max(count/maxSkewPoints, 1)
+	xs, ys = make([]float64, 0, count/step+1), make([]float64, 0, count/step+1)
+	n := 0
+	for i, v := range ink {
+		if v {
+			if n%step == 0 {
+				xs = append(xs, float64(i%img.Width))
+				ys = append(ys, float64(img.Height-1-i/img.Width))
+			}
+			n++
+		}
+	}
+	return xs, ys
+}
+
+// Returns the clockwise skew in degrees of the lines of ink points on a width x height page, at most
+// limit either way, to 0.05 degrees. The points are projected onto the vertical at each angle; the lines
+// line up, and the projection peaks the most, at the angle of the skew. Pages without a clear peak, such
+// as blank ones, have no skew.
+func skewOfPoints(xs, ys []float64, width, height int, limit float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	// Projections reach past both ends of the image by up to its width
+	bins := make([]float64, 2*width+height+2)
+	score := func(angle float64) float64 {
+		sin, cos := math.Sincos(angle * math.Pi / 180)
+		clear(bins)
+		for i := range xs {
+			bins[int(ys[i]*cos-xs[i]*sin+float64(width)+0.5)]++
+		}
+		sum := 0.0
+		for _, b := range bins {
+			sum += b * b
+		}
+		return sum
+	}
+	search := func(from, to, step float64, best float64) (float64, float64) {
+		top := score(best)
+		for angle := from; angle <= to+1e-9; angle += step {
+			if s := score(angle); s > top {
+				best, top = angle, s
+			}
+		}
+		return best, top
+	}
+	coarse, _ := search(-limit, limit, 0.5, 0)
+	fine, top := search(max(coarse-0.5, -limit), min(coarse+0.5, limit), 0.05, coarse)
+	fine = math.Round(fine/0.05) * 0.05
+	if math.Abs(fine) < 0.05 || top < score(0)*1.01 {
+		return 0
+	}
+	return fine
+}
+
+// Rotates the image against its skew, keeping its size; the corners the rotation uncovers take the
+// --background color, or white, the color of paper, when it is not given
+func applyDeskew(img *Image, limit float64, progress rowProgress) *Image {
+	angle := estimateSkew(img, limit)
+	if angle == 0 {
+		return img
+	}
+	logDetail("info.deskew", angle)
+	fill := background
+	if fill == nil {
+		fill = &Pixel{Red: 255, Green: 255, Blue: 255}
+	}
+	rotated := img.RotateAngle(-angle, fill, progress)
+	x, y := (rotated.Width-img.Width)/2, (rotated.Height-img.Height)/2
+	result := &Image{
+		Width:  img.Width,
+		Height: img.Height,
+		Pixels: bmp.CropPixels(rotated.Pixels, rotated.Width, rotated.Height, x, y, img.Width, img.Height, nil),
+	}
+	if rotated.Alpha != nil {
+		result.Alpha = bmp.CropPixels(rotated.Alpha, rotated.Width, rotated.Height, x, y, img.Width, img.Height, nil)
+	}
+	return result
+}
+
+// Modes of --auto-rotate: what tells which way up the page is
+var autoRotateModes = []string{"text"}
+
+// Largest skew of the text lines --auto-rotate allows for, in degrees
+const autoRotateSkew = 10
+
+// Fewest text lines a page needs for --auto-rotate to turn it, more than the few broad bands of light and
+// shade that pictures such as landscapes show
+const autoRotateMinLines = 5
+
+// Least share by which the profile of the lines one way must stand out more than the profile the other
+// way for the page to be taken as lying on its side
+const autoRotateSideMargin = 1.3
+
+// Least share by which the ink on one side of the text lines must outweigh the ink on the other for the
+// page to be turned over
+const autoRotateFlipMargin = 1.1
+
+// Returns the clockwise angle, 0, 90, 180 or 270, that the text of a page has been turned by, from
+// projection profiles of its ink. Text lines make the profile across them alternate between lines and
+// the gaps between them, far more than the profile along them, which tells upright and upside-down pages
+// from ones lying on their side; each profile is taken at the skew of the lines, as a tilt of a few
+// degrees blurs them. Latin letters rise above the x-height more often than they drop below it, so in
+// every line the ink past the dense band of the x-height shows which side is up. Pages without clear lines
+// or a clear side, such as blank ones or pictures, are taken as upright.
+func textOrientation(img *Image) int {
+	xs, ys := inkPoints(img)
+	if xs == nil {
+		return 0
+	}
+	// The page as it is and turned a quarter counterclockwise, which puts lines running down it across
+	across, upside, ok := lineProfile(xs, ys, img.Width, img.Height)
+	turnedX, turnedY := make([]float64, len(xs)), make([]float64, len(xs))
+	for i := range xs {
+		turnedX[i], turnedY[i] = ys[i], float64(img.Width-1)-xs[i]
+	}
+	down, downUpside, downOK := lineProfile(turnedX, turnedY, img.Height, img.Width)
+	switch {
+	case downOK && (!ok || down > across*autoRotateSideMargin):
+		if downUpside {
+			return 270
+		}
+		return 90
+	case ok && upside:
+		return 180
+	}
+	return 0
+}
+
+// Projects ink points across the lines of text of a width x height page, at their skew, and returns how
+// much the projection varies against its mean, the squared coefficient of variation, and whether the
+// page is upside down. ok is false when the projection holds too few lines or no clear side.
+func lineProfile(xs, ys []float64, width, height int) (contrast float64, upside, ok bool) {
+	sin, cos := math.Sincos(skewOfPoints(xs, ys, width, height, autoRotateSkew) * math.Pi / 180)
+	profile := make([]float64, 2*width+height+2)
+	for i := range xs {
+		profile[int(ys[i]*cos-xs[i]*sin+float64(width)+0.5)]++
+	}
+	// Only the lines of projection that cross the page from side to side are kept, as the short ones by
+	// the corners of a skewed page hold less ink for their length alone, and then only where there is ink
+	span := float64(width-1) * sin
+	from := int(max(0, -span) + float64(width) + 0.5)
+	to := int(min(float64(height-1)*cos, float64(height-1)*cos-span) + float64(width) + 0.5)
+	profile = profile[from : to+1]
+	first := slices.IndexFunc(profile, func(v float64) bool { return v > 0 })
+	last := len(profile) - 1
+	for last > first && profile[last] == 0 {
+		last--
+	}
+	if first < 0 || last-first < 8 {
+		return 0, false, false
+	}
+	profile = profile[first : last+1]
+	mean, variance := 0.0, 0.0
+	for _, v := range profile {
+		mean += v
+	}
+	mean /= float64(len(profile))
+	for _, v := range profile {
+		variance += (v - mean) * (v - mean)
+	}
+	contrast = variance / float64(len(profile)) / (mean * mean)
+
+	lines, above, below := ascenderInk(profile)
+	switch {
+	case lines < autoRotateMinLines:
+		return contrast, false, false
+	case below > above*autoRotateFlipMargin:
+		return contrast, true, true
+	case above > below*autoRotateFlipMargin:
+		return contrast, false, true
+	}
+	return contrast, false, false
+}
+
+// Splits a profile across text lines, top first, into the lines, runs of bins with more than a sliver of
+// ink, and returns how many there are and the ink of all of them above and below their x-height bands,
+// where the bins hold at least half the ink of the fullest one of the line
+func ascenderInk(profile []float64) (lines int, above, below float64) {
+	floor := slices.Max(profile) / 50
+	for start := 0; start < len(profile); {
+		if profile[start] <= floor {
+			start++
+			continue
+		}
+		end := start
+		for end < len(profile) && profile[end] > floor {
+			end++
+		}
+		line := profile[start:end]
+		dense := slices.Max(line) / 2
+		top := slices.IndexFunc(line, func(v float64) bool { return v >= dense })
+		bottom := len(line) - 1
+		for line[bottom] < dense {
+			bottom--
+		}
+		for _, v := range line[:top] {
+			above += v
+		}
+		for _, v := range line[bottom+1:] {
+			below += v
+		}
+		lines++
+		start = end
+	}
+	return lines, above, below
+}
+
+// Turns the page so that its text is upright, by multiples of 90 degrees, which move pixels exactly
+func applyAutoRotate(img *Image, progress rowProgress) (*Image, error) {
+	angle := textOrientation(img)
+	if angle == 0 {
+		return img, nil
+	}
+	logDetail("info.auto_rotate", angle)
+	result, err := img.Rotate(360-angle, progress)
+	return result, localizeError(err)
+}
+
+// A --threshold value: otsu, adaptive with the side of its window and the offset below the window mean
+// that pixels must reach to turn black, or a fixed level
+type thresholdSpec struct {
+	method         string
+	level          int
+	window, offset int
+}
+
+// Parses a --threshold value: otsu, adaptive[,window[,offset]] or a level from 0 to 255
+func parseThreshold(value string) (thresholdSpec, error) {
+	invalid := msgError("error.invalid_threshold", value)
+	parts := strings.Split(value, ",")
+	spec := thresholdSpec{method: parts[0], window: 31, offset: 10}
+	switch {
+	case spec.method == "otsu" && len(parts) == 1:
+	case spec.method == "adaptive" && len(parts) <= 3:
+		var err error
+		if len(parts) > 1 {
+			if spec.window, err = strconv.Atoi(parts[1]); err != nil || spec.window < 3 || spec.window%2 == 0 || spec.window > 1001 {
+				return spec, invalid
+			}
+		}
+		if len(parts) > 2 {
+			if spec.offset, err = strconv.Atoi(parts[2]); err != nil || spec.offset < -255 || spec.offset > 255 {
+				return spec, invalid
+			}
+		}
+	case len(parts) == 1:
+		level, err := strconv.Atoi(value)
+		if err != nil || level < 0 || level > 255 {
+			return spec, invalid
+		}
+		spec.method, spec.level = "level", level
+	default:
+		return spec, invalid
+	}
+	return spec, nil
+}
+
+// Turns every pixel black or white by its gray level. Fixed and Otsu thresholds compare every pixel with
+// one level; the adaptive threshold compares each pixel with the mean of the window around it less the
+// offset, so that text stays black on unevenly lit or yellowed pages. Alpha is kept.
+func applyThreshold(img *Image, spec thresholdSpec, progress rowProgress) *Image {
+	gray := grayLevels(img)
+	level := spec.level
+	if spec.method == "otsu" {
+		level = otsuLevel(gray)
+	}
+
+	// Sums of the levels above and to the left of each pixel, for the window means
+	var sums []int64
+	stride := img.Width + 1
+	if spec.method == "adaptive" {
+		sums = make([]int64, stride*(img.Height+1))
+		for y := 0; y < img.Height; y++ {
+			var row int64
+			for x := 0; x < img.Width; x++ {
+				row += int64(gray[y*img.Width+x])
+				sums[(y+1)*stride+x+1] = sums[y*stride+x+1] + row
+			}
+		}
+	}
+
+	result := *img
+	result.Indices = nil
+	result.Pixels = make([]Pixel, len(img.Pixels))
+	half := spec.window / 2
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			g := int(gray[y*img.Width+x])
+			white := g >= level
+			if sums != nil {
+				x0, x1 := max(x-half, 0), min(x+half+1, img.Width)
+				y0, y1 := max(y-half, 0), min(y+half+1, img.Height)
+				sum := sums[y1*stride+x1] - sums[y0*stride+x1] - sums[y1*stride+x0] + sums[y0*stride+x0]
+				white = int64(g+spec.offset)*int64((x1-x0)*(y1-y0)) > sum
+			}
+			if white {
+				result.Pixels[y*img.Width+x] = Pixel{Red: 255, Green: 255, Blue: 255}
+			}
+		}
+		progress.Report(y+1, img.Height)
+	}
+	return &result
+}
+
+// Parses a --despeckle value, a strength from 1 to maxDespeckle
+func parseDespeckle(value string) (int, error) {
+	strength, err := strconv.Atoi(value)
+	if err != nil || strength < 1 || strength > maxDespeckle {
+		return 0, msgError("error.invalid_despeckle", value, maxDespeckle)
+	}
+	return strength, nil
+}
+
+// Removes salt-and-pepper noise within a window 2 * strength + 1 pixels wide. Black-and-white images, such
+// as thresholded scans, lose the groups of touching black pixels, and the holes in black of white ones,
+// smaller than half the window: what a median filter of the window would remove, without rounding off the
+// corners of characters as it does. Other images go through that median filter, channel by channel.
+func applyDespeckle(img *Image, strength int, progress rowProgress) *Image {
+	window := 2*strength + 1
+	black, white := Pixel{}, Pixel{Red: 255, Green: 255, Blue: 255}
+	ink := make([]bool, len(img.Pixels))
+	for i, p := range img.Pixels {
+		if p != black && p != white {
+			return medianFilter(img, strength, progress)
+		}
+		ink[i] = p == black
+	}
+
+	result := *img
+	result.Indices = nil
+	result.Pixels = make([]Pixel, len(img.Pixels))
+	copy(result.Pixels, img.Pixels)
+	paint := func(color Pixel) func(pixels []int) {
+		return func(pixels []int) {
+			if len(pixels) < window*window/2 {
+				for _, i := range pixels {
+					result.Pixels[i] = color
+				}
+			}
+		}
+	}
+	inkComponents(ink, img.Width, img.Height, paint(white))
+	for i := range ink {
+		ink[i] = !ink[i]
+	}
+	inkComponents(ink, img.Width, img.Height, paint(black))
+	progress.Report(img.Height, img.Height)
+	return &result
+}
+
+// Replaces every channel of every pixel by the median of the channel within a square of radius pixels
+// around it, the edge pixels repeated beyond the edges. The histogram of the square is updated as it
+// slides along each row, as in Huang's algorithm, so that larger radii cost little more. Alpha is kept.
+func medianFilter(img *Image, radius int, progress rowProgress) *Image {
+	result := *img
+	result.Indices = nil
+	result.Pixels = make([]Pixel, len(img.Pixels))
+	half := (2*radius + 1) * (2*radius + 1) / 2
+	column := func(x int) int { return min(max(x, 0), img.Width-1) }
+	channels := []func(p *Pixel) *byte{
+		func(p *Pixel) *byte { return &p.Red },
+		func(p *Pixel) *byte { return &p.Green },
+		func(p *Pixel) *byte { return &p.Blue },
+	}
+	rows := make([]int, 2*radius+1)
+	for y := 0; y < img.Height; y++ {
+		for i := range rows {
+			rows[i] = min(max(y-radius+i, 0), img.Height-1) * img.Width
+		}
+		for _, channel := range channels {
+			// The median is the level with fewer than half of the square below it, and more up to it
+			var hist [256]int
+			for _, row := range rows {
+				for dx := -radius; dx <= radius; dx++ {
+					hist[*channel(&img.Pixels[row+column(dx)])]++
+				}
+			}
+			median, below := 0, 0
+			for below+hist[median] <= half {
+				below += hist[median]
+				median++
+			}
+			for x := 0; x < img.Width; x++ {
+				if x > 0 {
+					out, in := column(x-radius-1), column(x+radius)
+					for _, row := range rows {
+						gone, come := int(*channel(&img.Pixels[row+out])), int(*channel(&img.Pixels[row+in]))
+						hist[gone]--
+						hist[come]++
+						if gone < median {
+							below--
+						}
+						if come < median {
+							below++
+						}
+					}
+					for below > half {
+						median--
+						below -= hist[median]
+					}
+					for below+hist[median] <= half {
+						below += hist[median]
+						median++
+					}
+				}
+				*channel(&result.Pixels[y*img.Width+x]) = byte(median)
+			}
+		}
+		progress.Report(y+1, img.Height)
+	}
+	return &result
+}
+
+// Parses a --margin-crop value, the padding in pixels kept around the content
+func parseMarginCrop(value string) (int, error) {
+	padding, err := strconv.Atoi(value)
+	if err != nil || padding < 0 || padding > maxMargin {
+		return 0, msgError("error.invalid_margin_crop", value, maxMargin)
+	}
+	return padding, nil
+}
+
+// Crops the image to the box holding its ink, with padding pixels to spare on every side where the image
+// has them. Ink that touches the edges of the image or spans half its width or height, such as the dark
+// border a scanner lid leaves, does not count as content; text is made of far smaller groups. Stray marks
+// out in the margins, which hold less than 1/2000 of the content from the side they are on, are cut away
+// too. Images without content are returned unchanged.
+func applyMarginCrop(img *Image, padding int, progress rowProgress) *Image {
+	columns, rows := make([]int, img.Width), make([]int, img.Height)
+	total := 0
+	inkComponents(inkMask(img), img.Width, img.Height, func(pixels []int) {
+		l, r, b, t := img.Width, -1, img.Height, -1
+		for _, i := range pixels {
+			x, y := i%img.Width, i/img.Width
+			l, r, b, t = min(l, x), max(r, x), min(b, y), max(t, y)
+		}
+		if l == 0 || b == 0 || r == img.Width-1 || t == img.Height-1 || 2*(r-l+1) >= img.Width || 2*(t-b+1) >= img.Height {
+			return
+		}
+		for _, i := range pixels {
+			columns[i%img.Width]++
+			rows[i/img.Width]++
+		}
+		total += len(pixels)
+	})
+	if total == 0 {
+		return img
+	}
+	// The first index from either end at which the content seen so far exceeds the share of stray marks
+	bound := func(counts []int, from, step int) int {
+		seen := 0
+		for i := from; ; i += step {
+			if seen += counts[i]; seen*2000 > total {
+				return i
+			}
+		}
+	}
+	left, right := bound(columns, 0, 1), bound(columns, img.Width-1, -1)
+	bottom, top := bound(rows, 0, 1), bound(rows, img.Height-1, -1)
+	left, right = max(left-padding, 0), min(right+padding, img.Width-1)
+	bottom, top = max(bottom-padding, 0), min(top+padding, img.Height-1)
+
+	// Rows are stored bottom-up, so the topmost row of the box has the highest index
+	x, y, w, h := left, img.Height-1-top, right-left+1, top-bottom+1
+	result := &Image{
+		Width:  w,
+		Height: h,
+		Pixels: bmp.CropPixels(img.Pixels, img.Width, img.Height, x, y, w, h, progress),
+	}
+	if img.Alpha != nil {
+		result.Alpha = bmp.CropPixels(img.Alpha, img.Width, img.Height, x, y, w, h, nil)
+	}
+	return result
+}
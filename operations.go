@@ -0,0 +1,1427 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"creditcard/bmp"
+)
+
+// Describes a single parameter of an operation
+type Param struct {
+	Name    string   // Parameter name shown to the user
+	Help    string   // Short explanation of the parameter
+	Kind    string   // "enum", "int", "number", "file" or "text"
+	Choices []string // Allowed values for enum parameters
+	Min     int      // Lower bound for int parameters, and for number parameters when below Max
+	Max     int      // Upper bound for int parameters (0 means bounded by Bound) and number parameters
+	Bound   string   // "width" or "height" when the upper bound depends on the image
+	Unit    string   // "px", "percent" or "degrees" for int and number parameters measured in them
+	Default string   // Value used when the user does not specify one
+}
+
+// Describes an operation that can be applied to an image by the apply command
+type Operation struct {
+	Name      string   // Option name without the leading dashes (e.g. "mirror")
+	Short     string   // Single-letter alias used as "-m value", or empty
+	Summary   string   // One-line description
+	Details   string   // Longer description shown by help pages
+	Params    []Param  // Parameters that make up the option value
+	Separator string   // Joins multiple parameter values into one option value
+	Examples  []string // Example option values
+	// Set when values contain commas themselves, so they are not split into one option per value
+	WholeValue bool
+	// Value of the option when it is given without "=", for options whose value may be left out; a value
+	// after a space is then taken for a file name
+	Implicit string
+	// Validates a value while the command line is parsed; limits that depend on the image are left to Apply
+	Check func(value string) error
+	Apply func(img *Image, value string, progress rowProgress) (*Image, error)
+	// Set instead of Apply by guards, which decide whether the next stage runs rather than change the image
+	Guard func(img *Image, value string) (bool, error)
+	// Records the stage in a library pipeline instead of applying it, for an image of the given size, so that
+	// it runs fused with its neighbors; false leaves the value to Apply. Nil for stages that never fuse.
+	Fuse func(p *bmp.Pipeline, value string, width, height int) bool
+	// Estimates what the stage costs on an image of the given size before it runs, for the warnings of
+	// --warn-memory and --warn-time. Nil for stages that keep the size and look at no neighbors.
+	Cost func(value string, width, height int) stageCost
+	// Set when every pixel stays at its position, so regions of interest remain valid
+	KeepsLayout bool
+	// Color encoding the stage needs its input in, "srgb" or "linear", or empty when it works on either.
+	// The pipeline converts the image first when it is in the other encoding.
+	ColorSpace string
+}
+
+// Registry of all operations supported by the apply command, in display order
+var operations = []Operation{
+	{
+		Name:    "mirror",
+		Short:   "m",
+		Summary: "mirrors the image along the specified axis",
+		Details: "Flips the image left-to-right (horizontal) or top-to-bottom (vertical). " +
+			"The short forms h, hor, horizontally, v, ver and vertically are also accepted.",
+		Params: []Param{
+			{Name: "axis", Help: "axis to mirror along", Kind: "enum", Choices: []string{"horizontal", "vertical"}, Default: "horizontal"},
+		},
+		Examples: []string{"horizontal", "vertical"},
+		Check: func(value string) error {
+			_, err := parseMirror(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			mode, err := parseMirror(value)
+			if err != nil {
+				return nil, err
+			}
+			result, err := img.Mirror(mode, progress)
+			return result, localizeError(err)
+		},
+		Fuse: func(p *bmp.Pipeline, value string, width, height int) bool {
+			mode, err := parseMirror(value)
+			if err == nil {
+				p.Mirror(mode)
+			}
+			return err == nil
+		},
+	},
+	{
+		Name:    "filter",
+		Short:   "f",
+		Summary: "applies a specified filter to the image",
+		Details: "blue, red and green keep a single color channel; grayscale keeps the luminance of each pixel, " +
+			"weighting the channels by Rec. 709 in linear light as photo editors do; " +
+			"negative inverts every channel; pixelate paints 20x20 blocks with their average color, or blocks of " +
+			"another size given as pixelate:size=16, and --pixelate limits it to part of the image; " +
+			"blur averages each pixel with its neighbors within 3 pixels; --blur sets the radius and kernel; " +
+			"sharpen strengthens the difference between each pixel and its neighbors; edge keeps only the edges, " +
+			"found with the Sobel operator; emboss turns the image into gray relief. --convolve applies a kernel of your own.",
+		Params: []Param{
+			{Name: "type", Help: "filter to apply", Kind: "enum", Choices: bmp.Filters, Default: "grayscale"},
+		},
+		Examples:    []string{"grayscale", "negative", "sharpen", "edge", "pixelate:size=8"},
+		KeepsLayout: true,
+		ColorSpace:  "srgb",
+		Check: func(value string) error {
+			_, _, err := parseFilter(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			name, size, err := parseFilter(value)
+			if err != nil {
+				return nil, err
+			}
+			if size > 0 {
+				result, err := img.Pixelate(0, 0, img.Width, img.Height, size, progress)
+				return result, localizeError(err)
+			}
+			result, err := img.Filter(name, progress)
+			return result, localizeError(err)
+		},
+		Fuse: func(p *bmp.Pipeline, value string, width, height int) bool {
+			name, size, err := parseFilter(value)
+			if err == nil && size == 0 {
+				p.Filter(name)
+			}
+			return err == nil && size == 0
+		},
+	},
+	{
+		Name:    "brightness",
+		Summary: "brightens or darkens the image",
+		Details: "Every channel is shifted by the amount in percent of the full range and clamped to 0-255.",
+		Params: []Param{
+			{Name: "amount", Help: "percent of the full range to add", Kind: "int", Min: -100, Max: 100, Unit: "percent", Default: "20"},
+		},
+		Examples:    []string{"20", "-35"},
+		KeepsLayout: true,
+		ColorSpace:  "srgb",
+		Check: func(value string) error {
+			_, err := parseAdjustment("brightness", value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			amount, err := parseAdjustment("brightness", value)
+			if err != nil {
+				return nil, err
+			}
+			return applyCurve(img, brightnessCurve(amount), progress), nil
+		},
+	},
+	{
+		Name:    "contrast",
+		Summary: "raises or lowers the contrast of the image",
+		Details: "Channels move away from middle gray for positive amounts and towards it for negative ones; " +
+			"-100 leaves a flat gray and 100 pushes every other level to black or white.",
+		Params: []Param{
+			{Name: "amount", Help: "strength of the change", Kind: "int", Min: -100, Max: 100, Default: "20"},
+		},
+		Examples:    []string{"25", "-50"},
+		KeepsLayout: true,
+		ColorSpace:  "srgb",
+		Check: func(value string) error {
+			_, err := parseAdjustment("contrast", value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			amount, err := parseAdjustment("contrast", value)
+			if err != nil {
+				return nil, err
+			}
+			return applyCurve(img, contrastCurve(amount), progress), nil
+		},
+	},
+	{
+		Name:    "saturation",
+		Summary: "makes the colors more or less vivid",
+		Details: "Each pixel moves away from the gray of its own brightness for positive amounts and towards it for negative ones; " +
+			"-100 gives a grayscale image.",
+		Params: []Param{
+			{Name: "amount", Help: "strength of the change", Kind: "int", Min: -100, Max: 100, Default: "20"},
+		},
+		Examples:    []string{"30", "-100"},
+		KeepsLayout: true,
+		ColorSpace:  "srgb",
+		Check: func(value string) error {
+			_, err := parseAdjustment("saturation", value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			amount, err := parseAdjustment("saturation", value)
+			if err != nil {
+				return nil, err
+			}
+			return applySaturation(img, amount, progress), nil
+		},
+	},
+	{
+		Name:    "gamma",
+		Summary: "applies a gamma curve to brighten or darken the midtones",
+		Details: "Values above 1 brighten the midtones and values below 1 darken them, while black and white stay put; " +
+			"1 leaves the image unchanged. Each channel v becomes 255 * (v/255)^(1/gamma).",
+		Params: []Param{
+			{Name: "gamma", Help: "positive number, e.g. 2.2", Kind: "number", Default: "1.5"},
+		},
+		Examples:    []string{"1.5", "0.8"},
+		KeepsLayout: true,
+		ColorSpace:  "srgb",
+		Check: func(value string) error {
+			_, err := parseGamma(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			gamma, err := parseGamma(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyCurve(img, gammaCurve(gamma), progress), nil
+		},
+	},
+	{
+		Name:    "auto-expose",
+		Summary: "corrects the exposure so that a neutral area becomes middle gray",
+		Details: "The mean luminance of the area, e.g. a gray card in the shot, is measured in linear light and the whole image " +
+			"is brightened or darkened by the factor that brings it to 18% gray, as a longer or shorter exposure would; " +
+			"highlights pushed past white are clipped. The area is given in pixels from the top-left corner, " +
+			"so the same value corrects every photo of a batch shot with the card in place.",
+		Params: []Param{
+			{Name: "area", Help: "sample area as from:x,y,w,h", Kind: "text", Default: "from:0,0,16,16"},
+		},
+		Examples:    []string{"from:120,80,40,40"},
+		WholeValue:  true,
+		KeepsLayout: true,
+		ColorSpace:  "srgb",
+		Check: func(value string) error {
+			_, err := parseAutoExpose(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			area, err := parseAutoExpose(value)
+			if err != nil {
+				return nil, err
+			}
+			gain, err := exposureGain(img, area)
+			if err != nil {
+				return nil, err
+			}
+			return img.Expose(gain, progress), nil
+		},
+	},
+	{
+		Name:    "blur",
+		Summary: "blurs the image with the given radius",
+		Details: "gaussian weighs the neighbors by a bell curve for a soft blur; box averages them evenly. " +
+			"The kernel is applied to rows and columns in turn, so large radii stay fast. Alpha is left unchanged. " +
+			"Put --colorspace=linear before it to blend the colors in linear light.",
+		Params: []Param{
+			{Name: "radius", Help: "radius in pixels", Kind: "int", Min: 1, Max: bmp.MaxBlurRadius, Unit: "px", Default: "5"},
+			{Name: "kernel", Help: "blur kernel", Kind: "enum", Choices: bmp.BlurKernels, Default: "gaussian"},
+		},
+		Separator:   ",",
+		Examples:    []string{"5", "12,box"},
+		WholeValue:  true,
+		KeepsLayout: true,
+		Check: func(value string) error {
+			_, _, err := parseBlur(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			radius, kernel, err := parseBlur(value)
+			if err != nil {
+				return nil, err
+			}
+			result, err := img.Blur(radius, kernel, progress)
+			return result, localizeError(err)
+		},
+		// Rows are blurred into floats first, and every pixel takes 2r+1 taps in each direction
+		Cost: func(value string, width, height int) stageCost {
+			radius, _, _ := parseBlur(value)
+			return passCost(width, height, float64(2*(2*radius+1)+costPassSteps), 12)
+		},
+	},
+	{
+		Name:    "convolve",
+		Summary: "weighs each pixel and its neighbors with a kernel of your own",
+		Details: "The kernel has 9 or 25 weights for 3x3 or 5x5, given row by row from the top down. Unless the " +
+			"weights add up to 0, they are divided by their sum, so 1,1,1,1,1,1,1,1,1 averages. Pixels beyond " +
+			"the borders repeat the border pixel (clamp), come from the opposite side (wrap) or are reflected " +
+			"across the border (mirror). Alpha is left unchanged.",
+		Params: []Param{
+			{Name: "kernel", Help: "weights separated by commas", Kind: "text", Default: "0,-1,0,-1,5,-1,0,-1,0"},
+			{Name: "edge", Help: "pixels read beyond the borders", Kind: "enum", Choices: bmp.EdgeModes, Default: "clamp"},
+		},
+		Separator:   ":",
+		Examples:    []string{"1,2,1,2,4,2,1,2,1", "0,1,0,1,-4,1,0,1,0:mirror"},
+		WholeValue:  true,
+		KeepsLayout: true,
+		ColorSpace:  "srgb",
+		Check: func(value string) error {
+			_, _, err := parseConvolve(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			kernel, edge, err := parseConvolve(value)
+			if err != nil {
+				return nil, err
+			}
+			result, err := img.Convolve(kernel, edge, progress)
+			return result, localizeError(err)
+		},
+		Cost: func(value string, width, height int) stageCost {
+			kernel, _, _ := parseConvolve(value)
+			return passCost(width, height, float64(len(kernel)+costPassSteps), 12)
+		},
+	},
+	{
+		Name:    "rotate",
+		Short:   "r",
+		Summary: "rotates the image by the specified angle",
+		Details: "Positive angles and right rotate clockwise, negative angles and left rotate counterclockwise. " +
+			"Rotating by 90 or 270 degrees swaps the image width and height. Any other angle, such as 37.5, is " +
+			"resampled bilinearly onto a canvas enlarged to hold the whole image; the corners it uncovers take " +
+			"the --background color, and are transparent for images with alpha or black for others when it is not given.",
+		Params: []Param{
+			{Name: "angle", Help: "rotation in degrees, right, left or any number", Kind: "text", Default: "right"},
+		},
+		Examples: []string{"right", "-90", "180", "37.5"},
+		Check: func(value string) error {
+			_, err := parseRotate(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			angle, err := parseRotate(value)
+			if err != nil {
+				return nil, err
+			}
+			return rotateImage(img, angle, progress)
+		},
+		Fuse: func(p *bmp.Pipeline, value string, width, height int) bool {
+			angle, err := parseRotate(value)
+			if err != nil || math.Mod(angle, 90) != 0 {
+				return false
+			}
+			p.Rotate(int(math.Mod(angle, 360)))
+			return true
+		},
+		Cost: rotateCost,
+	},
+	{
+		Name:    "crop",
+		Short:   "c",
+		Summary: "crops the image based on the specified offset and dimensions",
+		Details: "Offsets are measured in pixels from the top-left corner; negative offsets count back from the right " +
+			"and bottom edges. When width and height are omitted the crop extends to the bottom-right corner. " +
+			"Any number can be a percentage of the image width or height, as in 10%-10%-80%-80%, or a physical length " +
+			"at a resolution, as in 1in@300dpi, and the width and height may be joined as WxH, as in center-640x480. " +
+			"Instead of the offsets, an anchor (top-left, top, top-right, left, center, right, bottom-left, bottom " +
+			"or bottom-right) followed by the width and height places the area against that side or in the middle.",
+		Params: []Param{
+			{Name: "offsetX", Help: "left edge of the crop area", Kind: "int", Min: 0, Bound: "width", Unit: "px", Default: "0"},
+			{Name: "offsetY", Help: "top edge of the crop area", Kind: "int", Min: 0, Bound: "height", Unit: "px", Default: "0"},
+			{Name: "width", Help: "width of the crop area", Kind: "int", Min: 1, Bound: "width", Unit: "px"},
+			{Name: "height", Help: "height of the crop area", Kind: "int", Min: 1, Bound: "height", Unit: "px"},
+		},
+		Separator: "-",
+		Examples:  []string{"20-20-100-100", "45-45", "10%-10%-80%-80%", "center-200-150", "-100--100"},
+		Check: func(value string) error {
+			_, _, err := parseCropNumbers(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			x, y, w, h, err := parseCrop(value, img.Width, img.Height)
+			if err != nil {
+				return nil, err
+			}
+			result, err := img.Crop(x, y, w, h, progress)
+			return result, localizeError(err)
+		},
+		Fuse: func(p *bmp.Pipeline, value string, width, height int) bool {
+			x, y, w, h, err := parseCrop(value, width, height)
+			if err == nil {
+				p.Crop(x, y, w, h)
+			}
+			return err == nil
+		},
+		Cost: func(value string, width, height int) stageCost {
+			if _, _, w, h, err := parseCrop(value, width, height); err == nil {
+				return passCost(w, h, 1, 0)
+			}
+			return passCost(width, height, 1, 0)
+		},
+	},
+	{
+		Name:    "pixelate",
+		Summary: "pixelates part of the image, such as faces or license plates",
+		Details: "The area is given as for --crop: offsets from the top-left corner and a size, any of them in percent " +
+			"of the image side, or an anchor and a size. It is painted in blocks of size pixels, 20 by default, " +
+			"laid from its top-left corner, with the average color of each block; the rest of the image stays sharp.",
+		Params: []Param{
+			{Name: "area", Help: "area to pixelate, as for --crop", Kind: "text", Default: "0-0-100-100"},
+			{Name: "size", Help: "side of the blocks in pixels", Kind: "int", Min: 1, Bound: "width", Unit: "px", Default: "20"},
+		},
+		Separator:   ":",
+		Examples:    []string{"120-80-64-48", "40-30-200-60:8", "center-25%-25%:12"},
+		KeepsLayout: true,
+		ColorSpace:  "srgb",
+		Check:       checkPixelate,
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			x, y, w, h, size, err := parsePixelate(value, img.Width, img.Height)
+			if err != nil {
+				return nil, err
+			}
+			result, err := img.Pixelate(x, y, w, h, size, progress)
+			return result, localizeError(err)
+		},
+	},
+	{
+		Name:    "smartcrop",
+		Summary: "crops a window of the given size around the most detailed part of the image",
+		Details: "Picks the WxH window with the most edge energy, the luminance differences between neighboring pixels, " +
+			"instead of the center, so thumbnails keep the subject in frame. Flat images are cropped at the center. " +
+			"When --hints came before, the window covering the most of the hinted regions wins and energy only breaks ties.",
+		Params: []Param{
+			{Name: "size", Help: "window as WxH, no larger than the image", Kind: "text", Default: "100x100"},
+		},
+		Examples:   []string{"12x8", "400x400"},
+		ColorSpace: "srgb",
+		Check: func(value string) error {
+			_, _, err := parseSmartCrop(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			width, height, err := parseSmartCrop(value)
+			if err != nil {
+				return nil, err
+			}
+			return applySmartCrop(img, width, height, progress)
+		},
+	},
+	{
+		Name:    "trim",
+		Summary: "crops away the fully transparent border of 32-bit images",
+		Details: "Keeps the smallest box holding every pixel that is not fully transparent, " +
+			"as sprite packers do before placing images in an atlas. Images without alpha are left unchanged.",
+		Params: []Param{
+			{Name: "mode", Help: "what counts as empty", Kind: "enum", Choices: trimModes, Default: "alpha"},
+		},
+		Examples: []string{"alpha"},
+		Check: func(value string) error {
+			if !contains(trimModes, value) {
+				return msgError("error.invalid_trim", value)
+			}
+			return nil
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			if !contains(trimModes, value) {
+				return nil, msgError("error.invalid_trim", value)
+			}
+			return applyTrim(img, progress)
+		},
+	},
+	{
+		Name:    "deskew",
+		Summary: "straightens scanned pages whose text lines are tilted",
+		Details: "Finds the angle, up to the given number of degrees either way, at which the dark pixels line up best " +
+			"along horizontal lines, and rotates the image back by it. The size is kept; the corners the rotation " +
+			"uncovers take the --background color, or white when it is not given. Pages without text lines, and " +
+			"pages tilted by less than 0.05 degrees, are left unchanged.",
+		Params: []Param{
+			{Name: "max", Help: "largest skew looked for", Kind: "number", Min: 0, Max: maxDeskew, Unit: "degrees", Default: "5"},
+		},
+		Examples:   []string{"5", "15"},
+		ColorSpace: "srgb",
+		Check: func(value string) error {
+			_, err := parseDeskew(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			limit, err := parseDeskew(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyDeskew(img, limit, progress), nil
+		},
+	},
+	{
+		Name:    "auto-rotate",
+		Summary: "turns scanned pages whose text is upside down or on its side upright",
+		Details: "text finds the lines of text from how the ink spreads along and across the page, and which side " +
+			"is up from the ascenders of the letters rising above the lines more often than descenders drop below " +
+			"them, as in Latin script, and rotates the page by 90, 180 or 270 degrees to put it upright, as the " +
+			"back sides of duplex scans need. Lines skewed by up to 10 degrees are allowed for; give --deskew " +
+			"after it to straighten them. Pages without clear lines or a clear side, such as pictures, are left " +
+			"unchanged.",
+		Params: []Param{
+			{Name: "mode", Help: "what tells which way is up", Kind: "enum", Choices: autoRotateModes, Default: "text"},
+		},
+		Examples:   []string{"text"},
+		ColorSpace: "srgb",
+		Check: func(value string) error {
+			if !contains(autoRotateModes, value) {
+				return msgError("error.invalid_auto_rotate", value)
+			}
+			return nil
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			if !contains(autoRotateModes, value) {
+				return nil, msgError("error.invalid_auto_rotate", value)
+			}
+			return applyAutoRotate(img, progress)
+		},
+	},
+	{
+		Name:    "threshold",
+		Summary: "turns every pixel black or white, as OCR engines and fax machines want",
+		Details: "A level from 0 to 255 makes pixels at least that bright white and the others black; otsu picks the " +
+			"level that best separates the dark and light pixels of the image. adaptive compares each pixel with the " +
+			"mean of the window pixels wide around it instead, and makes it black when it is darker than that mean " +
+			"less offset, so that text stays legible on unevenly lit, shadowed or yellowed pages. Larger windows suit " +
+			"larger text; larger offsets keep more faint strokes white.",
+		Params: []Param{
+			{Name: "method", Help: "otsu, adaptive or a level from 0 to 255", Kind: "text", Default: "otsu"},
+			{Name: "window", Help: "odd side of the adaptive window", Kind: "int", Min: 3, Max: 1001, Unit: "px", Default: "31"},
+			{Name: "offset", Help: "how much darker than the window mean ink is", Kind: "int", Min: -255, Max: 255, Default: "10"},
+		},
+		Separator:   ",",
+		Examples:    []string{"otsu", "128", "adaptive,31,10"},
+		WholeValue:  true,
+		KeepsLayout: true,
+		ColorSpace:  "srgb",
+		Check: func(value string) error {
+			_, err := parseThreshold(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			spec, err := parseThreshold(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyThreshold(img, spec, progress), nil
+		},
+	},
+	{
+		Name:    "despeckle",
+		Summary: "removes salt-and-pepper noise, such as the specks of dust on scanned pages",
+		Details: "Works within a window 2 * strength + 1 pixels wide. On black-and-white images, such as the " +
+			"output of --threshold, every group of touching black pixels, corners included, covering less than " +
+			"half the window turns white, and every such group of white pixels in black turns black, so specks " +
+			"and pinholes go while the corners of characters stay sharp. Other images go through a median filter " +
+			"of the window, which replaces each channel of each pixel by its median around it. Without a value " +
+			"the strength is 1.",
+		Params: []Param{
+			{Name: "strength", Help: "radius of the window", Kind: "int", Min: 1, Max: maxDespeckle, Unit: "px", Default: "1"},
+		},
+		Examples:    []string{"1", "3"},
+		Implicit:    "1",
+		KeepsLayout: true,
+		ColorSpace:  "srgb",
+		Check: func(value string) error {
+			_, err := parseDespeckle(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			strength, err := parseDespeckle(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyDespeckle(img, strength, progress), nil
+		},
+	},
+	{
+		Name:    "margin-crop",
+		Summary: "crops the blank margins of a page, keeping some padding around the text",
+		Details: "Crops to the box holding every group of dark pixels, told apart as --threshold=otsu does, with the " +
+			"given padding to spare on each side where the page has it. Groups that touch the edges of the image or span " +
+			"half its width or height, such as the dark border a scanner leaves around the paper, are not content and " +
+			"are cut away unless other content surrounds them. Blank pages are left unchanged.",
+		Params: []Param{
+			{Name: "padding", Help: "margin kept around the content", Kind: "int", Min: 0, Max: maxMargin, Unit: "px", Default: "20"},
+		},
+		Examples:   []string{"20", "0"},
+		ColorSpace: "srgb",
+		Check: func(value string) error {
+			_, err := parseMarginCrop(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			padding, err := parseMarginCrop(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyMarginCrop(img, padding, progress), nil
+		},
+	},
+	{
+		Name:    "preset",
+		Summary: "applies a tuned sequence of options for a common task",
+		Details: "ocr prepares scanned pages for OCR engines such as Tesseract. It is the same as " +
+			"--filter=grayscale --deskew=5 --threshold=adaptive,31,10 --despeckle=2 --margin-crop=20, applied in that " +
+			"order: the page is made gray, straightened, turned black and white against the local background, cleaned " +
+			"of specks and cropped to its text. To tune a stage, give those options instead with the value changed, " +
+			"such as a larger --threshold window for large print or a stronger --despeckle for dusty scans.",
+		Params: []Param{
+			{Name: "name", Help: "preset", Kind: "enum", Choices: presetNames, Default: "ocr"},
+		},
+		Examples:   []string{"ocr"},
+		ColorSpace: "srgb",
+		Check: func(value string) error {
+			if !contains(presetNames, value) {
+				return msgError("error.invalid_preset", value)
+			}
+			return nil
+		},
+		// Apply is set by init, as it looks up the operations of the preset in this registry
+	},
+	{
+		Name:    "outline",
+		Summary: "draws a stroke around the content, as for game sprites and stickers",
+		Details: "The content is every pixel that is not fully transparent or, in images without alpha, every pixel " +
+			"that differs from the top-left corner. Background pixels within the width of the content are painted " +
+			"with the color and made opaque; the stroke is clipped at the edges of the image.",
+		Params: []Param{
+			{Name: "width", Help: "stroke width in pixels", Kind: "int", Min: 1, Max: maxOutline, Unit: "px", Default: "2"},
+			{Name: "color", Help: "stroke color as rrggbb", Kind: "text", Default: "000000"},
+		},
+		Separator:   ",",
+		Examples:    []string{"2,ffffff", "4,#000000"},
+		WholeValue:  true,
+		KeepsLayout: true,
+		ColorSpace:  "srgb",
+		Check: func(value string) error {
+			_, _, err := parseOutline(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			width, color, err := parseOutline(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyOutline(img, width, color, progress), nil
+		},
+	},
+	{
+		Name:    "colormap",
+		Summary: "maps single-channel data to false colors, e.g. depth or scientific measurements",
+		Details: "Each gray level, or the luminance of pixels that are not gray, is replaced by its color along the map " +
+			"from the lowest value to the highest. viridis and magma are perceptually uniform, so equal steps in the data " +
+			"look equally large and the result stays readable in grayscale; jet is the classic rainbow from dark blue to dark red.",
+		Params: []Param{
+			{Name: "map", Help: "colormap", Kind: "enum", Choices: colormapNames, Default: "viridis"},
+		},
+		Examples:    []string{"viridis", "jet"},
+		KeepsLayout: true,
+		ColorSpace:  "srgb",
+		Check: func(value string) error {
+			_, err := parseColormap(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			name, err := parseColormap(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyColormap(img, name, progress), nil
+		},
+	},
+	{
+		Name:    "bitplane",
+		Summary: "shows one bit of a channel as a black and white image",
+		Details: "Pixels whose channel has the bit set turn white and the others black; bit 0 is the least significant " +
+			"and 7 the most. Low planes of natural photos look like noise, so structure in them hints at hidden data, " +
+			"and high planes show the banding left by quantization. The result is opaque.",
+		Params: []Param{
+			{Name: "channel", Help: "channel to read", Kind: "enum", Choices: bitplaneChannels, Default: "red"},
+			{Name: "bit", Help: "bit, 0 for the least significant", Kind: "int", Min: 0, Max: 7, Default: "0"},
+		},
+		Separator:   ":",
+		Examples:    []string{"red:0", "green:7"},
+		KeepsLayout: true,
+		Check: func(value string) error {
+			_, _, err := parseBitplane(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			channel, bit, err := parseBitplane(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyBitplane(img, channel, bit, progress), nil
+		},
+	},
+	{
+		Name:    "pixelsort",
+		Summary: "sorts runs of bright pixels by luminance, the pixel sorting glitch effect",
+		Details: "Along every row, or every column for vertical, each run of pixels brighter than the threshold is sorted " +
+			"from dark to light, left to right or top to bottom; darker pixels stay in place and end the runs. " +
+			"Lower thresholds give longer streaks. The result depends only on the image, so runs repeat exactly.",
+		Params: []Param{
+			{Name: "threshold", Help: "luminance above which pixels are sorted", Kind: "int", Min: 0, Max: 255, Default: "100"},
+			{Name: "direction", Help: "lines to sort along", Kind: "enum", Choices: sortDirections, Default: "horizontal"},
+		},
+		Separator:  ",",
+		Examples:   []string{"100", "60,vertical"},
+		WholeValue: true,
+		ColorSpace: "srgb",
+		Check: func(value string) error {
+			_, _, err := parsePixelSort(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			threshold, direction, err := parsePixelSort(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyPixelSort(img, threshold, direction, progress), nil
+		},
+	},
+	{
+		Name:    "rowshift",
+		Summary: "shifts rows sideways by random amounts, wrapping around the edges",
+		Details: "Every row moves left or right by up to amount pixels. The offsets come from a generator seeded with seed, " +
+			"1 by default, so a seed always gives the same glitch and different seeds give different ones.",
+		Params: []Param{
+			{Name: "amount", Help: "largest shift in pixels", Kind: "int", Min: 1, Bound: "width", Unit: "px", Default: "20"},
+			{Name: "seed", Help: "seed of the random offsets", Kind: "int", Min: 0, Max: math.MaxInt32, Default: "1"},
+		},
+		Separator: ":",
+		Examples:  []string{"20", "50:7"},
+		Check: func(value string) error {
+			_, _, err := parseRowShift(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			amount, seed, err := parseRowShift(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyRowShift(img, amount, seed, progress), nil
+		},
+	},
+	{
+		Name:    "crystallize",
+		Summary: "breaks the image into crystal-like cells of flat color",
+		Details: "cells sites are scattered at random and every pixel joins the cell of the nearest one, giving " +
+			"Voronoi cells that are painted with the average color of their pixels. The sites come from a generator " +
+			"seeded with seed, 1 by default, so a seed always gives the same cells.",
+		Params: []Param{
+			{Name: "cells", Help: "number of cells", Kind: "int", Min: 1, Max: maxCrystalCells, Default: "500"},
+			{Name: "seed", Help: "seed of the cell sites", Kind: "int", Min: 0, Max: math.MaxInt32, Default: "1"},
+		},
+		Separator:  ":",
+		Examples:   []string{"500", "2000:7"},
+		ColorSpace: "srgb",
+		Check: func(value string) error {
+			_, _, err := parseCrystallize(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			cells, seed, err := parseCrystallize(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyCrystallize(img, cells, seed, progress), nil
+		},
+	},
+	{
+		Name:    "lens",
+		Summary: "adds or corrects radial lens distortion",
+		Details: "Each pixel at distance r from the center, with r 1 at the corners, is taken from distance " +
+			"r(1 + k1 r² + k2 r⁴ + k3 r⁶). Positive coefficients bend straight lines into a barrel; negative ones pull " +
+			"the edges outward, which straightens the lines of fisheye and action camera frames. Pixels are resampled " +
+			"bilinearly, and areas taken from beyond the edges repeat the border pixels.",
+		Params: []Param{
+			{Name: "k1", Help: "coefficient of r²", Kind: "number", Default: "-0.2"},
+			{Name: "k2", Help: "coefficient of r⁴", Kind: "number", Default: "0"},
+			{Name: "k3", Help: "coefficient of r⁶, 0 if left out", Kind: "number", Default: "0"},
+		},
+		Separator:  ",",
+		Examples:   []string{"-0.2,0", "0.3,0.1", "-0.25,0.05,-0.01"},
+		WholeValue: true,
+		Check: func(value string) error {
+			_, err := parseLens(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			k, err := parseLens(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyLens(img, k, progress), nil
+		},
+	},
+	{
+		Name:    "swirl",
+		Summary: "twists the image around its center",
+		Details: "The twist is degrees at the center, clockwise for positive angles, and fades to nothing at radius pixels " +
+			"from the center, or at half the shorter side when the radius is left out. Pixels are resampled bilinearly.",
+		Params: []Param{
+			{Name: "degrees", Help: "twist at the center", Kind: "number", Unit: "degrees", Default: "90"},
+			{Name: "radius", Help: "reach of the twist in pixels", Kind: "number", Unit: "px"},
+		},
+		Separator:  ",",
+		Examples:   []string{"90", "-180,120"},
+		WholeValue: true,
+		Check: func(value string) error {
+			_, _, err := parseSwirl(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			degrees, radius, err := parseSwirl(value)
+			if err != nil {
+				return nil, err
+			}
+			return applySwirl(img, degrees, radius, progress), nil
+		},
+	},
+	{
+		Name:    "implode",
+		Summary: "pulls the image towards its center, or pushes it outward",
+		Details: "Positive factors up to 1 draw the content within the largest centered circle inward, negative factors " +
+			"down to -1 bulge it outward. Pixels are resampled bilinearly.",
+		Params: []Param{
+			{Name: "factor", Help: "strength of the pinch, negative to push outwards", Kind: "number", Min: -1, Max: 1, Default: "0.5"},
+		},
+		Examples: []string{"0.5", "-0.7"},
+		Check: func(value string) error {
+			_, err := parseImplode(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			factor, err := parseImplode(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyImplode(img, factor, progress), nil
+		},
+	},
+	{
+		Name:    "wave",
+		Summary: "ripples the image along a sine wave",
+		Details: "Every column moves up or down by up to amplitude pixels along a sine wave that repeats every " +
+			"wavelength pixels across the image. The image keeps its size, and the edges the wave uncovers repeat " +
+			"the border pixels. Pixels are resampled bilinearly.",
+		Params: []Param{
+			{Name: "amplitude", Help: "largest shift in pixels", Kind: "number", Unit: "px", Default: "10"},
+			{Name: "wavelength", Help: "length of one wave in pixels", Kind: "number", Unit: "px", Default: "100"},
+		},
+		Separator:  ",",
+		Examples:   []string{"10,100", "4,32.5"},
+		WholeValue: true,
+		Check: func(value string) error {
+			_, _, err := parseWave(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			amplitude, wavelength, err := parseWave(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyWave(img, amplitude, wavelength, progress), nil
+		},
+	},
+	{
+		Name:    "kaleidoscope",
+		Summary: "repeats a reflected wedge of the image around its center",
+		Details: "The image is divided into segments equal wedges around its center. The wedge that starts angle degrees " +
+			"clockwise from the right is kept, and every other wedge shows it reflected across the wedge before, as the " +
+			"mirrors of a kaleidoscope do; an even number of segments joins up without seams. Pixels are resampled bilinearly.",
+		Params: []Param{
+			{Name: "segments", Help: "number of wedges", Kind: "int", Min: 2, Max: maxKaleidoscopeSegments, Default: "6"},
+			{Name: "angle", Help: "start of the kept wedge in degrees", Kind: "number", Unit: "degrees", Default: "0"},
+		},
+		Separator:  ",",
+		Examples:   []string{"6", "8,22.5"},
+		WholeValue: true,
+		Check: func(value string) error {
+			_, _, err := parseKaleidoscope(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			segments, angle, err := parseKaleidoscope(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyKaleidoscope(img, segments, angle, progress), nil
+		},
+	},
+	{
+		Name:    "symmetry",
+		Summary: "makes the image symmetric by reflecting half of it",
+		Details: "horizontal reflects the left half onto the right, vertical the top half onto the bottom, and quad " +
+			"the top-left quarter onto the other three. Pixels are copied as they are.",
+		Params: []Param{
+			{Name: "mode", Help: "halves to reflect", Kind: "enum", Choices: symmetryModes, Default: "horizontal"},
+		},
+		Examples: []string{"horizontal", "quad"},
+		Check: func(value string) error {
+			_, err := parseSymmetry(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			mode, err := parseSymmetry(value)
+			if err != nil {
+				return nil, err
+			}
+			return applySymmetry(img, mode, progress), nil
+		},
+	},
+	{
+		Name:    "hints",
+		Summary: "loads regions of interest that --smartcrop keeps in frame",
+		Details: "The file holds a JSON array of boxes in pixels from the top-left corner, " +
+			`e.g. [{"x": 40, "y": 30, "width": 120, "height": 160, "weight": 2}], as written by a face or object detector. ` +
+			"weight is optional and defaults to 1. The boxes describe the image as it is at this stage " +
+			"and are dropped by stages that move pixels, such as rotate or crop.",
+		Params: []Param{
+			{Name: "file", Help: "JSON file with the boxes", Kind: "file"},
+		},
+		Examples: []string{"boxes.json"},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			hints, err := readHints(value)
+			if err != nil {
+				return nil, err
+			}
+			result := *img
+			result.Hints = hints
+			return &result, nil
+		},
+	},
+	{
+		Name:    "colorspace",
+		Summary: "converts the colors to linear light or back to sRGB for the stages that follow",
+		Details: "Stages that average colors, such as --resize, --scale and --blur, mix them as light mixes in linear light, " +
+			"which keeps blends of bright and dark colors from turning too dark. Stages that work with colors as they look, " +
+			"such as --filter, --outline and --remap, get the image converted back to sRGB first, as does the output, " +
+			"and converting to the encoding the image is already in does nothing. " +
+			"Eight bits of linear light merge the darkest shades, so convert only around the stages that benefit.",
+		Params: []Param{
+			{Name: "space", Help: "color encoding", Kind: "enum", Choices: colorSpaces, Default: "linear"},
+		},
+		Examples:    []string{"linear", "srgb"},
+		KeepsLayout: true,
+		Check: func(value string) error {
+			if !contains(colorSpaces, value) {
+				return msgError("error.invalid_colorspace", value)
+			}
+			return nil
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			return img, nil
+		},
+	},
+	{
+		Name:    "resize",
+		Summary: "scales the image to the given size",
+		Details: "bilinear blends the nearest source pixels, or all those a result pixel covers when downscaling, " +
+			"and suits photos; colors are weighted by alpha, so transparent pixels do not darken the edges " +
+			"(--straight-alpha turns this off). nearest copies the closest pixel, keeping hard edges and the colors of indexed images. " +
+			"The aspect ratio is not kept; see --fit and --scale for that. Either side may be a percentage of the image side, " +
+			"as in 50%x100%, and a single percentage such as 50% sizes both; physical sizes take the resolution " +
+			"at the end, as in 10x15cm@300dpi. " +
+			"Put --colorspace=linear before it to blend the colors in linear light.",
+		Params: []Param{
+			{Name: "size", Help: "result as WxH", Kind: "text", Default: "800x600"},
+			{Name: "algorithm", Help: "interpolation", Kind: "enum", Choices: resizeAlgorithms, Default: "bilinear"},
+		},
+		Separator: ":",
+		Examples:  []string{"16x8", "800x600:nearest"},
+		Check: func(value string) error {
+			_, _, _, err := parseResize(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			width, height, algorithm, err := resizeResult(value, img)
+			if err != nil {
+				return nil, err
+			}
+			return applyResize(img, width, height, algorithm, progress), nil
+		},
+		Cost: func(value string, width, height int) stageCost {
+			w, h, algorithm, err := parseResize(value)
+			if err != nil {
+				return passCost(width, height, costPassSteps, 0)
+			}
+			return resampleCost(max(w.pixels(width), 1), max(h.pixels(height), 1), algorithm)
+		},
+	},
+	{
+		Name:    "scale",
+		Summary: "scales the image by a factor, keeping its aspect ratio",
+		Details: "Factors below 1 shrink the image and factors above 1 enlarge it; each side is rounded to whole pixels. " +
+			"The algorithms are those of --resize.",
+		Params: []Param{
+			{Name: "factor", Help: "scale factor, e.g. 0.5", Kind: "number", Max: maxScaleFactor, Default: "0.5"},
+			{Name: "algorithm", Help: "interpolation", Kind: "enum", Choices: resizeAlgorithms, Default: "bilinear"},
+		},
+		Separator: ":",
+		Examples:  []string{"0.5", "2:nearest"},
+		Check: func(value string) error {
+			_, _, err := parseScale(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			factor, algorithm, err := parseScale(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyScale(img, value, factor, algorithm, progress)
+		},
+		Cost: func(value string, width, height int) stageCost {
+			factor, algorithm, _ := parseScale(value)
+			width, height = scaleSize(width, height, factor)
+			return resampleCost(width, height, algorithm)
+		},
+	},
+	{
+		Name:    "upscale",
+		Summary: "enlarges pixel art by 2, 3 or 4 while keeping its hard edges",
+		Details: "scale2x (Scale2x, Scale3x and Scale4x) only copies existing colors, rounding off staircases " +
+			"where two neighbors of a pixel match. hq2x finds edges by which neighbors look alike in YUV, as hqx does, " +
+			"and xbr weighs the color differences around each corner, as 2xBR does; both blend the corners they cut, " +
+			"giving smoother diagonals at the cost of new colors.",
+		Params: []Param{
+			{Name: "algorithm", Help: "upscaler", Kind: "enum", Choices: upscaleAlgorithms, Default: "scale2x"},
+			{Name: "factor", Help: "scale factor", Kind: "int", Min: 2, Max: 4, Default: "2"},
+		},
+		Separator:  ":",
+		Examples:   []string{"scale2x", "xbr:4"},
+		ColorSpace: "srgb",
+		Check: func(value string) error {
+			_, _, err := parseUpscale(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			algorithm, factor, err := parseUpscale(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyUpscale(img, algorithm, factor, progress), nil
+		},
+		// Every pixel of the result compares the neighbors of the pixel it comes from
+		Cost: func(value string, width, height int) stageCost {
+			_, factor, _ := parseUpscale(value)
+			return passCost(width*factor, height*factor, 4*costPassSteps, 0)
+		},
+	},
+	{
+		Name:    "zoom",
+		Summary: "enlarges every pixel to an NxN block, optionally with a grid between pixels",
+		Details: "Zooming copies pixels without blending, so icons and sprites stay crisp for documentation. " +
+			"With grid, gray one-pixel lines mark the border of every source pixel and frame the image, " +
+			"which makes the result one pixel wider and taller than N times the source.",
+		Params: []Param{
+			{Name: "factor", Help: "zoom as Nx", Kind: "text", Default: "8x"},
+			{Name: "grid", Help: "draw pixel boundaries", Kind: "enum", Choices: []string{"grid"}},
+		},
+		Separator:  ":",
+		Examples:   []string{"4x", "8x:grid"},
+		ColorSpace: "srgb",
+		Check: func(value string) error {
+			_, _, err := parseZoom(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			factor, grid, err := parseZoom(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyZoom(img, factor, grid, progress), nil
+		},
+		Cost: func(value string, width, height int) stageCost {
+			factor, grid, _ := parseZoom(value)
+			if grid {
+				return passCost(width*factor+1, height*factor+1, 2, 0)
+			}
+			return passCost(width*factor, height*factor, 2, 0)
+		},
+	},
+	{
+		Name:    "fit",
+		Summary: "scales the image to fit within a box, keeping its aspect ratio",
+		Details: "The result is as large as possible without exceeding WxH in either direction. " +
+			"With no-upscale, images that already fit are left unchanged, so only larger images are shrunk.",
+		Params: []Param{
+			{Name: "size", Help: "box as WxH", Kind: "text", Default: "1920x1080"},
+			{Name: "mode", Help: "whether smaller images are enlarged", Kind: "enum", Choices: fitModes, Default: "upscale"},
+		},
+		Separator: ":",
+		Examples:  []string{"16x8", "1920x1080:no-upscale"},
+		Check: func(value string) error {
+			_, _, _, err := parseFit(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			width, height, upscale, err := parseFit(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyFit(img, width, height, upscale), nil
+		},
+		Cost: func(value string, width, height int) stageCost {
+			boxWidth, boxHeight, upscale, _ := parseFit(value)
+			if !upscale && width <= boxWidth && height <= boxHeight {
+				return stageCost{width: width, height: height}
+			}
+			w, h := fitSize(width, height, boxWidth, boxHeight)
+			return passCost(w, h, 2, 0)
+		},
+	},
+	{
+		Name:    "ninepatch",
+		Summary: "scales the image to WxH with 9-slice semantics, as used for UI skins",
+		Details: "The borders, in pixels from the left, top, right and bottom edges, cut the image into nine parts. " +
+			"The corners keep their size, the top and bottom edges stretch horizontally, the left and right edges vertically " +
+			"and the center in both directions. The borders must leave a center in the source and fit within WxH.",
+		Params: []Param{
+			{Name: "borders", Help: "left,top,right,bottom border widths", Kind: "text", Default: "8,8,8,8"},
+			{Name: "size", Help: "result as WxH", Kind: "text", Default: "64x64"},
+		},
+		Separator:  ":",
+		Examples:   []string{"2,2,2,2:16x8", "12,10,12,14:300x80"},
+		WholeValue: true,
+		Check: func(value string) error {
+			_, _, _, err := parseNinePatch(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			borders, width, height, err := parseNinePatch(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyNinePatch(img, borders, width, height, progress)
+		},
+	},
+	{
+		Name:    "overlay",
+		Summary: "lays another BMP image over this one, e.g. a watermark",
+		Details: "The overlay is placed with its top-left corner at x,y from the top-left corner of the image; parts beyond " +
+			"the edges are clipped. 32-bit overlays are blended by their alpha, and the opacity, 1 by default, " +
+			"scales it for every overlay. Colors are mixed in linear light, by one of the blend modes when it is given. " +
+			"Alpha of the image is kept, and the overlay file is read again for every image of a batch.",
+		Params: []Param{
+			{Name: "file", Help: "BMP file to overlay", Kind: "file"},
+			{Name: "position", Help: "x,y of the overlay's top-left corner", Kind: "text", Default: "0,0"},
+			{Name: "opacity", Help: "1 for opaque, 0 for invisible", Kind: "number", Min: 0, Max: 1, Default: "1"},
+			{Name: "mode", Help: "blend mode", Kind: "enum", Choices: bmp.BlendModes(), Default: "normal"},
+		},
+		Separator:   ":",
+		Examples:    []string{"logo.bmp:20,20", "watermark.bmp:0,0:0.3", "texture.bmp:0,0:1:multiply"},
+		KeepsLayout: true,
+		ColorSpace:  "srgb",
+		Check: func(value string) error {
+			_, err := parseOverlay(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			spec, err := parseOverlay(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyOverlay(img, spec, progress)
+		},
+	},
+	{
+		Name:    "stamp",
+		Summary: "burns text such as the file name and time into a corner",
+		Details: "Draws one line of text in white on a black box in the bottom-right corner, or the corner given in front of " +
+			"it, as security cameras stamp their frames. {filename} and {stem} stand for the name of the source file with " +
+			"and without its extension, and {mtime} for its modification time, formatted by the Go time layout after a " +
+			"colon, e.g. {mtime:2006-01-02 15:04}; without one it reads like 2006-01-02 15:04:05. apply and batch fill " +
+			"them in for every file, so each image of a batch gets its own. With the global --deterministic flag {mtime} is " +
+			"$SOURCE_DATE_EPOCH in UTC, or 1970-01-01 00:00:00 when it is unset. Letters grow with the image, and text wider " +
+			"than the image is cut off.",
+		Params: []Param{
+			{Name: "corner", Help: "corner of the text", Kind: "enum", Choices: stampCorners, Default: "bottom-right"},
+			{Name: "text", Help: "text with {filename}, {stem} and {mtime} placeholders", Kind: "text"},
+		},
+		Separator:   ":",
+		WholeValue:  true,
+		Examples:    []string{"{filename} {mtime:2006-01-02 15:04}", "top-left:CAM 3 {mtime}"},
+		KeepsLayout: true,
+		Check: func(value string) error {
+			_, _, err := parseStamp(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			corner, text, err := parseStamp(value)
+			if err != nil {
+				return nil, err
+			}
+			result := applyStamp(img, corner, text)
+			progress.Report(img.Height, img.Height)
+			return result, nil
+		},
+	},
+	{
+		Name:    "displace",
+		Summary: "warps the image by the channels of a displacement map",
+		Details: "Red levels of the map move where each pixel is sampled from sideways and green levels up or down, by up " +
+			"to strength pixels, 10 by default: 128 leaves a pixel in place, lower levels take it from the left or above " +
+			"and higher levels from the right or below. A negative strength reverses the directions. The map is stretched " +
+			"over the image when their sizes differ, and pixels are resampled bilinearly. The map file is read again for " +
+			"every image of a batch.",
+		Params: []Param{
+			{Name: "file", Help: "BMP displacement map", Kind: "file"},
+			{Name: "strength", Help: "largest shift in pixels", Kind: "number", Unit: "px", Default: "10"},
+		},
+		Separator: ":",
+		Examples:  []string{"ripple.bmp", "haze.bmp:4", "noise.bmp:-25.5"},
+		Check: func(value string) error {
+			_, _, err := parseDisplace(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			file, strength, err := parseDisplace(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyDisplace(img, file, strength, progress)
+		},
+	},
+	{
+		Name:    "remap",
+		Summary: "replaces colors as listed in a mapping file",
+		Details: "The file holds one oldHex=newHex pair per line, e.g. ff00ff=00ff00. " +
+			"Indexed images have their color table recolored and keep it; other images are recolored pixel by pixel.",
+		Params: []Param{
+			{Name: "file", Help: "mapping file", Kind: "file"},
+		},
+		Examples:    []string{"mapping.txt"},
+		KeepsLayout: true,
+		ColorSpace:  "srgb",
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			mapping, err := readRemap(value)
+			if err != nil {
+				return nil, err
+			}
+			return applyRemap(img, mapping, progress), nil
+		},
+	},
+	{
+		Name:    "assert",
+		Summary: "stops the pipeline when the image does not meet a condition",
+		Details: "dimensions:WxH requires the exact size, max-colors:N at most N distinct colors and " +
+			"not-blank at least two different colors. The image passes through unchanged, " +
+			"so assertions can be placed between any stages.",
+		Params: []Param{
+			{Name: "check", Help: "condition to verify", Kind: "enum", Choices: assertChecks, Default: "not-blank"},
+			{Name: "argument", Help: "WxH for dimensions, a color count for max-colors, nothing for not-blank", Kind: "text"},
+		},
+		Separator:   ":",
+		Examples:    []string{"not-blank", "dimensions:800x600", "max-colors:256"},
+		KeepsLayout: true,
+		ColorSpace:  "srgb",
+		Check: func(value string) error {
+			_, _, _, err := parseAssert(value)
+			return err
+		},
+		Apply: func(img *Image, value string, progress rowProgress) (*Image, error) {
+			return applyAssert(img, value)
+		},
+	},
+	{
+		Name:    "if",
+		Summary: "runs the next option only when the image matches a condition",
+		Details: "The predicate compares width, height or pixels (width times height) with a number using " +
+			">, <, >=, <=, == or !=, e.g. width>2000. Consecutive conditions must all hold. " +
+			"Quote the option in the shell so that > and < are not taken as redirections.",
+		Params: []Param{
+			{Name: "predicate", Help: "property, comparison and number", Kind: "text"},
+		},
+		Examples: []string{"width>2000", "pixels<=1000000"},
+		Check: func(value string) error {
+			_, _, _, err := parseCondition(value)
+			return err
+		},
+		Guard: evalCondition,
+	},
+}
+
+// Looks up an operation by its option name (with or without the leading dashes)
+func findOperation(name string) (*Operation, bool) {
+	name = strings.TrimPrefix(name, "--")
+	for i := range operations {
+		if operations[i].Name == name {
+			return &operations[i], true
+		}
+	}
+	return nil, false
+}
+
+// Looks up an operation by its single-letter alias with the leading dash (e.g. "-m")
+func findShortOperation(flag string) (*Operation, bool) {
+	short, ok := strings.CutPrefix(flag, "-")
+	if !ok || short == "" {
+		return nil, false
+	}
+	for i := range operations {
+		if operations[i].Short == short {
+			return &operations[i], true
+		}
+	}
+	return nil, false
+}
+
+// Splits a comma-separated value into one option per value, so --filter=grayscale,negative applies
+// both filters in order. Values of options that name files or contain commas are kept whole.
+func splitOptionValues(name, value string) []Option {
+	if op, ok := findOperation(name); !ok || op.WholeValue || readsFiles(op) {
+		return []Option{{Name: name, Value: value}}
+	}
+	var options []Option
+	for _, v := range strings.Split(value, ",") {
+		options = append(options, Option{Name: name, Value: v})
+	}
+	return options
+}
+
+// Checks the int and number parameters of an option value against the limits the registry gives them,
+// before Check parses the value, so that every option reports the allowed range the same way. Parameters
+// are matched by position among the parts between separators, or by name for parts given as name=value;
+// parts that are not numbers, such as keywords and percentages, are left to Check. Upper bounds that
+// depend on the image are left to Apply.
+func checkParams(op *Operation, value string) error {
+	parts := []string{value}
+	if op.Separator != "" {
+		parts = strings.Split(value, op.Separator)
+	}
+	for i, part := range parts {
+		var p *Param
+		if name, v, found := strings.Cut(part, "="); found {
+			for j := range op.Params {
+				if op.Params[j].Name == name {
+					p, part = &op.Params[j], v
+				}
+			}
+		} else if i < len(op.Params) {
+			p = &op.Params[i]
+		}
+		if p == nil || (p.Kind != "int" && p.Kind != "number") {
+			continue
+		}
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || math.IsInf(n, 0) || math.IsNaN(n) || (p.Kind == "int" && n != math.Trunc(n)) {
+			continue
+		}
+		bounded := p.Kind == "int" || p.Min < p.Max
+		if bounded && (n < float64(p.Min) || (p.Bound == "" && n > float64(p.Max))) {
+			return msgError("error.invalid_param", p.Name, part, op.Name, paramRange(p))
+		}
+	}
+	return nil
+}
+
+// Validates an option value: its parameters against their limits, then the whole value with Check
+func checkOption(op *Operation, value string) error {
+	if err := checkParams(op, value); err != nil {
+		return err
+	}
+	if op.Check != nil {
+		return op.Check(value)
+	}
+	return nil
+}
+
+// Reports whether any parameter of the operation names a file to read
+func readsFiles(op *Operation) bool {
+	for _, p := range op.Params {
+		if p.Kind == "file" {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses a --mirror value into "horizontal" or "vertical"
+func parseMirror(value string) (string, error) {
+	switch value {
+	case "horizontal", "h", "horizontally", "hor":
+		return "horizontal", nil
+	case "vertical", "v", "vertically", "ver":
+		return "vertical", nil
+	}
+	return "", msgError("error.invalid_mirror", value)
+}
+
+// Set by the --background global flag: the color of the corners --rotate uncovers at angles that are not
+// multiples of 90 degrees. When nil they are transparent for images with alpha and black for the others.
+var background *Pixel
+
+// Parses a --rotate value into a clockwise angle in degrees
+func parseRotate(value string) (float64, error) {
+	switch value {
+	case "right":
+		return 90, nil
+	case "left":
+		return -90, nil
+	}
+	angle, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsInf(angle, 0) || math.IsNaN(angle) {
+		return 0, msgError("error.invalid_angle", value)
+	}
+	return angle, nil
+}
+
+// Rotates the image clockwise by the angle in degrees. Multiples of 90 degrees move pixels exactly; other
+// angles are resampled onto a canvas large enough to hold the whole rotated image.
+func rotateImage(img *Image, angle float64, progress rowProgress) (*Image, error) {
+	if math.Mod(angle, 90) == 0 {
+		result, err := img.Rotate(int(math.Mod(angle, 360)), progress)
+		return result, localizeError(err)
+	}
+	fill := background
+	if fill == nil && img.Alpha == nil {
+		fill = &Pixel{}
+	}
+	return img.RotateAngle(angle, fill, progress), nil
+}
+
+// Reports whether the list contains the value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
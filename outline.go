@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Widest stroke --outline draws, which bounds the work done around each edge pixel
+const maxOutline = 64
+
+// Parses an --outline value of the form width,color into the stroke width in pixels and its color
+func parseOutline(value string) (int, Pixel, error) {
+	w, c, found := strings.Cut(value, ",")
+	width, err := strconv.Atoi(w)
+	if !found || err != nil || width < 1 || width > maxOutline {
+		return 0, Pixel{}, msgError("error.invalid_outline", value, maxOutline)
+	}
+	color, err := parseHexColor(c)
+	if err != nil {
+		return 0, Pixel{}, err
+	}
+	return width, color, nil
+}
+
+// Reports which pixels belong to the content: those that are not fully transparent or, for images
+// without alpha, those that differ from the color of the top-left corner, which is taken as the backdrop
+func silhouette(img *Image) []bool {
+	mask := make([]bool, len(img.Pixels))
+	backdrop := img.Pixels[(img.Height-1)*img.Width]
+	for i, p := range img.Pixels {
+		if img.Alpha != nil {
+			mask[i] = img.Alpha[i] != 0
+		} else {
+			mask[i] = p != backdrop
+		}
+	}
+	return mask
+}
+
+// Draws a stroke of the given width and color around the content: every background pixel within width
+// pixels of the content is painted and made opaque. The stroke is clipped at the edges of the image.
+func applyOutline(img *Image, width int, color Pixel, progress rowProgress) *Image {
+	mask := silhouette(img)
+	// Offsets within a disc of the stroke width, stamped around each edge pixel of the content
+	type offset struct{ dx, dy int }
+	var disc []offset
+	for dy := -width; dy <= width; dy++ {
+		for dx := -width; dx <= width; dx++ {
+			if dx*dx+dy*dy <= width*width {
+				disc = append(disc, offset{dx, dy})
+			}
+		}
+	}
+
+	stroke := make([]bool, len(mask))
+	inside := func(x, y int) bool {
+		return x >= 0 && y >= 0 && x < img.Width && y < img.Height && mask[y*img.Width+x]
+	}
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			// Only content pixels next to the background can reach background pixels
+			if !inside(x, y) || (inside(x-1, y) && inside(x+1, y) && inside(x, y-1) && inside(x, y+1)) {
+				continue
+			}
+			for _, o := range disc {
+				sx, sy := x+o.dx, y+o.dy
+				if sx >= 0 && sy >= 0 && sx < img.Width && sy < img.Height && !mask[sy*img.Width+sx] {
+					stroke[sy*img.Width+sx] = true
+				}
+			}
+		}
+		progress.Report(y+1, img.Height)
+	}
+
+	result := *img
+	result.Indices = nil
+	result.Pixels = make([]Pixel, len(img.Pixels))
+	copy(result.Pixels, img.Pixels)
+	if img.Alpha != nil {
+		result.Alpha = make([]byte, len(img.Alpha))
+		copy(result.Alpha, img.Alpha)
+	}
+	for i, on := range stroke {
+		if !on {
+			continue
+		}
+		result.Pixels[i] = color
+		if result.Alpha != nil {
+			result.Alpha[i] = 255
+		}
+	}
+	return &result
+}
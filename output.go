@@ -0,0 +1,120 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// An output of the apply command: the file to write and the size the result is scaled to
+type outputTarget struct {
+	Filename string
+	Width    int // 0 keeps the result width, or the aspect ratio when Height is set
+	Height   int // 0 keeps the result height, or the aspect ratio when Width is set
+}
+
+// Matches the WxH suffix of an --output value; either side may be left out
+var outputSize = regexp.MustCompile(`^(\d*)x(\d*)$`)
+
+// Parses an --output value of the form <file>[:WxH]. The part after the last colon is only taken
+// as a size when it looks like one, so other file names with colons are kept whole.
+func parseOutputTarget(value string) (outputTarget, error) {
+	i := strings.LastIndex(value, ":")
+	if i < 0 {
+		return outputTarget{Filename: value}, nonEmpty(value)
+	}
+	m := outputSize.FindStringSubmatch(value[i+1:])
+	if m == nil {
+		return outputTarget{Filename: value}, nil
+	}
+
+	target := outputTarget{Filename: value[:i]}
+	var err error
+	if target.Width, err = parseOutputDimension(m[1]); err == nil {
+		target.Height, err = parseOutputDimension(m[2])
+	}
+	if err != nil || target.Filename == "" || (target.Width == 0 && target.Height == 0) {
+		return outputTarget{}, msgError("expect.output")
+	}
+	return target, nil
+}
+
+// Parses one side of an output size, 0 when it is left out
+func parseOutputDimension(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, msgError("expect.output")
+	}
+	return n, nil
+}
+
+// Validates an --output value
+func checkOutputTarget(value string) error {
+	_, err := parseOutputTarget(value)
+	return err
+}
+
+// Formats the target back into an --output value
+func (t outputTarget) String() string {
+	if t.Width == 0 && t.Height == 0 {
+		return t.Filename
+	}
+	size := "x"
+	if t.Width > 0 {
+		size = strconv.Itoa(t.Width) + size
+	}
+	if t.Height > 0 {
+		size += strconv.Itoa(t.Height)
+	}
+	return t.Filename + ":" + size
+}
+
+// Returns the size of the output for a result of the given size
+func (t outputTarget) size(width, height int) (int, int) {
+	switch {
+	case t.Width == 0 && t.Height == 0:
+		return width, height
+	case t.Height == 0:
+		return t.Width, max(height*t.Width/width, 1)
+	case t.Width == 0:
+		return max(width*t.Height/height, 1), t.Height
+	}
+	return t.Width, t.Height
+}
+
+// Writes the result of one pipeline run to every output, scaling it where a size was requested
+func (s *ioSettings) saveOutputs(outputs []outputTarget, format string, bmpHeader *BMPHeader, dibHeader *DIBHeader, img *Image) error {
+	for _, output := range outputs {
+		result := img
+		if width, height := output.size(img.Width, img.Height); width != img.Width || height != img.Height {
+			result = resizeImage(img, width, height)
+		}
+		if err := s.saveOutput(output.Filename, format, bmpHeader, dibHeader, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Scales the image to the given size with nearest-neighbor sampling. The color table and the bytes
+// before the pixel data are kept, so indexed images stay indexed.
+func resizeImage(img *Image, width, height int) *Image {
+	result := &Image{Width: width, Height: height, Pixels: make([]Pixel, width*height), Gap: img.Gap, Palette: img.Palette}
+	if img.Alpha != nil {
+		result.Alpha = make([]byte, width*height)
+	}
+	for y := 0; y < height; y++ {
+		sy := y * img.Height / height
+		for x := 0; x < width; x++ {
+			src := sy*img.Width + x*img.Width/width
+			result.Pixels[y*width+x] = img.Pixels[src]
+			if img.Alpha != nil {
+				result.Alpha[y*width+x] = img.Alpha[src]
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"creditcard/bmp"
+)
+
+// Settings of one --overlay stage
+type overlaySpec struct {
+	file    string
+	x, y    int
+	opacity float64
+	mode    string
+}
+
+// Parses an --overlay value of the form file:x,y[:opacity[:mode]]. The fields are taken from the end, so
+// file names may contain colons themselves.
+func parseOverlay(value string) (overlaySpec, error) {
+	spec := overlaySpec{opacity: 1, mode: "normal"}
+	parts := strings.Split(value, ":")
+	invalid := msgError("error.invalid_overlay", value)
+
+	// The position is the last part that holds a comma-separated pair of numbers
+	at := -1
+	for i := len(parts) - 1; i > 0 && i >= len(parts)-3; i-- {
+		x, y, found := strings.Cut(parts[i], ",")
+		var errX, errY error
+		spec.x, errX = strconv.Atoi(x)
+		spec.y, errY = strconv.Atoi(y)
+		if found && errX == nil && errY == nil {
+			at = i
+			break
+		}
+	}
+	if at < 0 {
+		return overlaySpec{}, invalid
+	}
+	spec.file = strings.Join(parts[:at], ":")
+	rest := parts[at+1:]
+	if len(rest) > 0 {
+		opacity, err := strconv.ParseFloat(rest[0], 64)
+		if err != nil || opacity < 0 || opacity > 1 || math.IsNaN(opacity) {
+			return overlaySpec{}, invalid
+		}
+		spec.opacity = opacity
+	}
+	if len(rest) > 1 {
+		spec.mode = rest[1]
+		if !slices.Contains(bmp.BlendModes(), spec.mode) {
+			return overlaySpec{}, msgError("error.invalid_overlay_mode", spec.mode, strings.Join(bmp.BlendModes(), ", "))
+		}
+	}
+	if spec.file == "" {
+		return overlaySpec{}, invalid
+	}
+	return spec, nil
+}
+
+// Lays the overlay file over the image, blending by its alpha when it has any and by the opacity
+func applyOverlay(img *Image, spec overlaySpec, progress rowProgress) (*Image, error) {
+	_, _, top, err := globalSettings.loadImage(spec.file)
+	if err != nil {
+		return nil, err
+	}
+	result, err := img.Composite(top, spec.x, spec.y, spec.opacity, spec.mode, progress)
+	return result, localizeError(err)
+}
@@ -0,0 +1,101 @@
+package main
+
+import "image"
+
+// Narrowest gutter between the two pages of a book scan, as a share of its width
+const minGutterShare = 100
+
+// Finds the two pages of a book scan from projection profiles of its ink, returning the area of the left
+// and right page from the top-left corner. Rows and columns whose ink covers at least half their length
+// are the dark border a scanner lid leaves around the book, or the shadow of its spine, and are cut away
+// from the edges of each page. The gutter is a run of columns without text in the middle third of the
+// scan, the one in the shadow of the spine or else the widest blank one, and the pages meet in the middle
+// of the shadow or of the run. ok is false when the run is narrower than 1/minGutterShare of the width, as
+// on most scans of a single page.
+func findPages(img *Image) (left, right image.Rectangle, ok bool) {
+	ink := inkMask(img)
+	width, height := img.Width, img.Height
+	solid := func(count, length int) bool { return 2*count >= length }
+
+	// The border along the top and bottom edges is left out before the columns are counted, as it would
+	// put ink in every one of them
+	rows := make([]int, height)
+	for i, v := range ink {
+		if v {
+			rows[height-1-i/width]++
+		}
+	}
+	top, bottom := 0, height
+	for top < bottom && solid(rows[top], width) {
+		top++
+	}
+	for bottom > top && solid(rows[bottom-1], width) {
+		bottom--
+	}
+	if bottom-top < 2 {
+		return left, right, false
+	}
+	columns := make([]int, width)
+	for i, v := range ink {
+		if y := height - 1 - i/width; v && y >= top && y < bottom {
+			columns[i%width]++
+		}
+	}
+
+	// Columns holding less than a sliver of the ink of the fullest column of text hold no text
+	floor := 0
+	for _, c := range columns {
+		if !solid(c, bottom-top) {
+			floor = max(floor, c)
+		}
+	}
+	floor /= 50
+	blank := func(x int) bool { return columns[x] <= floor || solid(columns[x], bottom-top) }
+	// Runs in the shadow of the spine come before wider blank ones, which may be the margin of a page
+	// with little text
+	gutter, shadow, start := 0, 0, 0
+	for x := width / 3; x < 2*width/3; {
+		if !blank(x) {
+			x++
+			continue
+		}
+		from, dark := x, 0
+		for x < 2*width/3 && blank(x) {
+			if solid(columns[x], bottom-top) {
+				dark++
+			}
+			x++
+		}
+		if dark > shadow || dark == shadow && x-from > gutter {
+			gutter, shadow, start = x-from, dark, from
+		}
+	}
+	if gutter < max(2, width/minGutterShare) {
+		return left, right, false
+	}
+	cut := start + gutter/2
+	if shadow > 0 {
+		first := start
+		for !solid(columns[first], bottom-top) {
+			first++
+		}
+		last := start + gutter - 1
+		for !solid(columns[last], bottom-top) {
+			last--
+		}
+		cut = (first + last + 1) / 2
+	}
+
+	// Solid columns are cut away from both sides of each page
+	page := func(from, to int) image.Rectangle {
+		for from < to && solid(columns[from], bottom-top) {
+			from++
+		}
+		for to > from && solid(columns[to-1], bottom-top) {
+			to--
+		}
+		return image.Rect(from, top, to, bottom)
+	}
+	left, right = page(0, cut), page(cut, width)
+	return left, right, !left.Empty() && !right.Empty()
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Parses a color written as rrggbb or #rrggbb
+func parseHexColor(value string) (Pixel, error) {
+	hex := strings.TrimPrefix(value, "#")
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return Pixel{}, msgError("error.invalid_color", value)
+	}
+	return Pixel{Blue: byte(n), Green: byte(n >> 8), Red: byte(n >> 16)}, nil
+}
+
+// Formats a color as #rrggbb
+func hexColor(p Pixel) string {
+	return fmt.Sprintf("#%02x%02x%02x", p.Red, p.Green, p.Blue)
+}
+
+// Runs the palette show, replace and sort subcommands
+func runPalette(args []string) error {
+	if len(args) < 2 {
+		return msgError("usage.palette")
+	}
+
+	switch args[0] {
+	case "show":
+		if len(args) != 2 {
+			return msgError("usage.palette")
+		}
+		_, _, img, err := loadIndexedImage(args[1])
+		if err != nil {
+			return err
+		}
+		for i, p := range img.Palette {
+			fmt.Printf("%3d %s\n", i, hexColor(p))
+		}
+		return nil
+
+	case "replace":
+		if len(args) != 4 {
+			return msgError("usage.palette")
+		}
+		bmpHeader, dibHeader, img, err := loadIndexedImage(args[1])
+		if err != nil {
+			return err
+		}
+		if err := replacePalette(img, args[2]); err != nil {
+			return err
+		}
+		return globalSettings.saveImage(args[3], bmpHeader, dibHeader, img)
+
+	case "sort":
+		if len(args) != 3 {
+			return msgError("usage.palette")
+		}
+		bmpHeader, dibHeader, img, err := loadIndexedImage(args[1])
+		if err != nil {
+			return err
+		}
+		sortPalette(img)
+		return globalSettings.saveImage(args[2], bmpHeader, dibHeader, img)
+	}
+	return msgError("usage.palette")
+}
+
+// Loads an image and checks that it has a color table
+func loadIndexedImage(filename string) (*BMPHeader, *DIBHeader, *Image, error) {
+	bmpHeader, dibHeader, img, err := globalSettings.loadImage(filename)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if img.Palette == nil {
+		return nil, nil, nil, msgError("error.not_indexed", filename)
+	}
+	return bmpHeader, dibHeader, img, nil
+}
+
+// Replaces color table entries with those listed in a file, one "index #rrggbb" per line as printed
+// by palette show, and recolors the pixels that use them
+func replacePalette(img *Image, filename string) error {
+	file, err := files.Open(filename)
+	if err != nil {
+		return msgError("error.open_file", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return msgError("error.palette_line", filename, line)
+		}
+		index, err := strconv.Atoi(fields[0])
+		if err != nil || index < 0 || index >= len(img.Palette) {
+			return msgError("error.palette_index", fields[0], len(img.Palette))
+		}
+		if img.Palette[index], err = parseHexColor(fields[1]); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return msgError("error.read_file", err)
+	}
+
+	for i, index := range img.Indices {
+		if int(index) < len(img.Palette) {
+			img.Pixels[i] = img.Palette[index]
+		}
+	}
+	return nil
+}
+
+// Orders the color table from dark to light and renumbers the pixel indices to match
+func sortPalette(img *Image) {
+	order := make([]int, len(img.Palette))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return img.Palette[order[a]].Luminance() < img.Palette[order[b]].Luminance()
+	})
+
+	// Indices outside the table are left as they are
+	var remap [256]byte
+	for i := range remap {
+		remap[i] = byte(i)
+	}
+	sorted := make([]Pixel, len(order))
+	for to, from := range order {
+		sorted[to] = img.Palette[from]
+		remap[from] = byte(to)
+	}
+	img.Palette = sorted
+	for i, index := range img.Indices {
+		img.Indices[i] = remap[index]
+	}
+}
+
+// Reads a --remap mapping file of oldHex=newHex lines
+func readRemap(filename string) (map[Pixel]Pixel, error) {
+	file, err := files.Open(filename)
+	if err != nil {
+		return nil, msgError("error.open_file", err)
+	}
+	defer file.Close()
+
+	mapping := make(map[Pixel]Pixel)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		from, to, found := strings.Cut(text, "=")
+		if !found {
+			return nil, msgError("error.remap_line", filename, line)
+		}
+		old, err := parseHexColor(strings.TrimSpace(from))
+		if err != nil {
+			return nil, err
+		}
+		if mapping[old], err = parseHexColor(strings.TrimSpace(to)); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, msgError("error.read_file", err)
+	}
+	return mapping, nil
+}
+
+// Replaces the colors of an image according to the mapping. The color table of an indexed image is
+// recolored too, so its pixels keep their indices.
+func applyRemap(img *Image, mapping map[Pixel]Pixel, progress rowProgress) *Image {
+	recolor := func(p Pixel) Pixel {
+		if to, ok := mapping[p]; ok {
+			return to
+		}
+		return p
+	}
+
+	result := &Image{Width: img.Width, Height: img.Height, Pixels: make([]Pixel, len(img.Pixels))}
+	for i, p := range img.Pixels {
+		result.Pixels[i] = recolor(p)
+	}
+	if img.Palette != nil {
+		result.Palette = make([]Pixel, len(img.Palette))
+		for i, p := range img.Palette {
+			result.Palette[i] = recolor(p)
+		}
+		result.Indices = img.Indices
+	}
+	progress.Report(img.Height, img.Height)
+	return result
+}
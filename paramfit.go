@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Longest side of the copies of the source and target that fit searches on. Tone curves barely depend on
+// the resolution, and small copies make every try cheap.
+const fitProxySize = 384
+
+// Most rounds of searching every parameter in turn before searching them together
+const fitRounds = 4
+
+// Values fit tries across the whole range of a parameter before narrowing down on the best of them
+const fitGridSteps = 16
+
+// Smallest step of the search, as a share of the range of a parameter, finer than the values are written
+const fitResolution = 1.0 / 2048
+
+// Most the aspect ratios of the source and target may differ by, as a share, for the target to be scaled
+// to the size of the source
+const fitAspectTolerance = 0.02
+
+// Option fit can search, with the range of its value
+type fitOperation struct {
+	name        string
+	low, high   float64
+	identity    float64 // Value that leaves the image as it is, where the search starts
+	logarithmic bool    // Searched in equal ratios rather than equal steps, as for gamma
+}
+
+// Options fit can search, in the order help lists them. Each has a single parameter and leaves the
+// layout of the image alone.
+var fitOperations = []fitOperation{
+	{name: "brightness", low: -100, high: 100},
+	{name: "contrast", low: -100, high: 100},
+	{name: "saturation", low: -100, high: 100},
+	{name: "gamma", low: 0.2, high: 5, identity: 1, logarithmic: true},
+}
+
+// Settings of the fit command
+type fitConfig struct {
+	target string   // Reference image the source is fitted to
+	ops    []string // Names of the options searched, applied in this order
+	metric string   // "psnr" or one of qualityMetrics
+	format string   // "text" or "json"
+	output string   // File the fitted image is written to, if set
+	source string
+}
+
+// Parameters printed by the fit command
+type fitReport struct {
+	Options []string           `json:"options"` // Apply options that fit the source to the target
+	Values  map[string]float64 `json:"values"`
+	Metric  string             `json:"metric"`
+	// Scores of the source against the target before and after, nil when the images are identical by PSNR
+	Before *float64 `json:"before"`
+	After  *float64 `json:"after"`
+}
+
+// Parses the arguments of the fit command
+func parseFitArgs(args []string) (*fitConfig, error) {
+	cfg := &fitConfig{metric: "psnr", format: "text"}
+	var ops string
+	flags := []flagSpec{
+		{Name: "target", Target: &cfg.target, Check: nonEmpty},
+		{Name: "op", Target: &ops, Check: checkFitOperations},
+		{Name: "metric", Target: &cfg.metric, Choices: append([]string{"psnr"}, qualityMetricNames()...)},
+		{Name: "format", Target: &cfg.format, Choices: []string{"text", "json"}},
+		{Name: "output", Target: &cfg.output, Check: nonEmpty},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 1 || cfg.target == "" || ops == "" {
+		return nil, msgError("usage.fit")
+	}
+	cfg.ops = strings.Split(ops, ",")
+	cfg.source = positional[0]
+	return cfg, nil
+}
+
+// Validates an --op value: names of fitOperations, separated by commas, each at most once
+func checkFitOperations(value string) error {
+	names := strings.Split(value, ",")
+	for i, name := range names {
+		if findFitOperation(name) == nil || slices.Contains(names[:i], name) {
+			names := make([]string, len(fitOperations))
+			for i, op := range fitOperations {
+				names[i] = op.name
+			}
+			return msgError("expect.fit_ops", strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// Looks up an option fit can search by name, returning nil for others
+func findFitOperation(name string) *fitOperation {
+	for i := range fitOperations {
+		if fitOperations[i].name == name {
+			return &fitOperations[i]
+		}
+	}
+	return nil
+}
+
+// Searches the values of the given options that make the source look most like a reference image, such
+// as a capture of a test chart by a device and the chart itself, and prints them as apply options
+func runFit(args []string) error {
+	cfg, err := parseFitArgs(args)
+	if err != nil {
+		return err
+	}
+	bmpHeader, dibHeader, source, err := loadConvertInput(cfg.source, pdfOptions{})
+	if err != nil {
+		return err
+	}
+	_, _, target, err := loadConvertInput(cfg.target, pdfOptions{})
+	if err != nil {
+		return err
+	}
+	ratio := float64(source.Width) * float64(target.Height) / (float64(source.Height) * float64(target.Width))
+	if math.Abs(ratio-1) > fitAspectTolerance {
+		return msgError("error.fit_aspect", source.Width, source.Height, target.Width, target.Height)
+	}
+
+	ops := make([]*fitOperation, len(cfg.ops))
+	for i, name := range cfg.ops {
+		ops[i] = findFitOperation(name)
+	}
+	proxy := downscaleToFit(source, fitProxySize)
+	reference := target
+	if target.Width != proxy.Width || target.Height != proxy.Height {
+		reference = resizeImage(target, proxy.Width, proxy.Height)
+	}
+	values, before, after, err := fitParameters(proxy, reference, ops, cfg.metric)
+	if err != nil {
+		return err
+	}
+
+	report := &fitReport{Values: map[string]float64{}, Metric: cfg.metric}
+	options := make([]Option, len(ops))
+	for i, op := range ops {
+		options[i] = Option{Name: "--" + op.name, Value: op.format(values[i])}
+		report.Options = append(report.Options, options[i].Name+"="+options[i].Value)
+		report.Values[op.name] = values[i]
+	}
+	report.Before, report.After = fitScoreValue(cfg.metric, before), fitScoreValue(cfg.metric, after)
+
+	if cfg.format == "json" {
+		if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+			return msgError("error.write_output", err)
+		}
+	} else {
+		fmt.Printf("options: %s\n", strings.Join(report.Options, " "))
+		fmt.Printf("%s: %s before, %s after\n", cfg.metric, formatFitScore(report.Before), formatFitScore(report.After))
+	}
+
+	if cfg.output != "" {
+		fitted, err := applyOptions(source, options)
+		if err != nil {
+			return err
+		}
+		return globalSettings.saveOutput(cfg.output, "", bmpHeader, dibHeader, fitted)
+	}
+	return nil
+}
+
+// Returns the value an option takes at position t from 0 to 1 of its range, rounded as it is written:
+// amounts to whole numbers and gammas to hundredths
+func (op *fitOperation) value(t float64) float64 {
+	if op.logarithmic {
+		return math.Round(op.low*math.Pow(op.high/op.low, t)*100) / 100
+	}
+	return math.Round(op.low + (op.high-op.low)*t)
+}
+
+// Returns the position from 0 to 1 of a value in the range of the option
+func (op *fitOperation) position(value float64) float64 {
+	if op.logarithmic {
+		return math.Log(value/op.low) / math.Log(op.high/op.low)
+	}
+	return (value - op.low) / (op.high - op.low)
+}
+
+// Writes a value of the option as apply takes it
+func (op *fitOperation) format(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// Finds the values of the options, applied in order, that score the source best against the target, with
+// the scores before and after. Each option is first searched in turn with the others held, across a grid
+// of its range and then by a golden-section search between the neighbors of the best point, for a few
+// rounds. Options such as brightness and gamma pull the same way, though, so the best value of one moves
+// with the other and searching them one at a time stalls on the ridge between them. A pattern search
+// then moves all of them at once, stepping every way in turn and halving the step once none helps.
+func fitParameters(source, target *Image, ops []*fitOperation, metric string) ([]float64, float64, float64, error) {
+	tried := map[string]float64{}
+	var failed error
+	// Scores the options at positions in their ranges
+	evaluate := func(positions []float64) float64 {
+		values := make([]float64, len(ops))
+		for i, op := range ops {
+			values[i] = op.value(min(max(positions[i], 0), 1))
+		}
+		key := fmt.Sprint(values)
+		if score, ok := tried[key]; ok {
+			return score
+		}
+		img := source
+		for i, op := range ops {
+			if failed != nil {
+				return math.Inf(-1)
+			}
+			img, failed = findOperationApply(op.name)(img, op.format(values[i]), nil)
+		}
+		if failed != nil {
+			return math.Inf(-1)
+		}
+		tried[key] = fitScore(metric, target, img)
+		return tried[key]
+	}
+
+	positions := make([]float64, len(ops))
+	for i, op := range ops {
+		positions[i] = op.position(op.identity)
+	}
+	before := evaluate(positions)
+	best := before
+	for range fitRounds {
+		improved := false
+		for i := range ops {
+			try := func(t float64) float64 {
+				candidate := slices.Clone(positions)
+				candidate[i] = min(max(t, 0), 1)
+				return evaluate(candidate)
+			}
+			bestT, bestScore := positions[i], best
+			for k := 0; k <= fitGridSteps; k++ {
+				if t := float64(k) / fitGridSteps; try(t) > bestScore {
+					bestT, bestScore = t, try(t)
+				}
+			}
+			lo, hi := bestT-1.0/fitGridSteps, bestT+1.0/fitGridSteps
+			phi := (math.Sqrt(5) - 1) / 2
+			for hi-lo > fitResolution {
+				a, b := hi-phi*(hi-lo), lo+phi*(hi-lo)
+				if try(a) >= try(b) {
+					hi = b
+				} else {
+					lo = a
+				}
+			}
+			if t := (lo + hi) / 2; try(t) > bestScore {
+				bestT, bestScore = t, try(t)
+			}
+			if bestScore > best {
+				positions[i], best, improved = min(max(bestT, 0), 1), bestScore, true
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+
+	// Every way to step: each option down, held or up, but not all held
+	var directions [][]float64
+	for d := range int(math.Pow(3, float64(len(ops)))) {
+		direction := make([]float64, len(ops))
+		for i := range direction {
+			direction[i] = float64(d%3 - 1)
+			d /= 3
+		}
+		if slices.ContainsFunc(direction, func(v float64) bool { return v != 0 }) {
+			directions = append(directions, direction)
+		}
+	}
+	for step := 1.0 / fitGridSteps; step >= fitResolution && failed == nil; {
+		var bestMove []float64
+		for _, direction := range directions {
+			candidate := slices.Clone(positions)
+			for i := range candidate {
+				candidate[i] = min(max(candidate[i]+direction[i]*step, 0), 1)
+			}
+			if score := evaluate(candidate); score > best {
+				bestMove, best = candidate, score
+			}
+		}
+		if bestMove == nil {
+			step /= 2
+			continue
+		}
+		positions = bestMove
+	}
+	if failed != nil {
+		return nil, 0, 0, failed
+	}
+
+	values := make([]float64, len(ops))
+	for i, op := range ops {
+		values[i] = op.value(positions[i])
+	}
+	return values, before, best, nil
+}
+
+// Returns the Apply function of an option of the apply command
+func findOperationApply(name string) func(img *Image, value string, progress rowProgress) (*Image, error) {
+	op, _ := findOperation(name)
+	return op.Apply
+}
+
+// Scores an image against the target by a metric, higher for closer images whichever way the metric runs
+func fitScore(metric string, target, img *Image) float64 {
+	if metric == "psnr" {
+		psnr := compareImages(target, img).PSNR
+		if psnr == nil {
+			return math.Inf(1)
+		}
+		return *psnr
+	}
+	score := qualityMetrics[metric].score(target, img)
+	if !qualityMetrics[metric].higherIsBetter() {
+		return -score
+	}
+	return score
+}
+
+// Turns a score of fitScore back into a value of the metric, nil for the infinite PSNR of identical images
+func fitScoreValue(metric string, score float64) *float64 {
+	if math.IsInf(score, 1) {
+		return nil
+	}
+	if metric != "psnr" && !qualityMetrics[metric].higherIsBetter() {
+		score = -score
+	}
+	return &score
+}
+
+// Formats a score of the fit report for text output
+func formatFitScore(score *float64) string {
+	if score == nil {
+		return "inf"
+	}
+	return strconv.FormatFloat(*score, 'f', 4, 64)
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+// Returns the path as it is: other systems have no limit below what their file systems allow
+func nativePath(name string) string {
+	return name
+}
+
+// Reports whether a name read from a directory cannot be opened again, which never happens where names
+// are bytes that Go strings keep unchanged
+func unreadableName(name string) bool {
+	return false
+}
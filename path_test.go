@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Names with spaces, non-Latin letters and bytes that are not UTF-8, which every path helper must pass
+// through without mangling
+var awkwardNames = []string{
+	"plain.bmp",
+	"with space.bmp",
+	"дом/фото 1.bmp",
+	"写真.bmp",
+	"latin1-\xe9t\xe9.bmp",
+	"\xff\xfe.bmp",
+}
+
+// Short paths, and any path on systems other than Windows, come back byte for byte
+func TestNativePathShort(t *testing.T) {
+	for _, name := range append(awkwardNames, stdioName, "") {
+		if got := nativePath(name); got != name {
+			t.Errorf("nativePath(%q) = %q", name, got)
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+	long := strings.Repeat("каталог с пробелом/", 40) + "\xff.bmp"
+	if got := nativePath(long); got != long {
+		t.Errorf("nativePath changed a long path to %q", got)
+	}
+}
+
+// Windows rejects names whose UTF-16 could not be read back; elsewhere names are bytes and always reopen
+func TestUnreadableName(t *testing.T) {
+	for _, name := range awkwardNames {
+		want := runtime.GOOS == "windows" && strings.ContainsRune(name, '\uFFFD')
+		if got := unreadableName(name); got != want {
+			t.Errorf("unreadableName(%q) = %v, want %v", name, got, want)
+		}
+	}
+	if got := unreadableName("bad\uFFFD.bmp"); got != (runtime.GOOS == "windows") {
+		t.Errorf("unreadableName of a replacement character = %v on %s", got, runtime.GOOS)
+	}
+}
+
+// Files named with awkward bytes are listed by batch under the same name and open again by it
+func TestListBMPFilesAwkwardNames(t *testing.T) {
+	dir := t.TempDir()
+	var want []string
+	for _, name := range awkwardNames {
+		name = strings.ReplaceAll(name, "/", " ")
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			// Some file systems, such as APFS, refuse names that are not UTF-8
+			t.Logf("skipping %q: %v", name, err)
+			continue
+		}
+		want = append(want, path)
+	}
+	files, err := listBMPFiles(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(want) {
+		t.Fatalf("listed %q, want %q", files, want)
+	}
+	for _, file := range files {
+		if _, err := os.Stat(nativePath(file)); err != nil {
+			t.Errorf("listed %q, which does not open: %v", file, err)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		arg, posix, windows string
+	}{
+		{"plain.bmp", "plain.bmp", "plain.bmp"},
+		{"--scale=0.5", "--scale=0.5", "--scale=0.5"},
+		{"", "''", `""`},
+		{"with space.bmp", "'with space.bmp'", `"with space.bmp"`},
+		{"it's.bmp", `'it'\''s.bmp'`, `"it's.bmp"`},
+		{`say "hi".bmp`, `'say "hi".bmp'`, `"say \"hi\".bmp"`},
+		{"фото 1.bmp", "'фото 1.bmp'", `"фото 1.bmp"`},
+		{"写真.bmp", "'写真.bmp'", `"写真.bmp"`},
+		{"\xff\xfe.bmp", "'\xff\xfe.bmp'", "\"\xff\xfe.bmp\""},
+		{"$HOME/*.bmp", "'$HOME/*.bmp'", `"$HOME/*.bmp"`},
+	}
+	for _, tt := range tests {
+		want := tt.posix
+		if runtime.GOOS == "windows" {
+			want = tt.windows
+		}
+		if got := shellQuote(tt.arg); got != want {
+			t.Errorf("shellQuote(%q) = %q, want %q", tt.arg, got, want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Length from which Windows refuses paths unless they carry the \\?\ prefix: MAX_PATH of 260 less room
+// for the 8.3 file name CreateDirectory insists on
+const maxShortPath = 248
+
+// Returns a path Windows accepts at any length. Paths that come near MAX_PATH are made absolute and given
+// the \\?\ prefix, or \\?\UNC\ for network shares, which lifts the limit of 260 characters that batch runs
+// over deep folders otherwise hit with a bare "file not found". Shorter paths are returned as they are.
+func nativePath(name string) string {
+	if len(name) < maxShortPath || strings.HasPrefix(name, `\\?\`) || name == stdioName {
+		return name
+	}
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return name
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
+
+// Reports whether a name read from a directory cannot be opened again. Windows names are UTF-16 and
+// may hold unpaired surrogates, which turn into U+FFFD on the way to UTF-8, so the name found is not the
+// name on disk.
+func unreadableName(name string) bool {
+	return strings.ContainsRune(name, utf8.RuneError)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Paths from maxShortPath on are made absolute and prefixed, keeping their letters and spaces
+func TestNativePathLong(t *testing.T) {
+	dir := `C:\` + strings.Repeat(`папка с пробелом\`, 20)
+	tests := []struct {
+		name, want string
+	}{
+		{dir + "写真.bmp", `\\?\` + dir + "写真.bmp"},
+		{`\\server\share\` + dir[3:] + "a b.bmp", `\\?\UNC\server\share\` + dir[3:] + "a b.bmp"},
+		{`\\?\` + dir + "a.bmp", `\\?\` + dir + "a.bmp"},
+	}
+	for _, tt := range tests {
+		if got := nativePath(tt.name); got != tt.want {
+			t.Errorf("nativePath(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	relative := strings.Repeat("каталог\\", 30) + "a.bmp"
+	abs, err := filepath.Abs(relative)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := nativePath(relative); got != `\\?\`+abs {
+		t.Errorf("nativePath of a long relative path = %q, want %q", got, `\\?\`+abs)
+	}
+}
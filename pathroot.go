@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Directory that names taken from a directory tree or from requests that may not be trusted have to stay
+// in. Names that climb out of it with "..", absolute names elsewhere and, unless symlinks are followed,
+// names that are or go through a symlink below it are refused, so that a crafted name or a link planted in
+// the tree cannot make a run read or overwrite files outside it.
+type pathRoot struct {
+	dir            string // Absolute and clean, as given
+	resolved       string // dir with its symlinks resolved, the same when it has none or does not exist yet
+	followSymlinks bool
+}
+
+// Returns the root of a directory. Symlinks to the directory itself are followed either way, as the user
+// named it.
+func newPathRoot(dir string, followSymlinks bool) (*pathRoot, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, msgError("error.path_root", dir, err)
+	}
+	root := &pathRoot{dir: abs, resolved: abs, followSymlinks: followSymlinks}
+	if onOSFileSystem() {
+		if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+			root.resolved = resolved
+		}
+	}
+	return root, nil
+}
+
+// Returns the absolute, clean form of a name, relative ones taken from the root, or an error when it
+// leaves the root or, unless symlinks are followed, is or goes through a symlink below it
+func (root *pathRoot) resolve(name string) (string, error) {
+	path := name
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root.dir, path)
+	}
+	path = filepath.Clean(path)
+	base, ok := root.dir, within(root.dir, path)
+	if !ok {
+		base, ok = root.resolved, within(root.resolved, path)
+	}
+	if !ok {
+		return "", msgError("error.path_escape", name, root.dir)
+	}
+	if !onOSFileSystem() {
+		return path, nil
+	}
+	if root.followSymlinks {
+		// Links are followed as long as where they lead stays in the root
+		resolved, err := resolveExisting(path)
+		if err != nil || !within(root.resolved, resolved) && !within(root.dir, resolved) {
+			return "", msgError("error.path_escape", name, root.dir)
+		}
+		return path, nil
+	}
+
+	// Parts that do not exist yet are created by the run, as directories and files rather than links
+	rel, _ := filepath.Rel(base, path)
+	current := base
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(nativePath(current))
+		if err != nil {
+			break
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return "", msgError("error.symlink", name)
+		}
+	}
+	return path, nil
+}
+
+// Returns a clean absolute path with the symlinks of its longest existing prefix resolved and the rest,
+// which the run creates, joined to it. A link whose target does not exist fails, as what creating the
+// rest would write through it cannot be checked.
+func resolveExisting(path string) (string, error) {
+	prefix, rest := path, ""
+	for {
+		if _, err := os.Lstat(nativePath(prefix)); err == nil {
+			resolved, err := filepath.EvalSymlinks(prefix)
+			if err != nil {
+				return "", err
+			}
+			return filepath.Join(resolved, rest), nil
+		}
+		parent := filepath.Dir(prefix)
+		if parent == prefix {
+			return path, nil
+		}
+		prefix, rest = parent, filepath.Join(filepath.Base(prefix), rest)
+	}
+}
+
+// Reports whether a clean absolute path is dir or lies below it
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Reports whether a file of the file system of sources and outputs is a symlink. Other file systems than
+// the operating system's have none.
+func isSymlink(name string) bool {
+	if !onOSFileSystem() || name == stdioName {
+		return false
+	}
+	info, err := os.Lstat(nativePath(name))
+	return err == nil && info.Mode()&fs.ModeSymlink != 0
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// With symlinks followed, a name may go through a link only while the link leads into the root, and one
+// that does not exist yet may not be created through a link that leads out of it
+func TestPathRootFollowedSymlinks(t *testing.T) {
+	dir, outside := t.TempDir(), t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.bmp"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"out":      outside,
+		"file.bmp": filepath.Join(outside, "secret.bmp"),
+		"in":       filepath.Join(dir, "sub"),
+		"dangling": filepath.Join(outside, "missing.bmp"),
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Skipf("cannot create symlinks: %v", err)
+		}
+	}
+	root, err := newPathRoot(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"sub/a.bmp", true},
+		{"in/a.bmp", true},
+		{"in/new/a.bmp", true},
+		{"out", false},
+		{"out/secret.bmp", false},
+		{"out/new/a.bmp", false},
+		{"file.bmp", false},
+		{"dangling", false},
+		{"../a.bmp", false},
+	}
+	for _, tt := range tests {
+		_, err := root.resolve(tt.name)
+		if (err == nil) != tt.ok {
+			t.Errorf("resolve(%q) = %v, want ok %t", tt.name, err, tt.ok)
+		}
+	}
+}
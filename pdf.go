@@ -0,0 +1,1038 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"creditcard/bmp"
+)
+
+const (
+	// Resolution pages are rendered at by an external rasterizer when --dpi is not set
+	defaultPDFDPI = 300
+	// Rasterizer run when a page is not a single scanned image and --rasterizer is not set
+	defaultPDFRasterizer = "pdftoppm -r {dpi} -f {page} -l {page} -singlefile -png {file}"
+	maxPDFDepth          = 64
+	maxPDFStream         = 1 << 28 // Bytes a stream other than an image may decode to
+)
+
+// How a PDF source is turned into an image: the page, counted from 1, the --dpi value, if set, and the
+// command of --rasterizer, if set
+type pdfOptions struct {
+	page       int
+	dpi        string
+	rasterizer string
+}
+
+// Returns the PDF options of an apply command
+func (cmd *commandArgs) pdfOptions() pdfOptions {
+	return pdfOptions{page: cmd.page, dpi: cmd.dpi, rasterizer: cmd.rasterizer}
+}
+
+// Turns a page of a PDF document into an image, returning the resolution it has in dots per inch
+type pdfRasterizer interface {
+	rasterize(data []byte, page int, dpi float64, limits DecodeOptions) (*Image, float64, error)
+}
+
+// Reports whether a source is a PDF document
+func (s *ioSettings) isPDFSource(filename string) bool {
+	file, err := s.openInput(filename)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	magic := make([]byte, 5)
+	n, _ := io.ReadFull(file, magic)
+	return string(magic[:n]) == "%PDF-"
+}
+
+// Reads a page of a PDF source as an image, with the resolution it has in dots per inch. Pages that are
+// a single scanned image, as scanners and most scanning software write them, are read by the embedded
+// rasterizer at the resolution they were scanned at; other pages, and every page when --rasterizer is
+// set, are rendered by an external command at the resolution of --dpi, 300 by default.
+func (s *ioSettings) loadPDFPage(filename string, opts pdfOptions) (*Image, float64, error) {
+	logDetail("info.opening_file", filename)
+	file, err := s.openInput(filename)
+	if err != nil {
+		return nil, 0, msgError("error.open_file", err)
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return nil, 0, msgError("error.open_file", err)
+	}
+	metrics.addBytesRead(int64(len(data)))
+
+	opts.page = max(opts.page, 1)
+	dpi := float64(defaultPDFDPI)
+	if opts.dpi != "" {
+		dpi, _ = strconv.ParseFloat(opts.dpi, 64)
+	}
+	var rasterizer pdfRasterizer = embeddedRasterizer{}
+	if opts.rasterizer != "" {
+		rasterizer = externalRasterizer{opts.rasterizer}
+	}
+	img, resolution, err := rasterizer.rasterize(data, opts.page, dpi, s.Decode)
+	if unsupported, ok := err.(*pdfUnsupported); ok {
+		program := strings.Fields(defaultPDFRasterizer)[0]
+		if _, lookErr := exec.LookPath(program); lookErr != nil {
+			return nil, 0, msgError("error.pdf_page_content", filename, opts.page, unsupported)
+		}
+		logDetail("info.pdf_rasterizer", opts.page, unsupported, program)
+		img, resolution, err = externalRasterizer{defaultPDFRasterizer}.rasterize(data, opts.page, dpi, s.Decode)
+	}
+	if err != nil {
+		if e, ok := err.(*pdfPageRange); ok {
+			return nil, 0, msgError("error.pdf_page_range", filename, e.pages, opts.page)
+		}
+		return nil, 0, err
+	}
+	return img, resolution, nil
+}
+
+// Reports why the embedded rasterizer cannot read a page, which an external one may still render
+type pdfUnsupported struct {
+	key  string
+	args []any
+}
+
+func (e *pdfUnsupported) Error() string { return msg(e.key, e.args...) }
+
+func unsupportedPDF(key string, args ...any) error {
+	return &pdfUnsupported{key, args}
+}
+
+// Reports a page past the last page of a document
+type pdfPageRange struct {
+	pages int
+}
+
+func (e *pdfPageRange) Error() string { return fmt.Sprintf("the document has %d pages", e.pages) }
+
+// Validates a --rasterizer command, which needs at least the program to run
+func checkRasterizer(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return msgError("expect.command")
+	}
+	return nil
+}
+
+// Renders pages with a command that writes the page as a PNG, JPEG or BMP file to standard output. The
+// command is split at spaces, and {file}, {page} and {dpi} in it are replaced by a temporary copy of the
+// document, the page number and the resolution.
+type externalRasterizer struct {
+	command string
+}
+
+func (r externalRasterizer) rasterize(data []byte, page int, dpi float64, limits DecodeOptions) (*Image, float64, error) {
+	defer metrics.observeStage("decode", time.Now())
+	temp, err := os.CreateTemp("", "bitmap-*.pdf")
+	if err != nil {
+		return nil, 0, msgError("error.create_file", err)
+	}
+	defer os.Remove(temp.Name())
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, 0, msgError("error.create_file", err)
+	}
+
+	replacer := strings.NewReplacer("{file}", temp.Name(), "{page}", strconv.Itoa(page), "{dpi}", strconv.FormatFloat(dpi, 'f', -1, 64))
+	args := strings.Fields(r.command)
+	if len(args) == 0 {
+		return nil, 0, msgError("error.no_rasterizer")
+	}
+	for i := range args {
+		args[i] = replacer.Replace(args[i])
+	}
+	var stdout, stderr bytes.Buffer
+	command := exec.Command(args[0], args[1:]...)
+	command.Stdout, command.Stderr = &stdout, &stderr
+	err = command.Run()
+	if message := strings.TrimSpace(stderr.String()); err != nil && message != "" {
+		err = fmt.Errorf("%w: %s", err, message)
+	}
+	if err != nil {
+		return nil, 0, msgError("error.pdf_rasterizer", args[0], err)
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(stdout.Bytes()))
+	if err != nil {
+		return nil, 0, msgError("error.pdf_rasterizer", args[0], err)
+	}
+	if err := limits.CheckSize(int64(config.Width), int64(config.Height), int64(stdout.Len())); err != nil {
+		return nil, 0, localizeError(err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(stdout.Bytes()))
+	if err != nil {
+		return nil, 0, msgError("error.pdf_rasterizer", args[0], err)
+	}
+	return bmp.FromImage(img), dpi, nil
+}
+
+// Reads pages that are a single image covering the whole page, as scanned documents are, by decoding that
+// image at the resolution it was scanned at. Images compressed with DCT (JPEG), Flate with or without PNG
+// predictors, ASCIIHex, ASCII85 or RunLength, in gray, RGB, CMYK, ICC-based or indexed color, are read;
+// other pages, such as pages of text or images compressed as CCITT fax, JBIG2 or JPEG 2000, are left to
+// an external rasterizer.
+type embeddedRasterizer struct{}
+
+func (embeddedRasterizer) rasterize(data []byte, page int, _ float64, limits DecodeOptions) (*Image, float64, error) {
+	defer metrics.observeStage("decode", time.Now())
+	doc := parsePDF(data)
+	if doc.encrypted {
+		return nil, 0, unsupportedPDF("pdf.encrypted")
+	}
+	pages := doc.pages()
+	if len(pages) == 0 {
+		return nil, 0, unsupportedPDF("pdf.damaged")
+	}
+	if page > len(pages) {
+		return nil, 0, &pdfPageRange{len(pages)}
+	}
+	p := pages[page-1]
+
+	// The largest image, which must have the proportions of the page, as a scan has
+	var images []*pdfStream
+	doc.pageImages(p.resources, 0, &images)
+	var scan *pdfStream
+	area := 0
+	for _, s := range images {
+		width, _ := doc.int(s.dict["Width"])
+		height, _ := doc.int(s.dict["Height"])
+		if width > 0 && height > 0 && width*height > area {
+			scan, area = s, width*height
+		}
+	}
+	if scan == nil {
+		return nil, 0, unsupportedPDF("pdf.no_image")
+	}
+	width, _ := doc.int(scan.dict["Width"])
+	height, _ := doc.int(scan.dict["Height"])
+	pageWidth, pageHeight := p.mediaBox[2]-p.mediaBox[0], p.mediaBox[3]-p.mediaBox[1]
+	if pageWidth <= 0 || pageHeight <= 0 || math.Abs(float64(width)/float64(height)/(pageWidth/pageHeight)-1) > 0.05 {
+		return nil, 0, unsupportedPDF("pdf.partial_image")
+	}
+
+	src, err := doc.decodeImage(scan, width, height, limits)
+	if err != nil {
+		return nil, 0, err
+	}
+	img := bmp.FromImage(src)
+	if p.rotate != 0 {
+		if img, err = img.Rotate(p.rotate, nil); err != nil {
+			return nil, 0, localizeError(err)
+		}
+	}
+	logDetail("info.pdf_image", page, width, height)
+	return img, float64(width) / pageWidth * 72, nil
+}
+
+// PDF objects are parsed into nil, bool, int, float64, []byte for strings, pdfName, []any for arrays,
+// pdfDict, pdfRef and, for indirect objects with data, *pdfStream
+type (
+	pdfName    string
+	pdfKeyword string
+	pdfDict    map[pdfName]any
+	pdfRef     struct{ num, gen int }
+)
+
+// A stream, with its data as stored, before its filters are undone
+type pdfStream struct {
+	dict pdfDict
+	data []byte
+}
+
+// Reads PDF objects from a position of the data
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+var errPDFSyntax = unsupportedPDF("pdf.damaged")
+
+func isPDFSpace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// Skips white space and comments
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch c := l.data[l.pos]; {
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		case isPDFSpace(c):
+			l.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (l *pdfLexer) hasPrefix(s string) bool {
+	return bytes.HasPrefix(l.data[l.pos:], []byte(s))
+}
+
+// Returns the regular characters at the position: a number, a keyword or the rest of a name
+func (l *pdfLexer) word() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// Parses the object at the position, nested at most maxPDFDepth deep
+func (l *pdfLexer) object(depth int) (any, error) {
+	l.skipSpace()
+	if depth > maxPDFDepth || l.pos >= len(l.data) {
+		return nil, errPDFSyntax
+	}
+	switch c := l.data[l.pos]; {
+	case c == '/':
+		l.pos++
+		return pdfName(unescapePDFName(l.word())), nil
+	case l.hasPrefix("<<"):
+		l.pos += 2
+		dict := pdfDict{}
+		for {
+			l.skipSpace()
+			if l.hasPrefix(">>") {
+				l.pos += 2
+				return dict, nil
+			}
+			key, err := l.object(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			name, ok := key.(pdfName)
+			if !ok {
+				return nil, errPDFSyntax
+			}
+			if dict[name], err = l.object(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+	case c == '<':
+		end := bytes.IndexByte(l.data[l.pos:], '>')
+		if end < 0 {
+			return nil, errPDFSyntax
+		}
+		digits := strings.Join(strings.Fields(string(l.data[l.pos+1:l.pos+end])), "")
+		l.pos += end + 1
+		if len(digits)%2 == 1 {
+			digits += "0"
+		}
+		s, err := hex.DecodeString(digits)
+		if err != nil {
+			return nil, errPDFSyntax
+		}
+		return s, nil
+	case c == '[':
+		l.pos++
+		array := []any{}
+		for {
+			l.skipSpace()
+			if l.hasPrefix("]") {
+				l.pos++
+				return array, nil
+			}
+			value, err := l.object(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+	case c == '(':
+		return l.literal()
+	}
+
+	word := l.word()
+	switch word {
+	case "":
+		return nil, errPDFSyntax
+	case "true", "false":
+		return word == "true", nil
+	case "null":
+		return nil, nil
+	}
+	if n, err := strconv.Atoi(word); err == nil {
+		// Two integers followed by R refer to an object
+		start := l.pos
+		l.skipSpace()
+		if gen, err := strconv.Atoi(l.word()); err == nil {
+			l.skipSpace()
+			if l.word() == "R" {
+				return pdfRef{n, gen}, nil
+			}
+		}
+		l.pos = start
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(word, 64); err == nil {
+		return f, nil
+	}
+	return pdfKeyword(word), nil
+}
+
+// Parses a literal string, whose parentheses nest unless escaped
+func (l *pdfLexer) literal() ([]byte, error) {
+	var s []byte
+	level := 1
+	for l.pos++; l.pos < len(l.data); l.pos++ {
+		c := l.data[l.pos]
+		switch c {
+		case '(':
+			level++
+		case ')':
+			if level--; level == 0 {
+				l.pos++
+				return s, nil
+			}
+		case '\\':
+			if l.pos++; l.pos >= len(l.data) {
+				return nil, errPDFSyntax
+			}
+			c = l.data[l.pos]
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// A line break after a backslash continues the string on the next line
+				if c == '\r' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '\n' {
+					l.pos++
+				}
+				continue
+			}
+			if c >= '0' && c <= '7' {
+				value := 0
+				for i := 0; i < 3 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+					value = value*8 + int(l.data[l.pos]-'0')
+					l.pos++
+				}
+				l.pos--
+				c = byte(value)
+			}
+		}
+		s = append(s, c)
+	}
+	return nil, errPDFSyntax
+}
+
+// Undoes the #xx escapes of a name
+func unescapePDFName(name string) string {
+	if !strings.Contains(name, "#") {
+		return name
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '#' && i+2 < len(name) {
+			if c, err := strconv.ParseUint(name[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+// The objects of a PDF document, by object number
+type pdfDocument struct {
+	objects   map[int]any
+	root      pdfDict
+	encrypted bool
+}
+
+var pdfObjectHeader = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+
+// Parses the objects of a document by scanning it from start to end rather than through its cross-reference
+// tables, so that damaged and incrementally updated files read as well; a later definition of an object
+// replaces an earlier one, as it does in an update. Objects inside object streams are read too.
+func parsePDF(data []byte) *pdfDocument {
+	doc := &pdfDocument{objects: map[int]any{}}
+	// Trailers, and cross-reference streams, which hold the trailer entries in newer files, by position
+	trailers := map[int]pdfDict{}
+	for pos := 0; pos < len(data); {
+		loc := pdfObjectHeader.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		num, _ := strconv.Atoi(string(data[pos+loc[2] : pos+loc[3]]))
+		start := pos + loc[0]
+		l := &pdfLexer{data: data, pos: pos + loc[1]}
+		pos = l.pos
+		value, err := l.object(0)
+		if err != nil {
+			continue
+		}
+		l.skipSpace()
+		pos = l.pos
+		if dict, ok := value.(pdfDict); ok && l.hasPrefix("stream") {
+			var stream []byte
+			stream, pos = streamData(data, l.pos+len("stream"), dict["Length"])
+			value = &pdfStream{dict, stream}
+			if dict["Type"] == pdfName("XRef") {
+				trailers[start] = dict
+			}
+		}
+		doc.objects[num] = value
+	}
+	for at := 0; ; {
+		i := bytes.Index(data[at:], []byte("trailer"))
+		if i < 0 {
+			break
+		}
+		l := &pdfLexer{data: data, pos: at + i + len("trailer")}
+		if dict, ok := ignoreError(l.object(0)).(pdfDict); ok {
+			trailers[at+i] = dict
+		}
+		at += i + len("trailer")
+	}
+
+	for num, value := range doc.objects {
+		if s, ok := value.(*pdfStream); ok && s.dict["Type"] == pdfName("ObjStm") {
+			doc.readObjectStream(num, s)
+		}
+	}
+
+	// Updates append their trailer, so the last one that names the catalog is the current one
+	for _, at := range slices.Sorted(maps.Keys(trailers)) {
+		trailer := trailers[at]
+		if root := doc.dict(trailer["Root"]); root != nil {
+			doc.root = root
+			doc.encrypted = trailer["Encrypt"] != nil
+		}
+	}
+	if doc.root == nil {
+		for _, value := range doc.objects {
+			if dict, ok := value.(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+				doc.root = dict
+			}
+		}
+	}
+	return doc
+}
+
+func ignoreError(value any, _ error) any {
+	return value
+}
+
+// Returns the data of a stream starting after its stream keyword, and the position after its endstream
+// keyword. Length is trusted when endstream follows it; otherwise, as when it refers to an object not read
+// yet, the data ends at the next endstream.
+func streamData(data []byte, start int, length any) ([]byte, int) {
+	if bytes.HasPrefix(data[start:], []byte("\r\n")) {
+		start += 2
+	} else if start < len(data) && (data[start] == '\n' || data[start] == '\r') {
+		start++
+	}
+	if n, ok := length.(int); ok && n >= 0 && start+n <= len(data) {
+		end := start + n
+		rest := bytes.TrimLeft(data[end:], "\r\n \t")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			return data[start:end], len(data) - len(rest) + len("endstream")
+		}
+	}
+	i := bytes.Index(data[start:], []byte("endstream"))
+	if i < 0 {
+		return data[start:], len(data)
+	}
+	end := start + i
+	if end > start && data[end-1] == '\n' {
+		end--
+	}
+	if end > start && data[end-1] == '\r' {
+		end--
+	}
+	return data[start:end], start + i + len("endstream")
+}
+
+// Adds the objects of an object stream that are not defined outside of one
+func (d *pdfDocument) readObjectStream(num int, s *pdfStream) {
+	data, jpeg, err := d.decodeFilters(s, maxPDFStream)
+	if err != nil || jpeg {
+		return
+	}
+	count, _ := d.int(s.dict["N"])
+	first, _ := d.int(s.dict["First"])
+	header := &pdfLexer{data: data}
+	for i := 0; i < count; i++ {
+		objNum, ok1 := ignoreError(header.object(0)).(int)
+		offset, ok2 := ignoreError(header.object(0)).(int)
+		if !ok1 || !ok2 {
+			return
+		}
+		if _, ok := d.objects[objNum]; ok || objNum == num || first+offset >= len(data) || first+offset < 0 {
+			continue
+		}
+		l := &pdfLexer{data: data, pos: first + offset}
+		if value, err := l.object(0); err == nil {
+			d.objects[objNum] = value
+		}
+	}
+}
+
+// Returns the object a value refers to, or the value itself when it is not a reference
+func (d *pdfDocument) resolve(value any) any {
+	for range maxPDFDepth {
+		ref, ok := value.(pdfRef)
+		if !ok {
+			return value
+		}
+		value = d.objects[ref.num]
+	}
+	return nil
+}
+
+// Returns the dictionary a value is or refers to, that of a stream included, or nil
+func (d *pdfDocument) dict(value any) pdfDict {
+	switch v := d.resolve(value).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+func (d *pdfDocument) int(value any) (int, bool) {
+	switch v := d.resolve(value).(type) {
+	case int:
+		return v, true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
+
+func (d *pdfDocument) float(value any) (float64, bool) {
+	switch v := d.resolve(value).(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func (d *pdfDocument) array(value any) []any {
+	array, _ := d.resolve(value).([]any)
+	return array
+}
+
+// A page, with the attributes it inherits from the page tree; the rotation is clockwise, in degrees
+type pdfPage struct {
+	resources pdfDict
+	mediaBox  [4]float64
+	rotate    int
+}
+
+// Returns the pages of the document in order
+func (d *pdfDocument) pages() []pdfPage {
+	var pages []pdfPage
+	visited := map[int]bool{}
+	var walk func(node pdfDict, inherited pdfPage, depth int)
+	walk = func(node pdfDict, inherited pdfPage, depth int) {
+		if resources := d.dict(node["Resources"]); resources != nil {
+			inherited.resources = resources
+		}
+		if box := d.array(node["MediaBox"]); len(box) == 4 {
+			for i := range box {
+				inherited.mediaBox[i], _ = d.float(box[i])
+			}
+		}
+		if rotate, ok := d.int(node["Rotate"]); ok {
+			inherited.rotate = (rotate%360 + 360) % 360 / 90 * 90
+		}
+		kids, ok := d.resolve(node["Kids"]).([]any)
+		if !ok {
+			pages = append(pages, inherited)
+			return
+		}
+		if depth >= maxPDFDepth {
+			return
+		}
+		for _, kid := range kids {
+			if ref, ok := kid.(pdfRef); ok {
+				if visited[ref.num] {
+					continue
+				}
+				visited[ref.num] = true
+			}
+			if dict := d.dict(kid); dict != nil {
+				walk(dict, inherited, depth+1)
+			}
+		}
+	}
+	if root := d.dict(d.root["Pages"]); root != nil {
+		// Letter size is the default of readers for pages without a media box
+		walk(root, pdfPage{mediaBox: [4]float64{0, 0, 612, 792}}, 0)
+	}
+	return pages
+}
+
+// Collects the image XObjects of resources, looking into the form XObjects they hold as well
+func (d *pdfDocument) pageImages(resources pdfDict, depth int, images *[]*pdfStream) {
+	if depth > 8 {
+		return
+	}
+	for _, value := range d.dict(resources["XObject"]) {
+		s, ok := d.resolve(value).(*pdfStream)
+		if !ok {
+			continue
+		}
+		switch s.dict["Subtype"] {
+		case pdfName("Image"):
+			*images = append(*images, s)
+		case pdfName("Form"):
+			d.pageImages(d.dict(s.dict["Resources"]), depth+1, images)
+		}
+	}
+}
+
+// Returns the entries of a value that may be given once or as an array, such as the filters of a stream
+func (d *pdfDocument) list(value any) []any {
+	switch v := d.resolve(value).(type) {
+	case nil:
+		return nil
+	case []any:
+		return v
+	default:
+		return []any{v}
+	}
+}
+
+// Undoes the filters of a stream, decoding at most limit bytes. A DCT filter, which must be the last,
+// is left for the JPEG decoder, and reported.
+func (d *pdfDocument) decodeFilters(s *pdfStream, limit int64) ([]byte, bool, error) {
+	data := s.data
+	filters := d.list(s.dict["Filter"])
+	params := d.list(s.dict["DecodeParms"])
+	for i, filter := range filters {
+		var param pdfDict
+		if i < len(params) {
+			param = d.dict(params[i])
+		}
+		name, _ := d.resolve(filter).(pdfName)
+		var err error
+		switch name {
+		case "FlateDecode", "Fl":
+			var r io.ReadCloser
+			if r, err = zlib.NewReader(bytes.NewReader(data)); err == nil {
+				// Streams cut short still give the rows before the cut
+				data, _ = io.ReadAll(io.LimitReader(r, limit))
+				r.Close()
+				data, err = d.unpredict(data, param)
+			}
+		case "ASCIIHexDecode", "AHx":
+			if end := bytes.IndexByte(data, '>'); end >= 0 {
+				data = data[:end]
+			}
+			digits := strings.Join(strings.Fields(string(data)), "")
+			if len(digits)%2 == 1 {
+				digits += "0"
+			}
+			data, err = hex.DecodeString(digits)
+		case "ASCII85Decode", "A85":
+			data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+			if end := bytes.Index(data, []byte("~>")); end >= 0 {
+				data = data[:end]
+			}
+			data, err = io.ReadAll(io.LimitReader(ascii85.NewDecoder(bytes.NewReader(data)), limit))
+		case "RunLengthDecode", "RL":
+			data = runLengthDecode(data, limit)
+		case "DCTDecode", "DCT":
+			return data, true, nil
+		default:
+			return nil, false, unsupportedPDF("pdf.filter", string(name))
+		}
+		if err != nil {
+			return nil, false, unsupportedPDF("pdf.damaged")
+		}
+	}
+	return data, false, nil
+}
+
+// Undoes the RunLength filter: a length byte below 128 precedes that many bytes plus one, copied, and one
+// above 128 precedes a byte repeated 257 minus that many times, until 128 ends the data
+func runLengthDecode(data []byte, limit int64) []byte {
+	var out []byte
+	for i := 0; i < len(data) && data[i] != 128 && int64(len(out)) < limit; {
+		n := int(data[i])
+		if n < 128 {
+			end := min(i+2+n, len(data))
+			out = append(out, data[i+1:end]...)
+			i = end
+		} else if i+1 < len(data) {
+			out = append(out, bytes.Repeat(data[i+1:i+2], 257-n)...)
+			i += 2
+		} else {
+			break
+		}
+	}
+	return out
+}
+
+// Undoes the PNG predictors of Flate data, whose rows each start with the PNG filter type
+func (d *pdfDocument) unpredict(data []byte, param pdfDict) ([]byte, error) {
+	predictor, _ := d.int(param["Predictor"])
+	if predictor <= 1 {
+		return data, nil
+	}
+	if predictor < 10 {
+		return nil, unsupportedPDF("pdf.filter", fmt.Sprintf("FlateDecode /Predictor %d", predictor))
+	}
+	colors, bits, columns := 1, 8, 1
+	if n, ok := d.int(param["Colors"]); ok && n > 0 {
+		colors = n
+	}
+	if n, ok := d.int(param["BitsPerComponent"]); ok && n > 0 {
+		bits = n
+	}
+	if n, ok := d.int(param["Columns"]); ok && n > 0 {
+		columns = n
+	}
+	bpp := max(colors*bits/8, 1)
+	stride := (colors*bits*columns + 7) / 8
+	out := make([]byte, 0, len(data)/(stride+1)*stride)
+	prev := make([]byte, stride)
+	for row := 0; row+1+stride <= len(data); row += 1 + stride {
+		filter, cur := data[row], data[row+1:row+1+stride]
+		for i := range cur {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = cur[i-bpp], prev[i-bpp]
+			}
+			up := prev[i]
+			switch filter {
+			case 1:
+				cur[i] += left
+			case 2:
+				cur[i] += up
+			case 3:
+				cur[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				cur[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, cur...)
+		prev = cur
+	}
+	return out, nil
+}
+
+// Returns the neighbour the Paeth predictor of PNG picks
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+// A color space of image samples: the components a color has, and for indexed color the palette, whose
+// entries hold as many components each
+type pdfColorSpace struct {
+	components int
+	palette    []byte
+}
+
+// Returns the color space a /ColorSpace value names
+func (d *pdfDocument) colorSpace(value any, depth int) (pdfColorSpace, error) {
+	value = d.resolve(value)
+	name, _ := value.(pdfName)
+	array, _ := value.([]any)
+	if len(array) > 0 {
+		name, _ = d.resolve(array[0]).(pdfName)
+	}
+	switch name {
+	case "DeviceGray", "G", "CalGray":
+		return pdfColorSpace{components: 1}, nil
+	case "DeviceRGB", "RGB", "CalRGB":
+		return pdfColorSpace{components: 3}, nil
+	case "DeviceCMYK", "CMYK":
+		return pdfColorSpace{components: 4}, nil
+	case "ICCBased":
+		if len(array) == 2 {
+			if n, _ := d.int(d.dict(array[1])["N"]); n == 1 || n == 3 || n == 4 {
+				return pdfColorSpace{components: n}, nil
+			}
+		}
+	case "Indexed", "I":
+		if len(array) == 4 && depth == 0 {
+			base, err := d.colorSpace(array[1], depth+1)
+			if err != nil {
+				return base, err
+			}
+			high, _ := d.int(array[2])
+			var lookup []byte
+			switch v := d.resolve(array[3]).(type) {
+			case []byte:
+				lookup = v
+			case *pdfStream:
+				data, jpeg, err := d.decodeFilters(v, maxPDFStream)
+				if err != nil || jpeg {
+					return base, unsupportedPDF("pdf.damaged")
+				}
+				lookup = data
+			}
+			entries := min(max(high+1, 1), 256)
+			padded := make([]byte, entries*base.components)
+			copy(padded, lookup)
+			return pdfColorSpace{components: base.components, palette: padded}, nil
+		}
+	}
+	return pdfColorSpace{}, unsupportedPDF("pdf.color_space", string(name))
+}
+
+// Decodes an image XObject within the given size limits
+func (d *pdfDocument) decodeImage(s *pdfStream, width, height int, limits DecodeOptions) (image.Image, error) {
+	if err := limits.CheckSize(int64(width), int64(height), int64(len(s.data))); err != nil {
+		return nil, localizeError(err)
+	}
+	if mask, _ := d.resolve(s.dict["ImageMask"]).(bool); mask {
+		return nil, unsupportedPDF("pdf.color_space", "ImageMask")
+	}
+	bits, ok := d.int(s.dict["BitsPerComponent"])
+	if !ok {
+		bits = 8
+	}
+	// Rows of up to 4 components of 16 bits, and the predictor byte of each
+	limit := int64(height) * (int64(width)*8 + 1)
+	data, isJPEG, err := d.decodeFilters(s, limit)
+	if err != nil {
+		return nil, err
+	}
+	if isJPEG {
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, unsupportedPDF("pdf.damaged")
+		}
+		return img, nil
+	}
+	if bits != 1 && bits != 2 && bits != 4 && bits != 8 && bits != 16 {
+		return nil, unsupportedPDF("pdf.damaged")
+	}
+	space, err := d.colorSpace(s.dict["ColorSpace"], 0)
+	if err != nil {
+		return nil, err
+	}
+	samples := space.components
+	if space.palette != nil {
+		samples = 1
+	}
+	stride := (width*samples*bits + 7) / 8
+	if len(data) < stride*height {
+		return nil, unsupportedPDF("pdf.damaged")
+	}
+
+	// Samples map to the range of /Decode, [0 1] for each component by default, or to palette indexes
+	maxSample := float64(int(1)<<bits - 1)
+	ranges := make([]float64, 2*samples)
+	for i := range samples {
+		ranges[2*i+1] = 1
+	}
+	if decode := d.array(s.dict["Decode"]); len(decode) == len(ranges) && space.palette == nil {
+		for i := range decode {
+			ranges[i], _ = d.float(decode[i])
+		}
+	}
+	sample := func(row []byte, i int) float64 {
+		var v int
+		switch bits {
+		case 16:
+			v = int(row[2*i])<<8 | int(row[2*i+1])
+		case 8:
+			v = int(row[i])
+		default:
+			bit := i * bits
+			v = int(row[bit/8]>>(8-bits-bit%8)) & (1<<bits - 1)
+		}
+		return float64(v) / maxSample
+	}
+	level := func(row []byte, i, component int) uint8 {
+		v := ranges[2*component] + sample(row, i)*(ranges[2*component+1]-ranges[2*component])
+		return uint8(math.Round(min(max(v, 0), 1) * 255))
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	components := make([]uint8, 4)
+	for y := range height {
+		row := data[y*stride : (y+1)*stride]
+		for x := range width {
+			if space.palette != nil {
+				index := min(int(math.Round(sample(row, x)*maxSample)), len(space.palette)/space.components-1)
+				copy(components, space.palette[index*space.components:(index+1)*space.components])
+			} else {
+				for c := range samples {
+					components[c] = level(row, x*samples+c, c)
+				}
+			}
+			var r, g, b uint8
+			switch space.components {
+			case 1:
+				r, g, b = components[0], components[0], components[0]
+			case 3:
+				r, g, b = components[0], components[1], components[2]
+			case 4:
+				r, g, b = color.CMYKToRGB(components[0], components[1], components[2], components[3])
+			}
+			img.SetNRGBA(x, y, color.NRGBA{r, g, b, 255})
+		}
+	}
+	return img, nil
+}
+
+// Runs apply on a page of a PDF source, which has no BMP headers. The outputs get the resolution the page
+// was read at, unless --dpi sets another one.
+func runPDFApply(cmd *commandArgs) error {
+	img, resolution, err := cmd.settings.loadPDFPage(cmd.filename, cmd.pdfOptions())
+	if err != nil {
+		return err
+	}
+	dibHeader := &DIBHeader{}
+	dpi := cmd.dpi
+	if dpi == "" {
+		dpi = strconv.FormatFloat(resolution, 'f', -1, 64)
+	}
+	setResolution(dibHeader, dpi)
+	return runApplyCommand(cmd, &BMPHeader{}, dibHeader, img)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// How alike two images of the same size look to people, as compare --metric measures it
+type qualityMetric interface {
+	// Returns the score of an image against the reference it was made from, in color channels only
+	score(reference, img *Image) float64
+	// Reports whether higher scores mean images that look more alike, as for SSIM, rather than less, as
+	// for distances
+	higherIsBetter() bool
+}
+
+// Metrics compare --metric measures, by name
+var qualityMetrics = map[string]qualityMetric{
+	"ssim":             ssimMetric{},
+	"butteraugli-lite": butteraugliLiteMetric{},
+}
+
+// Returns the names of the metrics in qualityMetrics, sorted
+func qualityMetricNames() []string {
+	return slices.Sorted(maps.Keys(qualityMetrics))
+}
+
+// Standard deviation in pixels of the Gaussian window SSIM gathers its statistics in, as in the paper
+// that defined it
+const ssimSigma = 1.5
+
+// Constants of SSIM that keep its ratios stable in flat areas, for levels out of 255
+const (
+	ssimC1 = (0.01 * 255) * (0.01 * 255)
+	ssimC2 = (0.03 * 255) * (0.03 * 255)
+)
+
+// Settings of the butteraugli-lite distance
+const (
+	// Blur in pixels both images get before they are compared, for the optics of the eye
+	perceptualBlur = 0.7
+	// Reach in pixels of the texture around a pixel that hides differences in it
+	perceptualMaskReach = 2.0
+	// Standard deviation of L* in the surroundings of a pixel that halves how visible its differences are
+	perceptualMasking = 10.0
+	// Color difference in CIELAB, ΔE*ab, that most people can just see next to each other
+	perceptualJND = 2.3
+	// Exponent of the norm the distances of the pixels are pooled by: higher ones give more weight to
+	// the worst areas, as the eye is drawn to them
+	perceptualNorm = 3
+)
+
+// Structural similarity of the luma, from 1 for images that look the same down, the mean over windows of
+// how alike their brightness, contrast and structure are
+type ssimMetric struct{}
+
+func (ssimMetric) higherIsBetter() bool { return true }
+
+func (ssimMetric) score(reference, img *Image) float64 {
+	x, y := lumaPlane(reference), lumaPlane(img)
+	n := len(x)
+	xx, yy, xy := make([]float64, n), make([]float64, n), make([]float64, n)
+	for i := range x {
+		xx[i], yy[i], xy[i] = x[i]*x[i], y[i]*y[i], x[i]*y[i]
+	}
+	w, h := img.Width, img.Height
+	mx, my := gaussianPlane(x, w, h, ssimSigma), gaussianPlane(y, w, h, ssimSigma)
+	sxx, syy, sxy := gaussianPlane(xx, w, h, ssimSigma), gaussianPlane(yy, w, h, ssimSigma), gaussianPlane(xy, w, h, ssimSigma)
+	var sum float64
+	for i := range n {
+		varX, varY, cov := sxx[i]-mx[i]*mx[i], syy[i]-my[i]*my[i], sxy[i]-mx[i]*my[i]
+		sum += (2*mx[i]*my[i] + ssimC1) * (2*cov + ssimC2) /
+			((mx[i]*mx[i] + my[i]*my[i] + ssimC1) * (varX + varY + ssimC2))
+	}
+	return sum / float64(n)
+}
+
+// Distance in steps that can just be seen, after the idea of Butteraugli but much simpler: 0 for images
+// that look the same, about 1 when a difference can just be made out, and more the plainer it is. Colors
+// are compared in CIELAB after a slight blur, differences are discounted where the reference is busy with
+// texture, which hides them, and the distances of the pixels are pooled by a norm that weighs the worst
+// areas most. Unlike SSIM it sees shifts of color as well as of brightness.
+type butteraugliLiteMetric struct{}
+
+func (butteraugliLiteMetric) higherIsBetter() bool { return false }
+
+func (butteraugliLiteMetric) score(reference, img *Image) float64 {
+	w, h := img.Width, img.Height
+	a, b := labPlanes(reference), labPlanes(img)
+	for c := range a {
+		a[c], b[c] = gaussianPlane(a[c], w, h, perceptualBlur), gaussianPlane(b[c], w, h, perceptualBlur)
+	}
+
+	// Texture is the spread of L* around each pixel of the reference
+	lightness := a[0]
+	mean := gaussianPlane(lightness, w, h, perceptualMaskReach)
+	deviations := make([]float64, len(lightness))
+	for i, l := range lightness {
+		deviations[i] = (l - mean[i]) * (l - mean[i])
+	}
+	texture := gaussianPlane(deviations, w, h, perceptualMaskReach)
+
+	var sum float64
+	for i := range lightness {
+		dl, da, db := a[0][i]-b[0][i], a[1][i]-b[1][i], a[2][i]-b[2][i]
+		d := math.Sqrt(dl*dl+da*da+db*db) / perceptualJND / (1 + math.Sqrt(max(texture[i], 0))/perceptualMasking)
+		sum += math.Pow(d, perceptualNorm)
+	}
+	return math.Pow(sum/float64(len(lightness)), 1.0/perceptualNorm)
+}
+
+// Returns the luma of the pixels, out of 255, in the order they are stored
+func lumaPlane(img *Image) []float64 {
+	plane := make([]float64, len(img.Pixels))
+	for i, p := range img.Pixels {
+		plane[i] = float64(p.Luminance()) / 1000
+	}
+	return plane
+}
+
+// Returns the L*, a* and b* planes of the pixels in the CIELAB space of the D65 white point of sRGB
+func labPlanes(img *Image) [3][]float64 {
+	var planes [3][]float64
+	for c := range planes {
+		planes[c] = make([]float64, len(img.Pixels))
+	}
+	for i, p := range img.Pixels {
+		lab := labColor(p)
+		planes[0][i], planes[1][i], planes[2][i] = lab[0], lab[1], lab[2]
+	}
+	return planes
+}
+
+// Returns a plane of w x h values blurred by a Gaussian of the given standard deviation, in rows and then
+// in columns, with the edge values repeated beyond the edges
+func gaussianPlane(plane []float64, w, h int, sigma float64) []float64 {
+	radius := int(math.Ceil(3 * sigma))
+	kernel := make([]float64, 2*radius+1)
+	var total float64
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		total += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= total
+	}
+
+	rows := make([]float64, len(plane))
+	for y := range h {
+		for x := range w {
+			var sum float64
+			for k, weight := range kernel {
+				sum += weight * plane[y*w+min(max(x+k-radius, 0), w-1)]
+			}
+			rows[y*w+x] = sum
+		}
+	}
+	out := make([]float64, len(plane))
+	for y := range h {
+		for x := range w {
+			var sum float64
+			for k, weight := range kernel {
+				sum += weight * rows[min(max(y+k-radius, 0), h-1)*w+x]
+			}
+			out[y*w+x] = sum
+		}
+	}
+	return out
+}
+
+// Parses a --metric value, a metric name with an optional score after ":" that differing images have to
+// reach to match
+func parseMetricFlag(value string) (name string, threshold float64, limited bool, ok bool) {
+	name, limit, limited := strings.Cut(value, ":")
+	if _, known := qualityMetrics[name]; !known {
+		return "", 0, false, false
+	}
+	if !limited {
+		return name, 0, false, true
+	}
+	threshold, err := strconv.ParseFloat(limit, 64)
+	return name, threshold, true, err == nil && threshold >= 0 && !math.IsInf(threshold, 0)
+}
+
+// Validates a --metric value
+func checkMetricFlag(value string) error {
+	if _, _, _, ok := parseMetricFlag(value); !ok {
+		return msgError("expect.metric", strings.Join(qualityMetricNames(), ", "))
+	}
+	return nil
+}
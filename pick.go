@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Size of the terminal assumed when it cannot be asked
+const (
+	pickDefaultColumns = 80
+	pickDefaultRows    = 24
+)
+
+// Keys of the escape sequences terminals send for arrows, plain and with Shift, the latter as xterm sends
+// them
+var pickKeySequences = map[string]string{
+	"\x1b[A": "up", "\x1b[B": "down", "\x1b[C": "right", "\x1b[D": "left",
+	"\x1bOA": "up", "\x1bOB": "down", "\x1bOC": "right", "\x1bOD": "left",
+	"\x1b[1;2A": "shift-up", "\x1b[1;2B": "shift-down", "\x1b[1;2C": "shift-right", "\x1b[1;2D": "shift-left",
+	"k": "up", "j": "down", "l": "right", "h": "left",
+	"K": "shift-up", "J": "shift-down", "L": "shift-right", "H": "shift-left",
+	"\r": "enter", "\n": "enter",
+	"q": "cancel", "\x1b": "cancel", "\x03": "cancel",
+}
+
+// Settings of the pick command
+type pickConfig struct {
+	option string // Apply option the area is printed for: "crop" or "pixelate"
+	source string
+}
+
+// Selection of the pick command over the preview of an image
+type picker struct {
+	img           *Image
+	x, y          int // Top-left corner of the selection in pixels of the image, from the top-left corner
+	width, height int
+	preview       *Image // The image scaled to the terminal, rebuilt when the terminal changes size
+	stepX, stepY  int    // Pixels of the image a pixel of the preview stands for, rounded up
+}
+
+// Parses the arguments of the pick command
+func parsePickArgs(args []string) (*pickConfig, error) {
+	cfg := &pickConfig{option: "crop"}
+	flags := []flagSpec{
+		{Name: "option", Target: &cfg.option, Choices: []string{"crop", "pixelate"}},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 1 {
+		return nil, msgError("usage.pick")
+	}
+	cfg.source = positional[0]
+	return cfg, nil
+}
+
+// Shows an image in the terminal and lets the user move and resize a selection over it with the keys,
+// then prints the selection as the option that crops, or pixelates, that area. The preview is drawn on
+// standard error, so that the option alone can be captured from standard output by a script.
+func runPick(args []string) error {
+	cfg, err := parsePickArgs(args)
+	if err != nil {
+		return err
+	}
+	_, _, img, err := loadConvertInput(cfg.source, pdfOptions{})
+	if err != nil {
+		return err
+	}
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stderr) {
+		return msgError("error.pick_terminal")
+	}
+	// The selection starts on the middle half of each side
+	p := &picker{img: img, x: img.Width / 4, y: img.Height / 4, width: max(img.Width/2, 1), height: max(img.Height/2, 1)}
+	if err := p.run(cfg.option); err != nil {
+		return err
+	}
+	fmt.Println(p.option(cfg.option))
+	return nil
+}
+
+// Reads keys until the selection is taken with Enter or given up with q, Esc or Ctrl-C, drawing it
+// again after every key
+func (p *picker) run(option string) error {
+	restore, err := makeRaw(os.Stdin, os.Stderr)
+	if err != nil {
+		return msgError("error.pick_raw", err)
+	}
+	defer restore()
+	// Draws on the alternate screen without a cursor, leaving the screen as it was once done
+	os.Stderr.WriteString("\x1b[?1049h\x1b[?25l")
+	defer os.Stderr.WriteString("\x1b[0m\x1b[?25h\x1b[?1049l")
+
+	buf := make([]byte, 16)
+	for {
+		p.draw(option)
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return msgError("error.read_input", err)
+		}
+		switch key := pickKeySequences[string(buf[:n])]; key {
+		case "enter":
+			return nil
+		case "cancel":
+			return msgError("error.pick_cancelled")
+		default:
+			p.press(key)
+		}
+	}
+}
+
+// Moves the selection for the arrows and resizes it for the arrows with Shift, by a pixel of the preview,
+// keeping it within the image
+func (p *picker) press(key string) {
+	switch key {
+	case "left":
+		p.x -= p.stepX
+	case "right":
+		p.x += p.stepX
+	case "up":
+		p.y -= p.stepY
+	case "down":
+		p.y += p.stepY
+	case "shift-left":
+		p.width -= p.stepX
+	case "shift-right":
+		p.width += p.stepX
+	case "shift-up":
+		p.height -= p.stepY
+	case "shift-down":
+		p.height += p.stepY
+	}
+	p.width = min(max(p.width, 1), p.img.Width)
+	p.height = min(max(p.height, 1), p.img.Height)
+	p.x = min(max(p.x, 0), p.img.Width-p.width)
+	p.y = min(max(p.y, 0), p.img.Height-p.height)
+}
+
+// Returns the selection as an apply option
+func (p *picker) option(name string) string {
+	return fmt.Sprintf("--%s=%d-%d-%d-%d", name, p.x, p.y, p.width, p.height)
+}
+
+// Draws the preview with the area outside the selection dimmed, two pixels to a character cell with
+// the upper half block, and a status line with the option and the keys below it
+func (p *picker) draw(option string) {
+	columns, rows, ok := terminalSize(os.Stderr)
+	if !ok {
+		columns, rows = pickDefaultColumns, pickDefaultRows
+	}
+	// Images smaller than the terminal are shown a pixel to a pixel rather than enlarged
+	width, height := fitSize(p.img.Width, p.img.Height, columns, max(rows-1, 1)*2)
+	if width > p.img.Width {
+		width, height = p.img.Width, p.img.Height
+	}
+	if p.preview == nil || p.preview.Width != width || p.preview.Height != height {
+		p.preview = applyResize(p.img, width, height, "bilinear", nil)
+		p.stepX = (p.img.Width + width - 1) / width
+		p.stepY = (p.img.Height + height - 1) / height
+	}
+
+	// Reports whether the center of a pixel of the preview falls in the selection
+	selected := func(px, py int) bool {
+		cx := (float64(px) + 0.5) * float64(p.img.Width) / float64(width)
+		cy := (float64(py) + 0.5) * float64(p.img.Height) / float64(height)
+		return cx >= float64(p.x) && cx < float64(p.x+p.width) && cy >= float64(p.y) && cy < float64(p.y+p.height)
+	}
+	shade := func(px, py int) Pixel {
+		c := pixelAt(p.preview, px, py)
+		if !selected(px, py) {
+			c = Pixel{Red: c.Red / 3, Green: c.Green / 3, Blue: c.Blue / 3}
+		}
+		return c
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for py := 0; py < height; py += 2 {
+		for px := 0; px < width; px++ {
+			top := shade(px, py)
+			fmt.Fprintf(&b, "\x1b[38;2;%d;%d;%dm", top.Red, top.Green, top.Blue)
+			if py+1 < height {
+				bottom := shade(px, py+1)
+				fmt.Fprintf(&b, "\x1b[48;2;%d;%d;%dm", bottom.Red, bottom.Green, bottom.Blue)
+			} else {
+				b.WriteString("\x1b[49m")
+			}
+			b.WriteString("▀")
+		}
+		b.WriteString("\x1b[0m\x1b[K\r\n")
+	}
+	// The status line is cut at the edge of the terminal, as a wrapped one would scroll the preview
+	status := p.option(option) + "  " + msg("info.pick_keys")
+	if utf8.RuneCountInString(status) > columns {
+		status = string([]rune(status)[:max(columns-1, 0)]) + "…"
+	}
+	b.WriteString(status + "\x1b[K\x1b[J")
+	os.Stderr.WriteString(b.String())
+}
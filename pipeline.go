@@ -0,0 +1,205 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"creditcard/bmp"
+)
+
+// Ordered chain of options applied to an image, with the hooks of the library pipeline it runs stages
+// through. Stages are named after their operations.
+type Pipeline struct {
+	Options []Option
+	bmp.StageHooks
+}
+
+// Reports how many output rows of the running stage are done
+type rowProgress = bmp.Progress
+
+// Creates a pipeline without hooks
+func NewPipeline(options []Option) *Pipeline {
+	return &Pipeline{Options: options}
+}
+
+// Applies the options in order, returning the final image. Every value is validated before the first
+// stage runs, so that a bad option late in a long pipeline fails at once rather than after the work
+// before it. Neighboring stages that move pixels or filter them one by one are recorded in a library
+// pipeline and run as one fused stage, named after its options joined by +, unless every stage result is
+// wanted.
+func (p *Pipeline) Run(img *Image) (*Image, error) {
+	total := len(p.Options)
+	if total > 0 {
+		if op, ok := findOperation(p.Options[total-1].Name); ok && op.Guard != nil {
+			return nil, msgError("error.guard_last", p.Options[total-1].Value)
+		}
+	}
+	for _, opt := range p.Options {
+		op, ok := findOperation(opt.Name)
+		if !ok {
+			return nil, msgError("error.unknown_option", opt.Name)
+		}
+		if err := checkOption(op, opt.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	// Set by a failed guard until the stage it guards has been skipped
+	skip := false
+	// Color encoding of img, which stages that need the other one get converted to
+	space := "srgb"
+
+	// Applies one stage, which may be a fused one, reporting it to the hooks
+	stage := func(name string, index int, need string, keepsLayout bool, apply func(img *Image, progress rowProgress) (*Image, error)) error {
+		if p.OnStageStart != nil {
+			p.OnStageStart(name, index, total)
+		}
+		var progress rowProgress
+		if p.OnRowsProcessed != nil {
+			progress = func(done, rows int) { p.OnRowsProcessed(name, done, rows) }
+		}
+
+		start := time.Now()
+		metrics.addPixels(int64(img.Width) * int64(img.Height))
+		// The conversion counts towards the stage that needs it
+		if need != "" && need != space {
+			img, space = convertColorSpace(img, need, nil), need
+		}
+		result, err := apply(img, progress)
+		metrics.observeStage(name, start)
+
+		if p.OnStageEnd != nil {
+			p.OnStageEnd(name, index, total, time.Since(start), err)
+		}
+		if err != nil {
+			return err
+		}
+		// File layout data is not touched by operations and carries over to the result
+		if result.Gap == nil {
+			result.Gap = img.Gap
+		}
+		if result.Palette == nil {
+			result.Palette = img.Palette
+		}
+		if result.Profile == nil {
+			result.Profile = img.Profile
+		}
+		if result.Hints == nil && keepsLayout {
+			result.Hints = img.Hints
+		}
+		// Operations that move pixels move the alpha along themselves
+		if result.Alpha == nil && keepsLayout {
+			result.Alpha = img.Alpha
+		}
+		img = result
+
+		if p.OnStageResult != nil {
+			return p.OnStageResult(name, index, img)
+		}
+		return nil
+	}
+
+	// Stages recorded for fusing, with their names, the position of the first and the encoding they need
+	var fused *bmp.Pipeline
+	var fusedNames []string
+	fusedIndex, fusedSpace := 0, ""
+	flush := func() error {
+		if fused == nil {
+			return nil
+		}
+		pipeline := fused
+		fused = nil
+		return stage(strings.Join(fusedNames, "+"), fusedIndex, fusedSpace, false, func(img *Image, progress rowProgress) (*Image, error) {
+			result, err := pipeline.Run(img, progress)
+			return result, localizeError(err)
+		})
+	}
+
+	for i, opt := range p.Options {
+		op, ok := findOperation(opt.Name)
+		if !ok {
+			return nil, msgError("error.unknown_option", opt.Name)
+		}
+
+		if op.Guard != nil {
+			if !skip {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+				if need := stageColorSpace(op, opt.Value); need != "" && need != space {
+					img, space = convertColorSpace(img, need, nil), need
+				}
+				pass, err := op.Guard(img, opt.Value)
+				if err != nil {
+					return nil, err
+				}
+				skip = !pass
+			}
+			continue
+		}
+		if skip {
+			skip = false
+			continue
+		}
+
+		if op.Fuse != nil && p.OnStageResult == nil {
+			next := fused
+			if next == nil {
+				next = bmp.NewPipeline()
+			}
+			width, height := next.Size(img.Width, img.Height)
+			if op.Fuse(next, opt.Value, width, height) {
+				if fused == nil {
+					fused, fusedNames, fusedIndex, fusedSpace = next, nil, i, ""
+				}
+				fusedNames = append(fusedNames, op.Name)
+				if need := stageColorSpace(op, opt.Value); need != "" {
+					fusedSpace = need
+				}
+				continue
+			}
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		err := stage(op.Name, i, stageColorSpace(op, opt.Value), op.KeepsLayout, func(img *Image, progress rowProgress) (*Image, error) {
+			return op.Apply(img, opt.Value, progress)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	// Files and previews always hold sRGB
+	if space != "srgb" {
+		img = convertColorSpace(img, "srgb", nil)
+	}
+	return img, nil
+}
+
+// Selects where filters, convolutions and resizing run: "cpu", or "gpu" when this build has a GPU backend
+// and the machine a GPU it can use. Otherwise gpu warns and leaves the work on the CPU.
+func selectBackend(name string) error {
+	switch name {
+	case "cpu":
+		bmp.Accel = nil
+		return nil
+	case "gpu":
+		gpu, err := openGPU()
+		if err != nil {
+			printWarning(msgError("warning.gpu_fallback", err))
+			return nil
+		}
+		logDetail("info.gpu_device", gpu.Name())
+		bmp.Accel = gpu
+		return nil
+	}
+	return msgError("error.invalid_backend", name)
+}
+
+// Applies the options in order, returning the final image
+func applyOptions(img *Image, options []Option) (*Image, error) {
+	return NewPipeline(options).Run(img)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"creditcard/bmp"
+)
+
+// Parses a --filter value: the name of a filter, which for pixelate may be followed by :size=<n> to set
+// the block size. size is 0 when it is not given.
+func parseFilter(value string) (name string, size int, err error) {
+	name, option, found := strings.Cut(value, ":")
+	if !contains(bmp.Filters, name) {
+		return "", 0, msgError("error.invalid_filter", value)
+	}
+	if found {
+		digits, ok := strings.CutPrefix(option, "size=")
+		size, err = strconv.Atoi(digits)
+		if name != "pixelate" || !ok || err != nil || size < 1 {
+			return "", 0, msgError("error.invalid_filter", value)
+		}
+	}
+	return name, size, nil
+}
+
+// Parses a --pixelate value of the form area[:size], where the area is given as for --crop, for an image
+// of the given size
+func parsePixelate(value string, width, height int) (x, y, w, h, size int, err error) {
+	area, blocks, found := strings.Cut(value, ":")
+	size = bmp.PixelateSize
+	if found {
+		if size, err = strconv.Atoi(blocks); err != nil || size < 1 {
+			return 0, 0, 0, 0, 0, msgError("error.invalid_pixelate", value)
+		}
+	}
+	x, y, w, h, err = parseCrop(area, width, height)
+	return x, y, w, h, size, err
+}
+
+// Checks a --pixelate value before the image size is known
+func checkPixelate(value string) error {
+	area, blocks, found := strings.Cut(value, ":")
+	if size, err := strconv.Atoi(blocks); found && (err != nil || size < 1) {
+		return msgError("error.invalid_pixelate", value)
+	}
+	_, _, err := parseCropNumbers(area)
+	return err
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Placeholder algorithms accepted by --algo
+var placeholderAlgos = []string{"blurhash", "thumbhash"}
+
+// Largest image the placeholders are computed from; bigger images are scaled down first, since
+// the few low-frequency components they keep do not need more detail
+const placeholderSourceSize = 100
+
+// Settings of the placeholder command
+type placeholderConfig struct {
+	algo       string
+	components string // BlurHash components as XxY, each from 1 to 9
+	decode     string // Placeholder string to render instead of encoding an image
+	size       string // Size of the rendered image as WxH, chosen from the placeholder when empty
+	filename   string // Image to encode, or the output file when decoding
+}
+
+// Parses the arguments of the placeholder command
+func parsePlaceholderArgs(args []string) (*placeholderConfig, error) {
+	cfg := &placeholderConfig{algo: "blurhash", components: "4x3"}
+	flags := []flagSpec{
+		{Name: "algo", Target: &cfg.algo, Choices: placeholderAlgos},
+		{Name: "components", Target: &cfg.components, Check: checkComponents},
+		{Name: "decode", Target: &cfg.decode, Check: nonEmpty},
+		{Name: "size", Target: &cfg.size, Check: checkSize},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(positional) != 1 {
+		return nil, msgError("usage.placeholder")
+	}
+	cfg.filename = positional[0]
+	return cfg, nil
+}
+
+// Validates a --components value
+func checkComponents(value string) error {
+	if x, y, ok := parseSize(value); !ok || x > 9 || y > 9 {
+		return msgError("expect.components")
+	}
+	return nil
+}
+
+// Validates a WxH value
+func checkSize(value string) error {
+	if _, _, ok := parseSize(value); !ok {
+		return msgError("expect.size")
+	}
+	return nil
+}
+
+// Prints the BlurHash or ThumbHash of an image, or renders one to an image file with --decode
+func runPlaceholder(args []string) error {
+	cfg, err := parsePlaceholderArgs(args)
+	if err != nil {
+		return err
+	}
+
+	if cfg.decode != "" {
+		var img *Image
+		if cfg.algo == "thumbhash" {
+			img, err = decodeThumbHash(cfg.decode, cfg.size)
+		} else {
+			img, err = decodeBlurHash(cfg.decode, cfg.size)
+		}
+		if err != nil {
+			return err
+		}
+		return globalSettings.saveOutput(cfg.filename, "", &BMPHeader{}, &DIBHeader{}, img)
+	}
+
+	_, _, img, err := globalSettings.loadImage(cfg.filename)
+	if err != nil {
+		return err
+	}
+	img = applyFit(img, placeholderSourceSize, placeholderSourceSize, false)
+	if cfg.algo == "thumbhash" {
+		fmt.Println(encodeThumbHash(img))
+		return nil
+	}
+	x, y, _ := parseSize(cfg.components)
+	fmt.Println(encodeBlurHash(img, x, y))
+	return nil
+}
+
+// Returns the pixel at column x of row y counted from the top
+func pixelAt(img *Image, x, y int) Pixel {
+	return img.Pixels[(img.Height-1-y)*img.Width+x]
+}
+
+// Sets the pixel at column x of row y counted from the top
+func setPixelAt(img *Image, x, y int, p Pixel) {
+	img.Pixels[(img.Height-1-y)*img.Width+x] = p
+}
+
+// Converts an sRGB channel value to linear light in [0, 1]
+func srgbToLinear(v byte) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 {
+		return f / 12.92
+	}
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+// Converts linear light to an sRGB channel value, clamping it to [0, 1] first
+func linearToSRGB(f float64) byte {
+	f = max(0, min(1, f))
+	if f <= 0.0031308 {
+		return byte(f*12.92*255 + 0.5)
+	}
+	return byte((1.055*math.Pow(f, 1/2.4)-0.055)*255 + 0.5)
+}
+
+// Returns the sign of v times |v| raised to exp
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
+
+// Digits of the base 83 encoding used by BlurHash
+const base83Digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// Appends value as length base 83 digits, most significant first
+func appendBase83(b []byte, value, length int) []byte {
+	for i := length - 1; i >= 0; i-- {
+		b = append(b, base83Digits[value/int(math.Pow(83, float64(i)))%83])
+	}
+	return b
+}
+
+// Decodes base 83 digits
+func decodeBase83(s string) (int, bool) {
+	value := 0
+	for i := 0; i < len(s); i++ {
+		digit := strings.IndexByte(base83Digits, s[i])
+		if digit < 0 {
+			return 0, false
+		}
+		value = value*83 + digit
+	}
+	return value, true
+}
+
+// Encodes the image as a BlurHash with the given number of horizontal and vertical components
+func encodeBlurHash(img *Image, componentsX, componentsY int) string {
+	factors := make([][3]float64, 0, componentsX*componentsY)
+	for j := 0; j < componentsY; j++ {
+		for i := 0; i < componentsX; i++ {
+			var f [3]float64
+			for y := 0; y < img.Height; y++ {
+				for x := 0; x < img.Width; x++ {
+					basis := math.Cos(math.Pi*float64(i*x)/float64(img.Width)) * math.Cos(math.Pi*float64(j*y)/float64(img.Height))
+					p := pixelAt(img, x, y)
+					f[0] += basis * srgbToLinear(p.Red)
+					f[1] += basis * srgbToLinear(p.Green)
+					f[2] += basis * srgbToLinear(p.Blue)
+				}
+			}
+			scale := 1.0
+			if i != 0 || j != 0 {
+				scale = 2
+			}
+			scale /= float64(img.Width * img.Height)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	hash := appendBase83(nil, (componentsX-1)+(componentsY-1)*9, 1)
+	maximum := 1.0
+	if len(factors) > 1 {
+		var actual float64
+		for _, f := range factors[1:] {
+			actual = max(actual, math.Abs(f[0]), math.Abs(f[1]), math.Abs(f[2]))
+		}
+		quantized := int(max(0, min(82, math.Floor(actual*166-0.5))))
+		maximum = float64(quantized+1) / 166
+		hash = appendBase83(hash, quantized, 1)
+	} else {
+		hash = appendBase83(hash, 0, 1)
+	}
+
+	dc := factors[0]
+	hash = appendBase83(hash, int(linearToSRGB(dc[0]))<<16|int(linearToSRGB(dc[1]))<<8|int(linearToSRGB(dc[2])), 4)
+	for _, f := range factors[1:] {
+		value := 0
+		for _, c := range f {
+			value = value*19 + int(max(0, min(18, math.Floor(signPow(c/maximum, 0.5)*9+9.5))))
+		}
+		hash = appendBase83(hash, value, 2)
+	}
+	return string(hash)
+}
+
+// Renders a BlurHash, at 32x32 pixels unless size is given
+func decodeBlurHash(hash, size string) (*Image, error) {
+	invalid := msgError("error.invalid_blurhash", hash)
+	if len(hash) < 6 {
+		return nil, invalid
+	}
+	sizeFlag, ok := decodeBase83(hash[:1])
+	if !ok {
+		return nil, invalid
+	}
+	componentsX, componentsY := sizeFlag%9+1, sizeFlag/9+1
+	if len(hash) != 4+2*componentsX*componentsY {
+		return nil, invalid
+	}
+	quantized, ok := decodeBase83(hash[1:2])
+	if !ok {
+		return nil, invalid
+	}
+	maximum := float64(quantized+1) / 166
+
+	colors := make([][3]float64, componentsX*componentsY)
+	dc, ok := decodeBase83(hash[2:6])
+	if !ok {
+		return nil, invalid
+	}
+	colors[0] = [3]float64{srgbToLinear(byte(dc >> 16)), srgbToLinear(byte(dc >> 8)), srgbToLinear(byte(dc))}
+	for i := 1; i < len(colors); i++ {
+		value, ok := decodeBase83(hash[4+i*2 : 6+i*2])
+		if !ok {
+			return nil, invalid
+		}
+		for c, q := range [3]int{value / (19 * 19), value / 19 % 19, value % 19} {
+			colors[i][c] = signPow(float64(q-9)/9, 2) * maximum
+		}
+	}
+
+	width, height := 32, 32
+	if size != "" {
+		width, height, _ = parseSize(size)
+	}
+	img := &Image{Width: width, Height: height, Pixels: make([]Pixel, width*height)}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var rgb [3]float64
+			for j := 0; j < componentsY; j++ {
+				for i := 0; i < componentsX; i++ {
+					basis := math.Cos(math.Pi*float64(x*i)/float64(width)) * math.Cos(math.Pi*float64(y*j)/float64(height))
+					for c := range rgb {
+						rgb[c] += colors[i+j*componentsX][c] * basis
+					}
+				}
+			}
+			setPixelAt(img, x, y, Pixel{Red: linearToSRGB(rgb[0]), Green: linearToSRGB(rgb[1]), Blue: linearToSRGB(rgb[2])})
+		}
+	}
+	return img, nil
+}
+
+// Computes the DCT factors of a ThumbHash channel: the constant term, the varying terms scaled to
+// [0, 1] and their largest magnitude. Only the components with cx*ny < nx*(ny-cy) are kept.
+func thumbHashChannel(channel []float64, w, h, nx, ny int) (dc float64, ac []float64, scale float64) {
+	for cy := 0; cy < ny; cy++ {
+		for cx := 0; cx*ny < nx*(ny-cy); cx++ {
+			var f float64
+			for y := 0; y < h; y++ {
+				fy := math.Cos(math.Pi / float64(h) * float64(cy) * (float64(y) + 0.5))
+				for x := 0; x < w; x++ {
+					f += channel[x+y*w] * math.Cos(math.Pi/float64(w)*float64(cx)*(float64(x)+0.5)) * fy
+				}
+			}
+			f /= float64(w * h)
+			if cx == 0 && cy == 0 {
+				dc = f
+				continue
+			}
+			ac = append(ac, f)
+			scale = max(scale, math.Abs(f))
+		}
+	}
+	if scale > 0 {
+		for i := range ac {
+			ac[i] = 0.5 + 0.5/scale*ac[i]
+		}
+	}
+	return dc, ac, scale
+}
+
+// Encodes the image as a base64 ThumbHash. Images are opaque, so the hash never has an alpha channel.
+func encodeThumbHash(img *Image) string {
+	w, h := img.Width, img.Height
+	l, p, q := make([]float64, w*h), make([]float64, w*h), make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			px := pixelAt(img, x, y)
+			r, g, b := float64(px.Red)/255, float64(px.Green)/255, float64(px.Blue)/255
+			i := x + y*w
+			l[i], p[i], q[i] = (r+g+b)/3, (r+g)/2-b, r-g
+		}
+	}
+
+	// Luminance gets up to 7 components along the longer side
+	lx := max(1, int(math.Round(7*float64(w)/float64(max(w, h)))))
+	ly := max(1, int(math.Round(7*float64(h)/float64(max(w, h)))))
+	lDC, lAC, lScale := thumbHashChannel(l, w, h, max(3, lx), max(3, ly))
+	pDC, pAC, pScale := thumbHashChannel(p, w, h, 3, 3)
+	qDC, qAC, qScale := thumbHashChannel(q, w, h, 3, 3)
+
+	landscape := 0
+	if w > h {
+		landscape = 1
+	}
+	header24 := int(math.Round(63*lDC)) | int(math.Round(31.5+31.5*pDC))<<6 | int(math.Round(31.5+31.5*qDC))<<12 | int(math.Round(31*lScale))<<18
+	// Only the component count of the shorter side is stored, the longer side always has 7
+	short := lx
+	if landscape == 1 {
+		short = ly
+	}
+	header16 := short | int(math.Round(63*pScale))<<3 | int(math.Round(63*qScale))<<9 | landscape<<15
+	hash := []byte{byte(header24), byte(header24 >> 8), byte(header24 >> 16), byte(header16), byte(header16 >> 8)}
+
+	// The varying factors are packed as 4-bit values, two per byte
+	index := 0
+	for _, ac := range [][]float64{lAC, pAC, qAC} {
+		for _, f := range ac {
+			if index%2 == 0 {
+				hash = append(hash, 0)
+			}
+			hash[len(hash)-1] |= byte(int(math.Round(15*f)) << (index % 2 * 4))
+			index++
+		}
+	}
+	return base64.StdEncoding.EncodeToString(hash)
+}
+
+// Renders a base64 ThumbHash, at most 32 pixels on the longer side in the hash's aspect ratio unless
+// size is given. The alpha channel of hashes that have one is ignored.
+func decodeThumbHash(value, size string) (*Image, error) {
+	invalid := msgError("error.invalid_thumbhash", value)
+	hash, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		// Hashes are often stored without padding
+		if hash, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(value, "=")); err != nil {
+			return nil, invalid
+		}
+	}
+	if len(hash) < 5 {
+		return nil, invalid
+	}
+
+	header24 := int(hash[0]) | int(hash[1])<<8 | int(hash[2])<<16
+	header16 := int(hash[3]) | int(hash[4])<<8
+	lDC := float64(header24&63) / 63
+	pDC := float64(header24>>6&63)/31.5 - 1
+	qDC := float64(header24>>12&63)/31.5 - 1
+	lScale := float64(header24>>18&31) / 31
+	hasAlpha := header24>>23 != 0
+	pScale := float64(header16>>3&63) / 63
+	qScale := float64(header16>>9&63) / 63
+	landscape := header16>>15 != 0
+
+	longSide := 7
+	if hasAlpha {
+		longSide = 5
+	}
+	lx, ly := max(3, header16&7), max(3, longSide)
+	if landscape {
+		lx, ly = max(3, longSide), max(3, header16&7)
+	}
+	start := 5
+	if hasAlpha {
+		start = 6
+	}
+
+	// Reads the next 4-bit factors; saturation is boosted by 1.25 to make up for the quantization
+	index := 0
+	readChannel := func(nx, ny int, scale float64) ([]float64, error) {
+		var ac []float64
+		for cy := 0; cy < ny; cy++ {
+			for cx := acStart(cy); cx*ny < nx*(ny-cy); cx++ {
+				pos := start + index/2
+				if pos >= len(hash) {
+					return nil, invalid
+				}
+				ac = append(ac, (float64(hash[pos]>>(index%2*4)&15)/7.5-1)*scale)
+				index++
+			}
+		}
+		return ac, nil
+	}
+	lAC, err := readChannel(lx, ly, lScale)
+	if err != nil {
+		return nil, err
+	}
+	pAC, err := readChannel(3, 3, pScale*1.25)
+	if err != nil {
+		return nil, err
+	}
+	qAC, err := readChannel(3, 3, qScale*1.25)
+	if err != nil {
+		return nil, err
+	}
+
+	// The approximate aspect ratio uses the stored component counts before they are raised to 3
+	width, height := 32, 32
+	if size != "" {
+		width, height, _ = parseSize(size)
+	} else {
+		ratio := float64(header16&7) / float64(longSide)
+		if landscape {
+			ratio = float64(longSide) / float64(header16&7)
+		}
+		if ratio > 1 {
+			height = max(1, int(math.Round(32/ratio)))
+		} else {
+			width = max(1, int(math.Round(32*ratio)))
+		}
+	}
+
+	img := &Image{Width: width, Height: height, Pixels: make([]Pixel, width*height)}
+	fx, fy := make([]float64, max(lx, 3)), make([]float64, max(ly, 3))
+	for y := 0; y < height; y++ {
+		for cy := range fy {
+			fy[cy] = math.Cos(math.Pi / float64(height) * (float64(y) + 0.5) * float64(cy))
+		}
+		for x := 0; x < width; x++ {
+			for cx := range fx {
+				fx[cx] = math.Cos(math.Pi / float64(width) * (float64(x) + 0.5) * float64(cx))
+			}
+
+			l, p, q := lDC, pDC, qDC
+			j := 0
+			for cy := 0; cy < ly; cy++ {
+				for cx := acStart(cy); cx*ly < lx*(ly-cy); cx++ {
+					l += lAC[j] * fx[cx] * fy[cy] * 2
+					j++
+				}
+			}
+			j = 0
+			for cy := 0; cy < 3; cy++ {
+				for cx := acStart(cy); cx < 3-cy; cx++ {
+					f := fx[cx] * fy[cy] * 2
+					p += pAC[j] * f
+					q += qAC[j] * f
+					j++
+				}
+			}
+
+			b := l - 2.0/3*p
+			r := (3*l - b + q) / 2
+			g := r - q
+			setPixelAt(img, x, y, Pixel{Red: unitToByte(r), Green: unitToByte(g), Blue: unitToByte(b)})
+		}
+	}
+	return img, nil
+}
+
+// Returns the first horizontal component of ThumbHash row cy: the constant term of row 0 is stored separately
+func acStart(cy int) int {
+	if cy == 0 {
+		return 1
+	}
+	return 0
+}
+
+// Converts a value in [0, 1] to a channel byte, clamping it first
+func unitToByte(f float64) byte {
+	return byte(max(0, min(1, f)) * 255)
+}
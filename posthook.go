@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Placeholders of --post-hook, each replaced by a property of the file just written
+var postHookFields = []string{"{output}", "{name}", "{stem}", "{ext}", "{dir}", "{width}", "{height}"}
+
+// A placeholder of --post-hook, or a misspelled one
+var postHookField = regexp.MustCompile(`\{[a-z]*\}`)
+
+// Validates a --post-hook command: a program and its arguments, with placeholders of postHookFields only
+func checkPostHook(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return msgError("expect.post_hook", strings.Join(postHookFields, ", "))
+	}
+	for _, field := range postHookField.FindAllString(value, -1) {
+		if !contains(postHookFields, field) {
+			return msgError("expect.post_hook", strings.Join(postHookFields, ", "))
+		}
+	}
+	return nil
+}
+
+// Runs the --post-hook command for an output that has just been written, as uploads or notifications
+// need. The command is split at spaces and the placeholders are replaced in each argument, without a
+// shell, so file names with spaces or quotes reach it as one argument and run nothing. What it prints goes
+// to standard error, keeping standard output for results. Outputs written to standard output or to a file
+// system other than the operating system's have no file to hand over, and run no command.
+func (s *ioSettings) runPostHook(filename string, img *Image) error {
+	if s.PostHook == "" || filename == stdioName || !onOSFileSystem() {
+		return nil
+	}
+	name := filepath.Base(filename)
+	ext := filepath.Ext(name)
+	replacer := strings.NewReplacer(
+		"{output}", filename, "{name}", name, "{stem}", strings.TrimSuffix(name, ext), "{ext}", strings.TrimPrefix(ext, "."),
+		"{dir}", filepath.Dir(filename), "{width}", strconv.Itoa(img.Width), "{height}", strconv.Itoa(img.Height),
+	)
+	args := strings.Fields(s.PostHook)
+	for i := range args {
+		args[i] = replacer.Replace(args[i])
+	}
+	logDetail("info.post_hook", strings.Join(args, " "))
+	command := exec.Command(args[0], args[1:]...)
+	command.Stdout, command.Stderr = os.Stderr, os.Stderr
+	if err := command.Run(); err != nil {
+		return msgError("error.post_hook", args[0], filename, err)
+	}
+	return nil
+}
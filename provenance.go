@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Version of the manifest format, raised whenever a field changes meaning
+const provenanceVersion = 1
+
+// Record of how an apply output was made, written by --provenance: what it was made from, by which build
+// and with which options. With a key it is signed, so that an edit trail can be audited without trusting
+// whoever stored it.
+type provenanceManifest struct {
+	Version    int              `json:"version"`
+	Tool       provenanceTool   `json:"tool"`
+	Created    string           `json:"created"` // RFC 3339, in UTC
+	Source     provenanceFile   `json:"source"`
+	Operations []provenanceStep `json:"operations"`
+	Outputs    []provenanceFile `json:"outputs"`
+	// HMAC-SHA256 of the manifest with this field empty, in hex; empty when no key was given
+	Signature string `json:"signature,omitempty"`
+}
+
+// The build that made an output
+type provenanceTool struct {
+	Name  string `json:"name"`
+	Build string `json:"build"` // SHA-256 of the executable
+	Go    string `json:"go"`
+}
+
+// A source or output file with the hash of its contents
+type provenanceFile struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// An apply option as it was given
+type provenanceStep struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Writes the manifest of an apply run to cmd.provenance, signed with cmd.provenanceKey when it is set.
+// Outputs written to standard output cannot be read back and are left out.
+func writeProvenance(cmd *commandArgs) error {
+	build, err := executableHash()
+	if err != nil {
+		return err
+	}
+	created := time.Now().UTC()
+	if deterministic {
+		if created, err = deterministicTime(); err != nil {
+			return err
+		}
+	}
+	manifest := &provenanceManifest{
+		Version:    provenanceVersion,
+		Tool:       provenanceTool{Name: "bitmap", Build: build, Go: runtime.Version()},
+		Created:    created.Format(time.RFC3339),
+		Operations: []provenanceStep{},
+		Outputs:    []provenanceFile{},
+	}
+	if manifest.Source, err = cmd.settings.hashSource(cmd.filename); err != nil {
+		return err
+	}
+	for _, opt := range cmd.options {
+		manifest.Operations = append(manifest.Operations, provenanceStep{Name: opt.Name, Value: opt.Value})
+	}
+	if cmd.dpi != "" {
+		manifest.Operations = append(manifest.Operations, provenanceStep{Name: "--dpi", Value: cmd.dpi})
+	}
+	for _, output := range cmd.outputs {
+		if output.Filename == stdioName {
+			continue
+		}
+		file, err := cmd.settings.hashSource(output.Filename)
+		if err != nil {
+			return err
+		}
+		manifest.Outputs = append(manifest.Outputs, file)
+	}
+	if cmd.provenanceKey != "" {
+		if manifest.Signature, err = signManifest(manifest, []byte(cmd.provenanceKey)); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return msgError("error.write_output", err)
+	}
+	if err := writeFile(cmd.provenance, append(data, '\n')); err != nil {
+		return msgError("error.write_output", err)
+	}
+	logDetail("info.provenance_written", cmd.provenance)
+	return nil
+}
+
+// Hashes a source or output, read as sources are, so that standard input and URLs work as well. Files in
+// encrypted containers are hashed as they are stored.
+func (s *ioSettings) hashSource(name string) (provenanceFile, error) {
+	file, err := s.openRawInput(name)
+	if err != nil {
+		return provenanceFile{}, msgError("error.open_file", err)
+	}
+	defer file.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return provenanceFile{}, msgError("error.read_file", err)
+	}
+	return provenanceFile{Name: name, SHA256: hex.EncodeToString(h.Sum(nil)), Size: size}, nil
+}
+
+// Returns the signature of a manifest: the HMAC-SHA256 of its JSON encoding without the signature. Field
+// order follows the struct, so the manifest read back encodes to the same bytes.
+func signManifest(manifest *provenanceManifest, key []byte) (string, error) {
+	unsigned := *manifest
+	unsigned.Signature = ""
+	data, err := json.Marshal(&unsigned)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Checks an image against a manifest written by --provenance: that it is one of the outputs, that the
+// signature is valid when a key is given and, with --source, that the source is the one recorded
+func runProvenance(args []string) error {
+	if len(args) == 0 || args[0] != "verify" {
+		return msgError("usage.provenance")
+	}
+	var key, source string
+	flags := []flagSpec{
+		{Name: "provenance-key", Target: &key},
+		{Name: "source", Target: &source, Check: nonEmpty},
+	}
+	_, positional, err := parseCommandLine(args[1:], flags, false)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return msgError("usage.provenance")
+	}
+	imageName, manifestName := positional[0], positional[1]
+
+	data, err := readFile(manifestName)
+	if err != nil {
+		return msgError("error.open_file", err)
+	}
+	var manifest provenanceManifest
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&manifest); err != nil {
+		return msgError("error.provenance_manifest", manifestName, err)
+	}
+	if manifest.Version != provenanceVersion {
+		return msgError("error.provenance_version", manifestName, manifest.Version, provenanceVersion)
+	}
+
+	image, err := globalSettings.hashSource(imageName)
+	if err != nil {
+		return err
+	}
+	var match *provenanceFile
+	for i := range manifest.Outputs {
+		if manifest.Outputs[i].SHA256 == image.SHA256 && manifest.Outputs[i].Size == image.Size {
+			match = &manifest.Outputs[i]
+		}
+	}
+	if match == nil {
+		return msgError("error.provenance_output", imageName, manifestName)
+	}
+	if source != "" {
+		file, err := globalSettings.hashSource(source)
+		if err != nil {
+			return err
+		}
+		if file.SHA256 != manifest.Source.SHA256 || file.Size != manifest.Source.Size {
+			return msgError("error.provenance_source", source, manifestName)
+		}
+	}
+
+	signature := "none"
+	switch {
+	case manifest.Signature != "" && key != "":
+		expected, err := signManifest(&manifest, []byte(key))
+		if err != nil {
+			return msgError("error.provenance_manifest", manifestName, err)
+		}
+		if !hmac.Equal([]byte(expected), []byte(manifest.Signature)) {
+			return msgError("error.provenance_signature", manifestName)
+		}
+		signature = "valid"
+	case manifest.Signature != "":
+		signature = "not checked"
+		printWarning(msgError("warning.provenance_unchecked", manifestName))
+	case key != "":
+		return msgError("error.provenance_unsigned", manifestName)
+	}
+
+	steps := make([]string, len(manifest.Operations))
+	for i, step := range manifest.Operations {
+		steps[i] = step.Name + "=" + step.Value
+	}
+	fmt.Printf("output: %s (%s)\n", match.Name, match.SHA256)
+	fmt.Printf("source: %s (%s)\n", manifest.Source.Name, manifest.Source.SHA256)
+	fmt.Printf("operations: %s\n", strings.Join(steps, " "))
+	fmt.Printf("tool: %s %s, %s\n", manifest.Tool.Name, manifest.Tool.Build, manifest.Tool.Go)
+	fmt.Printf("created: %s\n", manifest.Created)
+	fmt.Printf("signature: %s\n", signature)
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strconv"
+)
+
+// Shares of the pixels of an image at every level of its red, green and blue channels
+type colorHistogram [3][256]float64
+
+// Counts the levels of the color channels of an image, as shares of its pixels
+func measureColorHistogram(img *Image) *colorHistogram {
+	var h colorHistogram
+	for _, p := range img.Pixels {
+		h[0][p.Red]++
+		h[1][p.Green]++
+		h[2][p.Blue]++
+	}
+	n := float64(max(len(img.Pixels), 1))
+	for c := range h {
+		for level := range h[c] {
+			h[c][level] /= n
+		}
+	}
+	return &h
+}
+
+// Returns how far apart two histograms are, from 0 when they are the same to 1 from black to white: how
+// far the levels of one would have to move on average to turn it into the other, as a share of the range,
+// averaged over the channels. Unlike counting the pixels at different levels, this reads sensor noise,
+// which moves levels by little, as a small change and a cut to another scene as a large one. Sizes do not
+// matter, so a frame compares with a resized copy of itself as the same.
+func (h *colorHistogram) distance(other *colorHistogram) float64 {
+	var sum float64
+	for c := range h {
+		var below, otherBelow float64
+		for level := range 255 {
+			below += h[c][level]
+			otherBelow += other[c][level]
+			sum += max(below-otherBelow, otherBelow-below)
+		}
+	}
+	return sum / 255 / float64(len(h))
+}
+
+// Parses a --prune-similar threshold, a histogram distance from 0 to 1
+func parsePruneThreshold(value string) (float64, bool) {
+	threshold, err := strconv.ParseFloat(value, 64)
+	return threshold, err == nil && threshold >= 0 && threshold <= 1
+}
+
+// Validates a --prune-similar value
+func checkPruneThreshold(value string) error {
+	if _, ok := parsePruneThreshold(value); !ok {
+		return msgError("expect.prune_similar")
+	}
+	return nil
+}
+
+// Drops frames of a sequence that look like the last one kept, by the distance between their color
+// histograms. Comparing with the last frame kept rather than the one just before means a slow fade is
+// still sampled once it has drifted far enough, instead of being dropped step by step.
+type framePruner struct {
+	threshold float64
+	last      *colorHistogram // Histogram of the last frame kept, nil before the first
+}
+
+// Returns a pruner for a --prune-similar value, or nil when it is empty and every frame is kept
+func newFramePruner(value string) *framePruner {
+	if value == "" {
+		return nil
+	}
+	threshold, _ := parsePruneThreshold(value)
+	return &framePruner{threshold: threshold}
+}
+
+// Reports whether the next frame of the sequence is kept, and its distance to the last frame kept, which
+// is 1 for the first frame. Frames are kept when they are at least the threshold away, so a threshold of 0
+// keeps every frame.
+func (p *framePruner) keep(img *Image) (bool, float64) {
+	h := measureColorHistogram(img)
+	distance := 1.0
+	if p.last != nil {
+		distance = h.distance(p.last)
+	}
+	if distance < p.threshold {
+		return false, distance
+	}
+	p.last = h
+	return true, distance
+}
+
+// Makes a frame the last one kept without comparing it, as when an earlier run kept it
+func (p *framePruner) follow(img *Image) {
+	p.last = measureColorHistogram(img)
+}
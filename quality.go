@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// Luminance levels, out of 255, at or beyond which a pixel counts as clipped to black or white
+const (
+	clipDarkLevel   = 2
+	clipBrightLevel = 253
+)
+
+// Standard deviation of the luminance, out of 255, below which an image counts as blank
+const blankDeviation = 3
+
+// Banding is looked for in steps of at most bandStep luminance levels that end flat runs of at least
+// bandRun pixels; an image is reported as banded when more than bandedShare percent of such small steps
+// do, provided there are at least bandMinSteps of them
+const (
+	bandStep     = 4
+	bandRun      = 8
+	bandedShare  = 50
+	bandMinSteps = 16
+)
+
+// Measurements printed by the quality command
+type qualityReport struct {
+	Sharpness     float64 `json:"sharpness"`      // Variance of the Laplacian of the luminance; low values mean blur
+	ClippedDark   float64 `json:"clipped_dark"`   // Percentage of pixels crushed to black
+	ClippedBright float64 `json:"clipped_bright"` // Percentage of pixels blown out to white
+	Deviation     float64 `json:"deviation"`      // Standard deviation of the luminance
+	Blank         bool    `json:"blank"`          // Set when the image is a single color or nearly so
+	Noise         float64 `json:"noise"`          // Estimated standard deviation of the noise, out of 255
+	Banding       float64 `json:"banding"`        // Percentage of small luminance steps that end long flat runs
+	Banded        bool    `json:"banded"`         // Set when smooth gradients show visible steps
+	// Set when every pixel has equal red, green and blue, so the image is stored in color needlessly
+	Grayscale bool `json:"grayscale"`
+	// Channels with the same value in every pixel
+	ConstantChannels []string `json:"constant_channels"`
+	// Percentage of fully transparent pixels
+	Transparent float64 `json:"transparent"`
+	// Bounding box of the pixels that are not fully transparent, as x-y-width-height for --crop;
+	// empty when every pixel is transparent
+	AlphaBounds string `json:"alpha_bounds"`
+}
+
+// Settings of the quality command
+type qualityConfig struct {
+	format       string // "text" or "json"
+	minSharpness int    // Sharpness below which the image is rejected, 0 to accept any
+	maxClipped   int    // Percentage of clipped pixels above which the image is rejected, 100 to accept any
+	rejectBlank  bool
+	filename     string
+}
+
+// Parses the arguments of the quality command
+func parseQualityArgs(args []string) (*qualityConfig, error) {
+	cfg := &qualityConfig{format: "text", maxClipped: 100}
+	flags := []flagSpec{
+		{Name: "format", Target: &cfg.format, Choices: []string{"text", "json"}},
+		{Name: "min-sharpness", Target: &cfg.minSharpness},
+		{Name: "max-clipped", Target: &cfg.maxClipped},
+		{Name: "reject-blank", Target: &cfg.rejectBlank},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 1 {
+		return nil, msgError("usage.quality")
+	}
+	cfg.filename = positional[0]
+	return cfg, nil
+}
+
+// Prints sharpness, exposure clipping, blankness, noise, banding and transparency measurements of an image,
+// failing when any of the requested limits is exceeded
+func runQuality(args []string) error {
+	cfg, err := parseQualityArgs(args)
+	if err != nil {
+		return err
+	}
+	_, _, img, err := globalSettings.loadImage(cfg.filename)
+	if err != nil {
+		return err
+	}
+
+	report := measureQuality(img)
+	if cfg.format == "json" {
+		if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+			return msgError("error.write_output", err)
+		}
+	} else {
+		fmt.Printf("sharpness: %.2f\n", report.Sharpness)
+		fmt.Printf("clipped_dark: %.2f%%\n", report.ClippedDark)
+		fmt.Printf("clipped_bright: %.2f%%\n", report.ClippedBright)
+		fmt.Printf("deviation: %.2f\n", report.Deviation)
+		fmt.Printf("blank: %t\n", report.Blank)
+		fmt.Printf("noise: %.2f\n", report.Noise)
+		fmt.Printf("banding: %.2f%%\n", report.Banding)
+		fmt.Printf("banded: %t\n", report.Banded)
+		fmt.Printf("grayscale: %t\n", report.Grayscale)
+		channels := "none"
+		if len(report.ConstantChannels) > 0 {
+			channels = strings.Join(report.ConstantChannels, ", ")
+		}
+		fmt.Printf("constant_channels: %s\n", channels)
+		fmt.Printf("transparent: %.2f%%\n", report.Transparent)
+		bounds := report.AlphaBounds
+		if bounds == "" {
+			bounds = "none"
+		}
+		fmt.Printf("alpha_bounds: %s\n", bounds)
+	}
+
+	var failed []string
+	if report.Sharpness < float64(cfg.minSharpness) {
+		failed = append(failed, msg("quality.blurry", report.Sharpness, cfg.minSharpness))
+	}
+	if clipped := report.ClippedDark + report.ClippedBright; clipped > float64(cfg.maxClipped) {
+		failed = append(failed, msg("quality.clipped", clipped, cfg.maxClipped))
+	}
+	if cfg.rejectBlank && report.Blank {
+		failed = append(failed, msg("quality.blank"))
+	}
+	if len(failed) > 0 {
+		return msgError("error.quality", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Measures the image on its luminance, scaled to 0-255
+func measureQuality(img *Image) *qualityReport {
+	w, h := img.Width, img.Height
+	lum := make([]float64, len(img.Pixels))
+	var report qualityReport
+	var sum, sumSquares float64
+	for i, p := range img.Pixels {
+		l := float64(p.Luminance()) / 1000
+		lum[i] = l
+		sum += l
+		sumSquares += l * l
+		switch {
+		case l <= clipDarkLevel:
+			report.ClippedDark++
+		case l >= clipBrightLevel:
+			report.ClippedBright++
+		}
+	}
+	n := float64(len(lum))
+	report.ClippedDark *= 100 / n
+	report.ClippedBright *= 100 / n
+	report.Deviation = math.Sqrt(max(0, sumSquares/n-(sum/n)*(sum/n)))
+	report.Blank = report.Deviation < blankDeviation
+
+	report.Grayscale, report.ConstantChannels = channelUsage(img.Pixels)
+	for _, a := range img.Alpha {
+		if a == 0 {
+			report.Transparent++
+		}
+	}
+	report.Transparent *= 100 / n
+	if x, y, bw, bh, ok := alphaBounds(img); ok {
+		report.AlphaBounds = fmt.Sprintf("%d-%d-%d-%d", x, y, bw, bh)
+	}
+	report.Banding = measureBanding(lum, w, h)
+	report.Banded = report.Banding > bandedShare
+
+	// The Laplacian and the noise mask need all eight neighbors, so the border is left out
+	if w < 3 || h < 3 {
+		return &report
+	}
+	var lapSum, lapSquares, noise float64
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*w + x
+			v := 4*lum[i] - lum[i-1] - lum[i+1] - lum[i-w] - lum[i+w]
+			lapSum += v
+			lapSquares += v * v
+			// The difference of two Laplacians cancels edges and leaves mostly noise (Immerkær's method)
+			corners := lum[i-w-1] + lum[i-w+1] + lum[i+w-1] + lum[i+w+1]
+			noise += math.Abs(4*lum[i] - 2*(lum[i-1]+lum[i+1]+lum[i-w]+lum[i+w]) + corners)
+		}
+	}
+	m := float64((w - 2) * (h - 2))
+	report.Sharpness = max(0, lapSquares/m-(lapSum/m)*(lapSum/m))
+	report.Noise = math.Sqrt(math.Pi/2) * noise / (6 * m)
+	return &report
+}
+
+// Reports whether all pixels are gray and which channels never change
+func channelUsage(pixels []Pixel) (grayscale bool, constant []string) {
+	grayscale = true
+	first := pixels[0]
+	sameRed, sameGreen, sameBlue := true, true, true
+	for _, p := range pixels {
+		grayscale = grayscale && p.Red == p.Green && p.Green == p.Blue
+		sameRed = sameRed && p.Red == first.Red
+		sameGreen = sameGreen && p.Green == first.Green
+		sameBlue = sameBlue && p.Blue == first.Blue
+	}
+	constant = []string{}
+	for _, c := range []struct {
+		name string
+		same bool
+	}{{"red", sameRed}, {"green", sameGreen}, {"blue", sameBlue}} {
+		if c.same {
+			constant = append(constant, c.name)
+		}
+	}
+	return grayscale, constant
+}
+
+// Returns the percentage of small luminance steps, along rows and columns, that end a flat run of
+// at least bandRun pixels. Smooth gradients stored with too few levels step after long runs, while
+// real detail and noise change every few pixels.
+func measureBanding(lum []float64, w, h int) float64 {
+	var steps, bands int
+	scan := func(start, stride, length int) {
+		run := 1
+		prev := int(lum[start])
+		for k := 1; k < length; k++ {
+			cur := int(lum[start+k*stride])
+			switch diff := abs(cur - prev); {
+			case diff == 0:
+				run++
+				continue
+			case diff <= bandStep:
+				steps++
+				if run >= bandRun {
+					bands++
+				}
+			}
+			run, prev = 1, cur
+		}
+	}
+	for y := 0; y < h; y++ {
+		scan(y*w, 1, w)
+	}
+	for x := 0; x < w; x++ {
+		scan(x, w, h)
+	}
+	if steps < bandMinSteps {
+		return 0
+	}
+	return float64(bands) * 100 / float64(steps)
+}
@@ -0,0 +1,18 @@
+//go:build !((linux && !(mips || mipsle || mips64 || mips64le || ppc64 || ppc64le)) || darwin || freebsd || netbsd || openbsd || dragonfly || windows)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// Reports that raw mode is not supported here, as on WebAssembly hosts
+func makeRaw(in, out *os.File) (func(), error) {
+	return nil, errors.ErrUnsupported
+}
+
+// Reports that the size of the terminal is unknown
+func terminalSize(out *os.File) (columns, rows int, ok bool) {
+	return 0, 0, false
+}
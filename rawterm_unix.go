@@ -0,0 +1,46 @@
+//go:build (linux && !(mips || mipsle || mips64 || mips64le || ppc64 || ppc64le)) || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Size of a terminal in characters and pixels, as TIOCGWINSZ reports it
+type winsize struct {
+	Rows, Columns, XPixels, YPixels uint16
+}
+
+// Puts a terminal in raw mode, in which keys are read one at a time without being echoed and Ctrl-C is
+// read as a key rather than stopping the process, returning the function that puts it back
+func makeRaw(in, out *os.File) (func(), error) {
+	var saved syscall.Termios
+	if err := termiosIoctl(in, ioctlGetTermios, &saved); err != nil {
+		return nil, err
+	}
+	raw := saved
+	raw.Iflag &^= syscall.ICRNL | syscall.IXON | syscall.ISTRIP | syscall.BRKINT
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO | syscall.ISIG | syscall.IEXTEN
+	raw.Cc[syscall.VMIN], raw.Cc[syscall.VTIME] = 1, 0
+	if err := termiosIoctl(in, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+	return func() { termiosIoctl(in, ioctlSetTermios, &saved) }, nil
+}
+
+// Returns the columns and rows of a terminal
+func terminalSize(out *os.File) (columns, rows int, ok bool) {
+	var size winsize
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, out.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&size)))
+	return int(size.Columns), int(size.Rows), errno == 0 && size.Columns > 0 && size.Rows > 0
+}
+
+// Reads or sets the attributes of a terminal
+func termiosIoctl(file *os.File, request uintptr, termios *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, file.Fd(), request, uintptr(unsafe.Pointer(termios))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Console functions from kernel32, which the syscall package does not wrap
+var (
+	procSetConsoleMode             = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+	procGetConsoleScreenBufferInfo = syscall.NewLazyDLL("kernel32.dll").NewProc("GetConsoleScreenBufferInfo")
+)
+
+// Console modes of the input and of the screen
+const (
+	enableProcessedInput            = 0x1
+	enableLineInput                 = 0x2
+	enableEchoInput                 = 0x4
+	enableVirtualTerminalInput      = 0x200
+	enableVirtualTerminalProcessing = 0x4
+)
+
+// CONSOLE_SCREEN_BUFFER_INFO
+type consoleScreenBufferInfo struct {
+	Size, CursorPosition     [2]int16
+	Attributes               uint16
+	Left, Top, Right, Bottom int16
+	MaximumWindowSize        [2]int16
+}
+
+// Puts the console in raw mode, in which keys are read one at a time without being echoed, Ctrl-C is
+// read as a key and arrows arrive as the escape sequences of other terminals, and lets the screen take
+// escape sequences, returning the function that puts both back
+func makeRaw(in, out *os.File) (func(), error) {
+	var inMode, outMode uint32
+	if err := syscall.GetConsoleMode(syscall.Handle(in.Fd()), &inMode); err != nil {
+		return nil, err
+	}
+	if err := syscall.GetConsoleMode(syscall.Handle(out.Fd()), &outMode); err != nil {
+		return nil, err
+	}
+	if err := setConsoleMode(in, inMode&^(enableProcessedInput|enableLineInput|enableEchoInput)|enableVirtualTerminalInput); err != nil {
+		return nil, err
+	}
+	if err := setConsoleMode(out, outMode|enableVirtualTerminalProcessing); err != nil {
+		setConsoleMode(in, inMode)
+		return nil, err
+	}
+	return func() {
+		setConsoleMode(in, inMode)
+		setConsoleMode(out, outMode)
+	}, nil
+}
+
+// Returns the columns and rows of the visible part of the console
+func terminalSize(out *os.File) (columns, rows int, ok bool) {
+	var info consoleScreenBufferInfo
+	if r, _, _ := procGetConsoleScreenBufferInfo.Call(out.Fd(), uintptr(unsafe.Pointer(&info))); r == 0 {
+		return 0, 0, false
+	}
+	return int(info.Right-info.Left) + 1, int(info.Bottom-info.Top) + 1, true
+}
+
+// Sets the mode of a console handle
+func setConsoleMode(file *os.File, mode uint32) error {
+	if r, _, err := procSetConsoleMode.Call(file.Fd(), uintptr(mode)); r == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+	"io"
+	"time"
+
+	"creditcard/bmp"
+)
+
+// TIFF tags that lead to the previews of a RAW file
+const (
+	tagCompression    = 0x103
+	tagStripOffsets   = 0x111
+	tagOrientation    = 0x112
+	tagStripCounts    = 0x117
+	tagSubIFDs        = 0x14a
+	tagJPEGOffset     = 0x201
+	tagJPEGLength     = 0x202
+	tagExifIFD        = 0x8769
+	maxRawIFDs        = 64
+	maxRawIFDEntries  = 1024
+	tiffTypeUndefined = 7
+)
+
+// An embedded JPEG stream of a RAW file, from offset to the end of the file when its length is unknown
+type rawPreview struct {
+	offset, length int64
+}
+
+// Writes the largest JPEG preview embedded in a camera RAW file as an image, turned upright as the EXIF
+// orientation of the RAW file says. TIFF-based files (CR2, NEF, ARW, DNG, PEF, ORF, RW2 and most others)
+// list their previews in their image directories; other containers, such as CR3 and RAF, are searched
+// for JPEG streams instead.
+func runExtractThumb(args []string) error {
+	_, positional, err := parseCommandLine(args, nil, false)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return msgError("usage.extract_thumb")
+	}
+	source, output := positional[0], positional[1]
+
+	logDetail("info.opening_file", source)
+	file, err := globalSettings.openInput(source)
+	if err != nil {
+		return msgError("error.open_file", err)
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return msgError("error.open_file", err)
+	}
+	metrics.addBytesRead(int64(len(data)))
+
+	previews, orientation := tiffPreviews(data)
+	preview, ok := largestPreview(data, previews)
+	if !ok {
+		preview, ok = largestPreview(data, scanPreviews(data))
+	}
+	if !ok {
+		return msgError("error.no_preview", source)
+	}
+	img, err := decodePreview(data, preview, source)
+	if err != nil {
+		return err
+	}
+	if img, err = orientImage(img, orientation); err != nil {
+		return err
+	}
+	return globalSettings.saveOutput(output, "", &BMPHeader{}, &DIBHeader{}, img)
+}
+
+// Returns the JPEG streams the image directories of a TIFF-based RAW file point to, and its EXIF
+// orientation, 1 when it has none. Files that are not TIFF-based give no previews.
+func tiffPreviews(data []byte) ([]rawPreview, int) {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(data, []byte("II")):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(data, []byte("MM")):
+		order = binary.BigEndian
+	default:
+		return nil, 1
+	}
+	if len(data) < 8 {
+		return nil, 1
+	}
+	// 42 for TIFF, and the variants of Olympus (ORF) and Panasonic (RW2) files
+	switch order.Uint16(data[2:]) {
+	case 42, 0x4f52, 0x5352, 0x55:
+	default:
+		return nil, 1
+	}
+	u16 := func(at int64) int64 {
+		if at < 0 || at+2 > int64(len(data)) {
+			return 0
+		}
+		return int64(order.Uint16(data[at:]))
+	}
+	u32 := func(at int64) int64 {
+		if at < 0 || at+4 > int64(len(data)) {
+			return 0
+		}
+		return int64(order.Uint32(data[at:]))
+	}
+
+	var previews []rawPreview
+	orientation := 1
+	queue := []int64{u32(4)}
+	visited := map[int64]bool{}
+	for len(queue) > 0 && len(visited) < maxRawIFDs {
+		ifd := queue[0]
+		queue = queue[1:]
+		if ifd <= 0 || ifd >= int64(len(data)) || visited[ifd] {
+			continue
+		}
+		visited[ifd] = true
+
+		// Values of up to 4 bytes are stored in the entry itself, longer ones at the offset it holds
+		var compression, stripOffset, stripLength, jpegOffset, jpegLength int64
+		count := min(u16(ifd), maxRawIFDEntries)
+		for i := int64(0); i < count; i++ {
+			entry := ifd + 2 + i*12
+			tag, kind, n, value := u16(entry), u16(entry+2), u32(entry+4), entry+8
+			short := u16(value)
+			if kind == 4 || kind == 13 {
+				short = u32(value)
+			}
+			switch tag {
+			case tagCompression:
+				compression = short
+			case tagStripOffsets:
+				stripOffset = short
+			case tagStripCounts:
+				stripLength = short
+			case tagJPEGOffset:
+				jpegOffset = short
+			case tagJPEGLength:
+				jpegLength = short
+			case tagOrientation:
+				if len(visited) == 1 && short >= 1 && short <= 8 {
+					orientation = int(short)
+				}
+			case tagExifIFD:
+				queue = append(queue, short)
+			case tagSubIFDs:
+				if n == 1 {
+					queue = append(queue, short)
+				} else {
+					for j := int64(0); j < min(n, maxRawIFDs); j++ {
+						queue = append(queue, u32(u32(value)+j*4))
+					}
+				}
+			}
+			// Panasonic and others keep a whole JPEG file in a tag of its own
+			if kind == tiffTypeUndefined && n > 4 && bytes.HasPrefix(data[min(u32(value), int64(len(data))):], []byte{0xff, 0xd8}) {
+				previews = append(previews, rawPreview{u32(value), n})
+			}
+		}
+		if jpegOffset > 0 {
+			previews = append(previews, rawPreview{jpegOffset, jpegLength})
+		}
+		// Strips of old-style (6) and lossless (7) JPEG compression; the lossless ones hold raw sensor
+		// data, which the JPEG decoder rejects
+		if (compression == 6 || compression == 7) && stripOffset > 0 {
+			previews = append(previews, rawPreview{stripOffset, stripLength})
+		}
+		queue = append(queue, u32(ifd+2+count*12))
+	}
+	return previews, orientation
+}
+
+// Returns every JPEG stream in the file, for containers whose previews are not listed in TIFF directories
+func scanPreviews(data []byte) []rawPreview {
+	var previews []rawPreview
+	marker := []byte{0xff, 0xd8, 0xff}
+	for at := 0; ; at += len(marker) {
+		i := bytes.Index(data[at:], marker)
+		if i < 0 {
+			return previews
+		}
+		at += i
+		previews = append(previews, rawPreview{offset: int64(at)})
+	}
+}
+
+// Returns the stream of the previews that the JPEG decoder reads with the most pixels
+func largestPreview(data []byte, previews []rawPreview) (rawPreview, bool) {
+	best, area := rawPreview{}, 0
+	for _, p := range previews {
+		config, err := jpeg.DecodeConfig(bytes.NewReader(previewBytes(data, p)))
+		if err == nil && config.Width*config.Height > area {
+			best, area = p, config.Width*config.Height
+		}
+	}
+	return best, area > 0
+}
+
+// Returns the bytes of a preview, clipped to the file
+func previewBytes(data []byte, p rawPreview) []byte {
+	start := min(max(p.offset, 0), int64(len(data)))
+	end := int64(len(data))
+	if p.length > 0 {
+		end = min(start+p.length, end)
+	}
+	return data[start:end]
+}
+
+// Decodes a preview within the size limits of the global flags
+func decodePreview(data []byte, p rawPreview, filename string) (*Image, error) {
+	defer metrics.observeStage("decode", time.Now())
+	stream := previewBytes(data, p)
+	config, err := jpeg.DecodeConfig(bytes.NewReader(stream))
+	if err != nil {
+		return nil, msgError("error.decode_input", filename, err)
+	}
+	if err := globalSettings.Decode.CheckSize(int64(config.Width), int64(config.Height), int64(len(stream))); err != nil {
+		return nil, localizeError(err)
+	}
+	src, err := jpeg.Decode(bytes.NewReader(stream))
+	if err != nil {
+		return nil, msgError("error.decode_input", filename, err)
+	}
+	return bmp.FromImage(src), nil
+}
+
+// Turns an image upright by its EXIF orientation: 2 to 8 are mirrored, rotated or both, 1 is left as is
+func orientImage(img *Image, orientation int) (*Image, error) {
+	var err error
+	if orientation == 2 || orientation == 4 || orientation == 5 || orientation == 7 {
+		if img, err = img.Mirror("horizontal", nil); err != nil {
+			return nil, localizeError(err)
+		}
+	}
+	angle := map[int]int{3: 180, 4: 180, 5: 270, 6: 90, 7: 90, 8: 270}[orientation]
+	if angle != 0 {
+		if img, err = img.Rotate(angle, nil); err != nil {
+			return nil, localizeError(err)
+		}
+	}
+	return img, nil
+}
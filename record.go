@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+)
+
+// Longest side of the frames --record writes; larger images are shrunk so that the GIF stays small
+// enough to share
+const recordMaxSide = 640
+
+// Hundredths of a second each frame of the --record GIF is shown, the last one longer so that the
+// result can be looked at before the animation starts over
+const (
+	recordFrameDelay = 100
+	recordLastDelay  = 300
+)
+
+// Frames of a --record GIF: the source image and the image after every stage, each labelled with its
+// number and stage
+type stageRecorder struct {
+	frames []*Image
+	total  int // Number of stages of the pipeline
+}
+
+// Creates a recorder whose first frame is the source image
+func newStageRecorder(img *Image, stages int) *stageRecorder {
+	r := &stageRecorder{total: stages}
+	r.add("source", -1, img)
+	return r
+}
+
+// Adds the image a stage produced as a frame, shrunk and labelled "2/5 rotate"
+func (r *stageRecorder) add(stage string, index int, img *Image) {
+	if img.Width > recordMaxSide || img.Height > recordMaxSide {
+		width, height := fitSize(img.Width, img.Height, recordMaxSide, recordMaxSide)
+		img = applyResize(img, width, height, "bilinear", nil)
+	}
+	label := stage
+	if index >= 0 {
+		label = fmt.Sprintf("%d/%d %s", index+1, r.total, stage)
+	}
+	r.frames = append(r.frames, applyStamp(img, "top-left", label))
+}
+
+// Writes the frames as a looping GIF. Frames of different sizes, as rotate and crop produce, are centered
+// on a white screen the size of the largest one.
+func (r *stageRecorder) save(filename string) error {
+	width, height := 0, 0
+	for _, frame := range r.frames {
+		width, height = max(width, frame.Width), max(height, frame.Height)
+	}
+	anim := &gif.GIF{Config: image.Config{Width: width, Height: height}}
+	for i, frame := range r.frames {
+		anim.Image = append(anim.Image, gifFrame(frame, width, height))
+		delay := recordFrameDelay
+		if i == len(r.frames)-1 {
+			delay = recordLastDelay
+		}
+		anim.Delay = append(anim.Delay, delay)
+		// Each frame replaces the previous one entirely
+		anim.Disposal = append(anim.Disposal, gif.DisposalNone)
+	}
+
+	file, err := files.Create(filename)
+	if err != nil {
+		return msgError("error.create_file", err)
+	}
+	defer file.Close()
+	if err := gif.EncodeAll(file, anim); err != nil {
+		return msgError("error.write_output", err)
+	}
+	return file.Close()
+}
+
+// Converts an image to a GIF frame of the given size with the image centered on white and transparent
+// pixels blended onto it. Images of up to 256 colors keep them exactly; others are dithered to a fixed
+// table of 256 colors, matched by --distance.
+func gifFrame(img *Image, width, height int) *image.Paletted {
+	rgba := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(rgba, rgba.Rect, image.White, image.Point{}, draw.Src)
+	left, top := (width-img.Width)/2, (height-img.Height)/2
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			// Rows are stored bottom-up
+			i := (img.Height-1-y)*img.Width + x
+			p, a := img.Pixels[i], int(alphaAt(img, i))
+			blend := func(v byte) uint8 { return uint8((int(v)*a + 255*(255-a) + 127) / 255) }
+			rgba.SetRGBA(left+x, top+y, color.RGBA{R: blend(p.Red), G: blend(p.Green), B: blend(p.Blue), A: 255})
+		}
+	}
+
+	colors := color.Palette{}
+	seen := map[color.RGBA]bool{}
+	for i := 0; i < len(rgba.Pix) && len(colors) <= 256; i += 4 {
+		c := color.RGBA{R: rgba.Pix[i], G: rgba.Pix[i+1], B: rgba.Pix[i+2], A: 255}
+		if !seen[c] {
+			seen[c] = true
+			colors = append(colors, c)
+		}
+	}
+	frame := image.NewPaletted(rgba.Rect, colors)
+	if len(colors) > 256 {
+		frame.Palette = palette.Plan9
+		paletteDrawer().Draw(frame, frame.Rect, rgba, image.Point{})
+	} else {
+		draw.Draw(frame, frame.Rect, rgba, image.Point{}, draw.Src)
+	}
+	return frame
+}
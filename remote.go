@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"creditcard/bmp"
+)
+
+// Bytes the first request for a remote source asks for: enough for the headers, the color table and
+// the entries of a bitmap array, so that header needs no more than one request
+const firstRemoteBlock = 64 << 10
+
+// Most bytes one request asks for. Requests double up to it while reads move forward, so that decoding
+// the pixels of a large image takes few round trips.
+const maxRemoteBlock = 8 << 20
+
+// Most bytes read from a server that ignores Range and sends the whole file, unless --max-file-size sets
+// a limit: four bytes for each pixel the decoder allocates memory for, and the headers
+const maxRemoteFile = 4*bmp.MaxDecodePixels + firstRemoteBlock
+
+// Client that fetches remote sources. Credentials given in the URL are sent as basic authentication.
+var remoteSourceClient = &http.Client{Timeout: 30 * time.Second}
+
+// First block and size of every remote source fetched so far, with the validators the server sent for
+// it, so that opening one again, as header does for the headers, the array entries and the color profile,
+// costs a request without a body while the source has not changed. Sources sent without an ETag or a
+// Last-Modified date are fetched again each time.
+var remoteHeads = map[string]*remoteFile{}
+
+// Reports whether a source name is an http:// or https:// URL
+func isRemoteSource(name string) bool {
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+// A source read over HTTP with Range requests, one block at a time, so that reading the headers of an
+// image fetches a few kilobytes however large it is. Servers that ignore Range send the whole file,
+// which is then served from memory.
+type remoteFile struct {
+	url        string
+	limit      int64 // Most bytes a server that ignores Range may send, or 0 for maxRemoteFile
+	size       int64
+	pos        int64
+	block      []byte // Bytes fetched last, starting at blockStart
+	blockStart int64
+	next       int64  // Bytes the next request asks for
+	etag       string // Validators of the first block, sent back when the source is opened again
+	modified   string
+}
+
+// Opens a remote source, fetching its first block unless an earlier open did and the server reports it
+// unchanged. Called with the lock of its name held, so that the first block is fetched once; the map is
+// guarded by the mutex of buffered. A server that sends the whole file may send no more than limit bytes,
+// or maxRemoteFile when it is 0.
+func openRemote(name string, limit int64) (io.ReadSeekCloser, error) {
+	buffered.Lock()
+	head := remoteHeads[name]
+	buffered.Unlock()
+	file := &remoteFile{url: name, limit: limit, next: firstRemoteBlock}
+	if head != nil {
+		file.etag, file.modified = head.etag, head.modified
+	}
+	unchanged, err := file.fetchHead()
+	if err != nil {
+		return nil, err
+	}
+	if unchanged {
+		file := *head
+		file.limit = limit
+		return &file, nil
+	}
+	buffered.Lock()
+	if file.etag != "" || file.modified != "" {
+		remoteHeads[name] = &remoteFile{url: name, size: file.size, block: file.block, next: file.next,
+			etag: file.etag, modified: file.modified}
+	} else {
+		delete(remoteHeads, name)
+	}
+	buffered.Unlock()
+	return file, nil
+}
+
+// Fetches the first block, conditionally on the validators of f if it has any, and reports whether the
+// server answered that the source has not changed since
+func (f *remoteFile) fetchHead() (unchanged bool, err error) {
+	header := http.Header{}
+	if f.etag != "" {
+		header.Set("If-None-Match", f.etag)
+	} else if f.modified != "" {
+		header.Set("If-Modified-Since", f.modified)
+	}
+	resp, err := f.get(0, header)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return true, nil
+	}
+	f.etag, f.modified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	return false, f.read(resp, 0)
+}
+
+// Sends a request for the block that starts at start
+func (f *remoteFile) get(start int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, f.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, start+f.next-1))
+	return remoteSourceClient.Do(req)
+}
+
+// Fetches the block that starts at start
+func (f *remoteFile) fetch(start int64) error {
+	resp, err := f.get(start, http.Header{})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return f.read(resp, start)
+}
+
+// Reads the response to a request for the block that starts at start
+func (f *remoteFile) read(resp *http.Response, start int64) error {
+	var err error
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// Content-Range: bytes 0-65535/1048576
+		_, total, _ := strings.Cut(resp.Header.Get("Content-Range"), "/")
+		size, err := strconv.ParseInt(total, 10, 64)
+		if err != nil {
+			return &os.PathError{Op: "get", Path: f.url, Err: errors.New("no size in Content-Range")}
+		}
+		if f.block, err = io.ReadAll(io.LimitReader(resp.Body, f.next)); err != nil {
+			return err
+		}
+		f.size, f.blockStart = size, start
+		logDetail("info.fetch_range", start, start+int64(len(f.block))-1, size, f.url)
+	case http.StatusOK:
+		// The server does not serve ranges, so the whole file becomes one block, read up to the limit
+		// on the file size and a byte past it, to tell a file of that size from a larger one
+		limit := int64(maxRemoteFile)
+		if f.limit > 0 {
+			limit = f.limit
+		}
+		options := bmp.DecodeOptions{MaxFileSize: limit}
+		if err := options.CheckSize(0, 0, resp.ContentLength); err != nil {
+			return err
+		}
+		if f.block, err = io.ReadAll(io.LimitReader(resp.Body, limit+1)); err != nil {
+			return err
+		}
+		if err := options.CheckSize(0, 0, int64(len(f.block))); err != nil {
+			f.block = nil
+			return err
+		}
+		f.size, f.blockStart = int64(len(f.block)), 0
+		logDetail("info.fetch_range", 0, f.size-1, f.size, f.url)
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Asked past the end, as for an empty file: Content-Range: bytes */0
+		_, total, _ := strings.Cut(resp.Header.Get("Content-Range"), "/")
+		size, err := strconv.ParseInt(total, 10, 64)
+		if err != nil {
+			return &os.PathError{Op: "get", Path: f.url, Err: errors.New(resp.Status)}
+		}
+		f.size, f.block, f.blockStart = size, nil, start
+	default:
+		return &os.PathError{Op: "get", Path: f.url, Err: errors.New(resp.Status)}
+	}
+	f.next = min(f.next*2, maxRemoteBlock)
+	return nil
+}
+
+func (f *remoteFile) Read(p []byte) (int, error) {
+	if f.pos >= f.size {
+		return 0, io.EOF
+	}
+	if f.pos < f.blockStart || f.pos >= f.blockStart+int64(len(f.block)) {
+		if err := f.fetch(f.pos); err != nil {
+			return 0, err
+		}
+		if f.pos >= f.blockStart+int64(len(f.block)) {
+			return 0, io.ErrUnexpectedEOF
+		}
+	}
+	n := copy(p, f.block[f.pos-f.blockStart:])
+	f.pos += int64(n)
+	return n, nil
+}
+
+func (f *remoteFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.size
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.url, Err: os.ErrInvalid}
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+func (f *remoteFile) Close() error { return nil }
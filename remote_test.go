@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"creditcard/bmp"
+)
+
+// A server that ignores Range is read no further than the file size limit
+func TestOpenRemoteLimit(t *testing.T) {
+	body := strings.Repeat("x", 1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush() // Sends no Content-Length, so that only the read catches the size
+		io.WriteString(w, body)
+	}))
+	defer server.Close()
+	for _, tt := range []struct {
+		limit   int64
+		wantErr bool
+	}{{999, true}, {1000, false}, {0, false}} {
+		file, err := openRemote(server.URL+"/limit", tt.limit)
+		if tt.wantErr {
+			if !errors.Is(err, bmp.ErrLimit) {
+				t.Errorf("limit %d: got %v, want a limit error", tt.limit, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("limit %d: %v", tt.limit, err)
+		}
+		if data, _ := io.ReadAll(file); string(data) != body {
+			t.Errorf("limit %d: read %d bytes, want %d", tt.limit, len(data), len(body))
+		}
+	}
+}
+
+// Opening a remote source again reuses its first block while the server reports it unchanged, and fetches
+// it anew once the source changes
+func TestOpenRemoteRevalidates(t *testing.T) {
+	version, requests := "one", 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		etag := `"` + version + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		io.WriteString(w, version)
+	}))
+	defer server.Close()
+	name := server.URL + "/revalidate"
+	defer func() {
+		buffered.Lock()
+		delete(remoteHeads, name)
+		buffered.Unlock()
+	}()
+
+	read := func() string {
+		file, err := openRemote(name, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(file)
+		return string(data)
+	}
+	for _, want := range []string{"one", "one", "two"} {
+		if want == "two" {
+			version = "two"
+		}
+		if got := read(); got != want {
+			t.Errorf("read %q, want %q", got, want)
+		}
+	}
+	if requests != 3 {
+		t.Errorf("made %d requests, want 3", requests)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"creditcard/bmp"
+)
+
+// Interpolation algorithms of --resize and --scale
+var resizeAlgorithms = []string{"bilinear", "nearest"}
+
+// Largest factor --scale, and a percentage of --resize, enlarges a side by: a one-pixel image enlarged by
+// it on both sides reaches bmp.MaxDecodePixels
+const maxScaleFactor = 1 << 14
+
+// Reports whether an image of the given size has more pixels than the decoders allocate memory for, which
+// results of --resize and --scale may not have either
+func tooManyPixels(width, height int) bool {
+	return int64(width)*int64(height) > bmp.MaxDecodePixels
+}
+
+// Parses a --resize value of the form WxH[:algorithm], where the sides may be percentages of the image
+// sides or physical lengths, as parseGeometry reads them
+func parseResize(value string) (width, height geometryLength, algorithm string, err error) {
+	size, algorithm, found := strings.Cut(value, ":")
+	if !found {
+		algorithm = resizeAlgorithms[0]
+	}
+	width, height, ok := parseGeometry(size)
+	if !ok || width.value == 0 || height.value == 0 || !contains(resizeAlgorithms, algorithm) ||
+		!resizeLengthFits(width) || !resizeLengthFits(height) ||
+		!width.percent && !height.percent && width.value*height.value > bmp.MaxDecodePixels {
+		return geometryLength{}, geometryLength{}, "", msgError("error.invalid_resize", value, bmp.MaxDecodePixels)
+	}
+	return width, height, algorithm, nil
+}
+
+// Reports whether a side of --resize stays within the sizes a result may have, whatever the image side a
+// percentage is taken of
+func resizeLengthFits(length geometryLength) bool {
+	if length.percent {
+		return length.value <= maxScaleFactor*100
+	}
+	return length.value <= bmp.MaxDecodePixels
+}
+
+// Returns the size of the result of a --resize value on an image, or an error when it has more pixels
+// than the decoders allocate memory for
+func resizeResult(value string, img *Image) (width, height int, algorithm string, err error) {
+	w, h, algorithm, err := parseResize(value)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	width, height = max(w.pixels(img.Width), 1), max(h.pixels(img.Height), 1)
+	if tooManyPixels(width, height) {
+		return 0, 0, "", msgError("error.invalid_resize", value, bmp.MaxDecodePixels)
+	}
+	return width, height, algorithm, nil
+}
+
+// Parses a --scale value of the form factor[:algorithm]
+func parseScale(value string) (factor float64, algorithm string, err error) {
+	number, algorithm, found := strings.Cut(value, ":")
+	if !found {
+		algorithm = resizeAlgorithms[0]
+	}
+	factor, err = strconv.ParseFloat(number, 64)
+	if err != nil || !(factor > 0) || factor > maxScaleFactor || !contains(resizeAlgorithms, algorithm) {
+		return 0, "", msgError("error.invalid_scale", value, bmp.MaxDecodePixels)
+	}
+	return factor, algorithm, nil
+}
+
+// Returns the size an image scaled by a factor has, keeping at least one pixel on each side
+func scaleSize(width, height int, factor float64) (int, int) {
+	return max(int(math.Round(float64(width)*factor)), 1), max(int(math.Round(float64(height)*factor)), 1)
+}
+
+// Scales the image by a factor, or returns an error naming the --scale value when the result has more
+// pixels than the decoders allocate memory for
+func applyScale(img *Image, value string, factor float64, algorithm string, progress rowProgress) (*Image, error) {
+	width, height := scaleSize(img.Width, img.Height, factor)
+	if tooManyPixels(width, height) {
+		return nil, msgError("error.invalid_scale", value, bmp.MaxDecodePixels)
+	}
+	return applyResize(img, width, height, algorithm, progress), nil
+}
+
+// Scales the image to the given size with the interpolation algorithm
+func applyResize(img *Image, width, height int, algorithm string, progress rowProgress) *Image {
+	if width == img.Width && height == img.Height {
+		return img
+	}
+	if algorithm == "nearest" {
+		result := resizeImage(img, width, height)
+		progress.Report(height, height)
+		return result
+	}
+	return resizeBilinear(img, width, height, progress)
+}
+
+// Set by the --straight-alpha global flag: resamples colors without weighting them by alpha, as
+// earlier versions did, so that results can be compared with theirs
+var straightAlpha bool
+
+// Source pixel that contributes to a result pixel, and its share
+type resizeTap struct {
+	index  int
+	weight float64
+}
+
+// Returns the taps of each result pixel along one axis of a triangle filter. Enlarging blends the two
+// nearest source pixels, as bilinear interpolation does; shrinking widens the filter to cover every
+// source pixel the result pixel spans, so that no detail is skipped.
+func resizeTaps(size, sourceSize int) [][]resizeTap {
+	ratio := float64(sourceSize) / float64(size)
+	support := math.Max(ratio, 1)
+	taps := make([][]resizeTap, size)
+	for pos := range taps {
+		center := (float64(pos)+0.5)*ratio - 0.5
+		var sum float64
+		for s := int(math.Floor(center-support)) + 1; float64(s) < center+support; s++ {
+			weight := 1 - math.Abs(float64(s)-center)/support
+			if weight <= 0 {
+				continue
+			}
+			// Pixels beyond the borders repeat the edge pixels
+			taps[pos] = append(taps[pos], resizeTap{max(0, min(s, sourceSize-1)), weight})
+			sum += weight
+		}
+		for i := range taps[pos] {
+			taps[pos][i].weight /= sum
+		}
+	}
+	return taps
+}
+
+// Scales the image with a triangle filter, first along rows and then along columns. Colors are
+// premultiplied by alpha while they are blended, so transparent pixels do not darken the edges of the
+// content, unless --straight-alpha is given.
+func resizeBilinear(img *Image, width, height int, progress rowProgress) *Image {
+	result := &Image{Width: width, Height: height, Pixels: make([]Pixel, width*height), Gap: img.Gap, Palette: img.Palette}
+	if img.Alpha != nil {
+		result.Alpha = make([]byte, width*height)
+	}
+	columns, rows := resizeTaps(width, img.Width), resizeTaps(height, img.Height)
+	if bmp.Accel != nil {
+		if sums, ok := bmp.Accel.Resample(resampleSource(img), img.Width, img.Height, packTaps(columns), packTaps(rows)); ok {
+			for i := range result.Pixels {
+				c := sums[i*4 : i*4+4]
+				setResized(result, i, [4]float64{float64(c[0]), float64(c[1]), float64(c[2]), float64(c[3])})
+			}
+			progress.Report(height, height)
+			return result
+		}
+	}
+
+	// Source rows scaled to the result width, as red, green, blue and alpha
+	scaled := make([]float64, img.Height*width*4)
+	for y := 0; y < img.Height; y++ {
+		for x, taps := range columns {
+			c := scaled[(y*width+x)*4 : (y*width+x)*4+4]
+			for _, tap := range taps {
+				src := y*img.Width + tap.index
+				p, a := img.Pixels[src], 1.0
+				if img.Alpha != nil {
+					a = float64(img.Alpha[src]) / 255
+				}
+				w := tap.weight
+				c[3] += w * a
+				if !straightAlpha {
+					w *= a
+				}
+				c[0], c[1], c[2] = c[0]+w*float64(p.Red), c[1]+w*float64(p.Green), c[2]+w*float64(p.Blue)
+			}
+		}
+	}
+
+	for y, taps := range rows {
+		for x := 0; x < width; x++ {
+			var c [4]float64
+			for _, tap := range taps {
+				for i, v := range scaled[(tap.index*width+x)*4 : (tap.index*width+x)*4+4] {
+					c[i] += tap.weight * v
+				}
+			}
+			setResized(result, y*width+x, c)
+		}
+		progress.Report(y+1, height)
+	}
+	return result
+}
+
+// Stores pixel i of a resized image from its blended red, green, blue and alpha, the colors weighted by
+// alpha unless --straight-alpha is given
+func setResized(result *Image, i int, c [4]float64) {
+	red, green, blue, alpha := c[0], c[1], c[2], c[3]
+	if !straightAlpha && alpha > 0 {
+		red, green, blue = red/alpha, green/alpha, blue/alpha
+	}
+	if straightAlpha || alpha > 0 {
+		result.Pixels[i] = Pixel{Blue: byte(math.Round(blue)), Green: byte(math.Round(green)), Red: byte(math.Round(red))}
+	}
+	if result.Alpha != nil {
+		result.Alpha[i] = byte(math.Round(alpha * 255))
+	}
+}
+
+// Returns the pixels of an image as red, green, blue and alpha from 0 to 1, the colors weighted by alpha
+// unless --straight-alpha is given, as resizeBilinear blends them
+func resampleSource(img *Image) []float32 {
+	src := make([]float32, len(img.Pixels)*4)
+	for i, p := range img.Pixels {
+		a := float32(1)
+		if img.Alpha != nil {
+			a = float32(img.Alpha[i]) / 255
+		}
+		w := a
+		if straightAlpha {
+			w = 1
+		}
+		src[i*4], src[i*4+1], src[i*4+2], src[i*4+3] = w*float32(p.Red), w*float32(p.Green), w*float32(p.Blue), a
+	}
+	return src
+}
+
+// Packs the taps of every result pixel along an axis for an accelerator
+func packTaps(taps [][]resizeTap) bmp.Taps {
+	packed := bmp.Taps{Start: make([]int32, 0, len(taps)+1)}
+	for _, pixel := range taps {
+		packed.Start = append(packed.Start, int32(len(packed.Index)))
+		for _, tap := range pixel {
+			packed.Index = append(packed.Index, int32(tap.index))
+			packed.Weight = append(packed.Weight, float32(tap.weight))
+		}
+	}
+	packed.Start = append(packed.Start, int32(len(packed.Index)))
+	return packed
+}
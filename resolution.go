@@ -0,0 +1,43 @@
+package main
+
+import (
+	"math"
+	"strconv"
+)
+
+// Meters in an inch, for converting the pixels per meter BMP headers store to dots per inch
+const metersPerInch = 0.0254
+
+// Returns a resolution in pixels per meter as dots per inch, rounded to a tenth, so that the 2835 pixels
+// per meter most files store read as 72
+func dotsPerInch(pixelsPerMeter int32) float64 {
+	return math.Round(float64(pixelsPerMeter)*metersPerInch*10) / 10
+}
+
+// Parses a --dpi value into pixels per meter
+func parseDPI(value string) (int32, bool) {
+	dpi, err := strconv.ParseFloat(value, 64)
+	if err != nil || dpi <= 0 {
+		return 0, false
+	}
+	ppm := math.Round(dpi / metersPerInch)
+	if ppm < 1 || ppm > math.MaxInt32 {
+		return 0, false
+	}
+	return int32(ppm), true
+}
+
+// Validates a --dpi value
+func checkDPI(value string) error {
+	if _, ok := parseDPI(value); !ok {
+		return msgError("expect.dpi")
+	}
+	return nil
+}
+
+// Sets both resolution fields of the header to a --dpi value. Outputs copy them from the header, so the
+// pixel data is left as it is.
+func setResolution(dibHeader *DIBHeader, value string) {
+	ppm, _ := parseDPI(value)
+	dibHeader.XPixelsPerM, dibHeader.YPixelsPerM = ppm, ppm
+}
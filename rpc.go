@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// Decoded image together with the headers it was read with, so it can be saved like the source
+type loadedImage struct {
+	bmpHeader *BMPHeader
+	dibHeader *DIBHeader
+	img       *Image
+}
+
+// One request line of the rpc protocol
+type rpcRequest struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Path   string          `json:"path,omitempty"`  // load, save
+	Image  int             `json:"image,omitempty"` // apply, save, stats, release
+	Ops    []Option        `json:"ops,omitempty"`   // apply: [{"name": "rotate", "value": "right"}]
+}
+
+// One response line of the rpc protocol, echoing the request id
+type rpcResponse struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Result any             `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Image statistics returned by load, apply and stats
+type rpcImageInfo struct {
+	Image  int           `json:"image"`
+	Width  int           `json:"width"`
+	Height int           `json:"height"`
+	Red    *channelStats `json:"red,omitempty"`
+	Green  *channelStats `json:"green,omitempty"`
+	Blue   *channelStats `json:"blue,omitempty"`
+}
+
+// Summary of one color channel
+type channelStats struct {
+	Min  byte    `json:"min"`
+	Max  byte    `json:"max"`
+	Mean float64 `json:"mean"`
+}
+
+// Holds the images of an rpc session by id
+type rpcSession struct {
+	images map[int]*loadedImage
+	nextID int
+	root   *pathRoot // Directory paths of requests may not leave, nil when any path is allowed
+}
+
+// Answers newline-delimited JSON requests from standard input until it is closed
+func runRPC(args []string) error {
+	var rootDir string
+	var followSymlinks bool
+	flags := []flagSpec{
+		{Name: "root", Target: &rootDir, Check: nonEmpty},
+		{Name: "follow-symlinks", Target: &followSymlinks},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return msgError("usage.rpc")
+	}
+
+	lockFiles = true
+	s := &rpcSession{images: make(map[int]*loadedImage), nextID: 1}
+	if rootDir != "" {
+		if s.root, err = newPathRoot(rootDir, followSymlinks); err != nil {
+			return err
+		}
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), maxFrameSize)
+	encoder := json.NewEncoder(os.Stdout)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var req rpcRequest
+		resp := &rpcResponse{}
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			resp.Error = msg("error.rpc_request", err)
+		} else {
+			resp.ID = req.ID
+			if result, err := s.handle(&req); err != nil {
+				resp.Error = err.Error()
+			} else {
+				resp.Result = result
+			}
+		}
+		if err := encoder.Encode(resp); err != nil {
+			return msgError("error.write_results", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return msgError("error.rpc_request", err)
+	}
+	return nil
+}
+
+// Runs one request against the session
+func (s *rpcSession) handle(req *rpcRequest) (any, error) {
+	switch req.Method {
+	case "load":
+		path, err := s.resolve(req.Path)
+		if err != nil {
+			return nil, err
+		}
+		bmpHeader, dibHeader, img, err := globalSettings.loadImage(path)
+		if err != nil {
+			return nil, err
+		}
+		return s.add(&loadedImage{bmpHeader, dibHeader, img}), nil
+	case "apply":
+		src, err := s.lookup(req.Image)
+		if err != nil {
+			return nil, err
+		}
+		options := make([]Option, len(req.Ops))
+		for i, opt := range req.Ops {
+			options[i] = Option{Name: "--" + strings.TrimPrefix(opt.Name, "--"), Value: opt.Value}
+			// Files named in option values are not confined to the root, so no option may read one
+			if op, ok := findOperation(options[i].Name); ok && s.root != nil && readsFiles(op) {
+				return nil, msgError("error.rpc_file_option", op.Name)
+			}
+		}
+		img, err := applyOptions(src.img, options)
+		if err != nil {
+			return nil, err
+		}
+		return s.add(&loadedImage{src.bmpHeader, src.dibHeader, img}), nil
+	case "save":
+		src, err := s.lookup(req.Image)
+		if err != nil {
+			return nil, err
+		}
+		path, err := s.resolve(req.Path)
+		if err != nil {
+			return nil, err
+		}
+		if err := globalSettings.saveImage(path, src.bmpHeader, src.dibHeader, src.img); err != nil {
+			return nil, err
+		}
+		return map[string]string{"path": req.Path}, nil
+	case "stats":
+		src, err := s.lookup(req.Image)
+		if err != nil {
+			return nil, err
+		}
+		info := &rpcImageInfo{Image: req.Image, Width: src.img.Width, Height: src.img.Height}
+		info.Red, info.Green, info.Blue = imageChannelStats(src.img)
+		return info, nil
+	case "release":
+		if _, err := s.lookup(req.Image); err != nil {
+			return nil, err
+		}
+		delete(s.images, req.Image)
+		return map[string]int{"image": req.Image}, nil
+	}
+	return nil, msgError("error.rpc_method", req.Method)
+}
+
+// Stores an image in the session and describes it
+func (s *rpcSession) add(img *loadedImage) *rpcImageInfo {
+	id := s.nextID
+	s.nextID++
+	s.images[id] = img
+	return &rpcImageInfo{Image: id, Width: img.img.Width, Height: img.img.Height}
+}
+
+// Returns the file a request names: with --root, its canonical path, relative ones taken from the root,
+// as long as it stays in the root
+func (s *rpcSession) resolve(path string) (string, error) {
+	if s.root == nil {
+		return path, nil
+	}
+	return s.root.resolve(path)
+}
+
+// Returns the session image with the given id
+func (s *rpcSession) lookup(id int) (*loadedImage, error) {
+	img, ok := s.images[id]
+	if !ok {
+		return nil, msgError("error.unknown_image", id)
+	}
+	return img, nil
+}
+
+// Returns the minimum, maximum and mean of each color channel
+func imageChannelStats(img *Image) (red, green, blue *channelStats) {
+	red, green, blue = &channelStats{Min: 255}, &channelStats{Min: 255}, &channelStats{Min: 255}
+	var sumR, sumG, sumB float64
+	update := func(s *channelStats, v byte) {
+		s.Min, s.Max = min(s.Min, v), max(s.Max, v)
+	}
+	for _, p := range img.Pixels {
+		update(red, p.Red)
+		update(green, p.Green)
+		update(blue, p.Blue)
+		sumR, sumG, sumB = sumR+float64(p.Red), sumG+float64(p.Green), sumB+float64(p.Blue)
+	}
+	if n := float64(len(img.Pixels)); n > 0 {
+		red.Mean, green.Mean, blue.Mean = sumR/n, sumG/n, sumB/n
+	}
+	return red, green, blue
+}
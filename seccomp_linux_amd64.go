@@ -0,0 +1,24 @@
+package main
+
+import "syscall"
+
+// Numbers of the seccomp and rseq system calls and AUDIT_ARCH_X86_64
+const (
+	seccompSyscall = 317
+	seccompRseq    = 334 // Not in the syscall package, which predates it
+	seccompArch    = 0xc000003e
+)
+
+// System calls a confined decoder process may make: those the Go runtime makes to allocate, collect
+// garbage, schedule goroutines on threads and deliver signals, those the C library makes to start a thread
+// when the program is linked with it, and those that read the request and write the response
+var seccompSyscalls = []uintptr{
+	syscall.SYS_READ, syscall.SYS_WRITE, syscall.SYS_CLOSE,
+	syscall.SYS_MMAP, syscall.SYS_MUNMAP, syscall.SYS_MADVISE, syscall.SYS_MPROTECT, syscall.SYS_BRK,
+	syscall.SYS_FUTEX, syscall.SYS_CLONE, syscall.SYS_SCHED_YIELD, syscall.SYS_NANOSLEEP,
+	syscall.SYS_SET_ROBUST_LIST, seccompRseq,
+	syscall.SYS_GETTID, syscall.SYS_GETPID, syscall.SYS_TGKILL, syscall.SYS_ARCH_PRCTL,
+	syscall.SYS_RT_SIGACTION, syscall.SYS_RT_SIGPROCMASK, syscall.SYS_RT_SIGRETURN, syscall.SYS_SIGALTSTACK,
+	syscall.SYS_CLOCK_GETTIME, syscall.SYS_EPOLL_WAIT, syscall.SYS_EPOLL_PWAIT, syscall.SYS_EPOLL_CTL,
+	syscall.SYS_EXIT, syscall.SYS_EXIT_GROUP,
+}
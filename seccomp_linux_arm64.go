@@ -0,0 +1,22 @@
+package main
+
+import "syscall"
+
+// Numbers of the seccomp and rseq system calls and AUDIT_ARCH_AARCH64
+const (
+	seccompSyscall = 277
+	seccompRseq    = 293 // Not in the syscall package, which predates it
+	seccompArch    = 0xc00000b7
+)
+
+// System calls a confined decoder process may make, as on amd64, which arm64 has no older forms of
+var seccompSyscalls = []uintptr{
+	syscall.SYS_READ, syscall.SYS_WRITE, syscall.SYS_CLOSE,
+	syscall.SYS_MMAP, syscall.SYS_MUNMAP, syscall.SYS_MADVISE, syscall.SYS_MPROTECT, syscall.SYS_BRK,
+	syscall.SYS_FUTEX, syscall.SYS_CLONE, syscall.SYS_SCHED_YIELD, syscall.SYS_NANOSLEEP,
+	syscall.SYS_SET_ROBUST_LIST, seccompRseq,
+	syscall.SYS_GETTID, syscall.SYS_GETPID, syscall.SYS_TGKILL,
+	syscall.SYS_RT_SIGACTION, syscall.SYS_RT_SIGPROCMASK, syscall.SYS_RT_SIGRETURN, syscall.SYS_SIGALTSTACK,
+	syscall.SYS_CLOCK_GETTIME, syscall.SYS_EPOLL_PWAIT, syscall.SYS_EPOLL_CTL,
+	syscall.SYS_EXIT, syscall.SYS_EXIT_GROUP,
+}
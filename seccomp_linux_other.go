@@ -0,0 +1,12 @@
+//go:build linux && !amd64 && !arm64
+
+package main
+
+// Other architectures get no seccomp filter, only the limits on files
+const (
+	seccompSyscall = 0
+	seccompRseq    = 0
+	seccompArch    = 0
+)
+
+var seccompSyscalls []uintptr
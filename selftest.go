@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"runtime"
+	"strings"
+
+	"creditcard/bmp"
+)
+
+// Size of the fixtures the selftest command runs on: small enough to check in a blink, large enough for
+// every option to do real work and for --jobs to split the rows
+const selfTestWidth, selfTestHeight = 24, 16
+
+// Files the selftest command encodes from a fixture, with the CRC-32 of the bytes a correct build writes.
+// Decoding each file must give back the fixture.
+var selfTestCodecs = []struct {
+	name    string
+	fixture string
+	opts    bmp.EncodeOptions
+	crc     uint32
+}{
+	{"encode 24-bit", "rgb", bmp.EncodeOptions{}, 0x5c88f07c},
+	{"encode 32-bit with alpha", "alpha", bmp.EncodeOptions{}, 0x22f2928c},
+	{"encode 4-bit indexed", "indexed", bmp.EncodeOptions{}, 0xef7fa039},
+	{"encode 1-bit indexed", "mono", bmp.EncodeOptions{}, 0x1866801b},
+	{"encode compact", "gray", bmp.EncodeOptions{Compact: true}, 0x2d8606ad},
+	{"encode true color", "indexed", bmp.EncodeOptions{TrueColor: true}, 0xac1b7b4d},
+}
+
+// Option chains the selftest command applies to a fixture, with the CRC-32 of the pixels a correct build
+// produces, as imageChecksum computes it
+var selfTestOptions = []struct {
+	options string
+	fixture string
+	crc     uint32
+}{
+	{"--mirror=horizontal", "rgb", 0x84720b0f},
+	{"--mirror=vertical", "rgb", 0xa10df3d6},
+	{"--filter=grayscale", "rgb", 0xb0255676},
+	{"--filter=negative", "rgb", 0xf3eec4fb},
+	{"--filter=red", "rgb", 0x176a57e2},
+	{"--filter=sharpen", "rgb", 0xbe599e37},
+	{"--filter=edge", "rgb", 0xd0c447aa},
+	{"--filter=pixelate:size=4", "rgb", 0x88ee9077},
+	{"--brightness=20", "rgb", 0xb1f52816},
+	{"--contrast=-50", "rgb", 0x8515d2d6},
+	{"--saturation=30", "rgb", 0xf8fdc498},
+	{"--gamma=1.5", "rgb", 0x4bb5c424},
+	{"--auto-expose=from:4,4,8,8", "rgb", 0x0b667920},
+	{"--blur=2", "rgb", 0x00384950},
+	{"--blur=3,box", "rgb", 0x872a97ac},
+	{"--convolve=0,1,0,1,-4,1,0,1,0:mirror", "rgb", 0xdc215c75},
+	{"--rotate=right", "rgb", 0x1cb155d7},
+	{"--rotate=180", "rgb", 0x137de83d},
+	{"--rotate=37.5", "rgb", 0xc633d829},
+	{"--crop=2-2-12-8", "rgb", 0x624ab27a},
+	{"--crop=center-50%-50%", "rgb", 0x2e082103},
+	{"--pixelate=2-2-16-12:4", "rgb", 0x2a56e761},
+	{"--smartcrop=12x8", "rgb", 0x68c1c90d},
+	{"--colormap=viridis", "rgb", 0xc1d56288},
+	{"--bitplane=green:7", "rgb", 0x7a23e3d8},
+	{"--pixelsort=100", "rgb", 0x85e811a1},
+	{"--rowshift=5:7", "rgb", 0xcfd22576},
+	{"--crystallize=20:7", "rgb", 0xfbdf4a1e},
+	{"--lens=-0.2,0", "rgb", 0xce5db4a5},
+	{"--swirl=90", "rgb", 0x892a55b6},
+	{"--implode=0.5", "rgb", 0x0b1449fe},
+	{"--wave=2,8", "rgb", 0x6ad59389},
+	{"--kaleidoscope=6", "rgb", 0x799a25b3},
+	{"--symmetry=quad", "rgb", 0x7dae9996},
+	{"--colorspace=linear", "rgb", 0x2832bf26},
+	{"--resize=16x8", "rgb", 0x54aa9fd7},
+	{"--resize=40x30:nearest", "rgb", 0xa0f7f66a},
+	{"--scale=0.5", "rgb", 0x98c77ee6},
+	{"--upscale=scale2x", "rgb", 0xaeeadfc4},
+	{"--upscale=xbr:2", "rgb", 0x8707b723},
+	{"--zoom=4x:grid", "rgb", 0x479d5519},
+	{"--fit=16x8", "rgb", 0xcc787eb1},
+	{"--ninepatch=2,2,2,2:40x30", "rgb", 0x530ea1e0},
+	{"--stamp=top-left:OK", "rgb", 0xb420c945},
+	{"--trim=alpha", "alpha", 0x06d6be7d},
+	{"--outline=1,ffffff", "alpha", 0xdc406bb0},
+	{"--resize=12x8", "alpha", 0x177bd825},
+	{"--rotate=90", "alpha", 0x81e8b453},
+	{"--mirror=horizontal", "indexed", 0x2940858a},
+	{"--filter=grayscale", "indexed", 0x2a85776f},
+	// Neighboring moves and per-pixel filters run fused in one pass
+	{"--mirror=horizontal --rotate=90 --filter=negative --crop=1-1-10-20", "rgb", 0x124abb9f},
+	{"--colorspace=linear --resize=12x8 --colorspace=srgb --brightness=-35", "rgb", 0xf035c701},
+}
+
+// Run-length encoded 4x2 file with a black and white color table: white bottom row, then two black and
+// two white pixels
+var selfTestRLE8 = []byte{
+	'B', 'M', 72, 0, 0, 0, 0, 0, 0, 0, 62, 0, 0, 0, // BMP header
+	40, 0, 0, 0, 4, 0, 0, 0, 2, 0, 0, 0, 1, 0, 8, 0, // DIB header: size, width, height, planes, bits
+	1, 0, 0, 0, 10, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, // RLE8 compression, image size, resolution
+	2, 0, 0, 0, 0, 0, 0, 0, // colors used and important
+	0, 0, 0, 0, 255, 255, 255, 0, // color table
+	4, 1, 0, 0, // four white pixels, end of line
+	2, 0, 2, 1, 0, 1, // two black, two white, end of bitmap
+}
+
+// CRC-32 of the pixels selfTestRLE8 decodes to
+const selfTestRLE8CRC = 0xcd542274
+
+// Checks that this build decodes, encodes and transforms images exactly as the reference build does, by
+// running every vector on fixtures generated in memory and comparing checksums. Options also run on a
+// single goroutine, which must give the same result as the rows split across --jobs.
+func runSelfTest(args []string) error {
+	_, positional, err := parseCommandLine(args, nil, false)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return msgError("usage.selftest")
+	}
+	// The vectors were recorded with the default settings of the global options that change results
+	background, straightAlpha = nil, false
+
+	passed, failed := 0, 0
+	check := func(name string, got, want uint32, err error) {
+		switch {
+		case err != nil:
+			fmt.Println(msg("info.selftest_error", name, localizeError(err)))
+		case got != want:
+			fmt.Println(msg("info.selftest_fail", name, got, want))
+		default:
+			fmt.Println(msg("info.selftest_ok", name, got))
+			passed++
+			return
+		}
+		failed++
+	}
+
+	for _, codec := range selfTestCodecs {
+		got, err := selfTestCodec(selfTestFixture(codec.fixture), codec.opts)
+		check(codec.name, got, codec.crc, err)
+	}
+	img, err := bmp.Decode(bytes.NewReader(selfTestRLE8))
+	if err == nil {
+		check("decode RLE8", imageChecksum(img), selfTestRLE8CRC, nil)
+	} else {
+		check("decode RLE8", 0, selfTestRLE8CRC, err)
+	}
+
+	jobs := bmp.Jobs
+	for _, vector := range selfTestOptions {
+		name := vector.options
+		if vector.fixture != "rgb" {
+			name += " (" + vector.fixture + ")"
+		}
+		got, err := selfTestApply(selfTestFixture(vector.fixture), vector.options)
+		if err == nil && jobs != 1 {
+			bmp.Jobs = 1
+			single, singleErr := selfTestApply(selfTestFixture(vector.fixture), vector.options)
+			bmp.Jobs = jobs
+			if singleErr == nil && single != got {
+				fmt.Println(msg("info.selftest_jobs", name, jobs))
+				failed++
+				continue
+			}
+		}
+		check(name, got, vector.crc, err)
+	}
+
+	platform := fmt.Sprintf("%s/%s, %s", runtime.GOOS, runtime.GOARCH, runtime.Version())
+	if failed > 0 {
+		return msgError("error.selftest_failed", failed, passed+failed, platform)
+	}
+	fmt.Println(msg("info.selftest_passed", passed, platform))
+	return nil
+}
+
+// Encodes a fixture, returning the CRC-32 of the file, and checks that decoding it gives the fixture back
+func selfTestCodec(img *Image, opts bmp.EncodeOptions) (uint32, error) {
+	var buf bytes.Buffer
+	dibHeader := DIBHeader{Width: int32(img.Width), Height: int32(img.Height)}
+	if err := bmp.EncodePixels(&buf, &BMPHeader{}, &dibHeader, img, opts); err != nil {
+		return 0, err
+	}
+	crc := crc32.ChecksumIEEE(buf.Bytes())
+	decoded, err := bmp.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return crc, err
+	}
+	// True color output drops alpha, which the fixtures it runs on do not have
+	if imageChecksum(decoded) != imageChecksum(img) {
+		return crc, msgError("error.selftest_roundtrip")
+	}
+	return crc, nil
+}
+
+// Applies space-separated options to a fixture, returning the CRC-32 of the result
+func selfTestApply(img *Image, options string) (uint32, error) {
+	var opts []Option
+	for _, field := range strings.Fields(options) {
+		name, value, _ := strings.Cut(field, "=")
+		opts = append(opts, Option{Name: name, Value: value})
+	}
+	result, err := NewPipeline(opts).Run(img)
+	if err != nil {
+		return 0, err
+	}
+	return imageChecksum(result), nil
+}
+
+// Returns a fixture generated from its name: "rgb", a 24-bit image of gradients and diagonal stripes;
+// "alpha", the same with a transparent border fading in; "gray", its gray levels; "indexed", 16 colors
+// from a color table; "mono", two
+func selfTestFixture(name string) *Image {
+	width, height := selfTestWidth, selfTestHeight
+	img := &Image{Width: width, Height: height, Pixels: make([]Pixel, width*height)}
+	for i := range img.Pixels {
+		x, y := i%width, i/width
+		img.Pixels[i] = Pixel{Blue: byte(x * 255 / (width - 1)), Green: byte(y * 255 / (height - 1)), Red: byte((x*37 + y*91) % 256)}
+	}
+	switch name {
+	case "alpha":
+		img.Alpha = make([]byte, len(img.Pixels))
+		for i := range img.Alpha {
+			x, y := i%width, i/width
+			edge := min(x, y, width-1-x, height-1-y)
+			img.Alpha[i] = byte(min(edge*85, 255))
+		}
+	case "gray":
+		for i, p := range img.Pixels {
+			v := byte((int(p.Blue) + int(p.Green) + int(p.Red)) / 3)
+			img.Pixels[i] = Pixel{Blue: v, Green: v, Red: v}
+		}
+	case "indexed", "mono":
+		colors := 16
+		if name == "mono" {
+			colors = 2
+		}
+		img.Palette = make([]Pixel, colors)
+		for i := range img.Palette {
+			img.Palette[i] = Pixel{Blue: byte(i * 255 / (colors - 1)), Green: byte(i * 97 % 256), Red: byte(255 - i*255/(colors-1))}
+		}
+		img.Indices = make([]byte, len(img.Pixels))
+		for i := range img.Indices {
+			x, y := i%width, i/width
+			img.Indices[i] = byte((x/3 + y/2) % colors)
+			img.Pixels[i] = img.Palette[img.Indices[i]]
+		}
+	}
+	return img
+}
+
+// Returns the CRC-32 of an image's size and its blue, green, red and alpha values in storage order, laid
+// out in little-endian order so that the checksum is the same on every platform
+func imageChecksum(img *Image) uint32 {
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(img.Width))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(img.Height))
+	for i, p := range img.Pixels {
+		buf = append(buf, p.Blue, p.Green, p.Red, alphaAt(img, i))
+	}
+	return crc32.ChecksumIEEE(buf)
+}
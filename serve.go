@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Default limits of the serve command
+const (
+	defaultServeBodySize = 32 << 20
+	defaultServeTimeout  = 30 * time.Second
+	defaultCacheSize     = 64 << 20
+	defaultCacheMaxAge   = time.Hour
+)
+
+// Describes the settings of the serve command
+type serveConfig struct {
+	addr          string
+	maxConcurrent int           // Requests processed at once; more are rejected with 429
+	maxBodySize   int64         // Largest accepted upload in bytes; larger ones are rejected with 413
+	timeout       time.Duration // Time allowed for reading and processing one request
+	secret        string        // Key of the HMAC that requests must be signed with, unsigned requests are allowed when empty
+	cacheSize     int64         // Bytes of encoded responses kept in memory, 0 disables the cache
+	cacheMaxAge   time.Duration // max-age sent in Cache-Control headers
+	shutdownDelay time.Duration // Time /readyz reports failure before draining starts
+}
+
+// Holds the state of a running server
+type imageServer struct {
+	cfg      *serveConfig
+	cache    *responseCache // nil when caching is disabled
+	server   *http.Server
+	draining atomic.Bool // Set once shutdown has begun
+}
+
+// Parses serve arguments
+func parseServeArgs(args []string) (*serveConfig, error) {
+	cfg := &serveConfig{
+		addr:          "127.0.0.1:8080",
+		maxConcurrent: runtime.NumCPU(),
+		maxBodySize:   defaultServeBodySize,
+		timeout:       defaultServeTimeout,
+		cacheSize:     defaultCacheSize,
+		cacheMaxAge:   defaultCacheMaxAge,
+	}
+
+	flags := []flagSpec{
+		{Name: "addr", Target: &cfg.addr},
+		{Name: "max-concurrent", Target: &cfg.maxConcurrent, Min: 1},
+		{Name: "max-body-size", Target: &cfg.maxBodySize, Min: 1},
+		{Name: "timeout", Target: &cfg.timeout, Min: 1},
+		{Name: "secret", Target: &cfg.secret, Check: nonEmpty},
+		{Name: "cache-size", Target: &cfg.cacheSize},
+		{Name: "cache-max-age", Target: &cfg.cacheMaxAge},
+		{Name: "shutdown-delay", Target: &cfg.shutdownDelay},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) > 0 {
+		return nil, msgError("error.unexpected_arg", positional[0])
+	}
+	return cfg, nil
+}
+
+// Serves the apply pipeline over HTTP until the process is stopped
+func runServe(args []string) error {
+	cfg, err := parseServeArgs(args)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", cfg.addr)
+	if err != nil {
+		return msgError("error.start_server", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s := newServer(cfg)
+	logInfo("info.serving", listener.Addr())
+	errc := make(chan error, 1)
+	go func() { errc <- s.server.Serve(listener) }()
+
+	select {
+	case err := <-errc:
+		return msgError("error.start_server", err)
+	case <-ctx.Done():
+	}
+
+	// Report not ready first so load balancers stop routing here, then let in-flight requests finish
+	s.draining.Store(true)
+	logInfo("info.draining")
+	time.Sleep(cfg.shutdownDelay)
+
+	// No request can run longer than the request timeout, so that bounds the drain as well
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+	defer cancel()
+	if err := s.server.Shutdown(drainCtx); err != nil {
+		return msgError("error.shutdown", err)
+	}
+	return nil
+}
+
+// Builds the HTTP server with the request limits of cfg applied
+func newServer(cfg *serveConfig) *imageServer {
+	s := &imageServer{cfg: cfg}
+	if cfg.cacheSize > 0 {
+		s.cache = newResponseCache(cfg.cacheSize)
+	}
+
+	// The limiter sits inside the timeout handler so that a slot stays taken
+	// until the work finishes, even after the client was answered with 503
+	apply := limitConcurrency(cfg.maxConcurrent, limitBodySize(cfg.maxBodySize, recoverPanics(http.HandlerFunc(s.handleApply))))
+
+	var handler http.Handler = http.TimeoutHandler(apply, cfg.timeout, msg("error.request_timeout"))
+	if cfg.secret != "" {
+		handler = requireSignature([]byte(cfg.secret), handler)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/apply", handler)
+	mux.Handle("/metrics", metrics)
+	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/readyz", s.handleReady)
+
+	s.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: cfg.timeout,
+		ReadTimeout:       cfg.timeout,
+	}
+	return s
+}
+
+// Reports that the process is alive
+func (s *imageServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// Reports whether the server accepts new requests, failing once shutdown has begun
+func (s *imageServer) handleReady(w http.ResponseWriter, r *http.Request) {
+	if s.draining.Load() {
+		http.Error(w, msg("error.draining"), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// Turns a panic in a handler into a 500 response; responses are written in one piece
+// after processing, so a failure never leaves a client with a truncated image
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				printError(fmt.Errorf("%s: %v", r.URL.Path, p))
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Rejects requests with 429 while max requests are already being processed
+func limitConcurrency(max int, next http.Handler) http.Handler {
+	slots := make(chan struct{}, max)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			next.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, msg("error.too_many_requests"), http.StatusTooManyRequests)
+		}
+	})
+}
+
+// Rejects requests whose body is larger than max bytes with 413
+func limitBodySize(max int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > max {
+			http.Error(w, msg("error.body_too_large", max), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Rejects requests with 403 unless their "sig" query parameter is a valid signature of the URL
+func requireSignature(secret []byte, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sig, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("sig"))
+		if err != nil || !hmac.Equal(sig, signURL(secret, r.URL.Path, r.URL.RawQuery)) {
+			http.Error(w, msg("error.invalid_signature"), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Returns the HMAC-SHA256 of the path and the raw query with any "sig" parameter removed, as sent by the client
+func signURL(secret []byte, path, rawQuery string) []byte {
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param != "" && !strings.HasPrefix(param, "sig=") {
+			params = append(params, param)
+		}
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	io.WriteString(mac, path+"?"+strings.Join(params, "&"))
+	return mac.Sum(nil)
+}
+
+// Applies the "op" query parameters to the uploaded BMP and returns the result as BMP or, with ?format=png, PNG
+func (s *imageServer) handleApply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	options, err := queryOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Options that read files would expose the server's file system
+	for _, opt := range options {
+		if op, _ := findOperation(opt.Name); readsFiles(op) {
+			http.Error(w, msg("error.file_option", op.Name), http.StatusBadRequest)
+			return
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, msg("error.body_too_large", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, msg("error.read_body", err), http.StatusBadRequest)
+		return
+	}
+
+	format := "bmp"
+	if r.URL.Query().Get("format") == "png" {
+		format = "png"
+	}
+
+	// The same upload and pipeline always produce the same bytes, so the key doubles as an ETag
+	pipeline, err := globalSettings.pipelineHash(options, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	key := fmt.Sprintf("%x-%s", sha256.Sum256(body), pipeline)
+	if s.cache != nil {
+		if resp, ok := s.cache.get(key); ok {
+			s.writeResponse(w, r, resp, "HIT")
+			return
+		}
+	}
+
+	resp, err := renderResponse(body, options, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp.key = key
+	if s.cache != nil {
+		s.cache.put(resp)
+	}
+	s.writeResponse(w, r, resp, "MISS")
+}
+
+// Decodes the uploaded BMP, applies the options and encodes the result in format
+func renderResponse(body []byte, options []Option, format string) (*cachedResponse, error) {
+	bmpHeader, dibHeader, img, err := globalSettings.decodeImage(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if img, err = applyOptions(img, options); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	resp := &cachedResponse{contentType: "image/bmp"}
+	if format == "png" {
+		resp.contentType = "image/png"
+		err = png.Encode(&out, img.ToRGBA())
+	} else {
+		err = globalSettings.encodeImage(&out, bmpHeader, dibHeader, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp.data = out.Bytes()
+	return resp, nil
+}
+
+// Writes an encoded response with caching headers, or 304 when the client already has it
+func (s *imageServer) writeResponse(w http.ResponseWriter, r *http.Request, resp *cachedResponse, cacheStatus string) {
+	etag := `"` + resp.key + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int(s.cfg.cacheMaxAge.Seconds())))
+	if s.cache != nil {
+		w.Header().Set("X-Cache", cacheStatus)
+	}
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", resp.contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(resp.data)))
+	w.Write(resp.data)
+}
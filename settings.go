@@ -0,0 +1,29 @@
+package main
+
+import "creditcard/bmp"
+
+// Settings of the decoder: size limits, strict or permissive parsing and the image of a bitmap array
+type DecodeOptions = bmp.DecodeOptions
+
+// Settings of the encoder
+type EncodeOptions = bmp.EncodeOptions
+
+// Settings of the global flags that decide how sources are read and outputs written. Commands read and
+// write through them; apply takes them from its command, so that the daemon runs the request of each
+// client with the settings of that client while it serves others with other settings.
+type ioSettings struct {
+	Decode DecodeOptions `json:"decode"` // From --max-*, --strict, --permissive, --trust and --index
+	Encode EncodeOptions `json:"encode"` // From --keep-offset, --keep-orientation, --embed, --compact and --true-color
+	// Set by --isolate: files are decoded in a separate process with as few privileges as the system
+	// allows, which gets the bytes of the file on a pipe and sends the decoded image back the same way, so
+	// that a bug the decoder has with a crafted file cannot reach the files, network or memory of the run
+	Isolate bool `json:"isolate,omitempty"`
+	// Passphrases set by --encrypt, which wraps every output in an encrypted container, and by --decrypt,
+	// which opens sources given in one
+	Encrypt  string `json:"encrypt,omitempty"`
+	Decrypt  string `json:"decrypt,omitempty"`
+	PostHook string `json:"post_hook,omitempty"` // Command run after every output is written, set by --post-hook
+}
+
+// Settings the global flags of this process select
+var globalSettings ioSettings
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Images the shell keeps for undo and redo, the current one included; the oldest are dropped beyond it
+// so that editing a large file does not hold every step in memory
+const maxShellStates = 32
+
+// Image of the shell after a step, with the options that produced it from the previous one
+type shellState struct {
+	img     *Image
+	options []Option
+}
+
+// Editing session of the shell command
+type shellSession struct {
+	filename  string
+	bmpHeader *BMPHeader
+	dibHeader *DIBHeader
+	states    []shellState // Oldest first; the first holds the loaded image unless it was dropped
+	current   int          // Index of the state shown, lower than len(states)-1 after undo
+	dropped   [][]Option   // Options of the steps dropped from the start of states
+}
+
+// Loads an image once and reads commands from standard input: apply options, undo, redo, history,
+// preview, save and quit. Every option runs on the image in memory, so trying out chains on large files
+// does not decode and encode it again at every step.
+func runShell(args []string) error {
+	_, positional, err := parseCommandLine(args, nil, false)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return msgError("usage.shell")
+	}
+	bmpHeader, dibHeader, img, err := globalSettings.loadImage(positional[0])
+	if err != nil {
+		return err
+	}
+	s := &shellSession{filename: positional[0], bmpHeader: bmpHeader, dibHeader: dibHeader, states: []shellState{{img: img}}}
+	logInfo("info.shell_loaded", positional[0], img.Width, img.Height)
+
+	// The prompt is only shown to people typing, not to scripts piping commands in
+	interactive := false
+	if info, err := os.Stdin.Stat(); err == nil {
+		interactive = info.Mode()&os.ModeCharDevice != 0
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		if interactive {
+			fmt.Print("bitmap> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if line == "quit" || line == "exit" {
+			return nil
+		}
+		if err := s.run(line); err != nil {
+			printError(err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return msgError("error.read_input", err)
+	}
+	return nil
+}
+
+// Runs one command line of the shell
+func (s *shellSession) run(line string) error {
+	command, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+	switch command {
+	case "help":
+		fmt.Println(msg("help.shell_commands"))
+	case "undo":
+		if s.current == 0 {
+			return msgError("error.shell_undo")
+		}
+		s.current--
+		s.report()
+	case "redo":
+		if s.current == len(s.states)-1 {
+			return msgError("error.shell_redo")
+		}
+		s.current++
+		s.report()
+	case "history":
+		s.history()
+	case "save":
+		if rest == "" {
+			return msgError("error.shell_usage", "save <file>")
+		}
+		if err := globalSettings.saveOutput(rest, "", s.bmpHeader, s.dibHeader, s.states[s.current].img); err != nil {
+			return err
+		}
+		fmt.Println(msg("info.shell_saved", rest))
+	case "preview":
+		path := rest
+		if path == "" {
+			path = filepath.Join(os.TempDir(), "bitmap-preview.png")
+		}
+		if err := globalSettings.saveOutput(path, "", s.bmpHeader, s.dibHeader, s.states[s.current].img); err != nil {
+			return err
+		}
+		fmt.Println(msg("info.shell_preview", path))
+	default:
+		return s.apply(command, rest)
+	}
+	return nil
+}
+
+// Applies an option given as "name value" or as on the apply command line ("--name=value", "-m h"),
+// making the result the current image and discarding the steps that were undone
+func (s *shellSession) apply(command, value string) error {
+	args := strings.Fields(command + " " + value)
+	if !strings.HasPrefix(command, "-") {
+		if _, ok := findOperation(command); !ok {
+			return msgError("error.shell_command", command)
+		}
+		args = []string{"--" + command + "=" + value}
+	}
+	options, positional, err := parseCommandLine(args, nil, true)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 || len(options) == 0 {
+		return msgError("error.shell_command", command)
+	}
+	if options, err = resolveStamps(options, s.filename); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	img, err := applyOptions(s.states[s.current].img, options)
+	if err != nil {
+		return err
+	}
+	s.states = append(s.states[:s.current+1], shellState{img: img, options: options})
+	if len(s.states) > maxShellStates {
+		// The first state now holds the image after the dropped step
+		s.dropped = append(s.dropped, s.states[1].options)
+		s.states = s.states[1:]
+		s.states[0].options = nil
+	}
+	s.current = len(s.states) - 1
+	fmt.Println(msg("info.shell_applied", describeShellOptions(options), img.Width, img.Height, time.Since(start).Round(time.Millisecond)))
+	return nil
+}
+
+// Prints the size of the current image and how many steps can be undone and redone
+func (s *shellSession) report() {
+	img := s.states[s.current].img
+	fmt.Println(msg("info.shell_state", img.Width, img.Height, s.current, len(s.states)-1-s.current))
+}
+
+// Prints the steps applied so far, those undone marked as such, and the apply command that repeats the
+// applied ones
+func (s *shellSession) history() {
+	var applied []Option
+	for i, options := range s.dropped {
+		applied = append(applied, options...)
+		fmt.Printf("%3d  %s\n", i+1, describeShellOptions(options))
+	}
+	n := len(s.dropped)
+	for i, state := range s.states[1:] {
+		mark := ""
+		if i+1 > s.current {
+			mark = " " + msg("info.shell_undone")
+		} else {
+			applied = append(applied, state.options...)
+		}
+		n++
+		fmt.Printf("%3d  %s%s\n", n, describeShellOptions(state.options), mark)
+	}
+	if len(applied) == 0 {
+		fmt.Println(msg("info.shell_no_steps"))
+		return
+	}
+	fmt.Println(buildApplyCommand(applied, s.filename, "output.bmp"))
+}
+
+// Formats options as they are written on the command line, e.g. --filter=grayscale --rotate=90
+func describeShellOptions(options []Option) string {
+	parts := make([]string, len(options))
+	for i, opt := range options {
+		parts[i] = opt.Name + "=" + opt.Value
+	}
+	return strings.Join(parts, " ")
+}
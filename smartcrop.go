@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+
+	"creditcard/bmp"
+)
+
+// A region of interest given by --hints, in pixels from the top-left corner
+type hintBox = bmp.Hint
+
+// Reads the --hints file: a JSON array of boxes
+func readHints(filename string) ([]hintBox, error) {
+	data, err := readFile(filename)
+	if err != nil {
+		return nil, msgError("error.open_file", err)
+	}
+	var hints []hintBox
+	if err := json.Unmarshal(data, &hints); err != nil {
+		return nil, msgError("error.read_hints", filename, err)
+	}
+	for i := range hints {
+		if hints[i].Width <= 0 || hints[i].Height <= 0 || hints[i].Weight < 0 {
+			return nil, msgError("error.invalid_hint", filename, i+1)
+		}
+		if hints[i].Weight == 0 {
+			hints[i].Weight = 1
+		}
+	}
+	// An empty list is kept non-nil so that it still replaces earlier hints
+	if hints == nil {
+		hints = []hintBox{}
+	}
+	return hints, nil
+}
+
+// Returns how much of the hinted regions a window covers: the weighted fraction of each box inside it
+func hintCoverage(hints []hintBox, x, y, width, height int) float64 {
+	var coverage float64
+	for _, box := range hints {
+		w := min(x+width, box.X+box.Width) - max(x, box.X)
+		h := min(y+height, box.Y+box.Height) - max(y, box.Y)
+		if w > 0 && h > 0 {
+			coverage += box.Weight * float64(w*h) / float64(box.Width*box.Height)
+		}
+	}
+	return coverage
+}
+
+// Parses a --smartcrop value of the form WxH
+func parseSmartCrop(value string) (width, height int, err error) {
+	width, height, ok := parseSize(value)
+	if !ok {
+		return 0, 0, msgError("error.invalid_smartcrop", value)
+	}
+	return width, height, nil
+}
+
+// Crops a window of the given size where the image has the most edge energy, the sum of luminance
+// differences between neighboring pixels. The centered window is kept unless another one is busier.
+// Regions of interest from --hints take precedence: the window covering the most of them wins.
+func applySmartCrop(img *Image, cropWidth, cropHeight int, progress rowProgress) (*Image, error) {
+	if cropWidth > img.Width || cropHeight > img.Height {
+		return nil, msgError("error.smartcrop_bounds", cropWidth, cropHeight, img.Width, img.Height)
+	}
+
+	// Summed-area table of the energy, with an extra zero row and column so any window sum takes four lookups
+	w, h := img.Width, img.Height
+	sums := make([]int64, (w+1)*(h+1))
+	for y := 0; y < h; y++ {
+		var row int64
+		for x := 0; x < w; x++ {
+			l := img.Pixels[y*w+x].Luminance()
+			var energy int
+			if x+1 < w {
+				energy += abs(img.Pixels[y*w+x+1].Luminance() - l)
+			}
+			if y+1 < h {
+				energy += abs(img.Pixels[(y+1)*w+x].Luminance() - l)
+			}
+			row += int64(energy)
+			sums[(y+1)*(w+1)+x+1] = sums[y*(w+1)+x+1] + row
+		}
+		progress.Report(y+1, h)
+	}
+	window := func(x, y int) int64 {
+		x2, y2 := x+cropWidth, y+cropHeight
+		return sums[y2*(w+1)+x2] - sums[y*(w+1)+x2] - sums[y2*(w+1)+x] + sums[y*(w+1)+x]
+	}
+
+	// Hints are measured from the top while rows are stored bottom-up
+	coverage := func(x, y int) float64 {
+		return hintCoverage(img.Hints, x, h-y-cropHeight, cropWidth, cropHeight)
+	}
+
+	// Coverage of the hinted regions decides first, energy breaks ties
+	bestX, bestY := (w-cropWidth)/2, (h-cropHeight)/2
+	best, bestCoverage := window(bestX, bestY), coverage(bestX, bestY)
+	for y := 0; y <= h-cropHeight; y++ {
+		for x := 0; x <= w-cropWidth; x++ {
+			e, c := window(x, y), coverage(x, y)
+			if c > bestCoverage || (c == bestCoverage && e > best) {
+				best, bestCoverage, bestX, bestY = e, c, x, y
+			}
+		}
+	}
+	offsetY := h - bestY - cropHeight
+	result := &Image{Width: cropWidth, Height: cropHeight, Pixels: bmp.CropPixels(img.Pixels, w, h, bestX, offsetY, cropWidth, cropHeight, nil)}
+	if img.Alpha != nil {
+		result.Alpha = bmp.CropPixels(img.Alpha, w, h, bestX, offsetY, cropWidth, cropHeight, nil)
+	}
+	return result, nil
+}
+
+// Returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
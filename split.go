@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"regexp"
+	"slices"
+	"strings"
+
+	"creditcard/bmp"
+)
+
+// A strip file name pattern: one integer verb, optionally zero-padded, such as %d or %03d. Literal percent
+// signs are written %%.
+var stripVerb = regexp.MustCompile(`%0?[0-9]*d`)
+
+// Validates a split output pattern
+func checkStripPattern(value string) error {
+	rest := strings.ReplaceAll(value, "%%", "")
+	if strings.Count(rest, "%") != 1 || !stripVerb.MatchString(rest) {
+		return msgError("expect.strip_pattern")
+	}
+	return nil
+}
+
+// Divides an image into horizontal strips of --rows rows, numbered from 1 down from the top, and writes
+// each to a file named by the pattern. The last strip holds the rows that remain. With --split-pages, a
+// book scan is divided into its left and right page instead, numbered 1 and 2.
+func runSplit(args []string) error {
+	rows := 1024
+	pages := false
+	flags := []flagSpec{
+		{Name: "rows", Target: &rows, Min: 1},
+		{Name: "split-pages", Target: &pages},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return msgError("usage.split")
+	}
+	source, pattern := positional[0], positional[1]
+	if err := checkStripPattern(pattern); err != nil {
+		return msgError("error.invalid_strip_pattern", pattern, err)
+	}
+
+	bmpHeader, dibHeader, img, err := globalSettings.loadImage(source)
+	if err != nil {
+		return err
+	}
+	var areas []image.Rectangle
+	if pages {
+		left, right, ok := findPages(img)
+		if !ok {
+			return msgError("error.no_gutter", source)
+		}
+		logDetail("info.split_pages", left.Max.X, right.Min.X)
+		areas = []image.Rectangle{left, right}
+	} else {
+		for top := 0; top < img.Height; top += rows {
+			areas = append(areas, image.Rect(0, top, img.Width, min(top+rows, img.Height)))
+		}
+	}
+	for i, area := range areas {
+		strip := areaImage(img, area)
+		name := fmt.Sprintf(pattern, i+1)
+		if err := globalSettings.saveOutput(name, "", bmpHeader, dibHeader, strip); err != nil {
+			return err
+		}
+		// Readers take a 32-bit file whose alpha bytes are all zero for one that leaves them unused
+		if strip.Alpha != nil && !slices.ContainsFunc(strip.Alpha, func(a byte) bool { return a != 0 }) {
+			printWarning(msgError("warning.strip_transparent", name))
+		}
+	}
+	return nil
+}
+
+// Returns an area of an image, from its top-left corner, with the color table and indices of an indexed
+// image, so that the area is written in the same format
+func areaImage(img *Image, area image.Rectangle) *Image {
+	x, y, width, height := area.Min.X, area.Min.Y, area.Dx(), area.Dy()
+	strip := &Image{
+		Width:   width,
+		Height:  height,
+		Pixels:  bmp.CropPixels(img.Pixels, img.Width, img.Height, x, y, width, height, nil),
+		Palette: img.Palette,
+		Profile: img.Profile,
+	}
+	if img.Alpha != nil {
+		strip.Alpha = bmp.CropPixels(img.Alpha, img.Width, img.Height, x, y, width, height, nil)
+	}
+	if len(img.Indices) == len(img.Pixels) {
+		strip.Indices = bmp.CropPixels(img.Indices, img.Width, img.Height, x, y, width, height, nil)
+	}
+	return strip
+}
+
+// Stacks strips of the same width, given from the top down, back into one image. Strips that share a
+// color table are joined as an indexed image with it, and alpha is kept when any strip has it.
+func runJoin(args []string) error {
+	if len(args) < 2 {
+		return msgError("usage.join")
+	}
+	inputs, output := args[:len(args)-1], args[len(args)-1]
+
+	var bmpHeader *BMPHeader
+	var dibHeader *DIBHeader
+	strips := make([]*Image, len(inputs))
+	height, indexed, alpha := 0, true, false
+	for i, input := range inputs {
+		header, dib, img, err := globalSettings.loadImage(input)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			bmpHeader, dibHeader = header, dib
+			strips[0] = img
+		} else if img.Width != strips[0].Width {
+			return msgError("error.strip_width", input, img.Width, strips[0].Width)
+		}
+		indexed = indexed && len(img.Indices) == len(img.Pixels) && slices.Equal(img.Palette, strips[0].Palette)
+		alpha = alpha || img.Alpha != nil
+		height += img.Height
+		strips[i] = img
+	}
+
+	result := &Image{Width: strips[0].Width, Height: height, Profile: strips[0].Profile}
+	if indexed {
+		result.Palette = strips[0].Palette
+	}
+	// Rows are stored bottom-up, so the bottom strip comes first
+	for i := len(strips) - 1; i >= 0; i-- {
+		img := strips[i]
+		result.Pixels = append(result.Pixels, img.Pixels...)
+		if indexed {
+			result.Indices = append(result.Indices, img.Indices...)
+		}
+		if alpha {
+			if img.Alpha != nil {
+				result.Alpha = append(result.Alpha, img.Alpha...)
+			} else {
+				result.Alpha = append(result.Alpha, bytes.Repeat([]byte{255}, len(img.Pixels))...)
+			}
+		}
+	}
+	return globalSettings.saveOutput(output, "", bmpHeader, dibHeader, result)
+}
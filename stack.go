@@ -0,0 +1,196 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Methods of the stack command: a mean of the frames, evenly or by --weights, or the lightest or darkest
+// level of every channel
+var stackMethods = []string{"mean", "weighted", "max", "min"}
+
+// Shapes of --weights over the frames, from the first to the last
+var stackWeightShapes = []string{"flat", "gauss", "ramp"}
+
+// Settings of the stack command
+type stackConfig struct {
+	method  string
+	weights string
+	frames  []string
+	output  string
+}
+
+// Parses the arguments of the stack command
+func parseStackArgs(args []string) (*stackConfig, error) {
+	cfg := &stackConfig{method: "mean", weights: "gauss"}
+	flags := []flagSpec{
+		{Name: "method", Target: &cfg.method, Choices: stackMethods},
+		{Name: "weights", Target: &cfg.weights, Check: checkStackWeights},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) < 2 {
+		return nil, msgError("usage.stack")
+	}
+	cfg.frames, cfg.output = positional[:len(positional)-1], positional[len(positional)-1]
+	return cfg, nil
+}
+
+// Validates a --weights value: flat, gauss with an optional width in frames, ramp, or one weight per
+// frame separated by commas, none negative and not all 0
+func checkStackWeights(value string) error {
+	shape, width, found := strings.Cut(value, ",")
+	switch {
+	case shape == "gauss" && found:
+		if sigma, err := strconv.ParseFloat(width, 64); err != nil || !(sigma > 0) || math.IsInf(sigma, 1) {
+			return msgError("expect.stack_weights")
+		}
+		return nil
+	case contains(stackWeightShapes, value):
+		return nil
+	}
+	total := 0.0
+	for _, field := range strings.Split(value, ",") {
+		weight, err := strconv.ParseFloat(field, 64)
+		if err != nil || !(weight >= 0) || math.IsInf(weight, 1) {
+			return msgError("expect.stack_weights")
+		}
+		total += weight
+	}
+	if total == 0 {
+		return msgError("expect.stack_weights")
+	}
+	return nil
+}
+
+// Returns the weight of each of count frames by a --weights value. gauss centers a bell curve on the
+// middle frame, a quarter of the frames wide unless a width is given, and ramp rises evenly to the last
+// frame, so that moving things leave trails that fade toward where they started.
+func stackWeights(value string, count int) ([]float64, error) {
+	weights := make([]float64, count)
+	shape, width, found := strings.Cut(value, ",")
+	switch {
+	case value == "flat":
+		for i := range weights {
+			weights[i] = 1
+		}
+	case value == "ramp":
+		for i := range weights {
+			weights[i] = float64(i + 1)
+		}
+	case shape == "gauss":
+		sigma := max(float64(count)/4, 0.5)
+		if found {
+			sigma, _ = strconv.ParseFloat(width, 64)
+		}
+		center := float64(count-1) / 2
+		for i := range weights {
+			d := (float64(i) - center) / sigma
+			weights[i] = math.Exp(-d * d / 2)
+		}
+	default:
+		fields := strings.Split(value, ",")
+		if len(fields) != count {
+			return nil, msgError("error.stack_weight_count", len(fields), count)
+		}
+		for i, field := range fields {
+			weights[i], _ = strconv.ParseFloat(field, 64)
+		}
+	}
+	return weights, nil
+}
+
+// Combines frames of the same size, such as those frames writes from a video, into one image. Means are
+// taken in linear light, as a long exposure gathers it, so that a weighted mean over a sequence blurs
+// moving things as a slow shutter would; max keeps the lightest level of every channel, as for star
+// trails, and min the darkest. Frames are read one at a time, so sequences of any length fit in memory.
+func runStack(args []string) error {
+	cfg, err := parseStackArgs(args)
+	if err != nil {
+		return err
+	}
+	weights := make([]float64, len(cfg.frames))
+	switch cfg.method {
+	case "mean":
+		weights, _ = stackWeights("flat", len(cfg.frames))
+	case "weighted":
+		if weights, err = stackWeights(cfg.weights, len(cfg.frames)); err != nil {
+			return err
+		}
+	}
+
+	var bmpHeader *BMPHeader
+	var dibHeader *DIBHeader
+	var first *Image
+	// Sums of the linear channels weighted by weight and alpha, and of those weights
+	var sums [][3]float64
+	var covered []float64
+	var result *Image
+	alpha := false
+	for i, name := range cfg.frames {
+		header, dib, img, err := globalSettings.loadImage(name)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			bmpHeader, dibHeader, first = header, dib, img
+			sums, covered = make([][3]float64, len(img.Pixels)), make([]float64, len(img.Pixels))
+			result = &Image{Width: img.Width, Height: img.Height, Pixels: make([]Pixel, len(img.Pixels)), Alpha: make([]byte, len(img.Pixels))}
+			copy(result.Pixels, img.Pixels)
+			for j := range result.Alpha {
+				result.Alpha[j] = 255
+			}
+			if img.Alpha != nil {
+				copy(result.Alpha, img.Alpha)
+			}
+		} else if img.Width != first.Width || img.Height != first.Height {
+			return msgError("error.stack_size", name, img.Width, img.Height, first.Width, first.Height)
+		}
+		alpha = alpha || img.Alpha != nil
+		for j, p := range img.Pixels {
+			a := byte(255)
+			if img.Alpha != nil {
+				a = img.Alpha[j]
+			}
+			switch cfg.method {
+			case "max":
+				q := &result.Pixels[j]
+				q.Red, q.Green, q.Blue = max(q.Red, p.Red), max(q.Green, p.Green), max(q.Blue, p.Blue)
+				result.Alpha[j] = max(result.Alpha[j], a)
+			case "min":
+				q := &result.Pixels[j]
+				q.Red, q.Green, q.Blue = min(q.Red, p.Red), min(q.Green, p.Green), min(q.Blue, p.Blue)
+				result.Alpha[j] = min(result.Alpha[j], a)
+			default:
+				w := weights[i] * float64(a) / 255
+				sums[j][0] += w * srgbToLinear(p.Red)
+				sums[j][1] += w * srgbToLinear(p.Green)
+				sums[j][2] += w * srgbToLinear(p.Blue)
+				covered[j] += w
+			}
+		}
+		logDetail("info.stack_frame", i+1, len(cfg.frames), name)
+	}
+
+	if cfg.method == "mean" || cfg.method == "weighted" {
+		weightSum := 0.0
+		for _, w := range weights {
+			weightSum += w
+		}
+		// Alpha is the weighted mean of the frames' alpha, and colors are the mean of the frames that cover
+		// the pixel
+		for j, s := range sums {
+			result.Alpha[j] = byte(math.Round(covered[j] / weightSum * 255))
+			if covered[j] > 0 {
+				result.Pixels[j] = Pixel{Red: linearToSRGB(s[0] / covered[j]), Green: linearToSRGB(s[1] / covered[j]), Blue: linearToSRGB(s[2] / covered[j])}
+			}
+		}
+	}
+	if !alpha {
+		result.Alpha = nil
+	}
+	return globalSettings.saveOutput(cfg.output, "", bmpHeader, dibHeader, result)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Corners --stamp draws its text in
+var stampCorners = []string{"bottom-right", "bottom-left", "top-right", "top-left"}
+
+// Layout of {mtime} when none is given
+const defaultStampLayout = "2006-01-02 15:04:05"
+
+// Matches {field} and {field:layout} placeholders in --stamp text
+var stampField = regexp.MustCompile(`\{([a-z]+)(?::([^}]*))?\}`)
+
+// Placeholders --stamp text may use
+var stampFields = []string{"filename", "stem", "mtime"}
+
+// Parses a --stamp value of the form [corner:]text, checking that its placeholders are known
+func parseStamp(value string) (corner, text string, err error) {
+	corner, text = "bottom-right", value
+	if c, t, found := strings.Cut(value, ":"); found && slices.Contains(stampCorners, c) {
+		corner, text = c, t
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", "", msgError("error.invalid_stamp", value)
+	}
+	for _, field := range stampField.FindAllStringSubmatch(text, -1) {
+		if !slices.Contains(stampFields, field[1]) {
+			return "", "", msgError("error.stamp_field", field[0])
+		}
+	}
+	return corner, text, nil
+}
+
+// Fills in the placeholders of every --stamp option from the source file: its name, the name without the
+// extension and its modification time, formatted with a Go time layout. Standard input and URLs have no
+// file, so their time is the current one. With --deterministic the time comes from deterministicTime instead. Other
+// options are returned as they are.
+func resolveStamps(options []Option, input string) ([]Option, error) {
+	var resolved []Option
+	for i, opt := range options {
+		if opt.Name != "--stamp" {
+			continue
+		}
+		corner, text, err := parseStamp(opt.Value)
+		if err != nil {
+			return nil, err
+		}
+		modified := time.Now()
+		if deterministic {
+			if modified, err = deterministicTime(); err != nil {
+				return nil, err
+			}
+		} else if input != "-" && !isRemoteSource(input) {
+			info, err := files.Stat(input)
+			if err != nil {
+				return nil, msgError("error.open_file", err)
+			}
+			modified = info.ModTime()
+		}
+		name := filepath.Base(input)
+		text = stampField.ReplaceAllStringFunc(text, func(field string) string {
+			parts := stampField.FindStringSubmatch(field)
+			switch parts[1] {
+			case "filename":
+				return name
+			case "stem":
+				return strings.TrimSuffix(name, filepath.Ext(name))
+			}
+			layout := parts[2]
+			if layout == "" {
+				layout = defaultStampLayout
+			}
+			return modified.Format(layout)
+		})
+		if resolved == nil {
+			resolved = slices.Clone(options)
+		}
+		// The corner is always spelled out, so that text starting like one is not taken for it
+		resolved[i].Value = corner + ":" + text
+	}
+	if resolved == nil {
+		return options, nil
+	}
+	return resolved, nil
+}
+
+// Burns a line of text into a corner of the image in white on a black box, as security cameras stamp
+// their frames. Letters grow with the image, one font pixel per 240 pixels of its shorter side, and text
+// wider than the image is cut off at the far edge.
+func applyStamp(img *Image, corner, text string) *Image {
+	scale := max(min(img.Width, img.Height)/240, 1)
+	pad := 2 * scale
+	boxWidth := min(textWidth(text, scale)+2*pad, img.Width)
+	boxHeight := min(glyphHeight*scale+2*pad, img.Height)
+	x, y := 0, 0
+	if strings.HasSuffix(corner, "right") {
+		x = img.Width - boxWidth
+	}
+	if strings.HasPrefix(corner, "bottom") {
+		y = img.Height - boxHeight
+	}
+
+	result := *img
+	result.Indices = nil
+	result.Pixels = slices.Clone(img.Pixels)
+	result.Alpha = slices.Clone(img.Alpha)
+	box := make([]bool, len(img.Pixels))
+	for by := y; by < y+boxHeight; by++ {
+		for bx := x; bx < x+boxWidth; bx++ {
+			box[by*img.Width+bx] = true
+		}
+	}
+	paintMask(&result, box, Pixel{})
+	mask := make([]bool, len(img.Pixels))
+	stampText(mask, img.Width, img.Height, x+pad, y+pad, text, scale)
+	// Text that does not fit is cut off where the box ends
+	for i := range mask {
+		mask[i] = mask[i] && box[i]
+	}
+	paintMask(&result, mask, Pixel{Blue: 255, Green: 255, Red: 255})
+	return &result
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+)
+
+// Default name of the batch state file, kept in the output directory
+const defaultStateFile = ".bitmap-state.jsonl"
+
+// Records how one input file was last processed
+type stateEntry struct {
+	Input      string `json:"input"`
+	InputHash  string `json:"input_hash"`
+	Pipeline   string `json:"pipeline"`
+	Output     string `json:"output"`
+	OutputSize int64  `json:"output_size"`
+}
+
+// Incremental batch state: one JSON entry per line, later lines replace earlier ones. It is kept on the
+// file system of sources and outputs, as the outputs it records are.
+type batchState struct {
+	path    string
+	entries map[string]stateEntry // keyed by input path
+	file    io.WriteCloser
+}
+
+// Loads the state file if it exists and opens it for appending new entries
+func loadBatchState(path string) (*batchState, error) {
+	s := &batchState{path: path, entries: make(map[string]stateEntry)}
+
+	if file, err := files.Open(path); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var entry stateEntry
+			// A torn last line from an interrupted run is ignored
+			if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry.Input != "" {
+				s.entries[entry.Input] = entry
+			}
+		}
+		file.Close()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, msgError("error.read_state", err)
+	}
+
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reports whether the recorded output for input is current for the given input and pipeline hashes
+func (s *batchState) upToDate(input, inputHash, pipeline string) (stateEntry, bool) {
+	entry, ok := s.completed(input, pipeline)
+	return entry, ok && entry.InputHash == inputHash
+}
+
+// Reports whether an output for input was written with the given pipeline and is still present
+func (s *batchState) completed(input, pipeline string) (stateEntry, bool) {
+	entry, ok := s.entries[input]
+	if !ok || entry.Pipeline != pipeline {
+		return entry, false
+	}
+	info, err := files.Stat(entry.Output)
+	if err != nil || info.Size() != entry.OutputSize {
+		return entry, false
+	}
+	return entry, true
+}
+
+// Appends an entry to the state file
+func (s *batchState) record(entry stateEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return msgError("error.write_state", err)
+	}
+	s.entries[entry.Input] = entry
+	return nil
+}
+
+// Rewrites the state file with one line per input and reopens it for appending
+func (s *batchState) compact() error {
+	if s.file != nil {
+		s.file.Close()
+	}
+
+	inputs := make([]string, 0, len(s.entries))
+	for input := range s.entries {
+		inputs = append(inputs, input)
+	}
+	sort.Strings(inputs)
+
+	var b bytes.Buffer
+	for _, input := range inputs {
+		data, _ := json.Marshal(s.entries[input])
+		b.Write(data)
+		b.WriteByte('\n')
+	}
+
+	// Replaced whole so that an interruption never loses the old state
+	if err := files.MkdirAll(filepath.Dir(s.path)); err != nil {
+		return msgError("error.write_state", err)
+	}
+	if err := replaceFile(s.path, b.Bytes()); err != nil {
+		return msgError("error.write_state", err)
+	}
+	file, err := appendFile(s.path)
+	if err != nil {
+		return msgError("error.write_state", err)
+	}
+	s.file = file
+	return nil
+}
+
+// Compacts the state file and closes it
+func (s *batchState) close() error {
+	if err := s.compact(); err != nil {
+		return err
+	}
+	return s.file.Close()
+}
+
+// Returns the SHA-256 of a file's contents in hex
+func hashFile(path string) (string, error) {
+	file, err := globalSettings.openInput(path)
+	if err != nil {
+		return "", msgError("error.open_file", err)
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", msgError("error.open_file", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Returns a hash identifying an option chain and how its output is written, such as the naming template
+// of a batch run or the format of a server response. Like the keys of the output cache it covers the build
+// and the global settings that change the bytes written, so that a run changing either is not taken for
+// an earlier one.
+func (s *ioSettings) pipelineHash(options []Option, output string) (string, error) {
+	version, err := executableHash()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	io.WriteString(h, version+"\x00")
+	for _, opt := range options {
+		io.WriteString(h, opt.Name+"="+opt.Value+"\x00")
+	}
+	io.WriteString(h, s.outputSettings()+"\x00name-template="+output)
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+)
+
+// Every global setting that changes the written bytes changes the hash, so that incremental runs redo
+// the outputs it affects
+func TestPipelineHashSettings(t *testing.T) {
+	options := []Option{{Name: "--filter", Value: "grayscale"}}
+	base, err := globalSettings.pipelineHash(options, "{name}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedDecode, savedEncode, savedBackground := globalSettings.Decode, globalSettings.Encode, background
+	savedStraight, savedDeterministic, savedEncrypt := straightAlpha, deterministic, globalSettings.Encrypt
+	defer func() {
+		globalSettings.Decode, globalSettings.Encode, background = savedDecode, savedEncode, savedBackground
+		straightAlpha, deterministic, globalSettings.Encrypt = savedStraight, savedDeterministic, savedEncrypt
+	}()
+
+	changes := []struct {
+		name   string
+		change func()
+	}{
+		{"--compact", func() { globalSettings.Encode.Compact = true }},
+		{"--embed", func() { globalSettings.Encode.Embed = "png" }},
+		{"--keep-offset", func() { globalSettings.Encode.KeepOffset = true }},
+		{"--true-color", func() { globalSettings.Encode.TrueColor = true }},
+		{"--trust", func() { globalSettings.Decode.Trust = "data" }},
+		{"--index", func() { globalSettings.Decode.Index = 1 }},
+		{"--strict", func() { globalSettings.Decode.Mode = "strict" }},
+		{"--background", func() { background = &Pixel{Red: 255} }},
+		{"--straight-alpha", func() { straightAlpha = true }},
+		{"--deterministic", func() { deterministic = true }},
+		{"--encrypt", func() { globalSettings.Encrypt = "secret" }},
+	}
+	for _, c := range changes {
+		globalSettings.Decode, globalSettings.Encode, background = DecodeOptions{}, EncodeOptions{}, nil
+		straightAlpha, deterministic, globalSettings.Encrypt = false, false, ""
+		c.change()
+		got, err := globalSettings.pipelineHash(options, "{name}")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == base {
+			t.Errorf("%s leaves the pipeline hash unchanged", c.name)
+		}
+	}
+}
+
+// The state is read and written through the file system of sources and outputs
+func TestBatchStateFileSystem(t *testing.T) {
+	memory := NewMemoryFileSystem()
+	memory.WriteFile("out/a.bmp", []byte("BM"))
+	SetFileSystem(memory)
+	defer SetFileSystem(osFileSystem{})
+
+	state, err := loadBatchState("out/.bitmap-state.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := stateEntry{Input: "in/a.bmp", InputHash: "1", Pipeline: "p", Output: "out/a.bmp", OutputSize: 2}
+	if err := state.record(entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = loadBatchState("out/.bitmap-state.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.close()
+	if _, ok := state.upToDate("in/a.bmp", "1", "p"); !ok {
+		t.Errorf("recorded output is not up to date after reloading: %+v", state.entries)
+	}
+	if _, ok := state.upToDate("in/a.bmp", "1", "q"); ok {
+		t.Error("output is up to date for another pipeline")
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// File name that stands for standard input as a source and for standard output as an output
+const stdioName = "-"
+
+// Set by batch, daemon and rpc, which run alongside other invocations over the same files: sources are
+// opened with shared locks and outputs with exclusive ones, so that no run reads a file another one is
+// halfway through writing, and two runs never write the same file at once. Only files of the operating
+// system's file system are locked.
+var lockFiles bool
+
+// Sources that cannot seek, such as standard input, pipes and process substitutions, read whole the first
+// time they are opened. The mutex guards the maps only: opening a source holds the lock of its name, so
+// that a source waiting for a file lock or a slow server holds up runs opening it again, which would wait
+// all the same, and no others.
+var buffered struct {
+	sync.Mutex
+	data map[string][]byte
+	// Sources in encrypted containers, opened, kept while a reader of them is open, by name and passphrase
+	decrypted map[string]*decryptedSource
+	// Locks of the names being opened, dropped when no one holds or waits for them
+	opening map[string]*nameLock
+}
+
+// Lock of a source name and the number of openers holding or waiting for it
+type nameLock struct {
+	sync.Mutex
+	users int
+}
+
+// Locks a source name for opening it, returning the function that unlocks it
+func lockName(filename string) (unlock func()) {
+	buffered.Lock()
+	lock := buffered.opening[filename]
+	if lock == nil {
+		if buffered.opening == nil {
+			buffered.opening = make(map[string]*nameLock)
+		}
+		lock = &nameLock{}
+		buffered.opening[filename] = lock
+	}
+	lock.users++
+	buffered.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		buffered.Lock()
+		if lock.users--; lock.users == 0 {
+			delete(buffered.opening, filename)
+		}
+		buffered.Unlock()
+	}
+}
+
+// Returns what a map of buffered holds for a source
+func bufferedData(m map[string][]byte, filename string) ([]byte, bool) {
+	buffered.Lock()
+	defer buffered.Unlock()
+	data, ok := m[filename]
+	return data, ok
+}
+
+// Contents of an encrypted source and the number of its readers that are open
+type decryptedSource struct {
+	data  []byte
+	users int
+}
+
+// Reader of a decrypted source. Closing the last reader of a source drops its contents, so that the
+// plaintext stays in memory no longer than the source is read; opening it again derives no key, as
+// decryptContainer keeps the keys of the containers it opened last.
+type decryptedFile struct {
+	*bytes.Reader
+	key    string // Of the source in buffered.decrypted
+	source *decryptedSource
+	closed bool
+}
+
+// Returns a reader of a decrypted source, counting it among the readers of the source; called with the
+// mutex of buffered held
+func openDecrypted(key string, source *decryptedSource) *decryptedFile {
+	source.users++
+	return &decryptedFile{Reader: bytes.NewReader(source.data), key: key, source: source}
+}
+
+func (f *decryptedFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	buffered.Lock()
+	defer buffered.Unlock()
+	if f.source.users--; f.source.users == 0 && buffered.decrypted[f.key] == f.source {
+		delete(buffered.decrypted, f.key)
+	}
+	return nil
+}
+
+// Wraps a reader of data held in memory as a file that needs no closing
+type memoryFile struct {
+	*bytes.Reader
+}
+
+func (memoryFile) Close() error { return nil }
+
+// Opens a source file of the file system of sources and outputs, standard input for "-", or an http://
+// or https:// URL, read in blocks as decoding reaches them. Decoding seeks back and forth and several
+// readers go through the same source, so sources that are not regular files, or that cannot seek, are
+// read into memory once and served from there. Sources in an encrypted container are opened with the
+// passphrase of --decrypt and served from memory as well, while any reader of them is open, to runs
+// that give the same passphrase.
+func (s *ioSettings) openInput(filename string) (io.ReadSeekCloser, error) {
+	unlock := lockName(filename)
+	defer unlock()
+	key := filename + "\x00" + s.Decrypt
+	buffered.Lock()
+	if source, ok := buffered.decrypted[key]; ok {
+		defer buffered.Unlock()
+		return openDecrypted(key, source), nil
+	}
+	buffered.Unlock()
+	file, err := s.openRaw(filename)
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, len(cryptMagic))
+	n, _ := io.ReadFull(file, magic)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if !isEncrypted(magic[:n]) {
+		return file, nil
+	}
+	defer file.Close()
+	if s.Decrypt == "" {
+		return nil, msgError("error.encrypted", filename)
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = decryptContainer(data, s.Decrypt); err != nil {
+		return nil, err
+	}
+	buffered.Lock()
+	defer buffered.Unlock()
+	if buffered.decrypted == nil {
+		buffered.decrypted = make(map[string]*decryptedSource)
+	}
+	source := &decryptedSource{data: data}
+	buffered.decrypted[key] = source
+	return openDecrypted(key, source), nil
+}
+
+// Opens a source as openInput does, but as it is stored, without opening encrypted containers
+func (s *ioSettings) openRawInput(filename string) (io.ReadSeekCloser, error) {
+	unlock := lockName(filename)
+	defer unlock()
+	return s.openRaw(filename)
+}
+
+// Opens a source as it is stored; the caller holds the lock of its name
+func (s *ioSettings) openRaw(filename string) (io.ReadSeekCloser, error) {
+	if data, ok := bufferedData(buffered.data, filename); ok {
+		return memoryFile{bytes.NewReader(data)}, nil
+	}
+	if isRemoteSource(filename) {
+		return openRemote(filename, s.Decode.MaxFileSize)
+	}
+
+	var file fs.File = os.Stdin
+	if filename != stdioName {
+		var err error
+		if file, err = files.Open(filename); err != nil {
+			return nil, err
+		}
+		info, err := file.Stat()
+		if seeker, ok := file.(io.ReadSeekCloser); ok && (err != nil || info.Mode().IsRegular()) {
+			if osFile, ok := file.(*os.File); ok {
+				if err := waitForLock(osFile, filename, false); err != nil {
+					file.Close()
+					return nil, err
+				}
+			}
+			return seeker, nil
+		}
+		defer file.Close()
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	buffered.Lock()
+	if buffered.data == nil {
+		buffered.data = make(map[string][]byte)
+	}
+	buffered.data[filename] = data
+	buffered.Unlock()
+	return memoryFile{bytes.NewReader(data)}, nil
+}
+
+// Standard output as an output file; closing it leaves standard output open for the rest of the run
+type stdoutFile struct {
+	*os.File
+}
+
+func (stdoutFile) Close() error { return nil }
+
+// Creates an output file of the file system of sources and outputs, or returns standard output for "-".
+// With --encrypt, what is written is sealed in an encrypted container when the output is closed.
+func (s *ioSettings) createOutput(filename string) (io.WriteCloser, error) {
+	out, err := createPlainOutput(filename)
+	if err != nil || s.Encrypt == "" {
+		return out, err
+	}
+	return &encryptingWriter{out: out, passphrase: s.Encrypt}, nil
+}
+
+// Creates an output as createOutput does, without encrypting it
+func createPlainOutput(filename string) (io.WriteCloser, error) {
+	if filename == stdioName {
+		return stdoutFile{os.Stdout}, nil
+	}
+	if !lockFiles || !onOSFileSystem() {
+		return files.Create(filename)
+	}
+	// Truncating before the lock is held would cut a file short under a run that is reading it
+	file, err := os.OpenFile(nativePath(filename), os.O_WRONLY|os.O_CREATE, 0o666)
+	if err != nil {
+		return nil, err
+	}
+	if err := waitForLock(file, filename, true); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// Locks a file when lockFiles is set, shared for a source and exclusive for an output, waiting as long as
+// another run holds a conflicting lock. The lock is released when the file is closed. Failures read like
+// those of opening the file, which callers report.
+func waitForLock(file *os.File, filename string, exclusive bool) error {
+	if !lockFiles {
+		return nil
+	}
+	locked, err := tryLockFile(file, exclusive)
+	if err == nil && !locked {
+		logDetail("info.lock_wait", filename)
+		err = lockFile(file, exclusive)
+	}
+	if err != nil {
+		return &os.PathError{Op: "lock", Path: filename, Err: err}
+	}
+	return nil
+}
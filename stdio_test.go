@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// A source waiting for a lock another run holds keeps no other source from opening
+func TestOpenInputWaitsAlone(t *testing.T) {
+	if !fileLocksSupported {
+		t.Skip("files cannot be locked on this system")
+	}
+	dir := t.TempDir()
+	locked, free := filepath.Join(dir, "locked.bmp"), filepath.Join(dir, "free.bmp")
+	for _, name := range []string{locked, free} {
+		if err := os.WriteFile(name, []byte("BM"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writer, err := os.OpenFile(locked, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	if err := lockFile(writer, true); err != nil {
+		t.Fatal(err)
+	}
+	lockFiles = true
+	defer func() { lockFiles = false }()
+
+	open := func(name string) <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			file, err := globalSettings.openInput(name)
+			if err == nil {
+				file.Close()
+			}
+			done <- err
+		}()
+		return done
+	}
+	waiting := open(locked)
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case err := <-open(free):
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("opening a free source waited for the lock of another one")
+	}
+	select {
+	case err := <-waiting:
+		t.Fatalf("opened a source under an exclusive lock: %v", err)
+	default:
+	}
+
+	writer.Close()
+	if err := <-waiting; err != nil {
+		t.Fatal(err)
+	}
+	buffered.Lock()
+	defer buffered.Unlock()
+	if len(buffered.opening) != 0 {
+		t.Errorf("name locks left behind: %v", buffered.opening)
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"creditcard/bmp"
+)
+
+// Number of pixels above which apply processes an image row by row when the options and output allow it
+const streamPixels = 64 << 20
+
+// Filters that work on each pixel on its own and so can be applied to one row at a time
+var rowFilters = []string{"blue", "red", "green", "grayscale", "negative"}
+
+// Transforms row y of the source, counted in file order, or drops it by returning nil
+type rowStage func(y int, pixels []Pixel, alpha []byte) ([]Pixel, []byte)
+
+// Builds the row stages for the options of an image of the given size and returns the size of the
+// result. Only horizontal mirroring, per-pixel filters and crops keep every row on its own.
+func streamStages(options []Option, width, height int) ([]rowStage, int, int, error) {
+	var stages []rowStage
+	// Source rows that earlier crops dropped below the image the next stage sees
+	dropped := 0
+	for _, opt := range options {
+		switch strings.TrimPrefix(opt.Name, "--") {
+		case "mirror":
+			if axis, err := parseMirror(opt.Value); err != nil || axis != "horizontal" {
+				return nil, 0, 0, msgError("error.stream_option", opt.Name, opt.Value)
+			}
+			stages = append(stages, func(_ int, pixels []Pixel, alpha []byte) ([]Pixel, []byte) {
+				slices.Reverse(pixels)
+				slices.Reverse(alpha)
+				return pixels, alpha
+			})
+		case "filter":
+			if !contains(rowFilters, opt.Value) {
+				return nil, 0, 0, msgError("error.stream_option", opt.Name, opt.Value)
+			}
+			name := opt.Value
+			stages = append(stages, func(_ int, pixels []Pixel, alpha []byte) ([]Pixel, []byte) {
+				return bmp.FilterPixels(pixels, len(pixels), 1, name, nil), alpha
+			})
+		case "crop":
+			x, y, w, h, err := parseCrop(opt.Value, width, height)
+			if err != nil {
+				return nil, 0, 0, err
+			}
+			// Offsets are measured from the top while rows arrive bottom-up
+			first, below := height-y-h, dropped
+			stages = append(stages, func(y int, pixels []Pixel, alpha []byte) ([]Pixel, []byte) {
+				if row := y - below; row < first || row >= first+h {
+					return nil, nil
+				}
+				if alpha != nil {
+					alpha = alpha[x : x+w]
+				}
+				return pixels[x : x+w], alpha
+			})
+			width, height, dropped = w, h, dropped+first
+		default:
+			return nil, 0, 0, msgError("error.stream_option", opt.Name, opt.Value)
+		}
+	}
+	return stages, width, height, nil
+}
+
+// Returns an error unless the run writes a single BMP file as it is: no scaled or extra outputs, no
+// intermediate stages or recording and no output options that need the whole image
+func checkStreamOutput(cmd *commandArgs) error {
+	if len(cmd.outputs) != 1 || cmd.outputs[0].Width != 0 || cmd.outputs[0].Height != 0 ||
+		outputFormat(cmd.outputs[0].Filename, cmd.format) != "bmp" || cmd.saveStages != "" || cmd.record != "" ||
+		cmd.settings.Encode.Embed != "" || cmd.settings.Encode.Compact || cmd.settings.Encode.KeepOffset {
+		return msgError("error.stream_output")
+	}
+	return nil
+}
+
+// Reports whether apply processes the image row by row: when --stream or --checkpoint is given, or when
+// the image is too large to hold comfortably in memory and the file, options and output all allow it
+func useStream(cmd *commandArgs, dibHeader *DIBHeader) bool {
+	if cmd.stream || cmd.checkpoint != "" {
+		return true
+	}
+	if int64(dibHeader.Width)*int64(dibHeader.Height) <= streamPixels || !bmp.ReadsRows(dibHeader) {
+		return false
+	}
+	_, _, _, err := streamStages(cmd.options, int(dibHeader.Width), int(dibHeader.Height))
+	return err == nil && checkStreamOutput(cmd) == nil
+}
+
+// Runs the apply options one row at a time from the source file to the output file, so that memory
+// use does not grow with the image
+func runStreamCommand(cmd *commandArgs, bmpHeader *BMPHeader, dibHeader *DIBHeader) error {
+	defer metrics.observeStage("stream", time.Now())
+	if err := checkStreamOutput(cmd); err != nil {
+		return err
+	}
+	stages, width, height, err := streamStages(cmd.options, int(dibHeader.Width), int(dibHeader.Height))
+	if err != nil {
+		return err
+	}
+
+	if cmd.checkpoint != "" {
+		return runCheckpointedStream(cmd, bmpHeader, dibHeader, stages, width, height)
+	}
+	return withRowFiles(cmd, bmpHeader, dibHeader, width, height, func(rows *bmp.RowReader, output *bmp.RowWriter, alpha bool) error {
+		return streamRows(rows, output, stages, alpha, 0, nil)
+	})
+}
+
+// Runs the row stages on the rows of a reader from row start on and writes what they keep, calling done,
+// when it is set, after every row
+func streamRows(rows *bmp.RowReader, output *bmp.RowWriter, stages []rowStage, alpha bool, start int, done func(y int) error) error {
+	pixels := make([]Pixel, rows.Width)
+	var rowAlpha []byte
+	if alpha {
+		rowAlpha = make([]byte, rows.Width)
+	}
+	bar := &progressBar{}
+	for y := start; y < rows.Height; y++ {
+		if showProgress {
+			bar.report("stream", y+1, rows.Height)
+		}
+		if err := rows.Read(pixels, rowAlpha); err != nil {
+			return localizeError(err)
+		}
+		result, resultAlpha := pixels, rowAlpha
+		for _, stage := range stages {
+			if result, resultAlpha = stage(y, result, resultAlpha); result == nil {
+				break
+			}
+		}
+		if result != nil {
+			if err := output.Write(result, resultAlpha); err != nil {
+				return localizeError(err)
+			}
+		}
+		if done != nil {
+			if err := done(y); err != nil {
+				return err
+			}
+		}
+	}
+	if showProgress {
+		bar.finish("stream", nil)
+	}
+	metrics.addPixels(int64(rows.Width) * int64(rows.Height-start) * int64(len(stages)))
+	return nil
+}
+
+// Opens the source file of apply for reading rows and its output file for writing rows of an image of
+// the given size, runs process between them and completes the output. process learns whether the output
+// keeps alpha.
+func withRowFiles(cmd *commandArgs, bmpHeader *BMPHeader, dibHeader *DIBHeader, width, height int, process func(rows *bmp.RowReader, output *bmp.RowWriter, alpha bool) error) error {
+	rows, closeRows, err := openRowReader(cmd, bmpHeader, dibHeader)
+	if err != nil {
+		return err
+	}
+	defer closeRows()
+
+	out, err := cmd.settings.createOutput(cmd.outputs[0].Filename)
+	if err != nil {
+		return msgError("error.create_file", err)
+	}
+	defer out.Close()
+	writer := &writeCounter{Writer: out}
+	defer func() { metrics.addBytesWritten(writer.n) }()
+	dib := *dibHeader
+	dib.Width, dib.Height = int32(width), int32(height)
+	alpha := rows.Alpha && !cmd.settings.Encode.TrueColor
+	output, err := bmp.NewRowWriter(writer, bmpHeader, &dib, alpha)
+	if err != nil {
+		return localizeError(err)
+	}
+
+	if err := process(rows, output, alpha); err != nil {
+		return err
+	}
+	if err := output.Flush(); err != nil {
+		return localizeError(err)
+	}
+	return out.Close()
+}
+
+// Opens the source file of apply for reading rows. closeRows closes it and counts the bytes read.
+func openRowReader(cmd *commandArgs, bmpHeader *BMPHeader, dibHeader *DIBHeader) (rows *bmp.RowReader, closeRows func(), err error) {
+	in, err := cmd.settings.openInput(cmd.filename)
+	if err != nil {
+		return nil, nil, msgError("error.open_file", err)
+	}
+	reader := &readCounter{ReadSeeker: in}
+	closeRows = func() {
+		in.Close()
+		metrics.addBytesRead(reader.n)
+	}
+	opts := cmd.settings.Decode
+	opts.Warn = printWarning
+	if rows, err = bmp.NewRowReader(reader, bmpHeader, dibHeader, opts); err != nil {
+		closeRows()
+		return nil, nil, localizeError(err)
+	}
+	return rows, closeRows, nil
+}
+
+// Reports whether apply processes the image in tiles, which --tile-size and --max-memory ask for
+func useTiles(cmd *commandArgs) bool {
+	return cmd.tileSize > 0 || cmd.maxMemory != ""
+}
+
+// Records the apply options in a library pipeline for tiled processing of an image of the given size.
+// Like streaming it takes mirrors, crops and per-pixel filters, and rotations by multiples of 90 degrees
+// besides, since tiles can be read back in any order.
+func tilePipeline(options []Option, width, height int) (*bmp.Pipeline, error) {
+	p := bmp.NewPipeline()
+	for _, opt := range options {
+		op, ok := findOperation(opt.Name)
+		// Filters that look at neighboring pixels fuse into in-memory pipelines, but not into tiles
+		if !ok || op.Fuse == nil || (op.Name == "filter" && !contains(rowFilters, opt.Value)) {
+			return nil, msgError("error.tile_option", opt.Name, opt.Value)
+		}
+		w, h := p.Size(width, height)
+		if !op.Fuse(p, opt.Value, w, h) {
+			return nil, msgError("error.tile_option", opt.Name, opt.Value)
+		}
+	}
+	return p, nil
+}
+
+// Runs the apply options on square tiles of the image spilled to temporary files, holding no more in
+// memory than --max-memory allows, so that even options that move pixels between rows work on images
+// far larger than memory
+func runTiledCommand(cmd *commandArgs, bmpHeader *BMPHeader, dibHeader *DIBHeader) error {
+	defer metrics.observeStage("tiles", time.Now())
+	if cmd.checkpoint != "" {
+		return msgError("error.checkpoint_tiles")
+	}
+	if err := checkStreamOutput(cmd); err != nil {
+		return err
+	}
+	pipeline, err := tilePipeline(cmd.options, int(dibHeader.Width), int(dibHeader.Height))
+	if err != nil {
+		return err
+	}
+	opts := bmp.TileOptions{TileSize: cmd.tileSize}
+	if cmd.maxMemory != "" {
+		opts.MaxMemory, _ = parseByteSize(cmd.maxMemory)
+	}
+
+	width, height := pipeline.Size(int(dibHeader.Width), int(dibHeader.Height))
+	return withRowFiles(cmd, bmpHeader, dibHeader, width, height, func(rows *bmp.RowReader, output *bmp.RowWriter, alpha bool) error {
+		bar := &progressBar{}
+		var progress rowProgress
+		if showProgress {
+			progress = func(done, total int) { bar.report("tiles", done, total) }
+		}
+		err := pipeline.RunTiles(rows, output, opts, progress)
+		if showProgress {
+			bar.finish("tiles", err)
+		}
+		if err != nil {
+			return localizeError(err)
+		}
+		metrics.addPixels(int64(rows.Width) * int64(rows.Height) * int64(pipeline.Len()))
+		return nil
+	})
+}
+
+// Parses an amount of memory given in bytes or with a K, M or G suffix for binary kilobytes, megabytes
+// and gigabytes, such as 256M
+func parseByteSize(value string) (int64, error) {
+	number, unit := value, int64(1)
+	upper := strings.ToUpper(strings.TrimSuffix(strings.TrimSuffix(value, "B"), "b"))
+	if n := len(upper); n > 0 {
+		switch upper[n-1] {
+		case 'K':
+			number, unit = upper[:n-1], 1<<10
+		case 'M':
+			number, unit = upper[:n-1], 1<<20
+		case 'G':
+			number, unit = upper[:n-1], 1<<30
+		default:
+			number = upper
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n <= 0 || n > math.MaxInt64/unit {
+		return 0, msgError("expect.byte_size")
+	}
+	return n * unit, nil
+}
+
+// Checks a --max-memory value
+func checkByteSize(value string) error {
+	_, err := parseByteSize(value)
+	return err
+}
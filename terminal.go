@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// Set by --color: "auto" colors the error and warning prefixes only on a terminal and unless $NO_COLOR
+// is set or $TERM is dumb, "always" and "never" regardless of both
+var colorMode = "auto"
+
+// Terminal escape sequences of the styles diagnostics use
+const (
+	styleError   = "\x1b[1;31m"
+	styleWarning = "\x1b[1;33m"
+	styleReset   = "\x1b[0m"
+)
+
+// Reports whether a file is a terminal rather than a pipe or a regular file
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Reports whether what is written to a file may be colored
+func colorEnabled(file *os.File) bool {
+	switch colorMode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	return os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" && isTerminal(file)
+}
+
+// Returns text in a style when file may be colored, and as it is otherwise
+func colorize(file *os.File, style, text string) string {
+	if !colorEnabled(file) {
+		return text
+	}
+	return style + text + styleReset
+}
+
+// A writer of tab-separated columns that is flushed once everything is written
+type tableWriter interface {
+	io.Writer
+	Flush() error
+}
+
+// Returns a writer that lines up the tab-separated columns written to w when w is a terminal, and that
+// otherwise turns every tab into one space, so that what scripts read keeps its format
+func newTableWriter(w io.Writer) tableWriter {
+	if file, ok := w.(*os.File); ok && isTerminal(file) {
+		return tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	}
+	return &spacedWriter{w}
+}
+
+// Writes tab-separated columns with one space between them
+type spacedWriter struct {
+	w io.Writer
+}
+
+func (s *spacedWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(s.w, strings.ReplaceAll(string(p), "\t", " ")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *spacedWriter) Flush() error { return nil }
@@ -0,0 +1,10 @@
+//go:build linux && !(mips || mipsle || mips64 || mips64le || ppc64 || ppc64le)
+
+package main
+
+// Requests that read and set the attributes of a terminal, TCGETS and TCSETS, which the syscall package
+// does not define; MIPS and POWER number them differently
+const (
+	ioctlGetTermios = 0x5401
+	ioctlSetTermios = 0x5402
+)
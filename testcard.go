@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Test cards the testcard command draws
+var testcardTypes = []string{"gray-steps", "gamma", "convergence"}
+
+// Gammas of the patches of the gamma card
+var testcardGammas = []float64{1.8, 2.0, 2.2, 2.4, 2.6}
+
+// Most steps of the gray-steps card, one per level
+const maxTestcardSteps = 256
+
+// Part of the width and height of each step, around its center, that analyze measures, leaving out its
+// edges, which blur and bleed into the neighboring steps in photographs
+const testcardSample = 0.6
+
+// Columns and rows of the cells of the convergence card
+const (
+	convergenceColumns = 16
+	convergenceRows    = 9
+)
+
+// Settings of the testcard command
+type testcardConfig struct {
+	kind     string // One of testcardTypes
+	size     string // Size of the card as WxH
+	steps    int    // Steps of the gray-steps card
+	analyze  bool   // Measures a photographed gray-steps card instead of drawing one
+	format   string // "text" or "json", for analyze
+	filename string // Output file, or the photograph with --analyze
+}
+
+// One step of a photographed gray-steps card
+type testcardStep struct {
+	Level    int     `json:"level"`    // Gray level of the step on the card
+	Measured float64 `json:"measured"` // Mean luminance of the step in the photograph, out of 255
+	Noise    float64 `json:"noise"`    // Standard deviation of the luminance within the step
+	// Set when the step differs from the one before by more than their noise added up, and at least one
+	// level, and for the first step
+	Distinct bool `json:"distinct"`
+}
+
+// Measurements printed by testcard --analyze
+type testcardReport struct {
+	Steps []testcardStep `json:"steps"`
+	// Steps told apart from the one before them, counting the first
+	Distinguishable int `json:"distinguishable"`
+	// Dark steps after the first that cannot be told from it, and light steps before the last that cannot be
+	// told from it: shadows crushed to black and highlights clipped to white
+	BlackCrush int `json:"black_crush"`
+	WhiteClip  int `json:"white_clip"`
+	// Set when every step reads lighter than the one before
+	Monotonic bool `json:"monotonic"`
+	// Luminance of the last step less that of the first
+	Contrast float64 `json:"contrast"`
+	// Exponent of the power curve that best maps the levels of the card onto the measured ones, scaled to
+	// the range of the first and last steps: 1 for a faithful display, above 1 when mid-tones come out dark.
+	// 0 when there are no steps between the first and last to fit.
+	Gamma float64 `json:"gamma"`
+}
+
+// Parses the arguments of the testcard command
+func parseTestcardArgs(args []string) (*testcardConfig, error) {
+	cfg := &testcardConfig{kind: "gray-steps", size: "1920x1080", steps: 11, format: "text"}
+	flags := []flagSpec{
+		{Name: "type", Target: &cfg.kind, Choices: testcardTypes},
+		{Name: "size", Target: &cfg.size, Check: checkSize},
+		{Name: "steps", Target: &cfg.steps, Min: 2},
+		{Name: "analyze", Target: &cfg.analyze},
+		{Name: "format", Target: &cfg.format, Choices: []string{"text", "json"}},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.steps > maxTestcardSteps {
+		return nil, msgError("error.invalid_testcard_steps", cfg.steps, maxTestcardSteps)
+	}
+	if len(positional) != 1 {
+		return nil, msgError("usage.testcard")
+	}
+	cfg.filename = positional[0]
+	return cfg, nil
+}
+
+// Draws a test card for calibrating displays, projectors and printers, or measures the steps of a
+// photographed gray-steps card with --analyze
+func runTestcard(args []string) error {
+	cfg, err := parseTestcardArgs(args)
+	if err != nil {
+		return err
+	}
+
+	if cfg.analyze {
+		_, _, img, err := loadConvertInput(cfg.filename, pdfOptions{})
+		if err != nil {
+			return err
+		}
+		report, err := analyzeGraySteps(img, cfg.steps)
+		if err != nil {
+			return err
+		}
+		if cfg.format == "json" {
+			if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+				return msgError("error.write_output", err)
+			}
+			return nil
+		}
+		for i, s := range report.Steps {
+			fmt.Printf("step %d: level %d, measured %.2f, noise %.2f, distinct %t\n", i+1, s.Level, s.Measured,
+				s.Noise, s.Distinct)
+		}
+		fmt.Printf("distinguishable: %d of %d\n", report.Distinguishable, len(report.Steps))
+		fmt.Printf("black_crush: %d\n", report.BlackCrush)
+		fmt.Printf("white_clip: %d\n", report.WhiteClip)
+		fmt.Printf("monotonic: %t\n", report.Monotonic)
+		fmt.Printf("contrast: %.2f\n", report.Contrast)
+		fmt.Printf("gamma: %.2f\n", report.Gamma)
+		return nil
+	}
+
+	width, height, _ := parseSize(cfg.size)
+	var img *Image
+	switch cfg.kind {
+	case "gamma":
+		img = gammaCard(width, height)
+	case "convergence":
+		img = convergenceCard(width, height)
+	default:
+		img = grayStepsCard(width, height, cfg.steps)
+	}
+	return globalSettings.saveOutput(cfg.filename, "", &BMPHeader{}, &DIBHeader{}, img)
+}
+
+// Returns the gray level of step i of a gray-steps card of the given steps, evenly spaced from black to
+// white in sRGB values
+func grayStepLevel(i, steps int) int {
+	return (i*255*2 + steps - 1) / (2 * (steps - 1))
+}
+
+// Returns the column where step i of a gray-steps card of the given width starts
+func grayStepStart(i, steps, width int) int {
+	return i * width / steps
+}
+
+// Draws steps bars of equal width from black on the left to white on the right
+func grayStepsCard(width, height, steps int) *Image {
+	img := &Image{Width: width, Height: height, Pixels: make([]Pixel, width*height)}
+	for i := range steps {
+		v := byte(grayStepLevel(i, steps))
+		for x := grayStepStart(i, steps, width); x < grayStepStart(i+1, steps, width); x++ {
+			for y := range height {
+				setPixelAt(img, x, y, Pixel{Red: v, Green: v, Blue: v})
+			}
+		}
+	}
+	return img
+}
+
+// Draws a patch for every gamma of testcardGammas on alternating black and white lines, which average to
+// half the light of white at any gamma. The patch whose gray matches the lines seen from a distance, where
+// they blur together, is labeled with the gamma of the display.
+func gammaCard(width, height int) *Image {
+	img := &Image{Width: width, Height: height, Pixels: make([]Pixel, width*height)}
+	scale := max(height/120, 1)
+	labelTop := max(height-(glyphHeight+4)*scale, 0)
+	columns := len(testcardGammas)
+	mask := make([]bool, width*height)
+	for i, gamma := range testcardGammas {
+		left, right := i*width/columns, (i+1)*width/columns
+		v := byte(math.Round(255 * math.Pow(0.5, 1/gamma)))
+		patch := Pixel{Red: v, Green: v, Blue: v}
+		// The patch takes the middle half of the column across and the middle third of the lines down
+		pl, pr := left+(right-left)/4, right-(right-left)/4
+		pt, pb := labelTop/3, labelTop*2/3
+		for y := range labelTop {
+			for x := left; x < right; x++ {
+				switch {
+				case x >= pl && x < pr && y >= pt && y < pb:
+					setPixelAt(img, x, y, patch)
+				case y%2 == 0:
+					setPixelAt(img, x, y, Pixel{Red: 255, Green: 255, Blue: 255})
+				}
+			}
+		}
+		label := fmt.Sprintf("%.1f", gamma)
+		stampText(mask, width, height, (left+right-textWidth(label, scale))/2, labelTop+2*scale, label, scale)
+	}
+	paintMask(img, mask, Pixel{Red: 255, Green: 255, Blue: 255})
+	return img
+}
+
+// Draws a white crosshatch on black, with a dot in the middle of every cell and a circle around the
+// center. Misconverged displays and projectors show the lines as colored fringes, and geometry errors
+// bend them.
+func convergenceCard(width, height int) *Image {
+	img := &Image{Width: width, Height: height, Pixels: make([]Pixel, width*height)}
+	white := Pixel{Red: 255, Green: 255, Blue: 255}
+	thickness := max(min(width, height)/540, 1)
+	fill := func(x0, y0, x1, y1 int) {
+		for y := max(y0, 0); y < min(y1, height); y++ {
+			for x := max(x0, 0); x < min(x1, width); x++ {
+				setPixelAt(img, x, y, white)
+			}
+		}
+	}
+	// Lines run along the edges too, so that overscan that hides them shows
+	for i := 0; i <= convergenceColumns; i++ {
+		x := min(i*width/convergenceColumns, width-thickness)
+		fill(x, 0, x+thickness, height)
+	}
+	for i := 0; i <= convergenceRows; i++ {
+		y := min(i*height/convergenceRows, height-thickness)
+		fill(0, y, width, y+thickness)
+	}
+	for i := range convergenceColumns {
+		for j := range convergenceRows {
+			x := (2*i + 1) * width / (2 * convergenceColumns)
+			y := (2*j + 1) * height / (2 * convergenceRows)
+			fill(x-thickness, y-thickness, x+thickness+1, y+thickness+1)
+		}
+	}
+	radius := float64(min(width, height)) * 3 / 8
+	cx, cy := float64(width)/2, float64(height)/2
+	for y := range height {
+		for x := range width {
+			if d := math.Hypot(float64(x)+0.5-cx, float64(y)+0.5-cy); math.Abs(d-radius) < float64(thickness)/2 {
+				setPixelAt(img, x, y, white)
+			}
+		}
+	}
+	return img
+}
+
+// Measures a photograph of a gray-steps card of the given steps, cropped to the card, by the mean and
+// spread of the luminance in the middle of each step
+func analyzeGraySteps(img *Image, steps int) (*testcardReport, error) {
+	if img.Width < 2*steps || img.Height < 2 {
+		return nil, msgError("error.testcard_small", img.Width, img.Height, steps)
+	}
+	report := &testcardReport{Steps: make([]testcardStep, steps), Monotonic: true}
+	margin := (1 - testcardSample) / 2
+	top := int(float64(img.Height) * margin)
+	bottom := max(int(math.Ceil(float64(img.Height)*(1-margin))), top+1)
+	for i := range steps {
+		left, right := grayStepStart(i, steps, img.Width), grayStepStart(i+1, steps, img.Width)
+		inset := int(float64(right-left) * margin)
+		var sum, squares, n float64
+		for y := top; y < bottom; y++ {
+			for x := left + inset; x < max(right-inset, left+inset+1); x++ {
+				v := float64(pixelAt(img, x, y).Luminance()) / 1000
+				sum += v
+				squares += v * v
+				n++
+			}
+		}
+		mean := sum / n
+		report.Steps[i] = testcardStep{
+			Level:    grayStepLevel(i, steps),
+			Measured: mean,
+			Noise:    math.Sqrt(max(squares/n-mean*mean, 0)),
+		}
+	}
+
+	first, last := report.Steps[0], report.Steps[steps-1]
+	distinct := func(a, b testcardStep) bool {
+		return math.Abs(b.Measured-a.Measured) > max(a.Noise+b.Noise, 1)
+	}
+	for i := range report.Steps {
+		s := &report.Steps[i]
+		s.Distinct = i == 0 || distinct(report.Steps[i-1], *s)
+		if s.Distinct {
+			report.Distinguishable++
+		}
+		if i > 0 && s.Measured <= report.Steps[i-1].Measured {
+			report.Monotonic = false
+		}
+	}
+	for i := 1; i < steps-1 && !distinct(first, report.Steps[i]); i++ {
+		report.BlackCrush++
+	}
+	for i := steps - 2; i > 0 && !distinct(report.Steps[i], last); i-- {
+		report.WhiteClip++
+	}
+	report.Contrast = last.Measured - first.Measured
+
+	// Least squares fit of log(measured) = gamma * log(level), both scaled to 0 to 1 by the first and last
+	// steps; steps at or beyond either end have no logarithm and are left out, as are all of them when the
+	// last step is no lighter than the first
+	var xy, xx float64
+	for _, s := range report.Steps[1 : steps-1] {
+		if report.Contrast <= 0 {
+			break
+		}
+		level := float64(s.Level) / 255
+		measured := (s.Measured - first.Measured) / report.Contrast
+		if measured <= 0 || measured >= 1 {
+			continue
+		}
+		xy += math.Log(level) * math.Log(measured)
+		xx += math.Log(level) * math.Log(level)
+	}
+	if xx > 0 {
+		report.Gamma = xy / xx
+	}
+	return report, nil
+}
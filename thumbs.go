@@ -0,0 +1,132 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Settings of the thumbs command
+type thumbsConfig struct {
+	cols       int
+	cell       string // Box every thumbnail is scaled to fit, as WxH
+	padding    int    // Pixels between cells and around the sheet
+	labels     bool   // Writes the file name under every thumbnail
+	sheetColor string
+	dir        string
+	output     string
+}
+
+// Parses the arguments of the thumbs command
+func parseThumbsArgs(args []string) (*thumbsConfig, error) {
+	cfg := &thumbsConfig{cols: 6, cell: "160x120", padding: 8, sheetColor: "#ffffff"}
+	flags := []flagSpec{
+		{Name: "cols", Target: &cfg.cols, Min: 1},
+		{Name: "cell", Target: &cfg.cell, Check: checkSize},
+		{Name: "padding", Target: &cfg.padding},
+		{Name: "labels", Target: &cfg.labels},
+		{Name: "sheet-color", Target: &cfg.sheetColor, Check: checkColor},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 2 {
+		return nil, msgError("usage.thumbs")
+	}
+	cfg.dir, cfg.output = positional[0], positional[1]
+	return cfg, nil
+}
+
+// Tiles thumbnails of every BMP file in a directory, in name order, into one contact sheet. Files that
+// cannot be read are skipped with a warning, so one damaged scan does not hold up the rest.
+func runThumbs(args []string) error {
+	cfg, err := parseThumbsArgs(args)
+	if err != nil {
+		return err
+	}
+	files, err := listBMPFiles(cfg.dir, true)
+	if err != nil {
+		return err
+	}
+	cellWidth, cellHeight, _ := parseSize(cfg.cell)
+	background, _ := parseHexColor(cfg.sheetColor)
+
+	type thumb struct {
+		name string
+		img  *Image
+	}
+	var thumbs []thumb
+	for _, filename := range files {
+		_, _, img, err := globalSettings.loadImage(filename)
+		if err != nil {
+			printWarning(msgError("warning.thumb_skipped", filepath.Base(filename), err))
+			continue
+		}
+		// Thumbnails only shrink, so small images are not blown up into blurry ones
+		if img.Width > cellWidth || img.Height > cellHeight {
+			width, height := fitSize(img.Width, img.Height, cellWidth, cellHeight)
+			img = applyResize(img, width, height, "bilinear", nil)
+		}
+		thumbs = append(thumbs, thumb{name: filepath.Base(filename), img: img})
+	}
+	if len(thumbs) == 0 {
+		return msgError("error.thumbs_empty", cfg.dir)
+	}
+
+	// Labels sit under their thumbnail in the font at its own size, dark on light backgrounds
+	labelHeight, labelColor := 0, Pixel{}
+	if cfg.labels {
+		labelHeight = glyphHeight + cfg.padding/2
+	}
+	if background.Luminance() < 128000 {
+		labelColor = Pixel{Blue: 255, Green: 255, Red: 255}
+	}
+	cols := min(cfg.cols, len(thumbs))
+	rows := (len(thumbs) + cols - 1) / cols
+	width := cols*cellWidth + (cols+1)*cfg.padding
+	height := rows*(cellHeight+labelHeight) + (rows+1)*cfg.padding
+
+	sheet := &Image{Width: width, Height: height, Pixels: make([]Pixel, width*height)}
+	for i := range sheet.Pixels {
+		sheet.Pixels[i] = background
+	}
+	mask := make([]bool, len(sheet.Pixels))
+	for i, t := range thumbs {
+		x := cfg.padding + i%cols*(cellWidth+cfg.padding)
+		y := cfg.padding + i/cols*(cellHeight+labelHeight+cfg.padding)
+		placeThumb(sheet, t.img, x+(cellWidth-t.img.Width)/2, y+(cellHeight-t.img.Height)/2, background)
+		if cfg.labels {
+			label := shortenLabel(t.name, lineCapacity(cellWidth, 1))
+			stampText(mask, width, height, x+(cellWidth-textWidth(label, 1))/2, y+cellHeight+cfg.padding/2, label, 1)
+		}
+	}
+	paintMask(sheet, mask, labelColor)
+	return globalSettings.saveOutput(cfg.output, "", &BMPHeader{}, &DIBHeader{}, sheet)
+}
+
+// Copies a thumbnail into the sheet with its top-left corner at x, y, blending transparent pixels with
+// the background, since the sheet itself has no alpha
+func placeThumb(sheet, img *Image, x, y int, background Pixel) {
+	blend := func(c, b byte, a int) byte { return byte((int(c)*a + int(b)*(255-a) + 127) / 255) }
+	for ty := 0; ty < img.Height; ty++ {
+		for tx := 0; tx < img.Width; tx++ {
+			p := pixelAt(img, tx, ty)
+			if a := int(alphaAt(img, (img.Height-1-ty)*img.Width+tx)); a < 255 {
+				p = Pixel{Blue: blend(p.Blue, background.Blue, a), Green: blend(p.Green, background.Green, a), Red: blend(p.Red, background.Red, a)}
+			}
+			setPixelAt(sheet, x+tx, y+ty, p)
+		}
+	}
+}
+
+// Shortens a label longer than n characters, ending it with dots to show that it goes on
+func shortenLabel(label string, n int) string {
+	runes := []rune(label)
+	if len(runes) <= n {
+		return label
+	}
+	if n <= 3 {
+		return string(runes[:n])
+	}
+	return strings.TrimSpace(string(runes[:n-3])) + "..."
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"creditcard/bmp"
+)
+
+// Most decodes triage runs while minimizing a reproducer, so that large inputs end in reasonable time with
+// a reproducer that is smaller, if not the smallest
+const maxTriageRuns = 5000
+
+// Settings of the triage command
+type triageConfig struct {
+	output   string // Reproducer file, <name>.min<ext> next to the input by default
+	format   string // "text" or "json"
+	filename string
+}
+
+// Pixel format the headers of a file declare, read from its bytes without checking them
+type triageFormat struct {
+	HeaderSize  uint32 `json:"header_size"`
+	Width       int32  `json:"width"`
+	Height      int32  `json:"height"`
+	BitCount    uint16 `json:"bit_count"`
+	Compression uint32 `json:"compression"`
+	ImageSize   uint32 `json:"image_size"`
+	ColorsUsed  uint32 `json:"colors_used"`
+	PixelStart  uint32 `json:"pixel_offset"`
+}
+
+// Part of a file as its headers lay it out, with the bytes of it the input and the reproducer hold
+type triageRegion struct {
+	Name       string `json:"name"` // "file header", "dib header", "bit masks", "color table", "gap", "pixel data" or "trailing"
+	Offset     int    `json:"offset"`
+	Input      int    `json:"input"`
+	Reproducer int    `json:"reproducer"`
+}
+
+// What triage prints about a file
+type triageReport struct {
+	Input string `json:"input"`
+	Size  int    `json:"size"`
+	Mode  string `json:"mode"` // Decoding mode, "strict", "permissive" or "default"
+	// Key of the message the decoder rejects the file with, "panic" when it panics, empty when the file
+	// decodes
+	Rule    string `json:"rule,omitempty"`
+	Kind    string `json:"kind,omitempty"`  // "not_bmp", "invalid", "unsupported", "limit" or "panic"
+	Stage   string `json:"stage,omitempty"` // "headers" or "pixels"
+	Message string `json:"message,omitempty"`
+	// Function of the decoder that panicked, which a reproducer has to panic in as well
+	PanicIn        string        `json:"panic_in,omitempty"`
+	Format         *triageFormat `json:"format,omitempty"` // Only for files that start like BMP files
+	Reproducer     string        `json:"reproducer,omitempty"`
+	ReproducerSize int           `json:"reproducer_size,omitempty"`
+	// Pixel format of the reproducer, smaller than that of the input when its pixels were cut
+	ReproducerFormat *triageFormat  `json:"reproducer_format,omitempty"`
+	Runs             int            `json:"runs,omitempty"` // Decodes the minimization took
+	Layout           []triageRegion `json:"layout,omitempty"`
+}
+
+// How one decode of a file ended
+type triageOutcome struct {
+	rule, kind, stage, message, panicIn string
+}
+
+// Reports whether two decodes failed the same way. Panics also have to come from the same function, as
+// any bug can panic.
+func (o triageOutcome) same(other triageOutcome) bool {
+	return o.rule == other.rule && o.panicIn == other.panicIn
+}
+
+// Parses the arguments of the triage command
+func parseTriageArgs(args []string) (*triageConfig, error) {
+	cfg := &triageConfig{format: "text"}
+	flags := []flagSpec{
+		{Name: "output", Target: &cfg.output},
+		{Name: "format", Target: &cfg.format, Choices: []string{"text", "json"}},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != 1 || (positional[0] == stdioName && cfg.output == "") {
+		return nil, msgError("usage.triage")
+	}
+	cfg.filename = positional[0]
+	if cfg.output == "" {
+		ext := filepath.Ext(cfg.filename)
+		cfg.output = strings.TrimSuffix(cfg.filename, ext) + ".min" + ext
+	}
+	return cfg, nil
+}
+
+// Names the rule of the format a malformed file breaks, as the decoder sees it in the current mode, and
+// writes the smallest file cut from it that breaks the same rule, for fuzzing crashes to be reported and
+// fixed from
+func runTriage(args []string) error {
+	cfg, err := parseTriageArgs(args)
+	if err != nil {
+		return err
+	}
+	logDetail("info.opening_file", cfg.filename)
+	file, err := globalSettings.openInput(cfg.filename)
+	if err != nil {
+		return msgError("error.open_file", err)
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return msgError("error.read_file", err)
+	}
+
+	report := &triageReport{Input: cfg.filename, Size: len(data), Mode: globalSettings.Decode.Mode}
+	if report.Mode == "" {
+		report.Mode = "default"
+	}
+	if f, ok := readTriageFormat(data); ok {
+		report.Format = &f
+	}
+	outcome := triageDecode(data)
+	report.Rule, report.Kind, report.Stage = outcome.rule, outcome.kind, outcome.stage
+	report.Message, report.PanicIn = outcome.message, outcome.panicIn
+
+	if outcome.rule != "" {
+		cut, runs := minimizeReproducer(data, outcome)
+		reproducer := cut.bytes(data)
+		out, err := files.Create(cfg.output)
+		if err != nil {
+			return msgError("error.create_file", err)
+		}
+		if _, err := out.Write(reproducer); err != nil {
+			out.Close()
+			return msgError("error.write_output", err)
+		}
+		if err := out.Close(); err != nil {
+			return msgError("error.write_output", err)
+		}
+		report.Reproducer, report.ReproducerSize, report.Runs = cfg.output, len(reproducer), runs
+		if f, ok := readTriageFormat(reproducer); ok {
+			report.ReproducerFormat = &f
+		}
+		report.Layout = triageLayout(data, cut)
+	}
+
+	if cfg.format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return msgError("error.write_output", err)
+		}
+		return nil
+	}
+	printTriage(report)
+	return nil
+}
+
+// Prints a triage report as text
+func printTriage(report *triageReport) {
+	if f := report.Format; f != nil {
+		fmt.Printf("format: %s\n", f)
+	}
+	if report.Rule == "" {
+		fmt.Printf("rule: none, the file decodes in %s mode\n", report.Mode)
+		return
+	}
+	fmt.Printf("rule: %s (%s, in %s mode)\n", report.Rule, report.Kind, report.Mode)
+	fmt.Printf("stage: %s\n", report.Stage)
+	fmt.Printf("message: %s\n", report.Message)
+	if report.PanicIn != "" {
+		fmt.Printf("panic in: %s\n", report.PanicIn)
+	}
+	fmt.Printf("reproducer: %s, %d of %d bytes after %d decodes\n", report.Reproducer, report.ReproducerSize,
+		report.Size, report.Runs)
+	if f := report.ReproducerFormat; f != nil {
+		fmt.Printf("reproducer format: %s\n", f)
+	}
+	table := newTableWriter(os.Stdout)
+	fmt.Fprintln(table, "region\toffset\tinput\treproducer")
+	for _, r := range report.Layout {
+		fmt.Fprintf(table, "%s\t%d\t%d\t%d\n", r.Name, r.Offset, r.Input, r.Reproducer)
+	}
+	table.Flush()
+}
+
+// Describes the pixel format in a line
+func (f *triageFormat) String() string {
+	return fmt.Sprintf("%dx%d, %d-bit, compression %d, %d-byte DIB header, pixel data at %d", f.Width, f.Height,
+		f.BitCount, f.Compression, f.HeaderSize, f.PixelStart)
+}
+
+// Decodes a file in memory with the current decoding options, keeping warnings to itself, and tells how
+// it failed, if it did
+func triageDecode(data []byte) (outcome triageOutcome) {
+	opts := globalSettings.Decode
+	opts.Warn = nil
+	defer func() {
+		if p := recover(); p != nil {
+			outcome = triageOutcome{rule: "panic", kind: "panic", stage: outcome.stage, message: fmt.Sprint(p),
+				panicIn: panicFunction()}
+		}
+	}()
+	r := bytes.NewReader(data)
+	outcome.stage = "headers"
+	bmpHeader, dibHeader, err := bmp.DecodeHeaders(r, opts)
+	if err == nil {
+		outcome.stage = "pixels"
+		_, err = bmp.DecodePixels(r, bmpHeader, dibHeader, opts)
+	}
+	if err == nil {
+		return triageOutcome{}
+	}
+	outcome.message = localizeError(err).Error()
+	var bmpErr *bmp.Error
+	if !errors.As(err, &bmpErr) {
+		outcome.rule, outcome.kind = "other", "invalid"
+		return outcome
+	}
+	outcome.rule = bmpErr.Key
+	switch {
+	case errors.Is(err, bmp.ErrNotBMP):
+		outcome.kind = "not_bmp"
+	case errors.Is(err, bmp.ErrUnsupported):
+		outcome.kind = "unsupported"
+	case errors.Is(err, bmp.ErrLimit):
+		outcome.kind = "limit"
+	default:
+		outcome.kind = "invalid"
+	}
+	return outcome
+}
+
+// Returns the innermost function of the bmp package on the stack of a panic being recovered, or the
+// innermost function that is not part of the runtime when the decoder itself did not panic
+func panicFunction() string {
+	pc := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pc[:runtime.Callers(3, pc)])
+	first := ""
+	for {
+		frame, more := frames.Next()
+		name := frame.Function
+		if strings.HasPrefix(name, "creditcard/bmp.") {
+			return strings.TrimPrefix(name, "creditcard/")
+		}
+		if first == "" && !strings.HasPrefix(name, "runtime.") {
+			first = name
+		}
+		if !more {
+			return first
+		}
+	}
+}
+
+// Bytes of the input a reproducer is made of
+type triageCut struct {
+	kept [][2]int // Ranges of the input kept, in order
+	// Bytes of the kept ranges replaced, by their position in the input, so that the headers describe the
+	// pixels kept
+	patched map[int]byte
+}
+
+// Returns the bytes of the reproducer
+func (c triageCut) bytes(data []byte) []byte {
+	var out []byte
+	for _, r := range c.kept {
+		start := len(out)
+		out = append(out, data[r[0]:r[1]]...)
+		for pos, b := range c.patched {
+			if pos >= r[0] && pos < r[1] {
+				out[start+pos-r[0]] = b
+			}
+		}
+	}
+	return out
+}
+
+// Returns the number of bytes of the reproducer
+func (c triageCut) length() int {
+	n := 0
+	for _, r := range c.kept {
+		n += r[1] - r[0]
+	}
+	return n
+}
+
+// Returns the cut without the bytes from start to end of the reproducer
+func (c triageCut) remove(start, end int) triageCut {
+	var kept [][2]int
+	pos := 0
+	for _, r := range c.kept {
+		// Part of the range before start and part after end, in reproducer positions
+		from, to := pos, pos+r[1]-r[0]
+		if from < start {
+			kept = append(kept, [2]int{r[0], r[0] + min(to, start) - from})
+		}
+		if to > end {
+			kept = append(kept, [2]int{r[0] + max(end, from) - from, r[1]})
+		}
+		pos = to
+	}
+	return triageCut{kept: kept, patched: c.patched}
+}
+
+// Cuts the input down to bytes that still fail the way it does: first the shortest prefix that does, found
+// by bisection, then, for uncompressed pixels, images of half the height and then half the width, whose
+// headers are patched to match, and last ranges of halving length removed from anywhere. Headers are
+// checked before the pixels they describe, so cutting pixels alone tends to trip a size check first.
+// Returns the cut with the decodes it took.
+func minimizeReproducer(data []byte, outcome triageOutcome) (triageCut, int) {
+	runs := 0
+	fails := func(c triageCut) bool {
+		runs++
+		return triageDecode(c.bytes(data)).same(outcome)
+	}
+
+	// Bisection assumes that prefixes longer than one that fails fail as well. When they do not, the
+	// shortest prefix found may not fail, and the whole input is kept instead.
+	lo, hi := 0, len(data)
+	for hi-lo > 1 && runs < maxTriageRuns {
+		mid := (lo + hi) / 2
+		if fails(triageCut{kept: [][2]int{{0, mid}}}) {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	cut := triageCut{kept: [][2]int{{0, hi}}}
+	if hi < len(data) && !fails(cut) {
+		hi, cut = len(data), triageCut{kept: [][2]int{{0, len(data)}}}
+	}
+
+	if f, ok := readTriageFormat(data); ok && shrinkable(f, hi) {
+		width, rows := int(f.Width), int(max(f.Height, -f.Height))
+		for rows > 1 && runs < maxTriageRuns {
+			c := shrinkPixels(data, hi, f, width, rows/2)
+			if !fails(c) {
+				break
+			}
+			cut, rows = c, rows/2
+		}
+		for width > 1 && runs < maxTriageRuns {
+			c := shrinkPixels(data, hi, f, width/2, rows)
+			if !fails(c) {
+				break
+			}
+			cut, width = c, width/2
+		}
+	}
+
+	for chunk := cut.length() / 2; chunk >= 1 && runs < maxTriageRuns; chunk /= 2 {
+		for start := 0; start < cut.length() && runs < maxTriageRuns; {
+			if c := cut.remove(start, start+chunk); fails(c) {
+				cut = c
+			} else {
+				start += chunk
+			}
+		}
+	}
+	return cut, runs
+}
+
+// Reports whether the headers describe uncompressed pixels that follow them within the first prefix bytes
+// of the file, which shrinkPixels can cut
+func shrinkable(f triageFormat, prefix int) bool {
+	switch {
+	case f.HeaderSize != 12 && f.HeaderSize < 40:
+		return false
+	case f.Compression != 0 && f.Compression != 3 && f.Compression != 6:
+		return false
+	case f.BitCount != 1 && f.BitCount != 4 && f.BitCount != 8 && f.BitCount != 16 && f.BitCount != 24 && f.BitCount != 32:
+		return false
+	}
+	return f.Width > 0 && f.Height != 0 && int64(f.PixelStart) >= 14+int64(f.HeaderSize) && int(f.PixelStart) <= prefix
+}
+
+// Returns the cut of the first prefix bytes of the input that keeps the first rows rows of its pixels, in
+// file order, and the first width pixels of each, with the sizes in the headers patched to match
+func shrinkPixels(data []byte, prefix int, f triageFormat, width, rows int) triageCut {
+	stride := (int(f.Width)*int(f.BitCount) + 31) / 32 * 4
+	newStride := (width*int(f.BitCount) + 31) / 32 * 4
+	start := int(f.PixelStart)
+	kept := [][2]int{{0, start}}
+	for r := range rows {
+		from := start + r*stride
+		to := min(from+newStride, prefix)
+		if from >= to {
+			break
+		}
+		if last := &kept[len(kept)-1]; last[1] == from {
+			last[1] = to
+		} else {
+			kept = append(kept, [2]int{from, to})
+		}
+	}
+	c := triageCut{kept: kept, patched: map[int]byte{}}
+	put := func(pos, size int, v uint32) {
+		for i := range size {
+			c.patched[pos+i] = byte(v >> (8 * i))
+		}
+	}
+	height := rows
+	if f.Height < 0 {
+		height = -rows
+	}
+	if f.HeaderSize == 12 {
+		put(18, 2, uint32(width))
+		put(20, 2, uint32(height))
+	} else {
+		put(18, 4, uint32(width))
+		put(22, 4, uint32(int32(height)))
+		if f.ImageSize != 0 {
+			put(34, 4, uint32(newStride*rows))
+		}
+	}
+	if int(binary.LittleEndian.Uint32(data[2:])) == len(data) {
+		put(2, 4, uint32(c.length()))
+	}
+	return c
+}
+
+// Reads the pixel format from the headers of a BMP file, as far as the file holds them
+func readTriageFormat(data []byte) (triageFormat, bool) {
+	if len(data) < 18 || string(data[:2]) != "BM" {
+		return triageFormat{}, false
+	}
+	le := binary.LittleEndian
+	f := triageFormat{PixelStart: le.Uint32(data[10:]), HeaderSize: le.Uint32(data[14:])}
+	field := func(offset, size int) uint32 {
+		if len(data) < 14+offset+size {
+			return 0
+		}
+		if size == 2 {
+			return uint32(le.Uint16(data[14+offset:]))
+		}
+		return le.Uint32(data[14+offset:])
+	}
+	if f.HeaderSize == 12 {
+		// OS/2 core headers hold 16-bit sizes and no compression
+		f.Width, f.Height = int32(int16(field(4, 2))), int32(int16(field(6, 2)))
+		f.BitCount = uint16(field(10, 2))
+		return f, true
+	}
+	f.Width, f.Height = int32(field(4, 4)), int32(field(8, 4))
+	f.BitCount, f.Compression = uint16(field(14, 2)), field(16, 4)
+	f.ImageSize, f.ColorsUsed = field(20, 4), field(32, 4)
+	return f, true
+}
+
+// Lays out the input by what its headers say, counting the bytes of every part that the cut keeps
+func triageLayout(data []byte, cut triageCut) []triageRegion {
+	f, ok := readTriageFormat(data)
+	var regions []triageRegion
+	end := 0
+	add := func(name string, size int) {
+		size = min(max(size, 0), len(data)-end)
+		if size > 0 {
+			regions = append(regions, triageRegion{Name: name, Offset: end, Input: size})
+			end += size
+		}
+	}
+	add("file header", 14)
+	if ok {
+		add("dib header", int(min(f.HeaderSize, uint32(len(data)))))
+		if f.HeaderSize == 40 && f.Compression == 3 {
+			add("bit masks", 12)
+		} else if f.HeaderSize == 40 && f.Compression == 6 {
+			add("bit masks", 16)
+		}
+		if f.BitCount == 1 || f.BitCount == 4 || f.BitCount == 8 {
+			count := 1 << f.BitCount
+			if f.ColorsUsed > 0 && int(f.ColorsUsed) < count {
+				count = int(f.ColorsUsed)
+			}
+			entrySize := 4
+			if f.HeaderSize == 12 {
+				entrySize = 3
+			}
+			add("color table", count*entrySize)
+		}
+		add("gap", int(f.PixelStart)-end)
+		pixels := int(f.ImageSize)
+		if f.Compression == 0 || f.Compression == 3 || f.Compression == 6 {
+			pixels = (int(f.Width)*int(f.BitCount) + 31) / 32 * 4 * int(max(f.Height, -f.Height))
+		}
+		add("pixel data", pixels)
+	}
+	add("trailing", len(data)-end)
+
+	for i := range regions {
+		r := &regions[i]
+		for _, k := range cut.kept {
+			r.Reproducer += max(min(k[1], r.Offset+r.Input)-max(k[0], r.Offset), 0)
+		}
+	}
+	return regions
+}
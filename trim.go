@@ -0,0 +1,46 @@
+package main
+
+import "creditcard/bmp"
+
+// Modes of --trim: what counts as the empty border that is cut away
+var trimModes = []string{"alpha"}
+
+// Returns the smallest box, measured from the top-left corner, that holds every pixel that is not fully
+// transparent. Opaque images are bounded by their full size; ok is false when every pixel is transparent.
+func alphaBounds(img *Image) (x, y, width, height int, ok bool) {
+	if img.Alpha == nil {
+		return 0, 0, img.Width, img.Height, true
+	}
+	left, right, bottom, top := img.Width, -1, img.Height, -1
+	for row := 0; row < img.Height; row++ {
+		for col := 0; col < img.Width; col++ {
+			if img.Alpha[row*img.Width+col] == 0 {
+				continue
+			}
+			left, right = min(left, col), max(right, col)
+			bottom, top = min(bottom, row), max(top, row)
+		}
+	}
+	if right < 0 {
+		return 0, 0, 0, 0, false
+	}
+	// Rows are stored bottom-up, so the topmost visible row has the highest index
+	return left, img.Height - 1 - top, right - left + 1, top - bottom + 1, true
+}
+
+// Crops the image to the bounding box of its visible pixels. Opaque images are returned unchanged.
+func applyTrim(img *Image, progress rowProgress) (*Image, error) {
+	x, y, w, h, ok := alphaBounds(img)
+	if !ok {
+		return nil, msgError("error.trim_empty")
+	}
+	if w == img.Width && h == img.Height {
+		return img, nil
+	}
+	return &Image{
+		Width:  w,
+		Height: h,
+		Pixels: bmp.CropPixels(img.Pixels, img.Width, img.Height, x, y, w, h, progress),
+		Alpha:  bmp.CropPixels(img.Alpha, img.Width, img.Height, x, y, w, h, nil),
+	}, nil
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"image/png"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Longest side of the low-resolution proxy used for draft previews
+const tuneDraftSize = 256
+
+// Longest side of the full-quality preview shown in the browser
+const tunePreviewSize = 720
+
+// Holds the state of a running tune session
+type tuneSession struct {
+	filename string
+	output   string
+	script   string
+	source   *Image
+	draft    *Image  // Downscaled copy of source for fast previews
+	scale    float64 // draft size divided by source size
+	done     chan string
+}
+
+// Parses tune arguments and serves the tuning UI until the user presses Done
+func runTune(args []string) error {
+	addr := "127.0.0.1:8080"
+	output := "output.bmp"
+	script := ""
+
+	for _, arg := range args {
+		if arg == "-h" || arg == "--help" {
+			displayTuneHelp()
+			return nil
+		}
+	}
+	flags := []flagSpec{
+		{Name: "addr", Target: &addr},
+		{Name: "output", Target: &output},
+		{Name: "script", Target: &script},
+	}
+	_, positional, err := parseCommandLine(args, flags, false)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		return msgError("error.unexpected_arg", positional[1])
+	}
+	if len(positional) == 0 {
+		return msgError("usage.tune")
+	}
+	filename := positional[0]
+
+	_, _, img, err := globalSettings.loadImage(filename)
+	if err != nil {
+		return err
+	}
+
+	s := &tuneSession{filename: filename, output: output, script: script, source: img, done: make(chan string, 1)}
+	s.draft = downscaleToFit(img, tuneDraftSize)
+	s.scale = float64(s.draft.Width) / float64(img.Width)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return msgError("error.start_server", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/preview", s.handlePreview)
+	mux.HandleFunc("/done", s.handleDone)
+	mux.Handle("/metrics", metrics)
+	server := &http.Server{Handler: mux}
+
+	logInfo("info.tuning", filename, listener.Addr())
+	go server.Serve(listener)
+
+	command := <-s.done
+	server.Shutdown(context.Background())
+
+	fmt.Println(command)
+	if s.script != "" {
+		if err := os.WriteFile(nativePath(s.script), []byte("#!/bin/sh\n"+command+"\n"), 0o755); err != nil {
+			return msgError("error.write_script", err)
+		}
+	}
+	return nil
+}
+
+// Serves the tuning page with controls generated from the operation registry
+func (s *tuneSession) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	type paramInfo struct {
+		Name    string   `json:"name"`
+		Kind    string   `json:"kind"`
+		Choices []string `json:"choices,omitempty"`
+		Min     int      `json:"min"`
+		Max     int      `json:"max"`
+		Default string   `json:"default"`
+	}
+	type opInfo struct {
+		Name      string      `json:"name"`
+		Summary   string      `json:"summary"`
+		Separator string      `json:"separator"`
+		Params    []paramInfo `json:"params"`
+	}
+
+	var ops []opInfo
+	for _, op := range operations {
+		info := opInfo{Name: op.Name, Summary: op.Summary, Separator: op.Separator}
+		for _, p := range op.Params {
+			pi := paramInfo{Name: p.Name, Kind: p.Kind, Choices: p.Choices, Min: p.Min, Max: p.Max, Default: p.Default}
+			switch p.Bound {
+			case "width":
+				pi.Max = s.source.Width
+			case "height":
+				pi.Max = s.source.Height
+			}
+			if pi.Default == "" && p.Kind == "int" {
+				pi.Default = strconv.Itoa(pi.Max)
+			}
+			info.Params = append(info.Params, pi)
+		}
+		ops = append(ops, info)
+	}
+
+	data, err := json.Marshal(ops)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	tuneTemplate.Execute(w, map[string]any{
+		"File":       s.filename,
+		"Width":      s.source.Width,
+		"Height":     s.source.Height,
+		"Operations": template.JS(data),
+	})
+}
+
+// Renders the pipeline given in the query as a PNG preview
+func (s *tuneSession) handlePreview(w http.ResponseWriter, r *http.Request) {
+	options, err := queryOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Draft previews run the pipeline on the proxy image with geometry scaled down
+	img := s.source
+	if r.URL.Query().Get("quality") == "draft" {
+		img = s.draft
+		options = scaledOptions(options, s.scale)
+	}
+
+	result, err := applyOptions(img, options)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	png.Encode(w, downscaleToFit(result, tunePreviewSize).ToRGBA())
+}
+
+// Finishes the session with the pipeline given in the query
+func (s *tuneSession) handleDone(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	options, err := queryOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := applyOptions(s.draft, scaledOptions(options, s.scale)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	command := buildApplyCommand(options, s.filename, s.output)
+	fmt.Fprintln(w, command)
+
+	select {
+	case s.done <- command:
+	default:
+	}
+}
+
+// Extracts the ordered "op" query parameters (name=value) into options
+func queryOptions(r *http.Request) ([]Option, error) {
+	var options []Option
+	for _, raw := range r.URL.Query()["op"] {
+		parts := strings.SplitN(raw, "=", 2)
+		if len(parts) != 2 {
+			return nil, msgError("error.invalid_option", raw)
+		}
+		if _, ok := findOperation(parts[0]); !ok {
+			return nil, msgError("error.unknown_option", parts[0])
+		}
+		options = append(options, Option{Name: "--" + strings.TrimPrefix(parts[0], "--"), Value: parts[1]})
+	}
+	return options, nil
+}
+
+// Returns copies of the options with image-bound parameters scaled by factor
+func scaledOptions(options []Option, factor float64) []Option {
+	result := make([]Option, len(options))
+	for i, opt := range options {
+		result[i] = Option{Name: opt.Name, Value: scaleOptionValue(opt, factor)}
+	}
+	return result
+}
+
+// Scales the parameters of an option that are measured in image pixels
+func scaleOptionValue(opt Option, factor float64) string {
+	op, ok := findOperation(opt.Name)
+	if !ok || op.Separator == "" {
+		return opt.Value
+	}
+
+	parts := strings.Split(opt.Value, op.Separator)
+	for i, part := range parts {
+		if i >= len(op.Params) || op.Params[i].Bound == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			continue
+		}
+		scaled := int(float64(n)*factor + 0.5)
+		if scaled < op.Params[i].Min {
+			scaled = op.Params[i].Min
+		}
+		parts[i] = strconv.Itoa(scaled)
+	}
+	return strings.Join(parts, op.Separator)
+}
+
+// Builds the apply command line equivalent to the given options
+func buildApplyCommand(options []Option, filename, output string) string {
+	args := []string{"bitmap", "apply"}
+	for _, opt := range options {
+		args = append(args, shellQuote(opt.Name+"="+opt.Value))
+	}
+	args = append(args, shellQuote(filename), shellQuote(output))
+	return strings.Join(args, " ")
+}
+
+// Quotes an argument for a POSIX shell when it contains special characters, such as spaces in file
+// names. On Windows, whose shells know no single quotes, it is put in double quotes instead, with
+// backslashes before the double quotes inside as programs reading their command line expect.
+func shellQuote(arg string) string {
+	if arg != "" && strings.IndexFunc(arg, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_=./:,%@+", r))
+	}) < 0 {
+		return arg
+	}
+	if runtime.GOOS == "windows" {
+		return `"` + strings.ReplaceAll(arg, `"`, `\"`) + `"`
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// Scales the image down with nearest-neighbor sampling so it fits within maxSize
+func downscaleToFit(img *Image, maxSize int) *Image {
+	if img.Width <= maxSize && img.Height <= maxSize {
+		return img
+	}
+
+	width, height := maxSize, img.Height*maxSize/img.Width
+	if img.Height > img.Width {
+		width, height = img.Width*maxSize/img.Height, maxSize
+	}
+	return resizeImage(img, max(width, 1), max(height, 1))
+}
+
+var tuneTemplate = template.Must(template.New("tune").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>bitmap tune - {{.File}}</title>
+<style>
+body { font-family: sans-serif; display: flex; gap: 24px; margin: 16px; }
+#controls { width: 340px; }
+fieldset { margin-bottom: 12px; }
+label { display: block; margin: 4px 0; }
+input[type=range] { width: 200px; vertical-align: middle; }
+#preview { max-width: 720px; max-height: 720px; image-rendering: pixelated; }
+#command { font-family: monospace; white-space: pre-wrap; background: #f4f4f4; padding: 8px; }
+</style>
+</head>
+<body>
+<div id="controls">
+<h3>{{.File}} ({{.Width}}x{{.Height}})</h3>
+<div id="ops"></div>
+<button id="done">Done</button>
+<p id="command"></p>
+</div>
+<div><img id="preview" alt="preview"><p id="error" style="color: #b00"></p></div>
+<script>
+const operations = {{.Operations}};
+const opsDiv = document.getElementById("ops");
+
+for (const op of operations) {
+	const fs = document.createElement("fieldset");
+	fs.innerHTML = '<legend><label><input type="checkbox" data-op="' + op.name + '"> --' + op.name + '</label></legend><small>' + op.summary + '</small>';
+	op.params.forEach((p, i) => {
+		const label = document.createElement("label");
+		label.textContent = p.name + " ";
+		let input;
+		if (p.kind === "enum") {
+			input = document.createElement("select");
+			for (const c of p.choices) {
+				const o = document.createElement("option");
+				o.value = o.textContent = c;
+				input.appendChild(o);
+			}
+		} else if (p.kind === "file" || p.kind === "text" || (p.kind === "number" && p.min >= p.max)) {
+			input = document.createElement("input");
+			input.type = "text";
+		} else {
+			input = document.createElement("input");
+			input.type = "range";
+			input.min = p.min;
+			input.max = p.max;
+			if (p.kind === "number") input.step = 0.01;
+			const out = document.createElement("output");
+			input.addEventListener("input", () => out.value = input.value);
+			label.appendChild(input);
+			label.appendChild(out);
+			setTimeout(() => out.value = input.value);
+		}
+		input.value = p.default;
+		input.dataset.param = op.name + ":" + i;
+		label.insertBefore(input, label.firstChild.nextSibling);
+		fs.appendChild(label);
+	});
+	opsDiv.appendChild(fs);
+}
+
+function query() {
+	const params = new URLSearchParams();
+	for (const op of operations) {
+		if (!document.querySelector('[data-op="' + op.name + '"]').checked) continue;
+		const values = op.params.map((p, i) => document.querySelector('[data-param="' + op.name + ":" + i + '"]').value);
+		params.append("op", op.name + "=" + values.join(op.separator));
+	}
+	return params.toString();
+}
+
+let generation = 0;
+async function refresh() {
+	const gen = ++generation;
+	const q = query();
+	// Show a fast draft first, then replace it with the full-quality render
+	for (const quality of ["draft", "full"]) {
+		const resp = await fetch("/preview?quality=" + quality + "&" + q);
+		if (gen !== generation) return;
+		if (!resp.ok) {
+			document.getElementById("error").textContent = await resp.text();
+			return;
+		}
+		document.getElementById("error").textContent = "";
+		const url = URL.createObjectURL(await resp.blob());
+		if (gen !== generation) return;
+		document.getElementById("preview").src = url;
+	}
+}
+
+opsDiv.addEventListener("input", refresh);
+opsDiv.addEventListener("change", refresh);
+document.getElementById("done").addEventListener("click", async () => {
+	const resp = await fetch("/done?" + query(), { method: "POST" });
+	document.getElementById("command").textContent = await resp.text();
+});
+refresh();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Pixel-art upscalers of --upscale
+var upscaleAlgorithms = []string{"scale2x", "hq2x", "xbr"}
+
+// Parses an --upscale value of the form algorithm[:factor] with a factor of 2, 3 or 4
+func parseUpscale(value string) (algorithm string, factor int, err error) {
+	algorithm, f, found := strings.Cut(value, ":")
+	factor = 2
+	if found {
+		factor, err = strconv.Atoi(f)
+	}
+	if err != nil || factor < 2 || factor > 4 || !contains(upscaleAlgorithms, algorithm) {
+		return "", 0, msgError("error.invalid_upscale", value)
+	}
+	return algorithm, factor, nil
+}
+
+// Color with alpha, as the upscalers compare and blend it
+type rgba struct{ r, g, b, a float64 }
+
+// Returns the difference of two colors in YUV, weighted as hqx and xBR do, so that changes in
+// brightness count for more than changes in hue
+func (c rgba) distance(o rgba) float64 {
+	dr, dg, db := c.r-o.r, c.g-o.g, c.b-o.b
+	y := 0.299*dr + 0.587*dg + 0.114*db
+	u := -0.169*dr - 0.331*dg + 0.5*db
+	v := 0.5*dr - 0.419*dg - 0.081*db
+	return 48*math.Abs(y) + 7*math.Abs(u) + 6*math.Abs(v) + math.Abs(c.a-o.a)
+}
+
+// Reports whether two colors are alike by the thresholds of hqx
+func (c rgba) similar(o rgba) bool {
+	dr, dg, db := c.r-o.r, c.g-o.g, c.b-o.b
+	y := 0.299*dr + 0.587*dg + 0.114*db
+	u := -0.169*dr - 0.331*dg + 0.5*db
+	v := 0.5*dr - 0.419*dg - 0.081*db
+	return math.Abs(y) <= 48 && math.Abs(u) <= 7 && math.Abs(v) <= 6 && c.a == o.a
+}
+
+// Returns the color that is the given share of the way from c to o
+func (c rgba) mix(o rgba, share float64) rgba {
+	return rgba{c.r + (o.r-c.r)*share, c.g + (o.g-c.g)*share, c.b + (o.b-c.b)*share, c.a + (o.a-c.a)*share}
+}
+
+// Scales pixel art by an integer factor with an algorithm that keeps hard edges and rounds off
+// diagonal staircases instead of blurring them
+func applyUpscale(img *Image, algorithm string, factor int, progress rowProgress) *Image {
+	// The upscalers work top-down, so rows are flipped on the way in and out
+	src := make([]rgba, len(img.Pixels))
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			i := y*img.Width + x
+			p, a := img.Pixels[i], 255.0
+			if img.Alpha != nil {
+				a = float64(img.Alpha[i])
+			}
+			src[(img.Height-1-y)*img.Width+x] = rgba{float64(p.Red), float64(p.Green), float64(p.Blue), a}
+		}
+	}
+
+	width, height := img.Width, img.Height
+	switch {
+	case algorithm == "scale2x" && factor == 3:
+		src = scale3x(src, width, height, progress)
+	case algorithm == "scale2x":
+		// Scale4x is Scale2x applied twice
+		for range factor / 2 {
+			src = scale2x(src, width, height, progress)
+			width, height = width*2, height*2
+		}
+		width, height = img.Width, img.Height
+	default:
+		src = scaleCorners(src, width, height, factor, algorithm, progress)
+	}
+	width, height = img.Width*factor, img.Height*factor
+
+	result := &Image{Width: width, Height: height, Pixels: make([]Pixel, width*height), Gap: img.Gap, Palette: img.Palette}
+	if img.Alpha != nil {
+		result.Alpha = make([]byte, width*height)
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := src[(height-1-y)*width+x]
+			i := y*width + x
+			result.Pixels[i] = Pixel{Blue: byte(math.Round(c.b)), Green: byte(math.Round(c.g)), Red: byte(math.Round(c.r))}
+			if result.Alpha != nil {
+				result.Alpha[i] = byte(math.Round(c.a))
+			}
+		}
+	}
+	return result
+}
+
+// Returns the pixel at x, y of a top-down grid, repeating the edge pixels beyond the borders
+func at(pixels []rgba, width, height, x, y int) rgba {
+	x, y = max(0, min(x, width-1)), max(0, min(y, height-1))
+	return pixels[y*width+x]
+}
+
+// Doubles the image with Scale2x (AdvMAME2x): each corner of a pixel takes the color of its two
+// neighbors on that side when they match each other and differ from the opposite neighbors
+func scale2x(pixels []rgba, width, height int, progress rowProgress) []rgba {
+	result := make([]rgba, len(pixels)*4)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			b, d, e := at(pixels, width, height, x, y-1), at(pixels, width, height, x-1, y), pixels[y*width+x]
+			f, h := at(pixels, width, height, x+1, y), at(pixels, width, height, x, y+1)
+			e0, e1, e2, e3 := e, e, e, e
+			if b != h && d != f {
+				if d == b {
+					e0 = d
+				}
+				if b == f {
+					e1 = f
+				}
+				if d == h {
+					e2 = d
+				}
+				if h == f {
+					e3 = f
+				}
+			}
+			row := 2 * y * 2 * width
+			result[row+2*x], result[row+2*x+1] = e0, e1
+			result[row+2*width+2*x], result[row+2*width+2*x+1] = e2, e3
+		}
+		progress.Report(y+1, height)
+	}
+	return result
+}
+
+// Triples the image with Scale3x (AdvMAME3x), which extends the rules of Scale2x to the edge centers
+func scale3x(pixels []rgba, width, height int, progress rowProgress) []rgba {
+	result := make([]rgba, len(pixels)*9)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := func(dx, dy int) rgba { return at(pixels, width, height, x+dx, y+dy) }
+			a, b, c := p(-1, -1), p(0, -1), p(1, -1)
+			d, e, f := p(-1, 0), p(0, 0), p(1, 0)
+			g, h, i := p(-1, 1), p(0, 1), p(1, 1)
+			out := [9]rgba{e, e, e, e, e, e, e, e, e}
+			if b != h && d != f {
+				if d == b {
+					out[0] = d
+				}
+				if (d == b && e != c) || (b == f && e != a) {
+					out[1] = b
+				}
+				if b == f {
+					out[2] = f
+				}
+				if (d == b && e != g) || (d == h && e != a) {
+					out[3] = d
+				}
+				if (b == f && e != i) || (h == f && e != c) {
+					out[5] = f
+				}
+				if d == h {
+					out[6] = d
+				}
+				if (d == h && e != i) || (h == f && e != g) {
+					out[7] = h
+				}
+				if h == f {
+					out[8] = f
+				}
+			}
+			for k, color := range out {
+				result[(3*y+k/3)*3*width+3*x+k%3] = color
+			}
+		}
+		progress.Report(y+1, height)
+	}
+	return result
+}
+
+// Scales the image by factor, cutting each corner of a pixel along its diagonal where an edge runs past
+// it. hq2x detects edges like hqx, by which neighbors look alike in YUV, and blends the cut 3:1 towards
+// the neighbor; xbr weighs the color differences around the corner like 2xBR and blends the cut evenly.
+func scaleCorners(pixels []rgba, width, height, factor int, algorithm string, progress rowProgress) []rgba {
+	result := make([]rgba, len(pixels)*factor*factor)
+	edge := 0.75
+	if algorithm == "xbr" {
+		edge = 0.5
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			e := pixels[y*width+x]
+			for k := range factor * factor {
+				result[(factor*y+k/factor)*factor*width+factor*x+k%factor] = e
+			}
+			// Corners as the horizontal and vertical direction they point to
+			for _, corner := range [4][2]int{{-1, -1}, {1, -1}, {-1, 1}, {1, 1}} {
+				sx, sy := corner[0], corner[1]
+				// Neighbors in the frame of the corner: dx points towards it horizontally, dy vertically
+				p := func(dx, dy int) rgba { return at(pixels, width, height, x+dx*sx, y+dy*sy) }
+				color, ok := cornerColor(p, algorithm)
+				if !ok {
+					continue
+				}
+				for j := range factor {
+					for i := range factor {
+						// Distance of the sub-pixel center from the corner, in source pixels along each axis
+						u, v := (float64(i)+0.5)/float64(factor), (float64(j)+0.5)/float64(factor)
+						if sx < 0 {
+							u = 1 - u
+						}
+						if sy < 0 {
+							v = 1 - v
+						}
+						u, v = 1-u, 1-v
+						share := 0.0
+						switch {
+						case math.Abs(u+v-0.5) < 1e-9:
+							share = edge
+						case u+v < 0.5:
+							share = 1
+						}
+						if share > 0 {
+							k := (factor*y+j)*factor*width + factor*x + i
+							result[k] = result[k].mix(color, share)
+						}
+					}
+				}
+			}
+		}
+		progress.Report(y+1, height)
+	}
+	return result
+}
+
+// Decides whether an edge cuts the corner that p is oriented towards, returning the color to cut it with
+func cornerColor(p func(dx, dy int) rgba, algorithm string) (rgba, bool) {
+	e, f, h := p(0, 0), p(1, 0), p(0, 1)
+	if algorithm == "hq2x" {
+		// The two neighbors at the corner continue one shape that the opposite neighbors are not part of
+		if f.similar(h) && !e.similar(f) && !f.similar(p(0, -1)) && !h.similar(p(-1, 0)) {
+			return f.mix(h, 0.5), true
+		}
+		return rgba{}, false
+	}
+
+	// 2xBR compares the differences along the corner's diagonal with those across it
+	along := e.distance(p(1, -1)) + e.distance(p(-1, 1)) + p(1, 1).distance(p(2, 0)) + p(1, 1).distance(p(0, 2)) + 4*h.distance(f)
+	across := h.distance(p(-1, 0)) + h.distance(p(1, 2)) + f.distance(p(2, 1)) + f.distance(p(0, -1)) + 4*e.distance(p(1, 1))
+	if along >= across || e == f || e == h {
+		return rgba{}, false
+	}
+	if e.distance(f) <= e.distance(h) {
+		return f, true
+	}
+	return h, true
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Where commands read sources and write outputs. Reads follow io/fs, so that archives, embed.FS and other
+// io/fs implementations need only Create and MkdirAll to serve as one. Names are given as they are on
+// the command line, which may be absolute or hold "..", rather than the slash-separated relative names
+// fs.ValidPath accepts.
+type FileSystem interface {
+	fs.StatFS
+	fs.ReadDirFS
+	// Creates or truncates a file for writing; what is written becomes visible when it is closed
+	Create(name string) (io.WriteCloser, error)
+	// Creates a directory along with any missing parents
+	MkdirAll(name string) error
+}
+
+// File system of sources and outputs, the operating system's own unless an embedding application sets
+// another with SetFileSystem. The batch state is kept there too, next to the outputs it records; other
+// files bitmap keeps for itself, such as config files, the output cache and metrics, always stay on the
+// operating system's file system.
+var files FileSystem = osFileSystem{}
+
+// Makes every command read sources from and write outputs to fsys. It is meant to be called once before
+// any command runs.
+func SetFileSystem(fsys FileSystem) {
+	files = fsys
+}
+
+// Reads a whole file of the file system of sources and outputs
+func readFile(name string) ([]byte, error) {
+	return fs.ReadFile(files, name)
+}
+
+// Writes a whole file of the file system of sources and outputs
+func writeFile(name string, data []byte) error {
+	file, err := files.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Replaces a whole file of the file system of sources and outputs so that an interruption leaves either
+// the old contents or the new ones. The operating system's gets a temporary file of its own in the same
+// directory, renamed over the old one, so that runs replacing the same file do not rename each other's;
+// other file systems take a file whole when it is closed.
+func replaceFile(name string, data []byte) error {
+	if !onOSFileSystem() {
+		return writeFile(name, data)
+	}
+	tmp, err := os.CreateTemp(nativePath(filepath.Dir(name)), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), nativePath(name))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Opens a file of the file system of sources and outputs for adding to its end. On the operating system's
+// each write reaches the file at once; other file systems, which have no appending, take the old contents
+// and what was added when the file is closed.
+func appendFile(name string) (io.WriteCloser, error) {
+	if onOSFileSystem() {
+		return os.OpenFile(nativePath(name), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	}
+	data, err := readFile(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	file, err := files.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// The operating system's file system, reached through nativePath so that long Windows paths work
+type osFileSystem struct{}
+
+func (osFileSystem) Open(name string) (fs.File, error) { return os.Open(nativePath(name)) }
+
+func (osFileSystem) Stat(name string) (fs.FileInfo, error) { return os.Stat(nativePath(name)) }
+
+func (osFileSystem) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(nativePath(name)) }
+
+func (osFileSystem) Create(name string) (io.WriteCloser, error) { return os.Create(nativePath(name)) }
+
+func (osFileSystem) MkdirAll(name string) error { return os.MkdirAll(nativePath(name), 0o755) }
+
+// A file system held in memory, for embedding applications that have no files to give, such as the
+// browser build, and for those that fill it from archives or cloud storage before running commands.
+// Directories exist once MkdirAll creates them or a file is written below them.
+type MemoryFileSystem struct {
+	mu    sync.Mutex
+	files map[string]memoryEntry
+	dirs  map[string]bool
+}
+
+// Contents of a file of a MemoryFileSystem
+type memoryEntry struct {
+	data     []byte
+	modified time.Time
+}
+
+// Returns an empty file system held in memory
+func NewMemoryFileSystem() *MemoryFileSystem {
+	return &MemoryFileSystem{files: make(map[string]memoryEntry), dirs: map[string]bool{".": true}}
+}
+
+// Returns the key a name is stored under: slash-separated and cleaned, so that a.bmp, ./a.bmp and
+// dir/../a.bmp are one file
+func memoryKey(name string) string {
+	return path.Clean(filepath.ToSlash(name))
+}
+
+// Stores a file, replacing any file of the same name
+func (m *MemoryFileSystem) WriteFile(name string, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memoryKey(name)
+	m.files[key] = memoryEntry{data: data, modified: time.Now()}
+	for dir := path.Dir(key); !m.dirs[dir]; dir = path.Dir(dir) {
+		m.dirs[dir] = true
+	}
+}
+
+// Returns the contents of a file
+func (m *MemoryFileSystem) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.files[memoryKey(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return entry.data, nil
+}
+
+func (m *MemoryFileSystem) Open(name string) (fs.File, error) {
+	info, err := m.Stat(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	data, _ := m.ReadFile(name)
+	return &memoryOpenFile{memoryFile{bytes.NewReader(data)}, info}, nil
+}
+
+func (m *MemoryFileSystem) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memoryKey(name)
+	if entry, ok := m.files[key]; ok {
+		return memoryInfo{name: path.Base(key), size: int64(len(entry.data)), modified: entry.modified}, nil
+	}
+	if m.dirs[key] {
+		return memoryInfo{name: path.Base(key), dir: true}, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m *MemoryFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memoryKey(name)
+	if !m.dirs[key] {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	var entries []fs.DirEntry
+	for file, entry := range m.files {
+		if path.Dir(file) == key {
+			entries = append(entries, fs.FileInfoToDirEntry(memoryInfo{name: path.Base(file), size: int64(len(entry.data)), modified: entry.modified}))
+		}
+	}
+	for dir := range m.dirs {
+		if dir != key && path.Dir(dir) == key {
+			entries = append(entries, fs.FileInfoToDirEntry(memoryInfo{name: path.Base(dir), dir: true}))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (m *MemoryFileSystem) Create(name string) (io.WriteCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memoryKey(name)
+	if m.dirs[key] || !m.dirs[path.Dir(key)] {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrInvalid}
+	}
+	return &memoryWriter{fsys: m, name: name}, nil
+}
+
+func (m *MemoryFileSystem) MkdirAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memoryKey(name)
+	if _, ok := m.files[key]; ok {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	for dir := key; !m.dirs[dir]; dir = path.Dir(dir) {
+		m.dirs[dir] = true
+	}
+	return nil
+}
+
+// A file of a MemoryFileSystem opened for reading
+type memoryOpenFile struct {
+	memoryFile
+	info fs.FileInfo
+}
+
+func (f *memoryOpenFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// A file of a MemoryFileSystem being written, stored when it is closed
+type memoryWriter struct {
+	bytes.Buffer
+	fsys *MemoryFileSystem
+	name string
+}
+
+func (w *memoryWriter) Close() error {
+	w.fsys.WriteFile(w.name, w.Bytes())
+	return nil
+}
+
+// What Stat tells of a file or directory of a MemoryFileSystem
+type memoryInfo struct {
+	name     string
+	size     int64
+	modified time.Time
+	dir      bool
+}
+
+func (i memoryInfo) Name() string       { return i.name }
+func (i memoryInfo) Size() int64        { return i.size }
+func (i memoryInfo) ModTime() time.Time { return i.modified }
+func (i memoryInfo) IsDir() bool        { return i.dir }
+func (i memoryInfo) Sys() any           { return nil }
+
+func (i memoryInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0o755
+	}
+	return 0o644
+}
+
+// Reports whether the file system of sources and outputs is the operating system's, the only one whose
+// files can be locked
+func onOSFileSystem() bool {
+	_, ok := files.(osFileSystem)
+	return ok
+}
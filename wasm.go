@@ -0,0 +1,148 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"syscall/js"
+)
+
+// Registers the global bitmap object with decode, apply and encode functions, then keeps the
+// program alive so JavaScript can keep calling them. Images cross the boundary as
+// {width, height, rgba} objects with top-down RGBA rows, ready for canvas ImageData.
+// Failures are returned as Error objects rather than thrown. Browsers give no files, so options
+// that read one, such as --overlay or --remap, read it from memory, where writeFile puts it.
+//
+// Build with GOOS=js GOARCH=wasm go build -o bitmap.wasm and load it with Go's wasm_exec.js.
+func main() {
+	memory := NewMemoryFileSystem()
+	SetFileSystem(memory)
+	js.Global().Set("bitmap", js.ValueOf(map[string]any{
+		"decode":    js.FuncOf(jsDecode),
+		"apply":     js.FuncOf(jsApply),
+		"encode":    js.FuncOf(jsEncode),
+		"writeFile": js.FuncOf(func(this js.Value, args []js.Value) any { return jsWriteFile(memory, args) }),
+		"readFile":  js.FuncOf(func(this js.Value, args []js.Value) any { return jsReadFile(memory, args) }),
+	}))
+	select {}
+}
+
+// bitmap.decode(bytes: Uint8Array) -> image
+func jsDecode(this js.Value, args []js.Value) any {
+	if len(args) != 1 {
+		return jsError(msgError("error.invalid_args"))
+	}
+	data := make([]byte, args[0].Get("length").Int())
+	js.CopyBytesToGo(data, args[0])
+
+	_, _, img, err := globalSettings.decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return jsError(err)
+	}
+	return imageToJS(img)
+}
+
+// bitmap.apply(image, ops: string[]) -> image, where each op is "name=value", e.g. "rotate=right"
+func jsApply(this js.Value, args []js.Value) any {
+	if len(args) != 2 {
+		return jsError(msgError("error.invalid_args"))
+	}
+	img, err := imageFromJS(args[0])
+	if err != nil {
+		return jsError(err)
+	}
+
+	var options []Option
+	for i := 0; i < args[1].Length(); i++ {
+		raw := args[1].Index(i).String()
+		parts := strings.SplitN(raw, "=", 2)
+		if len(parts) != 2 {
+			return jsError(msgError("error.invalid_option", raw))
+		}
+		options = append(options, Option{Name: "--" + strings.TrimPrefix(parts[0], "--"), Value: parts[1]})
+	}
+
+	if img, err = applyOptions(img, options); err != nil {
+		return jsError(err)
+	}
+	return imageToJS(img)
+}
+
+// bitmap.encode(image) -> Uint8Array holding a 24-bit BMP file
+func jsEncode(this js.Value, args []js.Value) any {
+	if len(args) != 1 {
+		return jsError(msgError("error.invalid_args"))
+	}
+	img, err := imageFromJS(args[0])
+	if err != nil {
+		return jsError(err)
+	}
+
+	var out bytes.Buffer
+	if err := globalSettings.encodeImage(&out, &BMPHeader{}, &DIBHeader{}, img); err != nil {
+		return jsError(err)
+	}
+	result := js.Global().Get("Uint8Array").New(out.Len())
+	js.CopyBytesToJS(result, out.Bytes())
+	return result
+}
+
+// bitmap.writeFile(name: string, bytes: Uint8Array) stores a file that options can name
+func jsWriteFile(memory *MemoryFileSystem, args []js.Value) any {
+	if len(args) != 2 {
+		return jsError(msgError("error.invalid_args"))
+	}
+	data := make([]byte, args[1].Get("length").Int())
+	js.CopyBytesToGo(data, args[1])
+	memory.WriteFile(args[0].String(), data)
+	return js.Undefined()
+}
+
+// bitmap.readFile(name: string) -> Uint8Array holding a stored file
+func jsReadFile(memory *MemoryFileSystem, args []js.Value) any {
+	if len(args) != 1 {
+		return jsError(msgError("error.invalid_args"))
+	}
+	data, err := memory.ReadFile(args[0].String())
+	if err != nil {
+		return jsError(msgError("error.open_file", err))
+	}
+	result := js.Global().Get("Uint8Array").New(len(data))
+	js.CopyBytesToJS(result, data)
+	return result
+}
+
+// Converts an image to a {width, height, rgba} object
+func imageToJS(img *Image) js.Value {
+	rgba := img.ToRGBA()
+	array := js.Global().Get("Uint8ClampedArray").New(len(rgba.Pix))
+	js.CopyBytesToJS(array, rgba.Pix)
+	return js.ValueOf(map[string]any{"width": img.Width, "height": img.Height, "rgba": array})
+}
+
+// Converts a {width, height, rgba} object back to an image, dropping the alpha channel
+func imageFromJS(value js.Value) (*Image, error) {
+	width, height := value.Get("width").Int(), value.Get("height").Int()
+	rgba := value.Get("rgba")
+	if width <= 0 || height <= 0 || rgba.Get("length").Int() != width*height*4 {
+		return nil, msgError("error.dimensions", width, height)
+	}
+	data := make([]byte, width*height*4)
+	js.CopyBytesToGo(data, rgba)
+
+	// RGBA rows are top-down while Image rows are bottom-up
+	img := &Image{Width: width, Height: height, Pixels: make([]Pixel, width*height)}
+	for y := 0; y < height; y++ {
+		row := data[(height-1-y)*width*4:]
+		for x := 0; x < width; x++ {
+			img.Pixels[y*width+x] = Pixel{Red: row[x*4], Green: row[x*4+1], Blue: row[x*4+2]}
+		}
+	}
+	return img, nil
+}
+
+// Wraps an error in a JavaScript Error object
+func jsError(err error) js.Value {
+	return js.Global().Get("Error").New(err.Error())
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Largest factor of --zoom
+const maxZoom = 64
+
+// Color of the lines --zoom draws between pixels with :grid
+var gridColor = Pixel{Blue: 0x80, Green: 0x80, Red: 0x80}
+
+// Parses a --zoom value of the form Nx[:grid]
+func parseZoom(value string) (factor int, grid bool, err error) {
+	number, mode, found := strings.Cut(value, ":")
+	number, ok := strings.CutSuffix(number, "x")
+	factor, err = strconv.Atoi(number)
+	if !ok || err != nil || factor < 2 || factor > maxZoom || (found && mode != "grid") {
+		return 0, false, msgError("error.invalid_zoom", value, maxZoom)
+	}
+	return factor, found, nil
+}
+
+// Enlarges every pixel to a factor x factor block. With grid, one-pixel lines run along the borders
+// of the blocks and around the image, which makes the result one pixel wider and taller.
+func applyZoom(img *Image, factor int, grid bool, progress rowProgress) *Image {
+	if !grid {
+		result := resizeImage(img, img.Width*factor, img.Height*factor)
+		progress.Report(result.Height, result.Height)
+		return result
+	}
+
+	width, height := img.Width*factor+1, img.Height*factor+1
+	result := &Image{Width: width, Height: height, Pixels: make([]Pixel, width*height), Gap: img.Gap, Palette: img.Palette}
+	if img.Alpha != nil {
+		result.Alpha = make([]byte, width*height)
+	}
+	// The lines fall on every factor-th row and column counted from either side, so rows can be
+	// mapped bottom-up like the source
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			if x%factor == 0 || y%factor == 0 {
+				result.Pixels[i] = gridColor
+				if result.Alpha != nil {
+					result.Alpha[i] = 255
+				}
+				continue
+			}
+			src := (y/factor)*img.Width + x/factor
+			result.Pixels[i] = img.Pixels[src]
+			if result.Alpha != nil {
+				result.Alpha[i] = img.Alpha[src]
+			}
+		}
+		progress.Report(y+1, height)
+	}
+	return result
+}